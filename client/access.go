@@ -0,0 +1,166 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/schedule"
+)
+
+// AccessPolicy giới hạn ai và khi nào được gọi một route: theo quốc gia của
+// client và khung giờ. Request không thoả policy nhận 403, không tới local
+// service. Khác Backend.Schedule (503 maintenance khi service ngừng phục vụ),
+// đây là quyết định từ chối client.
+type AccessPolicy struct {
+	// AllowCountries là mã quốc gia ISO 3166-1 alpha-2 được phép (rỗng = mọi
+	// quốc gia). Khi được đặt, client không xác định được quốc gia bị từ chối.
+	AllowCountries []string
+
+	// DenyCountries là mã quốc gia bị từ chối, xét sau AllowCountries
+	DenyCountries []string
+
+	// Hours là khung giờ route nhận requests (nil = mọi lúc)
+	Hours *schedule.Schedule
+}
+
+// check trả về lý do từ chối, "" nếu request được phép. Policy nil luôn cho phép.
+func (p *AccessPolicy) check(country string, now time.Time) string {
+	if p == nil {
+		return ""
+	}
+	if len(p.AllowCountries) > 0 && !containsCountry(p.AllowCountries, country) {
+		if country == "" {
+			return "client country is unknown"
+		}
+		return fmt.Sprintf("country %s is not allowed", country)
+	}
+	if country != "" && containsCountry(p.DenyCountries, country) {
+		return fmt.Sprintf("country %s is denied", country)
+	}
+	if !p.Hours.Active(now) {
+		return "outside allowed hours"
+	}
+	return ""
+}
+
+// needsCountry cho biết policy có xét quốc gia không
+func (p *AccessPolicy) needsCountry() bool {
+	return p != nil && (len(p.AllowCountries) > 0 || len(p.DenyCountries) > 0)
+}
+
+func containsCountry(countries []string, country string) bool {
+	for _, c := range countries {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientCountry trả về quốc gia của client: geo_country Core gửi trong
+// metadata, nếu không có thì tra GeoTable theo client IP (hoặc hop đầu tiên
+// của X-Forwarded-For khi TrustForwardedHeaders)
+func (lf *LocalForwarder) clientCountry(info clientInfo, headers http.Header) string {
+	if country := info.Geo["Geo-Country"]; country != "" {
+		return strings.ToUpper(country)
+	}
+	if lf.geoTable == nil {
+		return ""
+	}
+	ip := info.IP
+	if lf.trustForwarded {
+		if first, _, _ := strings.Cut(headers.Get("X-Forwarded-For"), ","); strings.TrimSpace(first) != "" {
+			ip = strings.TrimSpace(first)
+		}
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	return lf.geoTable.Lookup(addr)
+}
+
+// writeForbidden ghi response 403 khi request bị access policy từ chối
+func (lf *LocalForwarder) writeForbidden(w io.Writer) error {
+	const body = "access denied\n"
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		StatusCode: http.StatusForbidden,
+		Status:     "403 Forbidden",
+		Header:     make(http.Header),
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Cache-Control", "no-store")
+	if err := lf.writeResponseHeader(w, resp); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, body)
+	return err
+}
+
+// GeoTable tra quốc gia theo IP từ bảng networks không chồng lên nhau, dùng
+// khi Core không gửi geo_country
+type GeoTable struct {
+	entries []geoEntry // sorted theo địa chỉ đầu của network
+}
+
+type geoEntry struct {
+	prefix  netip.Prefix
+	country string
+}
+
+// LoadGeoTable đọc bảng dạng CSV "network,country" (ví dụ "203.0.113.0/24,VN"),
+// mỗi dòng một network IPv4 hoặc IPv6. Dòng trống và dòng bắt đầu bằng # bị bỏ qua.
+func LoadGeoTable(r io.Reader) (*GeoTable, error) {
+	t := &GeoTable{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		network, country, ok := strings.Cut(text, ",")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected network,country", line)
+		}
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(network))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if len(country) != 2 {
+			return nil, fmt.Errorf("line %d: country %q is not a two-letter code", line, country)
+		}
+		t.entries = append(t.entries, geoEntry{prefix: prefix.Masked(), country: country})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(t.entries, func(i, j int) bool {
+		return t.entries[i].prefix.Addr().Less(t.entries[j].prefix.Addr())
+	})
+	return t, nil
+}
+
+// Lookup trả về quốc gia của addr, "" nếu không có network nào chứa addr
+func (t *GeoTable) Lookup(addr netip.Addr) string {
+	addr = addr.Unmap()
+	// Network cuối cùng bắt đầu không sau addr là network duy nhất có thể chứa nó
+	i := sort.Search(len(t.entries), func(i int) bool {
+		return addr.Less(t.entries[i].prefix.Addr())
+	})
+	if i > 0 && t.entries[i-1].prefix.Contains(addr) {
+		return t.entries[i-1].country
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/schedule"
+)
+
+func TestAccessPolicy_Check(t *testing.T) {
+	hours, err := schedule.Parse([]string{"Mon-Fri 08:00-18:00"}, "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	monday := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	sunday := time.Date(2024, 1, 7, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		policy  *AccessPolicy
+		country string
+		now     time.Time
+		denied  bool
+	}{
+		{"nil policy", nil, "", monday, false},
+		{"allowed country", &AccessPolicy{AllowCountries: []string{"VN", "SG"}}, "sg", monday, false},
+		{"other country", &AccessPolicy{AllowCountries: []string{"VN"}}, "US", monday, true},
+		{"unknown country with allow list", &AccessPolicy{AllowCountries: []string{"VN"}}, "", monday, true},
+		{"denied country", &AccessPolicy{DenyCountries: []string{"US"}}, "US", monday, true},
+		{"unknown country with deny list", &AccessPolicy{DenyCountries: []string{"US"}}, "", monday, false},
+		{"within hours", &AccessPolicy{Hours: hours}, "", monday, false},
+		{"outside hours", &AccessPolicy{Hours: hours}, "", sunday, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := tt.policy.check(tt.country, tt.now); (reason != "") != tt.denied {
+				t.Errorf("check(%q) = %q, want denied %v", tt.country, reason, tt.denied)
+			}
+		})
+	}
+}
+
+func TestGeoTable_Lookup(t *testing.T) {
+	table, err := LoadGeoTable(strings.NewReader("# network,country\n203.0.113.0/24,vn\n\n198.51.100.0/25, US\n2001:db8::/32,SG\n"))
+	if err != nil {
+		t.Fatalf("LoadGeoTable failed: %v", err)
+	}
+	for ip, want := range map[string]string{
+		"203.0.113.7":        "VN",
+		"::ffff:203.0.113.7": "VN",
+		"198.51.100.1":       "US",
+		"198.51.100.200":     "",
+		"2001:db8::1":        "SG",
+		"192.0.2.1":          "",
+	} {
+		if got := table.Lookup(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Lookup(%s) = %q, want %q", ip, got, want)
+		}
+	}
+
+	for _, bad := range []string{"203.0.113.0/24", "203.0.113.0/33,VN", "203.0.113.0/24,VNM"} {
+		if _, err := LoadGeoTable(strings.NewReader(bad)); err == nil {
+			t.Errorf("LoadGeoTable(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestLocalForwarder_Access(t *testing.T) {
+	received := make(chan struct{}, 4)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer backend.Close()
+
+	table, _ := LoadGeoTable(strings.NewReader("203.0.113.0/24,VN\n"))
+	lf := NewLocalForwarder(LocalForwarderOptions{GeoTable: table})
+	lf.AddBackend(Backend{Host: "app", URL: backend.URL, Access: &AccessPolicy{AllowCountries: []string{"VN"}}})
+
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		allowed  bool
+	}{
+		{"country from Core", map[string]string{"geo_country": "vn"}, true},
+		{"country from geoip table", map[string]string{"client_ip": "203.0.113.9"}, true},
+		{"other country", map[string]string{"geo_country": "US", "client_ip": "203.0.113.9"}, false},
+		{"unknown country", map[string]string{"client_ip": "192.0.2.1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, connector := newTestExecStream(t, tt.metadata)
+			result, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: app\r\n\r\n"))
+			if err != nil {
+				t.Fatalf("ForwardRequest failed: %v", err)
+			}
+			if tt.allowed {
+				<-received
+				return
+			}
+			resp := string((<-connector.sendCh).Payload)
+			if result.Source != SourceForbidden || !strings.HasPrefix(resp, "HTTP/1.1 403") {
+				t.Errorf("source %q, response %q, want 403", result.Source, resp)
+			}
+			select {
+			case <-received:
+				t.Error("local service received a denied request")
+			default:
+			}
+		})
+	}
+}
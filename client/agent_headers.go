@@ -0,0 +1,85 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+)
+
+// agentProduct là product token của agent trong Via và User-Agent
+const agentProduct = "tunnel-agent"
+
+// AgentHeaders cấu hình Via và User-Agent suffix mà agent thêm vào requests tới
+// local service, để access logs phân biệt được traffic đi qua tunnel
+type AgentHeaders struct {
+	// Version của agent, ví dụ "v1.2.3"
+	Version string
+
+	// AgentID là pseudonym của agent trong Via ("" dùng "tunnel-agent")
+	AgentID string
+
+	// UserAgent là suffix nối vào User-Agent của client
+	// ("" dùng "tunnel-agent/<Version>", kèm AgentID nếu có)
+	UserAgent string
+}
+
+// agentHeaders là giá trị headers đã build sẵn từ AgentHeaders
+type agentHeaders struct {
+	via       string
+	userAgent string
+}
+
+// newAgentHeaders build headers từ options, nil nếu opts là nil
+func newAgentHeaders(opts *AgentHeaders) *agentHeaders {
+	if opts == nil {
+		return nil
+	}
+	product := agentProduct
+	if opts.Version != "" {
+		product += "/" + headerToken(opts.Version)
+	}
+
+	// RFC 9110 §7.6.3: received-protocol received-by [comment]. Agent luôn nhận
+	// request từ Core dạng HTTP/1.1.
+	pseudonym := agentProduct
+	if opts.AgentID != "" {
+		pseudonym = headerToken(opts.AgentID)
+	}
+	h := &agentHeaders{via: "1.1 " + pseudonym + " (" + product + ")"}
+
+	h.userAgent = opts.UserAgent
+	if h.userAgent == "" {
+		h.userAgent = product
+		if opts.AgentID != "" {
+			h.userAgent += " (agent " + headerToken(opts.AgentID) + ")"
+		}
+	}
+	return h
+}
+
+// apply nối Via và User-Agent suffix vào headers của request tới local service
+func (h *agentHeaders) apply(header http.Header) {
+	if h == nil {
+		return
+	}
+	if prior := header.Get("Via"); prior != "" {
+		header.Set("Via", prior+", "+h.via)
+	} else {
+		header.Set("Via", h.via)
+	}
+	if prior := header.Get("User-Agent"); prior != "" {
+		header.Set("User-Agent", prior+" "+h.userAgent)
+	} else {
+		header.Set("User-Agent", h.userAgent)
+	}
+}
+
+// headerToken thay các ký tự không hợp lệ trong HTTP token (RFC 9110 §5.6.2)
+// bằng "-" để giá trị dùng được trong Via và product token
+func headerToken(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 0x20 && r < 0x7f && !strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return r
+		}
+		return '-'
+	}, s)
+}
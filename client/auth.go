@@ -3,6 +3,7 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
@@ -10,12 +11,14 @@ import (
 
 // Authenticator xử lý authentication với Core Server
 type Authenticator struct {
+	mu           sync.Mutex // bảo vệ token
 	token        string
 	agentID      string
 	version      string
 	capabilities []string
 	metadata     map[string]string
 	timeout      time.Duration
+	publicURL    string
 }
 
 // AuthRequest là payload của FrameAuth
@@ -31,6 +34,7 @@ type AuthRequest struct {
 type AuthResponse struct {
 	Success    bool                   `json:"success"`
 	AgentID    string                 `json:"agent_id,omitempty"`
+	PublicURL  string                 `json:"public_url,omitempty"`
 	ServerTime int64                  `json:"server_time,omitempty"`
 	Config     map[string]interface{} `json:"config,omitempty"`
 	Error      string                 `json:"error,omitempty"`
@@ -48,10 +52,21 @@ func NewAuthenticator(token, agentID, version string, capabilities []string, met
 	}
 }
 
+// SetToken thay token (ví dụ sau khi secret manager rotate token); connection
+// đang chạy giữ nguyên, token mới được gửi ở lần auth tiếp theo
+func (a *Authenticator) SetToken(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = token
+}
+
 // CreateAuthFrame tạo FrameAuth để gửi đến Core
 func (a *Authenticator) CreateAuthFrame() (*v1.Frame, error) {
+	a.mu.Lock()
+	token := a.token
+	a.mu.Unlock()
 	req := AuthRequest{
-		Token:        a.token,
+		Token:        token,
 		AgentID:      a.agentID,
 		Version:      a.version,
 		Capabilities: a.capabilities,
@@ -99,6 +114,12 @@ func (a *Authenticator) HandleAuthResponse(frame *v1.Frame) error {
 	if resp.AgentID != "" {
 		a.agentID = resp.AgentID
 	}
+	a.publicURL = resp.PublicURL
 
 	return nil
 }
+
+// PublicURL trả về public URL Core cấp cho agent (rỗng nếu Core không gửi)
+func (a *Authenticator) PublicURL() string {
+	return a.publicURL
+}
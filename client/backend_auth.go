@@ -0,0 +1,81 @@
+package client
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// BackendAuth là credentials agent dùng khi gọi local service, để local APIs
+// không mở truy cập ẩn danh vẫn tunnel được. Bearer và basic auth thay
+// Authorization header của client; TLS dùng cho mọi request tới backend.
+type BackendAuth struct {
+	// Bearer gửi Authorization: Bearer <token>
+	Bearer string
+
+	// Username và Password gửi HTTP basic auth
+	Username string
+	Password string
+
+	// TLS chứa client certificate (mTLS) và CA của local service
+	// (nil = TLS mặc định của forwarder)
+	TLS *tls.Config
+}
+
+// apply đặt Authorization header của request tới local service
+func (a *BackendAuth) apply(req *http.Request) {
+	switch {
+	case a == nil:
+	case a.Bearer != "":
+		req.Header.Set("Authorization", "Bearer "+a.Bearer)
+	case a.Username != "":
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+}
+
+// clientFor trả về HTTP client cho backend: client riêng khi backend có TLS
+// credentials, transport không keep-alive với ConnectionFresh
+func (lf *LocalForwarder) clientFor(backend Backend) *http.Client {
+	httpClient := lf.httpClient
+	if backend.Auth != nil && backend.Auth.TLS != nil {
+		httpClient = lf.authClient(backend.Auth)
+	}
+	if backend.Connection == ConnectionFresh {
+		httpClient = freshClient(httpClient)
+	}
+	return httpClient
+}
+
+// authClient trả về client dùng TLS config của auth, tạo một lần cho mỗi
+// BackendAuth để connections tới backend được dùng lại. Transport không phải
+// *http.Transport (tests) được dùng nguyên.
+func (lf *LocalForwarder) authClient(auth *BackendAuth) *http.Client {
+	lf.authMu.Lock()
+	defer lf.authMu.Unlock()
+	if c, ok := lf.authClients[auth]; ok {
+		return c
+	}
+
+	transport := lf.httpClient.Transport
+	if t, ok := transport.(*http.Transport); ok {
+		withTLS := t.Clone()
+		withTLS.TLSClientConfig = auth.TLS
+		transport = withTLS
+	}
+	c := &http.Client{Timeout: lf.httpClient.Timeout, Transport: transport}
+	if lf.authClients == nil {
+		lf.authClients = make(map[*BackendAuth]*http.Client)
+	}
+	lf.authClients[auth] = c
+	return c
+}
+
+// dropAuthClients bỏ các clients của backends cũ sau khi bảng routing thay đổi
+func (lf *LocalForwarder) dropAuthClients() {
+	lf.authMu.Lock()
+	clients := lf.authClients
+	lf.authClients = nil
+	lf.authMu.Unlock()
+	for _, c := range clients {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLocalForwarder_BackendAuthHeaders(t *testing.T) {
+	got := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Get("Authorization")
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		name string
+		auth *BackendAuth
+		want string
+	}{
+		{"bearer replaces client header", &BackendAuth{Bearer: "s3cret"}, "Bearer s3cret"},
+		{"basic", &BackendAuth{Username: "agent", Password: "pw"}, "Basic YWdlbnQ6cHc="},
+		{"none keeps client header", nil, "Bearer from-client"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := NewLocalForwarder(LocalForwarderOptions{Backends: []Backend{{Host: "app", URL: backend.URL, Auth: tt.auth}}})
+			stream, _ := newTestExecStream(t, nil)
+			req := "GET / HTTP/1.1\r\nHost: app\r\nAuthorization: Bearer from-client\r\n\r\n"
+			if _, err := lf.ForwardRequest(context.Background(), stream, []byte(req)); err != nil {
+				t.Fatalf("ForwardRequest failed: %v", err)
+			}
+			if auth := <-got; auth != tt.want {
+				t.Errorf("Authorization = %q, want %q", auth, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalForwarder_BackendAuthMTLS(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "0")
+	}))
+	backend.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	backend.StartTLS()
+	defer backend.Close()
+
+	// Certificate của test server dùng luôn làm client certificate
+	roots := backend.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	auth := &BackendAuth{TLS: &tls.Config{RootCAs: roots, Certificates: backend.TLS.Certificates}}
+	lf := NewLocalForwarder(LocalForwarderOptions{Backends: []Backend{
+		{Host: "secure", URL: backend.URL, Auth: auth},
+		{Host: "anonymous", URL: backend.URL, Auth: &BackendAuth{TLS: &tls.Config{RootCAs: roots}}},
+	}})
+
+	stream, connector := newTestExecStream(t, nil)
+	if _, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: secure\r\n\r\n")); err != nil {
+		t.Fatalf("ForwardRequest with client certificate failed: %v", err)
+	}
+	if resp := string((<-connector.sendCh).Payload); !strings.HasPrefix(resp, "HTTP/1.1 200") {
+		t.Errorf("response = %q, want 200", resp)
+	}
+
+	stream, _ = newTestExecStream(t, nil)
+	if _, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: anonymous\r\n\r\n")); err == nil {
+		t.Error("request without client certificate should fail the TLS handshake")
+	}
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"fmt"
+	"net"
+)
+
+// ResolveBindAddress chuyển bind address (IP hoặc tên network interface) thành local
+// address cho dialer. Với interface, IPv4 được ưu tiên, sau đó tới IPv6 global unicast.
+// Trả về nil nếu spec rỗng (OS tự chọn).
+func ResolveBindAddress(spec string) (*net.TCPAddr, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	if ip := net.ParseIP(spec); ip != nil {
+		return &net.TCPAddr{IP: ip}, nil
+	}
+
+	iface, err := net.InterfaceByName(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither an IP address nor a network interface: %w", spec, err)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return nil, fmt.Errorf("network interface %s is down", spec)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("network interface %s: %w", spec, err)
+	}
+
+	var v6 net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			return &net.TCPAddr{IP: ip4}, nil
+		}
+		if v6 == nil && ipNet.IP.IsGlobalUnicast() {
+			v6 = ipNet.IP
+		}
+	}
+	if v6 != nil {
+		return &net.TCPAddr{IP: v6}, nil
+	}
+	return nil, fmt.Errorf("network interface %s has no usable IP address", spec)
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"net"
+	"testing"
+)
+
+func TestResolveBindAddress(t *testing.T) {
+	if addr, err := ResolveBindAddress(""); err != nil || addr != nil {
+		t.Errorf("empty spec: got %v, %v; want nil, nil", addr, err)
+	}
+
+	addr, err := ResolveBindAddress("127.0.0.1")
+	if err != nil || !addr.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("IP spec: got %v, %v", addr, err)
+	}
+
+	if _, err := ResolveBindAddress("no-such-interface0"); err == nil {
+		t.Error("expected error for unknown interface")
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Skipf("list interfaces: %v", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback == 0 || iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addr, err := ResolveBindAddress(iface.Name)
+		if err != nil {
+			t.Fatalf("loopback interface %s: %v", iface.Name, err)
+		}
+		if !addr.IP.IsLoopback() {
+			t.Errorf("loopback interface %s resolved to %v", iface.Name, addr.IP)
+		}
+		return
+	}
+	t.Skip("no loopback interface")
+}
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Giá trị mặc định của BodyScanOptions
+const (
+	defaultScanMaxSize = 10 << 20
+	defaultScanTimeout = 10 * time.Second
+)
+
+var (
+	// ErrScanBlocked khi scanner chặn body; agent trả 403
+	ErrScanBlocked = errors.New("body blocked by content scan")
+	// ErrScanUnavailable khi không scan được body (scanner lỗi, timeout hoặc
+	// body vượt MaxSize) và FailOpen tắt; agent trả 503
+	ErrScanUnavailable = errors.New("content scan unavailable")
+)
+
+// BodyScanOptions cấu hình content scan (DLP, malware) của một route
+type BodyScanOptions struct {
+	// URL của scanner; agent POST body tới URL, 2xx cho phép, 403 chặn
+	URL string
+	// Requests và Responses chọn body được scan
+	Requests  bool
+	Responses bool
+	// MinSize: body nhỏ hơn được gửi tiếp không scan (0 = scan mọi body khác rỗng)
+	MinSize int64
+	// MaxSize là số bytes tối đa được buffer để scan (default 10 MiB)
+	MaxSize int64
+	// Timeout của mỗi lần gọi scanner (default 10s)
+	Timeout time.Duration
+	// FailOpen gửi tiếp body không scan khi scanner không khả dụng hoặc body
+	// vượt MaxSize thay vì trả 503
+	FailOpen bool
+	// HTTPClient gọi scanner (nil = client mặc định)
+	HTTPClient *http.Client
+}
+
+// BodyScanner gửi request/response body tới scanner ngoài trước khi forward,
+// tương tự ICAP REQMOD/RESPMOD: body được buffer (tối đa MaxSize), scanner
+// quyết định cho phép hay chặn, body được forward nguyên vẹn với Content-Length.
+type BodyScanner struct {
+	url       string
+	requests  bool
+	responses bool
+	minSize   int64
+	maxSize   int64
+	timeout   time.Duration
+	failOpen  bool
+	client    *http.Client
+}
+
+// NewBodyScanner tạo scanner từ opts
+func NewBodyScanner(opts BodyScanOptions) (*BodyScanner, error) {
+	if opts.URL == "" {
+		return nil, errors.New("scanner URL is empty")
+	}
+	if !opts.Requests && !opts.Responses {
+		return nil, errors.New("neither requests nor responses are scanned")
+	}
+	s := &BodyScanner{
+		url:       opts.URL,
+		requests:  opts.Requests,
+		responses: opts.Responses,
+		minSize:   opts.MinSize,
+		maxSize:   opts.MaxSize,
+		timeout:   opts.Timeout,
+		failOpen:  opts.FailOpen,
+		client:    opts.HTTPClient,
+	}
+	if s.maxSize <= 0 {
+		s.maxSize = defaultScanMaxSize
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultScanTimeout
+	}
+	if s.client == nil {
+		s.client = &http.Client{}
+	}
+	return s, nil
+}
+
+// scanInfo mô tả message được scan, gửi tới scanner qua X-Scan-* headers
+type scanInfo struct {
+	Direction   string // request hoặc response
+	Method      string
+	Host        string
+	Path        string
+	ClientIP    string
+	Status      int // chỉ với response
+	ContentType string
+}
+
+// scan đọc body và gửi tới scanner khi body đủ MinSize. Trả về body để
+// forward tiếp và độ dài của nó (-1 khi body không được buffer hết, chỉ xảy
+// ra với FailOpen). Lỗi wrap ErrScanBlocked hoặc ErrScanUnavailable khi
+// scanner chặn hoặc không scan được.
+func (s *BodyScanner) scan(ctx context.Context, body io.Reader, info scanInfo) (io.Reader, int64, error) {
+	buf, err := io.ReadAll(io.LimitReader(body, s.maxSize+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(buf)) > s.maxSize {
+		if s.failOpen {
+			return io.MultiReader(bytes.NewReader(buf), body), -1, nil
+		}
+		return nil, 0, fmt.Errorf("%w: %s body is larger than %d bytes", ErrScanUnavailable, info.Direction, s.maxSize)
+	}
+	if len(buf) == 0 || int64(len(buf)) < s.minSize {
+		return bytes.NewReader(buf), int64(len(buf)), nil
+	}
+
+	if err := s.call(ctx, buf, info); err != nil {
+		if errors.Is(err, ErrScanUnavailable) && s.failOpen {
+			return bytes.NewReader(buf), int64(len(buf)), nil
+		}
+		return nil, 0, err
+	}
+	return bytes.NewReader(buf), int64(len(buf)), nil
+}
+
+// call gửi body tới scanner
+func (s *BodyScanner) call(ctx context.Context, body []byte, info scanInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScanUnavailable, err)
+	}
+	if info.ContentType != "" {
+		req.Header.Set("Content-Type", info.ContentType)
+	}
+	req.Header.Set("X-Scan-Direction", info.Direction)
+	req.Header.Set("X-Scan-Method", info.Method)
+	req.Header.Set("X-Scan-Host", info.Host)
+	req.Header.Set("X-Scan-Path", info.Path)
+	if info.ClientIP != "" {
+		req.Header.Set("X-Scan-Client-IP", info.ClientIP)
+	}
+	if info.Status != 0 {
+		req.Header.Set("X-Scan-Status", strconv.Itoa(info.Status))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScanUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusForbidden:
+		// Dòng đầu của response là lý do chặn, chỉ dùng để log
+		reason, _ := bufio.NewReader(io.LimitReader(resp.Body, 256)).ReadString('\n')
+		if reason = strings.TrimSpace(reason); reason != "" {
+			return fmt.Errorf("%w: %s", ErrScanBlocked, reason)
+		}
+		return ErrScanBlocked
+	default:
+		return fmt.Errorf("%w: scanner returned %s", ErrScanUnavailable, resp.Status)
+	}
+}
+
+// writeScanRejected ghi 403 khi scanner chặn body, 503 khi không scan được
+func (lf *LocalForwarder) writeScanRejected(w io.Writer, err error) error {
+	status, body := http.StatusForbidden, "blocked by content scan\n"
+	if !errors.Is(err, ErrScanBlocked) {
+		status, body = http.StatusServiceUnavailable, "content scan unavailable\n"
+	}
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     make(http.Header),
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Cache-Control", "no-store")
+	if err := lf.writeResponseHeader(w, resp); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, body)
+	return err
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestScanner chặn mọi body chứa "secret"
+func newTestScanner(t *testing.T, scanned chan<- string) *httptest.Server {
+	t.Helper()
+	scanner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		scanned <- r.Header.Get("X-Scan-Direction") + " " + string(body)
+		if strings.Contains(string(body), "secret") {
+			http.Error(w, "DLP rule 7", http.StatusForbidden)
+		}
+	}))
+	t.Cleanup(scanner.Close)
+	return scanner
+}
+
+func TestBodyScanner_Scan(t *testing.T) {
+	scanned := make(chan string, 8)
+	scanner := newTestScanner(t, scanned)
+	s, err := NewBodyScanner(BodyScanOptions{URL: scanner.URL, Requests: true, MinSize: 4, MaxSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := scanInfo{Direction: "request"}
+
+	// Body nhỏ hơn MinSize không được gửi tới scanner
+	body, length, err := s.scan(context.Background(), strings.NewReader("abc"), info)
+	if err != nil || length != 3 {
+		t.Fatalf("small body: length %d, err %v", length, err)
+	}
+	if got, _ := io.ReadAll(body); string(got) != "abc" {
+		t.Errorf("small body = %q, want abc", got)
+	}
+	select {
+	case got := <-scanned:
+		t.Errorf("small body was scanned: %q", got)
+	default:
+	}
+
+	if _, _, err := s.scan(context.Background(), strings.NewReader("clean body"), info); err != nil {
+		t.Errorf("clean body: %v", err)
+	}
+	if got := <-scanned; got != "request clean body" {
+		t.Errorf("scanner received %q", got)
+	}
+
+	_, _, err = s.scan(context.Background(), strings.NewReader("a secret"), info)
+	if !errors.Is(err, ErrScanBlocked) || !strings.Contains(err.Error(), "DLP rule 7") {
+		t.Errorf("blocked body: got %v, want ErrScanBlocked with reason", err)
+	}
+	<-scanned
+
+	_, _, err = s.scan(context.Background(), strings.NewReader("more than sixteen bytes"), info)
+	if !errors.Is(err, ErrScanUnavailable) {
+		t.Errorf("large body: got %v, want ErrScanUnavailable", err)
+	}
+
+	// Scanner không khả dụng: FailOpen gửi tiếp body không scan
+	down, _ := NewBodyScanner(BodyScanOptions{URL: "http://127.0.0.1:1", Requests: true})
+	if _, _, err := down.scan(context.Background(), strings.NewReader("body"), info); !errors.Is(err, ErrScanUnavailable) {
+		t.Errorf("scanner down: got %v, want ErrScanUnavailable", err)
+	}
+	down.failOpen = true
+	if _, length, err := down.scan(context.Background(), strings.NewReader("body"), info); err != nil || length != 4 {
+		t.Errorf("scanner down with fail open: length %d, err %v", length, err)
+	}
+}
+
+func TestLocalForwarder_BodyScan(t *testing.T) {
+	scanned := make(chan string, 8)
+	scanner := newTestScanner(t, scanned)
+	received := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		io.WriteString(w, r.URL.Query().Get("reply"))
+	}))
+	defer backend.Close()
+
+	s, err := NewBodyScanner(BodyScanOptions{URL: scanner.URL, Requests: true, Responses: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf := NewLocalForwarder(LocalForwarderOptions{})
+	lf.AddBackend(Backend{Host: "app", URL: backend.URL, Scan: s})
+
+	forward := func(reply, body string) (*ForwardResult, string) {
+		t.Helper()
+		stream, connector := newTestExecStream(t, nil)
+		close(stream.dataOut)
+		req := fmt.Sprintf("POST /?reply=%s HTTP/1.1\r\nHost: app\r\nContent-Length: %d\r\n\r\n%s", reply, len(body), body)
+		result, err := lf.ForwardRequest(context.Background(), stream, []byte(req))
+		if err != nil {
+			t.Fatalf("ForwardRequest failed: %v", err)
+		}
+		var resp strings.Builder
+		for len(connector.sendCh) > 0 {
+			resp.Write((<-connector.sendCh).Payload)
+		}
+		return result, resp.String()
+	}
+
+	// Request và response sạch được scan rồi forward
+	result, resp := forward("ok", "hello")
+	if result.Source != SourceLocal || !strings.HasSuffix(resp, "ok") || <-received != "hello" {
+		t.Errorf("clean exchange: source %q, response %q", result.Source, resp)
+	}
+	if got := <-scanned + ", " + <-scanned; got != "request hello, response ok" {
+		t.Errorf("scanned %q", got)
+	}
+
+	// Request bị chặn không tới local service
+	result, resp = forward("ok", "my secret")
+	if result.Source != SourceScanBlocked || !strings.HasPrefix(resp, "HTTP/1.1 403") {
+		t.Errorf("blocked request: source %q, response %q", result.Source, resp)
+	}
+	select {
+	case got := <-received:
+		t.Errorf("local service received blocked body %q", got)
+	default:
+	}
+	<-scanned
+
+	// Response bị chặn không tới client
+	result, resp = forward("secret", "hello")
+	if result.Source != SourceScanBlocked || !strings.HasPrefix(resp, "HTTP/1.1 403") || strings.Contains(resp, "secret") {
+		t.Errorf("blocked response: source %q, response %q", result.Source, resp)
+	}
+}
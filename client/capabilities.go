@@ -0,0 +1,115 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Capabilities được agent advertise trong AuthRequest.Capabilities
+const (
+	CapabilityHTTPForward  = "http-forward"
+	CapabilityTCPForward   = "tcp-forward"
+	CapabilityExec         = "exec"
+	CapabilitySOCKSExit    = "socks-exit"
+	CapabilityFileTransfer = "file-transfer"
+	CapabilityEvents       = "events"
+)
+
+// knownCapabilities là danh sách tất cả capabilities hợp lệ
+var knownCapabilities = []string{
+	CapabilityHTTPForward,
+	CapabilityTCPForward,
+	CapabilityExec,
+	CapabilitySOCKSExit,
+	CapabilityFileTransfer,
+	CapabilityEvents,
+}
+
+// DefaultCapabilities là capabilities được bật khi config không chỉ định allowlist
+var DefaultCapabilities = []string{
+	CapabilityHTTPForward,
+	CapabilityFileTransfer,
+	CapabilityEvents,
+}
+
+// Capabilities là allowlist các feature agent chấp nhận
+type Capabilities struct {
+	allowed map[string]bool
+}
+
+// NewCapabilities tạo allowlist từ danh sách capability names
+func NewCapabilities(names []string) (*Capabilities, error) {
+	c := &Capabilities{allowed: make(map[string]bool)}
+	for _, name := range names {
+		if !isKnownCapability(name) {
+			return nil, fmt.Errorf("unknown capability %q (known: %v)", name, knownCapabilities)
+		}
+		c.allowed[name] = true
+	}
+	return c, nil
+}
+
+// Allows kiểm tra capability có được bật không
+func (c *Capabilities) Allows(name string) bool {
+	if c == nil {
+		return false
+	}
+	return c.allowed[name]
+}
+
+// AllowsKind kiểm tra stream kind có được phép không
+func (c *Capabilities) AllowsKind(kind string) bool {
+	return c.Allows(CapabilityForKind(kind))
+}
+
+// List trả về danh sách capabilities được bật (sorted)
+func (c *Capabilities) List() []string {
+	list := make([]string, 0, len(c.allowed))
+	for name := range c.allowed {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Refused trả về danh sách capabilities đã biết nhưng không được bật
+func (c *Capabilities) Refused() []string {
+	var list []string
+	for _, name := range knownCapabilities {
+		if !c.allowed[name] {
+			list = append(list, name)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// CapabilityForKind map stream kind sang capability tương ứng
+func CapabilityForKind(kind string) string {
+	switch kind {
+	case StreamKindHTTP:
+		return CapabilityHTTPForward
+	case StreamKindExec:
+		return CapabilityExec
+	case StreamKindFile:
+		return CapabilityFileTransfer
+	case StreamKindEvent:
+		return CapabilityEvents
+	case StreamKindTCP:
+		return CapabilityTCPForward
+	case StreamKindSOCKS:
+		return CapabilitySOCKSExit
+	default:
+		return kind
+	}
+}
+
+// isKnownCapability kiểm tra tên capability hợp lệ
+func isKnownCapability(name string) bool {
+	for _, known := range knownCapabilities {
+		if known == name {
+			return true
+		}
+	}
+	return false
+}
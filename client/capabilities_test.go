@@ -0,0 +1,111 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewCapabilities_RejectsUnknownName(t *testing.T) {
+	for _, names := range [][]string{
+		{"shell"},
+		{CapabilityHTTPForward, "Exec"},
+		{""},
+	} {
+		if caps, err := NewCapabilities(names); err == nil {
+			t.Errorf("NewCapabilities(%q) = %v, want error", names, caps.List())
+		}
+	}
+
+	caps, err := NewCapabilities(nil)
+	if err != nil {
+		t.Fatalf("NewCapabilities(nil): %v", err)
+	}
+	if len(caps.List()) != 0 {
+		t.Errorf("empty allowlist enables %v", caps.List())
+	}
+}
+
+func TestCapabilities_DefaultDeniesRiskyKinds(t *testing.T) {
+	caps, err := NewCapabilities(DefaultCapabilities)
+	if err != nil {
+		t.Fatalf("NewCapabilities: %v", err)
+	}
+
+	// Exec, TCP forward và SOCKS exit phải được bật rõ ràng trong config
+	for _, kind := range []string{StreamKindExec, StreamKindTCP, StreamKindSOCKS} {
+		if caps.AllowsKind(kind) {
+			t.Errorf("default capabilities allow %q streams", kind)
+		}
+	}
+	for _, kind := range []string{StreamKindHTTP, StreamKindFile, StreamKindEvent} {
+		if !caps.AllowsKind(kind) {
+			t.Errorf("default capabilities refuse %q streams", kind)
+		}
+	}
+
+	// Kind lạ không map sang capability nào nên không bao giờ được phép
+	if caps.AllowsKind("shell") || caps.Allows("shell") {
+		t.Error("unknown kind allowed")
+	}
+
+	var none *Capabilities
+	if none.Allows(CapabilityHTTPForward) || none.AllowsKind(StreamKindHTTP) {
+		t.Error("nil allowlist allows streams")
+	}
+}
+
+func TestCapabilities_ExplicitAllowlist(t *testing.T) {
+	caps, err := NewCapabilities([]string{CapabilityExec, CapabilityTCPForward, CapabilityExec})
+	if err != nil {
+		t.Fatalf("NewCapabilities: %v", err)
+	}
+	if !caps.AllowsKind(StreamKindExec) || !caps.AllowsKind(StreamKindTCP) {
+		t.Error("explicitly enabled kinds are refused")
+	}
+	// HTTP không có trong allowlist: config chỉ định allowlist thay thế defaults
+	if caps.AllowsKind(StreamKindHTTP) {
+		t.Error("http allowed without being listed")
+	}
+	if want := []string{CapabilityExec, CapabilityTCPForward}; !reflect.DeepEqual(caps.List(), want) {
+		t.Errorf("List() = %v, want %v", caps.List(), want)
+	}
+}
+
+func TestCapabilities_RefusedInAuthRequest(t *testing.T) {
+	caps, err := NewCapabilities(DefaultCapabilities)
+	if err != nil {
+		t.Fatalf("NewCapabilities: %v", err)
+	}
+	refused := caps.Refused()
+	if want := []string{CapabilityExec, CapabilitySOCKSExit, CapabilityTCPForward}; !reflect.DeepEqual(refused, want) {
+		t.Fatalf("Refused() = %v, want %v", refused, want)
+	}
+
+	// Agent gửi allowlist trong capabilities và danh sách bị từ chối trong
+	// metadata capabilities_refused để Core không route streams đó tới agent
+	metadata := map[string]string{"capabilities_refused": strings.Join(refused, ",")}
+	frame, err := NewAuthenticator("token", "agent-1", "test", caps.List(), metadata).CreateAuthFrame()
+	if err != nil {
+		t.Fatalf("CreateAuthFrame: %v", err)
+	}
+	var req AuthRequest
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		t.Fatalf("decode auth request: %v", err)
+	}
+	if !reflect.DeepEqual(req.Capabilities, caps.List()) {
+		t.Errorf("auth capabilities = %v, want %v", req.Capabilities, caps.List())
+	}
+	if got := req.Metadata["capabilities_refused"]; got != "exec,socks-exit,tcp-forward" {
+		t.Errorf("capabilities_refused = %q", got)
+	}
+
+	all, err := NewCapabilities(knownCapabilities)
+	if err != nil {
+		t.Fatalf("NewCapabilities: %v", err)
+	}
+	if r := all.Refused(); len(r) != 0 {
+		t.Errorf("all capabilities enabled, Refused() = %v", r)
+	}
+}
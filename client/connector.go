@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/hydragon2m/tunnel-agent/internal/chaos"
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
 	"github.com/hydragon2m/tunnel-agent/internal/health"
 	"github.com/hydragon2m/tunnel-agent/internal/logger"
 	"github.com/hydragon2m/tunnel-agent/internal/metrics"
@@ -19,12 +22,30 @@ import (
 type Connector struct {
 	serverAddr string
 	tlsConfig  *tls.Config
+	transport  Transport
 
 	// Connection state
 	conn      net.Conn
 	connMu    sync.RWMutex
 	connected bool
-	sendCh    chan *v1.Frame // Channel for async writes
+	connDone  chan struct{}  // đóng khi connection hiện tại bị Disconnect (dừng writeLoop)
+	sendCh    chan *v1.Frame // Channel for async writes (PriorityNormal và control frames)
+	urgentCh  chan *v1.Frame // Frames của streams PriorityHigh, được ghi trước sendCh
+	bulkCh    chan *v1.Frame // Frames của streams PriorityLow, chỉ ghi khi hai queue kia rỗng
+
+	// Frames writeLoop đã lấy khỏi send queues để xếp lượt giữa các streams
+	fairQuantum int
+	fairLimit   int
+	scheduled   atomic.Int64
+
+	// Frames đã vào send queues mà writeLoop chưa lấy ra khỏi scheduler
+	pending atomic.Int64
+	// closing = true khi Shutdown bắt đầu, send queues không nhận frame mới
+	closing atomic.Bool
+
+	// Frames gửi bằng SendFrameAcked đang chờ writeLoop ghi xong
+	ackMu sync.Mutex
+	acks  map[*v1.Frame]*pendingAck
 
 	// Reconnection
 	maxRetries    int
@@ -37,60 +58,132 @@ type Connector struct {
 	onDisconnected func()
 	onError        func(err error)
 
+	// Fault injection (chaos testing only, nil = disabled)
+	faults *chaos.Injector
+
+	// Frame dump (nil = tắt)
+	frameDump *FrameDumper
+
+	// Payload bytes đang nằm trong send queue (nil = không giới hạn)
+	memory *MemoryBudget
+
+	// Time source cho backoff, flush timer và timestamps
+	clock clock.Clock
+
 	// State
-	ctx    context.Context
-	cancel context.CancelFunc
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
-// NewConnector tạo Connector mới
-func NewConnector(serverAddr string, tlsConfig *tls.Config) *Connector {
-	ctx, cancel := context.WithCancel(context.Background())
+// ConnectorOptions cấu hình Connector. Zero value của mỗi field dùng default.
+type ConnectorOptions struct {
+	// TLSConfig cho connection tới Core (nil = plain TCP). Nếu ClientSessionCache
+	// là nil, connector dùng LRU cache riêng để reconnect resume TLS session thay vì
+	// full handshake.
+	TLSConfig *tls.Config
 
-	return &Connector{
-		serverAddr:    serverAddr,
-		tlsConfig:     tlsConfig,
-		sendCh:        make(chan *v1.Frame, 100), // Buffer 100 frames
-		maxRetries:    -1,                        // Unlimited
-		retryInterval: 1 * time.Second,
-		backoffFactor: 2.0,
-		maxBackoff:    60 * time.Second,
-		ctx:           ctx,
-		cancel:        cancel,
-	}
-}
+	// BindAddress là source IP hoặc tên network interface cho connection tới Core
+	// (rỗng = OS tự chọn). Interface được resolve lại mỗi lần dial.
+	BindAddress string
 
-// SetMaxRetries set max retry attempts (-1 = unlimited)
-func (c *Connector) SetMaxRetries(maxRetries int) {
-	c.maxRetries = maxRetries
-}
+	// Socket tinh chỉnh TCP socket (TCP_NODELAY, buffer sizes, DSCP)
+	Socket SocketOptions
 
-// SetRetryInterval set retry interval
-func (c *Connector) SetRetryInterval(interval time.Duration) {
-	c.retryInterval = interval
-}
+	// Transport mở connections tới Core (nil = TCP với TLSConfig, BindAddress và
+	// Socket ở trên; tests và simulation mode dùng MemoryTransport)
+	Transport Transport
 
-// SetOnConnected set callback khi connected
-func (c *Connector) SetOnConnected(callback func(conn net.Conn)) {
-	c.onConnected = callback
-}
+	// Reconnection: MaxRetries <= 0 = unlimited, RetryInterval default 1s,
+	// BackoffFactor default 2, MaxBackoff default 60s
+	MaxRetries    int
+	RetryInterval time.Duration
+	BackoffFactor float64
+	MaxBackoff    time.Duration
 
-// SetOnDisconnected set callback khi disconnected
-func (c *Connector) SetOnDisconnected(callback func()) {
-	c.onDisconnected = callback
+	// SendQueueSize là số frames được buffer cho writeLoop mỗi priority (default 100).
+	// writeLoop giữ thêm tối đa chừng này frames để ghi luân phiên giữa các streams.
+	SendQueueSize int
+
+	// FairQuantum là số bytes mỗi stream được ghi trong một lượt round robin
+	// trước khi nhường streams khác cùng priority (default DefaultFairQuantum)
+	FairQuantum int
+
+	// Callbacks
+	OnConnected    func(conn net.Conn)
+	OnDisconnected func()
+	OnError        func(err error)
+
+	// Faults bật fault injection cho outgoing frames (chỉ dùng để test)
+	Faults *chaos.Injector
+
+	// FrameDump ghi mọi frame đã gửi tới Core (nil = tắt)
+	FrameDump *FrameDumper
+
+	// Memory đếm payload bytes trong send queue vào memory budget chung (nil = không đếm)
+	Memory *MemoryBudget
+
+	// Clock cho backoff và timestamps (default clock.Real, tests dùng clock.Mock)
+	Clock clock.Clock
 }
 
-// SetOnError set callback khi có error
-func (c *Connector) SetOnError(callback func(err error)) {
-	c.onError = callback
+// NewConnector tạo Connector mới
+func NewConnector(serverAddr string, opts ConnectorOptions) *Connector {
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 1 * time.Second
+	}
+	if opts.BackoffFactor < 1 {
+		opts.BackoffFactor = 2.0
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 60 * time.Second
+	}
+	if opts.SendQueueSize <= 0 {
+		opts.SendQueueSize = 100
+	}
+	if opts.FairQuantum <= 0 {
+		opts.FairQuantum = DefaultFairQuantum
+	}
+	if opts.TLSConfig != nil && opts.TLSConfig.ClientSessionCache == nil {
+		opts.TLSConfig = opts.TLSConfig.Clone()
+		opts.TLSConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+	if opts.Transport == nil {
+		opts.Transport = &tcpTransport{tlsConfig: opts.TLSConfig, bindAddress: opts.BindAddress, socket: opts.Socket}
+	}
+
+	return &Connector{
+		serverAddr:     serverAddr,
+		tlsConfig:      opts.TLSConfig,
+		transport:      opts.Transport,
+		sendCh:         make(chan *v1.Frame, opts.SendQueueSize),
+		urgentCh:       make(chan *v1.Frame, opts.SendQueueSize),
+		bulkCh:         make(chan *v1.Frame, opts.SendQueueSize),
+		fairQuantum:    opts.FairQuantum,
+		fairLimit:      opts.SendQueueSize,
+		maxRetries:     opts.MaxRetries,
+		retryInterval:  opts.RetryInterval,
+		backoffFactor:  opts.BackoffFactor,
+		maxBackoff:     opts.MaxBackoff,
+		onConnected:    opts.OnConnected,
+		onDisconnected: opts.OnDisconnected,
+		onError:        opts.OnError,
+		faults:         opts.Faults,
+		frameDump:      opts.FrameDump,
+		memory:         opts.Memory,
+		clock:          clock.Or(opts.Clock),
+		closed:         make(chan struct{}),
+	}
 }
 
-// Connect kết nối tới Core Server
-func (c *Connector) Connect() error {
-	return c.connectWithRetry()
+// Connect kết nối tới Core Server, retry cho đến khi thành công, hết retries,
+// ctx bị huỷ hoặc connector bị Close. ctx chỉ giới hạn việc kết nối,
+// connection đã thiết lập sống đến khi Disconnect/Close.
+func (c *Connector) Connect(ctx context.Context) error {
+	return c.connectWithRetry(ctx)
 }
 
 // connectWithRetry kết nối với retry logic và improved error recovery
-func (c *Connector) connectWithRetry() error {
+func (c *Connector) connectWithRetry(ctx context.Context) error {
 	backoff := c.retryInterval
 	retries := 0
 	consecutiveErrors := 0
@@ -98,13 +191,15 @@ func (c *Connector) connectWithRetry() error {
 
 	for {
 		select {
-		case <-c.ctx.Done():
-			return c.ctx.Err()
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.closed:
+			return ErrConnectionClosed
 		default:
 		}
 
 		// Attempt connection
-		conn, err := c.dial()
+		conn, err := c.dial(ctx)
 		if err == nil {
 			// Connection successful - reset error counter
 			consecutiveErrors = 0
@@ -113,17 +208,29 @@ func (c *Connector) connectWithRetry() error {
 			// Update metrics
 			metrics.GetMetrics().IncrementConnectionsTotal()
 			metrics.GetMetrics().IncrementConnectionsActive()
-			metrics.GetMetrics().SetLastConnectionTime(time.Now())
+			metrics.GetMetrics().SetLastConnectionTime(c.clock.Now())
 
 			// Update health check
 			if check, ok := health.GetHealthChecker().GetCheck("connection"); ok {
 				check.UpdateCheck(health.HealthStatusHealthy, "Connected to server")
 			}
 
-			logger.Info("Connection established", "address", c.serverAddr)
+			localAddr := conn.LocalAddr().String()
+			metrics.GetMetrics().SetLocalAddr(localAddr)
+			if tlsConn, ok := conn.(*tls.Conn); ok {
+				resumed := tlsConn.ConnectionState().DidResume
+				metrics.GetMetrics().RecordTLSHandshake(resumed)
+				logger.Info("Connection established", "address", c.ServerAddr(), "local_addr", localAddr, "tls_resumed", resumed)
+			} else {
+				logger.Info("Connection established", "address", c.ServerAddr(), "local_addr", localAddr)
+			}
 
-			// Start Write Loop
-			go c.writeLoop(conn, c.ctx)
+			// Start Write Loop (dừng khi connection này bị Disconnect)
+			done := make(chan struct{})
+			c.connMu.Lock()
+			c.connDone = done
+			c.connMu.Unlock()
+			go c.writeLoop(conn, done)
 
 			if c.onConnected != nil {
 				c.onConnected(conn)
@@ -134,6 +241,11 @@ func (c *Connector) connectWithRetry() error {
 		// Connection failed
 		consecutiveErrors++
 
+		// Lý do lỗi được giữ trong health history (/health, status command)
+		if check, ok := health.GetHealthChecker().GetCheck("connection"); ok {
+			check.UpdateCheck(health.HealthStatusUnhealthy, fmt.Sprintf("Connection failed: %v", err))
+		}
+
 		// If too many consecutive errors, increase backoff more aggressively
 		if consecutiveErrors >= maxConsecutiveErrors {
 			backoff = time.Duration(float64(backoff) * c.backoffFactor * 1.5)
@@ -155,9 +267,11 @@ func (c *Connector) connectWithRetry() error {
 
 		// Wait before retry
 		select {
-		case <-c.ctx.Done():
-			return c.ctx.Err()
-		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.closed:
+			return ErrConnectionClosed
+		case <-c.clock.After(backoff):
 			// Exponential backoff
 			backoff = time.Duration(float64(backoff) * c.backoffFactor)
 			if backoff > c.maxBackoff {
@@ -167,12 +281,9 @@ func (c *Connector) connectWithRetry() error {
 	}
 }
 
-// dial tạo TLS connection
-func (c *Connector) dial() (net.Conn, error) {
-	if c.tlsConfig != nil {
-		return tls.Dial("tcp", c.serverAddr, c.tlsConfig)
-	}
-	return net.Dial("tcp", c.serverAddr)
+// dial mở connection tới Core qua transport
+func (c *Connector) dial(ctx context.Context) (net.Conn, error) {
+	return c.transport.Dial(ctx, c.ServerAddr())
 }
 
 // setConnection set connection và update state
@@ -184,6 +295,20 @@ func (c *Connector) setConnection(conn net.Conn) {
 	c.connected = true
 }
 
+// ServerAddr trả về address của Core dùng cho lần dial tiếp theo
+func (c *Connector) ServerAddr() string {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.serverAddr
+}
+
+// SetServerAddr đổi address của Core, có hiệu lực từ lần Connect/Reconnect tiếp theo
+func (c *Connector) SetServerAddr(addr string) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.serverAddr = addr
+}
+
 // GetConnection lấy connection hiện tại
 func (c *Connector) GetConnection() (net.Conn, bool) {
 	c.connMu.RLock()
@@ -192,6 +317,38 @@ func (c *Connector) GetConnection() (net.Conn, bool) {
 	return c.conn, c.connected
 }
 
+// ConnectionState là snapshot trạng thái connection (dùng cho diagnostics/status)
+type ConnectionState struct {
+	ServerAddr string `json:"server_addr"`
+	Connected  bool   `json:"connected"`
+	LocalAddr  string `json:"local_addr,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	TLS        bool   `json:"tls"`
+	TLSResumed bool   `json:"tls_resumed,omitempty"`
+	SendQueue  int    `json:"send_queue"`
+}
+
+// State trả về trạng thái connection hiện tại
+func (c *Connector) State() ConnectionState {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+
+	state := ConnectionState{
+		ServerAddr: c.serverAddr,
+		Connected:  c.connected,
+		TLS:        c.tlsConfig != nil,
+		SendQueue:  c.queuedFrames() + int(c.scheduled.Load()),
+	}
+	if c.conn != nil {
+		state.LocalAddr = c.conn.LocalAddr().String()
+		state.RemoteAddr = c.conn.RemoteAddr().String()
+		if tlsConn, ok := c.conn.(*tls.Conn); ok {
+			state.TLSResumed = tlsConn.ConnectionState().DidResume
+		}
+	}
+	return state
+}
+
 // IsConnected kiểm tra connection status
 func (c *Connector) IsConnected() bool {
 	c.connMu.RLock()
@@ -209,6 +366,11 @@ func (c *Connector) Disconnect() error {
 		return nil
 	}
 
+	if c.connDone != nil {
+		close(c.connDone)
+		c.connDone = nil
+	}
+	c.failAcks(c.conn)
 	err := c.conn.Close()
 	c.conn = nil
 	c.connected = false
@@ -231,13 +393,13 @@ func (c *Connector) Disconnect() error {
 }
 
 // Reconnect ngắt kết nối và kết nối lại
-func (c *Connector) Reconnect() error {
+func (c *Connector) Reconnect(ctx context.Context) error {
 	logger.Info("Reconnecting to server")
 	metrics.GetMetrics().IncrementReconnectionsTotal()
 
 	c.Disconnect()
 
-	err := c.connectWithRetry()
+	err := c.connectWithRetry(ctx)
 	if err != nil {
 		metrics.GetMetrics().IncrementReconnectionErrors()
 		logger.Error("Reconnection failed", "error", err)
@@ -248,14 +410,40 @@ func (c *Connector) Reconnect() error {
 	return err
 }
 
-// Close đóng connector
+// Close đóng connector, huỷ mọi Connect/Reconnect đang retry
 func (c *Connector) Close() error {
-	c.cancel()
+	c.closeOnce.Do(func() { close(c.closed) })
 	return c.Disconnect()
 }
 
-// SendFrame gửi frame qua connection (async via channel)
-func (c *Connector) SendFrame(frame *v1.Frame) error {
+// SendFrame gửi frame qua connection (async via channel).
+// Trả về ctx.Err() nếu ctx đã bị huỷ, ErrSendQueueFull nếu queue đầy.
+func (c *Connector) SendFrame(ctx context.Context, frame *v1.Frame) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.enqueue(frame, PriorityNormal)
+}
+
+// queueFor trả về send queue của priority
+func (c *Connector) queueFor(p Priority) chan *v1.Frame {
+	switch p {
+	case PriorityHigh:
+		return c.urgentCh
+	case PriorityLow:
+		return c.bulkCh
+	default:
+		return c.sendCh
+	}
+}
+
+// queuedFrames trả về tổng số frames đang chờ trong các send queues
+func (c *Connector) queuedFrames() int {
+	return len(c.urgentCh) + len(c.sendCh) + len(c.bulkCh)
+}
+
+// enqueue đưa frame vào send queue của priority, không block
+func (c *Connector) enqueue(frame *v1.Frame, p Priority) error {
 	c.connMu.RLock()
 	connected := c.connected
 	c.connMu.RUnlock()
@@ -263,77 +451,218 @@ func (c *Connector) SendFrame(frame *v1.Frame) error {
 	if !connected {
 		return ErrNotConnected
 	}
+	if c.closing.Load() {
+		return ErrConnectionClosed
+	}
 
 	// Non-blocking send or timeout?
 	// For high throughput, we want non-blocking if possible, but if buffer full, we might drop or block.
 	// Blocking with timeout is safer?
 	// Let's try select default to avoid blocking main loops if network stalls.
+	// Reserve trước khi enqueue để writeLoop không Release trước Reserve
+	c.memory.Reserve(len(frame.Payload))
+	c.pending.Add(1)
 	select {
-	case c.sendCh <- frame:
+	case c.queueFor(p) <- frame:
 		return nil
 	default:
 		// Queue full
-		return fmt.Errorf("send queue full")
+		c.memory.Release(len(frame.Payload))
+		c.pending.Add(-1)
+		return ErrSendQueueFull
+	}
+}
+
+// SendFrameWait gửi frame, block cho đến khi frame được đưa vào send queue
+// hoặc ctx bị huỷ. Dùng cho bulk transfers cần backpressure thay vì drop.
+func (c *Connector) SendFrameWait(ctx context.Context, frame *v1.Frame) error {
+	return c.sendFrameWait(ctx, frame, PriorityNormal)
+}
+
+// sendFrameWait là SendFrameWait vào send queue của priority
+func (c *Connector) sendFrameWait(ctx context.Context, frame *v1.Frame, p Priority) error {
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+	if c.closing.Load() {
+		return ErrConnectionClosed
+	}
+	return c.push(ctx, frame, p)
+}
+
+// push đưa frame vào send queue của priority, block tới khi queue có chỗ
+func (c *Connector) push(ctx context.Context, frame *v1.Frame, p Priority) error {
+	c.memory.Reserve(len(frame.Payload))
+	c.pending.Add(1)
+	select {
+	case c.queueFor(p) <- frame:
+		return nil
+	case <-ctx.Done():
+		c.memory.Release(len(frame.Payload))
+		c.pending.Add(-1)
+		return ctx.Err()
+	case <-c.closed:
+		c.memory.Release(len(frame.Payload))
+		c.pending.Add(-1)
+		return ErrConnectionClosed
 	}
 }
 
 // writeLoop handles buffered writing to the connection
-func (c *Connector) writeLoop(conn net.Conn, ctx context.Context) {
+func (c *Connector) writeLoop(conn net.Conn, done <-chan struct{}) {
 	// 4KB buffer for coalescing
 	w := bufio.NewWriterSize(conn, 4*1024)
-	timer := time.NewTimer(10 * time.Millisecond)
+	timer := c.clock.NewTimer(10 * time.Millisecond)
 	defer timer.Stop()
 
+	sched := newFrameScheduler(c.fairQuantum, c.fairLimit)
+	defer func() {
+		// Frames đã lấy khỏi send queues thuộc connection này, bỏ cùng connection
+		for frame := sched.pop(); frame != nil; frame = sched.pop() {
+			c.pending.Add(-1)
+			c.memory.Release(len(frame.Payload))
+			c.takeAck(frame).finish(ErrConnectionClosed)
+		}
+		c.scheduled.Store(0)
+	}()
+
 	for {
+		// Connection đã bị Disconnect: frames còn lại thuộc connection này
 		select {
-		case <-ctx.Done():
+		case <-done:
 			return
+		default:
+		}
 
-		case frame := <-c.sendCh:
-			// Encode to buffer
-			if err := v1.Encode(w, frame); err != nil {
-				logger.Error("Write loop encode error", "error", err)
-				c.Disconnect() // Trigger reconnect
+		// Frames đang chờ được xếp lượt theo priority và stream, chỉ block khi
+		// không còn frame nào
+		c.fill(sched)
+		frame := sched.pop()
+		if frame == nil {
+			select {
+			case <-done:
 				return
-			}
-			metrics.GetMetrics().IncrementFramesSent()
-
-			// Check if more frames are immediately available to batch them
-			// If not, we might flush soon via timer or immediately if we want lower latency?
-			// To coalesce, we generally wait for the timer OR if buffer is full (happens validly inside Encode).
-			// But if we just wrote one packet and nothing else comes, we must flush.
-			// Reset timer to ensure we flush eventually if no more data comes.
-			// Is 10ms too high latency?
-			// Maybe: flush if channel is empty? Use 'default' selection?
-
-			// Optimization: Flush immediately if no more data in channel
-			if len(c.sendCh) == 0 {
+			case frame := <-c.urgentCh:
+				sched.push(frame, PriorityHigh)
+			case frame := <-c.sendCh:
+				sched.push(frame, PriorityNormal)
+			case frame := <-c.bulkCh:
+				sched.push(frame, PriorityLow)
+			case <-timer.C():
 				if err := w.Flush(); err != nil {
 					logger.Error("Write loop flush error", "error", err)
 					c.Disconnect()
 					return
 				}
-			} else {
-				// If data pending, maybe just continue and let buffer fill?
-				// But we need to ensure we flush if buffer doesn't fill.
-				// Timer is running.
-				// Actually, simpler logic:
-				// Always write to buffer. Flush on timer tick.
-				// This guarantees bounded latency (10ms) and coalescing for high rates.
+				timer.Reset(10 * time.Millisecond)
+			}
+			continue
+		}
+		c.scheduled.Store(int64(sched.len()))
+		// Frames vào queue sau lúc này được ghi sau frame này (Shutdown dựa vào đó)
+		c.pending.Add(-1)
+
+		c.memory.Release(len(frame.Payload))
+		ack := c.takeAck(frame)
+		if ack != nil && ack.conn != conn {
+			// Frame của connection trước: stream ID không còn ý nghĩa ở đây
+			ack.finish(ErrConnectionClosed)
+			continue
+		}
+
+		// Fault injection: delay, disconnect, drop, corrupt
+		if c.faults != nil {
+			if delay := c.faults.Delay(); delay > 0 {
+				c.clock.Sleep(delay)
+			}
+			if c.faults.Disconnect() {
+				// Đóng connection như network bị ngắt, dispatcher sẽ trigger reconnect
+				logger.Warn("Chaos: forcing disconnect")
+				ack.finish(ErrConnectionClosed)
+				conn.Close()
+				return
+			}
+			if c.faults.Drop(frame.StreamID) {
+				logger.Debug("Chaos: dropped outgoing frame", "type", frame.Type, "streamID", frame.StreamID)
+				// Như network làm mất frame sau khi đã ghi thành công
+				ack.finish(nil)
+				continue
 			}
+			if payload, ok := c.faults.Corrupt(frame.StreamID, frame.Payload); ok {
+				corrupted := *frame
+				corrupted.Payload = payload
+				frame = &corrupted
+			}
+		}
 
-		case <-timer.C:
+		// Encode to buffer (payload lớn được ghi thẳng bằng writev)
+		if err := writeFrame(w, conn, frame); err != nil {
+			logger.Error("Write loop encode error", "error", err)
+			ack.finish(err)
+			c.Disconnect() // Trigger reconnect
+			return
+		}
+		metrics.GetMetrics().RecordFrameSent(len(frame.Payload))
+		c.frameDump.dump(dumpOut, frame)
+
+		// Frame cần ack được flush ngay để biết chắc đã ghi xuống connection
+		if ack != nil {
+			err := w.Flush()
+			ack.finish(err)
+			if err != nil {
+				logger.Error("Write loop flush error", "error", err)
+				c.Disconnect()
+				return
+			}
+			continue
+		}
+
+		// Check if more frames are immediately available to batch them
+		// If not, we might flush soon via timer or immediately if we want lower latency?
+		// To coalesce, we generally wait for the timer OR if buffer is full (happens validly inside Encode).
+		// But if we just wrote one packet and nothing else comes, we must flush.
+		// Reset timer to ensure we flush eventually if no more data comes.
+		// Is 10ms too high latency?
+		// Maybe: flush if channel is empty? Use 'default' selection?
+
+		// Optimization: Flush immediately if no more data in channel
+		if c.queuedFrames() == 0 && sched.len() == 0 {
 			if err := w.Flush(); err != nil {
 				logger.Error("Write loop flush error", "error", err)
 				c.Disconnect()
 				return
 			}
-			timer.Reset(10 * time.Millisecond)
+		} else {
+			// If data pending, maybe just continue and let buffer fill?
+			// But we need to ensure we flush if buffer doesn't fill.
+			// Timer is running.
+			// Actually, simpler logic:
+			// Always write to buffer. Flush on timer tick.
+			// This guarantees bounded latency (10ms) and coalescing for high rates.
 		}
 	}
 }
 
-// Context returns context for cancellation
-func (c *Connector) Context() context.Context {
-	return c.ctx
+// fill chuyển frames đang chờ trong send queues vào scheduler tới khi queues
+// rỗng hoặc scheduler đầy, không block
+func (c *Connector) fill(sched *frameScheduler) {
+	queues := [...]struct {
+		ch       chan *v1.Frame
+		priority Priority
+	}{{c.urgentCh, PriorityHigh}, {c.sendCh, PriorityNormal}, {c.bulkCh, PriorityLow}}
+
+	for !sched.full() {
+		moved := false
+		for _, q := range queues {
+			select {
+			case frame := <-q.ch:
+				sched.push(frame, q.priority)
+				moved = true
+			default:
+			}
+		}
+		if !moved {
+			return
+		}
+	}
 }
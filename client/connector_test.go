@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// closedAddr trả về address không có ai listen (dial fail ngay lập tức)
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestConnector_ConnectHonorsContext(t *testing.T) {
+	mock := clock.NewMock(time.Now())
+	connector := NewConnector(closedAddr(t), ConnectorOptions{Clock: mock})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- connector.Connect(ctx) }()
+
+	// Connect đang chờ backoff trên mock clock
+	mock.BlockUntil(1)
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Connect did not return after ctx was cancelled")
+	}
+}
+
+func TestConnector_CloseStopsConnect(t *testing.T) {
+	mock := clock.NewMock(time.Now())
+	connector := NewConnector(closedAddr(t), ConnectorOptions{Clock: mock})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- connector.Connect(context.Background()) }()
+
+	mock.BlockUntil(1)
+	connector.Close()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrConnectionClosed) {
+			t.Errorf("expected ErrConnectionClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Connect did not return after Close")
+	}
+}
+
+func TestConnector_SendFrameCancelledContext(t *testing.T) {
+	connector := NewConnector("127.0.0.1:0", ConnectorOptions{})
+	connector.connected = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := connector.SendFrame(ctx, &v1.Frame{Type: v1.FrameHeartbeat}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(connector.sendCh) != 0 {
+		t.Error("frame should not be queued when ctx is cancelled")
+	}
+}
+
+func TestNewConnector_Defaults(t *testing.T) {
+	connector := NewConnector("127.0.0.1:0", ConnectorOptions{SendQueueSize: 8})
+
+	if connector.retryInterval != time.Second {
+		t.Errorf("retryInterval = %v, want 1s", connector.retryInterval)
+	}
+	if connector.backoffFactor != 2.0 {
+		t.Errorf("backoffFactor = %v, want 2", connector.backoffFactor)
+	}
+	if connector.maxBackoff != 60*time.Second {
+		t.Errorf("maxBackoff = %v, want 60s", connector.maxBackoff)
+	}
+	if cap(connector.sendCh) != 8 {
+		t.Errorf("send queue size = %d, want 8", cap(connector.sendCh))
+	}
+	if connector.clock != clock.Real {
+		t.Error("expected clock.Real by default")
+	}
+}
+
+// tlsListener trả về TLS listener dùng certificate của httptest, accept và giữ
+// connections cho đến khi test kết thúc
+func tlsListener(t *testing.T) (string, *tls.Config) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	serverConfig := srv.TLS.Clone()
+	// TLS 1.2 gửi session ticket trong handshake; TLS 1.3 chỉ gửi sau handshake
+	serverConfig.MaxVersion = tls.VersionTLS12
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+				var buf [1]byte
+				conn.Read(buf[:])
+			}()
+		}
+	}()
+
+	pool := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	return ln.Addr().String(), &tls.Config{RootCAs: pool, ServerName: "example.com"}
+}
+
+func TestConnector_TLSSessionResumption(t *testing.T) {
+	addr, tlsConfig := tlsListener(t)
+	connector := NewConnector(addr, ConnectorOptions{TLSConfig: tlsConfig, MaxRetries: 1})
+	defer connector.Close()
+
+	if tlsConfig.ClientSessionCache != nil {
+		t.Error("caller's TLSConfig should not be modified")
+	}
+
+	for i, wantResumed := range []bool{false, true} {
+		if err := connector.Connect(context.Background()); err != nil {
+			t.Fatalf("connect %d: %v", i, err)
+		}
+		if got := connector.State().TLSResumed; got != wantResumed {
+			t.Errorf("connect %d: TLSResumed = %v, want %v", i, got, wantResumed)
+		}
+		connector.Disconnect()
+	}
+}
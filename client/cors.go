@@ -0,0 +1,148 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCORSMethods là methods được phép khi CORSOptions.AllowedMethods rỗng
+var defaultCORSMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// CORSOptions cấu hình CORS ở agent cho APIs expose qua tunnel
+type CORSOptions struct {
+	// AllowedOrigins là origins được phép: origin đầy đủ ("https://app.example.com"),
+	// wildcard subdomain ("https://*.example.com") hoặc "*" cho mọi origin
+	AllowedOrigins []string
+
+	// AllowedMethods cho preflight (default: GET, HEAD, POST, PUT, PATCH, DELETE)
+	AllowedMethods []string
+
+	// AllowedHeaders cho preflight; rỗng nghĩa là chấp nhận headers client yêu cầu
+	AllowedHeaders []string
+
+	// ExposedHeaders là response headers mà browser script được đọc
+	ExposedHeaders []string
+
+	// AllowCredentials cho phép cookies/Authorization; origin luôn được echo thay vì "*"
+	AllowCredentials bool
+
+	// MaxAge là thời gian browser cache kết quả preflight (0 = không gửi)
+	MaxAge time.Duration
+}
+
+// cors xử lý CORS cho LocalForwarder
+type cors struct {
+	opts    CORSOptions
+	methods string
+}
+
+// newCORS tạo cors từ options, nil nếu opts là nil
+func newCORS(opts *CORSOptions) *cors {
+	if opts == nil {
+		return nil
+	}
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	return &cors{opts: *opts, methods: strings.ToUpper(strings.Join(methods, ", "))}
+}
+
+// allowOrigin kiểm tra origin có được phép không
+func (c *cors) allowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, allowed := range c.opts.AllowedOrigins {
+		switch {
+		case allowed == "*":
+			return true
+		case strings.EqualFold(allowed, origin):
+			return true
+		case strings.Contains(allowed, "://*."):
+			scheme, domain, _ := strings.Cut(allowed, "://*")
+			if strings.HasPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://") &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(domain)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPreflight kiểm tra request là CORS preflight
+func isPreflight(method string, headers http.Header) bool {
+	return method == http.MethodOptions &&
+		headers.Get("Origin") != "" &&
+		headers.Get("Access-Control-Request-Method") != ""
+}
+
+// preflight trả về response cho CORS preflight mà không gọi local service:
+// 204 với allow headers khi origin được phép, 403 nếu không
+func (c *cors) preflight(headers http.Header) *http.Response {
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+	}
+	resp.Header.Set("Content-Length", "0")
+	resp.Header.Add("Vary", "Origin")
+	resp.Header.Add("Vary", "Access-Control-Request-Method")
+	resp.Header.Add("Vary", "Access-Control-Request-Headers")
+
+	origin := headers.Get("Origin")
+	if !c.allowOrigin(origin) {
+		resp.StatusCode = http.StatusForbidden
+		resp.Status = "403 Forbidden"
+		return resp
+	}
+
+	resp.StatusCode = http.StatusNoContent
+	resp.Status = "204 No Content"
+	c.setOrigin(resp.Header, origin)
+	resp.Header.Set("Access-Control-Allow-Methods", c.methods)
+	if len(c.opts.AllowedHeaders) > 0 {
+		resp.Header.Set("Access-Control-Allow-Headers", strings.Join(c.opts.AllowedHeaders, ", "))
+	} else if requested := headers.Get("Access-Control-Request-Headers"); requested != "" {
+		resp.Header.Set("Access-Control-Allow-Headers", requested)
+	}
+	if c.opts.MaxAge > 0 {
+		resp.Header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.opts.MaxAge.Seconds())))
+	}
+	return resp
+}
+
+// applyResponse thêm CORS headers vào response của request thường từ origin được phép.
+// CORS headers do local service đặt bị ghi đè để tránh giá trị trùng lặp.
+func (c *cors) applyResponse(h http.Header, origin string) {
+	if origin == "" {
+		return
+	}
+	h.Add("Vary", "Origin")
+	if !c.allowOrigin(origin) {
+		return
+	}
+	c.setOrigin(h, origin)
+	if len(c.opts.ExposedHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(c.opts.ExposedHeaders, ", "))
+	}
+}
+
+// setOrigin đặt Access-Control-Allow-Origin (và Allow-Credentials)
+func (c *cors) setOrigin(h http.Header, origin string) {
+	if c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Credentials", "true")
+		return
+	}
+	for _, allowed := range c.opts.AllowedOrigins {
+		if allowed == "*" {
+			h.Set("Access-Control-Allow-Origin", "*")
+			return
+		}
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+}
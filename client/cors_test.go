@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func forwardAndRead(t *testing.T, lf *LocalForwarder, req string) string {
+	t.Helper()
+	stream, connector := newTestExecStream(t, nil)
+	if _, err := lf.ForwardRequest(context.Background(), stream, []byte(req)); err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+	var resp strings.Builder
+	for len(connector.sendCh) > 0 {
+		resp.Write((<-connector.sendCh).Payload)
+	}
+	return resp.String()
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer backend.Close()
+
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		DefaultURL: backend.URL,
+		CORS: &CORSOptions{
+			AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"},
+			MaxAge:         10 * time.Minute,
+		},
+	})
+
+	resp := forwardAndRead(t, lf, "OPTIONS /api HTTP/1.1\r\nHost: a\r\nOrigin: https://x.example.org\r\n"+
+		"Access-Control-Request-Method: PUT\r\nAccess-Control-Request-Headers: content-type\r\n\r\n")
+	for _, want := range []string{
+		"HTTP/1.1 204 No Content\r\n",
+		"Access-Control-Allow-Origin: https://x.example.org\r\n",
+		"Access-Control-Allow-Methods: GET, HEAD, POST, PUT, PATCH, DELETE\r\n",
+		"Access-Control-Allow-Headers: content-type\r\n",
+		"Access-Control-Max-Age: 600\r\n",
+	} {
+		if !strings.Contains(resp, want) {
+			t.Errorf("preflight response missing %q:\n%s", want, resp)
+		}
+	}
+
+	resp = forwardAndRead(t, lf, "OPTIONS /api HTTP/1.1\r\nHost: a\r\nOrigin: https://evil.com\r\n"+
+		"Access-Control-Request-Method: PUT\r\n\r\n")
+	if !strings.HasPrefix(resp, "HTTP/1.1 403 Forbidden\r\n") || strings.Contains(resp, "Access-Control-Allow-Origin") {
+		t.Errorf("disallowed preflight should be 403 without allow headers:\n%s", resp)
+	}
+
+	if hits.Load() != 0 {
+		t.Errorf("preflight should not reach the local service, got %d hits", hits.Load())
+	}
+}
+
+func TestCORS_ActualRequest(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}))
+	defer backend.Close()
+
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		DefaultURL: backend.URL,
+		CORS: &CORSOptions{
+			AllowedOrigins:   []string{"https://app.example.com"},
+			ExposedHeaders:   []string{"X-Request-Id"},
+			AllowCredentials: true,
+		},
+	})
+
+	resp := forwardAndRead(t, lf, "GET /api HTTP/1.1\r\nHost: a\r\nOrigin: https://app.example.com\r\n\r\n")
+	for _, want := range []string{
+		"Access-Control-Allow-Origin: https://app.example.com\r\n",
+		"Access-Control-Allow-Credentials: true\r\n",
+		"Access-Control-Expose-Headers: X-Request-Id\r\n",
+		"Vary: Origin\r\n",
+	} {
+		if !strings.Contains(resp, want) {
+			t.Errorf("response missing %q:\n%s", want, resp)
+		}
+	}
+	if strings.Contains(resp, "Access-Control-Allow-Origin: *") {
+		t.Errorf("local service CORS header should be overwritten:\n%s", resp)
+	}
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// pendingAck chờ writeLoop ghi xong một frame gửi bằng SendFrameAcked
+type pendingAck struct {
+	conn net.Conn // connection lúc gửi: frame chỉ được ghi trên connection này
+	done chan error
+	once sync.Once
+}
+
+// finish báo kết quả ghi frame (chỉ lần đầu có hiệu lực)
+func (a *pendingAck) finish(err error) {
+	if a == nil {
+		return
+	}
+	a.once.Do(func() { a.done <- err })
+}
+
+// SendFrameAcked gửi frame và chờ tới khi frame đã được ghi và flush xuống
+// connection hiện tại. Khác SendFrame, queue đầy không làm mất frame: lời gọi
+// chờ tới khi có chỗ (hoặc ctx bị huỷ).
+//
+// Nếu connection bị đóng trước khi frame được ghi, SendFrameAcked trả về
+// ErrConnectionClosed và frame bị bỏ thay vì gửi lại trên connection mới:
+// Core đánh stream ID lại từ đầu cho mỗi connection và đã huỷ mọi stream của
+// connection cũ, nên frame cũ có thể trúng một stream mới cùng ID.
+//
+// Dùng cho frames mà Core chờ (error frames của stream), để lỗi gửi không bị
+// bỏ qua âm thầm.
+func (c *Connector) SendFrameAcked(ctx context.Context, frame *v1.Frame) error {
+	return c.sendAcked(ctx, frame, c.SendFrameWait)
+}
+
+// sendAcked là SendFrameAcked với send đưa frame vào send queue
+func (c *Connector) sendAcked(ctx context.Context, frame *v1.Frame, send func(context.Context, *v1.Frame) error) error {
+	c.connMu.RLock()
+	conn, connected := c.conn, c.connected
+	c.connMu.RUnlock()
+	if !connected {
+		return ErrNotConnected
+	}
+
+	ack := &pendingAck{conn: conn, done: make(chan error, 1)}
+	c.ackMu.Lock()
+	if c.acks == nil {
+		c.acks = make(map[*v1.Frame]*pendingAck)
+	}
+	c.acks[frame] = ack
+	c.ackMu.Unlock()
+
+	if err := send(ctx, frame); err != nil {
+		c.takeAck(frame)
+		return err
+	}
+
+	select {
+	case err := <-ack.done:
+		return err
+	case <-ctx.Done():
+		// Frame vẫn có thể được ghi sau đó; writeLoop dọn ack khi lấy frame ra
+		return ctx.Err()
+	}
+}
+
+// takeAck lấy (và xoá) ack đang chờ của frame, nil nếu frame không cần ack
+func (c *Connector) takeAck(frame *v1.Frame) *pendingAck {
+	c.ackMu.Lock()
+	defer c.ackMu.Unlock()
+	ack, ok := c.acks[frame]
+	if ok {
+		delete(c.acks, frame)
+	}
+	return ack
+}
+
+// failAcks báo ErrConnectionClosed cho frames đang chờ trên conn. Acks vẫn được
+// giữ để writeLoop của connection sau bỏ frames đó thay vì ghi.
+func (c *Connector) failAcks(conn net.Conn) {
+	c.ackMu.Lock()
+	defer c.ackMu.Unlock()
+	for _, ack := range c.acks {
+		if ack.conn == conn {
+			ack.finish(ErrConnectionClosed)
+		}
+	}
+}
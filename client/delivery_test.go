@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// readCoreFrame đọc một frame từ đầu phía Core của memory connection
+func readCoreFrame(t *testing.T, core net.Conn) *v1.Frame {
+	t.Helper()
+	core.SetReadDeadline(time.Now().Add(5 * time.Second))
+	length, err := v1.ReadFrameLength(core)
+	if err != nil {
+		t.Fatalf("read frame length: %v", err)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(core, buf); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	frame, err := v1.ParseFrame(buf)
+	if err != nil {
+		t.Fatalf("parse frame: %v", err)
+	}
+	return frame
+}
+
+func errorFrame(streamID uint32) *v1.Frame {
+	return &v1.Frame{Version: v1.Version, Type: v1.FrameData, Flags: v1.FlagError, StreamID: streamID, Payload: []byte("local service down")}
+}
+
+func TestConnector_SendFrameAckedDelivers(t *testing.T) {
+	transport := NewMemoryTransport()
+	defer transport.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := transport.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	connector := NewConnector("memory", ConnectorOptions{Transport: transport})
+	defer connector.Close()
+	if err := connector.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	core := <-accepted
+	defer core.Close()
+
+	if err := connector.SendFrameAcked(context.Background(), errorFrame(3)); err != nil {
+		t.Fatalf("SendFrameAcked failed: %v", err)
+	}
+	if frame := readCoreFrame(t, core); frame.StreamID != 3 || frame.Flags != v1.FlagError {
+		t.Errorf("Core received stream %d flags %v, want error frame for stream 3", frame.StreamID, frame.Flags)
+	}
+	if len(connector.acks) != 0 {
+		t.Errorf("acks should be cleaned up, %d left", len(connector.acks))
+	}
+}
+
+func TestConnector_SendFrameAckedNotReplayedOnNewConnection(t *testing.T) {
+	connector := NewConnector("memory", ConnectorOptions{})
+	defer connector.Close()
+
+	// Connection cũ không có writeLoop: frame nằm trong queue khi connection đóng
+	oldConn, _ := newMemoryPipe()
+	connector.setConnection(oldConn)
+	result := make(chan error, 1)
+	go func() { result <- connector.SendFrameAcked(context.Background(), errorFrame(5)) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(connector.sendCh) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("error frame was not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	connector.Disconnect()
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrConnectionClosed) {
+			t.Fatalf("got %v, want ErrConnectionClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SendFrameAcked did not return after disconnect")
+	}
+
+	// Connection mới: frame cũ bị bỏ, frame kế tiếp là frame đầu tiên Core nhận
+	newConn, core := newMemoryPipe()
+	defer core.Close()
+	connector.setConnection(newConn)
+	done := make(chan struct{})
+	defer close(done)
+	go connector.writeLoop(newConn, done)
+
+	if err := connector.SendFrame(context.Background(), errorFrame(1)); err != nil {
+		t.Fatalf("SendFrame failed: %v", err)
+	}
+	if frame := readCoreFrame(t, core); frame.StreamID != 1 {
+		t.Errorf("Core received stream %d first, stale frame for stream 5 was replayed", frame.StreamID)
+	}
+}
+
+func TestConnector_SendFrameAckedWaitsForQueue(t *testing.T) {
+	connector := NewConnector("memory", ConnectorOptions{SendQueueSize: 1})
+	defer connector.Close()
+	conn, _ := newMemoryPipe()
+	connector.setConnection(conn)
+
+	// Queue đầy: SendFrame bỏ frame, SendFrameAcked chờ tới khi ctx hết hạn
+	connector.SendFrame(context.Background(), errorFrame(1))
+	if err := connector.SendFrame(context.Background(), errorFrame(3)); !errors.Is(err, ErrSendQueueFull) {
+		t.Fatalf("SendFrame on full queue: got %v, want ErrSendQueueFull", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := connector.SendFrameAcked(ctx, errorFrame(3)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SendFrameAcked on full queue: got %v, want context.DeadlineExceeded", err)
+	}
+	if len(connector.acks) != 0 {
+		t.Errorf("ack of a frame never queued should be removed, %d left", len(connector.acks))
+	}
+}
@@ -1,17 +1,41 @@
 package client
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"fmt"
 	"io"
-	"strings"
+	"net"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/hydragon2m/tunnel-agent/internal/chaos"
 	"github.com/hydragon2m/tunnel-agent/internal/logger"
 	"github.com/hydragon2m/tunnel-agent/internal/metrics"
 	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
 )
 
+// readBufferSize là kích thước bufio.Reader của read loop: đủ cho một frame
+// DefaultFileChunkSize kèm header, nên phần lớn frames chỉ tốn một read syscall
+const readBufferSize = 64 * 1024
+
+// IdleTimeoutFactor là số heartbeat intervals không nhận được frame nào từ Core
+// trước khi connection bị coi là chết (Core ACK mỗi heartbeat)
+const IdleTimeoutFactor = 3
+
+// IdleTimeoutFor trả về idle timeout cho heartbeat interval
+func IdleTimeoutFor(heartbeat time.Duration) time.Duration {
+	return IdleTimeoutFactor * heartbeat
+}
+
+// readerPool giữ bufio.Reader giữa các lần Start (reconnect) để không cấp phát lại buffer
+var readerPool = sync.Pool{
+	New: func() any { return bufio.NewReaderSize(nil, readBufferSize) },
+}
+
 // Dispatcher xử lý frames từ Core Server
 type Dispatcher struct {
 	conn   io.Reader
@@ -22,27 +46,109 @@ type Dispatcher struct {
 	streamHandler  func(frame *v1.Frame) error
 
 	// State
-	ctx       context.Context
 	cancel    context.CancelFunc
 	running   bool
 	runningMu sync.RWMutex
 
 	// Config
-	readTimeout time.Duration
+	idleTimeout time.Duration
+	queueSize   int
 
 	// Callbacks
 	onConnectionClosed func()
 	onError            func(err error)
+
+	// Fault injection (chaos testing only, nil = disabled)
+	faults *chaos.Injector
+
+	// Frame dump (nil = tắt)
+	frameDump *FrameDumper
+
+	// Frame-type allowlist theo trạng thái auth của connection
+	requireAuth   bool
+	authenticated atomic.Bool
+	maxViolations int
+
+	// Giới hạn frames/giây nhận từ Core (0 = không giới hạn)
+	maxFrameRate int
+	frameBurst   int
+
+	// Xử lý lỗi của handlers (nil = policy mặc định)
+	errorPolicy *ErrorPolicy
+}
+
+// DispatcherOptions cấu hình Dispatcher. Zero value của mỗi field dùng default.
+type DispatcherOptions struct {
+	// IdleTimeout: connection bị coi là chết và dispatcher dừng với
+	// ErrIdleTimeout khi không nhận được frame nào từ Core trong khoảng này
+	// (0 = không giới hạn). Khi heartbeat chạy, Core ACK mỗi heartbeat nên dùng
+	// IdleTimeoutFor(heartbeat interval): link khoẻ không bao giờ chạm deadline.
+	IdleTimeout time.Duration
+
+	// QueueSize là số frames đã đọc nhưng chưa dispatch mà read stage được
+	// giữ trước khi chờ decode stage (default 64)
+	QueueSize int
+
+	// Frame handlers
+	ControlHandler func(frame *v1.Frame) error
+	StreamHandler  func(frame *v1.Frame) error
+
+	// Callbacks
+	OnConnectionClosed func()
+	OnError            func(err error)
+
+	// Faults bật fault injection cho incoming frames (chỉ dùng để test)
+	Faults *chaos.Injector
+
+	// FrameDump ghi mọi frame nhận từ Core (nil = tắt)
+	FrameDump *FrameDumper
+
+	// RequireAuth bỏ qua heartbeat và stream frames tới khi MarkAuthenticated
+	// được gọi trên connection hiện tại
+	RequireAuth bool
+
+	// MaxViolations là số frames vi phạm protocol (type không hợp lệ ở trạng
+	// thái hiện tại, open header hoặc request sai) được bỏ qua trước khi
+	// dispatcher dừng với ErrTooManyViolations (default 32)
+	MaxViolations int
+
+	// MaxFrameRate giới hạn số frames/giây xử lý từ Core (0 = không giới hạn).
+	// Frames vượt giới hạn được giữ lại ở read stage, nên Core bị chặn qua TCP
+	// backpressure thay vì agent phải xử lý một luồng frames nhỏ liên tục.
+	MaxFrameRate int
+	// FrameBurst là số frames được vượt MaxFrameRate trong một đợt ngắn
+	// (default = MaxFrameRate)
+	FrameBurst int
+
+	// ErrorPolicy phân loại lỗi của ControlHandler và StreamHandler và quyết
+	// định log, reset stream hay dừng connection (nil = policy mặc định, không
+	// reset được stream vì không có ResetStream)
+	ErrorPolicy *ErrorPolicy
 }
 
 // NewDispatcher tạo Dispatcher mới
-func NewDispatcher(readTimeout time.Duration) *Dispatcher {
-	ctx, cancel := context.WithCancel(context.Background())
+func NewDispatcher(opts DispatcherOptions) *Dispatcher {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 64
+	}
+	if opts.MaxViolations <= 0 {
+		opts.MaxViolations = defaultMaxViolations
+	}
 
 	return &Dispatcher{
-		readTimeout: readTimeout,
-		ctx:         ctx,
-		cancel:      cancel,
+		idleTimeout:        opts.IdleTimeout,
+		queueSize:          opts.QueueSize,
+		controlHandler:     opts.ControlHandler,
+		streamHandler:      opts.StreamHandler,
+		onConnectionClosed: opts.OnConnectionClosed,
+		onError:            opts.OnError,
+		faults:             opts.Faults,
+		frameDump:          opts.FrameDump,
+		requireAuth:        opts.RequireAuth,
+		maxViolations:      opts.MaxViolations,
+		maxFrameRate:       opts.MaxFrameRate,
+		frameBurst:         opts.FrameBurst,
+		errorPolicy:        opts.ErrorPolicy,
 	}
 }
 
@@ -53,53 +159,80 @@ func (d *Dispatcher) SetConnection(conn io.Reader) {
 	d.conn = conn
 }
 
-// SetControlHandler set handler cho control frames
-func (d *Dispatcher) SetControlHandler(handler func(frame *v1.Frame) error) {
-	d.controlHandler = handler
-}
-
-// SetStreamHandler set handler cho stream frames
-func (d *Dispatcher) SetStreamHandler(handler func(frame *v1.Frame) error) {
-	d.streamHandler = handler
-}
-
-// SetOnConnectionClosed set callback khi connection bị đóng
-func (d *Dispatcher) SetOnConnectionClosed(cb func()) {
-	d.onConnectionClosed = cb
-}
-
-// SetOnError set callback khi có lỗi xảy ra
-func (d *Dispatcher) SetOnError(cb func(err error)) {
-	d.onError = cb
-}
-
-// Start bắt đầu frame reading loop
-func (d *Dispatcher) Start() error {
+// Start bắt đầu frame reading pipeline, pipeline dừng khi ctx bị huỷ hoặc Stop được gọi
+func (d *Dispatcher) Start(ctx context.Context) error {
 	d.runningMu.Lock()
 	if d.running {
 		d.runningMu.Unlock()
 		return ErrAlreadyRunning
 	}
 	d.running = true
+	d.authenticated.Store(false)
+	// Context mới cho mỗi lần Start để dispatcher chạy lại được sau reconnect
+	loopCtx, cancel := context.WithCancel(ctx)
+	d.cancel = cancel
 	d.runningMu.Unlock()
 
-	go d.readLoop()
+	// Read stage và decode/dispatch stage chạy song song, nối bằng queue có giới hạn
+	queue := make(chan rawFrame, d.queueSize)
+	go d.readLoop(loopCtx, queue)
+	go d.dispatchLoop(loopCtx, cancel, queue)
 	return nil
 }
 
-// Stop dừng frame reading loop
+// MarkAuthenticated cho phép heartbeat và stream frames trên connection hiện
+// tại; gọi sau khi Core chấp nhận auth frame
+func (d *Dispatcher) MarkAuthenticated() {
+	d.authenticated.Store(true)
+}
+
+// Stop dừng frame reading pipeline
 func (d *Dispatcher) Stop() {
-	d.cancel()
 	d.runningMu.Lock()
+	if d.cancel != nil {
+		d.cancel()
+	}
 	d.running = false
 	d.runningMu.Unlock()
 }
 
-// readLoop đọc frames liên tục
-func (d *Dispatcher) readLoop() {
+// rawFrame là frame đã đọc từ network nhưng chưa parse. err != nil đánh dấu
+// read stage đã dừng (io.EOF = Core đóng connection), được xử lý sau khi
+// decode stage dispatch hết frames đứng trước nó.
+type rawFrame struct {
+	buf    []byte
+	length uint32
+	err    error
+}
+
+// readLoop là read stage: đọc frames liên tục và đẩy raw bytes vào queue,
+// chờ khi queue đầy. bufio.Reader thuộc riêng loop này và được Reset mỗi khi
+// connection thay đổi.
+func (d *Dispatcher) readLoop(ctx context.Context, queue chan<- rawFrame) {
+	reader := readerPool.Get().(*bufio.Reader)
+	defer func() {
+		reader.Reset(nil)
+		readerPool.Put(reader)
+	}()
+	var readerConn io.Reader
+	// armedAt là lần set read deadline gần nhất của readerConn
+	var armedAt time.Time
+	limiter := newFrameLimiter(d.maxFrameRate, d.frameBurst, nil)
+	var throttled int64
+
+	// push đẩy item vào queue, trả về false nếu pipeline đã dừng
+	push := func(item rawFrame) bool {
+		select {
+		case queue <- item:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
 	for {
 		select {
-		case <-d.ctx.Done():
+		case <-ctx.Done():
 			return
 		default:
 		}
@@ -115,42 +248,57 @@ func (d *Dispatcher) readLoop() {
 			continue
 		}
 
-		// Set read deadline if connection supports it
-		if connWithDeadline, ok := conn.(interface{ SetReadDeadline(time.Time) error }); ok {
-			connWithDeadline.SetReadDeadline(time.Now().Add(d.readTimeout))
+		if conn != readerConn {
+			// Connection mới: bỏ bytes còn buffer của connection cũ
+			reader.Reset(conn)
+			readerConn = conn
+			armedAt = time.Time{}
+		}
+
+		// Idle deadline: chỉ set lại trước khi đọc từ network (buffer rỗng) và
+		// khi đã qua idleTimeout/8 kể từ lần set trước, nên connection bận không
+		// gọi SetReadDeadline mỗi frame. Connection bị drop sau 7/8 tới 1 ×
+		// idleTimeout không nhận được gì.
+		if d.idleTimeout > 0 && reader.Buffered() == 0 {
+			if dl, ok := conn.(interface{ SetReadDeadline(time.Time) error }); ok {
+				if now := time.Now(); now.Sub(armedAt) >= d.idleTimeout/8 {
+					dl.SetReadDeadline(now.Add(d.idleTimeout))
+					armedAt = now
+				}
+			}
 		}
 
 		// 1. Read Frame Length
-		length, err := v1.ReadFrameLength(conn)
+		length, err := v1.ReadFrameLength(reader)
 		if err != nil {
+			if ctx.Err() != nil {
+				// Dispatcher đã bị Stop (disconnect/reconnect), không báo lỗi
+				return
+			}
 			if err == io.EOF {
 				logger.Debug("Connection closed (EOF)")
-				if d.onConnectionClosed != nil {
-					d.onConnectionClosed()
-				}
+				push(rawFrame{err: err})
 				return
 			}
-			// Check timeout
-			if contains(err.Error(), "timeout") {
-				logger.Debug("Read timeout (no data), continuing...")
-				continue
+			if isTimeout(err) {
+				push(rawFrame{err: d.idleTimedOut()})
+				return
 			}
 			logger.Warn("Frame length read error", "error", err)
 			metrics.GetMetrics().IncrementFramesError()
-			if d.onError != nil {
-				d.onError(err)
-			}
+			push(rawFrame{err: err})
 			return
 		}
 
 		// 2. Validate Length (optional check before allocation, ParseFrame also checks but better here)
+		// Protocol không có magic bytes để tìm lại frame header kế tiếp: đoán
+		// header có thể rơi vào payload do client bên ngoài kiểm soát, nên
+		// stream bị hỏng luôn drop connection
 		if length < v1.HeaderSize || length > v1.MaxFrameSize {
 			logger.Warn("Invalid frame size", "length", length)
 			metrics.GetMetrics().IncrementFramesError()
-			// Consume/discard? Or just close connection? Safe to close.
-			if d.onError != nil {
-				d.onError(ErrInvalidFrameSize)
-			}
+			metrics.GetMetrics().IncrementFramesInvalidLength()
+			push(rawFrame{err: ErrInvalidFrameSize})
 			return
 		}
 
@@ -160,11 +308,84 @@ func (d *Dispatcher) readLoop() {
 
 		// 4. Read the rest of the frame (Magic + Header + StreamID + Payload)
 		// Note: buf might be larger than length. We read into buf[:length]
-		if _, err := io.ReadFull(conn, buf[:length]); err != nil {
-			logger.Warn("Frame body read error", "error", err)
+		if _, err := io.ReadFull(reader, buf[:length]); err != nil {
 			v1.PutBuffer(buf) // Return buffer on error
+			if isTimeout(err) {
+				err = d.idleTimedOut()
+			} else {
+				logger.Warn("Frame body read error", "error", err)
+			}
+			push(rawFrame{err: err})
+			return
+		}
+
+		// Frame rate limit: chờ ở read stage trước khi chuyển frame cho decode stage
+		if limiter != nil {
+			if wait := limiter.reserve(); wait > 0 {
+				if throttled == 0 {
+					logger.Warn("Core is sending frames faster than the limit, throttling",
+						"max_frame_rate", d.maxFrameRate)
+				}
+				throttled++
+				metrics.GetMetrics().IncrementFramesThrottled()
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					v1.PutBuffer(buf)
+					return
+				}
+			} else if throttled > 0 {
+				logger.Info("Core frame rate back under the limit", "throttled_frames", throttled)
+				throttled = 0
+			}
+		}
+
+		// Decode stage trả buf về pool sau khi parse
+		if !push(rawFrame{buf: buf, length: length}) {
+			v1.PutBuffer(buf)
+			return
+		}
+	}
+}
+
+// dispatchLoop là decode/dispatch stage: parse frames theo thứ tự đọc và gọi
+// handlers. Khi stage này dừng vì lỗi, stop huỷ read stage.
+func (d *Dispatcher) dispatchLoop(ctx context.Context, stop context.CancelFunc, queue <-chan rawFrame) {
+	violations := 0
+	// violation ghi nhận một frame vi phạm protocol, trả về false khi vượt
+	// MaxViolations và pipeline đã dừng
+	violation := func() bool {
+		metrics.GetMetrics().IncrementProtocolViolations()
+		if violations++; violations <= d.maxViolations {
+			return true
+		}
+		logger.Warn("Too many protocol violations from Core, dropping connection", "violations", violations)
+		stop()
+		if d.onError != nil {
+			d.onError(fmt.Errorf("%w: %d frames rejected", ErrTooManyViolations, violations))
+		}
+		return false
+	}
+
+	for {
+		var raw rawFrame
+		select {
+		case <-ctx.Done():
+			return
+		case raw = <-queue:
+		}
+
+		if raw.err != nil {
+			if raw.err == io.EOF {
+				if d.onConnectionClosed != nil {
+					d.onConnectionClosed()
+				}
+				return
+			}
 			if d.onError != nil {
-				d.onError(err)
+				d.onError(raw.err)
 			}
 			return
 		}
@@ -214,11 +435,14 @@ func (d *Dispatcher) readLoop() {
 		//
 		// ACTUALLY: `ParseFrame` returns `Payload` as slice of `buf`.
 		// Let's copy it immediately so we can return `buf` to pool.
-		frame, err := v1.ParseFrame(buf[:length])
+		buf := raw.buf
+		frame, err := v1.ParseFrame(buf[:raw.length])
 		if err != nil {
 			logger.Warn("Frame parse error", "error", err)
+			d.frameDump.dumpRaw(dumpIn, buf[:raw.length], err)
 			v1.PutBuffer(buf)
 			metrics.GetMetrics().IncrementFramesError()
+			stop()
 			if d.onError != nil {
 				d.onError(err)
 			}
@@ -237,20 +461,56 @@ func (d *Dispatcher) readLoop() {
 		v1.PutBuffer(buf)
 
 		// Track frame received
-		metrics.GetMetrics().IncrementFramesReceived()
+		metrics.GetMetrics().RecordFrameReceived(len(frame.Payload))
+		d.frameDump.dump(dumpIn, frame)
+
+		// Fault injection: drop hoặc corrupt incoming frames
+		if d.faults.Drop(frame.StreamID) {
+			logger.Debug("Chaos: dropped incoming frame", "type", frame.Type, "streamID", frame.StreamID)
+			continue
+		}
+		if payload, ok := d.faults.Corrupt(frame.StreamID, frame.Payload); ok {
+			frame.Payload = payload
+		}
+
+		if err := checkFrame(frame, !d.requireAuth || d.authenticated.Load()); err != nil {
+			logger.Warn("Dropped frame from Core", "error", err, "type", frame.Type, "streamID", frame.StreamID)
+			if !violation() {
+				return
+			}
+			continue
+		}
 
 		// Handle frame
 		if err := d.handleFrame(frame); err != nil {
-			// Frame handling error, log but continue
-			logger.Error("Frame handling error", "error", err, "type", frame.Type, "streamID", frame.StreamID)
+			// ErrorPolicy quyết định bỏ qua, reset stream hay dừng connection
 			metrics.GetMetrics().IncrementFramesError()
+			keep := d.errorPolicy.handleError(frame, err)
+			if errors.Is(err, ErrProtocolViolation) && !violation() {
+				return
+			}
+			if !keep {
+				stop()
+				if d.onError != nil {
+					d.onError(fmt.Errorf("frame handler: %w", err))
+				}
+				return
+			}
 			continue
 		}
 	}
 }
 
-// handleFrame xử lý frame
-func (d *Dispatcher) handleFrame(frame *v1.Frame) error {
+// handleFrame xử lý frame. Panic của handler (frame lỗi đi vào code path chưa
+// được kiểm tra) được chuyển thành lỗi thay vì làm crash agent.
+func (d *Dispatcher) handleFrame(frame *v1.Frame) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic while handling frame", "panic", r, "type", frame.Type, "streamID", frame.StreamID, "stack", string(debug.Stack()))
+			err = fmt.Errorf("%w: handler panicked: %v", ErrProtocolViolation, r)
+		}
+	}()
+
 	// Control frames (StreamID = 0)
 	if frame.IsControlFrame() {
 		if d.controlHandler != nil {
@@ -274,7 +534,15 @@ func (d *Dispatcher) IsRunning() bool {
 	return d.running
 }
 
-// contains checks if string contains substring (case-insensitive)
-func contains(s, substr string) bool {
-	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+// idleTimedOut ghi nhận connection hết idle timeout và trả về ErrIdleTimeout
+func (d *Dispatcher) idleTimedOut() error {
+	logger.Warn("No frames from Core within the idle timeout, dropping connection", "idle_timeout", d.idleTimeout)
+	metrics.GetMetrics().IncrementIdleTimeouts()
+	return ErrIdleTimeout
+}
+
+// isTimeout báo err là lỗi do read deadline
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
 }
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// fuzzSeedFrames encode frames hợp lệ làm seed corpus: auth, open với HTTP
+// request, data, close, heartbeat
+func fuzzSeedFrames(tb testing.TB, frames ...*v1.Frame) []byte {
+	tb.Helper()
+	var buf bytes.Buffer
+	for _, frame := range frames {
+		if err := v1.Encode(&buf, frame); err != nil {
+			tb.Fatalf("encode: %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// FuzzDispatcher đưa bytes tuỳ ý từ "Core" qua read/decode pipeline với các
+// handlers parse như agent thật. Dispatcher phải luôn dừng (EOF hoặc lỗi),
+// không panic và không treo.
+func FuzzDispatcher(f *testing.F) {
+	open, _ := EncodeOpenPayload(StreamKindHTTP, map[string]string{"host": "app.example.com"},
+		[]byte("GET /?a=1 HTTP/1.1\r\nHost: app\r\nContent-Length: 2\r\n\r\nhi"))
+	f.Add(fuzzSeedFrames(f,
+		&v1.Frame{Version: v1.Version, Type: v1.FrameAuth, Payload: []byte(`{"ok":true}`)},
+		&v1.Frame{Version: v1.Version, Type: v1.FrameOpenStream, StreamID: 1, Payload: open},
+		&v1.Frame{Version: v1.Version, Type: v1.FrameData, StreamID: 1, Flags: v1.FlagEndStream, Payload: []byte("body")},
+		&v1.Frame{Version: v1.Version, Type: v1.FrameHeartbeat},
+		&v1.Frame{Version: v1.Version, Type: v1.FrameClose, StreamID: 1},
+	))
+	f.Add(fuzzSeedFrames(f, &v1.Frame{Version: v1.Version, Type: v1.FrameOpenStream, StreamID: 2, Payload: []byte("TUNNEL/1 \r\n\r\n")}))
+	f.Add([]byte{0, 0, 0, 3, 1, 2, 3})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+
+	lf := NewLocalForwarder(LocalForwarderOptions{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		sm := NewStreamManager(nil, StreamManagerOptions{MaxRemoteStreams: 8})
+		done := make(chan struct{})
+		finish := func() {
+			select {
+			case <-done:
+			default:
+				close(done)
+			}
+		}
+
+		var d *Dispatcher
+		d = NewDispatcher(DispatcherOptions{
+			RequireAuth: true,
+			ControlHandler: func(frame *v1.Frame) error {
+				if frame.Type == v1.FrameAuth {
+					d.MarkAuthenticated()
+				}
+				return nil
+			},
+			StreamHandler: func(frame *v1.Frame) error {
+				switch frame.Type {
+				case v1.FrameOpenStream:
+					if err := sm.ValidateRemoteOpen(frame.StreamID); err != nil {
+						return nil
+					}
+					kind, _, body, err := ParseOpenPayload(frame.Payload)
+					if err != nil {
+						return err
+					}
+					if _, err := sm.CreateStream(frame.StreamID); err != nil {
+						return err
+					}
+					if kind == StreamKindHTTP {
+						if _, _, _, headers, _, err := lf.parseRequest(body); err == nil {
+							requestLength(headers)
+						}
+					}
+				case v1.FrameClose:
+					sm.CloseStream(frame.StreamID)
+				}
+				return nil
+			},
+			OnConnectionClosed: finish,
+			OnError:            func(error) { finish() },
+		})
+		d.SetConnection(bytes.NewReader(data))
+		if err := d.Start(context.Background()); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		defer d.Stop()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("dispatcher wedged on input %q", data)
+		}
+	})
+}
+
+// FuzzParseOpenPayload: open header tuỳ ý không được panic và phải tôn trọng
+// giới hạn metadata
+func FuzzParseOpenPayload(f *testing.F) {
+	seed, _ := EncodeOpenPayload(StreamKindTCP, map[string]string{"target": "db:5432"}, []byte("x"))
+	f.Add(seed)
+	f.Add([]byte("TUNNEL/1 http\r\n" + strings.Repeat("k: v\r\n", maxOpenMetadata+1) + "\r\n"))
+	f.Add([]byte("TUNNEL/1 "))
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		kind, metadata, _, err := ParseOpenPayload(payload)
+		if err == nil && (kind == "" || len(metadata) > maxOpenMetadata) {
+			t.Fatalf("accepted kind %q with %d metadata entries", kind, len(metadata))
+		}
+	})
+}
+
+// FuzzParseRequest: request tuỳ ý từ Core không được panic và không được
+// vượt giới hạn header lines
+func FuzzParseRequest(f *testing.F) {
+	f.Add([]byte("POST /a?b=c HTTP/1.1\r\nHost: app\r\nContent-Length: 3\r\n\r\nabc"))
+	f.Add([]byte("GET / HTTP/1.1\r\n" + strings.Repeat("X: y\r\n", maxRequestHeaders+1) + "\r\n"))
+	f.Add([]byte(" \r\n:\r\n\r\n"))
+	lf := NewLocalForwarder(LocalForwarderOptions{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _, _, headers, _, err := lf.parseRequest(data)
+		if err != nil {
+			return
+		}
+		if n := len(headers); n > maxRequestHeaders {
+			t.Fatalf("accepted %d headers", n)
+		}
+		requestLength(headers)
+	})
+}
@@ -0,0 +1,315 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// countingReader đếm số lần Read được gọi trên connection
+type countingReader struct {
+	r     *bytes.Reader
+	reads int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.reads++
+	return c.r.Read(p)
+}
+
+// encodeFrames encode n data frames với payload size bytes
+func encodeFrames(t testing.TB, n, size int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	payload := bytes.Repeat([]byte("x"), size)
+	for i := 0; i < n; i++ {
+		frame := &v1.Frame{Version: v1.Version, Type: v1.FrameData, Flags: v1.FlagNone, StreamID: 1, Payload: payload}
+		if err := v1.Encode(&buf, frame); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// runDispatcher đọc hết conn bằng read loop, trả về số frames đã dispatch
+func runDispatcher(t testing.TB, conn *countingReader) int {
+	t.Helper()
+	frames := 0
+	done := make(chan struct{})
+	d := NewDispatcher(DispatcherOptions{
+		StreamHandler:      func(*v1.Frame) error { frames++; return nil },
+		OnConnectionClosed: func() { close(done) },
+	})
+	d.SetConnection(conn)
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer d.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("read loop did not reach EOF")
+	}
+	return frames
+}
+
+func TestDispatcher_ReadLoopBuffersReads(t *testing.T) {
+	conn := &countingReader{r: bytes.NewReader(encodeFrames(t, 100, 64))}
+
+	if frames := runDispatcher(t, conn); frames != 100 {
+		t.Fatalf("Expected 100 frames, got %d", frames)
+	}
+	// Không có buffer mỗi frame tốn 2 reads (length + body)
+	if conn.reads >= 100 {
+		t.Errorf("Expected buffered reads, got %d reads for 100 frames", conn.reads)
+	}
+}
+
+func TestDispatcher_PipelinePreservesOrder(t *testing.T) {
+	var buf bytes.Buffer
+	for id := uint32(1); id <= 50; id++ {
+		v1.Encode(&buf, &v1.Frame{Version: v1.Version, Type: v1.FrameData, Flags: v1.FlagNone, StreamID: id, Payload: []byte("x")})
+	}
+
+	// Queue nhỏ + handler chậm: read stage phải chờ decode stage
+	var got []uint32
+	done := make(chan struct{})
+	d := NewDispatcher(DispatcherOptions{
+		QueueSize: 1,
+		StreamHandler: func(frame *v1.Frame) error {
+			time.Sleep(time.Millisecond)
+			got = append(got, frame.StreamID)
+			return nil
+		},
+		OnConnectionClosed: func() { close(done) },
+	})
+	d.SetConnection(bytes.NewReader(buf.Bytes()))
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer d.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("pipeline did not reach EOF")
+	}
+
+	// EOF chỉ được báo sau khi mọi frame đứng trước đã dispatch
+	if len(got) != 50 {
+		t.Fatalf("Expected 50 frames before EOF, got %d", len(got))
+	}
+	for i, id := range got {
+		if id != uint32(i+1) {
+			t.Fatalf("Frame %d dispatched out of order: streamID %d", i, id)
+		}
+	}
+}
+
+func BenchmarkDispatcher_ReadLoop(b *testing.B) {
+	for _, size := range []int{64, 1024, DefaultFileChunkSize} {
+		b.Run(fmt.Sprintf("payload=%d", size), func(b *testing.B) {
+			data := encodeFrames(b, b.N, size)
+			conn := &countingReader{r: bytes.NewReader(data)}
+			b.SetBytes(int64(len(data) / b.N))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			runDispatcher(b, conn)
+			b.ReportMetric(float64(conn.reads)/float64(b.N), "reads/frame")
+		})
+	}
+}
+
+// deadlineCounter đếm số lần SetReadDeadline được gọi
+type deadlineCounter struct {
+	net.Conn
+	sets atomic.Int32
+}
+
+func (c *deadlineCounter) SetReadDeadline(t time.Time) error {
+	c.sets.Add(1)
+	return c.Conn.SetReadDeadline(t)
+}
+
+func TestDispatcher_IdleTimeout(t *testing.T) {
+	agent, core := newMemoryPipe()
+	defer core.Close()
+	conn := &deadlineCounter{Conn: agent}
+
+	errCh := make(chan error, 1)
+	frames := make(chan struct{}, 200)
+	d := NewDispatcher(DispatcherOptions{
+		IdleTimeout:   300 * time.Millisecond,
+		StreamHandler: func(*v1.Frame) error { frames <- struct{}{}; return nil },
+		OnError:       func(err error) { errCh <- err },
+	})
+	d.SetConnection(conn)
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer d.Stop()
+
+	// Frames đã buffer được đọc mà không set lại deadline mỗi frame
+	core.Write(encodeFrames(t, 100, 16))
+	for i := 0; i < 100; i++ {
+		<-frames
+	}
+	if sets := conn.sets.Load(); sets > 2 {
+		t.Errorf("SetReadDeadline called %d times for one burst of frames", sets)
+	}
+
+	// Link còn frames đều đặn: không timeout dù tổng thời gian vượt IdleTimeout
+	for i := 0; i < 6; i++ {
+		time.Sleep(100 * time.Millisecond)
+		core.Write(encodeFrames(t, 1, 16))
+	}
+	select {
+	case err := <-errCh:
+		t.Fatalf("connection with regular frames should not time out: %v", err)
+	default:
+	}
+
+	before := metrics.GetMetrics().GetSnapshot().IdleTimeouts
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrIdleTimeout) {
+			t.Fatalf("got %v, want ErrIdleTimeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle connection was not dropped")
+	}
+	if got := metrics.GetMetrics().GetSnapshot().IdleTimeouts - before; got != 1 {
+		t.Errorf("idle timeouts metric = %d, want 1", got)
+	}
+}
+
+func TestDispatcher_FrameAllowlist(t *testing.T) {
+	var buf bytes.Buffer
+	for _, frame := range []*v1.Frame{
+		{Version: v1.Version, Type: v1.FrameData, StreamID: 1, Payload: []byte("early")}, // trước auth: bị drop
+		{Version: v1.Version, Type: v1.FrameHeartbeat},                                   // trước auth: bị drop
+		{Version: v1.Version, Type: v1.FrameAuth, Payload: []byte(`{}`)},
+		{Version: v1.Version, Type: v1.FrameOpenStream, StreamID: 1},
+		{Version: v1.Version, Type: v1.FrameAuth, StreamID: 1}, // AUTH trên stream: bị drop
+		{Version: v1.Version, Type: v1.FrameType(42)},          // type không biết: bị drop
+		{Version: v1.Version, Type: v1.FrameHeartbeat},
+	} {
+		v1.Encode(&buf, frame)
+	}
+
+	var got []v1.FrameType
+	done := make(chan struct{})
+	var d *Dispatcher
+	d = NewDispatcher(DispatcherOptions{
+		RequireAuth: true,
+		ControlHandler: func(frame *v1.Frame) error {
+			got = append(got, frame.Type)
+			if frame.Type == v1.FrameAuth {
+				d.MarkAuthenticated()
+			}
+			return nil
+		},
+		StreamHandler:      func(frame *v1.Frame) error { got = append(got, frame.Type); return nil },
+		OnConnectionClosed: func() { close(done) },
+	})
+	d.SetConnection(&buf)
+	before := metrics.GetMetrics().GetSnapshot().ProtocolViolations
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer d.Stop()
+	<-done
+
+	want := []v1.FrameType{v1.FrameAuth, v1.FrameOpenStream, v1.FrameHeartbeat}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("dispatched %v, want %v", got, want)
+	}
+	if n := metrics.GetMetrics().GetSnapshot().ProtocolViolations - before; n != 4 {
+		t.Errorf("protocol violations = %d, want 4", n)
+	}
+}
+
+func TestDispatcher_ViolationBudget(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 10; i++ {
+		v1.Encode(&buf, &v1.Frame{Version: v1.Version, Type: v1.FrameData, StreamID: 1, Payload: []byte("x")})
+	}
+
+	handled := 0
+	errCh := make(chan error, 1)
+	d := NewDispatcher(DispatcherOptions{
+		MaxViolations: 3,
+		StreamHandler: func(*v1.Frame) error {
+			handled++
+			if handled == 1 {
+				panic("malformed payload")
+			}
+			return fmt.Errorf("%w: bad frame", ErrProtocolViolation)
+		},
+		OnError: func(err error) { errCh <- err },
+	})
+	d.SetConnection(&buf)
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer d.Stop()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrTooManyViolations) {
+			t.Fatalf("got %v, want ErrTooManyViolations", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not dropped after too many violations")
+	}
+	// Panic được recover và tính là violation; frame thứ 4 vượt budget
+	if handled != 4 {
+		t.Errorf("handled %d frames, want 4", handled)
+	}
+}
+
+func TestDispatcher_InvalidLengthDropsConnection(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(encodeFrames(t, 2, 8))
+	// Middlebox chèn rác: length 0xffffffff rồi frames hợp lệ. Agent không
+	// tìm lại header kế tiếp vì header đoán được có thể nằm trong payload.
+	stream.Write([]byte{0xff, 0xff, 0xff, 0xff, 0x00, 0x13, 0x37})
+	stream.Write(encodeFrames(t, 3, 8))
+
+	frames := 0
+	done := make(chan error, 1)
+	d := NewDispatcher(DispatcherOptions{
+		StreamHandler:      func(*v1.Frame) error { frames++; return nil },
+		OnConnectionClosed: func() { done <- nil },
+		OnError:            func(err error) { done <- err },
+	})
+	d.SetConnection(bytes.NewReader(stream.Bytes()))
+
+	before := metrics.GetMetrics().GetSnapshot()
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer d.Stop()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrInvalidFrameSize) || frames != 2 {
+			t.Errorf("%d frames, err %v; want 2 frames and ErrInvalidFrameSize", frames, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatcher did not stop")
+	}
+	after := metrics.GetMetrics().GetSnapshot()
+	if n := after.FramesInvalidLength - before.FramesInvalidLength; n != 1 {
+		t.Errorf("invalid length = %d, want 1", n)
+	}
+}
@@ -0,0 +1,186 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// ErrorClass là mức ảnh hưởng của lỗi do frame handler trả về
+type ErrorClass int
+
+const (
+	// ErrorTransient chỉ ảnh hưởng frame đang xử lý (ví dụ local service tạm lỗi)
+	ErrorTransient ErrorClass = iota
+	// ErrorStream làm stream của frame không dùng được nữa (open header sai,
+	// stream trùng ID, vượt giới hạn streams)
+	ErrorStream
+	// ErrorConnection làm connection không dùng được nữa, agent phải reconnect
+	ErrorConnection
+)
+
+// String trả về tên của class
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorStream:
+		return "stream"
+	case ErrorConnection:
+		return "connection"
+	default:
+		return "transient"
+	}
+}
+
+// ErrorAction là việc dispatcher làm với lỗi của một class
+type ErrorAction int
+
+const (
+	// ActionDefault dùng action mặc định của class
+	ActionDefault ErrorAction = iota
+	// ActionLog log lỗi rồi xử lý frame kế tiếp
+	ActionLog
+	// ActionResetStream reset stream của frame (qua ErrorPolicy.ResetStream)
+	// rồi xử lý frame kế tiếp; lỗi trên control stream chỉ được log
+	ActionResetStream
+	// ActionDisconnect dừng dispatcher và báo OnError để agent reconnect
+	ActionDisconnect
+)
+
+// ParseErrorAction parse tên action: log, reset, disconnect
+func ParseErrorAction(name string) (ErrorAction, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "":
+		return ActionDefault, nil
+	case "log":
+		return ActionLog, nil
+	case "reset":
+		return ActionResetStream, nil
+	case "disconnect":
+		return ActionDisconnect, nil
+	}
+	return ActionDefault, fmt.Errorf("unknown error action %q, expected log, reset or disconnect", name)
+}
+
+// ErrorPolicy quyết định dispatcher xử lý lỗi của control và stream handlers
+// thế nào, thay vì mỗi handler tự chọn giữa bỏ qua và dừng connection. Lỗi
+// được phân loại bằng Classify rồi xử lý theo action của class. Lỗi
+// ErrProtocolViolation vẫn được đếm vào MaxViolations dù action là gì.
+type ErrorPolicy struct {
+	// Classify phân loại lỗi của frame (nil = ClassifyError)
+	Classify func(frame *v1.Frame, err error) ErrorClass
+
+	// Action cho mỗi class (ActionDefault: transient = log, stream = reset,
+	// connection = disconnect)
+	Transient  ErrorAction
+	Stream     ErrorAction
+	Connection ErrorAction
+
+	// ResetStream báo Core stream bị reset và đóng stream phía agent
+	// (nil = chỉ log)
+	ResetStream func(streamID uint32, err error)
+}
+
+// classify trả về class của lỗi
+func (p *ErrorPolicy) classify(frame *v1.Frame, err error) ErrorClass {
+	if p != nil && p.Classify != nil {
+		return p.Classify(frame, err)
+	}
+	return ClassifyError(frame, err)
+}
+
+// action trả về action cho class
+func (p *ErrorPolicy) action(class ErrorClass) ErrorAction {
+	var action ErrorAction
+	if p != nil {
+		switch class {
+		case ErrorTransient:
+			action = p.Transient
+		case ErrorStream:
+			action = p.Stream
+		case ErrorConnection:
+			action = p.Connection
+		}
+	}
+	if action != ActionDefault {
+		return action
+	}
+	switch class {
+	case ErrorStream:
+		return ActionResetStream
+	case ErrorConnection:
+		return ActionDisconnect
+	default:
+		return ActionLog
+	}
+}
+
+// classifiedError là lỗi handler đã tự chọn class
+type classifiedError struct {
+	class ErrorClass
+	err   error
+}
+
+func (e *classifiedError) Error() string { return e.err.Error() }
+func (e *classifiedError) Unwrap() error { return e.err }
+
+// WithErrorClass đánh dấu class cho lỗi handler trả về, thay cho phân loại
+// mặc định của ClassifyError
+func WithErrorClass(err error, class ErrorClass) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// ClassifyError là phân loại mặc định: class đánh dấu bằng WithErrorClass,
+// lỗi làm hỏng framing hoặc trạng thái connection là ErrorConnection, lỗi
+// của một stream (vi phạm protocol, stream không tồn tại hoặc trùng ID, vượt
+// giới hạn, memory cap) là ErrorStream, còn lại là ErrorTransient. Lỗi trên
+// control stream không bao giờ là ErrorStream.
+func ClassifyError(frame *v1.Frame, err error) ErrorClass {
+	var classified *classifiedError
+	class := ErrorTransient
+	switch {
+	case errors.As(err, &classified):
+		class = classified.class
+	case errors.Is(err, ErrTooManyViolations), errors.Is(err, ErrInvalidFrameSize),
+		errors.Is(err, ErrChecksumMismatch), errors.Is(err, ErrConnectionClosed):
+		class = ErrorConnection
+	case errors.Is(err, ErrProtocolViolation), errors.Is(err, ErrStreamNotFound),
+		errors.Is(err, ErrStreamAlreadyExists), errors.Is(err, ErrStreamLimit),
+		errors.Is(err, ErrMemoryPressure):
+		class = ErrorStream
+	}
+	if class == ErrorStream && frame.IsControlFrame() {
+		return ErrorTransient
+	}
+	return class
+}
+
+// handleError áp dụng policy cho lỗi handler trả về, trả về false khi
+// dispatcher phải dừng connection
+func (p *ErrorPolicy) handleError(frame *v1.Frame, err error) bool {
+	class := p.classify(frame, err)
+	action := p.action(class)
+	metrics.GetMetrics().RecordHandlerError(class.String())
+	logger.Error("Frame handling error",
+		"error", err,
+		"class", class,
+		"type", frame.Type,
+		"streamID", frame.StreamID,
+	)
+
+	switch action {
+	case ActionDisconnect:
+		return false
+	case ActionResetStream:
+		if !frame.IsControlFrame() && p != nil && p.ResetStream != nil {
+			p.ResetStream(frame.StreamID, err)
+		}
+	}
+	return true
+}
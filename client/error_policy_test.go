@@ -0,0 +1,128 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+func TestClassifyError(t *testing.T) {
+	data := &v1.Frame{Type: v1.FrameData, StreamID: 1}
+	control := &v1.Frame{Type: v1.FrameAuth, StreamID: v1.StreamIDControl}
+	tests := []struct {
+		name  string
+		frame *v1.Frame
+		err   error
+		want  ErrorClass
+	}{
+		{"local error", data, errors.New("connection refused"), ErrorTransient},
+		{"violation", data, fmt.Errorf("%w: bad header", ErrProtocolViolation), ErrorStream},
+		{"duplicate stream", data, ErrStreamAlreadyExists, ErrorStream},
+		{"stream limit", data, fmt.Errorf("open: %w", ErrStreamLimit), ErrorStream},
+		{"connection closed", data, ErrConnectionClosed, ErrorConnection},
+		{"bad frame size", control, ErrInvalidFrameSize, ErrorConnection},
+		{"control violation", control, ErrProtocolViolation, ErrorTransient},
+		{"auth failure", control, errors.New("auth failed: invalid token"), ErrorTransient},
+		{"marked", data, WithErrorClass(errors.New("corrupt state"), ErrorConnection), ErrorConnection},
+		{"marked wrapped", data, fmt.Errorf("open: %w", WithErrorClass(ErrStreamLimit, ErrorTransient)), ErrorTransient},
+	}
+	for _, tt := range tests {
+		if got := ClassifyError(tt.frame, tt.err); got != tt.want {
+			t.Errorf("%s: class = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrorAction(t *testing.T) {
+	for name, want := range map[string]ErrorAction{"": ActionDefault, "log": ActionLog, " Reset ": ActionResetStream, "disconnect": ActionDisconnect} {
+		if got, err := ParseErrorAction(name); err != nil || got != want {
+			t.Errorf("ParseErrorAction(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseErrorAction("panic"); err == nil {
+		t.Error("unknown action accepted")
+	}
+}
+
+// runPolicy dispatch frames cho handler với policy, trả về lỗi OnError (nil
+// nếu dispatcher đọc hết frames mà không dừng connection)
+func runPolicy(t *testing.T, policy *ErrorPolicy, handler func(*v1.Frame) error, frames ...*v1.Frame) error {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, frame := range frames {
+		v1.Encode(&buf, frame)
+	}
+	done := make(chan error, 1)
+	d := NewDispatcher(DispatcherOptions{
+		StreamHandler:      handler,
+		ErrorPolicy:        policy,
+		OnError:            func(err error) { done <- err },
+		OnConnectionClosed: func() { done <- nil },
+	})
+	d.SetConnection(&buf)
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer d.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatcher neither finished nor stopped")
+		return nil
+	}
+}
+
+func TestErrorPolicy_Actions(t *testing.T) {
+	frames := []*v1.Frame{
+		{Version: v1.Version, Type: v1.FrameData, StreamID: 1, Payload: []byte("a")},
+		{Version: v1.Version, Type: v1.FrameData, StreamID: 3, Payload: []byte("b")},
+		{Version: v1.Version, Type: v1.FrameData, StreamID: 5, Payload: []byte("c")},
+	}
+	errs := map[uint32]error{
+		1: errors.New("local service unavailable"),
+		3: ErrStreamAlreadyExists,
+		5: ErrConnectionClosed,
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		var handled, reset []uint32
+		policy := &ErrorPolicy{ResetStream: func(id uint32, err error) { reset = append(reset, id) }}
+		err := runPolicy(t, policy, func(f *v1.Frame) error {
+			handled = append(handled, f.StreamID)
+			return errs[f.StreamID]
+		}, frames...)
+		if !errors.Is(err, ErrConnectionClosed) {
+			t.Errorf("OnError = %v, want ErrConnectionClosed", err)
+		}
+		if len(handled) != 3 || len(reset) != 1 || reset[0] != 3 {
+			t.Errorf("handled %v, reset %v; want all handled and stream 3 reset", handled, reset)
+		}
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		var handled, reset []uint32
+		policy := &ErrorPolicy{
+			Transient:   ActionDisconnect,
+			Stream:      ActionLog,
+			Connection:  ActionResetStream,
+			ResetStream: func(id uint32, err error) { reset = append(reset, id) },
+		}
+		err := runPolicy(t, policy, func(f *v1.Frame) error {
+			handled = append(handled, f.StreamID)
+			return errs[f.StreamID]
+		}, frames[1], frames[2], frames[0])
+		if err == nil || errs[1].Error() != errors.Unwrap(err).Error() {
+			t.Errorf("OnError = %v, want the transient error", err)
+		}
+		if len(handled) != 3 || len(reset) != 1 || reset[0] != 5 {
+			t.Errorf("handled %v, reset %v; want all handled and stream 5 reset", handled, reset)
+		}
+	})
+}
@@ -12,4 +12,22 @@ var (
 	ErrLocalServiceError   = errors.New("local service error")
 	ErrAlreadyRunning      = errors.New("dispatcher already running")
 	ErrInvalidFrameSize    = errors.New("invalid frame size")
+	ErrStreamIDExhausted   = errors.New("stream ID space exhausted")
+	ErrSendQueueFull       = errors.New("send queue full")
+	ErrChecksumMismatch    = errors.New("checksum mismatch")
+	ErrProtocolViolation   = errors.New("protocol violation")
+	ErrMemoryPressure      = errors.New("agent is over its memory cap")
+	ErrIdleTimeout         = errors.New("no frames from Core within the idle timeout")
+	ErrStreamLimit         = errors.New("stream limit exceeded")
+	ErrTooManyViolations   = errors.New("too many protocol violations from Core")
+	ErrInvalidMetadata     = errors.New("invalid stream metadata")
+
+	ErrResponseTooLarge       = errors.New("local response exceeds the decompressed size limit")
+	ErrTooManyResponseHeaders = errors.New("local response has too many headers")
+	ErrResponseHeaderTimeout  = errors.New("local service did not send response headers in time")
+	ErrResponseReadTimeout    = errors.New("local response body took too long to read")
+	ErrResponseIdleTimeout    = errors.New("local response body stalled")
+
+	ErrInvalidContentLength  = errors.New("invalid Content-Length")
+	ErrContentLengthMismatch = errors.New("body length does not match Content-Length")
 )
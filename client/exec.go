@@ -0,0 +1,305 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/audit"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// StreamKindExec là kind của remote exec streams (opt-in)
+const StreamKindExec = "exec"
+
+// ErrExecNotAllowed trả về khi command không nằm trong allowlist
+var ErrExecNotAllowed = errors.New("command not allowed")
+
+// ExecRule là một entry của exec allowlist: một command line dạng
+// "/usr/bin/journalctl -u * --no-pager". Command phải là absolute path (không
+// tra $PATH); mỗi argument phải khớp chính xác, trừ "*" khớp một argument bất
+// kỳ không bắt đầu bằng "-", nên Core không thêm được options như
+// `find -exec` hay `tar --to-command`.
+type ExecRule struct {
+	Path string
+	Args []string
+}
+
+// ParseExecRule parse một entry của allowlist
+func ParseExecRule(line string) (ExecRule, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ExecRule{}, errors.New("empty exec rule")
+	}
+	if !filepath.IsAbs(fields[0]) {
+		return ExecRule{}, fmt.Errorf("exec rule %q: command must be an absolute path", line)
+	}
+	return ExecRule{Path: filepath.Clean(fields[0]), Args: fields[1:]}, nil
+}
+
+// String trả về rule dạng command line
+func (r ExecRule) String() string {
+	return strings.Join(append([]string{r.Path}, r.Args...), " ")
+}
+
+// Match kiểm tra command (absolute path hoặc tên file của Path) và args
+func (r ExecRule) Match(command string, args []string) bool {
+	if command != r.Path && command != filepath.Base(r.Path) {
+		return false
+	}
+	if len(args) != len(r.Args) {
+		return false
+	}
+	for i, pattern := range r.Args {
+		if pattern == "*" {
+			if strings.HasPrefix(args[i], "-") {
+				return false
+			}
+		} else if args[i] != pattern {
+			return false
+		}
+	}
+	return true
+}
+
+// ExecHandler chạy allowlisted commands cho exec streams do Core mở.
+//
+// Open header metadata:
+//
+//	command: absolute path hoặc tên command của một rule trong allowlist
+//	args:    JSON array arguments, phải khớp args của rule (optional)
+//	pty:     "true" để chạy trong PTY (optional)
+//	cols, rows: kích thước terminal khi dùng PTY (optional)
+//
+// Stream data từ Core được ghi vào stdin, stdout/stderr được gửi về Core.
+// Exit code khác 0 được báo về Core qua error frame.
+type ExecHandler struct {
+	rules   []ExecRule
+	timeout time.Duration
+}
+
+// NewExecHandler tạo ExecHandler mới với allowlist command lines
+// (xem ExecRule)
+func NewExecHandler(allowed []string, timeout time.Duration) (*ExecHandler, error) {
+	h := &ExecHandler{timeout: timeout}
+	for _, line := range allowed {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rule, err := ParseExecRule(line)
+		if err != nil {
+			return nil, err
+		}
+		h.rules = append(h.rules, rule)
+	}
+	return h, nil
+}
+
+// match trả về rule khớp command và args
+func (h *ExecHandler) match(command string, args []string) (ExecRule, bool) {
+	for _, rule := range h.rules {
+		if rule.Match(command, args) {
+			return rule, true
+		}
+	}
+	return ExecRule{}, false
+}
+
+// Timeout trả về thời gian tối đa của một exec session
+func (h *ExecHandler) Timeout() time.Duration {
+	return h.timeout
+}
+
+// Handle chạy command cho exec stream và pipe I/O qua stream.
+// initialInput (body của FrameOpenStream) được ghi vào stdin trước stream data.
+func (h *ExecHandler) Handle(ctx context.Context, stream *Stream, initialInput []byte) error {
+	command, _ := stream.GetMetadata("command")
+	var args []string
+	if rawArgs, ok := stream.GetMetadata("args"); ok && rawArgs != "" {
+		if err := json.Unmarshal([]byte(rawArgs), &args); err != nil {
+			return fmt.Errorf("invalid exec args: %w", err)
+		}
+	}
+	rule, ok := h.match(command, args)
+	if !ok {
+		logger.Warn("Exec request rejected",
+			"audit", true,
+			"streamID", stream.ID,
+			"command", command,
+			"args", args,
+		)
+		audit.Record(audit.TypeExec, "session_start", audit.OutcomeDenied, map[string]any{
+			"stream_id": stream.ID,
+			"command":   command,
+			"args":      args,
+		})
+		return fmt.Errorf("%w: %q %q", ErrExecNotAllowed, command, args)
+	}
+	// Chạy path của rule, không tra $PATH
+	command = rule.Path
+
+	usePTY := false
+	if v, ok := stream.GetMetadata("pty"); ok {
+		usePTY, _ = strconv.ParseBool(v)
+	}
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = execEnv(usePTY)
+
+	startTime := time.Now()
+	logger.Info("Exec session started",
+		"audit", true,
+		"streamID", stream.ID,
+		"command", command,
+		"args", args,
+		"pty", usePTY,
+	)
+	audit.Record(audit.TypeExec, "session_start", audit.OutcomeSuccess, map[string]any{
+		"stream_id": stream.ID,
+		"command":   command,
+		"args":      args,
+		"pty":       usePTY,
+	})
+
+	var (
+		output  int64
+		waitErr error
+	)
+	input := io.MultiReader(bytes.NewReader(initialInput), stream)
+	if usePTY {
+		output, waitErr = h.runPTY(ctx, cmd, stream, input)
+	} else {
+		output, waitErr = h.runPipes(ctx, cmd, stream, input)
+	}
+
+	exitCode := 0
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	logger.Info("Exec session ended",
+		"audit", true,
+		"streamID", stream.ID,
+		"command", command,
+		"exitCode", exitCode,
+		"outputBytes", output,
+		"duration", time.Since(startTime),
+		"error", waitErr,
+	)
+	outcome := audit.OutcomeSuccess
+	endDetails := map[string]any{
+		"stream_id":    stream.ID,
+		"command":      command,
+		"exit_code":    exitCode,
+		"output_bytes": output,
+		"duration_ms":  time.Since(startTime).Milliseconds(),
+	}
+	if waitErr != nil {
+		outcome = audit.OutcomeFailure
+		endDetails["error"] = waitErr.Error()
+	}
+	audit.Record(audit.TypeExec, "session_end", outcome, endDetails)
+
+	if waitErr != nil {
+		var exitErr *exec.ExitError
+		if errors.As(waitErr, &exitErr) {
+			return fmt.Errorf("command exited with status %d", exitErr.ExitCode())
+		}
+		return waitErr
+	}
+	return nil
+}
+
+// execEnv trả về environment tối thiểu của exec sessions. Environment của agent
+// không được kế thừa vì chứa token và credentials (TUNNEL_AGENT_TOKEN,
+// VAULT_TOKEN, AWS_*...); pagers bị thay bằng cat để không mở được shell
+// escape từ pager.
+func execEnv(pty bool) []string {
+	env := []string{"PAGER=cat", "SYSTEMD_PAGER=cat", "GIT_PAGER=cat"}
+	if runtime.GOOS == "windows" {
+		// Nhiều chương trình Windows không chạy được thiếu SystemRoot
+		for _, key := range []string{"PATH", "SystemRoot", "PATHEXT", "ComSpec"} {
+			if v, ok := os.LookupEnv(key); ok {
+				env = append(env, key+"="+v)
+			}
+		}
+	} else {
+		env = append(env, "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		env = append(env, "HOME="+home)
+	}
+	if pty {
+		env = append(env, "TERM=xterm-256color")
+	} else {
+		env = append(env, "TERM=dumb")
+	}
+	return env
+}
+
+// runPipes chạy command với stdin/stdout/stderr pipes
+func (h *ExecHandler) runPipes(ctx context.Context, cmd *exec.Cmd, stream *Stream, input io.Reader) (int64, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	// Gộp stdout và stderr giống terminal
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	go func() {
+		io.Copy(stdin, input)
+		stdin.Close()
+	}()
+
+	outputDone := make(chan int64, 1)
+	go func() {
+		n, _ := copyToStream(ctx, stream, pr, DefaultFileChunkSize)
+		outputDone <- n
+	}()
+
+	waitErr := cmd.Wait()
+	pw.Close()
+	return <-outputDone, waitErr
+}
+
+// runPTY chạy command trong pseudo-terminal
+func (h *ExecHandler) runPTY(ctx context.Context, cmd *exec.Cmd, stream *Stream, input io.Reader) (int64, error) {
+	cols, _ := stream.GetMetadata("cols")
+	rows, _ := stream.GetMetadata("rows")
+	c, _ := strconv.Atoi(cols)
+	r, _ := strconv.Atoi(rows)
+
+	ptmx, err := startPTY(cmd, uint16(c), uint16(r))
+	if err != nil {
+		return 0, err
+	}
+	defer ptmx.Close()
+
+	go io.Copy(ptmx, input)
+
+	outputDone := make(chan int64, 1)
+	go func() {
+		// Đọc ptmx trả về error (EIO) khi process thoát, coi như EOF
+		n, _ := copyToStream(ctx, stream, ptmx, DefaultFileChunkSize)
+		outputDone <- n
+	}()
+
+	waitErr := cmd.Wait()
+	ptmx.Close()
+	return <-outputDone, waitErr
+}
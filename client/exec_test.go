@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestExecStream(t *testing.T, metadata map[string]string) (*Stream, *Connector) {
+	t.Helper()
+	connector := NewConnector("test", ConnectorOptions{})
+	connector.connected = true
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+
+	stream, err := sm.CreateStream(1)
+	if err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+	for k, v := range metadata {
+		stream.SetMetadata(k, v)
+	}
+	return stream, connector
+}
+
+func TestExecHandler_RejectsNotAllowed(t *testing.T) {
+	h, err := NewExecHandler([]string{"/bin/echo"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, _ := newTestExecStream(t, map[string]string{"command": "sh"})
+
+	err = h.Handle(context.Background(), stream, nil)
+	if !errors.Is(err, ErrExecNotAllowed) {
+		t.Errorf("Expected ErrExecNotAllowed, got %v", err)
+	}
+}
+
+func TestNewExecHandler_RequiresAbsolutePath(t *testing.T) {
+	if _, err := NewExecHandler([]string{"journalctl -u *"}, time.Second); err == nil {
+		t.Error("command resolved through $PATH accepted")
+	}
+}
+
+func TestExecRule_Match(t *testing.T) {
+	rule, err := ParseExecRule("/usr/bin/journalctl -u * --no-pager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		command string
+		args    []string
+		want    bool
+	}{
+		{"/usr/bin/journalctl", []string{"-u", "nginx", "--no-pager"}, true},
+		{"journalctl", []string{"-u", "nginx", "--no-pager"}, true},
+		{"/tmp/journalctl", []string{"-u", "nginx", "--no-pager"}, false},
+		{"journalctl", []string{"-u", "nginx"}, false},
+		{"journalctl", []string{"-u", "nginx", "--no-pager", "-f"}, false},
+		// "*" không khớp options
+		{"journalctl", []string{"-u", "--file=/etc/shadow", "--no-pager"}, false},
+		{"journalctl", []string{"-u", "nginx", "--pager"}, false},
+	}
+	for _, tt := range tests {
+		if got := rule.Match(tt.command, tt.args); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.command, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestExecHandler_RejectsUnlistedArgs(t *testing.T) {
+	find, err := exec.LookPath("find")
+	if err != nil {
+		t.Skip("find not available")
+	}
+	h, err := NewExecHandler([]string{find + " /tmp -name *"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, _ := newTestExecStream(t, map[string]string{
+		"command": "find",
+		"args":    `["/tmp","-name","x","-exec","sh","-c","id",";"]`,
+	})
+	if err := h.Handle(context.Background(), stream, nil); !errors.Is(err, ErrExecNotAllowed) {
+		t.Errorf("Expected ErrExecNotAllowed for find -exec, got %v", err)
+	}
+}
+
+func TestExecHandler_RunsAllowedCommand(t *testing.T) {
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat not available")
+	}
+	h, err := NewExecHandler([]string{cat}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, connector := newTestExecStream(t, map[string]string{"command": "cat"})
+	close(stream.dataOut)
+
+	if err := h.Handle(context.Background(), stream, []byte("hello exec")); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+
+	var output strings.Builder
+	for len(connector.sendCh) > 0 {
+		frame := <-connector.sendCh
+		output.Write(frame.Payload)
+	}
+	if output.String() != "hello exec" {
+		t.Errorf("Expected output 'hello exec', got %q", output.String())
+	}
+}
+
+func TestExecHandler_DoesNotInheritEnvironment(t *testing.T) {
+	env, err := exec.LookPath("env")
+	if err != nil {
+		t.Skip("env not available")
+	}
+	t.Setenv("TUNNEL_AGENT_TOKEN", "s3cr3t-agent-token")
+	t.Setenv("PAGER", "less")
+
+	h, err := NewExecHandler([]string{env}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, connector := newTestExecStream(t, map[string]string{"command": "env"})
+	close(stream.dataOut)
+
+	if err := h.Handle(context.Background(), stream, nil); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+
+	var output strings.Builder
+	for len(connector.sendCh) > 0 {
+		frame := <-connector.sendCh
+		output.Write(frame.Payload)
+	}
+	if strings.Contains(output.String(), "TUNNEL_AGENT_TOKEN") {
+		t.Errorf("Exec session inherited the agent token:\n%s", output.String())
+	}
+	if !strings.Contains(output.String(), "PAGER=cat\n") {
+		t.Errorf("Expected PAGER=cat in exec environment:\n%s", output.String())
+	}
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// DefaultFairQuantum là số bytes mỗi stream được ghi trong một lượt round robin
+// của writeLoop (một file chunk)
+const DefaultFairQuantum = DefaultFileChunkSize
+
+// fairQueue giữ frames chờ ghi theo stream và chọn frame kế tiếp bằng deficit
+// round robin theo bytes: mỗi lượt một stream được ghi tối đa quantum bytes,
+// nên stream đang đẩy file lớn không chặn response của các streams khác.
+// Thứ tự frames trong cùng stream được giữ nguyên. Chỉ writeLoop dùng, không
+// cần lock.
+type fairQueue struct {
+	quantum int
+	streams map[uint32]*streamQueue
+	active  []uint32 // ring các streams có frames đang chờ
+	next    int      // vị trí trong active của stream đang tới lượt
+	inTurn  bool     // stream tại next đã được cộng quantum cho lượt này
+	frames  int
+}
+
+// streamQueue là frames đang chờ của một stream
+type streamQueue struct {
+	frames  []*v1.Frame
+	deficit int
+}
+
+func newFairQueue(quantum int) *fairQueue {
+	return &fairQueue{quantum: quantum, streams: make(map[uint32]*streamQueue)}
+}
+
+// frameCost là số bytes frame chiếm trên connection
+func frameCost(frame *v1.Frame) int {
+	return v1.HeaderSize + len(frame.Payload)
+}
+
+// push thêm frame vào cuối queue của stream
+func (q *fairQueue) push(frame *v1.Frame) {
+	sq, ok := q.streams[frame.StreamID]
+	if !ok {
+		sq = &streamQueue{}
+		q.streams[frame.StreamID] = sq
+		q.active = append(q.active, frame.StreamID)
+	}
+	sq.frames = append(sq.frames, frame)
+	q.frames++
+}
+
+// pop lấy frame kế tiếp theo deficit round robin, nil nếu queue rỗng
+func (q *fairQueue) pop() *v1.Frame {
+	for len(q.active) > 0 {
+		if q.next >= len(q.active) {
+			q.next = 0
+		}
+		id := q.active[q.next]
+		sq := q.streams[id]
+		if !q.inTurn {
+			sq.deficit += q.quantum
+			q.inTurn = true
+		}
+
+		frame := sq.frames[0]
+		if cost := frameCost(frame); cost <= sq.deficit {
+			sq.deficit -= cost
+		} else {
+			// Hết lượt: deficit còn lại được giữ cho lượt sau của stream
+			q.next++
+			q.inTurn = false
+			continue
+		}
+
+		sq.frames[0] = nil
+		sq.frames = sq.frames[1:]
+		q.frames--
+		if len(sq.frames) == 0 {
+			// Stream hết frames rời ring và mất deficit còn lại
+			delete(q.streams, id)
+			q.active = append(q.active[:q.next], q.active[q.next+1:]...)
+			q.inTurn = false
+		}
+		return frame
+	}
+	return nil
+}
+
+// frameScheduler là phần send queue nằm trong writeLoop: frames được xếp theo
+// priority của stream, trong mỗi priority các streams được ghi luân phiên
+// bằng fairQueue. Priority cao hơn luôn được ghi trước.
+type frameScheduler struct {
+	classes [3]*fairQueue // theo thứ tự ghi: high, normal, low
+	limit   int
+}
+
+func newFrameScheduler(quantum, limit int) *frameScheduler {
+	s := &frameScheduler{limit: limit}
+	for i := range s.classes {
+		s.classes[i] = newFairQueue(quantum)
+	}
+	return s
+}
+
+// class trả về fairQueue của priority
+func (s *frameScheduler) class(p Priority) *fairQueue {
+	switch p {
+	case PriorityHigh:
+		return s.classes[0]
+	case PriorityLow:
+		return s.classes[2]
+	default:
+		return s.classes[1]
+	}
+}
+
+func (s *frameScheduler) push(frame *v1.Frame, p Priority) {
+	s.class(p).push(frame)
+}
+
+// pop lấy frame kế tiếp của priority cao nhất còn frames, nil nếu rỗng
+func (s *frameScheduler) pop() *v1.Frame {
+	for _, q := range s.classes {
+		if frame := q.pop(); frame != nil {
+			return frame
+		}
+	}
+	return nil
+}
+
+// len trả về số frames đang được giữ
+func (s *frameScheduler) len() int {
+	n := 0
+	for _, q := range s.classes {
+		n += q.frames
+	}
+	return n
+}
+
+// full báo scheduler đã giữ đủ limit frames: writeLoop ngừng lấy thêm từ send
+// queues để producers vẫn bị chặn bởi queue đầy
+func (s *frameScheduler) full() bool {
+	return s.len() >= s.limit
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"testing"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+func dataFrame(streamID uint32, size int) *v1.Frame {
+	return &v1.Frame{Version: v1.Version, Type: v1.FrameData, Flags: v1.FlagNone, StreamID: streamID, Payload: make([]byte, size)}
+}
+
+func TestFairQueue_InterleavesStreams(t *testing.T) {
+	q := newFairQueue(DefaultFairQuantum)
+
+	// Stream 1 đẩy file lớn trước, stream 3 chỉ có một response nhỏ
+	for i := 0; i < 8; i++ {
+		q.push(dataFrame(1, DefaultFileChunkSize))
+	}
+	q.push(dataFrame(3, 512))
+
+	// Stream 3 không phải chờ stream 1 ghi hết file
+	var order []uint32
+	for frame := q.pop(); frame != nil; frame = q.pop() {
+		order = append(order, frame.StreamID)
+	}
+	if len(order) != 9 {
+		t.Fatalf("popped %d frames, want 9", len(order))
+	}
+	if pos := indexOf(order, 3); pos > 1 {
+		t.Errorf("small stream written at position %d behind bulk stream: %v", pos, order)
+	}
+}
+
+func TestFairQueue_SplitsBandwidthByBytes(t *testing.T) {
+	q := newFairQueue(4096)
+	for i := 0; i < 16; i++ {
+		q.push(dataFrame(1, 4096-v1.HeaderSize))
+		q.push(dataFrame(3, 1024-v1.HeaderSize))
+		q.push(dataFrame(3, 1024-v1.HeaderSize))
+		q.push(dataFrame(3, 1024-v1.HeaderSize))
+		q.push(dataFrame(3, 1024-v1.HeaderSize))
+	}
+
+	// Sau 5 lượt mỗi stream được ghi cùng số bytes dù frames khác kích thước
+	bytes := map[uint32]int{}
+	for i := 0; i < 25; i++ {
+		frame := q.pop()
+		bytes[frame.StreamID] += frameCost(frame)
+	}
+	if bytes[1] != 5*4096 || bytes[3] != 5*4096 {
+		t.Errorf("bytes per stream = %v, want equal share", bytes)
+	}
+}
+
+func TestFrameScheduler_PriorityThenFairness(t *testing.T) {
+	s := newFrameScheduler(DefaultFairQuantum, 10)
+	s.push(dataFrame(1, 100), PriorityLow)
+	s.push(dataFrame(3, 100), PriorityNormal)
+	s.push(dataFrame(5, 100), PriorityHigh)
+	s.push(dataFrame(7, 100), PriorityHigh)
+
+	var order []uint32
+	for frame := s.pop(); frame != nil; frame = s.pop() {
+		order = append(order, frame.StreamID)
+	}
+	want := []uint32{5, 7, 3, 1}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+	if s.len() != 0 {
+		t.Errorf("scheduler holds %d frames after draining", s.len())
+	}
+}
+
+func indexOf(ids []uint32, id uint32) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,6 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package client
+
+// oNoFollow không có trên platform này; Pull vẫn kiểm tra symlink bằng Lstat
+const oNoFollow = 0
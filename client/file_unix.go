@@ -0,0 +1,8 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package client
+
+import "syscall"
+
+// oNoFollow làm os.OpenFile thất bại khi path là symlink
+const oNoFollow = syscall.O_NOFOLLOW
@@ -0,0 +1,315 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// StreamKindFile là kind của file transfer streams
+const StreamKindFile = "file"
+
+// File transfer operations
+const (
+	FileOpPush = "push"
+	FileOpPull = "pull"
+)
+
+// DefaultFileChunkSize là kích thước mỗi FrameData khi truyền file
+const DefaultFileChunkSize = 32 * 1024
+
+// maxFileControlSize giới hạn một control message (JSON line) từ Core
+const maxFileControlSize = 64 * 1024
+
+// FileTransfer truyền file giữa agent host và Core qua agent-initiated streams.
+//
+// Push:
+//
+//	Agent → OpenStream(kind=file, op=push, path, size, sha256)
+//	Core  → {"offset": N}\n          (số byte Core đã có, dùng để resume)
+//	Agent → file data từ offset N, FlagEndStream
+//	Core  → {"ok": true, "sha256": "..."}\n  (sha256 bắt buộc, phải khớp)
+//
+// Pull:
+//
+//	Agent → OpenStream(kind=file, op=pull, path, offset)
+//	Core  → {"size": S, "sha256": "..."}\n, file data từ offset, FlagEndStream
+type FileTransfer struct {
+	streamManager *StreamManager
+	chunkSize     int
+}
+
+// FileTransferResult là kết quả của một lần transfer
+type FileTransferResult struct {
+	Op          string        `json:"op"`
+	LocalPath   string        `json:"local_path"`
+	RemotePath  string        `json:"remote_path"`
+	Size        int64         `json:"size"`
+	Transferred int64         `json:"transferred"`
+	Resumed     int64         `json:"resumed_from"`
+	SHA256      string        `json:"sha256"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// fileControl là control message (JSON line) trong file transfer stream
+type fileControl struct {
+	OK     bool   `json:"ok,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// NewFileTransfer tạo FileTransfer mới
+func NewFileTransfer(streamManager *StreamManager) *FileTransfer {
+	return &FileTransfer{
+		streamManager: streamManager,
+		chunkSize:     DefaultFileChunkSize,
+	}
+}
+
+// Push gửi local file lên Core, resume từ offset Core báo về
+func (ft *FileTransfer) Push(ctx context.Context, localPath, remotePath string) (*FileTransferResult, error) {
+	startTime := time.Now()
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	size, checksum, err := fileDigest(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checksum file: %w", err)
+	}
+
+	stream, err := ft.streamManager.OpenStream(ctx, StreamKindFile, map[string]string{
+		"op":     FileOpPush,
+		"path":   remotePath,
+		"size":   strconv.FormatInt(size, 10),
+		"sha256": checksum,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file stream: %w", err)
+	}
+	defer ft.streamManager.CloseStream(stream.ID)
+	// Stream.Read không theo ctx: đóng stream để reads đang chờ Core trả về
+	stop := context.AfterFunc(ctx, func() { ft.streamManager.CloseStreamOf(stream) })
+	defer stop()
+
+	reader := bufio.NewReader(stream)
+
+	// 1. Core báo offset đã có (resume)
+	var ready fileControl
+	if err := readFileControl(ctx, reader, &ready); err != nil {
+		return nil, err
+	}
+	if ready.Offset < 0 || ready.Offset > size {
+		return nil, fmt.Errorf("invalid resume offset %d for file of size %d", ready.Offset, size)
+	}
+	if ready.Offset > 0 {
+		logger.Info("Resuming file push", "path", remotePath, "offset", ready.Offset)
+	}
+
+	// 2. Gửi data từ offset
+	if _, err := f.Seek(ready.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	sent, err := copyToStream(ctx, stream, f, ft.chunkSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send file data: %w", err)
+	}
+	if err := stream.Close(); err != nil {
+		return nil, err
+	}
+
+	// 3. Core xác nhận checksum
+	var done fileControl
+	if err := readFileControl(ctx, reader, &done); err != nil {
+		return nil, err
+	}
+	if !done.OK {
+		return nil, fmt.Errorf("push not acknowledged by core")
+	}
+	// Core phải báo sha256 của file đã nhận, nếu không upload không được kiểm tra
+	if done.SHA256 != checksum {
+		return nil, fmt.Errorf("%w: core stored %s with sha256 %q, want %s", ErrChecksumMismatch, remotePath, done.SHA256, checksum)
+	}
+
+	return &FileTransferResult{
+		Op:          FileOpPush,
+		LocalPath:   localPath,
+		RemotePath:  remotePath,
+		Size:        size,
+		Transferred: sent,
+		Resumed:     ready.Offset,
+		SHA256:      checksum,
+		Duration:    time.Since(startTime),
+	}, nil
+}
+
+// Pull tải file từ Core về localPath. Data được ghi vào localPath + ".part"
+// và chỉ rename khi checksum khớp, nên lần pull sau có thể resume. Khi size
+// hoặc checksum không khớp, ".part" bị xoá để lần pull sau tải lại từ đầu
+// thay vì resume từ bytes hỏng. ".part" không được là symlink, nếu không data
+// sẽ được ghi qua symlink ra ngoài thư mục đích.
+func (ft *FileTransfer) Pull(ctx context.Context, remotePath, localPath string) (*FileTransferResult, error) {
+	startTime := time.Now()
+	partPath := localPath + ".part"
+
+	if info, err := os.Lstat(partPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return nil, fmt.Errorf("partial file %s is a symlink", partPath)
+	}
+	f, err := os.OpenFile(partPath, os.O_CREATE|os.O_RDWR|oNoFollow, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := ft.streamManager.OpenStream(ctx, StreamKindFile, map[string]string{
+		"op":     FileOpPull,
+		"path":   remotePath,
+		"offset": strconv.FormatInt(offset, 10),
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file stream: %w", err)
+	}
+	defer ft.streamManager.CloseStream(stream.ID)
+	stop := context.AfterFunc(ctx, func() { ft.streamManager.CloseStreamOf(stream) })
+	defer stop()
+	// Agent không gửi thêm data cho pull
+	stream.Close()
+
+	reader := bufio.NewReader(stream)
+
+	var header fileControl
+	if err := readFileControl(ctx, reader, &header); err != nil {
+		return nil, err
+	}
+	if header.SHA256 == "" {
+		return nil, fmt.Errorf("%w: core sent no sha256 for %s", ErrChecksumMismatch, remotePath)
+	}
+	if offset > header.Size {
+		// File remote đã thay đổi, không thể resume
+		return nil, fmt.Errorf("partial file %s is larger than remote file, remove it and retry", partPath)
+	}
+
+	received, err := copyWithContext(ctx, f, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive file data: %w", err)
+	}
+
+	size, checksum, err := fileDigest(f)
+	if err != nil {
+		return nil, err
+	}
+	if size != header.Size || checksum != header.SHA256 {
+		f.Close()
+		if err := os.Remove(partPath); err != nil {
+			return nil, fmt.Errorf("%w; failed to remove %s: %v", ErrChecksumMismatch, partPath, err)
+		}
+		return nil, fmt.Errorf("%w: got %d bytes with sha256 %s, want %d bytes with sha256 %s; removed %s",
+			ErrChecksumMismatch, size, checksum, header.Size, header.SHA256, partPath)
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(partPath, localPath); err != nil {
+		return nil, err
+	}
+
+	return &FileTransferResult{
+		Op:          FileOpPull,
+		LocalPath:   localPath,
+		RemotePath:  remotePath,
+		Size:        size,
+		Transferred: received,
+		Resumed:     offset,
+		SHA256:      checksum,
+		Duration:    time.Since(startTime),
+	}, nil
+}
+
+// readFileControl đọc một control message (JSON line, tối đa
+// maxFileControlSize bytes) từ stream
+func readFileControl(ctx context.Context, r *bufio.Reader, msg *fileControl) error {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxFileControlSize {
+			return fmt.Errorf("file control message is larger than %d bytes", maxFileControlSize)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			// Stream bị đóng vì ctx kết thúc: báo lỗi của ctx thay vì EOF
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				err = ctxErr
+			}
+			return fmt.Errorf("failed to read file control message: %w", err)
+		}
+		break
+	}
+	if err := json.Unmarshal(line, msg); err != nil {
+		return fmt.Errorf("invalid file control message: %w", err)
+	}
+	if msg.Error != "" {
+		return fmt.Errorf("core error: %s", msg.Error)
+	}
+	return nil
+}
+
+// copyWithContext copy data từ src sang dst, dừng khi ctx bị huỷ. src là
+// stream bị đóng khi ctx kết thúc, nên EOF sau khi ctx kết thúc là lỗi của ctx.
+func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	var total int64
+	buf := make([]byte, DefaultFileChunkSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return total, werr
+			}
+			total += int64(n)
+		}
+		if err == io.EOF {
+			return total, ctx.Err()
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// fileDigest tính size và sha256 của toàn bộ file
+func fileDigest(f *os.File) (int64, string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pullFrom chạy Pull với Core giả trả về reply (control line + data)
+func pullFrom(t *testing.T, localPath, reply string) error {
+	t.Helper()
+	connector := NewConnector("test", ConnectorOptions{})
+	connector.connected = true
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := NewFileTransfer(sm).Pull(context.Background(), "/artifacts/build.tar.gz", localPath)
+		errCh <- err
+	}()
+	open := <-connector.sendCh
+	stream, ok := sm.GetStream(open.StreamID)
+	if !ok {
+		t.Fatalf("stream %d not found", open.StreamID)
+	}
+	if err := stream.Deliver([]byte(reply)); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	sm.CloseStream(open.StreamID)
+	return <-errCh
+}
+
+func TestFileTransfer_PullChecksumMismatchRemovesPart(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "build.tar.gz")
+	partPath := localPath + ".part"
+	// Phần đã tải trước đó bị hỏng: resume từ offset 3 cho ra file sai checksum
+	if err := os.WriteFile(partPath, []byte("xyz"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("hello world"))
+	header := fmt.Sprintf(`{"size":11,"sha256":%q}`+"\n", hex.EncodeToString(sum[:]))
+
+	if err := pullFrom(t, localPath, header+"lo world"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := os.Stat(partPath); !os.IsNotExist(err) {
+		t.Errorf("corrupt %s was kept (stat error %v)", partPath, err)
+	}
+
+	// Lần pull sau tải lại từ đầu
+	if err := pullFrom(t, localPath, header+"hello world"); err != nil {
+		t.Fatalf("Pull after mismatch failed: %v", err)
+	}
+	if data, _ := os.ReadFile(localPath); string(data) != "hello world" {
+		t.Errorf("local file = %q, want %q", data, "hello world")
+	}
+}
+
+func TestFileTransfer_PullRequiresChecksum(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "build.tar.gz")
+	if err := pullFrom(t, localPath, "{\"size\":5}\nhello"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch without sha256, got %v", err)
+	}
+	if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+		t.Errorf("unverified file was installed at %s", localPath)
+	}
+}
+
+func TestFileTransfer_CancelClosesStream(t *testing.T) {
+	connector := NewConnector("test", ConnectorOptions{})
+	connector.connected = true
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+	localPath := filepath.Join(t.TempDir(), "build.tar.gz")
+
+	// Core mở stream nhưng không bao giờ trả lời
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := NewFileTransfer(sm).Pull(ctx, "/artifacts/build.tar.gz", localPath)
+		errCh <- err
+	}()
+	open := <-connector.sendCh
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Pull did not return after ctx was cancelled")
+	}
+	if _, ok := sm.GetStream(open.StreamID); ok {
+		t.Errorf("stream %d was not closed", open.StreamID)
+	}
+}
+
+func TestFileTransfer_ControlMessageLimit(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "build.tar.gz")
+	huge := `{"size":5,"sha256":"` + string(make([]byte, maxFileControlSize)) + "\n"
+	if err := pullFrom(t, localPath, huge); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Fatalf("expected error for an oversized control message, got %v", err)
+	}
+}
+
+func TestFileTransfer_PullRefusesSymlinkPart(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(t.TempDir(), "authorized_keys")
+	if err := os.WriteFile(target, []byte("original"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	localPath := filepath.Join(dir, "build.tar.gz")
+	if err := os.Symlink(target, localPath+".part"); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	connector := NewConnector("test", ConnectorOptions{})
+	connector.connected = true
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+	if _, err := NewFileTransfer(sm).Pull(context.Background(), "/artifacts/build.tar.gz", localPath); err == nil {
+		t.Fatal("expected Pull to refuse a symlinked .part file")
+	}
+	if len(connector.sendCh) > 0 {
+		t.Error("Pull opened a stream despite the symlinked .part file")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "original" {
+		t.Errorf("symlink target was written: %q", data)
+	}
+}
+
+// pushTo chạy Push với Core giả trả về ready rồi done (control lines)
+func pushTo(t *testing.T, localPath, ready, done string) error {
+	t.Helper()
+	connector := NewConnector("test", ConnectorOptions{})
+	connector.connected = true
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := NewFileTransfer(sm).Push(context.Background(), localPath, "/uploads/app.log")
+		errCh <- err
+	}()
+	open := <-connector.sendCh
+	stream, ok := sm.GetStream(open.StreamID)
+	if !ok {
+		t.Fatalf("stream %d not found", open.StreamID)
+	}
+	if err := stream.Deliver([]byte(ready + done)); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	return <-errCh
+}
+
+func TestFileTransfer_PushRequiresChecksum(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(localPath, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("hello"))
+
+	tests := []struct {
+		name string
+		done string
+		want error
+	}{
+		{"matching", fmt.Sprintf(`{"ok":true,"sha256":%q}`, hex.EncodeToString(sum[:])), nil},
+		{"missing", `{"ok":true}`, ErrChecksumMismatch},
+		{"different", `{"ok":true,"sha256":"00"}`, ErrChecksumMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pushTo(t, localPath, "{\"offset\":0}\n", tt.done+"\n")
+			if tt.want == nil && err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Nguồn của response mà ForwardRequest đã ghi vào stream
+const (
+	// SourceLocal là response của local service qua HTTP
+	SourceLocal = "local"
+	// SourceMQTT là reply (hoặc 504) của MQTT backend
+	SourceMQTT = "mqtt"
+	// SourcePreflight là response CORS preflight do agent trả lời
+	SourcePreflight = "preflight"
+	// SourceUnmatched là response từ template Unmatched
+	SourceUnmatched = "unmatched"
+	// SourceMaintenance là 503 ngoài khung giờ hoạt động
+	SourceMaintenance = "maintenance"
+	// SourceBadRequest là 400 cho request có framing không hợp lệ
+	SourceBadRequest = "bad_request"
+	// SourceForbidden là 403 khi access policy của route từ chối client
+	SourceForbidden = "forbidden"
+	// SourceInvalidSignature là 401 (hoặc 413) khi webhook không qua được kiểm tra chữ ký
+	SourceInvalidSignature = "invalid_signature"
+	// SourceScanBlocked là 403 (hoặc 503) khi content scan chặn hoặc không scan được body
+	SourceScanBlocked = "scan_blocked"
+	// SourceQuotaExceeded là 429 khi tunnel đã dùng hết quota của tháng
+	SourceQuotaExceeded = "quota_exceeded"
+	// SourceThrottled là 429 khi route vượt rate limit
+	SourceThrottled = "throttled"
+	// SourceUnauthorized là 401 (hoặc 503) khi request không qua được xác thực JWT
+	SourceUnauthorized = "unauthorized"
+	// SourceDryRun là 202 của record dry-run mode, request không tới local service
+	SourceDryRun = "dry_run"
+)
+
+// ForwardResult mô tả response mà ForwardRequest đã ghi vào stream. Body được
+// stream thẳng vào tunnel nên ForwardResult chỉ giữ kích thước, không giữ data:
+// callers (metrics, logs, middleware) dùng được kết quả mà không phải parse lại
+// response đã serialize.
+type ForwardResult struct {
+	// Source là một trong các Source* constants, "" nếu chưa xác định được
+	// (request không parse được)
+	Source string
+
+	// Backend là URL của backend được chọn ("" nếu không tới backend nào)
+	Backend string
+
+	// Route là tên route của backend được chọn (Backend.RouteName), "" nếu
+	// request bị trả lời trước khi chọn backend
+	Route string
+
+	// TraceID là trace ID của stream, gửi tới local service và trong response
+	// qua TraceHeader
+	TraceID string
+
+	// StatusCode của final response, 0 nếu response headers chưa được ghi
+	StatusCode int
+
+	// HeaderBytes là kích thước response line và headers đã ghi
+	HeaderBytes int
+
+	// BodyBytes là số bytes body đã ghi sau headers (kể cả chunk framing)
+	BodyBytes int64
+
+	// Started là lúc ForwardRequest bắt đầu xử lý
+	Started time.Time
+
+	// LocalSend và FirstByte tính từ lúc stream được mở tới khi request headers
+	// đã ghi xong tới local service và tới byte response đầu tiên (0 nếu không gọi
+	// local service qua HTTP)
+	LocalSend time.Duration
+	FirstByte time.Duration
+
+	// Duration là tổng thời gian xử lý, tới khi body đã ghi xong hoặc có lỗi
+	Duration time.Duration
+
+	capture *exchangeCapture // exchange đang được record, nil khi không record
+}
+
+// HeadersWritten cho biết response headers đã được ghi vào stream: khi đó lỗi
+// sau này không thể thay bằng response khác
+func (r *ForwardResult) HeadersWritten() bool {
+	return r.StatusCode != 0
+}
+
+// resultWriter ghi vào stream và đếm bytes cho ForwardResult.
+// writeResponseHeader báo response headers qua header.
+// Khi record, capture nhận response headers và body của responses do agent tạo.
+type resultWriter struct {
+	w       io.Writer
+	result  *ForwardResult
+	capture *exchangeCapture
+}
+
+func (rw *resultWriter) Write(p []byte) (int, error) {
+	n, err := rw.w.Write(p)
+	if rw.result.StatusCode != 0 {
+		rw.result.BodyBytes += int64(n)
+		if rw.capture != nil {
+			rw.capture.respBody.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+// header ghi nhận final response đã ghi xong: bytes ghi sau đó thuộc về body
+func (rw *resultWriter) header(statusCode, size int, header http.Header) {
+	rw.result.StatusCode = statusCode
+	rw.result.HeaderBytes = size
+	if rw.capture != nil {
+		rw.capture.respHeader = header.Clone()
+	}
+}
+
+// traceTimings giữ các mốc của latencyTrace; hooks chạy trên goroutines của
+// http.Transport nên dùng atomics
+type traceTimings struct {
+	localSend atomic.Int64
+	firstByte atomic.Int64
+}
+
+// apply copy các mốc đã đo vào result
+func (t *traceTimings) apply(result *ForwardResult) {
+	result.LocalSend = time.Duration(t.localSend.Load())
+	result.FirstByte = time.Duration(t.firstByte.Load())
+}
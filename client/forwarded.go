@@ -0,0 +1,161 @@
+package client
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Stream metadata keys mà Core gửi kèm FrameOpenStream về connection của client public
+const (
+	metaClientIP   = "client_ip"
+	metaClientPort = "client_port"
+	metaProto      = "proto"
+	metaTLSVersion = "tls_version"
+	metaTLSCipher  = "tls_cipher"
+	metaGeoCountry = "geo_country"
+	metaGeoRegion  = "geo_region"
+	metaGeoCity    = "geo_city"
+)
+
+// tunnelHeaderPrefix là prefix của headers agent thêm về TLS/geo của client.
+// Headers cùng prefix từ client luôn bị xoá để không giả mạo được.
+const tunnelHeaderPrefix = "X-Tunnel-"
+
+// clientInfo là thông tin connection của client public lấy từ stream metadata
+type clientInfo struct {
+	IP         string
+	Port       string
+	Proto      string
+	TLSVersion string
+	TLSCipher  string
+	Geo        map[string]string // header suffix -> value
+}
+
+// clientInfoFromStream đọc clientInfo từ metadata của stream
+func clientInfoFromStream(stream *Stream) clientInfo {
+	var info clientInfo
+	if stream == nil {
+		return info
+	}
+	get := func(key string) string {
+		value, _ := stream.GetMetadata(key)
+		return strings.TrimSpace(value)
+	}
+
+	info.IP = get(metaClientIP)
+	info.Port = get(metaClientPort)
+	if host, port, err := net.SplitHostPort(info.IP); err == nil {
+		// Core có thể gửi client_ip dạng ip:port
+		info.IP = host
+		if info.Port == "" {
+			info.Port = port
+		}
+	}
+	info.Proto = strings.ToLower(get(metaProto))
+	info.TLSVersion = get(metaTLSVersion)
+	info.TLSCipher = get(metaTLSCipher)
+	if info.Proto == "" && info.TLSVersion != "" {
+		info.Proto = "https"
+	}
+
+	for key, suffix := range map[string]string{
+		metaGeoCountry: "Geo-Country",
+		metaGeoRegion:  "Geo-Region",
+		metaGeoCity:    "Geo-City",
+	} {
+		if value := get(key); value != "" {
+			if info.Geo == nil {
+				info.Geo = make(map[string]string)
+			}
+			info.Geo[suffix] = value
+		}
+	}
+	return info
+}
+
+// applyForwardedHeaders thêm X-Forwarded-*, X-Real-IP, Forwarded và X-Tunnel-* headers
+// vào request tới local service. Khi trust là false, giá trị client gửi lên bị thay thế
+// bằng thông tin Core cung cấp; khi true, chuỗi proxy có sẵn được giữ và nối thêm.
+func applyForwardedHeaders(req *http.Request, info clientInfo, host string, trust bool) {
+	for key := range req.Header {
+		if strings.HasPrefix(key, tunnelHeaderPrefix) {
+			req.Header.Del(key)
+		}
+	}
+	if !trust {
+		for _, key := range []string{"X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "X-Real-Ip", "Forwarded"} {
+			req.Header.Del(key)
+		}
+	}
+
+	if info.IP != "" {
+		if prior := req.Header.Get("X-Forwarded-For"); prior != "" {
+			req.Header.Set("X-Forwarded-For", prior+", "+info.IP)
+		} else {
+			req.Header.Set("X-Forwarded-For", info.IP)
+		}
+		if req.Header.Get("X-Real-Ip") == "" {
+			req.Header.Set("X-Real-Ip", info.IP)
+		}
+	}
+	if host != "" && req.Header.Get("X-Forwarded-Host") == "" {
+		req.Header.Set("X-Forwarded-Host", host)
+	}
+	if info.Proto != "" && req.Header.Get("X-Forwarded-Proto") == "" {
+		req.Header.Set("X-Forwarded-Proto", info.Proto)
+	}
+
+	if element := forwardedElement(info, host); element != "" {
+		if prior := req.Header.Get("Forwarded"); prior != "" {
+			req.Header.Set("Forwarded", prior+", "+element)
+		} else {
+			req.Header.Set("Forwarded", element)
+		}
+	}
+
+	if info.TLSVersion != "" {
+		req.Header.Set(tunnelHeaderPrefix+"Tls-Version", info.TLSVersion)
+	}
+	if info.TLSCipher != "" {
+		req.Header.Set(tunnelHeaderPrefix+"Tls-Cipher", info.TLSCipher)
+	}
+	for suffix, value := range info.Geo {
+		req.Header.Set(tunnelHeaderPrefix+suffix, value)
+	}
+}
+
+// forwardedElement build một forwarded-element theo RFC 7239
+func forwardedElement(info clientInfo, host string) string {
+	var pairs []string
+	if info.IP != "" {
+		node := info.IP
+		if strings.Contains(node, ":") {
+			node = "[" + node + "]"
+		}
+		if info.Port != "" {
+			node += ":" + info.Port
+		}
+		if strings.ContainsAny(node, ":[") {
+			node = `"` + node + `"`
+		}
+		pairs = append(pairs, "for="+node)
+	}
+	if host != "" {
+		pairs = append(pairs, "host="+forwardedValue(host))
+	}
+	if info.Proto != "" {
+		pairs = append(pairs, "proto="+info.Proto)
+	}
+	return strings.Join(pairs, ";")
+}
+
+// forwardedValue quote value của Forwarded nếu nó không phải token
+func forwardedValue(value string) string {
+	for _, r := range value {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+		}
+	}
+	return value
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// defaultFrameDumpPreview là số bytes payload đầu được dump hex
+const defaultFrameDumpPreview = 64
+
+// Hướng của frame trong dump
+const (
+	dumpIn  = "<" // Core → agent
+	dumpOut = ">" // agent → Core
+)
+
+// Giá trị nhạy cảm trong payload preview được thay bằng '*' cùng độ dài, nên
+// offsets của hex dump vẫn khớp với frame thật
+var (
+	dumpSecretHeader = regexp.MustCompile(`(?i)(?:authorization|proxy-authorization|cookie|set-cookie|x-api-key|x-auth-token)[ \t]*:[ \t]*([^\r\n]*)`)
+	dumpSecretJSON   = regexp.MustCompile(`(?i)"(?:[a-z_]*token|secret|password|api_key)"[ \t]*:[ \t]*"([^"]*)`)
+)
+
+// FrameDumpOptions cấu hình FrameDumper
+type FrameDumpOptions struct {
+	// Preview là số bytes payload đầu được dump hex (default 64, âm = chỉ header)
+	Preview int
+	// Clock cho timestamps (default clock.Real)
+	Clock clock.Clock
+}
+
+// FrameDumper ghi mỗi frame gửi và nhận (header và hex preview của payload)
+// vào một file riêng, như pcap ở mức frame, để debug protocol mismatch với
+// Core. Payload của AUTH frames không được dump; headers và JSON fields chứa
+// secrets bị che trong preview.
+type FrameDumper struct {
+	mu      sync.Mutex
+	w       *bufio.Writer
+	preview int
+	clock   clock.Clock
+}
+
+// NewFrameDumper tạo FrameDumper ghi vào w
+func NewFrameDumper(w io.Writer, opts FrameDumpOptions) *FrameDumper {
+	if opts.Preview == 0 {
+		opts.Preview = defaultFrameDumpPreview
+	}
+	return &FrameDumper{w: bufio.NewWriter(w), preview: max(opts.Preview, 0), clock: clock.Or(opts.Clock)}
+}
+
+// dump ghi frame đã gửi hoặc nhận theo hướng dir
+func (d *FrameDumper) dump(dir string, frame *v1.Frame) {
+	if d == nil {
+		return
+	}
+	header := fmt.Sprintf("%s %s stream=%d flags=%s len=%d",
+		dir, frameTypeName(frame.Type), frame.StreamID, flagNames(frame.Flags), len(frame.Payload))
+	if frame.Version != v1.Version {
+		header += fmt.Sprintf(" version=%d", frame.Version)
+	}
+	payload := frame.Payload
+	if frame.Type == v1.FrameAuth && len(payload) > 0 {
+		header += " payload=redacted"
+		payload = nil
+	}
+	d.write(header, payload)
+}
+
+// dumpRaw ghi bytes của frame không parse được
+func (d *FrameDumper) dumpRaw(dir string, data []byte, err error) {
+	if d == nil {
+		return
+	}
+	d.write(fmt.Sprintf("%s INVALID len=%d error=%q", dir, len(data), err), data)
+}
+
+func (d *FrameDumper) write(header string, payload []byte) {
+	preview := payload[:min(len(payload), d.preview)]
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprintf(d.w, "%s %s\n", d.clock.Now().UTC().Format("15:04:05.000000"), header)
+	if len(preview) > 0 {
+		for _, line := range strings.SplitAfter(hex.Dump(redactPreview(preview)), "\n") {
+			if line != "" {
+				d.w.WriteString("    " + line)
+			}
+		}
+		if len(preview) < len(payload) {
+			fmt.Fprintf(d.w, "    ... %d more bytes\n", len(payload)-len(preview))
+		}
+	}
+	// Flush sau mỗi frame: dump phải còn nguyên khi agent crash
+	d.w.Flush()
+}
+
+// redactPreview trả về bản sao của preview với giá trị secrets bị che
+func redactPreview(preview []byte) []byte {
+	out := append([]byte(nil), preview...)
+	for _, re := range []*regexp.Regexp{dumpSecretHeader, dumpSecretJSON} {
+		for _, m := range re.FindAllSubmatchIndex(out, -1) {
+			for i := m[2]; i < m[3]; i++ {
+				out[i] = '*'
+			}
+		}
+	}
+	return out
+}
+
+// frameTypeName trả về tên của frame type, số với type agent không biết
+func frameTypeName(t v1.FrameType) string {
+	switch t {
+	case v1.FrameOpenStream:
+		return "OPEN_STREAM"
+	case v1.FrameData:
+		return "DATA"
+	case v1.FrameClose:
+		return "CLOSE"
+	case v1.FrameAuth:
+		return "AUTH"
+	case v1.FrameHeartbeat:
+		return "HEARTBEAT"
+	}
+	return fmt.Sprintf("TYPE_%d", uint8(t))
+}
+
+// flagNames trả về flags dạng END_STREAM|ACK, "-" khi không có flag nào
+func flagNames(f v1.Flag) string {
+	var names []string
+	for _, flag := range []struct {
+		flag v1.Flag
+		name string
+	}{{v1.FlagEndStream, "END_STREAM"}, {v1.FlagError, "ERROR"}, {v1.FlagAck, "ACK"}} {
+		if f&flag.flag != 0 {
+			names = append(names, flag.name)
+			f &^= flag.flag
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("0x%02x", uint8(f)))
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, "|")
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+func TestFrameDumper(t *testing.T) {
+	var buf bytes.Buffer
+	mock := clock.NewMock(time.Date(2026, 10, 16, 8, 30, 0, 0, time.UTC))
+	d := NewFrameDumper(&buf, FrameDumpOptions{Preview: 48, Clock: mock})
+
+	payload := []byte("GET / HTTP/1.1\r\nAuthorization: Bearer s3cret\r\nHost: app\r\n\r\n")
+	d.dump(dumpIn, &v1.Frame{Version: v1.Version, Type: v1.FrameData, Flags: v1.FlagEndStream | v1.FlagAck, StreamID: 3, Payload: payload})
+	d.dump(dumpOut, &v1.Frame{Version: v1.Version, Type: v1.FrameAuth, Payload: []byte(`{"token":"s3cret"}`)})
+	d.dump(dumpOut, &v1.Frame{Version: 2, Type: v1.FrameType(42), Flags: v1.Flag(0x80)})
+	d.dumpRaw(dumpIn, []byte{0xde, 0xad}, errors.New("bad magic"))
+	out := buf.String()
+
+	for _, want := range []string{
+		"08:30:00.000000 < DATA stream=3 flags=END_STREAM|ACK len=59\n",
+		"00000000  47 45 54 20 2f 20 48 54  54 50 2f 31 2e 31 0d 0a  |GET / HTTP/1.1..|",
+		"|Authorization: *|",
+		"|************..Ho|",
+		"... 11 more bytes\n",
+		"> AUTH stream=0 flags=- len=18 payload=redacted\n",
+		"> TYPE_42 stream=0 flags=0x80 len=0 version=2\n",
+		"< INVALID len=2 error=\"bad magic\"\n    00000000  de ad",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dump does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "s3cret") {
+		t.Errorf("dump leaks secret:\n%s", out)
+	}
+}
+
+func TestRedactPreview_JSON(t *testing.T) {
+	in := []byte(`{"access_token": "abc", "name":"x", "password":"pw"}`)
+	got := string(redactPreview(in))
+	if want := `{"access_token": "***", "name":"x", "password":"**"}`; got != want {
+		t.Errorf("redactPreview = %s, want %s", got, want)
+	}
+	if len(got) != len(in) {
+		t.Error("redaction changed the length of the preview")
+	}
+}
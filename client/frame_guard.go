@@ -0,0 +1,38 @@
+package client
+
+import (
+	"fmt"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// defaultMaxViolations là số frames vi phạm protocol dispatcher bỏ qua trong
+// một connection trước khi dừng connection
+const defaultMaxViolations = 32
+
+// checkFrame kiểm tra frame type được phép ở trạng thái hiện tại của
+// connection: trước khi authenticate Core chỉ được gửi AUTH và CLOSE trên
+// control stream; stream frames chỉ gồm OPEN_STREAM, DATA và CLOSE.
+func checkFrame(frame *v1.Frame, authenticated bool) error {
+	if frame.IsControlFrame() {
+		switch frame.Type {
+		case v1.FrameAuth, v1.FrameClose:
+			return nil
+		case v1.FrameHeartbeat:
+			if authenticated {
+				return nil
+			}
+			return fmt.Errorf("%w: heartbeat before authentication", ErrProtocolViolation)
+		}
+		return fmt.Errorf("%w: frame type %d on the control stream", ErrProtocolViolation, frame.Type)
+	}
+
+	switch frame.Type {
+	case v1.FrameOpenStream, v1.FrameData, v1.FrameClose:
+		if authenticated {
+			return nil
+		}
+		return fmt.Errorf("%w: stream %d frame before authentication", ErrProtocolViolation, frame.StreamID)
+	}
+	return fmt.Errorf("%w: frame type %d on stream %d", ErrProtocolViolation, frame.Type, frame.StreamID)
+}
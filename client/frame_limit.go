@@ -0,0 +1,64 @@
+package client
+
+import (
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+// frameLimiter là token bucket giới hạn số frames/giây dispatcher nhận từ Core
+// (và số streams Core mở mỗi giây). Không có lock: mỗi limiter chỉ được một
+// goroutine dùng hoặc được caller bảo vệ.
+type frameLimiter struct {
+	clock  clock.Clock
+	rate   float64 // frames mỗi giây
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newFrameLimiter tạo limiter rate frames/giây cho phép burst frames liên tiếp
+// (burst <= 0 dùng rate); rate <= 0 trả về nil (không giới hạn)
+func newFrameLimiter(rate, burst int, c clock.Clock) *frameLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	return &frameLimiter{
+		clock:  clock.Or(c),
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// reserve lấy một token cho frame vừa đọc và trả về thời gian phải chờ trước
+// khi xử lý nó, 0 nếu frame nằm trong giới hạn
+func (l *frameLimiter) reserve() time.Duration {
+	now := l.clock.Now()
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// allow lấy một token nếu còn, không chờ; limiter nil luôn cho phép
+func (l *frameLimiter) allow() bool {
+	if l == nil {
+		return true
+	}
+	if l.reserve() > 0 {
+		// Trả lại token: request bị từ chối không được kéo dài thời gian chờ
+		l.tokens++
+		return false
+	}
+	return true
+}
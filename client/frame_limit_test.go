@@ -0,0 +1,79 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+func TestFrameLimiter_Reserve(t *testing.T) {
+	mock := clock.NewMock(time.Unix(1000, 0))
+	l := newFrameLimiter(10, 3, mock)
+
+	// Burst đi qua ngay, frame tiếp theo chờ 1/rate
+	for i := 0; i < 3; i++ {
+		if wait := l.reserve(); wait != 0 {
+			t.Fatalf("frame %d within burst should not wait, got %s", i+1, wait)
+		}
+	}
+	if wait := l.reserve(); wait != 100*time.Millisecond {
+		t.Errorf("frame over the burst should wait 100ms, got %s", wait)
+	}
+
+	// Tokens hồi lại theo rate nhưng không vượt burst
+	mock.Advance(time.Minute)
+	for i := 0; i < 3; i++ {
+		if wait := l.reserve(); wait != 0 {
+			t.Fatalf("frame %d after refill should not wait, got %s", i+1, wait)
+		}
+	}
+	if wait := l.reserve(); wait == 0 {
+		t.Error("refill should be capped at the burst")
+	}
+}
+
+func TestFrameLimiter_Disabled(t *testing.T) {
+	if l := newFrameLimiter(0, 10, nil); l != nil {
+		t.Error("rate 0 should disable the limiter")
+	}
+}
+
+func TestDispatcher_ThrottlesFrameRate(t *testing.T) {
+	before := metrics.GetMetrics().GetSnapshot().FramesThrottled
+	frames := 0
+	done := make(chan struct{})
+	d := NewDispatcher(DispatcherOptions{
+		MaxFrameRate:       100,
+		FrameBurst:         5,
+		StreamHandler:      func(*v1.Frame) error { frames++; return nil },
+		OnConnectionClosed: func() { close(done) },
+	})
+	d.SetConnection(bytes.NewReader(encodeFrames(t, 15, 8)))
+
+	start := time.Now()
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer d.Stop()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("read loop did not reach EOF")
+	}
+
+	if frames != 15 {
+		t.Errorf("throttled frames must still be dispatched, got %d of 15", frames)
+	}
+	// 10 frames over the burst at 100/s take at least ~100ms
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("frames were not throttled, took %s", elapsed)
+	}
+	if got := metrics.GetMetrics().GetSnapshot().FramesThrottled - before; got != 10 {
+		t.Errorf("throttled frames metric = %d, want 10", got)
+	}
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// framing là cách body của response gửi về Core được delimit
+type framing int
+
+const (
+	// framingNone: response không có body (HEAD, 1xx, 204, 304)
+	framingNone framing = iota
+	// framingLength: body dài đúng Content-Length
+	framingLength
+	// framingChunked: Transfer-Encoding: chunked, có thể kèm trailers
+	framingChunked
+	// framingEOF: HTTP/1.0 không có Content-Length hoặc 101, body kết thúc cùng stream
+	framingEOF
+)
+
+// normalizeFraming sửa Content-Length/Transfer-Encoding của resp cho khớp với
+// body agent sẽ gửi. Body từ local service đã được decode (de-chunk, có thể
+// giải nén) nên headers gốc không còn mô tả đúng body: Transfer-Encoding luôn
+// được bỏ, Content-Length chỉ giữ khi còn đúng, còn lại dùng chunked.
+func normalizeFraming(resp *http.Response, method string) framing {
+	resp.Header.Del("Transfer-Encoding")
+
+	switch {
+	case resp.StatusCode == http.StatusSwitchingProtocols:
+		// Sau upgrade, data chạy tới khi stream kết thúc
+		resp.Header.Del("Content-Length")
+		return framingEOF
+	case !bodyAllowed(resp.StatusCode):
+		if resp.StatusCode != http.StatusNotModified {
+			resp.Header.Del("Content-Length")
+		}
+		return framingNone
+	case method == http.MethodHead:
+		// Content-Length (nếu có) mô tả representation, không phải body
+		return framingNone
+	}
+
+	if prepareTrailers(resp) {
+		return framingChunked
+	}
+	if contentLength(resp.Header) >= 0 {
+		return framingLength
+	}
+	if !resp.ProtoAtLeast(1, 1) {
+		resp.Header.Del("Content-Length")
+		return framingEOF
+	}
+	resp.Header.Del("Content-Length")
+	resp.Header.Set("Transfer-Encoding", "chunked")
+	return framingChunked
+}
+
+// bodyAllowed trả về false với status không có body (1xx, 204, 304)
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// contentLength trả về giá trị Content-Length hợp lệ duy nhất của h, -1 nếu
+// không có hoặc không hợp lệ
+func contentLength(h http.Header) int64 {
+	values := h.Values("Content-Length")
+	if len(values) != 1 {
+		return -1
+	}
+	n, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// requestLength trả về Content-Length của request, -1 nếu không có. Request có
+// Content-Length không hợp lệ, nhiều giá trị khác nhau hoặc đi kèm
+// Transfer-Encoding bị từ chối: local service và Core có thể hiểu body theo
+// hai cách khác nhau (request smuggling).
+func requestLength(h http.Header) (int64, error) {
+	values := h.Values("Content-Length")
+	if len(values) == 0 {
+		return -1, nil
+	}
+	if h.Get("Transfer-Encoding") != "" {
+		return 0, fmt.Errorf("%w: both Content-Length and Transfer-Encoding are set", ErrInvalidContentLength)
+	}
+
+	// Các giá trị giống nhau ("5, 5") được gộp lại (RFC 9110 section 8.6)
+	n := int64(-1)
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			m, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || m < 0 || v[0] == '+' {
+				return 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, value)
+			}
+			if n >= 0 && m != n {
+				return 0, fmt.Errorf("%w: conflicting values %s", ErrInvalidContentLength, strings.Join(values, ", "))
+			}
+			n = m
+		}
+	}
+	return n, nil
+}
+
+// lengthReader đọc đúng n bytes từ r. Body kết thúc sớm hoặc còn data sau n
+// bytes trả về ErrContentLengthMismatch thay vì bị cắt/gửi lặng lẽ. Bytes cuối
+// cùng chỉ được trả sau khi đã biết body kết thúc đúng ở Content-Length, nên
+// local service không bao giờ nhận trọn một request có phần thừa (smuggling).
+type lengthReader struct {
+	r    io.Reader
+	n    int64 // Content-Length khai báo
+	read int64
+}
+
+func (lr *lengthReader) Read(p []byte) (int, error) {
+	if lr.read >= lr.n {
+		return 0, io.EOF
+	}
+
+	if remaining := lr.n - lr.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := lr.r.Read(p)
+	lr.read += int64(n)
+	if err == io.EOF && lr.read < lr.n {
+		return n, fmt.Errorf("%w: request body ended after %d of %d bytes", ErrContentLengthMismatch, lr.read, lr.n)
+	}
+	if err != nil && err != io.EOF {
+		return n, err
+	}
+	if lr.read == lr.n && err == nil {
+		// Đã đủ Content-Length: giữ lại bytes cuối tới khi body kết thúc ở đây
+		if err := lr.checkEnd(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// checkEnd chờ r kết thúc, trả ErrContentLengthMismatch nếu r còn data
+func (lr *lengthReader) checkEnd() error {
+	var probe [1]byte
+	for {
+		n, err := lr.r.Read(probe[:])
+		if n > 0 {
+			return fmt.Errorf("%w: request body is longer than Content-Length %d", ErrContentLengthMismatch, lr.n)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// lengthWriter ghi response body framingLength, kiểm tra body gửi về Core dài
+// đúng Content-Length đã gửi trong headers
+type lengthWriter struct {
+	w       io.Writer
+	n       int64
+	written int64
+}
+
+func (lw *lengthWriter) Write(p []byte) (int, error) {
+	if lw.written+int64(len(p)) > lw.n {
+		return 0, fmt.Errorf("%w: response body is longer than Content-Length %d", ErrContentLengthMismatch, lw.n)
+	}
+	n, err := lw.w.Write(p)
+	lw.written += int64(n)
+	return n, err
+}
+
+// Close báo lỗi nếu body ngắn hơn Content-Length
+func (lw *lengthWriter) Close() error {
+	if lw.written < lw.n {
+		return fmt.Errorf("%w: response body ended after %d of %d bytes", ErrContentLengthMismatch, lw.written, lw.n)
+	}
+	return nil
+}
+
+// writeBadRequest trả 400 cho request có framing không hợp lệ thay vì
+// chuyển tiếp nó tới local service
+func (lf *LocalForwarder) writeBadRequest(w io.Writer, reason error) error {
+	body := reason.Error() + "\n"
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		StatusCode: http.StatusBadRequest,
+		Status:     "400 Bad Request",
+		Header:     make(http.Header),
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Connection", "close")
+	if err := lf.writeResponseHeader(w, resp); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, body)
+	return err
+}
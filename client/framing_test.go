@@ -0,0 +1,321 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// rawBackend trả lời mọi connection bằng response thô rồi đóng connection
+func rawBackend(t *testing.T, response string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == "\r\n" {
+						break
+					}
+				}
+				io.WriteString(conn, response)
+			}()
+		}
+	}()
+	return "http://" + ln.Addr().String()
+}
+
+func TestLocalForwarder_Framing(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		response string
+
+		wantChunked bool
+		wantLength  string // Content-Length header, "" = không có
+		wantBody    string
+	}{
+		{
+			name:       "content-length",
+			method:     http.MethodGet,
+			response:   "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello",
+			wantLength: "5",
+			wantBody:   "hello",
+		},
+		{
+			name:        "chunked",
+			method:      http.MethodGet,
+			response:    "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nhel\r\n2\r\nlo\r\n0\r\n\r\n",
+			wantChunked: true,
+			wantBody:    "hello",
+		},
+		{
+			name:        "chunked overrides conflicting content-length",
+			method:      http.MethodGet,
+			response:    "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+			wantChunked: true,
+			wantBody:    "hello",
+		},
+		{
+			name:        "http/1.1 close-delimited",
+			method:      http.MethodGet,
+			response:    "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\nhello",
+			wantChunked: true,
+			wantBody:    "hello",
+		},
+		{
+			name:     "http/1.0 close-delimited",
+			method:   http.MethodGet,
+			response: "HTTP/1.0 200 OK\r\n\r\nhello",
+			wantBody: "hello",
+		},
+		{
+			name:       "head keeps content-length",
+			method:     http.MethodHead,
+			response:   "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n",
+			wantLength: "100",
+		},
+		{
+			name:     "204 has no framing headers",
+			method:   http.MethodGet,
+			response: "HTTP/1.1 204 No Content\r\nContent-Length: 0\r\n\r\n",
+		},
+		{
+			name:       "304 keeps content-length",
+			method:     http.MethodGet,
+			response:   "HTTP/1.1 304 Not Modified\r\nContent-Length: 10\r\n\r\n",
+			wantLength: "10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: rawBackend(t, tt.response)})
+			stream, connector := newTestExecStream(t, nil)
+			req := tt.method + " / HTTP/1.1\r\nHost: app\r\n\r\n"
+			if _, err := lf.ForwardRequest(context.Background(), stream, []byte(req)); err != nil {
+				t.Fatalf("ForwardRequest failed: %v", err)
+			}
+
+			var raw strings.Builder
+			for len(connector.sendCh) > 0 {
+				raw.Write((<-connector.sendCh).Payload)
+			}
+			head, _, _ := strings.Cut(raw.String(), "\r\n\r\n")
+			if strings.Contains(head, "Transfer-Encoding") && strings.Contains(head, "Content-Length") {
+				t.Errorf("response has both Transfer-Encoding and Content-Length:\n%s", raw.String())
+			}
+
+			resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(raw.String())), &http.Request{Method: tt.method})
+			if err != nil {
+				t.Fatalf("invalid response %q: %v", raw.String(), err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("invalid body %q: %v", raw.String(), err)
+			}
+			if chunked := len(resp.TransferEncoding) > 0; chunked != tt.wantChunked {
+				t.Errorf("chunked = %v, want %v:\n%s", chunked, tt.wantChunked, raw.String())
+			}
+			if got := resp.Header.Get("Content-Length"); got != tt.wantLength {
+				t.Errorf("Content-Length = %q, want %q:\n%s", got, tt.wantLength, raw.String())
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestBuildResponse_SetsContentLength(t *testing.T) {
+	lf := NewLocalForwarder(LocalForwarderOptions{})
+	resp := &http.Response{
+		Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+		StatusCode: http.StatusOK, Status: "200 OK",
+		Header: http.Header{"Transfer-Encoding": {"chunked"}, "Content-Length": {"99"}},
+	}
+	raw := string(lf.buildResponse(resp, []byte("hello")))
+	if strings.Contains(raw, "Transfer-Encoding") || !strings.Contains(raw, "Content-Length: 5\r\n") {
+		t.Errorf("buildResponse should frame the buffered body with its length:\n%s", raw)
+	}
+}
+
+func TestRequestLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  http.Header
+		want    int64
+		wantErr bool
+	}{
+		{name: "absent", header: http.Header{}, want: -1},
+		{name: "valid", header: http.Header{"Content-Length": {"5"}}, want: 5},
+		{name: "identical duplicates", header: http.Header{"Content-Length": {"5", "5, 5"}}, want: 5},
+		{name: "conflicting", header: http.Header{"Content-Length": {"5", "6"}}, wantErr: true},
+		{name: "negative", header: http.Header{"Content-Length": {"-1"}}, wantErr: true},
+		{name: "signed", header: http.Header{"Content-Length": {"+5"}}, wantErr: true},
+		{name: "not a number", header: http.Header{"Content-Length": {"abc"}}, wantErr: true},
+		{name: "with transfer-encoding", header: http.Header{"Content-Length": {"5"}, "Transfer-Encoding": {"chunked"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := requestLength(tt.header)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidContentLength) {
+					t.Errorf("expected ErrInvalidContentLength, got %d, %v", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("requestLength = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalForwarder_RequestContentLength(t *testing.T) {
+	var received atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received.Store(fmt.Sprintf("%d:%s", r.ContentLength, body))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		request string
+		stream  []string // data frames sau initial payload
+
+		wantStatus int   // response gửi về Core, 0 = không kiểm tra
+		wantErr    error // lỗi ForwardRequest
+		wantLocal  string
+	}{
+		{
+			name:       "body split across frames",
+			request:    "POST / HTTP/1.1\r\nHost: app\r\nContent-Length: 10\r\n\r\nhello",
+			stream:     []string{"world"},
+			wantStatus: http.StatusOK,
+			wantLocal:  "10:helloworld",
+		},
+		{
+			name:       "conflicting content-length",
+			request:    "POST / HTTP/1.1\r\nHost: app\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "content-length with transfer-encoding",
+			request:    "POST / HTTP/1.1\r\nHost: app\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "initial body longer than content-length",
+			request:    "POST / HTTP/1.1\r\nHost: app\r\nContent-Length: 2\r\n\r\nhello",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "body shorter than content-length",
+			request: "POST / HTTP/1.1\r\nHost: app\r\nContent-Length: 10\r\n\r\nhello",
+			wantErr: ErrContentLengthMismatch,
+		},
+		{
+			name:    "body longer than content-length",
+			request: "POST / HTTP/1.1\r\nHost: app\r\nContent-Length: 5\r\n\r\nhel",
+			stream:  []string{"lo", "GET /smuggled HTTP/1.1\r\n\r\n"},
+			wantErr: ErrContentLengthMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received.Store("")
+			lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: server.URL})
+			stream, connector := newTestExecStream(t, nil)
+			for _, data := range tt.stream {
+				stream.dataOut <- []byte(data)
+			}
+			close(stream.dataOut)
+
+			_, err := lf.ForwardRequest(context.Background(), stream, []byte(tt.request))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				if got := received.Load(); got != "" {
+					t.Errorf("local service should not receive a complete request, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ForwardRequest failed: %v", err)
+			}
+
+			var raw strings.Builder
+			for len(connector.sendCh) > 0 {
+				raw.Write((<-connector.sendCh).Payload)
+			}
+			resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(raw.String())), nil)
+			if err != nil {
+				t.Fatalf("invalid response %q: %v", raw.String(), err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := received.Load(); got != tt.wantLocal {
+				t.Errorf("local service received %q, want %q", got, tt.wantLocal)
+			}
+		})
+	}
+}
+
+func TestLocalForwarder_ResponseContentLength(t *testing.T) {
+	t.Run("body shorter than content-length", func(t *testing.T) {
+		lf := NewLocalForwarder(LocalForwarderOptions{
+			DefaultURL: rawBackend(t, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nhello"),
+		})
+		stream, _ := newTestExecStream(t, nil)
+		_, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: app\r\n\r\n"))
+		if !errors.Is(err, ErrContentLengthMismatch) {
+			t.Errorf("expected ErrContentLengthMismatch, got %v", err)
+		}
+	})
+
+	t.Run("header rules cannot change framing", func(t *testing.T) {
+		lf := NewLocalForwarder(LocalForwarderOptions{
+			DefaultURL:      rawBackend(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"),
+			ResponseHeaders: HeaderRules{Set: map[string]string{"Content-Length": "99"}},
+		})
+		stream, connector := newTestExecStream(t, nil)
+		if _, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: app\r\n\r\n")); err != nil {
+			t.Fatalf("ForwardRequest failed: %v", err)
+		}
+		var raw strings.Builder
+		for len(connector.sendCh) > 0 {
+			raw.Write((<-connector.sendCh).Payload)
+		}
+		if !strings.Contains(raw.String(), "Content-Length: 5\r\n") {
+			t.Errorf("Content-Length should describe the body:\n%s", raw.String())
+		}
+	})
+}
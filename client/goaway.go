@@ -0,0 +1,47 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// GoAway là payload của control FrameClose khi Core sắp dừng (rolling restart).
+// Agent ngừng nhận stream mới, chờ streams đang chạy kết thúc rồi reconnect
+// tới NextAddress. FrameClose không có payload vẫn là close ngay lập tức.
+type GoAway struct {
+	// NextAddress là Core address để reconnect (rỗng = address hiện tại)
+	NextAddress string `json:"next_address,omitempty"`
+
+	// Reason là lý do Core đóng connection (chỉ để log)
+	Reason string `json:"reason,omitempty"`
+
+	// DrainTimeoutMS giới hạn thời gian chờ streams (0 = dùng default của agent)
+	DrainTimeoutMS int64 `json:"drain_timeout_ms,omitempty"`
+}
+
+// DrainTimeout trả về thời gian drain Core yêu cầu, hoặc fallback nếu Core không gửi
+func (g *GoAway) DrainTimeout(fallback time.Duration) time.Duration {
+	if g.DrainTimeoutMS <= 0 {
+		return fallback
+	}
+	return time.Duration(g.DrainTimeoutMS) * time.Millisecond
+}
+
+// ParseGoAway parse GoAway từ control FrameClose.
+// Returns: (nil, nil) nếu frame là close thường (không có payload).
+func ParseGoAway(frame *v1.Frame) (*GoAway, error) {
+	if frame.Type != v1.FrameClose || !frame.IsControlFrame() {
+		return nil, ErrInvalidFrame
+	}
+	if len(frame.Payload) == 0 {
+		return nil, nil
+	}
+
+	var goAway GoAway
+	if err := json.Unmarshal(frame.Payload, &goAway); err != nil {
+		return nil, err
+	}
+	return &goAway, nil
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+func TestParseGoAway(t *testing.T) {
+	frame := &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameClose,
+		StreamID: v1.StreamIDControl,
+		Payload:  []byte(`{"next_address":"core-2:8443","reason":"deploy","drain_timeout_ms":1500}`),
+	}
+
+	goAway, err := ParseGoAway(frame)
+	if err != nil {
+		t.Fatalf("ParseGoAway failed: %v", err)
+	}
+	if goAway.NextAddress != "core-2:8443" || goAway.Reason != "deploy" {
+		t.Errorf("Unexpected GoAway: %+v", goAway)
+	}
+	if got := goAway.DrainTimeout(time.Minute); got != 1500*time.Millisecond {
+		t.Errorf("Expected drain timeout 1.5s, got %v", got)
+	}
+
+	// Close không có payload là close ngay lập tức
+	frame.Payload = nil
+	if goAway, err := ParseGoAway(frame); goAway != nil || err != nil {
+		t.Errorf("Expected plain close, got %+v, %v", goAway, err)
+	}
+
+	if got := (&GoAway{}).DrainTimeout(time.Minute); got != time.Minute {
+		t.Errorf("Expected fallback drain timeout, got %v", got)
+	}
+
+	// Stream-level close (reset) không phải GoAway
+	frame.StreamID = 3
+	if _, err := ParseGoAway(frame); err != ErrInvalidFrame {
+		t.Errorf("Expected ErrInvalidFrame for stream close, got %v", err)
+	}
+}
@@ -1,80 +1,275 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+	"github.com/hydragon2m/tunnel-agent/internal/health"
 	"github.com/hydragon2m/tunnel-agent/internal/logger"
 	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+	"github.com/hydragon2m/tunnel-agent/internal/scheduler"
 	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
 )
 
-// Heartbeat gửi periodic heartbeat đến Core Server
+// linkStaleFactor: link bị coi là degraded khi không nhận ACK trong
+// linkStaleFactor × interval
+const linkStaleFactor = 3
+
+// HeartbeatJob là tên job heartbeat trong scheduler
+const HeartbeatJob = "heartbeat"
+
+// MaxHeartbeatProbeSize giới hạn payload probe của heartbeat
+const MaxHeartbeatProbeSize = 1 << 20
+
+// Heartbeat gửi periodic heartbeat đến Core Server và theo dõi ACK để cập nhật
+// health check "link" (TCP còn connected chưa chắc Core còn trả lời)
 type Heartbeat struct {
 	connector *Connector
 	interval  time.Duration
-	ctx       context.Context
-	cancel    context.CancelFunc
+	clock     clock.Clock
 	running   bool
+
+	// jobs chạy heartbeat job; nil = Start tạo scheduler riêng (ownJobs)
+	jobs    *scheduler.Scheduler
+	ownJobs bool
+
+	// ACK tracking
+	ackMu   sync.Mutex
+	lastAck time.Time
+	stale   bool
+
+	// Echo probe: payload ngẫu nhiên probeSize bytes trong mỗi heartbeat, Core
+	// echo lại trong ACK. pending là các probes đã gửi chưa nhận echo, theo thứ tự.
+	probeSize int
+	pending   [][]byte
+	noEcho    bool
+
+	// quality nhận RTT/loss của heartbeats (nil = không tính)
+	quality *LinkQuality
 }
 
-// NewHeartbeat tạo Heartbeat mới
-func NewHeartbeat(connector *Connector, interval time.Duration) *Heartbeat {
-	ctx, cancel := context.WithCancel(context.Background())
+// HeartbeatOptions cấu hình Heartbeat. Zero value của mỗi field dùng default.
+type HeartbeatOptions struct {
+	// Clock dùng cho ticker và timestamps (nil = clock.Real; tests dùng clock.Mock)
+	Clock clock.Clock
 
+	// Scheduler chạy heartbeat như job HeartbeatJob (nil = Start tạo scheduler riêng)
+	Scheduler *scheduler.Scheduler
+
+	// ProbeSize bật echo probe: mỗi heartbeat mang ProbeSize bytes ngẫu nhiên và
+	// ACK phải echo lại nguyên vẹn, để phát hiện middleboxes cắt/làm hỏng frames
+	// lớn (0 = tắt)
+	ProbeSize int
+
+	// Quality nhận RTT và ACK của heartbeats (nil = không tính)
+	Quality *LinkQuality
+}
+
+// NewHeartbeat tạo Heartbeat mới
+func NewHeartbeat(connector *Connector, interval time.Duration, opts HeartbeatOptions) *Heartbeat {
 	return &Heartbeat{
 		connector: connector,
 		interval:  interval,
-		ctx:       ctx,
-		cancel:    cancel,
+		clock:     clock.Or(opts.Clock),
+		jobs:      opts.Scheduler,
+		probeSize: opts.ProbeSize,
+		quality:   opts.Quality,
 	}
 }
 
-// Start bắt đầu heartbeat loop
-func (h *Heartbeat) Start() {
+// Start bắt đầu gửi heartbeat mỗi interval. Không có Scheduler, heartbeat
+// dừng khi ctx bị huỷ hoặc Stop được gọi; với scheduler chung, heartbeat dừng
+// theo scheduler hoặc Stop.
+func (h *Heartbeat) Start(ctx context.Context) {
 	if h.running {
 		return
 	}
 	h.running = true
+	if h.jobs == nil {
+		h.jobs = scheduler.New(h.clock)
+		h.ownJobs = true
+		h.jobs.Start(ctx)
+	}
 
-	go h.heartbeatLoop()
+	// Grace period: link chỉ bị coi là stale sau linkStaleFactor intervals
+	h.ackMu.Lock()
+	h.lastAck = h.clock.Now()
+	h.ackMu.Unlock()
+
+	if err := h.jobs.Add(scheduler.Job{Name: HeartbeatJob, Interval: h.interval, Run: h.beat}); err != nil {
+		logger.Error("Failed to schedule heartbeat", "error", err)
+	}
 }
 
-// Stop dừng heartbeat loop
+// Stop dừng heartbeat
 func (h *Heartbeat) Stop() {
-	h.cancel()
+	if !h.running {
+		return
+	}
 	h.running = false
+	h.jobs.Remove(HeartbeatJob)
+	if h.ownJobs {
+		h.jobs.Stop()
+		h.jobs, h.ownJobs = nil, false
+	}
+}
+
+// Ack ghi nhận heartbeat ACK (hoặc frame khác chứng minh Core còn trả lời)
+func (h *Heartbeat) Ack() {
+	if recovered := h.touch(); recovered {
+		logger.Info("Heartbeat ACKs resumed")
+	}
+	updateLinkCheck(health.HealthStatusHealthy, "Heartbeat ACKs received")
+}
+
+// AckEcho ghi nhận heartbeat ACK có payload và kiểm tra echo của probe. Echo
+// bị cắt hoặc khác probe vẫn chứng minh Core còn trả lời, nhưng link bị đánh
+// dấu degraded.
+func (h *Heartbeat) AckEcho(payload []byte) {
+	if h.quality != nil {
+		h.quality.heartbeatAcked()
+	}
+	err := h.verifyEcho(payload)
+	if err == nil {
+		h.Ack()
+		return
+	}
+	h.touch()
+	metrics.GetMetrics().IncrementHeartbeatEchoFailures()
+	logger.Warn("Heartbeat echo mismatch, frames may be truncated or corrupted on the path to Core", "error", err)
+	updateLinkCheck(health.HealthStatusDegraded, err.Error())
+}
+
+// touch cập nhật thời điểm ACK gần nhất, trả về true nếu link vừa hết stale
+func (h *Heartbeat) touch() bool {
+	now := h.clock.Now()
+
+	h.ackMu.Lock()
+	h.lastAck = now
+	recovered := h.stale
+	h.stale = false
+	h.ackMu.Unlock()
+
+	metrics.GetMetrics().IncrementHeartbeatsAcked()
+	metrics.GetMetrics().SetLastHeartbeatAckTime(now)
+	return recovered
 }
 
-// heartbeatLoop gửi heartbeat định kỳ
-func (h *Heartbeat) heartbeatLoop() {
-	ticker := time.NewTicker(h.interval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-h.ctx.Done():
-			return
-		case <-ticker.C:
-			// Send heartbeat
-			if h.connector.IsConnected() {
-				frame := &v1.Frame{
-					Version:  v1.Version,
-					Type:     v1.FrameHeartbeat,
-					Flags:    v1.FlagNone,
-					StreamID: v1.StreamIDControl,
-					Payload:  nil,
-				}
-
-				err := h.connector.SendFrame(frame)
-				if err != nil {
-					metrics.GetMetrics().IncrementHeartbeatsFailed()
-					logger.Warn("Heartbeat send failed", "error", err)
-				} else {
-					metrics.GetMetrics().IncrementHeartbeatsSent()
-					metrics.GetMetrics().SetLastHeartbeatTime(time.Now())
-				}
-			}
+// verifyEcho so payload của ACK với probe đang chờ. ACK không có payload nghĩa
+// là Core không hỗ trợ echo: probe bị tắt thay vì báo lỗi mãi.
+func (h *Heartbeat) verifyEcho(payload []byte) error {
+	h.ackMu.Lock()
+	defer h.ackMu.Unlock()
+
+	if len(h.pending) == 0 {
+		return nil
+	}
+	if len(payload) == 0 {
+		if !h.noEcho {
+			h.noEcho = true
+			h.pending = nil
+			logger.Warn("Core does not echo heartbeat payloads, heartbeat probe disabled", "probe_size", h.probeSize)
+		}
+		return nil
+	}
+
+	// ACK có thể trả lời một probe cũ hơn probe mới nhất khi RTT > interval
+	for i, probe := range h.pending {
+		if bytes.Equal(payload, probe) {
+			h.pending = h.pending[i+1:]
+			return nil
 		}
 	}
+	expected := h.pending[0]
+	h.pending = h.pending[1:]
+	if len(payload) < len(expected) {
+		return fmt.Errorf("heartbeat echo truncated: sent %d bytes, received %d", len(expected), len(payload))
+	}
+	return fmt.Errorf("heartbeat echo corrupted: sent %d bytes, received %d different bytes", len(expected), len(payload))
+}
+
+// nextProbe tạo payload probe cho heartbeat tiếp theo, nil khi probe tắt
+func (h *Heartbeat) nextProbe() []byte {
+	h.ackMu.Lock()
+	defer h.ackMu.Unlock()
+
+	if h.probeSize <= 0 || h.noEcho {
+		return nil
+	}
+	probe := make([]byte, h.probeSize)
+	rand.Read(probe)
+	// Giữ tối đa số probes có thể còn đang chờ trước khi link bị coi là stale
+	if len(h.pending) > linkStaleFactor {
+		h.pending = h.pending[1:]
+	}
+	h.pending = append(h.pending, probe)
+	return probe
+}
+
+// LastAck trả về thời điểm nhận ACK gần nhất
+func (h *Heartbeat) LastAck() time.Time {
+	h.ackMu.Lock()
+	defer h.ackMu.Unlock()
+	return h.lastAck
+}
+
+// checkLink đánh dấu link degraded khi ACK gần nhất quá cũ
+func (h *Heartbeat) checkLink() {
+	now := h.clock.Now()
+
+	h.ackMu.Lock()
+	age := now.Sub(h.lastAck)
+	becameStale := age > linkStaleFactor*h.interval && !h.stale
+	if becameStale {
+		h.stale = true
+	}
+	h.ackMu.Unlock()
+
+	if becameStale {
+		logger.Warn("No heartbeat ACK from server", "last_ack_age", age)
+		updateLinkCheck(health.HealthStatusDegraded, fmt.Sprintf("No heartbeat ACK for %s", age.Round(time.Second)))
+	}
+}
+
+// updateLinkCheck cập nhật health check "link" nếu đã được register
+func updateLinkCheck(status health.HealthStatus, message string) {
+	if check, ok := health.GetHealthChecker().GetCheck("link"); ok {
+		check.UpdateCheck(status, message)
+	}
+}
+
+// beat gửi một heartbeat nếu đang connected
+func (h *Heartbeat) beat(ctx context.Context) {
+	if !h.connector.IsConnected() {
+		return
+	}
+	h.checkLink()
+
+	frame := &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameHeartbeat,
+		Flags:    v1.FlagNone,
+		StreamID: v1.StreamIDControl,
+		Payload:  h.nextProbe(),
+	}
+
+	err := h.connector.SendFrame(ctx, frame)
+	if err != nil {
+		metrics.GetMetrics().IncrementHeartbeatsFailed()
+		logger.Warn("Heartbeat send failed", "error", err)
+	} else {
+		metrics.GetMetrics().IncrementHeartbeatsSent()
+		metrics.GetMetrics().SetLastHeartbeatTime(h.clock.Now())
+		if h.quality != nil {
+			h.quality.heartbeatSent()
+		}
+	}
+	if h.quality != nil {
+		h.quality.evaluate()
+	}
 }
@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+	"github.com/hydragon2m/tunnel-agent/internal/health"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+func TestHeartbeat_SendsOnTick(t *testing.T) {
+	connector := NewConnector("127.0.0.1:0", ConnectorOptions{})
+	connector.connected = true
+	defer connector.Close()
+
+	mock := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	hb := NewHeartbeat(connector, 30*time.Second, HeartbeatOptions{Clock: mock})
+	hb.Start(context.Background())
+	defer hb.Stop()
+
+	mock.BlockUntil(1)
+
+	mock.Advance(29 * time.Second)
+	select {
+	case <-connector.sendCh:
+		t.Fatal("heartbeat sent before interval elapsed")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	for i := 0; i < 3; i++ {
+		mock.Advance(time.Second)
+		select {
+		case frame := <-connector.sendCh:
+			if frame.Type != v1.FrameHeartbeat || frame.StreamID != v1.StreamIDControl {
+				t.Fatalf("unexpected frame: type=%v stream=%d", frame.Type, frame.StreamID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("tick %d: heartbeat not sent", i)
+		}
+		// Lần kế tiếp được hẹn sau khi heartbeat gửi xong
+		mock.BlockUntil(1)
+		mock.Advance(29 * time.Second)
+	}
+}
+
+func TestStreamManager_SnapshotAgeUsesClock(t *testing.T) {
+	mock := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	sm := NewStreamManager(nil, StreamManagerOptions{Clock: mock})
+
+	if _, err := sm.CreateStream(1); err != nil {
+		t.Fatalf("CreateStream: %v", err)
+	}
+	mock.Advance(90 * time.Second)
+
+	infos := sm.Snapshot()
+	if len(infos) != 1 {
+		t.Fatalf("expected 1 stream, got %d", len(infos))
+	}
+	if infos[0].Age != "1m30s" {
+		t.Errorf("Age = %q, want 1m30s", infos[0].Age)
+	}
+}
+
+func TestHeartbeat_LinkDegradesWithoutAck(t *testing.T) {
+	linkCheck := health.GetHealthChecker().RegisterCheck("link")
+
+	connector := NewConnector("127.0.0.1:0", ConnectorOptions{})
+	connector.connected = true
+	defer connector.Close()
+
+	interval := 10 * time.Second
+	mock := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	hb := NewHeartbeat(connector, interval, HeartbeatOptions{Clock: mock})
+	hb.Start(context.Background())
+	defer hb.Stop()
+	hb.Ack()
+
+	mock.BlockUntil(1)
+
+	// tick đợi frame được gửi (checkLink chạy trước khi gửi)
+	tick := func() {
+		t.Helper()
+		mock.BlockUntil(1)
+		mock.Advance(interval)
+		select {
+		case <-connector.sendCh:
+		case <-time.After(time.Second):
+			t.Fatal("heartbeat not sent")
+		}
+	}
+
+	for i := 0; i < linkStaleFactor; i++ {
+		tick()
+	}
+	if status, _, _ := linkCheck.GetStatus(); status != health.HealthStatusHealthy {
+		t.Fatalf("link should stay healthy within %d intervals, got %s", linkStaleFactor, status)
+	}
+
+	tick()
+	if status, message, _ := linkCheck.GetStatus(); status != health.HealthStatusDegraded {
+		t.Fatalf("link should be degraded after missing ACKs, got %s (%s)", status, message)
+	}
+
+	hb.Ack()
+	if status, _, _ := linkCheck.GetStatus(); status != health.HealthStatusHealthy {
+		t.Errorf("link should recover after ACK, got %s", status)
+	}
+	if !hb.LastAck().Equal(mock.Now()) {
+		t.Errorf("LastAck = %v, want %v", hb.LastAck(), mock.Now())
+	}
+}
+
+func TestHeartbeat_ProbeEcho(t *testing.T) {
+	linkCheck := health.GetHealthChecker().RegisterCheck("link")
+
+	connector := NewConnector("127.0.0.1:0", ConnectorOptions{})
+	connector.connected = true
+	defer connector.Close()
+
+	interval := 10 * time.Second
+	mock := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	hb := NewHeartbeat(connector, interval, HeartbeatOptions{Clock: mock, ProbeSize: 1400})
+	hb.Start(context.Background())
+	defer hb.Stop()
+	mock.BlockUntil(1)
+
+	probe := func() []byte {
+		t.Helper()
+		mock.BlockUntil(1)
+		mock.Advance(interval)
+		select {
+		case frame := <-connector.sendCh:
+			return frame.Payload
+		case <-time.After(time.Second):
+			t.Fatal("heartbeat not sent")
+			return nil
+		}
+	}
+
+	payload := probe()
+	if len(payload) != 1400 {
+		t.Fatalf("probe size = %d, want 1400", len(payload))
+	}
+	hb.AckEcho(payload)
+	if status, _, _ := linkCheck.GetStatus(); status != health.HealthStatusHealthy {
+		t.Fatalf("intact echo should keep the link healthy, got %s", status)
+	}
+
+	before := metrics.GetMetrics().GetSnapshot().HeartbeatEchoFailures
+	payload = probe()
+	hb.AckEcho(payload[:512])
+	status, message, _ := linkCheck.GetStatus()
+	if status != health.HealthStatusDegraded || !strings.Contains(message, "truncated") {
+		t.Errorf("truncated echo should degrade the link, got %s (%s)", status, message)
+	}
+	if got := metrics.GetMetrics().GetSnapshot().HeartbeatEchoFailures - before; got != 1 {
+		t.Errorf("echo failures metric = %d, want 1", got)
+	}
+
+	// ACK trả lời probe cũ hơn (RTT > interval) vẫn hợp lệ
+	older, newer := probe(), probe()
+	hb.AckEcho(older)
+	hb.AckEcho(newer)
+	if status, _, _ := linkCheck.GetStatus(); status != health.HealthStatusHealthy {
+		t.Errorf("delayed echoes should recover the link, got %s", status)
+	}
+
+	// Core không echo: probe bị tắt
+	probe()
+	hb.AckEcho(nil)
+	if payload := probe(); payload != nil {
+		t.Errorf("probe should be disabled when Core does not echo, got %d bytes", len(payload))
+	}
+}
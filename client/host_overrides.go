@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// HostOverrides map hostname hoặc host:port của backend tới IP, như hosts file
+// hoặc curl --resolve. Key host:port được ưu tiên hơn key chỉ có hostname.
+type HostOverrides map[string]string
+
+// normalize trả về bản sao với keys viết thường (nil nếu rỗng)
+func (h HostOverrides) normalize() HostOverrides {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(HostOverrides, len(h))
+	for name, ip := range h {
+		out[strings.ToLower(name)] = ip
+	}
+	return out
+}
+
+// rewrite thay host của dial address bằng IP được cấu hình, port giữ nguyên
+func (h HostOverrides) rewrite(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	host = strings.ToLower(host)
+	if ip, ok := h[net.JoinHostPort(host, port)]; ok {
+		return net.JoinHostPort(ip, port)
+	}
+	if ip, ok := h[host]; ok {
+		return net.JoinHostPort(ip, port)
+	}
+	return addr
+}
+
+// DialContext bọc dial để connections tới hosts được override không cần DNS.
+// Chỉ dial address thay đổi: Host header và TLS server name vẫn là hostname.
+func (h HostOverrides) DialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	hosts := h.normalize()
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dial(ctx, network, hosts.rewrite(addr))
+	}
+}
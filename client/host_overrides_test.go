@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHostOverrides_Rewrite(t *testing.T) {
+	hosts := HostOverrides{"API.internal": "10.0.0.5", "api.internal:8443": "10.0.0.9", "v6.internal": "fd00::7"}.normalize()
+
+	tests := map[string]string{
+		"api.internal:80":   "10.0.0.5:80",
+		"Api.Internal:8443": "10.0.0.9:8443",
+		"v6.internal:443":   "[fd00::7]:443",
+		"other.internal:80": "other.internal:80",
+		"no-port":           "no-port",
+	}
+	for addr, want := range tests {
+		if got := hosts.rewrite(addr); got != want {
+			t.Errorf("rewrite(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestLocalForwarder_HostOverrides(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "host="+r.Host)
+	}))
+	defer backend.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+
+	// Tên .invalid không bao giờ resolve được qua DNS
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		DefaultURL:    "http://backend.invalid:" + port,
+		HostOverrides: HostOverrides{"backend.invalid": "127.0.0.1"},
+	})
+	stream, connector := newTestExecStream(t, nil)
+	if _, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: app.example.com\r\n\r\n")); err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+
+	var resp strings.Builder
+	for len(connector.sendCh) > 0 {
+		resp.Write((<-connector.sendCh).Payload)
+	}
+	if !strings.Contains(resp.String(), "host=app.example.com") {
+		t.Errorf("response = %q, want the backend reached with the original Host", resp.String())
+	}
+}
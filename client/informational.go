@@ -0,0 +1,62 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+// informationalTrace trả về ClientTrace ghi các 1xx responses của local
+// service (ví dụ 103 Early Hints) vào w trước final response. 100 Continue
+// thuộc về connection tới local service nên không được forward.
+func informationalTrace(w io.Writer) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusContinue {
+				return nil
+			}
+
+			var buf bytes.Buffer
+			fmt.Fprintf(&buf, "HTTP/1.1 %d %s\r\n", code, http.StatusText(code))
+			for key, values := range header {
+				for _, value := range values {
+					fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+				}
+			}
+			buf.WriteString("\r\n")
+			_, err := w.Write(buf.Bytes())
+			return err
+		},
+	}
+}
+
+// latencyTrace thêm vào trace các hooks đo thời gian từ lúc stream được mở
+// (nhận FrameOpenStream) tới khi request headers đã ghi xong tới local service
+// và tới byte response đầu tiên, vào metrics và timings. Mỗi mốc chỉ được ghi
+// một lần cho mỗi stream.
+func latencyTrace(trace *httptrace.ClientTrace, opened time.Time, timings *traceTimings) *httptrace.ClientTrace {
+	var sent, firstByte bool
+	trace.WroteHeaders = func() {
+		if !sent {
+			sent = true
+			elapsed := time.Since(opened)
+			timings.localSend.Store(int64(elapsed))
+			metrics.GetMetrics().RecordStreamLocalSend(elapsed)
+		}
+	}
+	trace.GotFirstResponseByte = func() {
+		if !firstByte {
+			firstByte = true
+			elapsed := time.Since(opened)
+			timings.firstByte.Store(int64(elapsed))
+			metrics.GetMetrics().RecordStreamFirstByte(elapsed)
+		}
+	}
+	return trace
+}
@@ -0,0 +1,511 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // hashes của RS256/ES256
+	_ "crypto/sha512" // hashes của RS384/RS512/ES384/ES512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidToken là lỗi của request không có JWT hợp lệ (agent trả 401)
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrJWKSUnavailable là lỗi khi không lấy được JWKS để kiểm tra token (agent trả 503)
+	ErrJWKSUnavailable = errors.New("JWKS unavailable")
+)
+
+const (
+	defaultJWKSCacheTTL = time.Hour
+	defaultJWTLeeway    = time.Minute
+	// jwksRefreshInterval giới hạn số lần tải lại JWKS khi gặp kid lạ (key rotation)
+	jwksRefreshInterval = time.Minute
+	// jwksRetryInterval là khoảng thử lại khi chưa tải được JWKS lần nào
+	jwksRetryInterval = 5 * time.Second
+	// maxJWKSSize giới hạn response của JWKS endpoint
+	maxJWKSSize = 1 << 20
+)
+
+// JWTOptions cấu hình xác thực JWT của requests trước khi forward tới local service
+type JWTOptions struct {
+	// JWKSURL là URL của JSON Web Key Set chứa public keys của issuer
+	JWKSURL string
+
+	// Issuer là giá trị bắt buộc của claim iss ("" = không kiểm tra)
+	Issuer string
+
+	// Audience: claim aud phải chứa ít nhất một giá trị (rỗng = không kiểm tra)
+	Audience []string
+
+	// ClaimHeaders là mapping claim -> request header gửi tới local service
+	// (ví dụ "sub" -> "X-User-Id"). Headers này từ client luôn bị xoá.
+	ClaimHeaders map[string]string
+
+	// Leeway cho phép lệch đồng hồ khi kiểm tra exp/nbf (default 1m)
+	Leeway time.Duration
+
+	// CacheTTL là thời gian cache JWKS (default 1h)
+	CacheTTL time.Duration
+
+	// HTTPClient tải JWKS (default: client với timeout 10s)
+	HTTPClient *http.Client
+}
+
+// jwtValidator kiểm tra JWT trong Authorization: Bearer header
+type jwtValidator struct {
+	opts JWTOptions
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey // kid -> key
+	keyAlgs   map[string]string           // kid -> alg của JWK ("" nếu không khai báo)
+	fetchedAt time.Time
+	lastTry   time.Time
+	inflight  *jwksFetch // lần tải JWKS đang chạy, nil nếu không có
+}
+
+// jwksFetch là một lần tải JWKS; requests cần keys mới chờ done thay vì
+// cùng tải lại
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// newJWTValidator tạo validator từ options, nil nếu opts là nil
+func newJWTValidator(opts *JWTOptions) *jwtValidator {
+	if opts == nil {
+		return nil
+	}
+	v := &jwtValidator{opts: *opts}
+	if v.opts.Leeway <= 0 {
+		v.opts.Leeway = defaultJWTLeeway
+	}
+	if v.opts.CacheTTL <= 0 {
+		v.opts.CacheTTL = defaultJWKSCacheTTL
+	}
+	if v.opts.HTTPClient == nil {
+		v.opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return v
+}
+
+// authenticate kiểm tra JWT của request và trả về claims
+func (v *jwtValidator) authenticate(ctx context.Context, headers http.Header) (map[string]any, error) {
+	scheme, token, _ := strings.Cut(headers.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, fmt.Errorf("%w: missing bearer token", ErrInvalidToken)
+	}
+	return v.validate(ctx, strings.TrimSpace(token), time.Now())
+}
+
+// validate kiểm tra chữ ký và claims của token tại thời điểm now
+func (v *jwtValidator) validate(ctx context.Context, token string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+
+	key, keyAlg, err := v.key(ctx, header.Kid, now)
+	if err != nil {
+		return nil, err
+	}
+	if keyAlg != "" && keyAlg != header.Alg {
+		return nil, fmt.Errorf("%w: key %q is for %s, token uses %s", ErrInvalidToken, header.Kid, keyAlg, header.Alg)
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.checkClaims(claims, now); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// checkClaims kiểm tra exp (bắt buộc), nbf, iss và aud
+func (v *jwtValidator) checkClaims(claims map[string]any, now time.Time) error {
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return errors.New("missing exp")
+	}
+	if now.After(exp.Add(v.opts.Leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.opts.Leeway).Before(nbf) {
+		return errors.New("token not valid yet")
+	}
+	if v.opts.Issuer != "" && claims["iss"] != v.opts.Issuer {
+		return fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if len(v.opts.Audience) > 0 && !audienceMatches(claims["aud"], v.opts.Audience) {
+		return fmt.Errorf("unexpected audience %v", claims["aud"])
+	}
+	return nil
+}
+
+// applyClaims xoá ClaimHeaders client gửi lên và đặt lại từ claims
+func (v *jwtValidator) applyClaims(headers http.Header, claims map[string]any) {
+	for claim, name := range v.opts.ClaimHeaders {
+		headers.Del(name)
+		if value, ok := claimString(claims[claim]); ok && !strings.ContainsAny(value, "\r\n") {
+			headers.Set(name, value)
+		}
+	}
+}
+
+// writeUnauthorized trả 401 cho request không có JWT hợp lệ, 503 khi không
+// lấy được JWKS để kiểm tra
+func (lf *LocalForwarder) writeUnauthorized(w io.Writer, reason error) error {
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		StatusCode: http.StatusUnauthorized,
+		Status:     "401 Unauthorized",
+		Header:     make(http.Header),
+	}
+	body := "unauthorized\n"
+	if errors.Is(reason, ErrJWKSUnavailable) {
+		resp.StatusCode, resp.Status = http.StatusServiceUnavailable, "503 Service Unavailable"
+		body = "unable to verify credentials, retry later\n"
+		resp.Header.Set("Retry-After", "5")
+	} else {
+		resp.Header.Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Cache-Control", "no-store")
+	if err := lf.writeResponseHeader(w, resp); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, body)
+	return err
+}
+
+// key trả về public key theo kid: tải JWKS khi cache hết hạn hoặc khi gặp kid
+// lạ (tối đa mỗi jwksRefreshInterval một lần). JWKS được tải ngoài lock và chỉ
+// một lần tại một thời điểm: requests có key trong cache dùng keys cũ ngay,
+// requests cần key mới chờ lần tải đang chạy. Không tải được thì dùng keys cũ.
+func (v *jwtValidator) key(ctx context.Context, kid string, now time.Time) (crypto.PublicKey, string, error) {
+	v.mu.Lock()
+	key, alg, found := v.find(kid)
+	stale := now.Sub(v.fetchedAt) > v.opts.CacheTTL
+	interval := jwksRefreshInterval
+	if v.keys == nil {
+		interval = jwksRetryInterval
+	}
+	if (stale || !found) && v.inflight == nil && now.Sub(v.lastTry) >= interval {
+		v.lastTry = now
+		v.inflight = &jwksFetch{done: make(chan struct{})}
+		// Lần tải dùng chung cho mọi requests nên không bị huỷ theo request này
+		go v.refresh(context.WithoutCancel(ctx), v.inflight, now)
+	}
+	call := v.inflight
+	v.mu.Unlock()
+
+	if found {
+		return key, alg, nil
+	}
+	if call != nil {
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, "", fmt.Errorf("%w: %v", ErrJWKSUnavailable, ctx.Err())
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if key, alg, found = v.find(kid); found {
+		return key, alg, nil
+	}
+	if v.keys == nil {
+		if call != nil && call.err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrJWKSUnavailable, call.err)
+		}
+		return nil, "", fmt.Errorf("%w: keys not loaded yet", ErrJWKSUnavailable)
+	}
+	return nil, "", fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+}
+
+// find tìm key theo kid trong cache; v.mu phải được giữ
+func (v *jwtValidator) find(kid string) (crypto.PublicKey, string, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		// Token không có kid: chỉ chấp nhận khi JWKS có đúng một key
+		for id, key := range v.keys {
+			return key, v.keyAlgs[id], true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, v.keyAlgs[kid], ok
+}
+
+// refresh chạy lần tải JWKS call rồi báo cho các requests đang chờ
+func (v *jwtValidator) refresh(ctx context.Context, call *jwksFetch, now time.Time) {
+	keys, algs, err := v.fetch(ctx)
+
+	v.mu.Lock()
+	if err == nil {
+		v.keys, v.keyAlgs = keys, algs
+		v.fetchedAt = now
+	}
+	call.err = err
+	v.inflight = nil
+	v.mu.Unlock()
+	close(call.done)
+}
+
+// fetch tải và parse JWKS; keys không hỗ trợ bị bỏ qua
+func (v *jwtValidator) fetch(ctx context.Context) (map[string]crypto.PublicKey, map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.opts.JWKSURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := v.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("JWKS endpoint returned %s", resp.Status)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&set); err != nil {
+		return nil, nil, fmt.Errorf("decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	algs := make(map[string]string, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+		algs[jwk.Kid] = jwk.Alg
+	}
+	if len(keys) == 0 {
+		return nil, nil, errors.New("JWKS has no supported signing keys")
+	}
+	return keys, algs, nil
+}
+
+// jsonWebKey là một key trong JWKS (RFC 7517): RSA, EC (P-256/384/521) hoặc Ed25519
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey chuyển JWK thành public key
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return key, nil
+	case "OKP":
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported OKP key %q", k.Crv)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// verifySignature kiểm tra chữ ký của signed theo alg. Chỉ algorithms bất đối
+// xứng được chấp nhận ("none" và HS* bị từ chối).
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(pub, signed, signature) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") || rsa.VerifyPKCS1v15(pub, hash, digest, signature) != nil {
+			return errors.New("signature verification failed")
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return errors.New("signature verification failed")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("signature verification failed")
+		}
+	default:
+		return fmt.Errorf("key does not match algorithm %q", alg)
+	}
+	return nil
+}
+
+// decodeSegment decode một phần base64url JSON của token
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// numericDate đọc claim NumericDate (giây Unix, có thể có phần lẻ)
+func numericDate(v any) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
+
+// audienceMatches kiểm tra claim aud (string hoặc array) chứa một giá trị được chấp nhận
+func audienceMatches(aud any, accepted []string) bool {
+	var values []any
+	switch a := aud.(type) {
+	case string:
+		values = []any{a}
+	case []any:
+		values = a
+	}
+	for _, value := range values {
+		for _, want := range accepted {
+			if value == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimString chuyển claim thành giá trị header: string và số giữ nguyên,
+// array nối bằng ", ", object là JSON
+func claimString(v any) (string, bool) {
+	switch c := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return c, true
+	case json.Number:
+		return c.String(), true
+	case bool:
+		return strconv.FormatBool(c), true
+	case []any:
+		parts := make([]string, 0, len(c))
+		for _, item := range c {
+			if s, ok := claimString(item); ok {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, ", "), true
+	default:
+		data, err := json.Marshal(c)
+		if err != nil {
+			return "", false
+		}
+		return string(data), true
+	}
+}
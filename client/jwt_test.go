@@ -0,0 +1,268 @@
+package client
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testIssuer ký JWTs và phục vụ JWKS của mình
+type testIssuer struct {
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	server  *httptest.Server
+	fetches atomic.Int32
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "alg": "RS256", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}}
+	iss.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iss.fetches.Add(1)
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(iss.server.Close)
+	return iss
+}
+
+// sign tạo JWT với alg RS256 hoặc ES256
+func (iss *testIssuer) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	b64 := func(v any) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := b64(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + b64(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		sig, err := rsa.SignPKCS1v15(rand.Reader, iss.rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = sig
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, iss.ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTValidator_Validate(t *testing.T) {
+	iss := newTestIssuer(t)
+	v := newJWTValidator(&JWTOptions{JWKSURL: iss.server.URL, Issuer: "https://issuer", Audience: []string{"api"}})
+	now := time.Now()
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{"iss": "https://issuer", "aud": []string{"other", "api"}, "sub": "user-1", "exp": now.Add(time.Hour).Unix()}
+		for k, val := range overrides {
+			if val == nil {
+				delete(c, k)
+			} else {
+				c[k] = val
+			}
+		}
+		return c
+	}
+
+	// Payload bị thay nhưng giữ chữ ký của token gốc
+	valid := strings.Split(iss.sign(t, "RS256", "rsa-1", claims(nil)), ".")
+	forged := strings.Split(iss.sign(t, "RS256", "rsa-1", claims(map[string]any{"sub": "admin"})), ".")
+	tampered := valid[0] + "." + forged[1] + "." + valid[2]
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"RS256", iss.sign(t, "RS256", "rsa-1", claims(nil)), ""},
+		{"ES256", iss.sign(t, "ES256", "ec-1", claims(nil)), ""},
+		{"expired", iss.sign(t, "RS256", "rsa-1", claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})), "token expired"},
+		{"expired within leeway", iss.sign(t, "RS256", "rsa-1", claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()})), ""},
+		{"missing exp", iss.sign(t, "RS256", "rsa-1", claims(map[string]any{"exp": nil})), "missing exp"},
+		{"not yet valid", iss.sign(t, "RS256", "rsa-1", claims(map[string]any{"nbf": now.Add(time.Hour).Unix()})), "not valid yet"},
+		{"wrong issuer", iss.sign(t, "RS256", "rsa-1", claims(map[string]any{"iss": "https://evil"})), "unexpected issuer"},
+		{"wrong audience", iss.sign(t, "RS256", "rsa-1", claims(map[string]any{"aud": "web"})), "unexpected audience"},
+		{"unknown key", iss.sign(t, "RS256", "rsa-2", claims(nil)), "unknown key"},
+		{"alg mismatch with key", iss.sign(t, "ES256", "rsa-1", claims(nil)), "is for RS256"},
+		{"tampered", tampered, "signature verification failed"},
+		{"none", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"ec-1"}`)) + ".e30.", "unsupported algorithm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.validate(context.Background(), tt.token, now)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("validate failed: %v", err)
+			case tt.wantErr == "" && got["sub"] != "user-1":
+				t.Errorf("claims = %v, want sub user-1", got)
+			case tt.wantErr != "" && (!errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got %v, want ErrInvalidToken containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// JWKS được cache; kid lạ chỉ tải lại tối đa mỗi jwksRefreshInterval
+	if n := iss.fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+	v.validate(context.Background(), iss.sign(t, "RS256", "rsa-3", claims(nil)), now.Add(2*jwksRefreshInterval))
+	if n := iss.fetches.Load(); n != 2 {
+		t.Errorf("JWKS fetched %d times after unknown kid, want 2", n)
+	}
+}
+
+func TestJWTValidator_JWKSUnavailable(t *testing.T) {
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer jwks.Close()
+
+	v := newJWTValidator(&JWTOptions{JWKSURL: jwks.URL})
+	token := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"k"}`)) + ".e30.c2ln"
+	if _, err := v.validate(context.Background(), token, time.Now()); !errors.Is(err, ErrJWKSUnavailable) {
+		t.Errorf("got %v, want ErrJWKSUnavailable", err)
+	}
+}
+
+func TestJWTValidator_RefreshOutsideLock(t *testing.T) {
+	iss := newTestIssuer(t)
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Các lần tải sau lần đầu bị treo cho tới khi release
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		resp, err := http.Get(iss.server.URL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		io.Copy(w, resp.Body)
+	}))
+	defer jwks.Close()
+
+	v := newJWTValidator(&JWTOptions{JWKSURL: jwks.URL, CacheTTL: time.Minute})
+	now := time.Now()
+	claims := map[string]any{"sub": "user-1", "exp": now.Add(time.Hour).Unix()}
+	if _, err := v.validate(context.Background(), iss.sign(t, "RS256", "rsa-1", claims), now); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+
+	// Cache hết hạn: JWKS được tải lại ở background, request vẫn dùng key cũ
+	later := now.Add(time.Hour)
+	done := make(chan error, 1)
+	go func() {
+		_, err := v.validate(context.Background(), iss.sign(t, "RS256", "rsa-1", claims), later)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("validate with stale keys failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("validate blocked on the JWKS refresh")
+	}
+
+	// Requests với kid lạ chờ lần tải đang chạy thay vì tải lại
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, err := v.validate(context.Background(), iss.sign(t, "RS256", "rsa-9", claims), later)
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 5; i++ {
+		if err := <-errs; !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("got %v, want ErrInvalidToken", err)
+		}
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", n)
+	}
+}
+
+func TestLocalForwarder_JWT(t *testing.T) {
+	iss := newTestIssuer(t)
+	received := make(chan http.Header, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+	}))
+	defer backend.Close()
+
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		DefaultURL: backend.URL,
+		JWT: &JWTOptions{
+			JWKSURL:      iss.server.URL,
+			ClaimHeaders: map[string]string{"sub": "X-User-Id", "roles": "X-User-Roles"},
+		},
+	})
+
+	// Không có token: 401, local service không được gọi
+	stream, connector := newTestExecStream(t, nil)
+	result, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: app\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+	resp := string((<-connector.sendCh).Payload)
+	if result.Source != SourceUnauthorized || !strings.HasPrefix(resp, "HTTP/1.1 401") || !strings.Contains(resp, "Www-Authenticate: Bearer") {
+		t.Errorf("request without token: source %q, response %q", result.Source, resp)
+	}
+	select {
+	case <-received:
+		t.Error("local service received a request without token")
+	default:
+	}
+
+	// Token hợp lệ: claims thành headers, giá trị giả mạo của client bị thay
+	token := iss.sign(t, "RS256", "rsa-1", map[string]any{"sub": "user-1", "roles": []string{"admin", "ops"}, "exp": time.Now().Add(time.Hour).Unix()})
+	stream, _ = newTestExecStream(t, nil)
+	req := "GET / HTTP/1.1\r\nHost: app\r\nAuthorization: Bearer " + token + "\r\nX-User-Id: forged\r\n\r\n"
+	if _, err := lf.ForwardRequest(context.Background(), stream, []byte(req)); err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+	headers := <-received
+	if got := headers.Get("X-User-Id"); got != "user-1" {
+		t.Errorf("X-User-Id = %q, want user-1", got)
+	}
+	if got := headers.Get("X-User-Roles"); got != "admin, ops" {
+		t.Errorf("X-User-Roles = %q, want \"admin, ops\"", got)
+	}
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Latency là độ trễ giả lập agent thêm vào mỗi request của route trước khi
+// gọi local service, để rehearse app khi đi qua một tunnel chậm mà không cần
+// công cụ traffic shaping bên ngoài. Mỗi request chờ Delay ± Jitter (phân bố
+// đều, không âm).
+type Latency struct {
+	Delay  time.Duration
+	Jitter time.Duration
+}
+
+// NewLatency tạo Latency; delay và jitter đều <= 0 trả về nil (không trễ)
+func NewLatency(delay, jitter time.Duration) *Latency {
+	if delay <= 0 && jitter <= 0 {
+		return nil
+	}
+	return &Latency{Delay: max(delay, 0), Jitter: max(jitter, 0)}
+}
+
+// next trả về độ trễ cho một request
+func (l *Latency) next() time.Duration {
+	d := l.Delay
+	if l.Jitter > 0 {
+		d += time.Duration(rand.Int64N(int64(2*l.Jitter)+1)) - l.Jitter
+	}
+	return max(d, 0)
+}
+
+// wait chờ độ trễ của một request, trả về lỗi của ctx nếu request bị hủy
+// trước đó. Latency nil không chờ.
+func (l *Latency) wait(ctx context.Context) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+	d := l.next()
+	if d <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return d, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLatency_Next(t *testing.T) {
+	l := NewLatency(100*time.Millisecond, 20*time.Millisecond)
+	for i := 0; i < 1000; i++ {
+		if d := l.next(); d < 80*time.Millisecond || d > 120*time.Millisecond {
+			t.Fatalf("next() = %s, want within 100ms ± 20ms", d)
+		}
+	}
+	if NewLatency(0, 0) != nil {
+		t.Error("NewLatency(0, 0) should disable injection")
+	}
+}
+
+func TestLatency_WaitCanceled(t *testing.T) {
+	l := NewLatency(time.Hour, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestLocalForwarder_Latency(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	lf := NewLocalForwarder(LocalForwarderOptions{Backends: []Backend{
+		{Host: "slow", URL: backend.URL, Latency: NewLatency(50*time.Millisecond, 0)},
+		{Host: "fast", URL: backend.URL},
+	}})
+	forward := func(host string) time.Duration {
+		stream, _ := newTestExecStream(t, nil)
+		start := time.Now()
+		if _, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: "+host+"\r\n\r\n")); err != nil {
+			t.Fatalf("ForwardRequest failed: %v", err)
+		}
+		return time.Since(start)
+	}
+
+	if d := forward("slow"); d < 50*time.Millisecond {
+		t.Errorf("slow route answered in %s, want at least the injected 50ms", d)
+	}
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+const (
+	// qualityHeartbeats là số heartbeats gần nhất dùng tính tỉ lệ mất ACK
+	qualityHeartbeats = 20
+	// qualityReconnectWindow là cửa sổ đếm reconnects
+	qualityReconnectWindow = 10 * time.Minute
+	// rttSmoothing là trọng số của mẫu RTT mới trong EWMA
+	rttSmoothing = 0.2
+)
+
+// LinkQualitySnapshot là điểm chất lượng link tại một thời điểm
+type LinkQualitySnapshot struct {
+	// Score từ 0 (link không dùng được) tới 100
+	Score int `json:"score"`
+	// RTT là heartbeat RTT đã làm mượt (EWMA)
+	RTT time.Duration `json:"rtt"`
+	// Loss là tỉ lệ heartbeats không được ACK trong qualityHeartbeats gần nhất
+	Loss float64 `json:"loss"`
+	// Reconnects là số lần reconnect trong qualityReconnectWindow
+	Reconnects int `json:"reconnects"`
+}
+
+// LinkQuality tính điểm chất lượng link từ heartbeat RTT, heartbeats mất ACK và
+// tần suất reconnect. Điểm được cập nhật mỗi heartbeat; khi điểm xuống dưới
+// threshold, OnLow được gọi một lần cho mỗi lần xuống.
+type LinkQuality struct {
+	mu    sync.Mutex
+	clock clock.Clock
+
+	rtt        time.Duration
+	sent       []heartbeatSample // heartbeats gần nhất theo thứ tự gửi
+	reconnects []time.Time
+
+	threshold int
+	low       bool
+	onLow     func(LinkQualitySnapshot)
+}
+
+// heartbeatSample là một heartbeat đã gửi và ACK của nó
+type heartbeatSample struct {
+	at    time.Time
+	acked bool
+}
+
+// NewLinkQuality tạo LinkQuality; threshold <= 0 tắt OnLow
+func NewLinkQuality(threshold int, onLow func(LinkQualitySnapshot)) *LinkQuality {
+	return &LinkQuality{clock: clock.Real, threshold: threshold, onLow: onLow}
+}
+
+// SetClock set clock dùng cho timestamps (tests dùng clock.Mock)
+func (q *LinkQuality) SetClock(c clock.Clock) {
+	q.clock = clock.Or(c)
+}
+
+// heartbeatSent ghi nhận một heartbeat vừa gửi
+func (q *LinkQuality) heartbeatSent() {
+	q.mu.Lock()
+	q.sent = append(q.sent, heartbeatSample{at: q.clock.Now()})
+	if len(q.sent) > qualityHeartbeats {
+		q.sent = q.sent[len(q.sent)-qualityHeartbeats:]
+	}
+	q.mu.Unlock()
+}
+
+// heartbeatAcked ghi nhận ACK cho heartbeat cũ nhất chưa được ACK và cập nhật RTT
+func (q *LinkQuality) heartbeatAcked() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.sent {
+		if q.sent[i].acked {
+			continue
+		}
+		q.sent[i].acked = true
+		sample := q.clock.Now().Sub(q.sent[i].at)
+		if q.rtt == 0 {
+			q.rtt = sample
+		} else {
+			q.rtt = time.Duration(rttSmoothing*float64(sample) + (1-rttSmoothing)*float64(q.rtt))
+		}
+		return
+	}
+}
+
+// RecordReconnect ghi nhận một lần reconnect tới Core
+func (q *LinkQuality) RecordReconnect() {
+	q.mu.Lock()
+	q.reconnects = append(q.reconnects, q.clock.Now())
+	q.mu.Unlock()
+}
+
+// Snapshot trả về điểm chất lượng hiện tại
+func (q *LinkQuality) Snapshot() LinkQualitySnapshot {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.snapshot()
+}
+
+func (q *LinkQuality) snapshot() LinkQualitySnapshot {
+	now := q.clock.Now()
+	s := LinkQualitySnapshot{RTT: q.rtt}
+
+	// Heartbeat mới nhất có thể vẫn đang chờ ACK nên không tính là mất
+	if n := len(q.sent) - 1; n > 0 {
+		lost := 0
+		for _, hb := range q.sent[:n] {
+			if !hb.acked {
+				lost++
+			}
+		}
+		s.Loss = float64(lost) / float64(n)
+	}
+
+	recent := q.reconnects[:0]
+	for _, t := range q.reconnects {
+		if now.Sub(t) < qualityReconnectWindow {
+			recent = append(recent, t)
+		}
+	}
+	q.reconnects = recent
+	s.Reconnects = len(recent)
+
+	// RTT tối đa trừ 40 điểm (1s), mất ACK tối đa 40, reconnects tối đa 20
+	rttPenalty := math.Min(40, float64(s.RTT)/float64(25*time.Millisecond))
+	lossPenalty := 40 * s.Loss
+	reconnectPenalty := math.Min(20, 5*float64(s.Reconnects))
+	s.Score = int(math.Round(math.Max(0, 100-rttPenalty-lossPenalty-reconnectPenalty)))
+	return s
+}
+
+// evaluate cập nhật metrics và gọi OnLow khi điểm vừa xuống dưới threshold
+func (q *LinkQuality) evaluate() {
+	q.mu.Lock()
+	s := q.snapshot()
+	wasLow := q.low
+	q.low = q.threshold > 0 && s.Score < q.threshold
+	becameLow := q.low && !wasLow
+	q.mu.Unlock()
+
+	metrics.GetMetrics().SetLinkQuality(s.Score, s.RTT, s.Loss)
+	switch {
+	case becameLow:
+		logger.Warn("Link quality below threshold",
+			"score", s.Score, "threshold", q.threshold, "rtt", s.RTT, "loss", s.Loss, "reconnects", s.Reconnects)
+		if q.onLow != nil {
+			q.onLow(s)
+		}
+	case wasLow && !q.low:
+		logger.Info("Link quality recovered", "score", s.Score, "threshold", q.threshold)
+	}
+}
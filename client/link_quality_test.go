@@ -0,0 +1,50 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+func TestLinkQuality_Score(t *testing.T) {
+	mock := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var low []LinkQualitySnapshot
+	q := NewLinkQuality(70, func(s LinkQualitySnapshot) { low = append(low, s) })
+	q.SetClock(mock)
+
+	// Link tốt: RTT 50ms, không mất ACK
+	for i := 0; i < 5; i++ {
+		q.heartbeatSent()
+		mock.Advance(50 * time.Millisecond)
+		q.heartbeatAcked()
+		mock.Advance(10 * time.Second)
+	}
+	q.evaluate()
+	if s := q.Snapshot(); s.Score != 98 || s.Loss != 0 || s.RTT != 50*time.Millisecond {
+		t.Fatalf("healthy link: got %+v, want score 98", s)
+	}
+
+	// Mất 5 ACKs và 3 reconnects: dưới threshold, OnLow được gọi một lần
+	for i := 0; i < 5; i++ {
+		q.heartbeatSent()
+		mock.Advance(10 * time.Second)
+	}
+	q.RecordReconnect()
+	q.RecordReconnect()
+	q.RecordReconnect()
+	q.evaluate()
+	q.evaluate()
+	if len(low) != 1 {
+		t.Fatalf("OnLow should fire once per drop, fired %d times", len(low))
+	}
+	if s := low[0]; s.Score >= 70 || s.Reconnects != 3 {
+		t.Errorf("degraded link: got %+v", s)
+	}
+
+	// Reconnects ngoài cửa sổ không còn bị tính
+	mock.Advance(qualityReconnectWindow)
+	if s := q.Snapshot(); s.Reconnects != 0 {
+		t.Errorf("reconnects outside the window should be dropped, got %d", s.Reconnects)
+	}
+}
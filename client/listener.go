@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// LocalListener là chiều ngược của LocalForwarder: nhận TCP connections ở
+// local và forward mỗi connection thành một agent-initiated stream tới
+// Target phía Core (xem Pipe), để cùng binary vừa expose vừa dùng services
+type LocalListener struct {
+	// Address là địa chỉ listen local (ví dụ 127.0.0.1:5432)
+	Address string
+
+	// Target là service phía Core (host:port) mà connections được nối tới
+	Target string
+
+	streamManager *StreamManager
+	ln            net.Listener
+}
+
+// NewLocalListener tạo LocalListener, gọi Start để bắt đầu listen
+func NewLocalListener(address, target string, streamManager *StreamManager) *LocalListener {
+	return &LocalListener{
+		Address:       address,
+		Target:        target,
+		streamManager: streamManager,
+	}
+}
+
+// Start listen trên Address và accept connections cho tới khi Close hoặc ctx bị huỷ
+func (l *LocalListener) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", l.Address)
+	if err != nil {
+		return err
+	}
+	l.ln = ln
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logger.Warn("Local listener accept failed", "address", l.Address, "error", err)
+				}
+				return
+			}
+			go l.handle(ctx, conn)
+		}
+	}()
+	return nil
+}
+
+// handle nối một local connection với stream tới Target
+func (l *LocalListener) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	if !l.streamManager.connector.IsConnected() {
+		logger.Warn("Not connected to Core, refusing local connection", "address", l.Address, "target", l.Target)
+		return
+	}
+	logger.Debug("Local connection accepted", "address", l.Address, "target", l.Target, "remote", conn.RemoteAddr().String())
+	if err := Pipe(ctx, l.streamManager, l.Target, conn, conn); err != nil && ctx.Err() == nil {
+		logger.Warn("Local connection to Core service failed", "target", l.Target, "error", err)
+	}
+}
+
+// Addr trả về địa chỉ thực tế đang listen (hữu ích khi Address dùng port 0)
+func (l *LocalListener) Addr() net.Addr {
+	if l.ln == nil {
+		return nil
+	}
+	return l.ln.Addr()
+}
+
+// Close dừng listen; connections đang mở kết thúc khi stream của chúng đóng
+func (l *LocalListener) Close() error {
+	if l.ln == nil {
+		return nil
+	}
+	return l.ln.Close()
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+func TestLocalListener_ForwardsConnection(t *testing.T) {
+	connector := NewConnector("test", ConnectorOptions{})
+	connector.connected = true
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := NewLocalListener("127.0.0.1:0", "db.internal:5432", sm)
+	if err := l.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("query"))
+
+	next := func() *v1.Frame {
+		t.Helper()
+		select {
+		case frame := <-connector.sendCh:
+			return frame
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for frame")
+			return nil
+		}
+	}
+
+	open := next()
+	_, metadata, _, _ := ParseOpenPayload(open.Payload)
+	if open.Type != v1.FrameOpenStream || metadata[PipeTargetKey] != "db.internal:5432" {
+		t.Fatalf("Unexpected open frame: type %v metadata %v", open.Type, metadata)
+	}
+	if data := next(); string(data.Payload) != "query" {
+		t.Errorf("Expected connection data, got %q", data.Payload)
+	}
+
+	stream, ok := sm.GetStream(open.StreamID)
+	if !ok {
+		t.Fatal("Listener stream not found")
+	}
+	stream.Deliver([]byte("result"))
+	sm.CloseStream(open.StreamID)
+
+	// Core đóng stream: connection nhận data rồi EOF
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	got, err := io.ReadAll(conn)
+	if err != nil || string(got) != "result" {
+		t.Errorf("Expected %q then EOF, got %q, %v", "result", got, err)
+	}
+}
@@ -3,70 +3,395 @@ package client
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hydragon2m/tunnel-agent/internal/logger"
 	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+	"github.com/hydragon2m/tunnel-agent/internal/quota"
+	"github.com/hydragon2m/tunnel-agent/internal/schedule"
 )
 
+// Host header modes của Backend
+const (
+	// HostHeaderPreserve gửi Host gốc của request public tới local service (default)
+	HostHeaderPreserve = ""
+	// HostHeaderRewrite gửi host của backend URL (ví dụ localhost:8080)
+	HostHeaderRewrite = "rewrite"
+)
+
+// Connection modes của Backend: cách dùng lại connection tới local service
+const (
+	// ConnectionReuse dùng keep-alive pool chung của forwarder (default)
+	ConnectionReuse = ""
+	// ConnectionClose gửi Connection: close, connection không được dùng lại
+	ConnectionClose = "close"
+	// ConnectionFresh mở connection mới qua transport riêng cho mỗi stream, cho
+	// local services xử lý sai keep-alive (kể cả khi bỏ qua Connection: close)
+	ConnectionFresh = "fresh"
+)
+
+// Backend là một local service được route tới theo host gốc và path của request
+type Backend struct {
+	// Host là pattern khớp với host gốc: subdomain label ("api"), hostname đầy đủ
+	// ("api.example.com"), wildcard ("*.example.com") hoặc "" cho default backend
+	Host string
+
+	// Path là path prefix mà backend phục vụ (ví dụ "/service-a"), "" là mọi path.
+	// Với cùng host, prefix dài nhất được chọn.
+	Path string
+
+	// URL của local service
+	URL string
+
+	// HostHeader là Host header gửi tới local service: HostHeaderPreserve,
+	// HostHeaderRewrite hoặc một giá trị cố định (ví dụ "app.internal")
+	HostHeader string
+
+	// Connection là ConnectionReuse, ConnectionClose hoặc ConnectionFresh
+	Connection string
+
+	// Rewrite viết lại path trước khi build local URL
+	Rewrite Rewrite
+
+	// Transform sửa headers và JSON body của request/response (nil = không sửa)
+	Transform *Transform
+
+	// Schedule là khung giờ backend hoạt động; ngoài khung giờ agent trả 503
+	// maintenance thay vì gọi local service (nil = luôn hoạt động)
+	Schedule *schedule.Schedule
+
+	// MQTT chuyển requests thành messages trên MQTT broker thay vì gọi URL
+	// qua HTTP (nil = HTTP backend)
+	MQTT *MQTTBridge
+
+	// Auth là credentials gửi tới local service (nil = không gửi)
+	Auth *BackendAuth
+
+	// RateLimit giới hạn requests/giây của route; vượt limit agent trả 429
+	// (nil = không giới hạn)
+	RateLimit *RateLimit
+
+	// Access giới hạn quốc gia và khung giờ được gọi route; bị từ chối agent
+	// trả 403 (nil = không giới hạn)
+	Access *AccessPolicy
+
+	// Webhook kiểm tra chữ ký HMAC của body; chữ ký không hợp lệ agent trả
+	// 401 (nil = không kiểm tra)
+	Webhook *WebhookVerifier
+
+	// Scan gửi request/response body tới scanner ngoài (DLP, malware); body
+	// bị chặn agent trả 403 (nil = không scan)
+	Scan *BodyScanner
+
+	// Latency thêm độ trễ giả lập trước khi gọi local service (nil = không trễ)
+	Latency *Latency
+}
+
+// RouteName là tên của backend trong thống kê theo route: host pattern ("*"
+// cho default backend) nối với path prefix, ví dụ "api/v1"
+func (b Backend) RouteName() string {
+	host := b.Host
+	if host == "" {
+		host = "*"
+	}
+	return host + b.Path
+}
+
 // LocalForwarder forward requests đến local services
 type LocalForwarder struct {
-	localServices map[string]string // subdomain -> localURL
-	defaultURL    string
-	httpClient    *http.Client
-	timeout       time.Duration
+	mu             sync.RWMutex         // bảo vệ backends và defaultURL
+	backends       map[string][]Backend // host pattern (lowercase) -> backends, Path dài nhất trước
+	defaultURL     string
+	httpClient     *http.Client
+	timeout        time.Duration
+	trustForwarded bool
+	respHeaders    HeaderRules
+	cors           *cors
+	limits         ResponseLimits
+	schedule       *schedule.Schedule
+	unmatched      *Unmatched
+	agentHeaders   *agentHeaders
+	jwt            *jwtValidator
+	geoTable       *GeoTable
+	quota          *quota.Quota
+	recorder       *Recorder
+	warmConns      int
+
+	authMu      sync.Mutex
+	authClients map[*BackendAuth]*http.Client // client riêng cho backends có TLS credentials
+}
+
+// LocalForwarderOptions cấu hình LocalForwarder. Zero value của mỗi field dùng default.
+type LocalForwarderOptions struct {
+	// DefaultURL là local service cho requests không khớp subdomain nào
+	DefaultURL string
+
+	// Services là mapping host pattern -> local URL ban đầu
+	Services map[string]string
+
+	// Backends là các backends ban đầu, dùng khi cần HostHeader riêng
+	Backends []Backend
+
+	// Timeout cho mỗi request tới local service (default 30s)
+	Timeout time.Duration
+
+	// TrustForwardedHeaders giữ X-Forwarded-*, X-Real-IP và Forwarded client gửi lên và
+	// nối thêm client IP; mặc định chúng bị thay bằng thông tin Core gửi trong metadata
+	TrustForwardedHeaders bool
+
+	// ResponseHeaders sửa headers của mọi response trước khi gửi về Core
+	ResponseHeaders HeaderRules
+
+	// CORS bật xử lý CORS ở agent (nil = tắt, headers của local service giữ nguyên)
+	CORS *CORSOptions
+
+	// Limits giới hạn response của local service
+	Limits ResponseLimits
+
+	// Schedule là khung giờ hoạt động chung cho mọi backend (nil = luôn hoạt động)
+	Schedule *schedule.Schedule
+
+	// Unmatched trả response từ template cho requests không khớp backend nào,
+	// thay cho default backend (nil = forward tới default URL)
+	Unmatched *Unmatched
+
+	// AgentHeaders thêm Via và User-Agent suffix nhận diện agent vào requests
+	// tới local service (nil = không thêm)
+	AgentHeaders *AgentHeaders
+
+	// JWT bật xác thực JWT: requests không có token hợp lệ nhận 401 thay vì tới
+	// local service (nil = tắt)
+	JWT *JWTOptions
+
+	// Quota giới hạn requests và bytes mỗi tháng của tunnel; hết quota agent
+	// trả 429 tới đầu tháng sau (nil = không giới hạn)
+	Quota *quota.Quota
+
+	// GeoTable tra quốc gia theo client IP cho Backend.Access khi Core không
+	// gửi geo_country (nil = chỉ dùng metadata của Core)
+	GeoTable *GeoTable
+
+	// Recorder ghi requests/responses vào file (nil = tắt); với
+	// RecorderOptions.DryRun requests không tới local service
+	Recorder *Recorder
+
+	// HostOverrides resolve hostnames của backends sang IP cố định thay vì DNS
+	// (chỉ áp dụng cho default transport)
+	HostOverrides HostOverrides
+
+	// WarmConns là số keep-alive connections WarmUp mở sẵn tới mỗi local
+	// service (0 = tắt)
+	WarmConns int
+
+	// RestartGrace là thời gian chờ local service đang refuse connections (đang
+	// restart) trước khi request thất bại: dial được thử lại với khoảng chờ tăng
+	// dần. Quá grace period address bị coi là down (0 = tắt, chỉ áp dụng cho
+	// default transport)
+	RestartGrace time.Duration
+
+	// OnLocalState được gọi khi một local service address bắt đầu refuse
+	// connections, vẫn refuse sau RestartGrace, hoặc nhận connections trở lại
+	OnLocalState func(addr string, state LocalState)
+
+	// Transport cho HTTP client (default: pooled http.Transport)
+	Transport http.RoundTripper
 }
 
 // NewLocalForwarder tạo LocalForwarder mới
-func NewLocalForwarder(defaultURL string, timeout time.Duration) *LocalForwarder {
-	return &LocalForwarder{
-		localServices: make(map[string]string),
-		defaultURL:    defaultURL,
+func NewLocalForwarder(opts LocalForwarderOptions) *LocalForwarder {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	opts.Limits = opts.Limits.withDefaults()
+	if opts.Transport == nil {
+		transport := &http.Transport{
+			MaxIdleConns:       100,
+			IdleConnTimeout:    90 * time.Second,
+			DisableCompression: false,
+		}
+		if opts.Limits.MaxHeaderBytes > 0 {
+			transport.MaxResponseHeaderBytes = opts.Limits.MaxHeaderBytes
+		}
+		if len(opts.HostOverrides) > 0 || opts.RestartGrace > 0 {
+			dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+			dial := dialer.DialContext
+			if opts.RestartGrace > 0 {
+				dial = newRestartDialer(dial, opts.RestartGrace, opts.OnLocalState).DialContext
+			}
+			transport.DialContext = opts.HostOverrides.DialContext(dial)
+		}
+		if opts.WarmConns > http.DefaultMaxIdleConnsPerHost {
+			// Pool phải giữ được mọi connections đã warm-up
+			transport.MaxIdleConnsPerHost = opts.WarmConns
+		}
+		opts.Transport = transport
+	}
+
+	lf := &LocalForwarder{
+		backends:   make(map[string][]Backend, len(opts.Services)+len(opts.Backends)),
+		defaultURL: opts.DefaultURL,
 		httpClient: &http.Client{
-			Timeout: timeout,
-			Transport: &http.Transport{
-				MaxIdleConns:       100,
-				IdleConnTimeout:    90 * time.Second,
-				DisableCompression: false,
-			},
+			Timeout:   opts.Timeout,
+			Transport: opts.Transport,
 		},
-		timeout: timeout,
+		timeout:        opts.Timeout,
+		trustForwarded: opts.TrustForwardedHeaders,
+		respHeaders:    opts.ResponseHeaders,
+		cors:           newCORS(opts.CORS),
+		limits:         opts.Limits,
+		schedule:       opts.Schedule,
+		unmatched:      opts.Unmatched,
+		agentHeaders:   newAgentHeaders(opts.AgentHeaders),
+		jwt:            newJWTValidator(opts.JWT),
+		geoTable:       opts.GeoTable,
+		quota:          opts.Quota,
+		recorder:       opts.Recorder,
+		warmConns:      opts.WarmConns,
+	}
+	for host, url := range opts.Services {
+		lf.AddService(host, url)
+	}
+	for _, backend := range opts.Backends {
+		lf.AddBackend(backend)
+	}
+	return lf
+}
+
+// AddService thêm mapping service mới với Host header mặc định
+func (lf *LocalForwarder) AddService(host, localURL string) {
+	lf.AddBackend(Backend{Host: host, URL: localURL})
+}
+
+// AddBackend thêm hoặc thay thế backend cho host pattern và path của nó
+func (lf *LocalForwarder) AddBackend(backend Backend) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	addBackend(lf.backends, backend)
+}
+
+// ReplaceBackends thay toàn bộ bảng routing và default URL trong một bước:
+// mỗi request dùng hoặc bảng cũ hoặc bảng mới, không bao giờ bảng dở dang
+func (lf *LocalForwarder) ReplaceBackends(backends []Backend, defaultURL string) {
+	table := make(map[string][]Backend, len(backends))
+	for _, backend := range backends {
+		addBackend(table, backend)
 	}
+
+	lf.mu.Lock()
+	lf.backends = table
+	lf.defaultURL = defaultURL
+	lf.mu.Unlock()
+	lf.dropAuthClients()
 }
 
-// AddService thêm mapping service mới
-func (lf *LocalForwarder) AddService(subdomain, localURL string) {
-	lf.localServices[subdomain] = localURL
+// Backends trả về snapshot các backends hiện tại, sorted theo host rồi path
+func (lf *LocalForwarder) Backends() []Backend {
+	lf.mu.RLock()
+	defer lf.mu.RUnlock()
+
+	var backends []Backend
+	for _, routes := range lf.backends {
+		backends = append(backends, routes...)
+	}
+	sort.Slice(backends, func(i, j int) bool {
+		if backends[i].Host != backends[j].Host {
+			return backends[i].Host < backends[j].Host
+		}
+		return backends[i].Path < backends[j].Path
+	})
+	return backends
+}
+
+// addBackend thêm hoặc thay thế backend trong table
+func addBackend(table map[string][]Backend, backend Backend) {
+	backend.Host = strings.ToLower(strings.TrimSpace(backend.Host))
+	backend.Path = strings.TrimRight(backend.Path, "/")
+
+	routes := table[backend.Host]
+	for i, existing := range routes {
+		if existing.Path == backend.Path {
+			routes[i] = backend
+			return
+		}
+	}
+	routes = append(routes, backend)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].Path) > len(routes[j].Path)
+	})
+	table[backend.Host] = routes
 }
 
 // SetDefaultURL đặt default local URL
 func (lf *LocalForwarder) SetDefaultURL(url string) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
 	lf.defaultURL = url
 }
 
 // GetDefaultURL lấy default local URL
 func (lf *LocalForwarder) GetDefaultURL() string {
+	lf.mu.RLock()
+	defer lf.mu.RUnlock()
 	return lf.defaultURL
 }
 
-// GetSubdomains trả về danh sách các subdomain đã đăng ký
+// GetSubdomains trả về danh sách các subdomain label đã đăng ký.
+// Hostnames đầy đủ và wildcards không phải subdomain của Core nên bị bỏ qua.
 func (lf *LocalForwarder) GetSubdomains() []string {
-	subs := make([]string, 0, len(lf.localServices))
-	for sub := range lf.localServices {
-		if sub != "" {
-			subs = append(subs, sub)
+	lf.mu.RLock()
+	defer lf.mu.RUnlock()
+	subs := make([]string, 0, len(lf.backends))
+	for host := range lf.backends {
+		if host != "" && !strings.ContainsAny(host, ".*") {
+			subs = append(subs, host)
 		}
 	}
 	return subs
 }
 
-// ForwardRequest forward request từ Core đến local service
-func (lf *LocalForwarder) ForwardRequest(ctx context.Context, stream *Stream, initialPayload []byte) error {
+// ForwardRequest forward request từ Core đến local service và ghi response vào
+// stream. Result luôn khác nil, kể cả khi có lỗi: nó mô tả phần response đã
+// được ghi (ví dụ headers đã gửi trước khi body bị lỗi).
+func (lf *LocalForwarder) ForwardRequest(ctx context.Context, stream *Stream, initialPayload []byte) (*ForwardResult, error) {
 	startTime := time.Now()
+	result := &ForwardResult{Started: startTime, TraceID: stream.EnsureTraceID()}
+	err := lf.forward(ctx, stream, initialPayload, result)
+	result.Duration = time.Since(startTime)
+	if result.Source != SourceQuotaExceeded {
+		// Bandwidth gồm request (headers và body) và response đã ghi vào stream
+		requestBytes := int64(len(initialPayload)) + stream.bytesRead.Load()
+		lf.quota.Record(1, requestBytes+int64(result.HeaderBytes)+result.BodyBytes)
+	}
+	if result.capture != nil {
+		lf.recorder.record(result.capture, result, err)
+	}
+	if result.Route != "" {
+		metrics.GetMetrics().Routes.Record(metrics.RouteRequest{
+			Route:    result.Route,
+			Status:   result.StatusCode,
+			Failed:   err != nil || result.StatusCode >= http.StatusInternalServerError,
+			BytesIn:  int64(len(initialPayload)) + stream.bytesRead.Load(),
+			BytesOut: int64(result.HeaderBytes) + result.BodyBytes,
+			Duration: result.Duration,
+		})
+	}
+	return result, err
+}
+
+// forward thực hiện ForwardRequest, điền result trong lúc ghi response
+func (lf *LocalForwarder) forward(ctx context.Context, stream *Stream, initialPayload []byte, result *ForwardResult) error {
+	startTime := result.Started
+	out := &resultWriter{w: stream, result: result}
 	metrics.GetMetrics().IncrementLocalRequestsTotal()
 	metrics.GetMetrics().IncrementRequestsTotal()
 
@@ -77,27 +402,247 @@ func (lf *LocalForwarder) ForwardRequest(ctx context.Context, stream *Stream, in
 		metrics.GetMetrics().IncrementRequestsFailed()
 		return fmt.Errorf("failed to parse request: %w", err)
 	}
+	// Recorder giữ request như client gửi, trước khi JWT claims hoặc rewrite sửa nó
+	result.capture = lf.recorder.capture(method, originalHost(stream, headers), path, query, headers)
+	out.capture = result.capture
+
+	// CORS preflight được trả lời ở agent, không tới local service
+	if lf.cors != nil && isPreflight(method, headers) {
+		result.Source = SourcePreflight
+		if err := lf.writeResponseHeader(out, lf.cors.preflight(headers)); err != nil {
+			return fmt.Errorf("failed to write preflight response: %w", err)
+		}
+		metrics.GetMetrics().IncrementRequestsSuccess()
+		return nil
+	}
+
+	// Hết quota của tunnel: 429 tới khi sang tháng mới
+	if reason, resetAt := lf.quota.Exceeded(); reason != "" {
+		logger.Debug("Request rejected, quota exceeded", "path", path, "reason", reason, "resets_at", resetAt)
+		result.Source = SourceQuotaExceeded
+		if err := lf.writeTooManyRequests(out, resetAt.Sub(startTime), "quota exceeded\n"); err != nil {
+			return fmt.Errorf("failed to write quota exceeded response: %w", err)
+		}
+		return nil
+	}
 
-	// 2. Determine local URL based on Host header
-	localBaseURL := lf.determineLocalURL(headers.Get("Host"))
-	localURL := lf.buildLocalURL(localBaseURL, path, query)
+	// JWT được kiểm tra trước mọi response khác; claims thành headers tới local service
+	if lf.jwt != nil {
+		claims, err := lf.jwt.authenticate(ctx, headers)
+		if err != nil {
+			logger.Debug("Rejected request without valid JWT", "path", path, "error", err)
+			metrics.GetMetrics().IncrementRequestsFailed()
+			result.Source = SourceUnauthorized
+			if err := lf.writeUnauthorized(out, err); err != nil {
+				return fmt.Errorf("failed to write unauthorized response: %w", err)
+			}
+			return nil
+		}
+		lf.jwt.applyClaims(headers, claims)
+	}
+
+	// 2. Determine backend based on the original host and path, then rewrite the path
+	host := originalHost(stream, headers)
+	backend, matched := lf.match(host, path)
+	if !matched {
+		// Unmatched response thay thế default backend khi được cấu hình
+		if lf.unmatched != nil {
+			result.Source = SourceUnmatched
+			if err := lf.writeUnmatched(out, host, path); err != nil {
+				return fmt.Errorf("failed to write unmatched response: %w", err)
+			}
+			metrics.GetMetrics().IncrementRequestsSuccess()
+			return nil
+		}
+		backend = lf.defaultBackend(host)
+	}
+	result.Backend = backend.URL
+	result.Route = backend.RouteName()
+
+	// Ngoài khung giờ hoạt động agent trả 503 maintenance, không tới local service
+	if active, next := lf.scheduleActive(backend, startTime); !active {
+		logger.Debug("Request outside scheduled hours", "host", host, "path", path, "url", backend.URL)
+		result.Source = SourceMaintenance
+		if err := lf.writeMaintenance(out, startTime, next); err != nil {
+			return fmt.Errorf("failed to write maintenance response: %w", err)
+		}
+		metrics.GetMetrics().IncrementRequestsSuccess()
+		return nil
+	}
+
+	// Access policy của route (quốc gia, khung giờ): 403 thay vì gọi local service
+	if backend.Access != nil {
+		var country string
+		if backend.Access.needsCountry() {
+			country = lf.clientCountry(clientInfoFromStream(stream), headers)
+		}
+		if reason := backend.Access.check(country, startTime); reason != "" {
+			logger.Debug("Request denied by access policy", "host", host, "path", path, "url", backend.URL, "country", country, "reason", reason)
+			result.Source = SourceForbidden
+			if err := lf.writeForbidden(out); err != nil {
+				return fmt.Errorf("failed to write forbidden response: %w", err)
+			}
+			return nil
+		}
+	}
+
+	// Rate limit của route: 429 thay vì gọi local service
+	if allowed, retryAfter := backend.RateLimit.allow(); !allowed {
+		logger.Debug("Request throttled by route rate limit", "host", host, "path", path, "url", backend.URL, "retryAfter", retryAfter)
+		metrics.GetMetrics().IncrementRequestsThrottled()
+		result.Source = SourceThrottled
+		if err := lf.writeTooManyRequests(out, retryAfter, "too many requests\n"); err != nil {
+			return fmt.Errorf("failed to write throttled response: %w", err)
+		}
+		return nil
+	}
+
+	// Độ trễ giả lập của route, tính cả cho dry-run và MQTT
+	if delay, err := backend.Latency.wait(ctx); err != nil {
+		return fmt.Errorf("request canceled during injected latency: %w", err)
+	} else if delay > 0 {
+		logger.Debug("Injected route latency", "host", host, "path", path, "url", backend.URL, "delay", delay)
+	}
+
+	publicPath := path
+	if rewritten := backend.Rewrite.Apply(path); rewritten != path {
+		logger.Debug("Rewrote request path", "path", path, "rewritten", rewritten, "url", backend.URL)
+		path = rewritten
+	}
+	// Dry-run: request được ghi lại và trả 202, không tới local service hay MQTT broker
+	if lf.recorder != nil && lf.recorder.dryRun {
+		result.Source = SourceDryRun
+		if _, err := io.Copy(&result.capture.reqBody, dryRunBody(stream, headers, initialBody)); err != nil {
+			return fmt.Errorf("failed to read dry-run request body: %w", err)
+		}
+		if err := lf.writeDryRun(out); err != nil {
+			return fmt.Errorf("failed to write dry-run response: %w", err)
+		}
+		metrics.GetMetrics().IncrementRequestsSuccess()
+		return nil
+	}
+	if backend.MQTT != nil {
+		result.Source = SourceMQTT
+		return lf.forwardMQTT(ctx, stream, out, backend.MQTT, method, path, query, headers, initialBody, startTime)
+	}
+	result.Source = SourceLocal
+	localURL := lf.buildLocalURL(backend.URL, path, query)
 
 	// 3. Create local HTTP request
+	reqLength, err := requestLength(headers)
+	if err == nil && reqLength >= 0 && int64(len(initialBody)) > reqLength {
+		err = fmt.Errorf("%w: request body is longer than Content-Length %d", ErrContentLengthMismatch, reqLength)
+	}
+	if err != nil {
+		logger.Warn("Rejected request with invalid framing", "host", host, "path", publicPath, "error", err)
+		metrics.GetMetrics().IncrementRequestsFailed()
+		result.Source = SourceBadRequest
+		if err := lf.writeBadRequest(out, err); err != nil {
+			return fmt.Errorf("failed to write bad request response: %w", err)
+		}
+		return nil
+	}
 	var bodyReader io.Reader
-	contentLength := headers.Get("Content-Length")
-	transferEncoding := headers.Get("Transfer-Encoding")
-
-	if (contentLength != "" && contentLength != "0") || transferEncoding != "" {
+	switch {
+	case reqLength == 0:
+		bodyReader = http.NoBody
+	case reqLength > 0:
+		// Body phải dài đúng Content-Length, kể cả phần đã nằm trong initial payload
+		bodyReader = &lengthReader{r: io.MultiReader(bytes.NewReader(initialBody), stream), n: reqLength}
+	case headers.Get("Transfer-Encoding") != "":
 		bodyReader = io.MultiReader(bytes.NewReader(initialBody), stream)
-	} else if len(initialBody) > 0 {
+	case len(initialBody) > 0:
 		bodyReader = bytes.NewReader(initialBody)
 	}
 
-	// 4. Create local HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, method, localURL, bodyReader)
+	// Upgrade request (WebSocket): bytes sau headers là data của connection sau
+	// upgrade, không phải body
+	upgrade := isUpgradeRequest(headers)
+	var earlyData []byte
+	if upgrade && reqLength < 0 && headers.Get("Transfer-Encoding") == "" {
+		earlyData, bodyReader = initialBody, http.NoBody
+	}
+
+	info := clientInfoFromStream(stream)
+
+	// Webhook route: chữ ký được kiểm tra trên toàn bộ body trước khi tới local service
+	if backend.Webhook != nil {
+		body, err := backend.Webhook.readBody(bodyReader)
+		if err == nil {
+			err = backend.Webhook.verify(headers, body, startTime)
+		}
+		if errors.Is(err, ErrInvalidSignature) || errors.Is(err, ErrWebhookBodyTooLarge) {
+			logger.Warn("Rejected webhook", "host", host, "path", publicPath, "url", backend.URL, "error", err)
+			metrics.GetMetrics().IncrementRequestsFailed()
+			result.Source = SourceInvalidSignature
+			if err := lf.writeWebhookRejected(out, err); err != nil {
+				return fmt.Errorf("failed to write webhook rejected response: %w", err)
+			}
+			return nil
+		}
+		if err != nil {
+			metrics.GetMetrics().IncrementRequestsFailed()
+			return fmt.Errorf("failed to read webhook body: %w", err)
+		}
+		bodyReader, reqLength = http.NoBody, 0
+		if len(body) > 0 {
+			bodyReader, reqLength = bytes.NewReader(body), int64(len(body))
+			setContentLength(headers, reqLength)
+		}
+	}
+
+	// Content scan của route: scanner quyết định trước khi body tới local service
+	if backend.Scan != nil && backend.Scan.requests && bodyReader != nil && bodyReader != http.NoBody {
+		body, length, err := backend.Scan.scan(ctx, bodyReader, scanInfo{
+			Direction:   "request",
+			Method:      method,
+			Host:        host,
+			Path:        publicPath,
+			ClientIP:    info.IP,
+			ContentType: headers.Get("Content-Type"),
+		})
+		if errors.Is(err, ErrScanBlocked) || errors.Is(err, ErrScanUnavailable) {
+			logger.Warn("Rejected request body by content scan", "host", host, "path", publicPath, "url", backend.URL, "error", err)
+			metrics.GetMetrics().IncrementRequestsFailed()
+			result.Source = SourceScanBlocked
+			if err := lf.writeScanRejected(out, err); err != nil {
+				return fmt.Errorf("failed to write scan rejected response: %w", err)
+			}
+			return nil
+		}
+		if err != nil {
+			metrics.GetMetrics().IncrementRequestsFailed()
+			return fmt.Errorf("failed to read request body for content scan: %w", err)
+		}
+		bodyReader = body
+		if length > 0 {
+			reqLength = length
+			setContentLength(headers, length)
+		}
+	}
+
+	// 4. Create local HTTP request; response limits huỷ reqCtx với cause là lỗi limit
+	reqCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	// 1xx responses (103 Early Hints) được ghi vào stream ngay khi nhận;
+	// latencyTrace đo thời gian tới local service của stream
+	timings := &traceTimings{}
+	defer timings.apply(result)
+	traceCtx := httptrace.WithClientTrace(reqCtx, latencyTrace(informationalTrace(stream), stream.CreatedAt, timings))
+	httpReq, err := http.NewRequestWithContext(traceCtx, method, localURL, bodyReader)
 	if err != nil {
 		return fmt.Errorf("failed to create local request: %w", err)
 	}
+	if reqLength > 0 {
+		httpReq.ContentLength = reqLength
+	}
+	if c := result.capture; c != nil && httpReq.Body != nil && httpReq.Body != http.NoBody {
+		// Tee sau NewRequest để ContentLength suy ra từ bodyReader giữ nguyên
+		httpReq.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(httpReq.Body, &c.reqBody), httpReq.Body}
+	}
 
 	// Copy headers
 	for key, values := range headers {
@@ -107,24 +652,144 @@ func (lf *LocalForwarder) ForwardRequest(ctx context.Context, stream *Stream, in
 			}
 		}
 	}
+	applyHostHeader(httpReq, backend, host)
+	applyForwardedHeaders(httpReq, info, host, lf.trustForwarded)
+	httpReq.Header.Set(TraceHeader, result.TraceID)
+	lf.agentHeaders.apply(httpReq.Header)
+
+	// Route transform: request headers và JSON body
+	var data *TransformData
+	if backend.Transform != nil {
+		data = &TransformData{
+			Method:   method,
+			Path:     publicPath,
+			Query:    query,
+			Host:     host,
+			ClientIP: info.IP,
+			Metadata: stream.metadataSnapshot(),
+			Header:   httpReq.Header,
+		}
+		if err := lf.transformRequest(httpReq, backend.Transform, data); err != nil {
+			metrics.GetMetrics().IncrementLocalRequestsError()
+			return err
+		}
+	}
+
+	// Credentials của backend áp dụng sau transform để không bị ghi đè
+	backend.Auth.apply(httpReq)
 
 	// 5. Execute local request
-	resp, err := lf.httpClient.Do(httpReq)
+	httpClient := lf.clientFor(backend)
+	if upgrade {
+		// Connection riêng của stream, không đi qua keep-alive pool
+		httpClient = relayClient(httpClient)
+	}
+	if backend.Connection == ConnectionClose || backend.Connection == ConnectionFresh {
+		httpReq.Close = true
+	}
+	var headerTimer *time.Timer
+	if lf.limits.HeaderTimeout > 0 {
+		headerTimer = time.AfterFunc(lf.limits.HeaderTimeout, func() { cancel(ErrResponseHeaderTimeout) })
+	}
+	resp, err := httpClient.Do(httpReq)
+	if headerTimer != nil {
+		headerTimer.Stop()
+	}
 	if err != nil {
 		metrics.GetMetrics().IncrementLocalRequestsError()
-		return fmt.Errorf("local service request failed: %w", err)
+		return fmt.Errorf("local service request failed: %w", limitError(reqCtx, err))
 	}
 	defer resp.Body.Close()
+	if upgrade && resp.StatusCode == http.StatusSwitchingProtocols {
+		// Response limits không áp dụng: connection sống tới khi stream đóng
+		if lf.cors != nil {
+			lf.cors.applyResponse(resp.Header, headers.Get("Origin"))
+		}
+		return lf.relayUpgrade(stream, out, resp, earlyData)
+	}
+	if err := guardResponse(resp, lf.limits, cancel); err != nil {
+		metrics.GetMetrics().IncrementLocalRequestsError()
+		return fmt.Errorf("local service request failed: %w", err)
+	}
 
 	// 6. Write response line and headers back to the stream
-	if err := lf.writeResponseHeader(stream, resp); err != nil {
+	if lf.cors != nil {
+		lf.cors.applyResponse(resp.Header, headers.Get("Origin"))
+	}
+	var respBody io.Reader = resp.Body
+	if backend.Transform != nil {
+		if respBody, err = lf.transformResponse(resp, backend.Transform, data); err != nil {
+			return limitError(reqCtx, err)
+		}
+	}
+	if backend.Scan != nil && backend.Scan.responses {
+		body, length, err := backend.Scan.scan(ctx, respBody, scanInfo{
+			Direction:   "response",
+			Method:      method,
+			Host:        host,
+			Path:        publicPath,
+			ClientIP:    info.IP,
+			Status:      resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+		})
+		if errors.Is(err, ErrScanBlocked) || errors.Is(err, ErrScanUnavailable) {
+			logger.Warn("Rejected response body by content scan", "host", host, "path", publicPath, "url", backend.URL, "status", resp.StatusCode, "error", err)
+			metrics.GetMetrics().IncrementRequestsFailed()
+			result.Source = SourceScanBlocked
+			if err := lf.writeScanRejected(out, err); err != nil {
+				return fmt.Errorf("failed to write scan rejected response: %w", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read response body for content scan: %w", limitError(reqCtx, err))
+		}
+		respBody = body
+		if length > 0 {
+			setContentLength(resp.Header, length)
+		}
+	}
+	mode := normalizeFraming(resp, method)
+	if err := lf.writeResponseHeader(out, resp); err != nil {
 		return fmt.Errorf("failed to write response headers: %w", err)
 	}
+	if c := out.capture; c != nil {
+		// Ghi body trước chunk framing thay vì bytes ghi vào stream
+		respBody = io.TeeReader(respBody, &c.respBody)
+		out.capture = nil
+	}
 
-	// 7. Stream response body back to the tunnel stream
-	_, err = io.Copy(stream, resp.Body)
+	// 7. Stream response body back to the tunnel stream (chunks nhỏ hơn khi có memory pressure)
+	var bodyWriter io.Writer = out
+	var chunks *chunkedBody
+	var length *lengthWriter
+	switch mode {
+	case framingNone:
+		respBody = http.NoBody
+	case framingLength:
+		length = &lengthWriter{w: out, n: contentLength(resp.Header)}
+		bodyWriter = length
+	case framingChunked:
+		chunks = &chunkedBody{w: out, resp: resp}
+		bodyWriter = chunks
+	}
+	_, err = io.CopyBuffer(bodyWriter, respBody, make([]byte, stream.memory.chunkSize(32*1024)))
+	if errors.Is(err, io.ErrUnexpectedEOF) && length != nil {
+		// Local service đóng connection trước khi gửi đủ Content-Length
+		err = length.Close()
+	}
 	if err != nil && err != io.EOF {
-		return fmt.Errorf("failed to stream response body: %w", err)
+		return fmt.Errorf("failed to stream response body: %w", limitError(reqCtx, err))
+	}
+	if chunks != nil {
+		if err := chunks.Close(); err != nil {
+			return fmt.Errorf("failed to write response trailers: %w", err)
+		}
+	}
+	if length != nil {
+		if err := length.Close(); err != nil {
+			return fmt.Errorf("failed to stream response body: %w", err)
+		}
 	}
 
 	// Record metrics
@@ -136,8 +801,70 @@ func (lf *LocalForwarder) ForwardRequest(ctx context.Context, stream *Stream, in
 	return nil
 }
 
+// transformRequest áp dụng request transform của route lên req
+func (lf *LocalForwarder) transformRequest(req *http.Request, t *Transform, data *TransformData) error {
+	if err := t.request.applyHeaders(req.Header, data); err != nil {
+		return err
+	}
+	if !t.request.hasJSON() || req.Body == nil || !isJSONContent(req.Header) {
+		return nil
+	}
+
+	body, length, err := transformBody(req.Body, t.request, data)
+	if err != nil {
+		return fmt.Errorf("failed to transform request body: %w", err)
+	}
+	req.Body = io.NopCloser(body)
+	req.GetBody = nil
+	if length >= 0 {
+		req.ContentLength = length
+		setContentLength(req.Header, length)
+	}
+	return nil
+}
+
+// transformResponse áp dụng response transform của route lên resp, trả về body mới
+func (lf *LocalForwarder) transformResponse(resp *http.Response, t *Transform, data *TransformData) (io.Reader, error) {
+	data.Status = resp.StatusCode
+	data.ResponseHeader = resp.Header
+	data.Body = nil
+	if err := t.response.applyHeaders(resp.Header, data); err != nil {
+		return nil, err
+	}
+	if !t.response.hasJSON() || !isJSONContent(resp.Header) {
+		return resp.Body, nil
+	}
+
+	body, length, err := transformBody(resp.Body, t.response, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transform response body: %w", err)
+	}
+	if length >= 0 {
+		setContentLength(resp.Header, length)
+	}
+	return body, nil
+}
+
 // writeResponseHeader writes HTTP response line and headers to the stream
 func (lf *LocalForwarder) writeResponseHeader(w io.Writer, resp *http.Response) error {
+	// Header rules không được đổi framing: Content-Length/Transfer-Encoding
+	// phải khớp với body agent thực sự gửi
+	framing := http.Header{
+		"Content-Length":    resp.Header.Values("Content-Length"),
+		"Transfer-Encoding": resp.Header.Values("Transfer-Encoding"),
+	}
+	lf.respHeaders.Apply(resp.Header)
+	for key, values := range framing {
+		resp.Header.Del(key)
+		for _, value := range values {
+			resp.Header.Add(key, value)
+		}
+	}
+	rw, _ := w.(*resultWriter)
+	if rw != nil && rw.result.TraceID != "" {
+		resp.Header.Set(TraceHeader, rw.result.TraceID)
+	}
+
 	var buf bytes.Buffer
 	// Response line
 	buf.WriteString(fmt.Sprintf("%s %s\r\n", resp.Proto, resp.Status))
@@ -148,10 +875,18 @@ func (lf *LocalForwarder) writeResponseHeader(w io.Writer, resp *http.Response)
 		}
 	}
 	buf.WriteString("\r\n")
-	_, err := w.Write(buf.Bytes())
-	return err
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if rw != nil {
+		rw.header(resp.StatusCode, buf.Len(), resp.Header)
+	}
+	return nil
 }
 
+// maxRequestHeaders là số header lines tối đa của request Core gửi tới
+const maxRequestHeaders = 256
+
 // parseRequest parse HTTP request từ payload
 // Returns: method, path, query, headers, body, error
 func (lf *LocalForwarder) parseRequest(data []byte) (string, string, string, http.Header, []byte, error) {
@@ -174,6 +909,9 @@ func (lf *LocalForwarder) parseRequest(data []byte) (string, string, string, htt
 	if len(lines) < 1 {
 		return "", "", "", nil, nil, fmt.Errorf("invalid request line")
 	}
+	if len(lines)-1 > maxRequestHeaders {
+		return "", "", "", nil, nil, fmt.Errorf("%w: request has more than %d header lines", ErrProtocolViolation, maxRequestHeaders)
+	}
 
 	requestLine := string(lines[0])
 	requestParts := strings.Split(requestLine, " ")
@@ -209,26 +947,128 @@ func (lf *LocalForwarder) parseRequest(data []byte) (string, string, string, htt
 	return method, path, query, headers, body, nil
 }
 
-// determineLocalURL quyết định local URL dựa trên host
-func (lf *LocalForwarder) determineLocalURL(host string) string {
-	if host == "" {
-		return lf.defaultURL
+// originalHost trả về host gốc của request public: metadata "host" hoặc "sni" do Core
+// gửi trong open header, nếu không có thì Host header của request
+func originalHost(stream *Stream, headers http.Header) string {
+	if stream != nil {
+		if host, ok := stream.GetMetadata("host"); ok && host != "" {
+			return host
+		}
+		if sni, ok := stream.GetMetadata("sni"); ok && sni != "" {
+			return sni
+		}
 	}
+	return headers.Get("Host")
+}
 
-	// Extract subdomain (assuming host is sub.domain.com or sub.localhost)
-	// We check if any of our keys match the start of the host
-	for sub, url := range lf.localServices {
-		if sub == "" {
-			continue
+// route chọn backend cho host và path. Host được so khớp theo thứ tự: hostname
+// chính xác, subdomain label đầu tiên, wildcard dài nhất, cuối cùng là default
+// backend; trong mỗi host, backend có path prefix dài nhất khớp với path thắng.
+func (lf *LocalForwarder) route(host, path string) Backend {
+	if backend, ok := lf.match(host, path); ok {
+		return backend
+	}
+	return lf.defaultBackend(host)
+}
+
+// match chọn backend như route nhưng không fallback về default backend;
+// ok = false khi request không khớp route nào
+func (lf *LocalForwarder) match(host, path string) (Backend, bool) {
+	lf.mu.RLock()
+	defer lf.mu.RUnlock()
+
+	name := strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(name); err == nil {
+		name = h
+	}
+
+	if name != "" {
+		patterns := []string{name}
+		if label, _, _ := strings.Cut(name, "."); label != name {
+			patterns = append(patterns, label)
 		}
-		if strings.HasPrefix(host, sub+".") || host == sub {
-			logger.Debug("Matched local service", "host", host, "subdomain", sub, "url", url)
-			return url
+		patterns = append(patterns, lf.wildcardsFor(name)...)
+
+		for _, pattern := range patterns {
+			if backend, ok := lf.matchPath(pattern, path); ok {
+				logger.Debug("Matched local service", "host", host, "path", path, "pattern", backend.Host, "prefix", backend.Path, "url", backend.URL)
+				return backend, true
+			}
 		}
 	}
 
+	if backend, ok := lf.matchPath("", path); ok && backend.Path != "" {
+		logger.Debug("Matched local service", "host", host, "path", path, "prefix", backend.Path, "url", backend.URL)
+		return backend, true
+	}
+	return Backend{}, false
+}
+
+// defaultBackend trả về default backend với URL là default URL hiện tại
+func (lf *LocalForwarder) defaultBackend(host string) Backend {
+	lf.mu.RLock()
+	defer lf.mu.RUnlock()
+
 	logger.Debug("No mapping found for host, using default", "host", host, "default", lf.defaultURL)
-	return lf.defaultURL
+	var backend Backend
+	for _, b := range lf.backends[""] {
+		if b.Path == "" {
+			backend = b
+		}
+	}
+	backend.URL = lf.defaultURL
+	return backend
+}
+
+// wildcardsFor trả về các wildcard patterns khớp với name, dài nhất trước
+func (lf *LocalForwarder) wildcardsFor(name string) []string {
+	var matches []string
+	for pattern := range lf.backends {
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(name, pattern[1:]) {
+			matches = append(matches, pattern)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return len(matches[i]) > len(matches[j])
+	})
+	return matches
+}
+
+// matchPath trả về backend của pattern có path prefix dài nhất khớp với path
+func (lf *LocalForwarder) matchPath(pattern, path string) (Backend, bool) {
+	for _, backend := range lf.backends[pattern] {
+		if hasPathPrefix(path, backend.Path) {
+			return backend, true
+		}
+	}
+	return Backend{}, false
+}
+
+// freshClient trả về bản sao của base với transport riêng không keep-alive, nên
+// request không bao giờ dùng connection của request khác. Transport không phải
+// *http.Transport (tests) được dùng nguyên.
+func freshClient(base *http.Client) *http.Client {
+	transport := base.Transport
+	if t, ok := transport.(*http.Transport); ok {
+		fresh := t.Clone()
+		fresh.DisableKeepAlives = true
+		transport = fresh
+	}
+	return &http.Client{Timeout: base.Timeout, Transport: transport}
+}
+
+// applyHostHeader đặt Host header của request tới local service theo backend
+func applyHostHeader(req *http.Request, backend Backend, host string) {
+	switch backend.HostHeader {
+	case HostHeaderPreserve:
+		if host != "" {
+			req.Host = host
+		}
+	case HostHeaderRewrite:
+		// http.NewRequest đã đặt Host theo backend URL
+	default:
+		req.Host = backend.HostHeader
+	}
 }
 
 // buildLocalURL build local service URL
@@ -245,6 +1085,14 @@ func (lf *LocalForwarder) buildLocalURL(baseURL, path, query string) string {
 
 // buildResponse build HTTP response payload
 func (lf *LocalForwarder) buildResponse(resp *http.Response, body []byte) []byte {
+	lf.respHeaders.Apply(resp.Header)
+	// Body đã được buffer nên Content-Length luôn là độ dài thật của body
+	resp.Header.Del("Transfer-Encoding")
+	chunked := prepareTrailers(resp)
+	if !chunked && bodyAllowed(resp.StatusCode) {
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
 	var buf bytes.Buffer
 
 	// Response line
@@ -259,8 +1107,12 @@ func (lf *LocalForwarder) buildResponse(resp *http.Response, body []byte) []byte
 
 	buf.WriteString("\r\n")
 
-	// Body
-	if len(body) > 0 {
+	// Body, kèm trailers nếu có
+	if chunked {
+		cb := &chunkedBody{w: &buf, resp: resp}
+		cb.Write(body)
+		cb.Close()
+	} else if len(body) > 0 {
 		buf.Write(body)
 	}
 
@@ -0,0 +1,442 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+func TestLocalForwarder_Route(t *testing.T) {
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		DefaultURL: "http://default",
+		Services: map[string]string{
+			"api":              "http://api",
+			"Shop.Example.com": "http://shop",
+			"*.example.com":    "http://wildcard",
+			"*.eu.example.com": "http://eu",
+		},
+	})
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"api.tunnel.dev", "http://api"},
+		{"api", "http://api"},
+		{"shop.example.com:443", "http://shop"},
+		{"blog.example.com", "http://wildcard"},
+		{"blog.eu.example.com", "http://eu"},
+		{"example.com", "http://default"},
+		{"", "http://default"},
+	}
+	for _, tt := range tests {
+		if got := lf.route(tt.host, "/").URL; got != tt.want {
+			t.Errorf("route(%q) = %s, want %s", tt.host, got, tt.want)
+		}
+	}
+
+	subs := lf.GetSubdomains()
+	if len(subs) != 1 || subs[0] != "api" {
+		t.Errorf("GetSubdomains() = %v, want [api]", subs)
+	}
+}
+
+func TestLocalForwarder_HostHeader(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Seen-Host", r.Host)
+		w.Header().Set("X-Seen-Forwarded-Host", r.Header.Get("X-Forwarded-Host"))
+	}))
+	defer backend.Close()
+	backendHost := strings.TrimPrefix(backend.URL, "http://")
+
+	tests := []struct {
+		name       string
+		hostHeader string
+		want       string
+	}{
+		{"preserve", HostHeaderPreserve, "app.example.com"},
+		{"rewrite", HostHeaderRewrite, backendHost},
+		{"override", "app.internal", "app.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := NewLocalForwarder(LocalForwarderOptions{
+				Backends: []Backend{{Host: "*.example.com", URL: backend.URL, HostHeader: tt.hostHeader}},
+			})
+			// Core gửi host gốc trong metadata; Host header của request là host nội bộ của Core
+			stream, connector := newTestExecStream(t, map[string]string{"host": "app.example.com"})
+
+			req := "GET / HTTP/1.1\r\nHost: core.internal\r\n\r\n"
+			if _, err := lf.ForwardRequest(context.Background(), stream, []byte(req)); err != nil {
+				t.Fatalf("ForwardRequest failed: %v", err)
+			}
+
+			var resp strings.Builder
+			for len(connector.sendCh) > 0 {
+				resp.Write((<-connector.sendCh).Payload)
+			}
+			if !strings.Contains(resp.String(), "X-Seen-Host: "+tt.want+"\r\n") {
+				t.Errorf("expected Host %q, got response:\n%s", tt.want, resp.String())
+			}
+			if !strings.Contains(resp.String(), "X-Seen-Forwarded-Host: app.example.com\r\n") {
+				t.Errorf("expected X-Forwarded-Host app.example.com, got response:\n%s", resp.String())
+			}
+		})
+	}
+}
+
+func TestLocalForwarder_RoutePath(t *testing.T) {
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		DefaultURL: "http://default",
+		Backends: []Backend{
+			{Host: "", Path: "/service-a/", URL: "http://service-a"},
+			{Host: "api", Path: "/v2", URL: "http://api-v2"},
+			{Host: "api", URL: "http://api"},
+		},
+	})
+
+	tests := []struct {
+		host, path, want string
+	}{
+		{"api.tunnel.dev", "/v2/users", "http://api-v2"},
+		{"api.tunnel.dev", "/v2", "http://api-v2"},
+		{"api.tunnel.dev", "/v20", "http://api"},
+		{"api.tunnel.dev", "/service-a/x", "http://api"},
+		{"other.tunnel.dev", "/service-a/x", "http://service-a"},
+		{"other.tunnel.dev", "/service-b", "http://default"},
+	}
+	for _, tt := range tests {
+		if got := lf.route(tt.host, tt.path).URL; got != tt.want {
+			t.Errorf("route(%q, %q) = %s, want %s", tt.host, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRewrite_Apply(t *testing.T) {
+	tests := []struct {
+		name    string
+		rewrite Rewrite
+		path    string
+		want    string
+	}{
+		{"zero value", Rewrite{}, "/a/b", "/a/b"},
+		{"strip prefix", Rewrite{StripPrefix: "/service-a/"}, "/service-a/users", "/users"},
+		{"strip whole path", Rewrite{StripPrefix: "/service-a"}, "/service-a", "/"},
+		{"strip respects segments", Rewrite{StripPrefix: "/service-a"}, "/service-ab", "/service-ab"},
+		{"add prefix", Rewrite{AddPrefix: "/api/"}, "/users", "/api/users"},
+		{"strip then add", Rewrite{StripPrefix: "/public", AddPrefix: "/internal"}, "/public/x", "/internal/x"},
+		{"regex", Rewrite{Regex: regexp.MustCompile(`^/users/(\d+)$`), Replacement: "/profiles/$1"}, "/users/42", "/profiles/42"},
+	}
+	for _, tt := range tests {
+		if got := tt.rewrite.Apply(tt.path); got != tt.want {
+			t.Errorf("%s: Apply(%q) = %q, want %q", tt.name, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLocalForwarder_ForwardedHeaders(t *testing.T) {
+	var seen http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	metadata := map[string]string{
+		"host":        "app.example.com",
+		"client_ip":   "203.0.113.7:51000",
+		"tls_version": "TLS 1.3",
+		"geo_country": "VN",
+	}
+	req := "GET / HTTP/1.1\r\nHost: app.example.com\r\n" +
+		"X-Forwarded-For: 10.0.0.1\r\nX-Real-IP: 10.0.0.1\r\nX-Tunnel-Geo-Country: US\r\n\r\n"
+
+	tests := []struct {
+		name     string
+		trust    bool
+		xff      string
+		realIP   string
+		fwdParam string
+	}{
+		{"override", false, "203.0.113.7", "203.0.113.7", `for="203.0.113.7:51000";host=app.example.com;proto=https`},
+		{"trust", true, "10.0.0.1, 203.0.113.7", "10.0.0.1", `for="203.0.113.7:51000";host=app.example.com;proto=https`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: backend.URL, TrustForwardedHeaders: tt.trust})
+			stream, _ := newTestExecStream(t, metadata)
+			if _, err := lf.ForwardRequest(context.Background(), stream, []byte(req)); err != nil {
+				t.Fatalf("ForwardRequest failed: %v", err)
+			}
+
+			if got := seen.Get("X-Forwarded-For"); got != tt.xff {
+				t.Errorf("X-Forwarded-For = %q, want %q", got, tt.xff)
+			}
+			if got := seen.Get("X-Real-Ip"); got != tt.realIP {
+				t.Errorf("X-Real-IP = %q, want %q", got, tt.realIP)
+			}
+			if got := seen.Get("Forwarded"); got != tt.fwdParam {
+				t.Errorf("Forwarded = %q, want %q", got, tt.fwdParam)
+			}
+			if got := seen.Get("X-Forwarded-Proto"); got != "https" {
+				t.Errorf("X-Forwarded-Proto = %q, want https", got)
+			}
+			if got := seen.Get("X-Tunnel-Tls-Version"); got != "TLS 1.3" {
+				t.Errorf("X-Tunnel-Tls-Version = %q", got)
+			}
+			// X-Tunnel-* từ client không bao giờ được tin
+			if got := seen.Get("X-Tunnel-Geo-Country"); got != "VN" {
+				t.Errorf("X-Tunnel-Geo-Country = %q, want VN", got)
+			}
+		})
+	}
+}
+
+func TestForwardedElement_IPv6(t *testing.T) {
+	got := forwardedElement(clientInfo{IP: "2001:db8::1", Proto: "http"}, "a b")
+	want := `for="[2001:db8::1]";host="a b";proto=http`
+	if got != want {
+		t.Errorf("forwardedElement = %q, want %q", got, want)
+	}
+}
+
+func TestLocalForwarder_ResponseHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "legacy-app/1.0")
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+		w.Header().Set("Cache-Control", "no-cache")
+	}))
+	defer backend.Close()
+
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		DefaultURL: backend.URL,
+		ResponseHeaders: HeaderRules{
+			Remove:   []string{"Server"},
+			Defaults: SecurityHeaders,
+			Set:      map[string]string{"Cache-Control": "no-store"},
+			Add:      map[string]string{"X-Served-By": "tunnel-agent"},
+		},
+	})
+	stream, connector := newTestExecStream(t, nil)
+	if _, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: a\r\n\r\n")); err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+
+	var resp strings.Builder
+	for len(connector.sendCh) > 0 {
+		resp.Write((<-connector.sendCh).Payload)
+	}
+	got := resp.String()
+	for _, want := range []string{
+		"X-Frame-Options: SAMEORIGIN\r\n", // local service đã đặt, preset không ghi đè
+		"X-Content-Type-Options: nosniff\r\n",
+		"Strict-Transport-Security: max-age=31536000; includeSubDomains\r\n",
+		"Cache-Control: no-store\r\n",
+		"X-Served-By: tunnel-agent\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("response missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Server:") {
+		t.Errorf("Server header should be removed:\n%s", got)
+	}
+}
+
+func TestLocalForwarder_ReplaceBackends(t *testing.T) {
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		DefaultURL: "http://old-default",
+		Services:   map[string]string{"api": "http://old-api", "web": "http://web"},
+	})
+
+	lf.ReplaceBackends([]Backend{
+		{Host: "API", URL: "http://new-api"},
+		{Host: "api", Path: "/v2/", URL: "http://new-api-v2"},
+	}, "http://new-default")
+
+	tests := []struct {
+		host, path, want string
+	}{
+		{"api.tunnel.dev", "/", "http://new-api"},
+		{"api.tunnel.dev", "/v2/users", "http://new-api-v2"},
+		{"web.tunnel.dev", "/", "http://new-default"},
+	}
+	for _, tt := range tests {
+		if got := lf.route(tt.host, tt.path).URL; got != tt.want {
+			t.Errorf("route(%q, %q) = %s, want %s", tt.host, tt.path, got, tt.want)
+		}
+	}
+
+	backends := lf.Backends()
+	if len(backends) != 2 || backends[0].Path != "" || backends[1].Path != "/v2" {
+		t.Errorf("Backends() = %+v, want api and api/v2", backends)
+	}
+}
+
+func TestLocalForwarder_Connection(t *testing.T) {
+	tests := []struct {
+		connection string
+		wantConns  int
+	}{
+		{ConnectionReuse, 1},
+		{ConnectionClose, 3},
+		{ConnectionFresh, 3},
+	}
+	for _, tt := range tests {
+		t.Run("mode="+tt.connection, func(t *testing.T) {
+			var mu sync.Mutex
+			conns := make(map[string]bool)
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				conns[r.RemoteAddr] = true
+				mu.Unlock()
+				w.Write([]byte("ok"))
+			}))
+			defer backend.Close()
+
+			lf := NewLocalForwarder(LocalForwarderOptions{
+				Backends: []Backend{{Host: "", URL: backend.URL, Connection: tt.connection}},
+			})
+			lf.SetDefaultURL(backend.URL)
+			for i := 0; i < 3; i++ {
+				stream, connector := newTestExecStream(t, nil)
+				if _, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: app\r\n\r\n")); err != nil {
+					t.Fatalf("ForwardRequest failed: %v", err)
+				}
+				for len(connector.sendCh) > 0 {
+					<-connector.sendCh
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(conns) != tt.wantConns {
+				t.Errorf("local service saw %d connections, want %d", len(conns), tt.wantConns)
+			}
+		})
+	}
+}
+
+func TestLocalForwarder_RecordsStreamLatency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	before := metrics.GetMetrics().GetSnapshot()
+	lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: server.URL})
+	stream, _ := newTestExecStream(t, nil)
+	if _, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: app\r\n\r\n")); err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+
+	after := metrics.GetMetrics().GetSnapshot()
+	if got := after.StreamLocalSend.Count - before.StreamLocalSend.Count; got != 1 {
+		t.Errorf("local_send observations = %d, want 1", got)
+	}
+	if got := after.StreamFirstByte.Count - before.StreamFirstByte.Count; got != 1 {
+		t.Errorf("first_byte observations = %d, want 1", got)
+	}
+}
+
+func TestLocalForwarder_ForwardResult(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "5")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "hello")
+	}))
+	defer backend.Close()
+
+	lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: backend.URL})
+	stream, connector := newTestExecStream(t, nil)
+	result, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: a\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+
+	var written int
+	for len(connector.sendCh) > 0 {
+		written += len((<-connector.sendCh).Payload)
+	}
+	if result.Source != SourceLocal || result.Backend != backend.URL || result.StatusCode != http.StatusCreated {
+		t.Errorf("result = %s %s %d, want local %s 201", result.Source, result.Backend, result.StatusCode, backend.URL)
+	}
+	if result.BodyBytes != 5 || result.HeaderBytes+int(result.BodyBytes) != written {
+		t.Errorf("result has %d header + %d body bytes, stream received %d bytes", result.HeaderBytes, result.BodyBytes, written)
+	}
+	if result.FirstByte <= 0 || result.LocalSend <= 0 || result.Duration <= 0 {
+		t.Errorf("timings not recorded: %+v", result)
+	}
+
+	// Response do agent tạo (400) cũng được mô tả bằng result
+	stream, _ = newTestExecStream(t, nil)
+	result, err = lf.ForwardRequest(context.Background(), stream, []byte("POST / HTTP/1.1\r\nHost: a\r\nContent-Length: x\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+	if result.Source != SourceBadRequest || result.StatusCode != http.StatusBadRequest || !result.HeadersWritten() {
+		t.Errorf("result = %s %d, want bad_request 400", result.Source, result.StatusCode)
+	}
+}
+
+func TestAgentHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          *AgentHeaders
+		via, ua       string
+		wantVia       string
+		wantUserAgent string
+	}{
+		{
+			name:          "default",
+			opts:          &AgentHeaders{Version: "v1.2.3", AgentID: "edge-1"},
+			ua:            "curl/8.0",
+			wantVia:       "1.1 edge-1 (tunnel-agent/v1.2.3)",
+			wantUserAgent: "curl/8.0 tunnel-agent/v1.2.3 (agent edge-1)",
+		},
+		{
+			name:          "appends to proxy chain",
+			opts:          &AgentHeaders{Version: "v1.2.3", UserAgent: "via-tunnel"},
+			via:           "1.1 cdn",
+			wantVia:       "1.1 cdn, 1.1 tunnel-agent (tunnel-agent/v1.2.3)",
+			wantUserAgent: "via-tunnel",
+		},
+		{
+			name:          "invalid token characters",
+			opts:          &AgentHeaders{Version: "dev", AgentID: "my agent (prod)"},
+			ua:            "app",
+			wantVia:       "1.1 my-agent--prod- (tunnel-agent/dev)",
+			wantUserAgent: "app tunnel-agent/dev (agent my-agent--prod-)",
+		},
+		{
+			name:          "disabled",
+			ua:            "curl/8.0",
+			wantUserAgent: "curl/8.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := make(http.Header)
+			if tt.via != "" {
+				header.Set("Via", tt.via)
+			}
+			if tt.ua != "" {
+				header.Set("User-Agent", tt.ua)
+			}
+			newAgentHeaders(tt.opts).apply(header)
+			if got := header.Get("Via"); got != tt.wantVia {
+				t.Errorf("Via = %q, want %q", got, tt.wantVia)
+			}
+			if got := header.Get("User-Agent"); got != tt.wantUserAgent {
+				t.Errorf("User-Agent = %q, want %q", got, tt.wantUserAgent)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+// DefaultMemoryCap là giới hạn mặc định của payload đang buffer (256 MiB)
+const DefaultMemoryCap = 256 << 20
+
+// memoryReliefRatio: pressure kết thúc khi buffered giảm xuống dưới tỷ lệ này của cap,
+// tránh bật/tắt liên tục quanh ngưỡng
+const memoryReliefRatio = 0.8
+
+// pressureChunkSize là chunk size khi có memory pressure
+const pressureChunkSize = 4 * 1024
+
+// MemoryBudget đếm xấp xỉ payload bytes đang buffer (stream queues, send queue)
+// so với cap. Khi vượt cap agent shed load: từ chối stream mới và dùng chunks
+// nhỏ hơn. Nil MemoryBudget = không giới hạn, mọi method đều nil-safe.
+type MemoryBudget struct {
+	limit    int64
+	buffered atomic.Int64
+	pressure atomic.Bool
+
+	onPressure func(underPressure bool, buffered, limit int64)
+	mu         sync.Mutex // serialize pressure transitions và callback
+}
+
+// NewMemoryBudget tạo MemoryBudget với cap limit bytes. onPressure (có thể nil)
+// được gọi mỗi khi pressure bắt đầu hoặc kết thúc.
+func NewMemoryBudget(limit int64, onPressure func(underPressure bool, buffered, limit int64)) *MemoryBudget {
+	metrics.GetMetrics().SetMemoryLimit(limit)
+	return &MemoryBudget{limit: limit, onPressure: onPressure}
+}
+
+// Reserve ghi nhận n bytes được buffer
+func (m *MemoryBudget) Reserve(n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	metrics.GetMetrics().AddMemoryBuffered(int64(n))
+	if m.buffered.Add(int64(n)) > m.limit && !m.pressure.Load() {
+		m.update()
+	}
+}
+
+// Release ghi nhận n bytes đã rời buffer
+func (m *MemoryBudget) Release(n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	metrics.GetMetrics().AddMemoryBuffered(-int64(n))
+	if m.buffered.Add(-int64(n)) < int64(float64(m.limit)*memoryReliefRatio) && m.pressure.Load() {
+		m.update()
+	}
+}
+
+// update tính lại pressure state và báo callback khi state đổi
+func (m *MemoryBudget) update() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buffered := m.buffered.Load()
+	under := m.pressure.Load()
+	switch {
+	case !under && buffered > m.limit:
+		under = true
+	case under && buffered < int64(float64(m.limit)*memoryReliefRatio):
+		under = false
+	default:
+		return
+	}
+	m.pressure.Store(under)
+	metrics.GetMetrics().SetMemoryPressure(under)
+	if m.onPressure != nil {
+		m.onPressure(under, buffered, m.limit)
+	}
+}
+
+// UnderPressure trả về true khi buffered đã vượt cap và chưa giảm về mức relief
+func (m *MemoryBudget) UnderPressure() bool {
+	return m != nil && m.pressure.Load()
+}
+
+// Buffered trả về số bytes đang buffer
+func (m *MemoryBudget) Buffered() int64 {
+	if m == nil {
+		return 0
+	}
+	return m.buffered.Load()
+}
+
+// Limit trả về cap (0 = không giới hạn)
+func (m *MemoryBudget) Limit() int64 {
+	if m == nil {
+		return 0
+	}
+	return m.limit
+}
+
+// chunkSize trả về size khi bình thường, hoặc chunk nhỏ hơn khi có pressure
+func (m *MemoryBudget) chunkSize(size int) int {
+	if m.UnderPressure() && size > pressureChunkSize {
+		return pressureChunkSize
+	}
+	return size
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestMemoryBudget_PressureHysteresis(t *testing.T) {
+	var transitions []bool
+	m := NewMemoryBudget(1000, func(underPressure bool, buffered, limit int64) {
+		transitions = append(transitions, underPressure)
+	})
+
+	m.Reserve(900)
+	if m.UnderPressure() {
+		t.Fatal("900/1000 should not be under pressure")
+	}
+	m.Reserve(200)
+	if !m.UnderPressure() {
+		t.Fatal("1100/1000 should be under pressure")
+	}
+	if got := m.chunkSize(DefaultFileChunkSize); got != pressureChunkSize {
+		t.Errorf("Expected chunk size %d under pressure, got %d", pressureChunkSize, got)
+	}
+
+	// Dưới cap nhưng chưa dưới mức relief (80%): vẫn shed load
+	m.Release(200)
+	if !m.UnderPressure() {
+		t.Error("900/1000 should stay under pressure until below 80%")
+	}
+	m.Release(200)
+	if m.UnderPressure() {
+		t.Error("700/1000 should relieve pressure")
+	}
+
+	if len(transitions) != 2 || !transitions[0] || transitions[1] {
+		t.Errorf("Expected transitions [true false], got %v", transitions)
+	}
+}
+
+func TestMemoryBudget_Nil(t *testing.T) {
+	var m *MemoryBudget
+	m.Reserve(1 << 30)
+	m.Release(1)
+	if m.UnderPressure() || m.Buffered() != 0 || m.Limit() != 0 {
+		t.Error("nil budget should be unlimited")
+	}
+	if got := m.chunkSize(DefaultFileChunkSize); got != DefaultFileChunkSize {
+		t.Errorf("nil budget should keep chunk size, got %d", got)
+	}
+}
+
+func TestStream_DeliverTracksMemory(t *testing.T) {
+	m := NewMemoryBudget(1<<20, nil)
+	sm := NewStreamManager(nil, StreamManagerOptions{Memory: m})
+
+	stream, err := sm.CreateStream(1)
+	if err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+	if err := stream.Deliver([]byte("hello")); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	if err := stream.Deliver([]byte("world")); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	if got := m.Buffered(); got != 10 {
+		t.Fatalf("Expected 10 buffered bytes, got %d", got)
+	}
+
+	buf := make([]byte, 5)
+	if _, err := stream.Read(buf); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got := m.Buffered(); got != 5 {
+		t.Errorf("Expected 5 buffered bytes after read, got %d", got)
+	}
+
+	// Data chưa đọc được release khi stream đóng, đọc sau đó không release lần nữa
+	sm.CloseStream(1)
+	if got := m.Buffered(); got != 0 {
+		t.Errorf("Expected 0 buffered bytes after close, got %d", got)
+	}
+	stream.Read(buf)
+	if got := m.Buffered(); got != 0 {
+		t.Errorf("Expected buffered bytes to stay 0, got %d", got)
+	}
+
+	if err := stream.Deliver([]byte("late")); err != ErrStreamNotFound {
+		t.Errorf("Expected ErrStreamNotFound for closed stream, got %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+	"github.com/hydragon2m/tunnel-agent/internal/mqtt"
+)
+
+// ErrBridgeReplyTimeout được trả về khi broker không có reply trong ReplyTimeout
+var ErrBridgeReplyTimeout = errors.New("no reply from broker within timeout")
+
+// MQTTBridgeOptions cấu hình MQTTBridge
+type MQTTBridgeOptions struct {
+	// Address của broker (host:port)
+	Address string
+
+	// Topic mà requests được publish tới
+	Topic string
+
+	// ClientID, Username và Password dùng khi CONNECT (ClientID rỗng = random)
+	ClientID string
+	Username string
+	Password string
+
+	// ReplyTimeout là thời gian chờ reply cho mỗi request (default 30s)
+	ReplyTimeout time.Duration
+
+	// MaxBody là số bytes request body tối đa được publish (default 1 MiB);
+	// body lớn hơn nhận 413
+	MaxBody int64
+}
+
+// defaultMQTTMaxBody là kích thước request body tối đa mặc định của MQTT bridge
+const defaultMQTTMaxBody = 1 << 20
+
+// MQTTRequest là envelope JSON được publish cho mỗi request. Service phía
+// broker publish reply (payload = response body) lên ReplyTo.
+type MQTTRequest struct {
+	ID      string      `json:"id"`
+	ReplyTo string      `json:"reply_to"`
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Query   string      `json:"query,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    []byte      `json:"body,omitempty"` // base64 trong JSON
+}
+
+// MQTTBridge là backend chuyển request thành message trên MQTT broker
+// (publish request, chờ reply có cùng correlation ID), cho deployments IoT
+// mà local service là broker thay vì HTTP server
+type MQTTBridge struct {
+	opts        MQTTBridgeOptions
+	replyPrefix string
+
+	mu     sync.Mutex
+	client *mqtt.Client
+
+	pendingMu sync.Mutex
+	pending   map[string]chan []byte
+}
+
+// NewMQTTBridge tạo MQTTBridge; connection tới broker được mở ở request đầu tiên
+// và mở lại khi bị mất
+func NewMQTTBridge(opts MQTTBridgeOptions) *MQTTBridge {
+	if opts.ReplyTimeout <= 0 {
+		opts.ReplyTimeout = 30 * time.Second
+	}
+	if opts.MaxBody <= 0 {
+		opts.MaxBody = defaultMQTTMaxBody
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = "tunnel-agent-" + randomHex(6)
+	}
+	return &MQTTBridge{
+		opts:        opts,
+		replyPrefix: "tunnel-agent/replies/" + opts.ClientID,
+		pending:     make(map[string]chan []byte),
+	}
+}
+
+// Request publish req và chờ reply
+func (b *MQTTBridge) Request(ctx context.Context, req MQTTRequest) ([]byte, error) {
+	client, err := b.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to broker %s: %w", b.opts.Address, err)
+	}
+
+	req.ID = randomHex(8)
+	req.ReplyTo = b.replyPrefix + "/" + req.ID
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := make(chan []byte, 1)
+	b.pendingMu.Lock()
+	b.pending[req.ID] = reply
+	b.pendingMu.Unlock()
+	defer func() {
+		b.pendingMu.Lock()
+		delete(b.pending, req.ID)
+		b.pendingMu.Unlock()
+	}()
+
+	if err := client.Publish(b.opts.Topic, payload); err != nil {
+		return nil, fmt.Errorf("failed to publish to %s: %w", b.opts.Topic, err)
+	}
+
+	timer := time.NewTimer(b.opts.ReplyTimeout)
+	defer timer.Stop()
+	select {
+	case body := <-reply:
+		return body, nil
+	case <-timer.C:
+		return nil, ErrBridgeReplyTimeout
+	case <-client.Done():
+		return nil, client.Err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// connect trả về connection hiện tại tới broker, mở lại nếu đã mất
+func (b *MQTTBridge) connect(ctx context.Context) (*mqtt.Client, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client != nil && b.client.Err() == nil {
+		return b.client, nil
+	}
+
+	client, err := mqtt.Dial(ctx, b.opts.Address, mqtt.Options{
+		ClientID: b.opts.ClientID,
+		Username: b.opts.Username,
+		Password: b.opts.Password,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Subscribe(ctx, b.replyPrefix+"/+", b.deliver); err != nil {
+		client.Close()
+		return nil, err
+	}
+	logger.Info("Connected to MQTT broker", "address", b.opts.Address, "topic", b.opts.Topic)
+	b.client = client
+	return client, nil
+}
+
+// deliver chuyển reply tới request đang chờ theo correlation ID (segment cuối của topic)
+func (b *MQTTBridge) deliver(topic string, payload []byte) {
+	id := topic[strings.LastIndex(topic, "/")+1:]
+	b.pendingMu.Lock()
+	reply, ok := b.pending[id]
+	b.pendingMu.Unlock()
+	if !ok {
+		logger.Debug("Dropping MQTT reply without pending request", "topic", topic)
+		return
+	}
+	select {
+	case reply <- payload:
+	default:
+	}
+}
+
+// writePayloadTooLarge ghi 413 cho request body lớn hơn MaxBody của bridge;
+// body không được đọc nên connection bị đóng sau response
+func (lf *LocalForwarder) writePayloadTooLarge(w io.Writer) error {
+	const body = "payload too large\n"
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		StatusCode: http.StatusRequestEntityTooLarge,
+		Status:     "413 Request Entity Too Large",
+		Header:     make(http.Header),
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Connection", "close")
+	if err := lf.writeResponseHeader(w, resp); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, body)
+	return err
+}
+
+// Close đóng connection tới broker
+func (b *MQTTBridge) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client == nil {
+		return nil
+	}
+	return b.client.Close()
+}
+
+// forwardMQTT gửi request tới broker của backend và ghi reply thành response
+// 200 vào out; không có reply trong timeout thì trả 504. Request body còn lại
+// được đọc từ stream, tối đa MaxBody bytes (lớn hơn trả 413).
+func (lf *LocalForwarder) forwardMQTT(ctx context.Context, stream *Stream, out io.Writer, bridge *MQTTBridge, method, path, query string, headers http.Header, initialBody []byte, startTime time.Time) error {
+	length, err := requestLength(headers)
+	if err == nil && length >= 0 && int64(len(initialBody)) > length {
+		err = fmt.Errorf("%w: request body is longer than Content-Length %d", ErrContentLengthMismatch, length)
+	}
+	if err != nil {
+		metrics.GetMetrics().IncrementRequestsFailed()
+		return lf.writeBadRequest(out, err)
+	}
+	// Content-Length do public client gửi: kiểm tra trước khi cấp phát
+	if length > bridge.opts.MaxBody || int64(len(initialBody)) > bridge.opts.MaxBody {
+		metrics.GetMetrics().IncrementRequestsFailed()
+		return lf.writePayloadTooLarge(out)
+	}
+
+	body := initialBody
+	if length > int64(len(initialBody)) {
+		body = make([]byte, length)
+		if _, err := io.ReadFull(io.MultiReader(bytes.NewReader(initialBody), stream), body); err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+
+	headers = headers.Clone()
+	headers.Del("Host")
+	reply, err := bridge.Request(ctx, MQTTRequest{
+		Method:  method,
+		Path:    path,
+		Query:   query,
+		Headers: headers,
+		Body:    body,
+	})
+
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+	}
+	switch {
+	case errors.Is(err, ErrBridgeReplyTimeout):
+		metrics.GetMetrics().IncrementLocalRequestsError()
+		resp.StatusCode, resp.Status = http.StatusGatewayTimeout, "504 Gateway Timeout"
+		reply = []byte(err.Error() + "\n")
+		resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	case err != nil:
+		metrics.GetMetrics().IncrementLocalRequestsError()
+		return fmt.Errorf("broker request failed: %w", err)
+	default:
+		resp.StatusCode, resp.Status = http.StatusOK, "200 OK"
+		resp.Header.Set("Content-Type", "application/octet-stream")
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(reply)))
+	if lf.cors != nil {
+		lf.cors.applyResponse(resp.Header, headers.Get("Origin"))
+	}
+
+	if err := lf.writeResponseHeader(out, resp); err != nil {
+		return fmt.Errorf("failed to write response headers: %w", err)
+	}
+	if _, err := out.Write(reply); err != nil {
+		return fmt.Errorf("failed to write response body: %w", err)
+	}
+
+	metrics.GetMetrics().RecordLocalRequestDuration(time.Since(startTime))
+	metrics.GetMetrics().IncrementRequestsSuccess()
+	metrics.GetMetrics().SetLastRequestTime(time.Now())
+	return nil
+}
+
+// randomHex trả về n bytes ngẫu nhiên dạng hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/mqtt"
+)
+
+func TestMQTTBridge_RequestReply(t *testing.T) {
+	broker, err := mqtt.NewBroker("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewBroker failed: %v", err)
+	}
+	defer broker.Close()
+
+	// Service phía broker: reply bằng body viết hoa
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	device, err := mqtt.Dial(ctx, broker.Addr(), mqtt.Options{ClientID: "device"})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer device.Close()
+	requests := make(chan MQTTRequest, 1)
+	if err := device.Subscribe(ctx, "devices/cmd", func(topic string, payload []byte) {
+		var req MQTTRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			t.Errorf("Invalid request envelope %q: %v", payload, err)
+			return
+		}
+		requests <- req
+		device.Publish(req.ReplyTo, bytes.ToUpper(req.Body))
+	}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	bridge := NewMQTTBridge(MQTTBridgeOptions{Address: broker.Addr(), Topic: "devices/cmd"})
+	defer bridge.Close()
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		Backends: []Backend{{URL: "mqtt://" + broker.Addr() + "/devices/cmd", MQTT: bridge}},
+	})
+
+	resp := forwardAndRead(t, lf, "POST /lamp?state=on HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\n\r\nhello")
+	if !strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n") || !strings.HasSuffix(resp, "\r\n\r\nHELLO") {
+		t.Errorf("Unexpected response:\n%s", resp)
+	}
+	req := <-requests
+	if req.Method != "POST" || req.Path != "/lamp" || req.Query != "state=on" || req.ID == "" {
+		t.Errorf("Unexpected request envelope: %+v", req)
+	}
+}
+
+func TestMQTTBridge_ReplyTimeout(t *testing.T) {
+	broker, err := mqtt.NewBroker("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewBroker failed: %v", err)
+	}
+	defer broker.Close()
+
+	bridge := NewMQTTBridge(MQTTBridgeOptions{Address: broker.Addr(), Topic: "nobody", ReplyTimeout: 50 * time.Millisecond})
+	defer bridge.Close()
+	lf := NewLocalForwarder(LocalForwarderOptions{Backends: []Backend{{URL: "mqtt://" + broker.Addr() + "/nobody", MQTT: bridge}}})
+
+	resp := forwardAndRead(t, lf, "GET / HTTP/1.1\r\nHost: a\r\n\r\n")
+	if !strings.HasPrefix(resp, "HTTP/1.1 504 Gateway Timeout\r\n") {
+		t.Errorf("Expected 504 without a reply:\n%s", resp)
+	}
+}
+
+func TestMQTTBridge_BodyTooLarge(t *testing.T) {
+	broker, err := mqtt.NewBroker("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewBroker failed: %v", err)
+	}
+	defer broker.Close()
+
+	bridge := NewMQTTBridge(MQTTBridgeOptions{Address: broker.Addr(), Topic: "devices/cmd", MaxBody: 4, ReplyTimeout: 50 * time.Millisecond})
+	defer bridge.Close()
+	lf := NewLocalForwarder(LocalForwarderOptions{Backends: []Backend{{URL: "mqtt://" + broker.Addr() + "/devices/cmd", MQTT: bridge}}})
+
+	// Content-Length lớn bị từ chối trước khi cấp phát body
+	resp := forwardAndRead(t, lf, "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 99999999999\r\n\r\nhello")
+	if !strings.HasPrefix(resp, "HTTP/1.1 413 Request Entity Too Large\r\n") {
+		t.Errorf("Expected 413 for a body over MaxBody:\n%s", resp)
+	}
+	resp = forwardAndRead(t, lf, "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: abc\r\n\r\n")
+	if !strings.HasPrefix(resp, "HTTP/1.1 400 Bad Request\r\n") {
+		t.Errorf("Expected 400 for an invalid Content-Length:\n%s", resp)
+	}
+}
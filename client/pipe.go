@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// PipeTargetKey là metadata key chứa địa chỉ phía Core mà pipe stream nối tới
+const PipeTargetKey = "target"
+
+// pipeChunkSize là kích thước tối đa của mỗi data frame đọc từ input
+const pipeChunkSize = 32 * 1024
+
+// Pipe mở một agent-initiated TCP stream tới target phía Core và nối nó với
+// in/out (như `ssh -W`): data từ in được gửi lên stream, EOF của in
+// half-close stream (EndStream); data Core gửi về được ghi ra out. Pipe trả
+// về khi Core đóng stream hoặc ctx bị huỷ.
+func Pipe(ctx context.Context, sm *StreamManager, target string, in io.Reader, out io.Writer) error {
+	stream, err := sm.OpenStream(ctx, StreamKindTCP, map[string]string{PipeTargetKey: target}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to open pipe stream: %w", err)
+	}
+	defer sm.CloseStream(stream.ID)
+
+	sendErr := make(chan error, 1)
+	go func() {
+		_, err := copyToStream(ctx, stream, in, pipeChunkSize)
+		if err == nil {
+			err = stream.Close()
+		}
+		if err != nil {
+			sendErr <- fmt.Errorf("failed to send pipe input: %w", err)
+		}
+	}()
+
+	recvErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(out, stream)
+		recvErr <- err
+	}()
+
+	select {
+	case err := <-recvErr:
+		return err
+	case err := <-sendErr:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+func TestPipe_BridgesStream(t *testing.T) {
+	connector := NewConnector("test", ConnectorOptions{})
+	connector.connected = true
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- Pipe(context.Background(), sm, "db.internal:5432", strings.NewReader("ping"), &out)
+	}()
+
+	next := func() *v1.Frame {
+		t.Helper()
+		select {
+		case frame := <-connector.sendCh:
+			return frame
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for frame")
+			return nil
+		}
+	}
+
+	open := next()
+	kind, metadata, _, err := ParseOpenPayload(open.Payload)
+	if open.Type != v1.FrameOpenStream || err != nil || kind != StreamKindTCP || metadata[PipeTargetKey] != "db.internal:5432" {
+		t.Fatalf("Unexpected open frame: type %v kind %q metadata %v err %v", open.Type, kind, metadata, err)
+	}
+	if !IsAgentInitiatedID(open.StreamID) {
+		t.Errorf("Pipe stream should use an agent-initiated ID, got %d", open.StreamID)
+	}
+
+	if data := next(); string(data.Payload) != "ping" {
+		t.Errorf("Expected input data, got %q", data.Payload)
+	}
+	// EOF của input là half-close
+	if end := next(); !end.IsEndStream() {
+		t.Errorf("Expected EndStream after input EOF, got flags %v", end.Flags)
+	}
+
+	stream, ok := sm.GetStream(open.StreamID)
+	if !ok {
+		t.Fatal("Pipe stream not found")
+	}
+	if err := stream.Deliver([]byte("pong")); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	sm.CloseStream(open.StreamID)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Pipe failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Pipe did not return after Core closed the stream")
+	}
+	if out.String() != "pong" {
+		t.Errorf("Expected output %q, got %q", "pong", out.String())
+	}
+}
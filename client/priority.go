@@ -0,0 +1,70 @@
+package client
+
+import (
+	"strconv"
+	"strings"
+)
+
+// metaPriority là stream metadata key chứa priority hint trong open header
+const metaPriority = "priority"
+
+// Priority là priority hint của stream. Frames của stream priority cao được
+// writeLoop ghi trước, để request tương tác không phải chờ sau bulk transfers
+// dùng chung tunnel.
+type Priority int
+
+const (
+	PriorityNormal Priority = iota // default khi open header không có hint
+	PriorityHigh                   // request tương tác (API, page loads)
+	PriorityLow                    // bulk transfers (downloads, backups)
+)
+
+// String trả về tên của priority
+func (p Priority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityLow:
+		return "low"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriority parse priority hint: "high"/"interactive", "normal",
+// "low"/"bulk", hoặc urgency 0-7 kiểu RFC 9218 (0-2 = high, 3-4 = normal,
+// 5-7 = low). Giá trị không hợp lệ là PriorityNormal.
+func ParsePriority(value string) Priority {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "high", "interactive":
+		return PriorityHigh
+	case "low", "bulk", "background":
+		return PriorityLow
+	}
+	if urgency, err := strconv.Atoi(strings.TrimPrefix(value, "u=")); err == nil {
+		switch {
+		case urgency < 0 || urgency > 7:
+		case urgency <= 2:
+			return PriorityHigh
+		case urgency >= 5:
+			return PriorityLow
+		}
+	}
+	return PriorityNormal
+}
+
+// PriorityFromMetadata trả về priority hint trong stream metadata của open header
+func PriorityFromMetadata(metadata map[string]string) Priority {
+	return ParsePriority(metadata[metaPriority])
+}
+
+// SetPriority set priority cho frames stream gửi từ giờ về sau
+func (s *Stream) SetPriority(p Priority) {
+	s.priority.Store(int32(p))
+}
+
+// Priority trả về priority của stream
+func (s *Stream) Priority() Priority {
+	return Priority(s.priority.Load())
+}
@@ -0,0 +1,56 @@
+package client
+
+import "testing"
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Priority
+	}{
+		{"", PriorityNormal},
+		{"high", PriorityHigh},
+		{"Interactive", PriorityHigh},
+		{"low", PriorityLow},
+		{"bulk", PriorityLow},
+		{"u=0", PriorityHigh},
+		{"3", PriorityNormal},
+		{"u=7", PriorityLow},
+		{"9", PriorityNormal},
+		{"urgent!", PriorityNormal},
+	}
+	for _, tt := range tests {
+		if got := ParsePriority(tt.value); got != tt.want {
+			t.Errorf("ParsePriority(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestConnector_WritesHighPriorityFirst(t *testing.T) {
+	connector := NewConnector("memory", ConnectorOptions{})
+	defer connector.Close()
+	conn, core := newMemoryPipe()
+	connector.setConnection(conn)
+
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+	bulk, _ := sm.CreateStream(1)
+	bulk.SetPriority(PriorityLow)
+	normal, _ := sm.CreateStream(3)
+	interactive, _ := sm.CreateStream(5)
+	interactive.SetPriority(PriorityHigh)
+
+	// Frames được queue trước khi writeLoop chạy, theo thứ tự ngược priority
+	for _, stream := range []*Stream{bulk, normal, interactive} {
+		if _, err := stream.Write([]byte("chunk")); err != nil {
+			t.Fatalf("Write stream %d: %v", stream.ID, err)
+		}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go connector.writeLoop(conn, done)
+
+	for _, want := range []uint32{5, 3, 1} {
+		if frame := readCoreFrame(t, core); frame.StreamID != want {
+			t.Errorf("Core received stream %d, want %d", frame.StreamID, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+//go:build linux
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// startPTY mở pseudo-terminal và start cmd với PTY làm controlling terminal
+func startPTY(cmd *exec.Cmd, cols, rows uint16) (*os.File, error) {
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unlock slave và lấy số PTY
+	var unlock int32
+	if err := ioctl(ptmx.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		ptmx.Close()
+		return nil, err
+	}
+	var ptyNum uint32
+	if err := ioctl(ptmx.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&ptyNum))); err != nil {
+		ptmx.Close()
+		return nil, err
+	}
+
+	tty, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", ptyNum), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		ptmx.Close()
+		return nil, err
+	}
+	defer tty.Close()
+
+	if cols > 0 && rows > 0 {
+		ws := struct{ Row, Col, X, Y uint16 }{Row: rows, Col: cols}
+		if err := ioctl(ptmx.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws))); err != nil {
+			ptmx.Close()
+			return nil, err
+		}
+	}
+
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	if err := cmd.Start(); err != nil {
+		ptmx.Close()
+		return nil, err
+	}
+	return ptmx, nil
+}
+
+// ioctl wrapper
+func ioctl(fd, cmd, ptr uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, cmd, ptr)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
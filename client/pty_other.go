@@ -0,0 +1,14 @@
+//go:build !linux
+
+package client
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// startPTY không được hỗ trợ trên platform này
+func startPTY(cmd *exec.Cmd, cols, rows uint16) (*os.File, error) {
+	return nil, errors.New("pty is not supported on this platform")
+}
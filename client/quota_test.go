@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hydragon2m/tunnel-agent/internal/quota"
+)
+
+func TestLocalForwarder_Quota(t *testing.T) {
+	calls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("hello"))
+	}))
+	defer backend.Close()
+
+	q, err := quota.Open(quota.Options{Path: filepath.Join(t.TempDir(), "quota"), MaxRequests: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: backend.URL, Quota: q})
+	const req = "GET / HTTP/1.1\r\nHost: app\r\n\r\n"
+	forward := func() (*ForwardResult, string) {
+		stream, connector := newTestExecStream(t, nil)
+		result, err := lf.ForwardRequest(context.Background(), stream, []byte(req))
+		if err != nil {
+			t.Fatalf("ForwardRequest failed: %v", err)
+		}
+		return result, string((<-connector.sendCh).Payload)
+	}
+
+	var want int64
+	for i := 0; i < 2; i++ {
+		result, _ := forward()
+		if result.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, result.StatusCode)
+		}
+		want += int64(len(req)+result.HeaderBytes) + result.BodyBytes
+	}
+	if usage := q.Usage(); usage.Requests != 2 || usage.Bytes != want {
+		t.Errorf("usage = %+v, want 2 requests and %d bytes", usage, want)
+	}
+
+	// Hết quota: 429, local service không được gọi và request không được tính
+	result, resp := forward()
+	if result.Source != SourceQuotaExceeded || !strings.HasPrefix(resp, "HTTP/1.1 429") || !strings.Contains(resp, "Retry-After: ") {
+		t.Errorf("request over quota: source %q, response %q", result.Source, resp)
+	}
+	if calls != 2 || q.Usage().Requests != 2 {
+		t.Errorf("local service called %d times, usage %+v; want 2 calls and 2 requests", calls, q.Usage())
+	}
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+// RateLimit là token bucket giới hạn requests/giây của một route. Khác frame
+// rate limit của Dispatcher (chờ trước khi đọc tiếp), request vượt RateLimit
+// bị từ chối ngay với 429 và Retry-After, không tới local service.
+type RateLimit struct {
+	mu     sync.Mutex
+	clock  clock.Clock
+	rate   float64 // requests mỗi giây
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimit tạo limit rate requests/giây cho phép burst requests liên tiếp
+// (burst <= 0 dùng rate, tối thiểu 1); rate <= 0 trả về nil (không giới hạn)
+func NewRateLimit(rate float64, burst int, c clock.Clock) *RateLimit {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if burst <= 0 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &RateLimit{
+		clock:  clock.Or(c),
+		rate:   rate,
+		burst:  b,
+		tokens: b,
+	}
+}
+
+// allow lấy một token cho request; khi hết token trả về false và thời gian tới
+// khi có token tiếp theo. Limit nil luôn cho phép.
+func (l *RateLimit) allow() (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// writeTooManyRequests ghi response 429 với Retry-After (giây, làm tròn lên)
+func (lf *LocalForwarder) writeTooManyRequests(w io.Writer, retryAfter time.Duration, body string) error {
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		StatusCode: http.StatusTooManyRequests,
+		Status:     "429 Too Many Requests",
+		Header:     make(http.Header),
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Retry-After", fmt.Sprint(int64(math.Ceil(retryAfter.Seconds()))))
+	if err := lf.writeResponseHeader(w, resp); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, body)
+	return err
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+func TestRateLimit_Allow(t *testing.T) {
+	mock := clock.NewMock(time.Unix(1000, 0))
+	l := NewRateLimit(2, 3, mock)
+
+	// Burst đi qua, request tiếp theo bị từ chối với thời gian tới token kế tiếp
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow(); !ok {
+			t.Fatalf("request %d within burst should be allowed", i+1)
+		}
+	}
+	if ok, retryAfter := l.allow(); ok || retryAfter != 500*time.Millisecond {
+		t.Errorf("request over the burst: allowed %v, retry after %s; want rejected, 500ms", ok, retryAfter)
+	}
+
+	// Request bị từ chối không tiêu token
+	mock.Advance(500 * time.Millisecond)
+	if ok, _ := l.allow(); !ok {
+		t.Error("request after one token refilled should be allowed")
+	}
+
+	if NewRateLimit(0, 10, mock) != nil {
+		t.Error("rate 0 should disable the limit")
+	}
+	var disabled *RateLimit
+	if ok, _ := disabled.allow(); !ok {
+		t.Error("nil limit should allow every request")
+	}
+}
+
+func TestLocalForwarder_RateLimit(t *testing.T) {
+	calls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer backend.Close()
+
+	mock := clock.NewMock(time.Unix(1000, 0))
+	lf := NewLocalForwarder(LocalForwarderOptions{Backends: []Backend{
+		{Host: "app", URL: backend.URL, RateLimit: NewRateLimit(0.5, 1, mock)},
+	}})
+	forward := func() (*ForwardResult, string) {
+		stream, connector := newTestExecStream(t, nil)
+		result, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: app\r\n\r\n"))
+		if err != nil {
+			t.Fatalf("ForwardRequest failed: %v", err)
+		}
+		return result, string((<-connector.sendCh).Payload)
+	}
+
+	if result, _ := forward(); result.StatusCode != http.StatusOK {
+		t.Fatalf("first request: status %d, want 200", result.StatusCode)
+	}
+	result, resp := forward()
+	if result.Source != SourceThrottled || !strings.HasPrefix(resp, "HTTP/1.1 429") || !strings.Contains(resp, "Retry-After: 2\r\n") {
+		t.Errorf("second request: source %q, response %q; want 429 with Retry-After: 2", result.Source, resp)
+	}
+	if calls != 1 {
+		t.Errorf("local service called %d times, want 1", calls)
+	}
+}
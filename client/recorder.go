@@ -0,0 +1,630 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Định dạng file record
+const (
+	// RecordNDJSON ghi mỗi exchange là một RecordedExchange JSON trên một dòng
+	RecordNDJSON = "ndjson"
+	// RecordHAR ghi HTTP Archive 1.2, mở được bằng browser devtools
+	RecordHAR = "har"
+)
+
+// defaultRecordMaxBody là số bytes body tối đa được ghi cho mỗi request/response
+const defaultRecordMaxBody = 64 << 10
+
+// Phần đầu và phần kết của file HAR, entries nằm giữa và cách nhau bởi ",\n"
+const (
+	harPreamble = `{"log":{"version":"1.2","creator":{"name":"tunnel-agent","version":""},"entries":[` + "\n"
+	harTrailer  = "\n]}}\n"
+)
+
+// redactedValue thay giá trị của headers và query params nhạy cảm
+const redactedValue = "[REDACTED]"
+
+// Headers và query params luôn bị redact khi record
+var (
+	defaultRedactHeaders = []string{
+		"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+		"X-Api-Key", "X-Auth-Token", "X-Hub-Signature-256", "Stripe-Signature",
+	}
+	defaultRedactQuery = []string{
+		"token", "access_token", "api_key", "apikey", "key", "password", "secret", "signature", "sig",
+	}
+)
+
+// RecorderOptions cấu hình Recorder
+type RecorderOptions struct {
+	// Format là RecordNDJSON (default) hoặc RecordHAR
+	Format string
+	// MaxBody là số bytes body tối đa được ghi (default 64 KiB), âm = không ghi body
+	MaxBody int64
+	// RedactHeaders và RedactQuery được thêm vào danh sách redact mặc định
+	RedactHeaders []string
+	RedactQuery   []string
+	// DryRun: requests được ghi lại và trả 202 mà không tới local service
+	DryRun bool
+	// Keep là số exchanges gần nhất giữ trong memory cho inspector (0 = không giữ)
+	Keep int
+}
+
+// Recorder ghi các request/response đã forward vào file để phân tích offline
+// hoặc replay bằng `agent bench -replay`. Giá trị của headers và query params
+// nhạy cảm bị thay bằng [REDACTED]; body chỉ được ghi tới MaxBody bytes.
+// Với Keep, các exchanges gần nhất còn được giữ trong memory (Recent).
+type Recorder struct {
+	mu      sync.Mutex
+	w       io.WriteCloser // nil khi chỉ giữ exchanges trong memory
+	format  string
+	maxBody int64
+	dryRun  bool
+	entries int
+	err     error // lỗi ghi đầu tiên; sau đó Recorder ngừng ghi
+
+	keep   int
+	recent []RecordedExchange // ring buffer, next là vị trí ghi tiếp theo
+	next   int
+
+	redactHeaders map[string]bool // canonical header names
+	redactQuery   map[string]bool // lower-case param names
+}
+
+// NewRecorder tạo Recorder ghi vào w; Close ghi phần kết của file HAR và đóng w.
+// w có thể nil khi opts.Keep > 0: exchanges chỉ được giữ trong memory.
+func NewRecorder(w io.WriteCloser, opts RecorderOptions) (*Recorder, error) {
+	if w == nil && opts.Keep <= 0 {
+		return nil, errors.New("recorder has neither a writer nor Keep")
+	}
+	switch opts.Format {
+	case "":
+		opts.Format = RecordNDJSON
+	case RecordNDJSON, RecordHAR:
+	default:
+		return nil, fmt.Errorf("unknown record format %q", opts.Format)
+	}
+	if opts.MaxBody == 0 {
+		opts.MaxBody = defaultRecordMaxBody
+	}
+	r := &Recorder{
+		w:             w,
+		format:        opts.Format,
+		maxBody:       max(opts.MaxBody, 0),
+		dryRun:        opts.DryRun,
+		keep:          max(opts.Keep, 0),
+		redactHeaders: make(map[string]bool),
+		redactQuery:   make(map[string]bool),
+	}
+	for _, name := range append(defaultRedactHeaders, opts.RedactHeaders...) {
+		r.redactHeaders[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+	}
+	for _, name := range append(defaultRedactQuery, opts.RedactQuery...) {
+		r.redactQuery[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	if w != nil && r.format == RecordHAR {
+		if _, err := io.WriteString(w, harPreamble); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Close kết thúc file và đóng writer
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return nil
+	}
+	if r.format == RecordHAR && r.err == nil {
+		if _, err := io.WriteString(r.w, harTrailer); err != nil {
+			r.w.Close()
+			return err
+		}
+	}
+	return r.w.Close()
+}
+
+// RecordedBody là body đã ghi; body không phải UTF-8 được encode base64
+type RecordedBody struct {
+	Body      string `json:"body,omitempty"`
+	Encoding  string `json:"body_encoding,omitempty"`
+	Size      int64  `json:"body_size"`
+	Truncated bool   `json:"body_truncated,omitempty"`
+}
+
+// Bytes trả về body đã decode
+func (b RecordedBody) Bytes() ([]byte, error) {
+	if b.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(b.Body)
+	}
+	return []byte(b.Body), nil
+}
+
+// RecordedRequest là request client gửi tới tunnel
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	Host   string      `json:"host"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header"`
+	RecordedBody
+}
+
+// RecordedResponse là response agent đã ghi vào stream
+type RecordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	RecordedBody
+}
+
+// RecordedExchange là một dòng của file NDJSON
+type RecordedExchange struct {
+	Time       time.Time        `json:"time"`
+	DurationMs float64          `json:"duration_ms"`
+	Source     string           `json:"source"`
+	Backend    string           `json:"backend,omitempty"`
+	Request    RecordedRequest  `json:"request"`
+	Response   RecordedResponse `json:"response"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// bodyBuffer giữ tối đa max bytes đầu của body và đếm tổng số bytes. Request
+// body được đọc trên goroutine của http.Transport nên cần mutex.
+type bodyBuffer struct {
+	mu   sync.Mutex
+	buf  []byte
+	max  int64
+	size int64
+}
+
+func (b *bodyBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.size += int64(len(p))
+	if room := b.max - int64(len(b.buf)); room > 0 {
+		b.buf = append(b.buf, p[:min(int64(len(p)), room)]...)
+	}
+	return len(p), nil
+}
+
+func (b *bodyBuffer) recorded() RecordedBody {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	body := RecordedBody{Size: b.size, Truncated: int64(len(b.buf)) < b.size}
+	if utf8.Valid(b.buf) {
+		body.Body = string(b.buf)
+	} else {
+		body.Body = base64.StdEncoding.EncodeToString(b.buf)
+		body.Encoding = "base64"
+	}
+	return body
+}
+
+// exchangeCapture gom dữ liệu của một exchange trong lúc forward
+type exchangeCapture struct {
+	request    RecordedRequest
+	respHeader http.Header
+	reqBody    bodyBuffer
+	respBody   bodyBuffer
+}
+
+// capture bắt đầu ghi một exchange với request đã parse; nil nếu không record
+func (r *Recorder) capture(method, host, path, query string, header http.Header) *exchangeCapture {
+	if r == nil {
+		return nil
+	}
+	c := &exchangeCapture{
+		request: RecordedRequest{
+			Method: method,
+			Host:   host,
+			Path:   path,
+			Query:  r.redactQueryString(query),
+			Header: r.redactHeader(header),
+		},
+	}
+	c.reqBody.max = r.maxBody
+	c.respBody.max = r.maxBody
+	return c
+}
+
+// redactHeader trả về bản sao của h với giá trị headers nhạy cảm bị thay
+func (r *Recorder) redactHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for key, values := range out {
+		if r.redactHeaders[http.CanonicalHeaderKey(key)] {
+			for i := range values {
+				values[i] = redactedValue
+			}
+		}
+	}
+	return out
+}
+
+// redactQueryString thay giá trị của query params nhạy cảm, giữ nguyên thứ tự
+func (r *Recorder) redactQueryString(query string) string {
+	if query == "" {
+		return ""
+	}
+	parts := strings.Split(query, "&")
+	for i, part := range parts {
+		name, _, hasValue := strings.Cut(part, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if hasValue && r.redactQuery[strings.ToLower(name)] {
+			parts[i] = part[:strings.Index(part, "=")+1] + url.QueryEscape(redactedValue)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// record ghi exchange đã hoàn tất
+func (r *Recorder) record(c *exchangeCapture, result *ForwardResult, forwardErr error) {
+	exchange := RecordedExchange{
+		Time:       result.Started,
+		DurationMs: float64(result.Duration.Microseconds()) / 1000,
+		Source:     result.Source,
+		Backend:    result.Backend,
+		Request:    c.request,
+		Response: RecordedResponse{
+			Status: result.StatusCode,
+			Header: r.redactHeader(c.respHeader),
+		},
+	}
+	exchange.Request.RecordedBody = c.reqBody.recorded()
+	exchange.Response.RecordedBody = c.respBody.recorded()
+	if forwardErr != nil {
+		exchange.Error = forwardErr.Error()
+	}
+
+	r.keepRecent(exchange)
+	if r.w == nil {
+		return
+	}
+
+	var entry any = exchange
+	if r.format == RecordHAR {
+		entry = harEntryFrom(exchange)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if r.format == RecordHAR && r.entries > 0 {
+		data = append([]byte(",\n"), data...)
+	} else if r.format == RecordNDJSON {
+		data = append(data, '\n')
+	}
+	if _, err := r.w.Write(data); err != nil {
+		r.err = err
+		return
+	}
+	r.entries++
+}
+
+// keepRecent thêm exchange vào ring buffer, bỏ exchange cũ nhất khi đầy
+func (r *Recorder) keepRecent(e RecordedExchange) {
+	if r.keep == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.recent) < r.keep {
+		r.recent = append(r.recent, e)
+		return
+	}
+	r.recent[r.next] = e
+	r.next = (r.next + 1) % r.keep
+}
+
+// Recent trả về các exchanges được giữ trong memory, cũ nhất trước
+func (r *Recorder) Recent() []RecordedExchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]RecordedExchange, 0, len(r.recent))
+	out = append(out, r.recent[r.next:]...)
+	return append(out, r.recent[:r.next]...)
+}
+
+// WriteHAR ghi exchanges thành một file HAR 1.2
+func WriteHAR(w io.Writer, exchanges []RecordedExchange) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(harPreamble)
+	for i, e := range exchanges {
+		data, err := json.Marshal(harEntryFrom(e))
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			bw.WriteString(",\n")
+		}
+		bw.Write(data)
+	}
+	bw.WriteString(harTrailer)
+	return bw.Flush()
+}
+
+// Err trả về lỗi ghi file đầu tiên, nil nếu chưa có
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// dryRunBody trả về body của request dry-run theo framing của request; body
+// có framing không hợp lệ chỉ gồm phần nằm trong initial payload
+func dryRunBody(stream *Stream, headers http.Header, initialBody []byte) io.Reader {
+	length, err := requestLength(headers)
+	switch {
+	case err != nil || length < 0 && headers.Get("Transfer-Encoding") == "":
+		return bytes.NewReader(initialBody)
+	case length >= 0:
+		return io.LimitReader(io.MultiReader(bytes.NewReader(initialBody), stream), length)
+	default:
+		return io.MultiReader(bytes.NewReader(initialBody), stream)
+	}
+}
+
+// writeDryRun ghi 202 cho request đã được record ở dry-run mode
+func (lf *LocalForwarder) writeDryRun(w io.Writer) error {
+	const body = "recorded (dry run)\n"
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		StatusCode: http.StatusAccepted,
+		Status:     "202 Accepted",
+		Header:     make(http.Header),
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	if err := lf.writeResponseHeader(w, resp); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, body)
+	return err
+}
+
+// HAR 1.2 (http://www.softwareishard.com/blog/har-12-spec/), chỉ các fields
+// agent ghi được
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	Cookies     []harNameValue `json:"cookies"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+	PostData    *harContent    `json:"postData,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Cookies     []harNameValue `json:"cookies"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	} `json:"timings"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	out := []harNameValue{}
+	for key, values := range h {
+		for _, value := range values {
+			out = append(out, harNameValue{Name: key, Value: value})
+		}
+	}
+	return out
+}
+
+// harEntryFrom chuyển exchange thành HAR entry; source của agent nằm trong comment
+func harEntryFrom(e RecordedExchange) harEntry {
+	u := url.URL{Scheme: "http", Host: e.Request.Host, Path: e.Request.Path, RawQuery: e.Request.Query}
+	entry := harEntry{
+		StartedDateTime: e.Time.Format(time.RFC3339Nano),
+		Time:            e.DurationMs,
+		Request: harRequest{
+			Method:      e.Request.Method,
+			URL:         u.String(),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     harHeaders(e.Request.Header),
+			QueryString: []harNameValue{},
+			Cookies:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    e.Request.Size,
+		},
+		Response: harResponse{
+			Status:      e.Response.Status,
+			StatusText:  http.StatusText(e.Response.Status),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     harHeaders(e.Response.Header),
+			Cookies:     []harNameValue{},
+			Content: harContent{
+				Size:     e.Response.Size,
+				MimeType: e.Response.Header.Get("Content-Type"),
+				Text:     e.Response.Body,
+				Encoding: e.Response.Encoding,
+			},
+			HeadersSize: -1,
+			BodySize:    e.Response.Size,
+		},
+		Comment: e.Source,
+	}
+	entry.Timings.Wait = e.DurationMs
+	if values, err := url.ParseQuery(e.Request.Query); err == nil {
+		for name, vs := range values {
+			for _, v := range vs {
+				entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: name, Value: v})
+			}
+		}
+	}
+	if e.Request.Size > 0 {
+		entry.Request.PostData = &harContent{
+			Size:     e.Request.Size,
+			MimeType: e.Request.Header.Get("Content-Type"),
+			Text:     e.Request.Body,
+			Encoding: e.Request.Encoding,
+		}
+	}
+	return entry
+}
+
+// exchange chuyển HAR entry về RecordedExchange
+func (h harEntry) exchange() (RecordedExchange, error) {
+	u, err := url.Parse(h.Request.URL)
+	if err != nil {
+		return RecordedExchange{}, err
+	}
+	started, _ := time.Parse(time.RFC3339Nano, h.StartedDateTime)
+	e := RecordedExchange{
+		Time:       started,
+		DurationMs: h.Time,
+		Source:     h.Comment,
+		Request: RecordedRequest{
+			Method: h.Request.Method,
+			Host:   u.Host,
+			Path:   u.Path,
+			Query:  u.RawQuery,
+			Header: make(http.Header),
+		},
+		Response: RecordedResponse{Status: h.Response.Status, Header: make(http.Header)},
+	}
+	for _, nv := range h.Request.Headers {
+		e.Request.Header.Add(nv.Name, nv.Value)
+	}
+	for _, nv := range h.Response.Headers {
+		e.Response.Header.Add(nv.Name, nv.Value)
+	}
+	if p := h.Request.PostData; p != nil {
+		e.Request.RecordedBody = RecordedBody{Body: p.Text, Encoding: p.Encoding, Size: h.Request.BodySize}
+	}
+	e.Response.RecordedBody = RecordedBody{Body: h.Response.Content.Text, Encoding: h.Response.Content.Encoding, Size: h.Response.Content.Size}
+	return e, nil
+}
+
+// ReadRecording đọc file do Recorder ghi, NDJSON hoặc HAR (cả file HAR chưa
+// được Close, thiếu phần kết)
+func ReadRecording(r io.Reader) ([]RecordedExchange, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(16)
+	if bytes.HasPrefix(bytes.TrimSpace(head), []byte(`{"log"`)) {
+		return readHAR(br)
+	}
+
+	var exchanges []RecordedExchange
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e RecordedExchange
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges, scanner.Err()
+}
+
+// readHAR đọc entries của HAR theo từng entry, nên file bị cắt (agent dừng
+// đột ngột) vẫn đọc được các entries đầy đủ
+func readHAR(r io.Reader) ([]RecordedExchange, error) {
+	dec := json.NewDecoder(r)
+	// {"log": {... "entries": [
+	for depth := 0; ; {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("HAR without entries: %w", err)
+		}
+		switch tok {
+		case json.Delim('{'):
+			depth++
+		case json.Delim('}'):
+			depth--
+		}
+		if tok == "entries" && depth == 2 {
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+				return nil, errors.New("HAR entries is not an array")
+			}
+			break
+		}
+	}
+
+	var exchanges []RecordedExchange
+	for dec.More() {
+		var entry harEntry
+		if err := dec.Decode(&entry); err != nil {
+			if truncatedJSON(err) {
+				break
+			}
+			return nil, fmt.Errorf("entry %d: %w", len(exchanges)+1, err)
+		}
+		e, err := entry.exchange()
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", len(exchanges)+1, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges, nil
+}
+
+// truncatedJSON cho biết input kết thúc giữa chừng: sau entry cuối (Decoder
+// báo SyntaxError) hoặc trong một entry đang ghi dở
+func truncatedJSON(err error) bool {
+	var syntax *json.SyntaxError
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &syntax) && syntax.Error() == "unexpected end of JSON input"
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// recordBuffer là io.WriteCloser trong memory cho Recorder
+type recordBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *recordBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+// forwardRecorded forward request (body nằm hết trong payload) qua lf
+func forwardRecorded(t *testing.T, lf *LocalForwarder, req string) *ForwardResult {
+	t.Helper()
+	stream, _ := newTestExecStream(t, nil)
+	close(stream.dataOut)
+	result, err := lf.ForwardRequest(context.Background(), stream, []byte(req))
+	if err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+	return result
+}
+
+func TestRecorder_NDJSON(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Write(append([]byte("echo:"), body...))
+	}))
+	defer backend.Close()
+
+	buf := &recordBuffer{}
+	recorder, err := NewRecorder(buf, RecorderOptions{RedactHeaders: []string{"x-tenant"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: backend.URL, Recorder: recorder})
+	forwardRecorded(t, lf, "POST /api?token=abc&x=1 HTTP/1.1\r\nHost: app\r\nAuthorization: Bearer s3cret\r\nX-Tenant: acme\r\nContent-Length: 5\r\n\r\nhello")
+	if err := recorder.Close(); err != nil || !buf.closed {
+		t.Fatalf("Close: %v, closed %v", err, buf.closed)
+	}
+
+	exchanges, err := ReadRecording(bytes.NewReader(buf.Bytes()))
+	if err != nil || len(exchanges) != 1 {
+		t.Fatalf("ReadRecording = %d exchanges, %v; want 1", len(exchanges), err)
+	}
+	e := exchanges[0]
+	if e.Source != SourceLocal || e.Backend != backend.URL {
+		t.Errorf("source %q backend %q", e.Source, e.Backend)
+	}
+	req := e.Request
+	if req.Method != "POST" || req.Host != "app" || req.Path != "/api" || req.Query != "token=%5BREDACTED%5D&x=1" {
+		t.Errorf("request = %s %s %s ?%s", req.Method, req.Host, req.Path, req.Query)
+	}
+	if got := req.Header.Get("Authorization"); got != redactedValue {
+		t.Errorf("Authorization = %q, want redacted", got)
+	}
+	if got := req.Header.Get("X-Tenant"); got != redactedValue {
+		t.Errorf("X-Tenant = %q, want redacted", got)
+	}
+	if req.Body != "hello" || req.Size != 5 {
+		t.Errorf("request body = %q (%d bytes)", req.Body, req.Size)
+	}
+	resp := e.Response
+	if resp.Status != http.StatusOK || resp.Body != "echo:hello" || resp.Header.Get("Set-Cookie") != redactedValue {
+		t.Errorf("response = %d %q, Set-Cookie %q", resp.Status, resp.Body, resp.Header.Get("Set-Cookie"))
+	}
+}
+
+func TestRecorder_HAR(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer backend.Close()
+
+	buf := &recordBuffer{}
+	recorder, err := NewRecorder(buf, RecorderOptions{Format: RecordHAR, MaxBody: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: backend.URL, Recorder: recorder})
+	forwardRecorded(t, lf, "GET /a HTTP/1.1\r\nHost: app\r\n\r\n")
+	forwardRecorded(t, lf, "POST /b HTTP/1.1\r\nHost: app\r\nContent-Length: 6\r\n\r\n\xff\x00abcd")
+
+	// Entries đọc được cả khi file chưa được Close
+	exchanges, err := ReadRecording(bytes.NewReader(buf.Bytes()))
+	if err != nil || len(exchanges) != 2 {
+		t.Fatalf("ReadRecording before Close = %d exchanges, %v; want 2", len(exchanges), err)
+	}
+	recorder.Close()
+	if !json.Valid(buf.Bytes()) {
+		t.Fatalf("HAR is not valid JSON:\n%s", buf.String())
+	}
+	exchanges, err = ReadRecording(bytes.NewReader(buf.Bytes()))
+	if err != nil || len(exchanges) != 2 {
+		t.Fatalf("ReadRecording = %d exchanges, %v; want 2", len(exchanges), err)
+	}
+
+	if e := exchanges[0]; e.Request.Path != "/a" || e.Response.Status != http.StatusOK || e.Source != SourceLocal {
+		t.Errorf("first entry = %+v", e)
+	}
+	e := exchanges[1]
+	body, err := e.Request.Bytes()
+	if err != nil || !bytes.Equal(body, []byte("\xff\x00ab")) || e.Request.Size != 6 {
+		t.Errorf("binary request body = %q (%d bytes), %v; want first 4 of 6 bytes", body, e.Request.Size, err)
+	}
+	if e.Response.Size != 6 {
+		t.Errorf("response body size = %d, want 6", e.Response.Size)
+	}
+}
+
+func TestRecorder_DryRun(t *testing.T) {
+	calls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer backend.Close()
+
+	buf := &recordBuffer{}
+	recorder, err := NewRecorder(buf, RecorderOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: backend.URL, Recorder: recorder})
+	result := forwardRecorded(t, lf, "PUT /items/1 HTTP/1.1\r\nHost: app\r\nContent-Length: 7\r\n\r\n{\"a\":1}")
+	if result.Source != SourceDryRun || result.StatusCode != http.StatusAccepted || calls != 0 {
+		t.Fatalf("dry run: source %q, status %d, local calls %d", result.Source, result.StatusCode, calls)
+	}
+
+	exchanges, err := ReadRecording(bytes.NewReader(buf.Bytes()))
+	if err != nil || len(exchanges) != 1 {
+		t.Fatalf("ReadRecording = %d exchanges, %v; want 1", len(exchanges), err)
+	}
+	if e := exchanges[0]; e.Request.Body != `{"a":1}` || e.Response.Status != http.StatusAccepted {
+		t.Errorf("recorded = %+v", e)
+	}
+}
+
+func TestRecorder_RecentHAR(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	if _, err := NewRecorder(nil, RecorderOptions{}); err == nil {
+		t.Error("NewRecorder without writer and Keep succeeded")
+	}
+	recorder, err := NewRecorder(nil, RecorderOptions{Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: backend.URL, Recorder: recorder})
+	for _, path := range []string{"/1", "/2", "/3"} {
+		forwardRecorded(t, lf, "GET "+path+" HTTP/1.1\r\nHost: app\r\n\r\n")
+	}
+
+	// Ring buffer giữ 2 exchanges gần nhất, cũ nhất trước
+	recent := recorder.Recent()
+	if len(recent) != 2 || recent[0].Request.Path != "/2" || recent[1].Request.Path != "/3" {
+		t.Fatalf("Recent = %+v, want /2 and /3", recent)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHAR(&buf, recent); err != nil {
+		t.Fatal(err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		t.Fatalf("HAR is not valid JSON:\n%s", buf.String())
+	}
+	exchanges, err := ReadRecording(&buf)
+	if err != nil || len(exchanges) != 2 || exchanges[1].Request.Path != "/3" {
+		t.Errorf("ReadRecording = %+v, %v", exchanges, err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Errorf("Close without writer: %v", err)
+	}
+}
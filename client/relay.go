@@ -0,0 +1,103 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+// isUpgradeRequest kiểm tra request có xin chuyển protocol (WebSocket, h2c, ...)
+// không: có Upgrade header và Connection chứa token "upgrade"
+func isUpgradeRequest(headers http.Header) bool {
+	if headers.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range headers.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// relayClient trả về client cho upgrade requests: connection luôn được dial
+// mới (không lấy từ keep-alive pool) và không có Client.Timeout, vì connection
+// sống cùng stream chứ không theo timeout của một request
+func relayClient(base *http.Client) *http.Client {
+	c := freshClient(base)
+	c.Timeout = 0
+	return c
+}
+
+// relayUpgrade ghi 101 response về Core rồi relay data hai chiều giữa stream và
+// connection của local service. Connection thuộc riêng stream: nó được đóng khi
+// stream đóng (FrameClose/EndStream từ Core) hoặc khi local service đóng nó.
+// earlyData là bytes client gửi ngay sau request headers.
+func (lf *LocalForwarder) relayUpgrade(stream *Stream, out *resultWriter, resp *http.Response, earlyData []byte) error {
+	local, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return fmt.Errorf("local service switched protocols on a read-only connection")
+	}
+	defer local.Close()
+	metrics.GetMetrics().IncrementPinnedConns()
+	defer metrics.GetMetrics().DecrementPinnedConnsActive()
+
+	normalizeFraming(resp, http.MethodGet)
+	// Recorder chỉ giữ request và 101 response, không giữ data sau upgrade
+	out.capture = nil
+	if err := lf.writeResponseHeader(out, resp); err != nil {
+		return fmt.Errorf("failed to write response headers: %w", err)
+	}
+	metrics.GetMetrics().IncrementRequestsSuccess()
+
+	// Stream đóng thì connection cũng đóng, giải phóng cả hai chiều copy
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stream.CloseCh():
+			local.Close()
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Client → local service
+	go func() {
+		io.Copy(local, io.MultiReader(bytes.NewReader(earlyData), stream))
+		local.Close()
+	}()
+
+	// Local service → client, chờ send queue thay vì bỏ data khi queue đầy
+	out.w = streamWriter{ctx: ctx, stream: stream}
+	_, err := io.Copy(out, local)
+	select {
+	case <-stream.CloseCh():
+		return nil
+	default:
+	}
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("failed to relay upgraded connection: %w", err)
+	}
+	return nil
+}
+
+// streamWriter ghi vào stream bằng WriteContext
+type streamWriter struct {
+	ctx    context.Context
+	stream *Stream
+}
+
+func (w streamWriter) Write(p []byte) (int, error) {
+	// WriteContext giữ p tới khi writeLoop ghi xong
+	return w.stream.WriteContext(w.ctx, append([]byte(nil), p...))
+}
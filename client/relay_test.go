@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+// echoUpgradeServer trả 101 rồi echo lại mọi dòng client gửi trên connection
+func echoUpgradeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isUpgradeRequest(r.Header) {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		rw.Flush()
+		for {
+			line, err := rw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			rw.WriteString("echo " + line)
+			rw.Flush()
+		}
+	}))
+}
+
+func TestLocalForwarder_RelaysUpgradedConnection(t *testing.T) {
+	backend := echoUpgradeServer(t)
+	defer backend.Close()
+
+	connector := NewConnector("test", ConnectorOptions{})
+	connector.connected = true
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+	stream, _ := sm.CreateStream(1)
+	lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: backend.URL, Timeout: time.Second})
+
+	pinned := metrics.GetMetrics().GetSnapshot().PinnedConnsActive
+	done := make(chan error, 1)
+	go func() {
+		_, err := lf.ForwardRequest(context.Background(), stream,
+			[]byte("GET /ws HTTP/1.1\r\nHost: a\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\nfirst\n"))
+		done <- err
+	}()
+
+	// Early data và data gửi sau upgrade đều tới local service
+	var resp strings.Builder
+	readUntil := func(want string) {
+		t.Helper()
+		deadline := time.After(5 * time.Second)
+		for !strings.Contains(resp.String(), want) {
+			select {
+			case frame := <-connector.sendCh:
+				resp.Write(frame.Payload)
+			case <-deadline:
+				t.Fatalf("response missing %q:\n%s", want, resp.String())
+			}
+		}
+	}
+	readUntil("echo first\n")
+	if !strings.HasPrefix(resp.String(), "HTTP/1.1 101 ") {
+		t.Errorf("response does not start with 101:\n%s", resp.String())
+	}
+	stream.Deliver([]byte("second\n"))
+	readUntil("echo second\n")
+
+	// Connection được giữ tới khi stream đóng và chỉ thuộc về stream này
+	if got := metrics.GetMetrics().GetSnapshot().PinnedConnsActive; got != pinned+1 {
+		t.Errorf("pinned connections = %d during relay, want %d", got, pinned+1)
+	}
+	sm.CloseStream(1)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ForwardRequest after stream close: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not stop after the stream was closed")
+	}
+	if got := metrics.GetMetrics().GetSnapshot().PinnedConnsActive; got != pinned {
+		t.Errorf("pinned connections = %d after close, want %d", got, pinned)
+	}
+}
+
+func TestIsUpgradeRequest(t *testing.T) {
+	h := http.Header{}
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "keep-alive, Upgrade")
+	if !isUpgradeRequest(h) {
+		t.Error("Connection: keep-alive, Upgrade should be an upgrade request")
+	}
+	h.Set("Connection", "keep-alive")
+	if isUpgradeRequest(h) {
+		t.Error("Upgrade without the Connection token should not be an upgrade request")
+	}
+}
@@ -0,0 +1,46 @@
+package client
+
+import "net/http"
+
+// SecurityHeaders là các security headers được thêm khi bật preset, chỉ khi local
+// service chưa tự đặt
+var SecurityHeaders = map[string]string{
+	"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+	"X-Content-Type-Options":    "nosniff",
+	"X-Frame-Options":           "DENY",
+	"Referrer-Policy":           "strict-origin-when-cross-origin",
+}
+
+// HeaderRules sửa headers của mỗi response trước khi gửi về client public.
+// Các bước chạy theo thứ tự: Remove, Defaults, Set, Add.
+type HeaderRules struct {
+	// Remove xoá headers (ví dụ Server, X-Powered-By)
+	Remove []string
+
+	// Defaults thêm headers khi response chưa có
+	Defaults map[string]string
+
+	// Set ghi đè headers
+	Set map[string]string
+
+	// Add nối thêm giá trị vào headers
+	Add map[string]string
+}
+
+// Apply áp dụng rules lên h
+func (r HeaderRules) Apply(h http.Header) {
+	for _, key := range r.Remove {
+		h.Del(key)
+	}
+	for key, value := range r.Defaults {
+		if h.Get(key) == "" {
+			h.Set(key, value)
+		}
+	}
+	for key, value := range r.Set {
+		h.Set(key, value)
+	}
+	for key, value := range r.Add {
+		h.Add(key, value)
+	}
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Default response limits
+const (
+	defaultMaxResponseHeaderBytes = 1 << 20
+	defaultMaxResponseHeaders     = 100
+	defaultMaxDecompressedSize    = 100 << 20
+)
+
+// ResponseLimits bảo vệ bộ nhớ của agent khỏi local services misbehaving hoặc bị
+// compromise (gzip bombs, slow-loris). Zero value của mỗi field dùng default,
+// giá trị âm tắt limit.
+type ResponseLimits struct {
+	// MaxHeaderBytes giới hạn tổng kích thước response headers (default 1 MiB).
+	// Chỉ áp dụng cho default transport.
+	MaxHeaderBytes int64
+
+	// MaxHeaders giới hạn số response headers (default 100)
+	MaxHeaders int
+
+	// MaxDecompressedSize giới hạn body sau khi transport tự giải nén gzip (default 100 MiB)
+	MaxDecompressedSize int64
+
+	// HeaderTimeout là thời gian tối đa chờ response headers (default: tắt)
+	HeaderTimeout time.Duration
+
+	// ReadTimeout là tổng thời gian tối đa đọc response body, tính từ khi có headers
+	// (default: tắt, chỉ request timeout áp dụng)
+	ReadTimeout time.Duration
+
+	// IdleTimeout là thời gian tối đa một lần đọc body bị block chờ local service
+	// (default: tắt). Backpressure từ tunnel không tính vào idle.
+	IdleTimeout time.Duration
+}
+
+// withDefaults trả về limits với default cho các field zero
+func (l ResponseLimits) withDefaults() ResponseLimits {
+	if l.MaxHeaderBytes == 0 {
+		l.MaxHeaderBytes = defaultMaxResponseHeaderBytes
+	}
+	if l.MaxHeaders == 0 {
+		l.MaxHeaders = defaultMaxResponseHeaders
+	}
+	if l.MaxDecompressedSize == 0 {
+		l.MaxDecompressedSize = defaultMaxDecompressedSize
+	}
+	return l
+}
+
+// guardedBody bọc response body: giới hạn kích thước sau giải nén và huỷ request
+// khi đọc quá ReadTimeout hoặc một lần đọc bị block quá IdleTimeout
+type guardedBody struct {
+	body      io.ReadCloser
+	remaining int64 // < 0 = không giới hạn
+	cancel    context.CancelCauseFunc
+	idle      *time.Timer
+	idleAfter time.Duration
+	total     *time.Timer
+}
+
+// guardResponse kiểm tra headers của resp và bọc body theo limits.
+// cancel huỷ context của request với cause là lỗi limit.
+func guardResponse(resp *http.Response, limits ResponseLimits, cancel context.CancelCauseFunc) error {
+	if limits.MaxHeaders > 0 && len(resp.Header) > limits.MaxHeaders {
+		return ErrTooManyResponseHeaders
+	}
+
+	g := &guardedBody{body: resp.Body, remaining: -1, cancel: cancel, idleAfter: limits.IdleTimeout}
+	if resp.Uncompressed && limits.MaxDecompressedSize > 0 {
+		g.remaining = limits.MaxDecompressedSize
+	}
+	if limits.ReadTimeout > 0 {
+		g.total = time.AfterFunc(limits.ReadTimeout, func() { cancel(ErrResponseReadTimeout) })
+	}
+	if limits.IdleTimeout > 0 {
+		g.idle = time.AfterFunc(limits.IdleTimeout, func() { cancel(ErrResponseIdleTimeout) })
+		g.idle.Stop()
+	}
+	resp.Body = g
+	return nil
+}
+
+func (g *guardedBody) Read(p []byte) (int, error) {
+	if g.remaining == 0 {
+		// Đọc thử 1 byte để phân biệt body vừa đúng limit với body vượt limit
+		var probe [1]byte
+		if n, _ := g.body.Read(probe[:]); n > 0 {
+			g.cancel(ErrResponseTooLarge)
+			return 0, ErrResponseTooLarge
+		}
+		return 0, io.EOF
+	}
+	if g.remaining > 0 && int64(len(p)) > g.remaining {
+		p = p[:g.remaining]
+	}
+
+	if g.idle != nil {
+		g.idle.Reset(g.idleAfter)
+	}
+	n, err := g.body.Read(p)
+	if g.idle != nil {
+		g.idle.Stop()
+	}
+	if g.remaining > 0 {
+		g.remaining -= int64(n)
+	}
+	return n, err
+}
+
+func (g *guardedBody) Close() error {
+	if g.total != nil {
+		g.total.Stop()
+	}
+	if g.idle != nil {
+		g.idle.Stop()
+	}
+	return g.body.Close()
+}
+
+// limitError trả về lỗi limit nếu request bị huỷ bởi một response limit, ngược lại err
+func limitError(ctx context.Context, err error) error {
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, ErrResponseHeaderTimeout),
+		errors.Is(cause, ErrResponseReadTimeout),
+		errors.Is(cause, ErrResponseIdleTimeout),
+		errors.Is(cause, ErrResponseTooLarge):
+		return cause
+	default:
+		return err
+	}
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// getGuarded gửi GET tới url và bọc response theo limits như ForwardRequest
+func getGuarded(t *testing.T, url string, limits ResponseLimits) (*http.Response, context.Context, error) {
+	t.Helper()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	t.Cleanup(func() { cancel(nil) })
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, ctx, guardResponse(resp, limits.withDefaults(), cancel)
+}
+
+func TestGuardResponseDecompressedSize(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(make([]byte, 1<<20))
+	zw.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed.Bytes())
+	}))
+	defer srv.Close()
+
+	resp, ctx, err := getGuarded(t, srv.URL, ResponseLimits{MaxDecompressedSize: 64 << 10})
+	if err != nil {
+		t.Fatalf("guardResponse: %v", err)
+	}
+	if !resp.Uncompressed {
+		t.Fatal("expected transport to decompress the body")
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("expected ErrResponseTooLarge, got %v", err)
+	}
+	if n != 64<<10 {
+		t.Errorf("expected %d bytes before the limit, got %d", 64<<10, n)
+	}
+	if !errors.Is(limitError(ctx, err), ErrResponseTooLarge) {
+		t.Error("expected request context to carry the limit cause")
+	}
+
+	// Body vừa đúng limit không bị coi là vượt
+	resp, _, _ = getGuarded(t, srv.URL, ResponseLimits{MaxDecompressedSize: 1 << 20})
+	if n, err := io.Copy(io.Discard, resp.Body); err != nil || n != 1<<20 {
+		t.Errorf("expected full body at the limit, got %d bytes, err %v", n, err)
+	}
+}
+
+func TestGuardResponseTooManyHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 20; i++ {
+			w.Header().Set("X-Header-"+strconv.Itoa(i), "v")
+		}
+	}))
+	defer srv.Close()
+
+	if _, _, err := getGuarded(t, srv.URL, ResponseLimits{MaxHeaders: 10}); !errors.Is(err, ErrTooManyResponseHeaders) {
+		t.Errorf("expected ErrTooManyResponseHeaders, got %v", err)
+	}
+	if _, _, err := getGuarded(t, srv.URL, ResponseLimits{MaxHeaders: -1}); err != nil {
+		t.Errorf("expected disabled limit to pass, got %v", err)
+	}
+}
+
+func TestGuardResponseIdleTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	resp, ctx, err := getGuarded(t, srv.URL, ResponseLimits{IdleTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("guardResponse: %v", err)
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	if err == nil {
+		t.Fatal("expected stalled body to fail")
+	}
+	if !errors.Is(limitError(ctx, err), ErrResponseIdleTimeout) {
+		t.Errorf("expected ErrResponseIdleTimeout, got %v", limitError(ctx, err))
+	}
+}
+
+func TestGuardResponseReadTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Gửi từng byte đủ nhanh để không idle nhưng tổng thời gian vượt ReadTimeout
+		for i := 0; i < 100; i++ {
+			if _, err := w.Write([]byte("x")); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	resp, ctx, err := getGuarded(t, srv.URL, ResponseLimits{ReadTimeout: 100 * time.Millisecond, IdleTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("guardResponse: %v", err)
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	if !errors.Is(limitError(ctx, err), ErrResponseReadTimeout) {
+		t.Errorf("expected ErrResponseReadTimeout, got %v", limitError(ctx, err))
+	}
+}
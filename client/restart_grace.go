@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+const (
+	// restartRampStart là khoảng chờ đầu tiên trước khi dial lại local service
+	// đang refuse connections; mỗi lần sau gấp đôi tới restartRampMax
+	restartRampStart = 50 * time.Millisecond
+	restartRampMax   = time.Second
+)
+
+// LocalState là trạng thái của một local service address theo các lần dial
+type LocalState int
+
+const (
+	// LocalUp: dial thành công (lại) sau khi bị refuse
+	LocalUp LocalState = iota
+	// LocalRestarting: address refuse connections, đang trong grace period
+	LocalRestarting
+	// LocalDown: address vẫn refuse connections sau grace period
+	LocalDown
+)
+
+// String trả về tên của state
+func (s LocalState) String() string {
+	switch s {
+	case LocalRestarting:
+		return "restarting"
+	case LocalDown:
+		return "down"
+	default:
+		return "up"
+	}
+}
+
+// restartDialer bọc dial để local service restart (deploy, crash loop ngắn)
+// không làm requests thất bại: connection refused trong grace period được dial
+// lại với khoảng chờ tăng dần. Dial thất bại trước khi request được gửi nên
+// retry an toàn với mọi method và body. Sau grace period address được coi là
+// down và requests thất bại ngay cho tới khi dial lại thành công.
+type restartDialer struct {
+	dial    func(ctx context.Context, network, addr string) (net.Conn, error)
+	grace   time.Duration
+	onState func(addr string, state LocalState)
+
+	mu      sync.Mutex
+	refused map[string]*refusal // address -> lần refuse đầu tiên
+}
+
+// refusal là chuỗi connection refused liên tiếp của một address
+type refusal struct {
+	since time.Time
+	down  bool
+}
+
+func newRestartDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error), grace time.Duration, onState func(addr string, state LocalState)) *restartDialer {
+	return &restartDialer{
+		dial:    dial,
+		grace:   grace,
+		onState: onState,
+		refused: make(map[string]*refusal),
+	}
+}
+
+// DialContext dial addr, chờ local service đang restart tối đa hết grace period
+func (d *restartDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	delay := restartRampStart
+	for {
+		conn, err := d.dial(ctx, network, addr)
+		if err == nil {
+			d.up(addr)
+			return conn, nil
+		}
+		if !isConnRefused(err) {
+			return nil, err
+		}
+		remaining := d.refuse(addr)
+		if remaining <= 0 {
+			return nil, err
+		}
+
+		wait := min(delay, remaining)
+		metrics.GetMetrics().IncrementLocalDialRetries()
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+		delay = min(delay*2, restartRampMax)
+	}
+}
+
+// refuse ghi nhận connection refused của addr, trả về phần grace period còn lại
+func (d *restartDialer) refuse(addr string) time.Duration {
+	d.mu.Lock()
+	r, ok := d.refused[addr]
+	if !ok {
+		r = &refusal{since: time.Now()}
+		d.refused[addr] = r
+	}
+	remaining := d.grace - time.Since(r.since)
+	down := remaining <= 0 && !r.down
+	if down {
+		r.down = true
+	}
+	d.mu.Unlock()
+
+	switch {
+	case !ok:
+		logger.Warn("Local service refusing connections, waiting for it to restart", "addr", addr, "grace", d.grace)
+		d.notify(addr, LocalRestarting)
+	case down:
+		logger.Error("Local service still refusing connections after the restart grace period", "addr", addr, "grace", d.grace)
+		d.notify(addr, LocalDown)
+	}
+	return remaining
+}
+
+// up xoá trạng thái refused của addr sau khi dial thành công
+func (d *restartDialer) up(addr string) {
+	d.mu.Lock()
+	r, ok := d.refused[addr]
+	delete(d.refused, addr)
+	d.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	downtime := time.Since(r.since)
+	if !r.down {
+		metrics.GetMetrics().IncrementLocalRestarts()
+	}
+	logger.Info("Local service accepting connections again", "addr", addr, "downtime", downtime.Round(time.Millisecond))
+	d.notify(addr, LocalUp)
+}
+
+func (d *restartDialer) notify(addr string, state LocalState) {
+	if d.onState != nil {
+		d.onState(addr, state)
+	}
+}
+
+// isConnRefused kiểm tra lỗi dial là local service không listen trên port
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
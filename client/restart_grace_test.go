@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stateLog ghi lại các lần OnLocalState được gọi
+type stateLog struct {
+	mu     sync.Mutex
+	states []LocalState
+}
+
+func (l *stateLog) record(addr string, state LocalState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.states = append(l.states, state)
+}
+
+func (l *stateLog) get() []LocalState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]LocalState(nil), l.states...)
+}
+
+func TestRestartDialer_WaitsForRestart(t *testing.T) {
+	addr := closedAddr(t)
+	var log stateLog
+	d := newRestartDialer((&net.Dialer{}).DialContext, 5*time.Second, log.record)
+
+	// Local service listen lại sau một lúc, như sau deploy
+	restarted := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("relisten %s: %v", addr, err)
+		}
+		restarted <- listener
+	}()
+
+	conn, err := d.DialContext(context.Background(), "tcp", addr)
+	if listener := <-restarted; listener != nil {
+		defer listener.Close()
+	}
+	if err != nil {
+		t.Fatalf("dial during restart failed: %v", err)
+	}
+	conn.Close()
+
+	if states := log.get(); len(states) != 2 || states[0] != LocalRestarting || states[1] != LocalUp {
+		t.Errorf("states = %v, want [restarting up]", states)
+	}
+}
+
+func TestRestartDialer_DownAfterGrace(t *testing.T) {
+	addr := closedAddr(t)
+	var log stateLog
+	d := newRestartDialer((&net.Dialer{}).DialContext, 150*time.Millisecond, log.record)
+
+	start := time.Now()
+	if _, err := d.DialContext(context.Background(), "tcp", addr); !isConnRefused(err) {
+		t.Fatalf("got %v, want connection refused", err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("gave up after %s, before the grace period", elapsed)
+	}
+
+	// Đã down: dial kế tiếp thất bại ngay, không chờ thêm grace period
+	start = time.Now()
+	if _, err := d.DialContext(context.Background(), "tcp", addr); !isConnRefused(err) {
+		t.Fatalf("got %v, want connection refused", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("dial to a down service waited %s", elapsed)
+	}
+	if states := log.get(); len(states) != 2 || states[0] != LocalRestarting || states[1] != LocalDown {
+		t.Errorf("states = %v, want [restarting down]", states)
+	}
+
+	// Local service quay lại: dial thành công và state trở về up
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conn, err := d.DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatalf("dial after recovery: %v", err)
+	}
+	conn.Close()
+	if states := log.get(); len(states) != 3 || states[2] != LocalUp {
+		t.Errorf("states = %v, want up after recovery", states)
+	}
+}
+
+func TestRestartDialer_ContextCancel(t *testing.T) {
+	addr := closedAddr(t)
+	d := newRestartDialer((&net.Dialer{}).DialContext, time.Minute, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := d.DialContext(ctx, "tcp", addr); err == nil {
+		t.Fatal("dial succeeded without a listener")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("dial ignored the request context for %s", elapsed)
+	}
+}
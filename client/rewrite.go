@@ -0,0 +1,56 @@
+package client
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Rewrite viết lại path của request trước khi forward tới local service.
+// Các bước chạy theo thứ tự: StripPrefix, Regex, AddPrefix; zero value giữ nguyên path.
+type Rewrite struct {
+	// StripPrefix bỏ prefix khỏi path (ví dụ "/service-a": /service-a/x -> /x)
+	StripPrefix string
+
+	// Regex và Replacement viết lại path bằng regexp.ReplaceAllString
+	// (Replacement hỗ trợ $1, ${name})
+	Regex       *regexp.Regexp
+	Replacement string
+
+	// AddPrefix thêm prefix vào path (ví dụ "/api": /x -> /api/x)
+	AddPrefix string
+}
+
+// Apply trả về path sau khi viết lại; path đã viết lại luôn bắt đầu bằng "/"
+func (r Rewrite) Apply(path string) string {
+	if r == (Rewrite{}) {
+		return path
+	}
+	if r.StripPrefix != "" {
+		prefix := strings.TrimRight(r.StripPrefix, "/")
+		if hasPathPrefix(path, prefix) {
+			path = strings.TrimPrefix(path, prefix)
+		}
+	}
+	if r.Regex != nil {
+		path = r.Regex.ReplaceAllString(path, r.Replacement)
+	}
+	if r.AddPrefix != "" {
+		path = strings.TrimRight(r.AddPrefix, "/") + "/" + strings.TrimLeft(path, "/")
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// hasPathPrefix kiểm tra path nằm dưới prefix theo ranh giới segment:
+// "/api" khớp "/api" và "/api/x" nhưng không khớp "/apix"
+func hasPathPrefix(path, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || path[len(prefix)] == '/' || strings.HasSuffix(prefix, "/")
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"encoding/json"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// RouteStatusType là giá trị Type của RouteStatus, để Core phân biệt với các
+// control data payload khác
+const RouteStatusType = "route_status"
+
+// RouteStatus là payload của control FrameData agent gửi cho Core khi local
+// service down quá lâu (Routable = false: Core ngừng route tới agent này) và
+// khi service phục hồi (Routable = true). Connection vẫn giữ nguyên.
+type RouteStatus struct {
+	Type     string `json:"type"`
+	Routable bool   `json:"routable"`
+
+	// Reason mô tả lý do pause (chỉ để log/hiển thị ở Core)
+	Reason string `json:"reason,omitempty"`
+}
+
+// NewRouteStatusFrame tạo control frame báo Core agent có nhận traffic không
+func NewRouteStatusFrame(routable bool, reason string) (*v1.Frame, error) {
+	payload, err := json.Marshal(RouteStatus{Type: RouteStatusType, Routable: routable, Reason: reason})
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameData,
+		Flags:    v1.FlagNone,
+		StreamID: v1.StreamIDControl,
+		Payload:  payload,
+	}, nil
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+func TestNewRouteStatusFrame(t *testing.T) {
+	frame, err := NewRouteStatusFrame(false, "local service unreachable")
+	if err != nil {
+		t.Fatalf("NewRouteStatusFrame failed: %v", err)
+	}
+	if frame.Type != v1.FrameData || !frame.IsControlFrame() {
+		t.Errorf("Expected control data frame, got type %v stream %d", frame.Type, frame.StreamID)
+	}
+
+	var status RouteStatus
+	if err := json.Unmarshal(frame.Payload, &status); err != nil {
+		t.Fatalf("Invalid payload %q: %v", frame.Payload, err)
+	}
+	if status.Type != RouteStatusType || status.Routable || status.Reason != "local service unreachable" {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	// routable=false phải có mặt trong payload, không bị omitempty bỏ đi
+	frame, _ = NewRouteStatusFrame(true, "")
+	if string(frame.Payload) != `{"type":"route_status","routable":true}` {
+		t.Errorf("Unexpected payload: %s", frame.Payload)
+	}
+}
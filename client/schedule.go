@@ -0,0 +1,49 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/schedule"
+)
+
+// maintenanceBody là body trả về cho requests ngoài khung giờ hoạt động
+const maintenanceBody = "Service is outside its scheduled hours\n"
+
+// scheduleActive kiểm tra cả schedule của tunnel lẫn của backend
+func (lf *LocalForwarder) scheduleActive(backend Backend, now time.Time) (bool, time.Time) {
+	for _, s := range []*schedule.Schedule{lf.schedule, backend.Schedule} {
+		if !s.Active(now) {
+			return false, s.Next(now)
+		}
+	}
+	return true, time.Time{}
+}
+
+// writeMaintenance ghi response 503 với Retry-After tới lần mở tiếp theo
+// (bỏ qua nếu schedule không bao giờ mở lại)
+func (lf *LocalForwarder) writeMaintenance(w io.Writer, now, next time.Time) error {
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		StatusCode: http.StatusServiceUnavailable,
+		Status:     "503 Service Unavailable",
+		Header:     make(http.Header),
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(maintenanceBody)))
+	resp.Header.Set("Cache-Control", "no-store")
+	if !next.IsZero() {
+		resp.Header.Set("Retry-After", fmt.Sprint(int64(math.Ceil(next.Sub(now).Seconds()))))
+	}
+	if err := lf.writeResponseHeader(w, resp); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, maintenanceBody)
+	return err
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/schedule"
+)
+
+// closedSchedule trả về schedule mở 2-3 giờ sau thời điểm hiện tại (UTC)
+func closedSchedule(t *testing.T) *schedule.Schedule {
+	t.Helper()
+	now := time.Now().UTC()
+	window := now.Add(2*time.Hour).Format("15:04") + "-" + now.Add(3*time.Hour).Format("15:04")
+	s, err := schedule.Parse([]string{window}, "UTC")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	return s
+}
+
+func TestLocalForwarder_ScheduleMaintenance(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer backend.Close()
+
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		DefaultURL: backend.URL,
+		Backends:   []Backend{{Path: "/demo", URL: backend.URL, Schedule: closedSchedule(t)}},
+	})
+
+	resp := forwardAndRead(t, lf, "GET /demo/page HTTP/1.1\r\nHost: a\r\n\r\n")
+	for _, want := range []string{"HTTP/1.1 503 Service Unavailable\r\n", "Retry-After: ", maintenanceBody} {
+		if !strings.Contains(resp, want) {
+			t.Errorf("maintenance response missing %q:\n%s", want, resp)
+		}
+	}
+	if hits.Load() != 0 {
+		t.Errorf("request outside the window should not reach the local service, got %d hits", hits.Load())
+	}
+
+	// Backend không có schedule vẫn hoạt động
+	resp = forwardAndRead(t, lf, "GET /other HTTP/1.1\r\nHost: a\r\n\r\n")
+	if !strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n") || hits.Load() != 1 {
+		t.Errorf("unscheduled backend should be forwarded, got %d hits:\n%s", hits.Load(), resp)
+	}
+
+	// Schedule của tunnel áp dụng cho mọi backend
+	lf = NewLocalForwarder(LocalForwarderOptions{DefaultURL: backend.URL, Schedule: closedSchedule(t)})
+	resp = forwardAndRead(t, lf, "GET /other HTTP/1.1\r\nHost: a\r\n\r\n")
+	if !strings.HasPrefix(resp, "HTTP/1.1 503 Service Unavailable\r\n") {
+		t.Errorf("tunnel schedule should apply to every backend:\n%s", resp)
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// ShutdownType là giá trị Type của Shutdown
+const ShutdownType = "shutdown"
+
+// Shutdown reason codes
+const (
+	// ShutdownSignal: agent nhận SIGINT/SIGTERM (systemd stop, Ctrl+C, ...)
+	ShutdownSignal = "signal"
+	// ShutdownRestart: graceful restart (SIGHUP hoặc admin API), process mới đã thay thế
+	ShutdownRestart = "restart"
+	// ShutdownSelfUpdate: auto-update đã cài binary mới và restart
+	ShutdownSelfUpdate = "self_update"
+	// ShutdownIdle: không có request nào trong -idle-shutdown
+	ShutdownIdle = "idle"
+	// ShutdownFatal: agent dừng vì lỗi không thể phục hồi
+	ShutdownFatal = "fatal_error"
+)
+
+// Shutdown là payload của control FrameClose cuối cùng agent gửi khi dừng,
+// để Core phân biệt shutdown chủ động với crash (connection mất mà không có
+// FrameClose, hoặc FrameClose không có payload của agents cũ)
+type Shutdown struct {
+	Type string `json:"type"`
+	Code string `json:"code"`
+
+	// Message mô tả chi tiết (signal nhận được, lỗi, ...)
+	Message string `json:"message,omitempty"`
+}
+
+// NewShutdownFrame tạo control FrameClose báo Core lý do agent dừng
+func NewShutdownFrame(code, message string) (*v1.Frame, error) {
+	payload, err := json.Marshal(Shutdown{Type: ShutdownType, Code: code, Message: message})
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameClose,
+		Flags:    v1.FlagNone,
+		StreamID: v1.StreamIDControl,
+		Payload:  payload,
+	}, nil
+}
+
+// closeFrameTimeout giới hạn thời gian chờ frame cuối của Shutdown được ghi,
+// kể cả khi ctx đã hết trong lúc flush
+const closeFrameTimeout = time.Second
+
+// flushPollInterval là chu kỳ Shutdown kiểm tra send queues đã rỗng chưa
+const flushPollInterval = 5 * time.Millisecond
+
+// Shutdown đóng connector theo thứ tự: ngừng nhận frames mới vào send queues
+// (SendFrame và các biến thể trả về ErrConnectionClosed), chờ writeLoop ghi hết
+// frames đang chờ hoặc tới khi ctx hết, gửi frame (thường là NewShutdownFrame)
+// và chờ nó được flush xuống connection, rồi Close. Frame cuối luôn được ghi
+// sau mọi stream frame đã vào queue trước đó. Trả về lỗi gửi frame cuối; hết
+// ctx trong lúc flush chỉ được log vì connector vẫn được đóng.
+func (c *Connector) Shutdown(ctx context.Context, frame *v1.Frame) error {
+	defer c.Close()
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+	c.closing.Store(true)
+
+	if err := c.flush(ctx); err != nil {
+		logger.Warn("Timed out flushing frames before close", "pending", c.pending.Load(), "error", err)
+	}
+	if frame == nil {
+		return nil
+	}
+
+	sendCtx, cancel := context.WithTimeout(context.Background(), closeFrameTimeout)
+	defer cancel()
+	return c.sendAcked(sendCtx, frame, func(ctx context.Context, frame *v1.Frame) error {
+		return c.push(ctx, frame, PriorityNormal)
+	})
+}
+
+// flush chờ writeLoop lấy hết frames đã vào send queues; connection mất thì
+// frames còn lại không bao giờ được ghi
+func (c *Connector) flush(ctx context.Context) error {
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+	for c.pending.Load() > 0 {
+		if !c.IsConnected() {
+			return ErrConnectionClosed
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.closed:
+			return ErrConnectionClosed
+		}
+	}
+	return nil
+}
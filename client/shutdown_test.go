@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+func TestNewShutdownFrame(t *testing.T) {
+	frame, err := NewShutdownFrame(ShutdownSignal, "received terminated")
+	if err != nil {
+		t.Fatalf("NewShutdownFrame failed: %v", err)
+	}
+	if frame.Type != v1.FrameClose || !frame.IsControlFrame() {
+		t.Errorf("Expected control close frame, got type %v stream %d", frame.Type, frame.StreamID)
+	}
+
+	var shutdown Shutdown
+	if err := json.Unmarshal(frame.Payload, &shutdown); err != nil {
+		t.Fatalf("Invalid payload %q: %v", frame.Payload, err)
+	}
+	if shutdown.Type != ShutdownType || shutdown.Code != ShutdownSignal || shutdown.Message != "received terminated" {
+		t.Errorf("Unexpected shutdown: %+v", shutdown)
+	}
+}
+
+func TestConnector_ShutdownFlushesBeforeClose(t *testing.T) {
+	connector := NewConnector("memory", ConnectorOptions{})
+	conn, core := newMemoryPipe()
+	defer core.Close()
+	connector.setConnection(conn)
+
+	// Frames đã vào queue trước Shutdown, kể cả bulk frames chỉ được ghi khi
+	// các queue khác rỗng
+	for i := uint32(0); i < 20; i++ {
+		priority := PriorityNormal
+		if i%2 == 0 {
+			priority = PriorityLow
+		}
+		if err := connector.enqueue(errorFrame(2*i+1), priority); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go connector.writeLoop(conn, done)
+
+	received := make(chan []*v1.Frame, 1)
+	go func() {
+		var frames []*v1.Frame
+		for {
+			length, err := v1.ReadFrameLength(core)
+			if err != nil {
+				received <- frames
+				return
+			}
+			buf := make([]byte, length)
+			if _, err := io.ReadFull(core, buf); err != nil {
+				received <- frames
+				return
+			}
+			frame, _ := v1.ParseFrame(buf)
+			frames = append(frames, frame)
+		}
+	}()
+
+	closeFrame, _ := NewShutdownFrame(ShutdownSignal, "received terminated")
+	if err := connector.Shutdown(context.Background(), closeFrame); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := connector.SendFrame(context.Background(), errorFrame(99)); err == nil {
+		t.Error("SendFrame after Shutdown should fail")
+	}
+
+	frames := <-received
+	if len(frames) != 21 {
+		t.Fatalf("Core received %d frames, want 20 stream frames and the close frame", len(frames))
+	}
+	if last := frames[20]; last.Type != v1.FrameClose || !last.IsControlFrame() {
+		t.Errorf("last frame = type %v stream %d, want control FrameClose", last.Type, last.StreamID)
+	}
+}
+
+func TestConnector_ShutdownFlushTimeout(t *testing.T) {
+	connector := NewConnector("memory", ConnectorOptions{})
+	conn, core := newMemoryPipe()
+	defer core.Close()
+	connector.setConnection(conn)
+
+	// Không có writeLoop: queue không bao giờ rỗng, Shutdown vẫn đóng connector
+	connector.SendFrame(context.Background(), errorFrame(1))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	closeFrame, _ := NewShutdownFrame(ShutdownSignal, "")
+	if err := connector.Shutdown(ctx, closeFrame); err == nil {
+		t.Error("close frame reported as sent without a writeLoop")
+	}
+	if connector.IsConnected() {
+		t.Error("connector still connected after Shutdown")
+	}
+}
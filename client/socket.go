@@ -0,0 +1,73 @@
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// SocketOptions tinh chỉnh TCP socket của connection tới Core. Zero value giữ
+// default của OS/Go.
+type SocketOptions struct {
+	// DisableNoDelay tắt TCP_NODELAY (Go bật mặc định): Nagle gom frames nhỏ, tăng
+	// throughput trên link chậm đổi lại latency cao hơn
+	DisableNoDelay bool
+
+	// SendBuffer và ReceiveBuffer là SO_SNDBUF/SO_RCVBUF tính bằng bytes (0 = default OS)
+	SendBuffer    int
+	ReceiveBuffer int
+
+	// DSCP đánh dấu packets với DSCP code point 0-63 (0 = không đánh dấu).
+	// Chỉ hỗ trợ trên Linux và BSD/macOS.
+	DSCP int
+}
+
+// control trả về net.Dialer.Control đặt DSCP trước khi connect để cả SYN cũng được
+// đánh dấu, nil nếu không cần
+func (o SocketOptions) control() func(network, address string, c syscall.RawConn) error {
+	if o.DSCP == 0 {
+		return nil
+	}
+	tos := o.DSCP << 2
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = setTOS(fd, network, tos)
+		})
+		if err != nil {
+			return err
+		}
+		if sockErr != nil {
+			return fmt.Errorf("set DSCP %d: %w", o.DSCP, sockErr)
+		}
+		return nil
+	}
+}
+
+// apply đặt TCP_NODELAY và buffer sizes cho connection đã dial
+func (o SocketOptions) apply(conn net.Conn) error {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if o.DisableNoDelay {
+		if err := tcpConn.SetNoDelay(false); err != nil {
+			return fmt.Errorf("disable TCP_NODELAY: %w", err)
+		}
+	}
+	if o.SendBuffer > 0 {
+		if err := tcpConn.SetWriteBuffer(o.SendBuffer); err != nil {
+			return fmt.Errorf("set send buffer: %w", err)
+		}
+	}
+	if o.ReceiveBuffer > 0 {
+		if err := tcpConn.SetReadBuffer(o.ReceiveBuffer); err != nil {
+			return fmt.Errorf("set receive buffer: %w", err)
+		}
+	}
+	return nil
+}
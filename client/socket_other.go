@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package client
+
+import (
+	"errors"
+	"runtime"
+)
+
+// DSCPSupported cho biết platform hỗ trợ SocketOptions.DSCP
+const DSCPSupported = false
+
+// setTOS không được hỗ trợ trên platform này
+func setTOS(fd uintptr, network string, tos int) error {
+	return errors.New("DSCP marking is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package client
+
+import "syscall"
+
+// DSCPSupported cho biết platform hỗ trợ SocketOptions.DSCP
+const DSCPSupported = true
+
+// setTOS đặt IP_TOS (IPv4) hoặc IPV6_TCLASS (IPv6) cho socket
+func setTOS(fd uintptr, network string, tos int) error {
+	if network == "tcp6" {
+		return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos)
+	}
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+}
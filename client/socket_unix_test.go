@@ -0,0 +1,52 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package client
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestConnector_SocketOptions(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			var buf [1]byte
+			conn.Read(buf[:])
+		}
+	}()
+
+	connector := NewConnector(ln.Addr().String(), ConnectorOptions{
+		MaxRetries: 1,
+		Socket:     SocketOptions{DisableNoDelay: true, SendBuffer: 64 << 10, ReceiveBuffer: 64 << 10, DSCP: 46},
+	})
+	defer connector.Close()
+	if err := connector.Connect(context.Background()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	conn, _ := connector.GetConnection()
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn: %v", err)
+	}
+	var tos, noDelay int
+	raw.Control(func(fd uintptr) {
+		tos, _ = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS)
+		noDelay, _ = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_NODELAY)
+	})
+	if tos != 46<<2 {
+		t.Errorf("IP_TOS = %#x, want %#x", tos, 46<<2)
+	}
+	if noDelay != 0 {
+		t.Error("expected TCP_NODELAY to be disabled")
+	}
+}
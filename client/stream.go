@@ -1,20 +1,27 @@
 package client
 
 import (
+	"context"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
 	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
 )
 
 // Stream đại diện cho 1 stream từ Core Server
 type Stream struct {
 	ID        uint32
+	Kind      string
 	State     StreamState
 	CreatedAt time.Time
 	Metadata  map[string]string
 
+	// AgentInitiated = true nếu stream được mở bởi agent (reverse call tới Core)
+	AgentInitiated bool
+
 	// Data channels
 	dataOut chan []byte
 	closeCh chan struct{}
@@ -22,8 +29,21 @@ type Stream struct {
 	connector *Connector // Reference to connector for writing
 	mu        sync.RWMutex
 
+	// Payload bytes đang nằm trong dataOut, được đếm vào memory budget
+	memory *MemoryBudget
+	queued atomic.Int64
+
 	// Internal read buffer for Read interface
 	readBuf []byte
+
+	// Tổng số bytes đã đọc qua Read (request body tới local service)
+	bytesRead atomic.Int64
+
+	// Priority (kiểu Priority) của frames stream gửi tới Core
+	priority atomic.Int32
+
+	// orphaned = true khi connection của stream đã mất (CloseAll)
+	orphaned atomic.Bool
 }
 
 // StreamState là state của stream
@@ -37,6 +57,24 @@ const (
 	StreamStateError
 )
 
+// String trả về tên của state
+func (s StreamState) String() string {
+	switch s {
+	case StreamStateInit:
+		return "init"
+	case StreamStateOpen:
+		return "open"
+	case StreamStateData:
+		return "data"
+	case StreamStateClosed:
+		return "closed"
+	case StreamStateError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
 // StreamManager quản lý streams
 type StreamManager struct {
 	streams   map[uint32]*Stream
@@ -47,28 +85,84 @@ type StreamManager struct {
 	onStreamClosed  func(streamID uint32)
 
 	connector *Connector
+	clock     clock.Clock
+	memory    *MemoryBudget
+
+	// Agent-side stream ID allocation (even IDs, Core dùng odd IDs)
+	nextLocalID    uint32
+	localExhausted bool
+	nextLocalMu    sync.Mutex
+
+	// Core-initiated stream ID lớn nhất đã mở trong connection hiện tại
+	lastRemoteID uint32
+	remoteMu     sync.Mutex
+
+	// Giới hạn streams Core được mở (MaxRemoteStreams, RemoteOpenRate),
+	// 0/nil = không giới hạn
+	maxRemoteStreams int
+	openLimiter      *frameLimiter
+}
+
+// IsAgentInitiatedID kiểm tra stream ID có thuộc không gian ID của agent không.
+// Core-initiated streams dùng odd IDs, agent-initiated streams dùng even IDs (> 0).
+func IsAgentInitiatedID(streamID uint32) bool {
+	return streamID != v1.StreamIDControl && streamID%2 == 0
+}
+
+// StreamManagerOptions cấu hình StreamManager. Zero value của mỗi field dùng default.
+type StreamManagerOptions struct {
+	// Clock dùng cho stream timestamps và open rate limit (nil = clock.Real;
+	// tests dùng clock.Mock)
+	Clock clock.Clock
+
+	// Memory là memory budget cho stream queues; khi có pressure, OpenStream
+	// từ chối stream mới và streams dùng chunks nhỏ hơn (nil = không giới hạn)
+	Memory *MemoryBudget
+
+	// MaxRemoteStreams giới hạn số streams Core mở đồng thời và RemoteOpenRate
+	// số streams mới Core được mở mỗi giây (burst = RemoteOpenRate); 0 = không
+	// giới hạn
+	MaxRemoteStreams int
+	RemoteOpenRate   int
+
+	// Callbacks
+	OnStreamCreated func(streamID uint32)
+	OnStreamClosed  func(streamID uint32)
 }
 
 // NewStreamManager tạo StreamManager mới
-func NewStreamManager(connector *Connector) *StreamManager {
+func NewStreamManager(connector *Connector, opts StreamManagerOptions) *StreamManager {
+	c := clock.Or(opts.Clock)
 	return &StreamManager{
-		streams:   make(map[uint32]*Stream),
-		connector: connector,
+		streams:          make(map[uint32]*Stream),
+		onStreamCreated:  opts.OnStreamCreated,
+		onStreamClosed:   opts.OnStreamClosed,
+		connector:        connector,
+		clock:            c,
+		memory:           opts.Memory,
+		maxRemoteStreams: opts.MaxRemoteStreams,
+		openLimiter:      newFrameLimiter(opts.RemoteOpenRate, 0, c),
 	}
 }
 
-// SetOnStreamCreated set callback khi stream được tạo
-func (sm *StreamManager) SetOnStreamCreated(callback func(streamID uint32)) {
-	sm.onStreamCreated = callback
-}
-
-// SetOnStreamClosed set callback khi stream đóng
-func (sm *StreamManager) SetOnStreamClosed(callback func(streamID uint32)) {
-	sm.onStreamClosed = callback
+// now trả về thời gian hiện tại theo clock của manager
+func (sm *StreamManager) now() time.Time {
+	return clock.Or(sm.clock).Now()
 }
 
 // CreateStream tạo stream mới
 func (sm *StreamManager) CreateStream(streamID uint32) (*Stream, error) {
+	return sm.createStream(streamID, "", nil, false)
+}
+
+// CreateStreamKind tạo stream cho FrameOpenStream của Core với kind và
+// metadata từ open header. Kind, metadata và priority được gán trước khi
+// stream vào map, nên Snapshot và onStreamCreated không thấy stream dở dang.
+func (sm *StreamManager) CreateStreamKind(streamID uint32, kind string, metadata map[string]string) (*Stream, error) {
+	return sm.createStream(streamID, kind, metadata, false)
+}
+
+func (sm *StreamManager) createStream(streamID uint32, kind string, metadata map[string]string, agentInitiated bool) (*Stream, error) {
 	sm.streamsMu.Lock()
 	defer sm.streamsMu.Unlock()
 
@@ -77,14 +171,21 @@ func (sm *StreamManager) CreateStream(streamID uint32) (*Stream, error) {
 	}
 
 	stream := &Stream{
-		ID:        streamID,
-		State:     StreamStateInit,
-		CreatedAt: time.Now(),
-		Metadata:  make(map[string]string),
-		dataOut:   make(chan []byte, 100),
-		closeCh:   make(chan struct{}),
-		connector: sm.connector,
+		ID:             streamID,
+		Kind:           kind,
+		State:          StreamStateInit,
+		CreatedAt:      sm.now(),
+		AgentInitiated: agentInitiated,
+		Metadata:       make(map[string]string, len(metadata)),
+		dataOut:        make(chan []byte, 100),
+		closeCh:        make(chan struct{}),
+		connector:      sm.connector,
+		memory:         sm.memory,
 	}
+	for k, v := range metadata {
+		stream.Metadata[k] = v
+	}
+	stream.SetPriority(PriorityFromMetadata(metadata))
 
 	sm.streams[streamID] = stream
 
@@ -95,6 +196,76 @@ func (sm *StreamManager) CreateStream(streamID uint32) (*Stream, error) {
 	return stream, nil
 }
 
+// OpenStream mở stream mới từ phía agent tới Core (reverse call).
+// Stream ID được cấp phát tăng dần theo parity của agent (even IDs).
+// FrameOpenStream được gửi kèm open header chứa kind và metadata (thêm trace
+// ID nếu metadata chưa có); khi send queue đầy OpenStream chờ đến khi ctx bị huỷ.
+func (sm *StreamManager) OpenStream(ctx context.Context, kind string, metadata map[string]string, payload []byte) (*Stream, error) {
+	if sm.connector == nil {
+		return nil, ErrNotConnected
+	}
+	if sm.memory.UnderPressure() {
+		return nil, ErrMemoryPressure
+	}
+
+	metadata = withTraceID(metadata)
+	openPayload, err := EncodeOpenPayload(kind, metadata, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	streamID, err := sm.allocateLocalID()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := sm.createStream(streamID, kind, metadata, true)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameOpenStream,
+		Flags:    v1.FlagNone,
+		StreamID: streamID,
+		Payload:  openPayload,
+	}
+	if err := sm.connector.sendFrameWait(ctx, frame, stream.Priority()); err != nil {
+		sm.CloseStream(streamID)
+		return nil, err
+	}
+
+	stream.setState(StreamStateOpen)
+	return stream, nil
+}
+
+// allocateLocalID cấp phát stream ID tiếp theo cho agent-initiated stream
+func (sm *StreamManager) allocateLocalID() (uint32, error) {
+	sm.nextLocalMu.Lock()
+	defer sm.nextLocalMu.Unlock()
+
+	if sm.nextLocalID == 0 {
+		sm.nextLocalID = 2
+	}
+
+	// Bỏ qua ID đang được sử dụng, dừng khi hết không gian ID
+	for {
+		if sm.localExhausted {
+			return 0, ErrStreamIDExhausted
+		}
+		id := sm.nextLocalID
+		sm.nextLocalID += 2
+		if sm.nextLocalID < id {
+			// Overflow: ID này là ID cuối cùng
+			sm.localExhausted = true
+		}
+		if _, exists := sm.GetStream(id); !exists {
+			return id, nil
+		}
+	}
+}
+
 // GetStream lấy stream theo ID
 func (sm *StreamManager) GetStream(streamID uint32) (*Stream, bool) {
 	sm.streamsMu.RLock()
@@ -104,20 +275,94 @@ func (sm *StreamManager) GetStream(streamID uint32) (*Stream, bool) {
 	return stream, ok
 }
 
+// StreamInfo là snapshot thông tin của một stream (dùng cho diagnostics/status)
+type StreamInfo struct {
+	ID             uint32            `json:"id"`
+	Kind           string            `json:"kind"`
+	State          string            `json:"state"`
+	AgentInitiated bool              `json:"agent_initiated"`
+	CreatedAt      time.Time         `json:"created_at"`
+	Age            string            `json:"age"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+}
+
+// Snapshot trả về thông tin của tất cả streams đang mở
+func (sm *StreamManager) Snapshot() []StreamInfo {
+	sm.streamsMu.RLock()
+	defer sm.streamsMu.RUnlock()
+
+	now := sm.now()
+	infos := make([]StreamInfo, 0, len(sm.streams))
+	for _, stream := range sm.streams {
+		stream.mu.RLock()
+		metadata := make(map[string]string, len(stream.Metadata))
+		for k, v := range stream.Metadata {
+			metadata[k] = v
+		}
+		infos = append(infos, StreamInfo{
+			ID:             stream.ID,
+			Kind:           stream.Kind,
+			State:          stream.State.String(),
+			AgentInitiated: stream.AgentInitiated,
+			CreatedAt:      stream.CreatedAt,
+			Age:            now.Sub(stream.CreatedAt).Round(time.Millisecond).String(),
+			Metadata:       metadata,
+		})
+		stream.mu.RUnlock()
+	}
+	return infos
+}
+
 // CloseStream đóng stream
 func (sm *StreamManager) CloseStream(streamID uint32) error {
+	return sm.closeStream(streamID, nil)
+}
+
+// CloseStreamOf đóng stream nếu ID của nó chưa được một stream khác dùng lại.
+// Goroutine xử lý stream dùng nó thay cho CloseStream: sau reconnect, Core có
+// thể đã mở stream mới với cùng ID.
+func (sm *StreamManager) CloseStreamOf(stream *Stream) error {
+	return sm.closeStream(stream.ID, stream)
+}
+
+// CloseAll đóng mọi stream khi connection của chúng đã mất. Core quên streams
+// của connection cũ và bắt đầu lại không gian ID, nên streams còn chạy (relay,
+// WebSocket đang chờ local service) bị orphaned: frames của chúng không được
+// gửi lên connection mới và IDs được giải phóng. Trả về số streams đã đóng.
+func (sm *StreamManager) CloseAll() int {
+	sm.streamsMu.RLock()
+	streams := make([]*Stream, 0, len(sm.streams))
+	for _, stream := range sm.streams {
+		streams = append(streams, stream)
+	}
+	sm.streamsMu.RUnlock()
+
+	closed := 0
+	for _, stream := range streams {
+		stream.orphaned.Store(true)
+		if sm.closeStream(stream.ID, stream) == nil {
+			closed++
+		}
+	}
+	return closed
+}
+
+// closeStream đóng streamID; match != nil chỉ đóng khi streamID vẫn là match
+func (sm *StreamManager) closeStream(streamID uint32, match *Stream) error {
 	sm.streamsMu.Lock()
 	defer sm.streamsMu.Unlock()
 
 	stream, exists := sm.streams[streamID]
-	if !exists {
+	if !exists || (match != nil && stream != match) {
 		return ErrStreamNotFound
 	}
 
 	stream.setState(StreamStateClosed)
+	// Data chưa đọc không còn được tính là buffered
+	stream.memory.Release(int(stream.queued.Swap(0)))
+	// Read trả về EOF qua closeCh; dataOut không bị close vì Deliver có thể
+	// đang gửi vào nó
 	close(stream.closeCh)
-	// Close dataOut to signal anyone reading from it
-	close(stream.dataOut)
 	delete(sm.streams, streamID)
 
 	if sm.onStreamClosed != nil {
@@ -146,6 +391,42 @@ func (s *Stream) DataOut() chan<- []byte {
 	return s.dataOut
 }
 
+// Deliver đưa payload từ Core vào stream cho Read, block khi queue đầy.
+// Trả về ErrStreamNotFound nếu stream đã đóng.
+func (s *Stream) Deliver(payload []byte) error {
+	select {
+	case <-s.closeCh:
+		return ErrStreamNotFound
+	default:
+	}
+
+	s.queued.Add(int64(len(payload)))
+	s.memory.Reserve(len(payload))
+	select {
+	case s.dataOut <- payload:
+		return nil
+	case <-s.closeCh:
+		s.release(len(payload))
+		return ErrStreamNotFound
+	}
+}
+
+// release trả n bytes đã rời dataOut về memory budget. Bytes đã được
+// CloseStream release thì không bị release lần nữa.
+func (s *Stream) release(n int) {
+	for {
+		queued := s.queued.Load()
+		if queued <= 0 {
+			return
+		}
+		r := min(int64(n), queued)
+		if s.queued.CompareAndSwap(queued, queued-r) {
+			s.memory.Release(int(r))
+			return
+		}
+	}
+}
+
 // CloseCh returns close channel
 func (s *Stream) CloseCh() <-chan struct{} {
 	return s.closeCh
@@ -153,6 +434,7 @@ func (s *Stream) CloseCh() <-chan struct{} {
 
 // Read implements io.Reader
 func (s *Stream) Read(p []byte) (n int, err error) {
+	defer func() { s.bytesRead.Add(int64(n)) }()
 	if len(s.readBuf) > 0 {
 		n = copy(p, s.readBuf)
 		s.readBuf = s.readBuf[n:]
@@ -164,18 +446,63 @@ func (s *Stream) Read(p []byte) (n int, err error) {
 		if !ok {
 			return 0, io.EOF
 		}
-		n = copy(p, data)
-		if n < len(data) {
-			s.readBuf = data[n:]
-		}
-		return n, nil
+		s.release(len(data))
+		return s.consume(p, data), nil
 	case <-s.closeCh:
+		// Drain data còn trong buffer trước khi báo EOF
+		select {
+		case data, ok := <-s.dataOut:
+			if ok {
+				s.release(len(data))
+				return s.consume(p, data), nil
+			}
+		default:
+		}
 		return 0, io.EOF
 	}
 }
 
-// Write implements io.Writer
+// consume copy data vào p, giữ phần còn lại trong readBuf
+func (s *Stream) consume(p []byte, data []byte) int {
+	n := copy(p, data)
+	if n < len(data) {
+		s.readBuf = data[n:]
+	}
+	return n
+}
+
+// Orphaned trả về true khi connection của stream đã mất: Core không còn biết
+// stream, nên mọi write trả về ErrConnectionClosed
+func (s *Stream) Orphaned() bool {
+	return s.orphaned.Load()
+}
+
+// Write implements io.Writer. Frame được gửi async bởi writeLoop nên p được
+// copy (io.Writer không được giữ p sau khi return, ví dụ buffer của io.Copy).
 func (s *Stream) Write(p []byte) (n int, err error) {
+	if s.orphaned.Load() {
+		return 0, ErrConnectionClosed
+	}
+	frame := &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameData,
+		Flags:    v1.FlagNone,
+		StreamID: s.ID,
+		Payload:  append([]byte(nil), p...),
+	}
+
+	if err := s.connector.enqueue(frame, s.Priority()); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// WriteContext ghi data vào stream, chờ khi send queue đầy thay vì trả lỗi
+func (s *Stream) WriteContext(ctx context.Context, p []byte) (n int, err error) {
+	if s.orphaned.Load() {
+		return 0, ErrConnectionClosed
+	}
 	frame := &v1.Frame{
 		Version:  v1.Version,
 		Type:     v1.FrameData,
@@ -184,15 +511,41 @@ func (s *Stream) Write(p []byte) (n int, err error) {
 		Payload:  p,
 	}
 
-	if err := s.connector.SendFrame(frame); err != nil {
+	if err := s.connector.sendFrameWait(ctx, frame, s.Priority()); err != nil {
 		return 0, err
 	}
 
 	return len(p), nil
 }
 
+// copyToStream gửi data từ r vào stream theo từng chunk với backpressure.
+// Mỗi chunk dùng buffer riêng vì frame payload được gửi async bởi writeLoop.
+func copyToStream(ctx context.Context, stream *Stream, r io.Reader, chunkSize int) (int64, error) {
+	var total int64
+	for {
+		// Chunk nhỏ hơn khi có memory pressure
+		buf := make([]byte, stream.memory.chunkSize(chunkSize))
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := stream.WriteContext(ctx, buf[:n]); werr != nil {
+				return total, werr
+			}
+			total += int64(n)
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
 // Close implements io.Closer
 func (s *Stream) Close() error {
+	if s.orphaned.Load() {
+		return ErrConnectionClosed
+	}
 	frame := &v1.Frame{
 		Version:  v1.Version,
 		Type:     v1.FrameData,
@@ -200,7 +553,7 @@ func (s *Stream) Close() error {
 		StreamID: s.ID,
 		Payload:  nil,
 	}
-	return s.connector.SendFrame(frame)
+	return s.connector.enqueue(frame, s.Priority())
 }
 
 // SetMetadata set metadata
@@ -213,6 +566,17 @@ func (s *Stream) SetMetadata(key, value string) {
 	s.Metadata[key] = value
 }
 
+// metadataSnapshot trả về bản sao metadata
+func (s *Stream) metadataSnapshot() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	metadata := make(map[string]string, len(s.Metadata))
+	for k, v := range s.Metadata {
+		metadata[k] = v
+	}
+	return metadata
+}
+
 // GetMetadata lấy metadata
 func (s *Stream) GetMetadata(key string) (string, bool) {
 	s.mu.RLock()
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// ValidateRemoteOpen kiểm tra stream ID của FrameOpenStream từ Core.
+// Core-initiated IDs phải là odd và tăng dần trong một connection; ID hợp lệ
+// được ghi nhận là ID lớn nhất Core đã mở.
+func (sm *StreamManager) ValidateRemoteOpen(streamID uint32) error {
+	if streamID == v1.StreamIDControl || IsAgentInitiatedID(streamID) {
+		return fmt.Errorf("%w: stream %d does not use core parity", ErrProtocolViolation, streamID)
+	}
+
+	sm.remoteMu.Lock()
+	defer sm.remoteMu.Unlock()
+
+	if streamID <= sm.lastRemoteID {
+		return fmt.Errorf("%w: stream %d reuses or precedes last opened stream %d", ErrProtocolViolation, streamID, sm.lastRemoteID)
+	}
+	sm.lastRemoteID = streamID
+
+	// Core bị compromise không được mở streams vô hạn hoặc mở/đóng liên tục:
+	// stream vượt giới hạn bị reset, ID vẫn được tính là đã dùng
+	if sm.maxRemoteStreams > 0 {
+		sm.streamsMu.RLock()
+		open := len(sm.streams)
+		sm.streamsMu.RUnlock()
+		if open >= sm.maxRemoteStreams {
+			return fmt.Errorf("%w: %d streams already open", ErrStreamLimit, open)
+		}
+	}
+	if !sm.openLimiter.allow() {
+		return fmt.Errorf("%w: streams opened faster than %.0f/s", ErrStreamLimit, sm.openLimiter.rate)
+	}
+	return nil
+}
+
+// IsClosedID kiểm tra streamID đã từng được mở trong connection hiện tại và đã đóng
+func (sm *StreamManager) IsClosedID(streamID uint32) bool {
+	if _, exists := sm.GetStream(streamID); exists {
+		return false
+	}
+
+	if IsAgentInitiatedID(streamID) {
+		sm.nextLocalMu.Lock()
+		defer sm.nextLocalMu.Unlock()
+		return sm.localExhausted || (sm.nextLocalID != 0 && streamID < sm.nextLocalID)
+	}
+
+	sm.remoteMu.Lock()
+	defer sm.remoteMu.Unlock()
+	return streamID <= sm.lastRemoteID
+}
+
+// ResetRemoteIDs quên các Core-initiated IDs đã thấy, gọi khi có connection
+// mới vì Core bắt đầu lại không gian ID cho mỗi connection
+func (sm *StreamManager) ResetRemoteIDs() {
+	sm.remoteMu.Lock()
+	defer sm.remoteMu.Unlock()
+	sm.lastRemoteID = 0
+}
+
+// NewResetFrame tạo frame reset cho streamID: FrameClose với FlagError,
+// payload là lý do reset
+func NewResetFrame(streamID uint32, reason string) *v1.Frame {
+	return &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameClose,
+		Flags:    v1.FlagError,
+		StreamID: streamID,
+		Payload:  []byte(reason),
+	}
+}
+
+// ResetCode là mã lý do trong payload của reset frame, để Core trả lỗi ngay
+// cho client đang chờ (và quyết định retry) thay vì chờ timeout
+type ResetCode string
+
+const (
+	// ResetProtocolError: frame của Core vi phạm protocol
+	ResetProtocolError ResetCode = "protocol_error"
+	// ResetStreamExists: Core mở stream với ID đang được dùng
+	ResetStreamExists ResetCode = "stream_exists"
+	// ResetStreamLimit: vượt giới hạn streams đồng thời hoặc tốc độ mở stream
+	ResetStreamLimit ResetCode = "stream_limit"
+	// ResetStreamClosed: frame cho stream đã đóng hoặc không tồn tại
+	ResetStreamClosed ResetCode = "stream_closed"
+	// ResetMemoryPressure: agent đang vượt memory cap, Core nên retry sau
+	ResetMemoryPressure ResetCode = "memory_pressure"
+	// ResetInternal: lỗi khác của agent
+	ResetInternal ResetCode = "internal_error"
+)
+
+// ResetCodeOf trả về reset code ứng với lỗi
+func ResetCodeOf(err error) ResetCode {
+	switch {
+	case errors.Is(err, ErrStreamAlreadyExists):
+		return ResetStreamExists
+	case errors.Is(err, ErrStreamLimit):
+		return ResetStreamLimit
+	case errors.Is(err, ErrStreamNotFound):
+		return ResetStreamClosed
+	case errors.Is(err, ErrMemoryPressure):
+		return ResetMemoryPressure
+	case errors.Is(err, ErrProtocolViolation):
+		return ResetProtocolError
+	default:
+		return ResetInternal
+	}
+}
+
+// NewStreamReset tạo reset frame cho streamID với payload "<code>: <lỗi>",
+// code lấy từ ResetCodeOf(err)
+func NewStreamReset(streamID uint32, err error) *v1.Frame {
+	return NewResetFrame(streamID, string(ResetCodeOf(err))+": "+err.Error())
+}
+
+// ParseReset tách reset code và lý do từ payload của reset frame. Payload
+// không có code hợp lệ (peer cũ) trả về code rỗng và cả payload là lý do.
+func ParseReset(frame *v1.Frame) (ResetCode, string) {
+	payload := string(frame.Payload)
+	code, reason, ok := strings.Cut(payload, ": ")
+	if !ok || code == "" || strings.ContainsAny(code, " \t") {
+		return "", payload
+	}
+	return ResetCode(code), reason
+}
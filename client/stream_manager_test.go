@@ -1,9 +1,16 @@
 package client
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
 )
 
 func TestStreamManager_CreateStream(t *testing.T) {
@@ -126,23 +133,20 @@ func TestStreamManager_ConcurrentStreamCreation(t *testing.T) {
 }
 
 func TestStreamManager_Callbacks(t *testing.T) {
-	sm := &StreamManager{
-		streams: make(map[uint32]*Stream),
-	}
-
 	var createdID uint32
 	var closedID uint32
 	var createdCalled bool
 	var closedCalled bool
 
-	sm.SetOnStreamCreated(func(streamID uint32) {
-		createdCalled = true
-		createdID = streamID
-	})
-
-	sm.SetOnStreamClosed(func(streamID uint32) {
-		closedCalled = true
-		closedID = streamID
+	sm := NewStreamManager(nil, StreamManagerOptions{
+		OnStreamCreated: func(streamID uint32) {
+			createdCalled = true
+			createdID = streamID
+		},
+		OnStreamClosed: func(streamID uint32) {
+			closedCalled = true
+			closedID = streamID
+		},
 	})
 
 	_, err := sm.CreateStream(42)
@@ -298,3 +302,314 @@ func TestStreamManager_ConcurrentOperations(t *testing.T) {
 		t.Fatal("Concurrent operations timed out")
 	}
 }
+
+func TestStreamManager_AllocateLocalID(t *testing.T) {
+	sm := &StreamManager{
+		streams: make(map[uint32]*Stream),
+	}
+
+	// ID 4 đã được sử dụng, allocator phải bỏ qua
+	if _, err := sm.CreateStream(4); err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+
+	expected := []uint32{2, 6, 8}
+	for _, want := range expected {
+		id, err := sm.allocateLocalID()
+		if err != nil {
+			t.Fatalf("allocateLocalID failed: %v", err)
+		}
+		if id != want {
+			t.Errorf("Expected ID %d, got %d", want, id)
+		}
+		if !IsAgentInitiatedID(id) {
+			t.Errorf("ID %d should be agent-initiated", id)
+		}
+	}
+
+	sm.nextLocalID = 0xFFFFFFFE
+	if _, err := sm.allocateLocalID(); err != nil {
+		t.Fatalf("Last even ID should be allocatable: %v", err)
+	}
+	if _, err := sm.allocateLocalID(); err != ErrStreamIDExhausted {
+		t.Errorf("Expected ErrStreamIDExhausted, got %v", err)
+	}
+}
+
+func TestOpenPayload_RoundTrip(t *testing.T) {
+	payload, err := EncodeOpenPayload(StreamKindEvent, map[string]string{"topic": "orders"}, []byte("hello"))
+	if err != nil {
+		t.Fatalf("EncodeOpenPayload failed: %v", err)
+	}
+
+	kind, meta, body, err := ParseOpenPayload(payload)
+	if err != nil {
+		t.Fatalf("ParseOpenPayload failed: %v", err)
+	}
+	if kind != StreamKindEvent {
+		t.Errorf("Expected kind %q, got %q", StreamKindEvent, kind)
+	}
+	if meta["topic"] != "orders" {
+		t.Errorf("Expected topic=orders, got %q", meta["topic"])
+	}
+	if string(body) != "hello" {
+		t.Errorf("Expected body 'hello', got %q", body)
+	}
+
+	// Legacy payload không có open header
+	raw := []byte("GET / HTTP/1.1\r\nHost: a\r\n\r\n")
+	kind, _, body, err = ParseOpenPayload(raw)
+	if err != nil || kind != StreamKindHTTP || string(body) != string(raw) {
+		t.Errorf("Legacy payload should parse as HTTP, got kind=%q err=%v", kind, err)
+	}
+}
+
+func TestOpenPayload_RejectsHeaderInjection(t *testing.T) {
+	for name, metadata := range map[string]map[string]string{
+		"CRLF in value":  {"target": "db:5432\r\nexec: rm"},
+		"LF in value":    {"target": "db:5432\nexec: rm"},
+		"blank line":     {"target": "db:5432\r\n\r\nGET /smuggled HTTP/1.1"},
+		"CRLF in key":    {"target\r\nexec": "rm"},
+		"colon in key":   {"exec: rm\r\ntarget": "db"},
+		"colon only key": {"a:b": "c"},
+		"empty key":      {"": "c"},
+	} {
+		if _, err := EncodeOpenPayload(StreamKindTCP, metadata, nil); !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("%s: expected ErrInvalidMetadata, got %v", name, err)
+		}
+	}
+	if _, err := EncodeOpenPayload("tcp\r\nexec: rm", nil, nil); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("CRLF in kind: expected ErrInvalidMetadata, got %v", err)
+	}
+
+	// Value có ':' vẫn hợp lệ
+	payload, err := EncodeOpenPayload(StreamKindTCP, map[string]string{"target": "db:5432"}, nil)
+	if err != nil {
+		t.Fatalf("EncodeOpenPayload failed: %v", err)
+	}
+	if _, meta, _, _ := ParseOpenPayload(payload); len(meta) != 1 || meta["target"] != "db:5432" {
+		t.Errorf("metadata = %v, want only target=db:5432", meta)
+	}
+
+	// OpenStream không mở stream (hay gửi frame) với metadata không hợp lệ
+	connector := NewConnector("test", ConnectorOptions{})
+	connector.connected = true
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+	if _, err := sm.OpenStream(context.Background(), StreamKindTCP, map[string]string{"target": "db\r\nx: y"}, nil); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("OpenStream: expected ErrInvalidMetadata, got %v", err)
+	}
+	if len(sm.Snapshot()) != 0 || len(connector.sendCh) != 0 {
+		t.Error("OpenStream opened a stream with invalid metadata")
+	}
+}
+
+func TestStream_WriteCopiesPayload(t *testing.T) {
+	connector := NewConnector("test", ConnectorOptions{})
+	connector.connected = true
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+
+	stream, err := sm.CreateStream(1)
+	if err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+
+	// Frame được gửi async, caller (ví dụ io.Copy) tái sử dụng buffer ngay sau Write
+	buf := []byte("first")
+	if _, err := stream.Write(buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	copy(buf, "XXXXX")
+
+	frame := <-connector.sendCh
+	if string(frame.Payload) != "first" {
+		t.Errorf("Expected queued payload 'first', got %q", frame.Payload)
+	}
+}
+
+func TestStreamManager_ValidateRemoteOpen(t *testing.T) {
+	sm := &StreamManager{
+		streams: make(map[uint32]*Stream),
+	}
+
+	if err := sm.ValidateRemoteOpen(3); err != nil {
+		t.Fatalf("Odd ID should be accepted: %v", err)
+	}
+
+	// Sai parity, dùng lại ID cũ hoặc lùi ID đều là vi phạm
+	for _, id := range []uint32{0, 4, 3, 1} {
+		if err := sm.ValidateRemoteOpen(id); !errors.Is(err, ErrProtocolViolation) {
+			t.Errorf("ID %d: expected ErrProtocolViolation, got %v", id, err)
+		}
+	}
+
+	if !sm.IsClosedID(1) || !sm.IsClosedID(3) {
+		t.Error("IDs up to the last opened stream should be closed")
+	}
+	if sm.IsClosedID(5) {
+		t.Error("ID 5 was never opened")
+	}
+
+	// Connection mới: Core bắt đầu lại từ đầu
+	sm.ResetRemoteIDs()
+	if err := sm.ValidateRemoteOpen(1); err != nil {
+		t.Errorf("ID 1 should be accepted after reset: %v", err)
+	}
+}
+
+func TestStreamManager_CloseAllOnReconnect(t *testing.T) {
+	connector := NewConnector("test", ConnectorOptions{})
+	connector.connected = true
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+
+	if err := sm.ValidateRemoteOpen(1); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := sm.CreateStream(1)
+
+	// Connection mới: stream cũ (ví dụ relay đang chờ local service) bị đóng
+	if n := sm.CloseAll(); n != 1 {
+		t.Fatalf("CloseAll closed %d streams, want 1", n)
+	}
+	sm.ResetRemoteIDs()
+	if err := sm.ValidateRemoteOpen(1); err != nil {
+		t.Fatalf("ID 1 should be accepted after reconnect: %v", err)
+	}
+	current, err := sm.CreateStream(1)
+	if err != nil {
+		t.Fatalf("Core could not reuse ID 1: %v", err)
+	}
+
+	if !old.Orphaned() || current.Orphaned() {
+		t.Error("only the stream of the previous connection should be orphaned")
+	}
+	if _, err := old.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read on the orphaned stream = %v, want EOF", err)
+	}
+	if _, err := old.Write([]byte("stale response")); !errors.Is(err, ErrConnectionClosed) {
+		t.Errorf("Write on the orphaned stream = %v, want ErrConnectionClosed", err)
+	}
+	if len(connector.sendCh) != 0 {
+		t.Errorf("orphaned stream sent %d frames on the new connection", len(connector.sendCh))
+	}
+
+	// Goroutine của stream cũ kết thúc sau reconnect: không đóng stream mới
+	if err := sm.CloseStreamOf(old); err == nil {
+		t.Error("CloseStreamOf closed a stream reusing the ID")
+	}
+	if got, ok := sm.GetStream(1); !ok || got != current {
+		t.Error("the stream of the new connection was closed")
+	}
+}
+
+func TestStreamManager_KindSetBeforePublish(t *testing.T) {
+	connector := NewConnector("test", ConnectorOptions{})
+	connector.connected = true
+	sm := NewStreamManager(connector, StreamManagerOptions{})
+
+	// Snapshot (admin API) chạy song song với việc mở stream: go test -race
+	// phát hiện nếu Kind/AgentInitiated được gán sau khi stream vào map
+	done := make(chan struct{})
+	started := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		close(started)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			for _, info := range sm.Snapshot() {
+				if info.Kind == "" {
+					t.Errorf("stream %d published without kind", info.ID)
+					return
+				}
+			}
+		}
+	}()
+	<-started
+
+	for i := 0; i < 100; i++ {
+		if _, err := sm.OpenStream(context.Background(), StreamKindTCP, map[string]string{"priority": "low"}, nil); err != nil {
+			t.Fatalf("OpenStream: %v", err)
+		}
+		<-connector.queueFor(PriorityLow)
+		if _, err := sm.CreateStreamKind(uint32(2*i+1), StreamKindExec, nil); err != nil {
+			t.Fatalf("CreateStreamKind: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	for _, info := range sm.Snapshot() {
+		if info.AgentInitiated != IsAgentInitiatedID(info.ID) {
+			t.Errorf("stream %d: AgentInitiated = %v", info.ID, info.AgentInitiated)
+		}
+	}
+	stream, _ := sm.GetStream(2)
+	if stream.Kind != StreamKindTCP || stream.Priority() != PriorityLow {
+		t.Errorf("OpenStream stream: kind %q priority %v", stream.Kind, stream.Priority())
+	}
+}
+
+func TestStreamManager_RemoteLimits(t *testing.T) {
+	mock := clock.NewMock(time.Unix(0, 0))
+	sm := NewStreamManager(nil, StreamManagerOptions{Clock: mock, MaxRemoteStreams: 2, RemoteOpenRate: 3})
+
+	// Tối đa 2 streams đồng thời
+	for _, id := range []uint32{1, 3} {
+		if err := sm.ValidateRemoteOpen(id); err != nil {
+			t.Fatalf("stream %d: %v", id, err)
+		}
+		sm.CreateStream(id)
+	}
+	if err := sm.ValidateRemoteOpen(5); !errors.Is(err, ErrStreamLimit) {
+		t.Fatalf("third concurrent stream: got %v, want ErrStreamLimit", err)
+	}
+	sm.CloseStream(1)
+
+	// 3 opens mỗi giây: streams 1, 3 và 7 dùng hết burst (stream 5 bị từ chối
+	// trước khi lấy token)
+	if err := sm.ValidateRemoteOpen(7); err != nil {
+		t.Fatalf("stream 7 after close: %v", err)
+	}
+	sm.CloseStream(3)
+	if err := sm.ValidateRemoteOpen(9); !errors.Is(err, ErrStreamLimit) {
+		t.Fatalf("open beyond rate: got %v, want ErrStreamLimit", err)
+	}
+	mock.Advance(time.Second)
+	if err := sm.ValidateRemoteOpen(11); err != nil {
+		t.Errorf("open after refill: %v", err)
+	}
+}
+
+func TestStreamReset_Codes(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ResetCode
+	}{
+		{fmt.Errorf("failed to create stream: %w", ErrStreamAlreadyExists), ResetStreamExists},
+		{fmt.Errorf("%w: 32 streams already open", ErrStreamLimit), ResetStreamLimit},
+		{fmt.Errorf("%w: stream 2 does not use core parity", ErrProtocolViolation), ResetProtocolError},
+		{ErrStreamNotFound, ResetStreamClosed},
+		{ErrMemoryPressure, ResetMemoryPressure},
+		{errors.New("boom"), ResetInternal},
+	}
+	for _, tt := range tests {
+		frame := NewStreamReset(5, tt.err)
+		if frame.StreamID != 5 || frame.Type != v1.FrameClose || frame.Flags&v1.FlagError == 0 {
+			t.Fatalf("reset frame = type %d flags %#x stream %d", frame.Type, frame.Flags, frame.StreamID)
+		}
+		code, reason := ParseReset(frame)
+		if code != tt.want || reason != tt.err.Error() {
+			t.Errorf("%v: parsed (%q, %q), want (%q, %q)", tt.err, code, reason, tt.want, tt.err.Error())
+		}
+	}
+
+	// Reset frame không có code (peer cũ)
+	if code, reason := ParseReset(NewResetFrame(5, "stream not found: late data")); code != "" || reason != "stream not found: late data" {
+		t.Errorf("legacy reset parsed as (%q, %q)", code, reason)
+	}
+}
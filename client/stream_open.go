@@ -0,0 +1,98 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Stream kinds. Kind được truyền trong open header của FrameOpenStream
+// để bên nhận biết cách xử lý stream (HTTP request, event, ...).
+const (
+	StreamKindHTTP  = "http"
+	StreamKindEvent = "event"
+	StreamKindTCP   = "tcp"
+	StreamKindSOCKS = "socks"
+)
+
+// openHeaderPrefix đánh dấu payload FrameOpenStream có open header.
+// Payload không có prefix này được coi là raw HTTP request (legacy).
+const openHeaderPrefix = "TUNNEL/1 "
+
+// maxOpenMetadata là số metadata lines tối đa trong open header
+const maxOpenMetadata = 64
+
+// EncodeOpenPayload tạo payload cho FrameOpenStream gồm open header và body
+// Format: "TUNNEL/1 <kind>\r\nKey: Value\r\n...\r\n\r\n<body>"
+// Kind, key hoặc value chứa CR/LF (và key chứa ':') là lỗi: chúng sẽ thêm
+// metadata lines hoặc kết thúc header sớm và đẩy phần còn lại vào body.
+func EncodeOpenPayload(kind string, metadata map[string]string, body []byte) ([]byte, error) {
+	if kind == "" || strings.ContainsAny(kind, "\r\n") {
+		return nil, fmt.Errorf("%w: stream kind %q", ErrInvalidMetadata, kind)
+	}
+	for k, v := range metadata {
+		if k == "" || strings.ContainsAny(k, "\r\n:") {
+			return nil, fmt.Errorf("%w: key %q", ErrInvalidMetadata, k)
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, fmt.Errorf("%w: value of %q contains CR or LF", ErrInvalidMetadata, k)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(openHeaderPrefix)
+	buf.WriteString(kind)
+	buf.WriteString("\r\n")
+
+	// Sort keys để payload deterministic
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf.WriteString(fmt.Sprintf("%s: %s\r\n", k, metadata[k]))
+	}
+
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+// ParseOpenPayload parse payload của FrameOpenStream
+// Returns: kind, metadata, body, error
+func ParseOpenPayload(payload []byte) (string, map[string]string, []byte, error) {
+	metadata := make(map[string]string)
+
+	if !bytes.HasPrefix(payload, []byte(openHeaderPrefix)) {
+		// Legacy payload: raw HTTP request
+		return StreamKindHTTP, metadata, payload, nil
+	}
+
+	parts := bytes.SplitN(payload, []byte("\r\n\r\n"), 2)
+	if len(parts) < 2 {
+		return "", nil, nil, fmt.Errorf("invalid open header: missing terminator")
+	}
+
+	lines := strings.Split(string(parts[0]), "\r\n")
+	if len(lines)-1 > maxOpenMetadata {
+		return "", nil, nil, fmt.Errorf("%w: open header has more than %d metadata lines", ErrProtocolViolation, maxOpenMetadata)
+	}
+	kind := strings.TrimSpace(strings.TrimPrefix(lines[0], openHeaderPrefix))
+	if kind == "" {
+		return "", nil, nil, fmt.Errorf("invalid open header: empty stream kind")
+	}
+
+	for _, line := range lines[1:] {
+		colonIndex := strings.Index(line, ":")
+		if colonIndex == -1 {
+			continue
+		}
+		key := strings.TrimSpace(line[:colonIndex])
+		value := strings.TrimSpace(line[colonIndex+1:])
+		metadata[key] = value
+	}
+
+	return kind, metadata, parts[1], nil
+}
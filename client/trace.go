@@ -0,0 +1,68 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// metaTraceID là stream metadata key của tunnel trace ID trong open header
+const metaTraceID = "trace_id"
+
+// TraceHeader mang trace ID của stream tới local service (request) và về
+// client public (response), để một request được đối chiếu qua logs của
+// agent, Core và local service
+const TraceHeader = tunnelHeaderPrefix + "Trace-Id"
+
+// maxTraceIDLen là độ dài tối đa của trace ID nhận từ Core
+const maxTraceIDLen = 64
+
+// NewTraceID tạo trace ID ngẫu nhiên 128-bit dạng hex (cùng format trace-id
+// của W3C traceparent)
+func NewTraceID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validTraceID kiểm tra trace ID an toàn để đưa vào headers và logs
+func validTraceID(id string) bool {
+	if id == "" || len(id) > maxTraceIDLen {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// TraceID trả về trace ID của stream, "" nếu chưa có
+func (s *Stream) TraceID() string {
+	id, _ := s.GetMetadata(metaTraceID)
+	return id
+}
+
+// EnsureTraceID trả về trace ID Core gửi trong open header; stream không có
+// trace ID (Core cũ) hoặc có giá trị không hợp lệ được gán ID mới, để logs và
+// headers của agent vẫn đối chiếu được với nhau
+func (s *Stream) EnsureTraceID() string {
+	if id := s.TraceID(); validTraceID(id) {
+		return id
+	}
+	id := NewTraceID()
+	s.SetMetadata(metaTraceID, id)
+	return id
+}
+
+// withTraceID trả về bản sao metadata có trace ID cho stream agent mở tới Core
+func withTraceID(metadata map[string]string) map[string]string {
+	out := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		out[k] = v
+	}
+	if !validTraceID(out[metaTraceID]) {
+		out[metaTraceID] = NewTraceID()
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStream_EnsureTraceID(t *testing.T) {
+	for _, tt := range []struct {
+		name, meta string
+		keep       bool
+	}{
+		{"from core", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"missing", "", false},
+		{"invalid", "a b\tc", false},
+		{"too long", strings.Repeat("a", maxTraceIDLen+1), false},
+	} {
+		stream := &Stream{}
+		if tt.meta != "" {
+			stream.SetMetadata(metaTraceID, tt.meta)
+		}
+		id := stream.EnsureTraceID()
+		if tt.keep && id != tt.meta || !tt.keep && (id == tt.meta || len(id) != 32) {
+			t.Errorf("%s: trace ID = %q", tt.name, id)
+		}
+		if again := stream.EnsureTraceID(); again != id || stream.TraceID() != id {
+			t.Errorf("%s: trace ID changed from %q to %q", tt.name, id, again)
+		}
+	}
+}
+
+func TestLocalForwarder_TraceHeader(t *testing.T) {
+	var seen string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(TraceHeader)
+	}))
+	defer backend.Close()
+
+	// Core không gửi trace ID: agent tạo ID, header của client bị thay thế
+	lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: backend.URL})
+	stream, connector := newTestExecStream(t, nil)
+	result, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: a\r\nX-Tunnel-Trace-Id: spoofed\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+	if result.TraceID == "" || result.TraceID != stream.TraceID() || seen != result.TraceID {
+		t.Errorf("result trace ID %q, stream %q, local service saw %q", result.TraceID, stream.TraceID(), seen)
+	}
+
+	var resp strings.Builder
+	for len(connector.sendCh) > 0 {
+		resp.Write((<-connector.sendCh).Payload)
+	}
+	if want := TraceHeader + ": " + result.TraceID + "\r\n"; !strings.Contains(resp.String(), want) {
+		t.Errorf("response missing %q:\n%s", want, resp.String())
+	}
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// prepareTrailers chuyển response có trailers sang chunked encoding, vì
+// trailers chỉ gửi được sau chunk cuối. Trả về false nếu response không có
+// trailers hoặc là HTTP/1.0 (không có chunked encoding, trailers bị bỏ).
+// Gọi qua normalizeFraming.
+func prepareTrailers(resp *http.Response) bool {
+	if len(resp.Trailer) == 0 || !resp.ProtoAtLeast(1, 1) {
+		return false
+	}
+
+	keys := make([]string, 0, len(resp.Trailer))
+	for key := range resp.Trailer {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	resp.Header.Del("Content-Length")
+	resp.Header.Set("Transfer-Encoding", "chunked")
+	resp.Header.Set("Trailer", strings.Join(keys, ", "))
+	return true
+}
+
+// chunkedBody ghi body dạng chunked vào w, mỗi Write là một chunk (và một
+// frame); Close ghi chunk cuối kèm trailers của resp
+type chunkedBody struct {
+	w    io.Writer
+	resp *http.Response
+}
+
+// Write ghi p thành một chunk
+func (c *chunkedBody) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	chunk := make([]byte, 0, len(p)+16)
+	chunk = strconv.AppendInt(chunk, int64(len(p)), 16)
+	chunk = append(chunk, "\r\n"...)
+	chunk = append(chunk, p...)
+	chunk = append(chunk, "\r\n"...)
+	if _, err := c.w.Write(chunk); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close ghi chunk cuối và trailers. Giá trị trailers chỉ có sau khi body của
+// resp đã được đọc hết, nên Close phải được gọi sau khi copy body.
+func (c *chunkedBody) Close() error {
+	var buf bytes.Buffer
+	buf.WriteString("0\r\n")
+	for key, values := range c.resp.Trailer {
+		for _, value := range values {
+			fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+		}
+	}
+	buf.WriteString("\r\n")
+	_, err := c.w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLocalForwarder_Trailers(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte("hello "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("world"))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	defer backend.Close()
+
+	lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: backend.URL})
+	stream, connector := newTestExecStream(t, nil)
+	if _, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: app\r\n\r\n")); err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+
+	var raw strings.Builder
+	for len(connector.sendCh) > 0 {
+		raw.Write((<-connector.sendCh).Payload)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(raw.String())), nil)
+	if err != nil {
+		t.Fatalf("Invalid response %q: %v", raw.String(), err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Invalid chunked body %q: %v", raw.String(), err)
+	}
+	if string(body) != "hello world" {
+		t.Errorf("body = %q, want hello world", body)
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("trailer Grpc-Status = %q, want 0; response:\n%s", got, raw.String())
+	}
+}
+
+func TestLocalForwarder_EarlyHints(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Del("Link")
+		w.Write([]byte("page"))
+	}))
+	defer backend.Close()
+
+	lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: backend.URL})
+	stream, connector := newTestExecStream(t, nil)
+	if _, err := lf.ForwardRequest(context.Background(), stream, []byte("GET / HTTP/1.1\r\nHost: app\r\n\r\n")); err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+
+	var raw strings.Builder
+	for len(connector.sendCh) > 0 {
+		raw.Write((<-connector.sendCh).Payload)
+	}
+	r := bufio.NewReader(strings.NewReader(raw.String()))
+	hints, err := http.ReadResponse(r, nil)
+	if err != nil || hints.StatusCode != http.StatusEarlyHints {
+		t.Fatalf("expected 103 first, got %v (%v):\n%s", hints, err, raw.String())
+	}
+	if hints.Header.Get("Link") == "" {
+		t.Errorf("103 should carry the Link header:\n%s", raw.String())
+	}
+	final, err := http.ReadResponse(r, nil)
+	if err != nil || final.StatusCode != http.StatusOK {
+		t.Fatalf("expected final 200, got %v (%v):\n%s", final, err, raw.String())
+	}
+}
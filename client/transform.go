@@ -0,0 +1,253 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// maxTransformBody là kích thước tối đa của JSON body được transform; body lớn hơn
+// được forward nguyên vẹn
+const maxTransformBody = 1 << 20
+
+// TransformSpec mô tả transformation của một route bằng Go templates
+type TransformSpec struct {
+	Request  MessageTransformSpec
+	Response MessageTransformSpec
+}
+
+// MessageTransformSpec mô tả transformation của request hoặc response.
+// Headers được sửa trước, rồi tới JSON body; trong mỗi phần Remove chạy trước Set.
+type MessageTransformSpec struct {
+	// SetHeaders ghi đè headers bằng kết quả template; kết quả rỗng xoá header
+	SetHeaders map[string]string
+	// RemoveHeaders xoá headers
+	RemoveHeaders []string
+
+	// SetJSON đặt field của JSON body theo dotted path ("user.id"). Kết quả template
+	// là JSON hợp lệ (số, bool, object, ...) được giữ kiểu, còn lại là string.
+	SetJSON map[string]string
+	// RemoveJSON xoá fields theo dotted path
+	RemoveJSON []string
+}
+
+// TransformData là dữ liệu của templates
+type TransformData struct {
+	Method   string
+	Path     string
+	Query    string
+	Host     string
+	ClientIP string
+	Metadata map[string]string
+
+	// Header là request headers (sau khi agent thêm forwarded headers)
+	Header http.Header
+
+	// Status và ResponseHeader chỉ có khi transform response
+	Status         int
+	ResponseHeader http.Header
+
+	// Body là JSON body đã decode của message đang transform (nil nếu không phải JSON)
+	Body any
+}
+
+// Transform là TransformSpec đã compile
+type Transform struct {
+	request  messageTransform
+	response messageTransform
+}
+
+type messageTransform struct {
+	setHeaders    map[string]*template.Template
+	removeHeaders []string
+	setJSON       map[string]*template.Template
+	removeJSON    []string
+}
+
+// transformFuncs là functions dùng được trong templates
+var transformFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"default": func(fallback, value any) any {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// CompileTransform compile các templates của spec
+func CompileTransform(spec TransformSpec) (*Transform, error) {
+	request, err := compileMessageTransform("request", spec.Request)
+	if err != nil {
+		return nil, err
+	}
+	response, err := compileMessageTransform("response", spec.Response)
+	if err != nil {
+		return nil, err
+	}
+	return &Transform{request: request, response: response}, nil
+}
+
+func compileMessageTransform(kind string, spec MessageTransformSpec) (messageTransform, error) {
+	mt := messageTransform{
+		setHeaders:    make(map[string]*template.Template, len(spec.SetHeaders)),
+		removeHeaders: spec.RemoveHeaders,
+		setJSON:       make(map[string]*template.Template, len(spec.SetJSON)),
+		removeJSON:    spec.RemoveJSON,
+	}
+	for key, text := range spec.SetHeaders {
+		tmpl, err := template.New(kind + " header " + key).Funcs(transformFuncs).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return mt, fmt.Errorf("%s header %s: %w", kind, key, err)
+		}
+		mt.setHeaders[key] = tmpl
+	}
+	for path, text := range spec.SetJSON {
+		tmpl, err := template.New(kind + " json " + path).Funcs(transformFuncs).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return mt, fmt.Errorf("%s json %s: %w", kind, path, err)
+		}
+		mt.setJSON[path] = tmpl
+	}
+	return mt, nil
+}
+
+// hasJSON kiểm tra transform có sửa JSON body không
+func (mt messageTransform) hasJSON() bool {
+	return len(mt.setJSON) > 0 || len(mt.removeJSON) > 0
+}
+
+// applyHeaders sửa headers h theo transform
+func (mt messageTransform) applyHeaders(h http.Header, data *TransformData) error {
+	for _, key := range mt.removeHeaders {
+		h.Del(key)
+	}
+	for key, tmpl := range mt.setHeaders {
+		value, err := execute(tmpl, data)
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			h.Del(key)
+			continue
+		}
+		h.Set(key, value)
+	}
+	return nil
+}
+
+// applyJSON trả về body sau khi sửa JSON fields. ok là false khi body không phải
+// JSON object (body được giữ nguyên).
+func (mt messageTransform) applyJSON(body []byte, data *TransformData) ([]byte, bool, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return body, false, nil
+	}
+	data.Body = doc
+
+	for _, path := range mt.removeJSON {
+		removeJSONPath(doc, path)
+	}
+	for path, tmpl := range mt.setJSON {
+		raw, err := execute(tmpl, data)
+		if err != nil {
+			return body, false, err
+		}
+		var value any
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		setJSONPath(doc, path, value)
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return body, false, err
+	}
+	return out, true, nil
+}
+
+// execute chạy template và trả về kết quả
+func execute(tmpl *template.Template, data *TransformData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("transform %s: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// setJSONPath đặt value tại dotted path, tạo objects trung gian khi cần
+func setJSONPath(doc map[string]any, path string, value any) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := doc[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			doc[key] = next
+		}
+		doc = next
+	}
+	doc[keys[len(keys)-1]] = value
+}
+
+// removeJSONPath xoá field tại dotted path nếu tồn tại
+func removeJSONPath(doc map[string]any, path string) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := doc[key].(map[string]any)
+		if !ok {
+			return
+		}
+		doc = next
+	}
+	delete(doc, keys[len(keys)-1])
+}
+
+// isJSONContent kiểm tra Content-Type là JSON (application/json hoặc +json)
+func isJSONContent(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// transformBody đọc body (tối đa maxTransformBody), áp dụng JSON transform và trả
+// về reader mới cùng độ dài. Body quá lớn hoặc không phải JSON object được giữ nguyên
+// (length -1 nghĩa là không đổi).
+func transformBody(body io.Reader, mt messageTransform, data *TransformData) (io.Reader, int64, error) {
+	buf, err := io.ReadAll(io.LimitReader(body, maxTransformBody+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(buf) > maxTransformBody {
+		return io.MultiReader(bytes.NewReader(buf), body), -1, nil
+	}
+
+	out, ok, err := mt.applyJSON(buf, data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ok {
+		return bytes.NewReader(buf), -1, nil
+	}
+	return bytes.NewReader(out), int64(len(out)), nil
+}
+
+// setContentLength cập nhật Content-Length sau khi body bị transform
+func setContentLength(h http.Header, length int64) {
+	h.Del("Transfer-Encoding")
+	h.Set("Content-Length", strconv.FormatInt(length, 10))
+}
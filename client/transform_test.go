@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTransform_RequestAndResponse(t *testing.T) {
+	var gotBody map[string]any
+	var gotHeader http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		data, _ := io.ReadAll(r.Body)
+		if int64(len(data)) != r.ContentLength {
+			t.Errorf("ContentLength = %d, body has %d bytes", r.ContentLength, len(data))
+		}
+		json.Unmarshal(data, &gotBody)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Internal", "secret")
+		w.Write([]byte(`{"id":7,"internal":{"node":"db-1"}}`))
+	}))
+	defer backend.Close()
+
+	transform, err := CompileTransform(TransformSpec{
+		Request: MessageTransformSpec{
+			SetHeaders:    map[string]string{"X-Api-Version": "2", "X-Caller": `{{ .Header.Get "X-User" | upper }}`},
+			RemoveHeaders: []string{"Cookie"},
+			SetJSON:       map[string]string{"meta.client_ip": "{{ .ClientIP }}", "meta.path": "{{ .Path }}", "count": "{{ .Body.n }}"},
+			RemoveJSON:    []string{"debug"},
+		},
+		Response: MessageTransformSpec{
+			RemoveHeaders: []string{"X-Internal"},
+			SetJSON:       map[string]string{"status": "{{ .Status }}", "method": "{{ .Method }}"},
+			RemoveJSON:    []string{"internal.node"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CompileTransform: %v", err)
+	}
+
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		Backends: []Backend{{Path: "/api", URL: backend.URL, Transform: transform}},
+	})
+	body := `{"n":3,"debug":true}`
+	req := "POST /api/items HTTP/1.1\r\nHost: a\r\nContent-Type: application/json\r\nX-User: alice\r\nCookie: s=1\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+	stream, connector := newTestExecStream(t, map[string]string{"client_ip": "203.0.113.7"})
+	close(stream.dataOut)
+	if _, err := lf.ForwardRequest(context.Background(), stream, []byte(req)); err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+
+	if gotHeader.Get("X-Caller") != "ALICE" || gotHeader.Get("X-Api-Version") != "2" || gotHeader.Get("Cookie") != "" {
+		t.Errorf("unexpected request headers: %v", gotHeader)
+	}
+	meta, _ := gotBody["meta"].(map[string]any)
+	if meta["client_ip"] != "203.0.113.7" || meta["path"] != "/api/items" {
+		t.Errorf("meta = %v", gotBody["meta"])
+	}
+	if gotBody["count"] != float64(3) {
+		t.Errorf("count = %#v, want number 3", gotBody["count"])
+	}
+	if _, ok := gotBody["debug"]; ok {
+		t.Errorf("debug should be removed: %v", gotBody)
+	}
+
+	var resp strings.Builder
+	for len(connector.sendCh) > 0 {
+		resp.Write((<-connector.sendCh).Payload)
+	}
+	_, respBody, _ := strings.Cut(resp.String(), "\r\n\r\n")
+	if respBody != `{"id":7,"internal":{},"method":"POST","status":200}` {
+		t.Errorf("response body = %s", respBody)
+	}
+	if !strings.Contains(resp.String(), "Content-Length: "+strconv.Itoa(len(respBody))+"\r\n") {
+		t.Errorf("Content-Length not updated:\n%s", resp.String())
+	}
+	if strings.Contains(resp.String(), "X-Internal") {
+		t.Errorf("X-Internal should be removed:\n%s", resp.String())
+	}
+}
+
+func TestTransform_NonJSONUnchanged(t *testing.T) {
+	transform, err := CompileTransform(TransformSpec{
+		Response: MessageTransformSpec{SetJSON: map[string]string{"a": "1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := &TransformData{}
+	resp := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader("[1,2]")),
+	}
+	body, err := (&LocalForwarder{}).transformResponse(resp, transform, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := io.ReadAll(body)
+	if string(out) != "[1,2]" {
+		t.Errorf("non-object JSON should be unchanged, got %s", out)
+	}
+}
+
+func TestCompileTransform_InvalidTemplate(t *testing.T) {
+	_, err := CompileTransform(TransformSpec{
+		Request: MessageTransformSpec{SetHeaders: map[string]string{"X-A": "{{ .Method "}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "request header X-A") {
+		t.Errorf("expected template error naming the header, got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Transport mở connections tới Core. Connection trả về là net.Conn: Connector
+// gửi frames qua Write (writeLoop), Dispatcher đọc frames qua Read và
+// connection được đóng bằng Close khi Disconnect.
+type Transport interface {
+	// Dial mở connection mới tới addr
+	Dial(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// tcpTransport là Transport mặc định: TCP, TLS nếu tlsConfig != nil
+type tcpTransport struct {
+	tlsConfig   *tls.Config
+	bindAddress string
+	socket      SocketOptions
+}
+
+// Dial implements Transport
+func (t *tcpTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	netDialer := net.Dialer{Control: t.socket.control()}
+	if t.bindAddress != "" {
+		localAddr, err := ResolveBindAddress(t.bindAddress)
+		if err != nil {
+			return nil, fmt.Errorf("bind address: %w", err)
+		}
+		netDialer.LocalAddr = localAddr
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if t.tlsConfig != nil {
+		dialer := &tls.Dialer{NetDialer: &netDialer, Config: t.tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = netDialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := t.socket.apply(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("socket options: %w", err)
+	}
+	return conn, nil
+}
+
+// MemoryTransport là Transport in-memory cho tests và simulation mode: mỗi Dial
+// tạo một cặp connections nối với nhau, đầu phía Core được nhận qua Accept.
+// MemoryTransport cũng là net.Listener nên fake Core (simcore) dùng trực tiếp
+// được, không cần sockets thật.
+//
+// Khác net.Pipe, mỗi chiều có buffer (không giới hạn) nên Write không chờ đầu
+// kia đọc: như TCP, hai phía cùng ghi không bị deadlock.
+type MemoryTransport struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMemoryTransport tạo MemoryTransport
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+// Dial implements Transport; addr bị bỏ qua. Dial block cho tới khi phía Core
+// Accept, ctx bị huỷ hoặc transport bị Close.
+func (t *MemoryTransport) Dial(ctx context.Context, _ string) (net.Conn, error) {
+	agent, core := newMemoryPipe()
+	select {
+	case t.conns <- core:
+		return agent, nil
+	case <-ctx.Done():
+		err := ctx.Err()
+		agent.Close()
+		core.Close()
+		return nil, err
+	case <-t.closed:
+		agent.Close()
+		core.Close()
+		return nil, fmt.Errorf("memory transport: %w", net.ErrClosed)
+	}
+}
+
+// Accept implements net.Listener: trả về đầu phía Core của connection kế tiếp
+func (t *MemoryTransport) Accept() (net.Conn, error) {
+	select {
+	case conn := <-t.conns:
+		return conn, nil
+	case <-t.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener; Dial và Accept sau đó trả về net.ErrClosed
+func (t *MemoryTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
+
+// Addr implements net.Listener
+func (t *MemoryTransport) Addr() net.Addr {
+	return memoryAddr{}
+}
+
+// memoryAddr là địa chỉ của MemoryTransport
+type memoryAddr struct{}
+
+func (memoryAddr) Network() string { return "memory" }
+func (memoryAddr) String() string  { return "memory" }
+
+// newMemoryPipe tạo cặp connections in-memory nối với nhau
+func newMemoryPipe() (net.Conn, net.Conn) {
+	toCore, toAgent := newMemoryBuffer(), newMemoryBuffer()
+	agent := &memoryConn{in: toAgent, out: toCore}
+	core := &memoryConn{in: toCore, out: toAgent}
+	return agent, core
+}
+
+// memoryBuffer là một chiều của memory connection
+type memoryBuffer struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	eof      bool          // phía ghi đã Close: Read trả về io.EOF sau khi hết data
+	closed   bool          // phía đọc đã Close: Write trả về io.ErrClosedPipe
+	deadline time.Time     // read deadline
+	wake     chan struct{} // đóng (và thay mới) khi state thay đổi
+}
+
+func newMemoryBuffer() *memoryBuffer {
+	return &memoryBuffer{wake: make(chan struct{})}
+}
+
+// notifyLocked đánh thức Read đang chờ
+func (b *memoryBuffer) notifyLocked() {
+	close(b.wake)
+	b.wake = make(chan struct{})
+}
+
+func (b *memoryBuffer) read(p []byte) (int, error) {
+	for {
+		b.mu.Lock()
+		switch {
+		case b.closed:
+			b.mu.Unlock()
+			return 0, net.ErrClosed
+		case b.buf.Len() > 0:
+			n, _ := b.buf.Read(p)
+			b.mu.Unlock()
+			return n, nil
+		case b.eof:
+			b.mu.Unlock()
+			return 0, io.EOF
+		}
+		wake, deadline := b.wake, b.deadline
+		b.mu.Unlock()
+
+		if deadline.IsZero() {
+			<-wake
+			continue
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (b *memoryBuffer) write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed || b.eof {
+		return 0, io.ErrClosedPipe
+	}
+	b.buf.Write(p)
+	b.notifyLocked()
+	return len(p), nil
+}
+
+// memoryConn là một đầu của memory connection
+type memoryConn struct {
+	in, out *memoryBuffer
+}
+
+func (c *memoryConn) Read(p []byte) (int, error)  { return c.in.read(p) }
+func (c *memoryConn) Write(p []byte) (int, error) { return c.out.write(p) }
+func (c *memoryConn) LocalAddr() net.Addr         { return memoryAddr{} }
+func (c *memoryConn) RemoteAddr() net.Addr        { return memoryAddr{} }
+
+// Close đóng cả hai chiều: Read của đầu kia trả về io.EOF sau khi hết data
+func (c *memoryConn) Close() error {
+	for _, b := range []*memoryBuffer{c.in, c.out} {
+		b.mu.Lock()
+		if b == c.in {
+			b.closed = true
+		} else {
+			b.eof = true
+		}
+		b.notifyLocked()
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+func (c *memoryConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *memoryConn) SetReadDeadline(t time.Time) error {
+	c.in.mu.Lock()
+	c.in.deadline = t
+	c.in.notifyLocked()
+	c.in.mu.Unlock()
+	return nil
+}
+
+// SetWriteDeadline không có tác dụng: Write không bao giờ block
+func (c *memoryConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
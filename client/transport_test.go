@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+func TestMemoryTransport_ConnectorAndDispatcher(t *testing.T) {
+	transport := NewMemoryTransport()
+	defer transport.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := transport.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	connector := NewConnector("memory", ConnectorOptions{Transport: transport})
+	defer connector.Close()
+	if err := connector.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	core := <-accepted
+	defer core.Close()
+
+	// Agent → Core qua writeLoop
+	sent := &v1.Frame{Version: v1.Version, Type: v1.FrameHeartbeat, Flags: v1.FlagNone, StreamID: v1.StreamIDControl, Payload: []byte("ping")}
+	if err := connector.SendFrameWait(context.Background(), sent); err != nil {
+		t.Fatalf("SendFrameWait failed: %v", err)
+	}
+	core.SetReadDeadline(time.Now().Add(5 * time.Second))
+	length, err := v1.ReadFrameLength(core)
+	if err != nil {
+		t.Fatalf("read frame length: %v", err)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(core, buf); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	if frame, err := v1.ParseFrame(buf); err != nil || string(frame.Payload) != "ping" {
+		t.Fatalf("Core received %v, %v", frame, err)
+	}
+
+	// Core → agent qua dispatcher; Core đóng connection = EOF
+	received := make(chan *v1.Frame, 1)
+	closed := make(chan struct{})
+	d := NewDispatcher(DispatcherOptions{
+		ControlHandler:     func(f *v1.Frame) error { received <- f; return nil },
+		OnConnectionClosed: func() { close(closed) },
+	})
+	conn, _ := connector.GetConnection()
+	d.SetConnection(conn)
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer d.Stop()
+
+	v1.Encode(core, &v1.Frame{Version: v1.Version, Type: v1.FrameHeartbeat, Flags: v1.FlagAck, StreamID: v1.StreamIDControl, Payload: []byte("pong")})
+	select {
+	case f := <-received:
+		if string(f.Payload) != "pong" {
+			t.Errorf("dispatcher received %q, want pong", f.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatcher did not receive frame")
+	}
+
+	core.Close()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatcher did not see Core closing the connection")
+	}
+}
+
+func TestMemoryTransport_ConnSemantics(t *testing.T) {
+	agent, core := newMemoryPipe()
+
+	// Write không chờ đầu kia đọc
+	if _, err := agent.Write([]byte("buffered")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	core.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	buf := make([]byte, 16)
+	if n, err := core.Read(buf); err != nil || string(buf[:n]) != "buffered" {
+		t.Fatalf("Read = %q, %v", buf[:n], err)
+	}
+	if _, err := core.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read past deadline: got %v, want os.ErrDeadlineExceeded", err)
+	}
+
+	// Data đã ghi trước Close vẫn đọc được, sau đó là EOF
+	core.SetReadDeadline(time.Time{})
+	agent.Write([]byte("last"))
+	agent.Close()
+	if n, err := core.Read(buf); err != nil || string(buf[:n]) != "last" {
+		t.Fatalf("Read after Close = %q, %v", buf[:n], err)
+	}
+	if _, err := core.Read(buf); err != io.EOF {
+		t.Errorf("Read after drain: got %v, want io.EOF", err)
+	}
+	if _, err := core.Write([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Write to closed peer: got %v, want io.ErrClosedPipe", err)
+	}
+	if _, err := agent.Read(buf); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Read on closed conn: got %v, want net.ErrClosed", err)
+	}
+}
+
+func TestMemoryTransport_DialAfterClose(t *testing.T) {
+	transport := NewMemoryTransport()
+	transport.Close()
+
+	if _, err := transport.Dial(context.Background(), "memory"); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Dial: got %v, want net.ErrClosed", err)
+	}
+	if _, err := transport.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept: got %v, want net.ErrClosed", err)
+	}
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+// defaultUnmatchedTemplate là landing page mặc định cho requests không khớp route nào
+const defaultUnmatchedTemplate = `<!DOCTYPE html>
+<html>
+<head><title>No route for {{.Host}}</title></head>
+<body>
+<h1>No route for {{.Host}}{{.Path}}</h1>
+<p>This tunnel ({{.Agent}}) does not serve this address.</p>
+{{- if .Routes}}
+<p>Available routes:</p>
+<ul>
+{{- range .Routes}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`
+
+// UnmatchedOptions cấu hình response cho requests không khớp backend nào
+type UnmatchedOptions struct {
+	// Status code của response (default 404)
+	Status int
+
+	// ContentType của response (default text/html); template được escape
+	// theo HTML khi content type là HTML
+	ContentType string
+
+	// Template là Go template nhận UnmatchedData (default: landing page liệt kê routes)
+	Template string
+
+	// Agent là tên agent hiển thị trong template
+	Agent string
+}
+
+// UnmatchedData là dữ liệu truyền vào template của Unmatched
+type UnmatchedData struct {
+	Agent  string
+	Host   string
+	Path   string
+	Routes []string
+}
+
+// Unmatched trả response từ template cho requests không khớp route nào thay
+// vì forward tới default URL
+type Unmatched struct {
+	status      int
+	contentType string
+	agent       string
+	tmpl        interface {
+		Execute(w io.Writer, data any) error
+	}
+}
+
+// CompileUnmatched compile template của opts
+func CompileUnmatched(opts UnmatchedOptions) (*Unmatched, error) {
+	if opts.Status == 0 {
+		opts.Status = http.StatusNotFound
+	}
+	if opts.ContentType == "" {
+		opts.ContentType = "text/html; charset=utf-8"
+	}
+	if opts.Template == "" {
+		opts.Template = defaultUnmatchedTemplate
+	}
+
+	u := &Unmatched{status: opts.Status, contentType: opts.ContentType, agent: opts.Agent}
+	var err error
+	if strings.Contains(opts.ContentType, "html") {
+		u.tmpl, err = htmltemplate.New("unmatched").Option("missingkey=zero").Parse(opts.Template)
+	} else {
+		u.tmpl, err = texttemplate.New("unmatched").Option("missingkey=zero").Parse(opts.Template)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// writeUnmatched render template của lf.unmatched và ghi response vào w
+func (lf *LocalForwarder) writeUnmatched(w io.Writer, host, path string) error {
+	var body bytes.Buffer
+	data := UnmatchedData{Agent: lf.unmatched.agent, Host: host, Path: path, Routes: lf.routeList()}
+	if err := lf.unmatched.tmpl.Execute(&body, data); err != nil {
+		return err
+	}
+
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		StatusCode: lf.unmatched.status,
+		Status:     strconv.Itoa(lf.unmatched.status) + " " + http.StatusText(lf.unmatched.status),
+		Header:     make(http.Header),
+	}
+	resp.Header.Set("Content-Type", lf.unmatched.contentType)
+	resp.Header.Set("Content-Length", strconv.Itoa(body.Len()))
+	resp.Header.Set("Cache-Control", "no-store")
+	if err := lf.writeResponseHeader(w, resp); err != nil {
+		return err
+	}
+	_, err := w.Write(body.Bytes())
+	return err
+}
+
+// routeList trả về host+path của các backends (sorted), không gồm default backend
+func (lf *LocalForwarder) routeList() []string {
+	lf.mu.RLock()
+	defer lf.mu.RUnlock()
+
+	var routes []string
+	for host, backends := range lf.backends {
+		for _, b := range backends {
+			if host == "" && b.Path == "" {
+				continue
+			}
+			routes = append(routes, host+b.Path)
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
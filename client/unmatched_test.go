@@ -0,0 +1,63 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLocalForwarder_Unmatched(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer backend.Close()
+
+	unmatched, err := CompileUnmatched(UnmatchedOptions{Agent: "edge-1"})
+	if err != nil {
+		t.Fatalf("CompileUnmatched failed: %v", err)
+	}
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		DefaultURL: backend.URL,
+		Services:   map[string]string{"api": backend.URL, "": backend.URL},
+		Unmatched:  unmatched,
+	})
+
+	resp := forwardAndRead(t, lf, "GET /x HTTP/1.1\r\nHost: <script>.example.com\r\n\r\n")
+	for _, want := range []string{"HTTP/1.1 404 Not Found\r\n", "edge-1", "<li>api</li>", "&lt;script&gt;"} {
+		if !strings.Contains(resp, want) {
+			t.Errorf("unmatched response missing %q:\n%s", want, resp)
+		}
+	}
+	if hits.Load() != 0 {
+		t.Errorf("unmatched request should not reach the default backend, got %d hits", hits.Load())
+	}
+
+	resp = forwardAndRead(t, lf, "GET /x HTTP/1.1\r\nHost: api.example.com\r\n\r\n")
+	if !strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n") || hits.Load() != 1 {
+		t.Errorf("matched request should be forwarded, got %d hits:\n%s", hits.Load(), resp)
+	}
+}
+
+func TestCompileUnmatched_TextTemplate(t *testing.T) {
+	unmatched, err := CompileUnmatched(UnmatchedOptions{
+		Status:      http.StatusServiceUnavailable,
+		ContentType: "text/plain",
+		Template:    "no route for {{.Host}} & {{len .Routes}} routes",
+	})
+	if err != nil {
+		t.Fatalf("CompileUnmatched failed: %v", err)
+	}
+	lf := NewLocalForwarder(LocalForwarderOptions{Unmatched: unmatched})
+
+	resp := forwardAndRead(t, lf, "GET / HTTP/1.1\r\nHost: a.example.com\r\n\r\n")
+	if !strings.HasPrefix(resp, "HTTP/1.1 503 Service Unavailable\r\n") || !strings.HasSuffix(resp, "no route for a.example.com & 0 routes") {
+		t.Errorf("Unexpected response:\n%s", resp)
+	}
+
+	if _, err := CompileUnmatched(UnmatchedOptions{Template: "{{.Host"}); err == nil {
+		t.Error("invalid template should fail to compile")
+	}
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+// warmUpTimeout giới hạn thời gian mở mỗi connection warm-up
+const warmUpTimeout = 5 * time.Second
+
+// warmTarget là một local service cần warm-up và client dùng để gọi nó
+type warmTarget struct {
+	origin string // scheme://host:port
+	client *http.Client
+	auth   *BackendAuth
+}
+
+// WarmUp mở sẵn WarmConns keep-alive connections tới mỗi local service, để
+// requests đầu tiên qua tunnel không phải chờ TCP/TLS handshake. Mỗi
+// connection được mở bằng một HEAD request tới root của service rồi nằm lại
+// trong keep-alive pool; mọi HTTP response đều tính là thành công. Backends
+// MQTT, ConnectionClose và ConnectionFresh không dùng pool nên được bỏ qua.
+// Trả về số connections đã mở và số lần thất bại.
+func (lf *LocalForwarder) WarmUp(ctx context.Context) (warmed, failed int) {
+	if lf.warmConns <= 0 {
+		return 0, 0
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, target := range lf.warmTargets() {
+		// Các requests chạy song song để mỗi request dial connection riêng
+		for i := 0; i < lf.warmConns; i++ {
+			wg.Add(1)
+			go func(target warmTarget) {
+				defer wg.Done()
+				ok := warmConn(ctx, target)
+				metrics.GetMetrics().RecordWarmConn(ok)
+				mu.Lock()
+				if ok {
+					warmed++
+				} else {
+					failed++
+				}
+				mu.Unlock()
+			}(target)
+		}
+	}
+	wg.Wait()
+	return warmed, failed
+}
+
+// warmTargets trả về các local services dùng keep-alive pool, mỗi origin và
+// client một lần
+func (lf *LocalForwarder) warmTargets() []warmTarget {
+	backends := lf.Backends()
+	if defaultURL := lf.GetDefaultURL(); defaultURL != "" {
+		backends = append(backends, Backend{URL: defaultURL})
+	}
+
+	type key struct {
+		origin string
+		client *http.Client
+	}
+	seen := make(map[key]bool)
+	var targets []warmTarget
+	for _, backend := range backends {
+		if backend.MQTT != nil || backend.Connection == ConnectionClose || backend.Connection == ConnectionFresh {
+			continue
+		}
+		u, err := url.Parse(backend.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		target := warmTarget{origin: u.Scheme + "://" + u.Host, client: lf.clientFor(backend), auth: backend.Auth}
+		k := key{target.origin, target.client}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// warmConn mở một connection tới target và trả nó về pool
+func warmConn(ctx context.Context, target warmTarget) bool {
+	ctx, cancel := context.WithTimeout(ctx, warmUpTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target.origin+"/", nil)
+	if err != nil {
+		return false
+	}
+	target.auth.apply(req)
+	resp, err := target.client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
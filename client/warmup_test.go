@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLocalForwarder_WarmUp(t *testing.T) {
+	var conns, heads atomic.Int64
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+		}
+	}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	lf := NewLocalForwarder(LocalForwarderOptions{
+		DefaultURL: backend.URL,
+		Backends: []Backend{
+			{Host: "api", URL: backend.URL + "/api"}, // cùng origin với default
+			{Host: "fresh", URL: backend.URL, Connection: ConnectionFresh},
+		},
+		WarmConns: 4,
+	})
+	warmed, failed := lf.WarmUp(context.Background())
+	if warmed != 4 || failed != 0 {
+		t.Fatalf("WarmUp = %d warmed, %d failed, want 4 and 0", warmed, failed)
+	}
+	if heads.Load() != 4 || conns.Load() != 4 {
+		t.Fatalf("backend saw %d HEAD requests on %d connections, want 4 on 4", heads.Load(), conns.Load())
+	}
+
+	// Requests sau warm-up dùng connections có sẵn trong pool
+	for i := 0; i < 4; i++ {
+		resp, err := lf.httpClient.Get(backend.URL)
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if conns.Load() != 4 {
+		t.Errorf("backend saw %d connections after warm-up, want the 4 warmed ones reused", conns.Load())
+	}
+}
+
+func TestLocalForwarder_WarmUpFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	lf := NewLocalForwarder(LocalForwarderOptions{DefaultURL: "http://" + addr, WarmConns: 2})
+	if warmed, failed := lf.WarmUp(context.Background()); warmed != 0 || failed != 2 {
+		t.Errorf("WarmUp = %d warmed, %d failed, want 0 and 2", warmed, failed)
+	}
+}
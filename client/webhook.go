@@ -0,0 +1,244 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Các scheme chữ ký webhook
+const (
+	// WebhookSchemeHMAC: header chứa prefix + HMAC của body (cấu hình được)
+	WebhookSchemeHMAC = "hmac"
+	// WebhookSchemeGitHub: X-Hub-Signature-256: sha256=<hex HMAC-SHA256 của body>
+	WebhookSchemeGitHub = "github"
+	// WebhookSchemeStripe: Stripe-Signature: t=<unix>,v1=<hex HMAC-SHA256 của "t.body">
+	WebhookSchemeStripe = "stripe"
+)
+
+// defaultWebhookMaxBody là kích thước body tối đa được đọc để kiểm tra chữ ký
+const defaultWebhookMaxBody = 1 << 20
+
+// defaultWebhookTolerance là độ lệch tối đa của timestamp (Stripe) so với giờ agent
+const defaultWebhookTolerance = 5 * time.Minute
+
+var (
+	// ErrInvalidSignature khi chữ ký webhook thiếu hoặc không khớp; agent trả 401
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrWebhookBodyTooLarge khi body vượt MaxBody; agent trả 413
+	ErrWebhookBodyTooLarge = errors.New("webhook body too large")
+)
+
+// WebhookOptions cấu hình kiểm tra chữ ký webhook của một route. Các scheme
+// github và stripe điền sẵn Header, Algorithm, Prefix và Encoding; giá trị
+// khác rỗng ghi đè.
+type WebhookOptions struct {
+	Scheme string
+	Secret []byte
+
+	// Header chứa chữ ký (hmac: bắt buộc)
+	Header string
+	// Algorithm là sha1, sha256 (default) hoặc sha512
+	Algorithm string
+	// Prefix đứng trước chữ ký trong header (ví dụ "sha256=")
+	Prefix string
+	// Encoding của chữ ký: hex (default) hoặc base64
+	Encoding string
+
+	// Tolerance là độ lệch tối đa của timestamp với scheme stripe (default 5m)
+	Tolerance time.Duration
+	// MaxBody là số bytes body tối đa được kiểm tra (default 1 MiB); body lớn hơn nhận 413
+	MaxBody int64
+}
+
+// WebhookVerifier kiểm tra chữ ký HMAC của webhook trước khi request tới
+// local service. Body được đọc hết vào memory (tối đa MaxBody) để tính chữ
+// ký, rồi gửi tới local service với Content-Length.
+type WebhookVerifier struct {
+	scheme    string
+	secret    []byte
+	header    string
+	hash      func() hash.Hash
+	prefix    string
+	base64    bool
+	tolerance time.Duration
+	maxBody   int64
+}
+
+// NewWebhookVerifier tạo verifier từ opts
+func NewWebhookVerifier(opts WebhookOptions) (*WebhookVerifier, error) {
+	switch opts.Scheme {
+	case WebhookSchemeGitHub:
+		opts.Header = orDefault(opts.Header, "X-Hub-Signature-256")
+		opts.Prefix = orDefault(opts.Prefix, "sha256=")
+	case WebhookSchemeStripe:
+		opts.Header = orDefault(opts.Header, "Stripe-Signature")
+	case WebhookSchemeHMAC:
+		if opts.Header == "" {
+			return nil, errors.New("header is required for the hmac scheme")
+		}
+	default:
+		return nil, fmt.Errorf("unknown webhook scheme %q", opts.Scheme)
+	}
+	if len(opts.Secret) == 0 {
+		return nil, errors.New("secret is empty")
+	}
+
+	v := &WebhookVerifier{
+		scheme:    opts.Scheme,
+		secret:    opts.Secret,
+		header:    opts.Header,
+		prefix:    opts.Prefix,
+		tolerance: opts.Tolerance,
+		maxBody:   opts.MaxBody,
+	}
+	switch orDefault(opts.Algorithm, "sha256") {
+	case "sha1":
+		v.hash = sha1.New
+	case "sha256":
+		v.hash = sha256.New
+	case "sha512":
+		v.hash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", opts.Algorithm)
+	}
+	switch orDefault(opts.Encoding, "hex") {
+	case "hex":
+	case "base64":
+		v.base64 = true
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", opts.Encoding)
+	}
+	if v.tolerance <= 0 {
+		v.tolerance = defaultWebhookTolerance
+	}
+	if v.maxBody <= 0 {
+		v.maxBody = defaultWebhookMaxBody
+	}
+	return v, nil
+}
+
+func orDefault(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
+
+// readBody đọc body để kiểm tra chữ ký, tối đa maxBody bytes
+func (v *WebhookVerifier) readBody(body io.Reader) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	buf, err := io.ReadAll(io.LimitReader(body, v.maxBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > v.maxBody {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrWebhookBodyTooLarge, v.maxBody)
+	}
+	return buf, nil
+}
+
+// verify kiểm tra chữ ký của body; lỗi wrap ErrInvalidSignature
+func (v *WebhookVerifier) verify(headers http.Header, body []byte, now time.Time) error {
+	value := strings.TrimSpace(headers.Get(v.header))
+	if value == "" {
+		return fmt.Errorf("%w: missing %s header", ErrInvalidSignature, v.header)
+	}
+	if v.scheme == WebhookSchemeStripe {
+		return v.verifyTimestamped(value, body, now)
+	}
+
+	signature, ok := strings.CutPrefix(value, v.prefix)
+	if !ok {
+		return fmt.Errorf("%w: %s does not start with %q", ErrInvalidSignature, v.header, v.prefix)
+	}
+	if !v.equal(signature, v.sign(body)) {
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// verifyTimestamped kiểm tra header dạng Stripe "t=<unix>,v1=<sig>[,v1=<sig>]":
+// chữ ký là HMAC của "<t>.<body>" và t phải nằm trong tolerance
+func (v *WebhookVerifier) verifyTimestamped(value string, body []byte, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = val
+		case "v1":
+			signatures = append(signatures, val)
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %s has no valid timestamp", ErrInvalidSignature, v.header)
+	}
+	if skew := now.Sub(time.Unix(unix, 0)); skew > v.tolerance || skew < -v.tolerance {
+		return fmt.Errorf("%w: timestamp is %s away from agent time", ErrInvalidSignature, skew.Round(time.Second))
+	}
+
+	expected := v.sign(append([]byte(timestamp+"."), body...))
+	for _, signature := range signatures {
+		if v.equal(signature, expected) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: signature mismatch", ErrInvalidSignature)
+}
+
+func (v *WebhookVerifier) sign(data []byte) []byte {
+	mac := hmac.New(v.hash, v.secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// equal so sánh chữ ký đã encode với MAC trong constant time
+func (v *WebhookVerifier) equal(signature string, mac []byte) bool {
+	var decoded []byte
+	var err error
+	if v.base64 {
+		decoded, err = base64.StdEncoding.DecodeString(signature)
+	} else {
+		decoded, err = hex.DecodeString(strings.ToLower(signature))
+	}
+	return err == nil && hmac.Equal(decoded, mac)
+}
+
+// writeWebhookRejected ghi 401 khi chữ ký không hợp lệ, 413 khi body quá lớn
+func (lf *LocalForwarder) writeWebhookRejected(w io.Writer, err error) error {
+	status, body := http.StatusUnauthorized, "invalid signature\n"
+	if errors.Is(err, ErrWebhookBodyTooLarge) {
+		status, body = http.StatusRequestEntityTooLarge, "payload too large\n"
+	}
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     make(http.Header),
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	if err := lf.writeResponseHeader(w, resp); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, body)
+	return err
+}
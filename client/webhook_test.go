@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hmacSHA256(secret, data string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func TestWebhookVerifier_Verify(t *testing.T) {
+	const secret, body = "s3cret", `{"action":"opened"}`
+	now := time.Unix(1700000000, 0)
+	github, _ := NewWebhookVerifier(WebhookOptions{Scheme: WebhookSchemeGitHub, Secret: []byte(secret)})
+	stripe, _ := NewWebhookVerifier(WebhookOptions{Scheme: WebhookSchemeStripe, Secret: []byte(secret)})
+	shopify, _ := NewWebhookVerifier(WebhookOptions{Scheme: WebhookSchemeHMAC, Secret: []byte(secret), Header: "X-Shopify-Hmac-Sha256", Encoding: "base64"})
+
+	githubSig := "sha256=" + hex.EncodeToString(hmacSHA256(secret, body))
+	stripeSig := func(ts time.Time, payload string) string {
+		t := fmt.Sprint(ts.Unix())
+		return "t=" + t + ",v1=" + hex.EncodeToString(hmacSHA256(secret, t+"."+payload))
+	}
+
+	tests := []struct {
+		name     string
+		verifier *WebhookVerifier
+		header   string
+		value    string
+		body     string
+		wantErr  string
+	}{
+		{"github", github, "X-Hub-Signature-256", githubSig, body, ""},
+		{"github missing header", github, "X-Other", githubSig, body, "missing X-Hub-Signature-256"},
+		{"github without prefix", github, "X-Hub-Signature-256", strings.TrimPrefix(githubSig, "sha256="), body, "does not start with"},
+		{"github modified body", github, "X-Hub-Signature-256", githubSig, body + " ", "signature mismatch"},
+		{"stripe", stripe, "Stripe-Signature", stripeSig(now.Add(-time.Minute), body) + ",v1=00", body, ""},
+		{"stripe old timestamp", stripe, "Stripe-Signature", stripeSig(now.Add(-10*time.Minute), body), body, "away from agent time"},
+		{"stripe without timestamp", stripe, "Stripe-Signature", "v1=00", body, "no valid timestamp"},
+		{"stripe modified body", stripe, "Stripe-Signature", stripeSig(now, body), "{}", "signature mismatch"},
+		{"hmac base64", shopify, "X-Shopify-Hmac-Sha256", base64.StdEncoding.EncodeToString(hmacSHA256(secret, body)), body, ""},
+		{"hmac wrong secret", shopify, "X-Shopify-Hmac-Sha256", base64.StdEncoding.EncodeToString(hmacSHA256("other", body)), body, "signature mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.verifier.verify(http.Header{tt.header: {tt.value}}, []byte(tt.body), now)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("verify failed: %v", err)
+			case tt.wantErr != "" && (!errors.Is(err, ErrInvalidSignature) || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got %v, want ErrInvalidSignature containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewWebhookVerifier_Invalid(t *testing.T) {
+	for _, opts := range []WebhookOptions{
+		{Scheme: "gitlab", Secret: []byte("s")},
+		{Scheme: WebhookSchemeHMAC, Secret: []byte("s")},
+		{Scheme: WebhookSchemeGitHub},
+		{Scheme: WebhookSchemeGitHub, Secret: []byte("s"), Algorithm: "md5"},
+		{Scheme: WebhookSchemeGitHub, Secret: []byte("s"), Encoding: "base32"},
+	} {
+		if _, err := NewWebhookVerifier(opts); err == nil {
+			t.Errorf("NewWebhookVerifier(%+v) succeeded, want error", opts)
+		}
+	}
+}
+
+func TestLocalForwarder_Webhook(t *testing.T) {
+	const secret = "s3cret"
+	received := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r.Header.Get("Content-Length") + " " + string(body)
+	}))
+	defer backend.Close()
+
+	verifier, err := NewWebhookVerifier(WebhookOptions{Scheme: WebhookSchemeGitHub, Secret: []byte(secret), MaxBody: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf := NewLocalForwarder(LocalForwarderOptions{})
+	lf.AddBackend(Backend{Host: "hooks", URL: backend.URL, Webhook: verifier})
+
+	request := func(body, signature string) string {
+		return "POST /github HTTP/1.1\r\nHost: hooks\r\nContent-Length: " + fmt.Sprint(len(body)) +
+			"\r\nX-Hub-Signature-256: " + signature + "\r\n\r\n" + body
+	}
+
+	// Chữ ký hợp lệ: body tới local service nguyên vẹn
+	const body = `{"ok":true}`
+	stream, _ := newTestExecStream(t, nil)
+	close(stream.dataOut)
+	if _, err := lf.ForwardRequest(context.Background(), stream, []byte(request(body, "sha256="+hex.EncodeToString(hmacSHA256(secret, body))))); err != nil {
+		t.Fatalf("ForwardRequest failed: %v", err)
+	}
+	if got, want := <-received, fmt.Sprintf("%d %s", len(body), body); got != want {
+		t.Errorf("local service received %q, want %q", got, want)
+	}
+
+	// Chữ ký sai: 401; body quá MaxBody: 413; local service không được gọi
+	for _, tt := range []struct {
+		body, signature, status string
+	}{
+		{body, "sha256=" + hex.EncodeToString(hmacSHA256("other", body)), "401"},
+		{`{"payload":"too large"}`, "sha256=00", "413"},
+	} {
+		stream, connector := newTestExecStream(t, nil)
+		close(stream.dataOut)
+		result, err := lf.ForwardRequest(context.Background(), stream, []byte(request(tt.body, tt.signature)))
+		if err != nil {
+			t.Fatalf("ForwardRequest failed: %v", err)
+		}
+		resp := string((<-connector.sendCh).Payload)
+		if result.Source != SourceInvalidSignature || !strings.HasPrefix(resp, "HTTP/1.1 "+tt.status) {
+			t.Errorf("source %q, response %q, want %s", result.Source, resp, tt.status)
+		}
+	}
+	select {
+	case got := <-received:
+		t.Errorf("local service received rejected webhook %q", got)
+	default:
+	}
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"net"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// vectoredWriteMin là payload size tối thiểu để ghi frame bằng writev thay vì
+// copy qua bufio.Writer; nhỏ hơn thì coalescing frames nhỏ có lợi hơn
+const vectoredWriteMin = 4 * 1024
+
+// frameVector thu các writes của v1.Encode thành net.Buffers. Write trùng với
+// frame payload được giữ nguyên slice (payload thuộc frame, không bị sửa sau khi
+// enqueue), các writes khác (header) được copy vì io.Writer không được giữ p.
+type frameVector struct {
+	payload []byte
+	bufs    net.Buffers
+}
+
+func (v *frameVector) Write(p []byte) (int, error) {
+	if len(p) > 0 && len(p) == len(v.payload) && &p[0] == &v.payload[0] {
+		v.bufs = append(v.bufs, p)
+	} else {
+		v.bufs = append(v.bufs, append([]byte(nil), p...))
+	}
+	return len(p), nil
+}
+
+// writeFrame encode frame vào w. Frame có payload lớn được ghi thẳng vào dst
+// bằng net.Buffers (writev trên TCP) sau khi flush w để giữ thứ tự frames,
+// nên header và payload không phải copy vào một buffer chung.
+func writeFrame(w *bufio.Writer, dst io.Writer, frame *v1.Frame) error {
+	if len(frame.Payload) < vectoredWriteMin {
+		return v1.Encode(w, frame)
+	}
+
+	vec := frameVector{payload: frame.Payload}
+	if err := v1.Encode(&vec, frame); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := vec.bufs.WriteTo(dst)
+	return err
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+func TestWriteFrame_MatchesEncode(t *testing.T) {
+	frames := []*v1.Frame{
+		{Version: v1.Version, Type: v1.FrameData, Flags: v1.FlagNone, StreamID: 1, Payload: []byte("small")},
+		{Version: v1.Version, Type: v1.FrameData, Flags: v1.FlagNone, StreamID: 3, Payload: bytes.Repeat([]byte("L"), 3*vectoredWriteMin)},
+		{Version: v1.Version, Type: v1.FrameData, Flags: v1.FlagEndStream, StreamID: 1},
+	}
+
+	var want bytes.Buffer
+	for _, frame := range frames {
+		if err := v1.Encode(&want, frame); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+	}
+
+	// Frame nhỏ nằm trong bufio, frame lớn đi thẳng: thứ tự bytes phải giữ nguyên
+	var got bytes.Buffer
+	w := bufio.NewWriterSize(&got, 4*1024)
+	for _, frame := range frames {
+		if err := writeFrame(w, &got, frame); err != nil {
+			t.Fatalf("writeFrame: %v", err)
+		}
+	}
+	w.Flush()
+
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("writeFrame output differs from v1.Encode (%d vs %d bytes)", got.Len(), want.Len())
+	}
+}
+
+// loopbackConn trả về TCP connection tới listener loopback đọc và bỏ mọi data
+func loopbackConn(b *testing.B) net.Conn {
+	b.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("listen: %v", err)
+	}
+	b.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, conn)
+		conn.Close()
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		b.Fatalf("dial: %v", err)
+	}
+	b.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func BenchmarkWriteFrame(b *testing.B) {
+	for _, size := range []int{1 << 10, 16 << 10, 64 << 10, 1 << 20} {
+		if size > int(v1.MaxFrameSize-v1.HeaderSize) {
+			continue
+		}
+		frame := &v1.Frame{Version: v1.Version, Type: v1.FrameData, Flags: v1.FlagNone, StreamID: 1, Payload: make([]byte, size)}
+
+		b.Run(fmt.Sprintf("encode/payload=%d", size), func(b *testing.B) {
+			conn := loopbackConn(b)
+			w := bufio.NewWriterSize(conn, 4*1024)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := v1.Encode(w, frame); err != nil {
+					b.Fatal(err)
+				}
+				w.Flush()
+			}
+		})
+
+		b.Run(fmt.Sprintf("writev/payload=%d", size), func(b *testing.B) {
+			conn := loopbackConn(b)
+			w := bufio.NewWriterSize(conn, 4*1024)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := writeFrame(w, conn, frame); err != nil {
+					b.Fatal(err)
+				}
+				w.Flush()
+			}
+		})
+	}
+}
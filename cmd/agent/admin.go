@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// fileTransferRequest là body của /files/push và /files/pull
+type fileTransferRequest struct {
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+}
+
+// registerFileTransferHandlers đăng ký file transfer endpoints vào admin API.
+// Endpoints cần admin token và chỉ đọc/ghi file trong dir.
+func registerFileTransferHandlers(server *admin.Server, ft *client.FileTransfer, token, dir string) {
+	handle := func(op string) http.HandlerFunc {
+		return admin.RequireToken(token, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				admin.WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+				return
+			}
+
+			var req fileTransferRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+				return
+			}
+			if req.Local == "" || req.Remote == "" {
+				admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("local and remote paths are required"))
+				return
+			}
+			local, err := confinePath(dir, req.Local)
+			if err != nil {
+				admin.WriteError(w, http.StatusForbidden, err)
+				return
+			}
+			req.Local = local
+
+			var result *client.FileTransferResult
+			if op == client.FileOpPush {
+				result, err = ft.Push(r.Context(), req.Local, req.Remote)
+			} else {
+				result, err = ft.Pull(r.Context(), req.Remote, req.Local)
+			}
+			if err != nil {
+				logger.Error("File transfer failed", "op", op, "local", req.Local, "remote", req.Remote, "error", err)
+				admin.WriteError(w, http.StatusBadGateway, err)
+				return
+			}
+
+			logger.Info("File transfer completed",
+				"op", op,
+				"local", req.Local,
+				"remote", req.Remote,
+				"bytes", result.Transferred,
+				"duration", result.Duration,
+			)
+			admin.WriteJSON(w, http.StatusOK, result)
+		})
+	}
+
+	server.Handle("/files/push", handle(client.FileOpPush))
+	server.Handle("/files/pull", handle(client.FileOpPull))
+}
+
+// confinePath trả về path thật của local (symlinks của thư mục cha đã được
+// resolve) nếu nó nằm trong dir. File của pull có thể chưa tồn tại nên chỉ
+// thư mục cha được resolve; bản thân local và file tạm local+".part" của pull
+// không được là symlink.
+func confinePath(dir, local string) (string, error) {
+	if !filepath.IsAbs(local) {
+		return "", fmt.Errorf("local path %q must be absolute", local)
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("files directory: %w", err)
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(filepath.Clean(local)))
+	if err != nil {
+		return "", fmt.Errorf("local path %q: %w", local, err)
+	}
+	resolved := filepath.Join(parent, filepath.Base(local))
+	for _, path := range []string{resolved, resolved + ".part"} {
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("local path %q is a symlink", path)
+		}
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("local path %q is outside %s", local, dir)
+	}
+	return resolved, nil
+}
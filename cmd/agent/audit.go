@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hydragon2m/tunnel-agent/internal/audit"
+)
+
+// runAuditVerify thực thi lệnh `agent audit-verify <file>` kiểm tra hash chain của audit log
+func runAuditVerify(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: agent audit-verify <audit-log-file>")
+		return 2
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open audit log: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	count, err := audit.Verify(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit log INVALID after %d valid records: %v\n", count, err)
+		return 1
+	}
+
+	fmt.Printf("audit log OK: %d records, hash chain intact\n", count)
+	return 0
+}
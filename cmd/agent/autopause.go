@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/health"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// autoPause probe default local service định kỳ; khi service unreachable
+// liên tục quá after, agent báo Core ngừng route tới agent này (RouteStatus)
+// và báo lại khi probe thấy service phục hồi
+type autoPause struct {
+	after      time.Duration
+	interval   time.Duration
+	url        func() string
+	connector  *client.Connector
+	check      *health.Check
+	httpClient *http.Client
+
+	paused    atomic.Bool
+	downSince time.Time // chỉ dùng trong job jobLocalProbe
+}
+
+func newAutoPause(after, interval time.Duration, url func() string, connector *client.Connector, check *health.Check) *autoPause {
+	return &autoPause{
+		after:     after,
+		interval:  interval,
+		url:       url,
+		connector: connector,
+		check:     check,
+		httpClient: &http.Client{
+			Timeout: interval,
+			// Redirects vẫn chứng tỏ service đang chạy
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// schedule thêm job probe local service mỗi interval
+func (p *autoPause) schedule() {
+	scheduleJob(jobLocalProbe, p.interval, 0, func(ctx context.Context) {
+		p.probe(ctx, time.Now())
+	})
+}
+
+// probe kiểm tra local service một lần và pause/resume khi cần
+func (p *autoPause) probe(ctx context.Context, now time.Time) {
+	err := p.reach(ctx)
+	if err == nil {
+		p.downSince = time.Time{}
+		if p.paused.CompareAndSwap(true, false) {
+			logger.Info("Local service recovered, resuming routing")
+			p.check.UpdateCheck(health.HealthStatusHealthy, "Local service recovered")
+			p.send(ctx, true, "")
+			return
+		}
+		// Request lỗi trước đó để check degraded/unhealthy; probe thành công
+		// là đủ để healthy lại, không phải chờ request kế tiếp
+		if status, _, _ := p.check.GetStatus(); status != health.HealthStatusHealthy {
+			p.check.UpdateCheck(health.HealthStatusHealthy, "Local service responding to probes")
+		}
+		return
+	}
+
+	if p.downSince.IsZero() {
+		p.downSince = now
+	}
+	down := now.Sub(p.downSince)
+	if down >= p.after && p.paused.CompareAndSwap(false, true) {
+		reason := fmt.Sprintf("local service unreachable for %s: %v", down.Round(time.Second), err)
+		logger.Warn("Local service down, asking Core to pause routing", "url", p.url(), "down_for", down.Round(time.Second), "error", err)
+		p.check.UpdateCheck(health.HealthStatusUnhealthy, "Paused: "+reason)
+		p.send(ctx, false, reason)
+	}
+}
+
+// reach trả về lỗi nếu không kết nối được tới local service; mọi HTTP
+// response (kể cả 5xx) đều chứng tỏ service còn chạy
+func (p *autoPause) reach(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// resend gửi lại trạng thái paused sau khi reconnect, vì Core mới (hoặc
+// connection mới) không biết agent đang pause
+func (p *autoPause) resend(ctx context.Context) {
+	if p != nil && p.paused.Load() {
+		p.send(ctx, false, "local service still unreachable")
+	}
+}
+
+func (p *autoPause) send(ctx context.Context, routable bool, reason string) {
+	if !p.connector.IsConnected() {
+		return
+	}
+	frame, err := client.NewRouteStatusFrame(routable, reason)
+	if err == nil {
+		err = p.connector.SendFrame(ctx, frame)
+	}
+	if err != nil {
+		logger.Warn("Failed to send route status", "routable", routable, "error", err)
+	}
+}
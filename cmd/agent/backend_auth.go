@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/config"
+	"github.com/hydragon2m/tunnel-agent/internal/keyring"
+	"github.com/hydragon2m/tunnel-agent/internal/secrets"
+)
+
+// backendAuth chuyển auth của một backend thành BackendAuth: đọc secrets từ
+// OS keyring, environment hoặc secret file và load client certificate, nil nếu
+// không cấu hình
+func backendAuth(a config.BackendAuthConfig) (*client.BackendAuth, error) {
+	if a.Empty() {
+		return nil, nil
+	}
+
+	auth := &client.BackendAuth{Username: a.Username}
+	var err error
+	if a.Bearer != "" {
+		if auth.Bearer, err = resolveSecret(a.Bearer); err != nil {
+			return nil, fmt.Errorf("bearer: %w", err)
+		}
+	}
+	if a.Password != "" {
+		if auth.Password, err = resolveSecret(a.Password); err != nil {
+			return nil, fmt.Errorf("password: %w", err)
+		}
+	}
+
+	if a.ClientCert != "" || a.CA != "" {
+		auth.TLS = &tls.Config{}
+	}
+	if a.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(a.ClientCert, a.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("client_cert: %w", err)
+		}
+		auth.TLS.Certificates = []tls.Certificate{cert}
+	}
+	if a.CA != "" {
+		pem, err := os.ReadFile(a.CA)
+		if err != nil {
+			return nil, fmt.Errorf("ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca: no PEM certificates in %s", a.CA)
+		}
+		auth.TLS.RootCAs = pool
+	}
+	return auth, nil
+}
+
+// webhookVerifier tạo kiểm tra chữ ký webhook của một backend với secret đọc
+// qua resolveSecret, nil nếu không cấu hình
+func webhookVerifier(w config.WebhookConfig) (*client.WebhookVerifier, error) {
+	if w.Scheme == "" {
+		return nil, nil
+	}
+	secret, err := resolveSecret(w.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("secret: %w", err)
+	}
+	return client.NewWebhookVerifier(client.WebhookOptions{
+		Scheme:    w.Scheme,
+		Secret:    []byte(secret),
+		Header:    w.Header,
+		Algorithm: w.Algorithm,
+		Prefix:    w.Prefix,
+		Encoding:  w.Encoding,
+		Tolerance: w.Tolerance,
+		MaxBody:   w.MaxBody,
+	})
+}
+
+// resolveSecret đọc giá trị của secret reference (keyring:<account>,
+// env:<NAME>, ${NAME}, file:<path> hoặc secret manager: vault:, aws-sm:,
+// gcp-sm:). Secret không đọc được hoặc rỗng luôn là lỗi, không bao giờ thành
+// credential rỗng.
+func resolveSecret(ref string) (string, error) {
+	source, name, err := config.ParseSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+	switch source {
+	case "keyring":
+		secret, err := keyring.Get(keyring.Service, name)
+		if err != nil {
+			return "", fmt.Errorf("keyring account %q: %w (store it with `agent login -account %s`)", name, err, name)
+		}
+		return secret, nil
+	case "file":
+		return config.ReadSecretFile(name)
+	case secrets.SourceVault, secrets.SourceAWS, secrets.SourceGCP:
+		return fetchSecret(source, name)
+	default:
+		secret, ok := os.LookupEnv(name)
+		if !ok || secret == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	}
+}
+
+// tokenFromConfig đọc agent token từ `token` của config file, "" nếu config
+// file không có token. Config file không load được được báo khi agent load
+// config sau đó; config không hợp lệ là lỗi trước khi secret nào được đọc.
+func tokenFromConfig(path string) (string, error) {
+	cfg, err := config.Load(path)
+	if err != nil || cfg.Token == "" {
+		return "", nil
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return "", fmt.Errorf("invalid environment configuration:\n%w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return "", fmt.Errorf("invalid config:\n%w", err)
+	}
+	initSecrets(cfg.Secrets)
+	secret, err := resolveSecret(cfg.Token)
+	if err != nil {
+		return "", fmt.Errorf("token: %w", err)
+	}
+	tokenSecretRef = cfg.Token
+	return secret, nil
+}
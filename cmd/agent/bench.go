@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/buildinfo"
+	"github.com/hydragon2m/tunnel-agent/internal/health"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/simcore"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// runBench thực thi `agent bench`: chạy simulated Core, echo backend và agent pipeline
+// (dispatcher → stream manager → forwarder) trong cùng process, gửi synthetic requests
+// và báo throughput, allocations và latency percentiles của hot path.
+//
+//	agent bench -n 10000 -c 32 -size 4096
+//
+// Với -replay, requests được lấy lần lượt (quay vòng) từ file do `agent -record`
+// ghi thay cho synthetic body; chỉ lỗi transport được tính là failed vì echo
+// backend không trả lại response đã record.
+//
+//	agent bench -replay traffic.ndjson -n 1000
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	requests := fs.Int("n", 5000, "Total number of requests")
+	concurrency := fs.Int("c", 16, "Number of concurrent requests")
+	size := fs.Int("size", 1024, "Request body size in bytes (echoed back by the backend)")
+	timeout := fs.Duration("timeout", 30*time.Second, "Per-request timeout")
+	replay := fs.String("replay", "", "Replay requests recorded by `agent -record` (NDJSON or HAR) instead of synthetic ones")
+	fs.Parse(args)
+
+	if *requests <= 0 || *concurrency <= 0 || *size < 0 {
+		fmt.Fprintln(os.Stderr, "-n and -c must be positive, -size must not be negative")
+		return 2
+	}
+
+	var recorded []client.RecordedExchange
+	if *replay != "" {
+		var err error
+		if recorded, err = loadReplay(*replay); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load %s: %v\n", *replay, err)
+			return 1
+		}
+	}
+
+	logger.InitLogger("error", false)
+
+	// 1. Echo backend
+	backendLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start echo backend: %v\n", err)
+		return 1
+	}
+	backend := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// HTTP/1.x server không full-duplex: đọc hết body trước khi ghi response
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	})}
+	go backend.Serve(backendLn)
+	defer backend.Close()
+
+	// 2. Simulated Core
+	sim := simcore.NewServer("")
+	if err := sim.Start("127.0.0.1:0", "127.0.0.1:0"); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start simulated core: %v\n", err)
+		return 1
+	}
+	defer sim.Close()
+
+	// 3. Agent pipeline
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	connector, err := startBenchAgent(ctx, sim.Addr(), "http://"+backendLn.Addr().String(), *timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start agent: %v\n", err)
+		return 1
+	}
+	defer connector.Close()
+
+	select {
+	case <-sim.Ready():
+	case <-time.After(10 * time.Second):
+		fmt.Fprintln(os.Stderr, "agent did not authenticate with the simulated core")
+		return 1
+	}
+
+	var send benchSender
+	if recorded != nil {
+		fmt.Printf("Replaying %d recorded requests from %s as %d requests, concurrency %d\n", len(recorded), *replay, *requests, *concurrency)
+		send = func(ctx context.Context, n int64) (int64, error) {
+			return replayRequest(ctx, sim, recorded[n%int64(len(recorded))])
+		}
+	} else {
+		fmt.Printf("Running %d requests, concurrency %d, body %d bytes\n", *requests, *concurrency, *size)
+		body := make([]byte, *size)
+		for i := range body {
+			body[i] = byte('a' + i%26)
+		}
+		send = func(ctx context.Context, _ int64) (int64, error) {
+			received, err := benchRequest(ctx, sim, body)
+			return int64(len(body)) + received, err
+		}
+	}
+	result := benchRun(*requests, *concurrency, *timeout, send)
+	result.print(os.Stdout)
+	if result.failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// startBenchAgent kết nối agent pipeline tới simulated Core
+func startBenchAgent(ctx context.Context, serverAddr, backendURL string, timeout time.Duration) (*client.Connector, error) {
+	forwarder := client.NewLocalForwarder(client.LocalForwarderOptions{DefaultURL: backendURL, Timeout: timeout})
+	caps, err := client.NewCapabilities([]string{client.CapabilityHTTPForward})
+	if err != nil {
+		return nil, err
+	}
+	authenticator := client.NewAuthenticator("bench", "bench", buildinfo.Get().Version, caps.List(), nil)
+	localServiceCheck := health.GetHealthChecker().RegisterCheck("local_service")
+
+	var (
+		connector  *client.Connector
+		dispatcher *client.Dispatcher
+	)
+	connector = client.NewConnector(serverAddr, client.ConnectorOptions{
+		OnConnected: func(conn net.Conn) {
+			dispatcher.SetConnection(conn)
+			if err := dispatcher.Start(ctx); err != nil {
+				return
+			}
+			if authFrame, err := authenticator.CreateAuthFrame(); err == nil {
+				connector.SendFrame(ctx, authFrame)
+			}
+		},
+	})
+	streamManager := client.NewStreamManager(connector, client.StreamManagerOptions{})
+	dispatcher = client.NewDispatcher(client.DispatcherOptions{
+		ControlHandler: func(frame *v1.Frame) error {
+			if frame.Type == v1.FrameAuth {
+				return authenticator.HandleAuthResponse(frame)
+			}
+			return nil
+		},
+		StreamHandler: func(frame *v1.Frame) error {
+			return handleStreamFrame(ctx, frame, streamManager, nil, forwarder, nil, caps, connector, localServiceCheck)
+		},
+	})
+
+	return connector, connector.Connect(ctx)
+}
+
+// benchResult là kết quả của một lần bench
+type benchResult struct {
+	requests  int
+	failed    int64
+	bytes     int64
+	duration  time.Duration
+	latencies []time.Duration
+	mallocs   uint64
+	allocated uint64
+}
+
+// benchSender gửi request thứ n và trả về số bytes đã gửi và nhận
+type benchSender func(ctx context.Context, n int64) (int64, error)
+
+// benchRun gửi requests qua send với concurrency cho trước
+func benchRun(requests, concurrency int, timeout time.Duration, send benchSender) *benchResult {
+	latencies := make([]time.Duration, requests)
+
+	var next, failed, transferred int64
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				n := atomic.AddInt64(&next, 1) - 1
+				if n >= int64(requests) {
+					return
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				reqStart := time.Now()
+				bytes, err := send(ctx, n)
+				latencies[n] = time.Since(reqStart)
+				cancel()
+
+				if err != nil {
+					atomic.AddInt64(&failed, 1)
+					continue
+				}
+				atomic.AddInt64(&transferred, bytes)
+			}
+		}()
+	}
+	wg.Wait()
+
+	duration := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	return &benchResult{
+		requests:  requests,
+		failed:    failed,
+		bytes:     transferred,
+		duration:  duration,
+		latencies: latencies,
+		mallocs:   after.Mallocs - before.Mallocs,
+		allocated: after.TotalAlloc - before.TotalAlloc,
+	}
+}
+
+// benchRequest gửi một request qua tunnel và đọc hết response
+func benchRequest(ctx context.Context, sim *simcore.Server, body []byte) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://bench/echo", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	resp, err := sim.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	echoed, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return int64(len(echoed)), err
+	}
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(echoed, body) {
+		return int64(len(echoed)), fmt.Errorf("unexpected response: %s, %d bytes", resp.Status, len(echoed))
+	}
+	return int64(len(echoed)), nil
+}
+
+// loadReplay đọc requests đã record để replay
+func loadReplay(path string) ([]client.RecordedExchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	recorded, err := client.ReadRecording(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("no recorded requests")
+	}
+	return recorded, nil
+}
+
+// replayRequest gửi lại request đã record qua tunnel và đọc hết response.
+// Headers bị redact được gửi với giá trị [REDACTED]; body bị cắt ở
+// -record-max-body được gửi phần đã ghi.
+func replayRequest(ctx context.Context, sim *simcore.Server, e client.RecordedExchange) (int64, error) {
+	body, err := e.Request.Bytes()
+	if err != nil {
+		return 0, fmt.Errorf("recorded body: %w", err)
+	}
+	host := e.Request.Host
+	if host == "" {
+		host = "bench"
+	}
+	target := url.URL{Scheme: "http", Host: host, Path: e.Request.Path, RawQuery: e.Request.Query}
+	req, err := http.NewRequestWithContext(ctx, e.Request.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for key, values := range e.Request.Header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Host", "Content-Length", "Transfer-Encoding":
+			continue
+		}
+		req.Header[key] = values
+	}
+	resp, err := sim.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	received, err := io.Copy(io.Discard, resp.Body)
+	return int64(len(body)) + received, err
+}
+
+// print in kết quả bench
+func (r *benchResult) print(w io.Writer) {
+	sorted := append([]time.Duration(nil), r.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) time.Duration {
+		return sorted[int(float64(len(sorted)-1)*p)]
+	}
+
+	seconds := r.duration.Seconds()
+	fmt.Fprintf(w, "\nRequests:     %d (%d failed)\n", r.requests, r.failed)
+	fmt.Fprintf(w, "Duration:     %s\n", r.duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "Throughput:   %.0f req/s, %.2f MB/s\n", float64(r.requests)/seconds, float64(r.bytes)/seconds/(1<<20))
+	fmt.Fprintf(w, "Latency:      p50 %s  p90 %s  p99 %s  max %s\n",
+		percentile(0.50), percentile(0.90), percentile(0.99), sorted[len(sorted)-1])
+	fmt.Fprintf(w, "Allocations:  %d allocs/req, %d B/req (agent + simulated core)\n",
+		r.mallocs/uint64(r.requests), r.allocated/uint64(r.requests))
+}
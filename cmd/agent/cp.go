@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+)
+
+// remotePrefix đánh dấu path nằm phía Core trong lệnh cp
+const remotePrefix = "core:"
+
+// runCp thực thi lệnh `agent cp <src> <dst>` thông qua admin API của agent đang chạy.
+// Một trong hai path phải có prefix "core:", ví dụ:
+//
+//	agent cp /var/log/app.log core:/uploads/app.log
+//	agent cp core:/artifacts/build.tar.gz ./build.tar.gz
+func runCp(args []string) int {
+	fs := flag.NewFlagSet("cp", flag.ExitOnError)
+	addr := fs.String("admin-addr", admin.DefaultAddr, "Admin API address of the running agent")
+	timeout := fs.Duration("timeout", 30*time.Minute, "Transfer timeout")
+	token := fs.String("admin-token", os.Getenv("TUNNEL_AGENT_ADMIN_TOKEN"), "Admin token of the running agent (default: $TUNNEL_AGENT_ADMIN_TOKEN)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: agent cp [flags] <src> <dst>")
+		fmt.Fprintln(fs.Output(), "One of src/dst must be prefixed with \"core:\".")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	src, dst := fs.Arg(0), fs.Arg(1)
+
+	var op string
+	req := fileTransferRequest{}
+	switch {
+	case strings.HasPrefix(dst, remotePrefix) && !strings.HasPrefix(src, remotePrefix):
+		op = client.FileOpPush
+		req.Local, req.Remote = src, strings.TrimPrefix(dst, remotePrefix)
+	case strings.HasPrefix(src, remotePrefix) && !strings.HasPrefix(dst, remotePrefix):
+		op = client.FileOpPull
+		req.Local, req.Remote = dst, strings.TrimPrefix(src, remotePrefix)
+	default:
+		fmt.Fprintln(os.Stderr, "exactly one of src/dst must be prefixed with \"core:\"")
+		return 2
+	}
+
+	// Admin API chạy trong process agent, path local phải là absolute
+	local, err := filepath.Abs(req.Local)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid local path: %v\n", err)
+		return 1
+	}
+	req.Local = local
+
+	var result client.FileTransferResult
+	if err := admin.NewClient(*addr, *timeout).WithToken(*token).Do("POST", "/files/"+op, req, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "cp failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%s %s -> %s: %d bytes (resumed from %d) in %s, sha256=%s\n",
+		result.Op, src, dst, result.Transferred, result.Resumed, result.Duration.Round(time.Millisecond), result.SHA256)
+	return 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/crashloop"
+	"github.com/hydragon2m/tunnel-agent/internal/health"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// crashLoopPath trả về state file của crash-loop detection
+func crashLoopPath() string {
+	if *crashLoopFile != "" {
+		return *crashLoopFile
+	}
+	return filepath.Join(os.TempDir(), "tunnel-agent-"+*tunnelName+".starts")
+}
+
+// checkCrashLoop ghi lại lần start này; nếu agent đang crash-loop thì log, đánh
+// dấu check degraded và chờ backoff trước khi start. Process mới của graceful
+// restart không được tính. Trả về false nếu nhận SIGINT/SIGTERM trong lúc chờ.
+func checkCrashLoop(check *health.Check) bool {
+	check.UpdateCheck(health.HealthStatusHealthy, "No crash loop detected")
+	if *crashLoopStarts == 0 || isHandoffChild() {
+		return true
+	}
+
+	res, err := crashloop.RecordStart(crashloop.Options{
+		Path:     crashLoopPath(),
+		Starts:   *crashLoopStarts,
+		Window:   *crashLoopWindow,
+		MaxDelay: *crashLoopMaxDelay,
+	}, time.Now())
+	if err != nil {
+		logger.Warn("Failed to record start for crash-loop detection", "path", crashLoopPath(), "error", err)
+	}
+	if !res.Looping {
+		return true
+	}
+
+	message := fmt.Sprintf("Crash loop: %d starts within %s", res.Starts, *crashLoopWindow)
+	check.UpdateCheck(health.HealthStatusDegraded, message)
+	logger.Error("Agent is crash-looping, delaying startup",
+		"starts", res.Starts,
+		"window", *crashLoopWindow,
+		"delay", res.Delay,
+		"state_file", crashLoopPath(),
+	)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	select {
+	case <-time.After(res.Delay):
+	case <-sigCh:
+		logger.Info("Stopped while delaying startup")
+		return false
+	}
+
+	// Chạy ổn định hết window thì không còn coi là crash-loop
+	time.AfterFunc(*crashLoopWindow, func() {
+		check.UpdateCheck(health.HealthStatusHealthy, "Running without restarts for "+crashLoopWindow.String())
+	})
+	return true
+}
+
+// clearCrashLoop xoá lịch sử starts khi agent dừng chủ động, để restart
+// thường (deploy, systemctl restart) không bị tính là crash
+func clearCrashLoop() {
+	if *crashLoopStarts == 0 {
+		return
+	}
+	if err := crashloop.Clear(crashLoopPath()); err != nil {
+		logger.Warn("Failed to clear crash-loop state", "path", crashLoopPath(), "error", err)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/buildinfo"
+	"github.com/hydragon2m/tunnel-agent/internal/config"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// doctorTimeout là timeout cho mỗi network check của doctor
+const doctorTimeout = 10 * time.Second
+
+// doctorResult là kết quả một check của doctor
+type doctorResult struct {
+	name    string
+	status  string // PASS, FAIL, WARN, SKIP
+	message string
+	hint    string
+}
+
+// doctor chạy các checks tuần tự; check phụ thuộc vào check trước bị SKIP khi check trước FAIL
+type doctor struct {
+	results []doctorResult
+	failed  bool
+}
+
+func (d *doctor) pass(name, format string, args ...any) {
+	d.results = append(d.results, doctorResult{name: name, status: "PASS", message: fmt.Sprintf(format, args...)})
+}
+
+func (d *doctor) warn(name, message, hint string) {
+	d.results = append(d.results, doctorResult{name: name, status: "WARN", message: message, hint: hint})
+}
+
+func (d *doctor) fail(name string, err error, hint string) {
+	d.failed = true
+	d.results = append(d.results, doctorResult{name: name, status: "FAIL", message: err.Error(), hint: hint})
+}
+
+func (d *doctor) skip(name string) {
+	d.results = append(d.results, doctorResult{name: name, status: "SKIP", message: "skipped because a previous check failed"})
+}
+
+// print in report ra w
+func (d *doctor) print(w io.Writer) {
+	for _, r := range d.results {
+		fmt.Fprintf(w, "[%s] %-16s %s\n", r.status, r.name, r.message)
+		if r.hint != "" {
+			fmt.Fprintf(w, "       %-16s hint: %s\n", "", r.hint)
+		}
+	}
+}
+
+// runDoctor thực thi `agent doctor [agent flags]`: kiểm tra config, kết nối tới Core
+// (DNS, TCP, TLS), auth handshake ở dry-run mode, protocol version và local services,
+// rồi in pass/fail report. Dùng cùng flags/env với agent nên kiểm tra đúng config thật.
+func runDoctor() int {
+	d := &doctor{}
+
+	// 1. Config
+	if err := validateFlags(); err != nil {
+		d.fail("flags", err, "fix the flags or TUNNEL_AGENT_* environment variables listed above")
+	} else {
+		d.pass("flags", "valid")
+	}
+	var hosts client.HostOverrides
+	if *configPath != "" {
+		cfg, err := config.Load(*configPath)
+		if err == nil {
+			err = cfg.Validate()
+		}
+		if err != nil {
+			d.fail("config", err, "fix the YAML syntax, the listed keys or the path passed to -config")
+		} else {
+			d.pass("config", "loaded %s", *configPath)
+			hosts = cfg.Hosts
+		}
+	}
+	if *token == "" {
+		d.fail("token", errors.New("no token configured"), "use -token, the TUNNEL_AGENT_TOKEN env var, `token` in the config file or `agent login`")
+	} else {
+		d.pass("token", "present")
+	}
+
+	// 2. Core connectivity
+	conn := doctorConnect(d)
+	if conn != nil {
+		defer conn.Close()
+		doctorAuth(d, conn)
+	} else {
+		d.skip("auth")
+	}
+
+	// 3. Local services
+	doctorLocalServices(d, hosts)
+
+	d.print(os.Stdout)
+	if d.failed {
+		fmt.Println("\nSome checks failed.")
+		return 1
+	}
+	fmt.Println("\nAll checks passed.")
+	return 0
+}
+
+// doctorConnect kiểm tra DNS, TCP và TLS tới Core, trả về connection nếu thành công
+func doctorConnect(d *doctor) net.Conn {
+	host, _, err := net.SplitHostPort(*serverAddr)
+	if err != nil {
+		d.fail("server address", err, "use host:port, e.g. -server core.example.com:8443")
+		d.skip("dns")
+		d.skip("tcp")
+		return nil
+	}
+
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		d.fail("dns", err, "check the server hostname and DNS resolver configuration")
+		d.skip("tcp")
+		return nil
+	}
+	d.pass("dns", "%s → %s", host, strings.Join(addrs, ", "))
+
+	dialer := net.Dialer{Timeout: doctorTimeout}
+	if localAddr, err := client.ResolveBindAddress(*bindAddr); err == nil && localAddr != nil {
+		dialer.LocalAddr = localAddr
+	}
+	start := time.Now()
+	conn, err := dialer.Dial("tcp", *serverAddr)
+	if err != nil {
+		hint := "check that Core is running and that firewalls/proxies allow outbound connections to " + *serverAddr
+		if *bindAddr != "" {
+			hint += " from -bind-address " + *bindAddr
+		}
+		d.fail("tcp", err, hint)
+		return nil
+	}
+	d.pass("tcp", "connected to %s from %s in %s", *serverAddr, conn.LocalAddr(), time.Since(start).Round(time.Millisecond))
+
+	if !*useTLS {
+		d.warn("tls", "disabled", "use -tls in production")
+		return conn
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: *skipVerify,
+	})
+	tlsConn.SetDeadline(time.Now().Add(doctorTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		d.fail("tls", err, tlsHint(err))
+		return nil
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	state := tlsConn.ConnectionState()
+	msg := tls.VersionName(state.Version)
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		msg += fmt.Sprintf(", certificate %q expires %s", cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02"))
+		if time.Until(cert.NotAfter) < 14*24*time.Hour {
+			d.warn("tls", msg, "server certificate expires in less than 14 days")
+			return tlsConn
+		}
+	}
+	if *skipVerify {
+		d.warn("tls", msg+" (verification skipped)", "remove -skip-verify once Core has a trusted certificate")
+		return tlsConn
+	}
+	d.pass("tls", "%s", msg)
+	return tlsConn
+}
+
+// tlsHint trả về remediation hint cho TLS handshake errors
+func tlsHint(err error) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return "Core certificate is not signed by a trusted CA; install the CA certificate or use -skip-verify for testing"
+	case errors.As(err, &hostname):
+		return "certificate does not match the server hostname; use the hostname from the certificate in -server"
+	case errors.As(err, &invalid):
+		return "certificate is expired or not yet valid; check the Core certificate and the local clock"
+	case strings.Contains(err.Error(), "first record does not look like a TLS handshake"):
+		return "server does not speak TLS on this port; try -tls=false or check the port"
+	default:
+		return "check the TLS configuration of Core"
+	}
+}
+
+// doctorAuth gửi FrameAuth ở dry-run mode, kiểm tra response và protocol version
+func doctorAuth(d *doctor, conn net.Conn) {
+	if *token == "" {
+		d.skip("auth")
+		return
+	}
+
+	authenticator := client.NewAuthenticator(*token, *agentID, buildinfo.Get().Version, nil, map[string]string{"dry_run": "true"})
+	frame, err := authenticator.CreateAuthFrame()
+	if err != nil {
+		d.fail("auth", err, "")
+		return
+	}
+
+	conn.SetDeadline(time.Now().Add(doctorTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := v1.Encode(conn, frame); err != nil {
+		d.fail("auth", fmt.Errorf("failed to send auth frame: %w", err), "the connection was closed by Core")
+		return
+	}
+
+	length, err := v1.ReadFrameLength(conn)
+	if err != nil {
+		d.fail("auth", fmt.Errorf("no auth response: %w", err), "Core closed the connection; check Core logs and that -server points to the agent port")
+		return
+	}
+	if length < v1.HeaderSize || length > v1.MaxFrameSize {
+		d.fail("protocol", fmt.Errorf("invalid frame size %d", length), "the server at "+*serverAddr+" is not a tunnel Core")
+		return
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		d.fail("auth", fmt.Errorf("failed to read auth response: %w", err), "")
+		return
+	}
+	resp, err := v1.ParseFrame(buf)
+	if err != nil {
+		d.fail("protocol", err, "Core uses an incompatible protocol version; upgrade the agent or Core")
+		return
+	}
+
+	if resp.Version != v1.Version {
+		d.fail("protocol", fmt.Errorf("core speaks protocol v%d, agent speaks v%d", resp.Version, v1.Version),
+			"upgrade the agent (`agent update`) or Core so both use the same protocol version")
+		return
+	}
+	d.pass("protocol", "v%d", v1.Version)
+
+	if err := authenticator.HandleAuthResponse(resp); err != nil {
+		d.fail("auth", err, "check the token; it may be revoked, expired or belong to another environment")
+		return
+	}
+	msg := "token accepted (dry run)"
+	if publicURL := authenticator.PublicURL(); publicURL != "" {
+		msg += ", public URL " + publicURL
+	}
+	d.pass("auth", "%s", msg)
+
+	// Đóng connection lịch sự
+	v1.Encode(conn, &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameClose,
+		Flags:    v1.FlagNone,
+		StreamID: v1.StreamIDControl,
+	})
+}
+
+// doctorLocalServices probe từng local service trong -local
+func doctorLocalServices(d *doctor, hosts client.HostOverrides) {
+	httpClient := &http.Client{
+		Timeout: doctorTimeout,
+		// Redirects vẫn chứng tỏ service đang chạy
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	if len(hosts) > 0 {
+		// Cùng static host overrides với forwarder, để kiểm tra đúng address thật
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		dialer := &net.Dialer{Timeout: doctorTimeout}
+		transport.DialContext = hosts.DialContext(dialer.DialContext)
+		httpClient.Transport = transport
+	}
+
+	for _, part := range strings.Split(*localServices, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, url := "local", part
+		if kv := strings.SplitN(part, "=", 2); len(kv) == 2 {
+			name, url = "local "+strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		}
+
+		start := time.Now()
+		resp, err := httpClient.Get(url)
+		if err != nil {
+			d.fail(name, err, "start the local service or fix the URL in -local ("+url+")")
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			d.warn(name, fmt.Sprintf("%s responded %s", url, resp.Status), "the local service is reachable but returns server errors")
+			continue
+		}
+		d.pass(name, "%s responded %s in %s", url, resp.Status, time.Since(start).Round(time.Millisecond))
+	}
+}
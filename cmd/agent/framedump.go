@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// openFrameDump mở file frame dump từ -frame-dump, nil nếu flag không được đặt.
+// File được nối thêm và flush sau mỗi frame nên không cần đóng khi shutdown.
+func openFrameDump() (*client.FrameDumper, error) {
+	if *frameDumpPath == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(*frameDumpPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	logger.Warn("Frame dump enabled, every frame to and from Core is written to disk", "file", *frameDumpPath, "preview", *frameDumpPreview)
+	return client.NewFrameDumper(f, client.FrameDumpOptions{Preview: *frameDumpPreview}), nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/health"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// goingAway = true khi Core đã gửi GoAway: không nhận stream mới,
+// chờ streams hiện tại kết thúc rồi reconnect
+var goingAway atomic.Bool
+
+// handleGoAway drain streams của connection hiện tại rồi reconnect tới Core
+// mà GoAway chỉ định. Address mới được set ngay để reconnect do Core đóng
+// connection sớm (trước khi drain xong) cũng đi tới Core mới.
+func handleGoAway(ctx context.Context, goAway *client.GoAway, connector *client.Connector, streamManager *client.StreamManager, connectionCheck *health.Check) {
+	if !goingAway.CompareAndSwap(false, true) {
+		logger.Debug("GoAway already in progress, ignoring")
+		return
+	}
+
+	if goAway.NextAddress != "" {
+		connector.SetServerAddr(goAway.NextAddress)
+	}
+	logger.Info("Core is going away, draining streams",
+		"reason", goAway.Reason,
+		"next_address", connector.ServerAddr(),
+	)
+	connectionCheck.UpdateCheck(health.HealthStatusDegraded, "Core going away, draining streams")
+
+	go func() {
+		defer goingAway.Store(false)
+
+		drainStreams(streamManager, goAway.DrainTimeout(*drainTimeout))
+		if err := connector.Reconnect(ctx); err != nil {
+			logger.Error("Reconnect after GoAway failed", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/health"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+// Hành động khi tunnel idle quá -idle-shutdown
+const (
+	idleActionExit  = "exit"
+	idleActionSleep = "sleep"
+)
+
+// idleSleeping = true khi tunnel bị ngắt vì idle (-idle-action=sleep hoặc
+// start sau idle exit không có -wake-on-start): connection đóng lúc này
+// không trigger reconnect
+var idleSleeping atomic.Bool
+
+// tunnelClosed cho biết tunnel đang được đóng chủ động (ngoài khung giờ hoặc idle)
+func tunnelClosed() bool {
+	return scheduleClosed.Load() || idleSleeping.Load()
+}
+
+// idleMarkerPath trả về file đánh dấu process trước đã exit vì idle
+func idleMarkerPath() string {
+	return filepath.Join(os.TempDir(), "tunnel-agent-"+*tunnelName+".idle")
+}
+
+// idleMonitor theo dõi thời gian không có stream nào được forward
+type idleMonitor struct {
+	timeout    time.Duration
+	lastTotal  int64
+	lastActive time.Time
+}
+
+func newIdleMonitor(timeout time.Duration, now time.Time) *idleMonitor {
+	return &idleMonitor{timeout: timeout, lastTotal: -1, lastActive: now}
+}
+
+// idle cập nhật hoạt động gần nhất từ số streams đã mở và đang mở, trả về
+// true khi không có stream nào trong timeout
+func (m *idleMonitor) idle(now time.Time, streamsTotal int64, streamsActive int) bool {
+	if streamsTotal != m.lastTotal || streamsActive > 0 {
+		m.lastTotal = streamsTotal
+		m.lastActive = now
+		return false
+	}
+	return now.Sub(m.lastActive) >= m.timeout
+}
+
+// idleCheckInterval là chu kỳ kiểm tra idle: 1/10 timeout, trong khoảng 1s..30s
+func idleCheckInterval(timeout time.Duration) time.Duration {
+	return min(max(timeout/10, time.Second), 30*time.Second)
+}
+
+// scheduleIdleShutdown thêm job kiểm tra idle. Với exit, idleCh nhận shutdown
+// reason để main dừng agent; với sleep, tunnel bị ngắt tới khi POST /wake.
+func scheduleIdleShutdown(timeout time.Duration, action string, idleCh chan<- string, connector *client.Connector, streamManager *client.StreamManager, connectionCheck *health.Check) {
+	monitor := newIdleMonitor(timeout, time.Now())
+	scheduleJob(jobIdleShutdown, idleCheckInterval(timeout), 0, func(context.Context) {
+		if tunnelClosed() {
+			// Không tính thời gian tunnel đóng là idle
+			monitor.lastActive = time.Now()
+			return
+		}
+		total := metrics.GetMetrics().GetSnapshot().StreamsTotal
+		if !monitor.idle(time.Now(), total, len(streamManager.Snapshot())) {
+			return
+		}
+
+		if action == idleActionExit {
+			logger.Info("No requests forwarded, shutting down", "idle_for", timeout)
+			if err := os.WriteFile(idleMarkerPath(), []byte(time.Now().Format(time.RFC3339)), 0o600); err != nil {
+				logger.Warn("Failed to write idle marker", "path", idleMarkerPath(), "error", err)
+			}
+			select {
+			case idleCh <- client.ShutdownIdle:
+			default:
+			}
+			return
+		}
+		if idleSleeping.CompareAndSwap(false, true) {
+			logger.Info("No requests forwarded, disconnecting until woken", "idle_for", timeout)
+			connector.Disconnect()
+			connectionCheck.UpdateCheck(health.HealthStatusDegraded, fmt.Sprintf("Sleeping after %s without requests", timeout))
+		}
+	})
+}
+
+// wakeAfterIdleExit kiểm tra process trước có exit vì idle không. Với
+// -wake-on-start, marker bị xoá và agent kết nối bình thường; nếu không,
+// agent start ở trạng thái sleep tới khi POST /wake.
+func wakeAfterIdleExit(wakeOnStart bool) {
+	if _, err := os.Stat(idleMarkerPath()); err != nil {
+		return
+	}
+	if !wakeOnStart {
+		idleSleeping.Store(true)
+		return
+	}
+	logger.Info("Waking after idle shutdown", "marker", idleMarkerPath())
+	clearIdleMarker()
+}
+
+// clearIdleMarker xoá file đánh dấu idle exit
+func clearIdleMarker() {
+	if err := os.Remove(idleMarkerPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Warn("Failed to remove idle marker", "path", idleMarkerPath(), "error", err)
+	}
+}
+
+// registerWakeHandler đăng ký POST /wake vào admin API: kết nối lại tunnel
+// đang sleep vì idle
+func registerWakeHandler(server *admin.Server, ctx context.Context, connector *client.Connector) {
+	server.Handle("/wake", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			admin.WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		if !idleSleeping.CompareAndSwap(true, false) {
+			admin.WriteJSON(w, http.StatusOK, map[string]string{"status": "awake"})
+			return
+		}
+		logger.Info("Woken by admin API, reconnecting")
+		clearIdleMarker()
+		// Connection sống theo root context, không theo request
+		go func() {
+			if err := connector.Connect(ctx); err != nil {
+				logger.Error("Failed to connect after wake", "error", err)
+			}
+		}()
+		admin.WriteJSON(w, http.StatusAccepted, map[string]string{"status": "connecting"})
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// inspectorResponse là body của GET /inspector
+type inspectorResponse struct {
+	Exchanges []client.RecordedExchange `json:"exchanges"`
+}
+
+// registerInspectorHandlers đăng ký inspector vào admin API: GET /inspector trả
+// về các exchanges gần nhất (-inspect), GET /inspector/har export chúng thành
+// file HAR mở được bằng browser devtools
+func registerInspectorHandlers(server *admin.Server, recorder *client.Recorder) {
+	server.Handle("/inspector", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			admin.WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, inspectorResponse{Exchanges: recorder.Recent()})
+	})
+	server.Handle("/inspector/har", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			admin.WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "tunnel-agent-"+*tunnelName+".har"))
+		if err := client.WriteHAR(w, recorder.Recent()); err != nil {
+			logger.Warn("Failed to export HAR", "error", err)
+		}
+	})
+}
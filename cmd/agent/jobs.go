@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/scheduler"
+)
+
+// Tên các jobs định kỳ của agent (GET /jobs)
+const (
+	jobTunnelSchedule = "tunnel-schedule"
+	jobLocalProbe     = "local-probe"
+	jobWarmUp         = "warm-up"
+	jobWatchdog       = "watchdog"
+	jobAutoUpdate     = "auto-update"
+	jobQuota          = "quota"
+	jobIdleShutdown   = "idle-shutdown"
+	jobSecretRefresh  = "secret-refresh"
+)
+
+// jobs chạy mọi tác vụ định kỳ của agent: start cùng root context và dừng
+// cùng lúc khi shutdown, thay vì mỗi tác vụ tự quản goroutine riêng
+var jobs = scheduler.New(nil)
+
+// scheduleJob thêm job định kỳ; lỗi chỉ xảy ra khi cấu hình job sai nên chỉ log
+func scheduleJob(name string, interval time.Duration, jitter float64, run func(ctx context.Context)) {
+	if err := jobs.Add(scheduler.Job{Name: name, Interval: interval, Jitter: jitter, Run: run}); err != nil {
+		logger.Error("Failed to schedule job", "job", name, "error", err)
+	}
+}
+
+// jobRequest là body của PUT /jobs
+type jobRequest struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+}
+
+// registerJobsHandler đăng ký /jobs vào admin API: GET liệt kê jobs định kỳ
+// (lần chạy gần nhất, lần kế tiếp, số lần chạy/panic), PUT pause hoặc resume một job
+func registerJobsHandler(server *admin.Server) {
+	server.Handle("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var req jobRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+				return
+			}
+
+			setPaused := jobs.Resume
+			if req.Paused {
+				setPaused = jobs.Pause
+			}
+			if err := setPaused(req.Name); errors.Is(err, scheduler.ErrUnknownJob) {
+				admin.WriteError(w, http.StatusNotFound, err)
+				return
+			}
+			logger.Info("Job updated", "job", req.Name, "paused", req.Paused)
+		default:
+			admin.WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, jobs.Jobs())
+	})
+}
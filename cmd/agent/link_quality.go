@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// currentTransport trả về tên transport đang dùng tới Core
+func currentTransport() string {
+	if *useTLS {
+		return "tls"
+	}
+	return "tcp"
+}
+
+// onLowLinkQuality log warning khi link quality xuống dưới
+// -link-quality-threshold để operators thấy link nào cần xử lý. Agent chỉ có
+// một transport (TCP, có hoặc không TLS) nên không tự đổi transport.
+func onLowLinkQuality(s client.LinkQualitySnapshot) {
+	logger.Warn("Link quality below threshold",
+		"transport", currentTransport(),
+		"score", s.Score,
+		"threshold", *linkQualityThreshold,
+		"rtt_ms", s.RTT.Milliseconds(),
+		"loss", s.Loss,
+		"reconnects", s.Reconnects)
+}
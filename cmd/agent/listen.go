@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// listenSpec là một mapping local_addr=target của -listen
+type listenSpec struct {
+	address, target string
+}
+
+// parseListeners parse -listen: danh sách local_addr=target cách nhau bởi dấu phẩy
+func parseListeners(input string) ([]listenSpec, error) {
+	var specs []listenSpec
+	var errs []error
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		address, target, ok := strings.Cut(part, "=")
+		address, target = strings.TrimSpace(address), strings.TrimSpace(target)
+		if !ok {
+			errs = append(errs, fmt.Errorf("-listen entry %q: missing '='; use local_addr=target, e.g. 127.0.0.1:5432=db.internal:5432", part))
+			continue
+		}
+		if err := validateHostPort(address); err != nil {
+			errs = append(errs, fmt.Errorf("-listen entry %q: local address: %v", part, err))
+			continue
+		}
+		if err := validateHostPort(target); err != nil {
+			errs = append(errs, fmt.Errorf("-listen entry %q: target: %v", part, err))
+			continue
+		}
+		specs = append(specs, listenSpec{address: address, target: target})
+	}
+	return specs, errors.Join(errs...)
+}
+
+// startListeners mở local listeners của -listen; mỗi connection được forward
+// thành agent-initiated stream tới target phía Core
+func startListeners(ctx context.Context, specs []listenSpec, streamManager *client.StreamManager) error {
+	for _, spec := range specs {
+		l := client.NewLocalListener(spec.address, spec.target, streamManager)
+		if err := l.Start(ctx); err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", spec.address, err)
+		}
+		logger.Info("Forwarding local listener to Core service", "address", l.Addr().String(), "target", spec.target)
+	}
+	return nil
+}
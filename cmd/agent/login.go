@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hydragon2m/tunnel-agent/internal/keyring"
+)
+
+// runLogin thực thi lệnh `agent login`: lưu token vào OS keyring.
+// Token được đọc từ stdin để không xuất hiện trong shell history hay process list:
+//
+//	agent login < token.txt
+//	echo "$TOKEN" | agent login -account prod
+//
+// Secrets của backends (auth.bearer, auth.password dạng keyring:<account>) được
+// lưu cùng cách.
+func runLogin(args []string) int {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	account := fs.String("account", keyring.DefaultAccount, "Keyring account name")
+	fs.Parse(args)
+
+	fmt.Fprint(os.Stderr, "Token: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintf(os.Stderr, "\nfailed to read token: %v\n", err)
+		return 1
+	}
+	tok := strings.TrimSpace(line)
+	if tok == "" {
+		fmt.Fprintln(os.Stderr, "\ntoken must not be empty")
+		return 1
+	}
+
+	if err := keyring.Set(keyring.Service, *account, tok); err != nil {
+		fmt.Fprintf(os.Stderr, "\nfailed to store token: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "\nToken stored in OS keyring (account %q)\n", *account)
+	return 0
+}
+
+// runLogout thực thi lệnh `agent logout`: xoá token khỏi OS keyring
+func runLogout(args []string) int {
+	fs := flag.NewFlagSet("logout", flag.ExitOnError)
+	account := fs.String("account", keyring.DefaultAccount, "Keyring account name")
+	fs.Parse(args)
+
+	if err := keyring.Delete(keyring.Service, *account); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to remove token: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Token removed from OS keyring (account %q)\n", *account)
+	return 0
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// logLevelRequest là body của PUT /log-level
+type logLevelRequest struct {
+	// Level rỗng khôi phục -log-level
+	Level string `json:"level"`
+	// Duration trước khi khôi phục -log-level, ví dụ "10m" (rỗng = -debug-duration)
+	Duration string `json:"duration,omitempty"`
+}
+
+// toggleDebug bật debug logging trong d, hoặc khôi phục -log-level nếu debug đang bật
+func toggleDebug(d time.Duration) {
+	if logger.Level().Level == "debug" {
+		logger.ResetLevel()
+		logger.Info("Debug logging disabled", "level", logger.Level().Level)
+		return
+	}
+	logger.SetLevel("debug", d)
+	logger.Info("Debug logging enabled", "duration", d)
+}
+
+// watchLogLevelSignal bật/tắt debug logging mỗi khi nhận SIGUSR1 (Unix only)
+func watchLogLevelSignal(d time.Duration) {
+	signals := logLevelSignals()
+	if len(signals) == 0 {
+		return
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		for range ch {
+			toggleDebug(d)
+		}
+	}()
+}
+
+// registerLogLevelHandler đăng ký /log-level vào admin API: GET trả về level
+// hiện tại, PUT đổi level (tự khôi phục -log-level sau duration)
+func registerLogLevelHandler(server *admin.Server, defaultDuration time.Duration) {
+	server.Handle("/log-level", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var req logLevelRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+				return
+			}
+
+			if req.Level == "" {
+				logger.ResetLevel()
+				logger.Info("Log level restored", "level", logger.Level().Level)
+				break
+			}
+			d := defaultDuration
+			if req.Duration != "" {
+				parsed, err := time.ParseDuration(req.Duration)
+				if err != nil || parsed < 0 {
+					admin.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid duration %q; use e.g. 10m, or 0s to keep the level", req.Duration))
+					return
+				}
+				d = parsed
+			}
+			if err := logger.SetLevel(req.Level, d); err != nil {
+				admin.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			logger.Info("Log level changed", "level", req.Level, "duration", d)
+		default:
+			admin.WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, logger.Level())
+	})
+}
@@ -4,22 +4,34 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
-	"strconv"
+	"regexp"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/audit"
+	"github.com/hydragon2m/tunnel-agent/internal/buildinfo"
+	"github.com/hydragon2m/tunnel-agent/internal/chaos"
+	"github.com/hydragon2m/tunnel-agent/internal/config"
+	"github.com/hydragon2m/tunnel-agent/internal/diag"
 	"github.com/hydragon2m/tunnel-agent/internal/health"
+	"github.com/hydragon2m/tunnel-agent/internal/keyring"
 	"github.com/hydragon2m/tunnel-agent/internal/logger"
 	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+	"github.com/hydragon2m/tunnel-agent/internal/schedule"
+	"github.com/hydragon2m/tunnel-agent/internal/simcore"
+	"github.com/hydragon2m/tunnel-agent/internal/update"
 	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
 )
 
@@ -28,92 +40,298 @@ var (
 	serverAddr = flag.String("server", "localhost:8443", "Core server address")
 	useTLS     = flag.Bool("tls", true, "Use TLS connection")
 	skipVerify = flag.Bool("skip-verify", false, "Skip TLS certificate verification")
+	bindAddr   = flag.String("bind-address", "", "Source IP or network interface for the connection to Core (default: chosen by the OS)")
+
+	// Tunnel name (label cho logs, /metrics, /health và status). Mỗi process
+	// chạy đúng một tunnel: metrics, health và logger là global của process.
+	tunnelName = flag.String("tunnel-name", "default", "Name of the tunnel run by this process, added to every log line, metric series, /health and status")
 
 	// Auth config
 	token   = flag.String("token", "", "Authentication token (required)")
 	agentID = flag.String("agent-id", "", "Agent ID (optional)")
-	version = flag.String("version", "1.0.0", "Agent version")
+	version = flag.String("version", "", "Deprecated and ignored: the reported version comes from build info")
+
+	keyringAccount = flag.String("keyring-account", keyring.DefaultAccount, "OS keyring account to read the token from when -token is not set")
 
 	// Local service config
-	localServices = flag.String("local", "http://localhost:3003", "Local service(s) mapping. Format: [subdomain=]url,[subdomain2=]url2")
+	localServices = flag.String("local", "http://localhost:3003", "Local service(s) mapping. Format: [host=]url,... where host is a subdomain, hostname or *.domain")
+
+	// Warm-up keep-alive connections tới local services
+	warmConns = flag.Int("warm-conns", 0, "Idle keep-alive connections opened to each local service at startup and after it recovers, so the first requests skip connection setup (0 disables)")
+
+	// Local service restart: chờ thay vì trả lỗi khi connection bị refuse
+	restartGrace = flag.Duration("restart-grace", 10*time.Second, "How long requests wait for a local service that refuses connections (e.g. while it restarts) before failing and marking it unhealthy (0 disables)")
+
+	// Local listeners (chiều ngược: dùng services phía Core)
+	listenAddrs = flag.String("listen", "", "Local listener(s) forwarded to Core services. Format: local_addr=target,... e.g. 127.0.0.1:5432=db.internal:5432")
+
+	// Auto-pause khi local service down lâu
+	pauseAfter    = flag.Duration("pause-after", 0, "Ask Core to stop routing to this agent after the local service has been unreachable this long (0 disables)")
+	probeInterval = flag.Duration("probe-interval", 10*time.Second, "Interval between local service probes used by -pause-after")
 
 	// Config
-	heartbeatInterval = flag.Duration("heartbeat", 10*time.Second, "Heartbeat interval")
-	readTimeout       = flag.Duration("read-timeout", 30*time.Second, "Read timeout")
-	requestTimeout    = flag.Duration("request-timeout", 30*time.Second, "Request timeout")
+	heartbeatInterval    = flag.Duration("heartbeat", 10*time.Second, "Heartbeat interval")
+	linkQualityThreshold = flag.Int("link-quality-threshold", 0, "Link quality score (0-100) below which the agent logs a warning (0 disables)")
+	heartbeatProbeSize   = flag.Int("heartbeat-probe-size", 0, "Random payload bytes sent in each heartbeat; Core must echo them intact, detecting middleboxes that truncate or corrupt larger frames (0 disables)")
+	readTimeout          = flag.Duration("read-timeout", 0, "Drop the connection when nothing is received from Core for this long (0 = 3× -heartbeat)")
+	requestTimeout       = flag.Duration("request-timeout", 30*time.Second, "Request timeout")
+	maxFrameRate         = flag.Int("max-frame-rate", 0, "Maximum frames per second processed from Core; excess frames are throttled (0 = unlimited)")
+	frameBurst           = flag.Int("frame-burst", 0, "Frames allowed above -max-frame-rate in a short burst (0 = same as -max-frame-rate)")
+	maxStreams           = flag.Int("max-streams", 10000, "Maximum streams open at once; further streams opened by Core are reset (0 = unlimited)")
+	maxStreamOpenRate    = flag.Int("max-stream-open-rate", 0, "Maximum streams Core may open per second; excess streams are reset (0 = unlimited)")
 
 	// Logging
-	logLevel = flag.String("log-level", "info", "Log level: debug, info, warn, error")
-	logJSON  = flag.Bool("log-json", false, "Use JSON logging format")
+	logLevel      = flag.String("log-level", "info", "Log level: debug, info, warn, error")
+	debugDuration = flag.Duration("debug-duration", 15*time.Minute, "How long debug logging enabled by SIGUSR1 or the admin API stays on before reverting to -log-level (0 = until toggled off)")
+	logJSON       = flag.Bool("log-json", false, "Use JSON logging format")
 
 	// Metrics
 	metricsEnabled = flag.Bool("metrics", false, "Enable metrics collection")
 	metricsPort    = flag.Int("metrics-port", 9091, "Metrics HTTP server port")
 
+	// Config file
+	configPath   = flag.String("config", "", "Path to YAML config file")
+	capabilities = flag.String("capabilities", "", "Comma-separated capability allowlist (overrides config file)")
+
+	// Audit log
+	auditLogPath = flag.String("audit-log", "", "Path to hash-chained audit log file (disabled if empty)")
+
+	// Remote exec (opt-in)
+	execEnabled = flag.Bool("exec", false, "Enable remote exec streams (dangerous, opt-in)")
+	execAllow   = flag.String("exec-allow", "", "Comma-separated allowlist of command lines for remote exec, e.g. \"/usr/bin/journalctl -u * --no-pager\"")
+	execTimeout = flag.Duration("exec-timeout", 1*time.Hour, "Maximum duration of a remote exec session")
+
+	// Diagnostics
+	diagDir = flag.String("diag-dir", os.TempDir(), "Directory for diagnostics bundles (SIGUSR2 or admin API)")
+
+	// Leak watchdog
+	watchdogInterval = flag.Duration("watchdog-interval", time.Minute, "Interval between goroutine/stream/connection leak checks (0 disables)")
+
+	// Crash-loop detection
+	crashLoopStarts   = flag.Int("crash-loop-starts", 5, "Starts within -crash-loop-window after which startup is delayed with backoff (0 disables)")
+	crashLoopWindow   = flag.Duration("crash-loop-window", 5*time.Minute, "Window in which starts count towards -crash-loop-starts")
+	crashLoopMaxDelay = flag.Duration("crash-loop-max-delay", 5*time.Minute, "Maximum startup delay while crash-looping")
+	crashLoopFile     = flag.String("crash-loop-file", "", "File recording recent starts (default: <tmp>/tunnel-agent-<tunnel-name>.starts)")
+
+	// Idle shutdown
+	idleShutdown = flag.Duration("idle-shutdown", 0, "Exit or sleep after this long without forwarded requests (0 disables)")
+	idleAction   = flag.String("idle-action", idleActionExit, "What to do when idle: exit (clean exit) or sleep (disconnect until POST /wake)")
+	wakeOnStart  = flag.Bool("wake-on-start", false, "Reconnect when started after an idle exit; otherwise start asleep until POST /wake")
+
+	// Traffic recording
+	recordPath    = flag.String("record", "", "Record forwarded requests and responses to this file for offline analysis or `agent bench -replay` (disabled if empty)")
+	recordFormat  = flag.String("record-format", "", "Record file format: ndjson or har (default: har for a .har file, ndjson otherwise)")
+	recordMaxBody = flag.Int64("record-max-body", 64<<10, "Maximum body bytes recorded per request and response (-1 records no bodies)")
+	recordRedact  = flag.String("record-redact", "", "Comma-separated extra headers whose values are redacted in the record file")
+	recordDryRun  = flag.Bool("record-dry-run", false, "Answer recorded requests with 202 without calling local services")
+	inspectKeep   = flag.Int("inspect", 0, "Keep the last N forwarded exchanges in memory for the admin API inspector (0 disables)")
+
+	// Frame dump
+	frameDumpPath    = flag.String("frame-dump", "", "Append a dump of every frame sent to and received from Core (header and hex payload preview) to this file (disabled if empty)")
+	frameDumpPreview = flag.Int("frame-dump-preview", 64, "Payload bytes shown as hex per frame in -frame-dump (-1 dumps headers only)")
+
+	// Graceful restart
+	drainTimeout = flag.Duration("drain-timeout", 5*time.Minute, "Maximum time to drain streams after a graceful restart (SIGHUP)")
+
+	// Shutdown
+	flushTimeout = flag.Duration("flush-timeout", 5*time.Second, "Maximum time to flush queued frames to Core before sending the close frame on shutdown")
+
+	// Self-update
+	autoUpdate         = flag.Bool("auto-update", false, "Periodically install signed releases and restart gracefully")
+	autoUpdateInterval = flag.Duration("auto-update-interval", 24*time.Hour, "Interval between auto-update checks")
+	updateURL          = flag.String("update-url", update.DefaultBaseURL, "Release download base URL")
+	updateKey          = flag.String("update-public-key", "", "Base64 ed25519 key used to verify releases (default: built-in key)")
+
+	// Admin API
+	adminEnabled = flag.Bool("admin", false, "Enable local admin API")
+	adminAddr    = flag.String("admin-addr", admin.DefaultAddr, "Admin API listen address")
+	adminToken   = flag.String("admin-token", "", "Bearer token required by privileged admin API endpoints (restart, diagnostics, file transfer)")
+	filesDir     = flag.String("files-dir", "", "Directory that local paths of file transfers must be inside")
+
+	// Offline simulation
+	simulate     = flag.Bool("simulate", false, "Run against an in-process simulated Core (development only)")
+	simulateAddr = flag.String("simulate-addr", "127.0.0.1:8081", "Public HTTP address of the simulated Core")
+
 	// Remote Config
 	remoteConfig = flag.Bool("remote", false, "Fetch mapping configuration from server")
 	mgmtAddr     = flag.String("mgmt", "http://localhost:9000", "Management API address")
 )
 
+// legacyEnvFlags là các flags vẫn đọc được từ env var cũ không có prefix TUNNEL_AGENT_ (ví dụ SERVER, TOKEN)
+var legacyEnvFlags = []string{
+	"server", "tls", "skip-verify", "token", "agent-id", "keyring-account", "local",
+	"heartbeat", "read-timeout", "request-timeout", "log-level", "log-json",
+	"metrics", "metrics-port", "config", "capabilities", "audit-log",
+	"exec", "exec-allow", "exec-timeout", "diag-dir", "drain-timeout",
+	"auto-update", "auto-update-interval", "update-url", "update-public-key",
+	"admin", "admin-addr", "simulate", "simulate-addr",
+}
+
 func main() {
+	// Subcommands
+	doctorMode, pipeMode := false, false
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "doctor":
+			// doctor dùng cùng flags/env với agent
+			doctorMode = true
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "pipe":
+			// pipe cũng dùng flags/env của agent, target là argument cuối
+			pipeMode = true
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "cp":
+			os.Exit(runCp(os.Args[2:]))
+		case "login":
+			os.Exit(runLogin(os.Args[2:]))
+		case "logout":
+			os.Exit(runLogout(os.Args[2:]))
+		case "audit-verify":
+			os.Exit(runAuditVerify(os.Args[2:]))
+		case "update":
+			os.Exit(runUpdate(os.Args[2:]))
+		case "bench":
+			os.Exit(runBench(os.Args[2:]))
+		case "status":
+			os.Exit(runStatus(os.Args[2:]))
+		case "routes":
+			os.Exit(runRoutes(os.Args[2:]))
+		}
+	}
+
 	flag.Parse()
 
-	// Override with environment variables if set
-	if envServer := os.Getenv("SERVER"); envServer != "" {
-		*serverAddr = envServer
+	// Flags không có trên command line lấy giá trị từ TUNNEL_AGENT_* (hoặc tên cũ không prefix)
+	if err := config.BindFlags(flag.CommandLine, os.LookupEnv, legacyEnvFlags); err != nil {
+		log.Fatalf("Invalid environment configuration:\n%v", err)
 	}
-	if envTLS := os.Getenv("TLS"); envTLS != "" {
-		*useTLS = (envTLS == "true")
+	if *updateKey == "" {
+		*updateKey = updatePublicKey
 	}
-	if envSkipVerify := os.Getenv("SKIP_VERIFY"); envSkipVerify != "" {
-		*skipVerify = (envSkipVerify == "true")
+
+	// Simulated Core chấp nhận mọi token
+	if *simulate && *token == "" {
+		*token = "simulated-core-token"
 	}
-	if envToken := os.Getenv("TOKEN"); envToken != "" {
-		*token = envToken
+
+	// Fallback: token trong config file, rồi OS keyring (lưu bằng `agent login`)
+	if *token == "" && *configPath != "" {
+		configured, err := tokenFromConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to read token from config file %s: %v", *configPath, err)
+		}
+		*token = configured
 	}
-	if envAgentID := os.Getenv("AGENT_ID"); envAgentID != "" {
-		*agentID = envAgentID
+	if *token == "" {
+		stored, err := keyring.Get(keyring.Service, *keyringAccount)
+		switch {
+		case err == nil:
+			*token = stored
+		case errors.Is(err, keyring.ErrNotFound), errors.Is(err, keyring.ErrUnsupported):
+		default:
+			log.Printf("Failed to read token from OS keyring: %v", err)
+		}
 	}
-	if envLocal := os.Getenv("LOCAL"); envLocal != "" {
-		*localServices = envLocal
+
+	if doctorMode {
+		os.Exit(runDoctor())
 	}
-	if envHeartbeat := os.Getenv("HEARTBEAT"); envHeartbeat != "" {
-		if duration, err := time.ParseDuration(envHeartbeat); err == nil {
-			*heartbeatInterval = duration
-		}
+	if pipeMode {
+		os.Exit(runPipe(flag.Args()))
 	}
-	if envReadTimeout := os.Getenv("READ_TIMEOUT"); envReadTimeout != "" {
-		if duration, err := time.ParseDuration(envReadTimeout); err == nil {
-			*readTimeout = duration
-		}
+
+	if err := validateFlags(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	if *token == "" {
+		log.Fatal("Token is required. Use -token flag, TUNNEL_AGENT_TOKEN environment variable, `token` in the config file or `agent login`")
 	}
-	if envRequestTimeout := os.Getenv("REQUEST_TIMEOUT"); envRequestTimeout != "" {
-		if duration, err := time.ParseDuration(envRequestTimeout); err == nil {
-			*requestTimeout = duration
+
+	// Load config file
+	cfg := config.Default()
+	if *configPath != "" {
+		loaded, err := config.Load(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
 		}
+		cfg = loaded
 	}
-	if envLogLevel := os.Getenv("LOG_LEVEL"); envLogLevel != "" {
-		*logLevel = envLogLevel
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		log.Fatalf("Invalid environment configuration:\n%v", err)
 	}
-	if envLogJSON := os.Getenv("LOG_JSON"); envLogJSON != "" {
-		*logJSON = (envLogJSON == "true")
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid config file %s:\n%v", *configPath, err)
 	}
-	if envMetrics := os.Getenv("METRICS"); envMetrics != "" {
-		*metricsEnabled = (envMetrics == "true")
+	if secretStore == nil {
+		initSecrets(cfg.Secrets)
+	}
+
+	// Secrets redaction: configured patterns + the token itself
+	if err := logger.AddRedactPatterns(cfg.Logging.RedactPatterns); err != nil {
+		log.Fatalf("Invalid logging config: %v", err)
 	}
-	if envMetricsPort := os.Getenv("METRICS_PORT"); envMetricsPort != "" {
-		if port, err := parseInt(envMetricsPort); err == nil {
-			*metricsPort = port
+	if err := logger.AddRedactPatterns([]string{regexp.QuoteMeta(*token)}); err != nil {
+		log.Fatalf("Failed to configure token redaction: %v", err)
+	}
+	if *adminToken != "" {
+		if err := logger.AddRedactPatterns([]string{regexp.QuoteMeta(*adminToken)}); err != nil {
+			log.Fatalf("Failed to configure token redaction: %v", err)
 		}
 	}
 
-	if *token == "" {
-		log.Fatal("Token is required. Use -token flag or TOKEN environment variable")
+	// Initialize structured logging
+	if err := logger.InitLoggerWithOptions(logger.Options{
+		Level:          *logLevel,
+		JSON:           *logJSON,
+		SampleInterval: cfg.Logging.SampleInterval,
+		SampleBurst:    cfg.Logging.SampleBurst,
+		Sink:           cfg.Logging.Sink,
+		Tunnel:         *tunnelName,
+		Syslog: logger.SyslogOptions{
+			Network:  cfg.Logging.Syslog.Network,
+			Address:  cfg.Logging.Syslog.Address,
+			Facility: cfg.Logging.Syslog.Facility,
+			Tag:      cfg.Logging.Syslog.Tag,
+		},
+	}); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
 	}
+	build := buildinfo.Get()
+	logger.Info("Starting Tunnel Agent", "version", build.String(), "agentID", *agentID)
+	if *version != "" {
+		logger.Warn("-version is deprecated and ignored, the build version is reported instead",
+			"flag", *version, "version", build.Version)
+	}
+	digest := configDigest(cfg)
 
-	// Initialize structured logging
-	logger.InitLogger(*logLevel, *logJSON)
-	logger.Info("Starting Tunnel Agent", "version", *version, "agentID", *agentID)
+	// Initialize audit log
+	if *auditLogPath != "" {
+		if err := audit.Init(*auditLogPath); err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer audit.Close()
+		logger.Info("Audit log enabled", "path", *auditLogPath)
+	}
+	if *configPath != "" {
+		audit.Record(audit.TypeConfig, "load", audit.OutcomeSuccess, map[string]any{"path": *configPath})
+	}
+
+	// Offline simulation: fake Core chạy trong process, agent kết nối qua
+	// memory transport (không mở socket tới Core)
+	var transport client.Transport
+	if *simulate {
+		sim := simcore.NewServer("")
+		memTransport := client.NewMemoryTransport()
+		if err := sim.Serve(memTransport, *simulateAddr); err != nil {
+			log.Fatalf("Failed to start simulated core: %v", err)
+		}
+		defer sim.Close()
+		transport = memTransport
+		*serverAddr = sim.Addr()
+		*useTLS = false
+		logger.Warn("Simulation mode: not connected to a real Core", "public_url", sim.PublicURL())
+	}
 
 	// Initialize health checks
 	healthChecker := health.GetHealthChecker()
@@ -126,12 +344,27 @@ func main() {
 	localServiceCheck := healthChecker.RegisterCheck("local_service")
 	localServiceCheck.UpdateCheck(health.HealthStatusHealthy, "Local service available")
 
+	// Link liveness theo heartbeat ACKs (degraded khi không có ACK trong 3× heartbeat interval)
+	linkCheck := healthChecker.RegisterCheck("link")
+	linkCheck.UpdateCheck(health.HealthStatusDegraded, "Waiting for first heartbeat ACK")
+
+	// Buffered payload so với memory cap (degraded khi đang shed load)
+	memoryCheck := healthChecker.RegisterCheck("memory")
+	memoryCheck.UpdateCheck(health.HealthStatusHealthy, "Buffered payload below cap")
+	memory := newMemoryBudget(cfg.Memory, memoryCheck)
+
 	// Start metrics server if enabled
 	if *metricsEnabled {
-		go startMetricsServer(*metricsPort)
+		go startMetricsServer(*metricsPort, digest)
 		logger.Info("Metrics server started", "port", *metricsPort)
 	}
 
+	// Crash-loop: delay startup khi bị supervisor restart liên tục (sau metrics
+	// server để /health báo degraded trong lúc chờ)
+	if !checkCrashLoop(healthChecker.RegisterCheck("crash_loop")) {
+		return
+	}
+
 	// Create TLS config
 	var tlsConfig *tls.Config
 	if *useTLS {
@@ -140,18 +373,112 @@ func main() {
 		}
 	}
 
-	// Create connector
-	connector := client.NewConnector(*serverAddr, tlsConfig)
-	connector.SetRetryInterval(1 * time.Second)
+	// Root context của agent, bị huỷ khi shutdown
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	jobs.Start(ctx)
+
+	// Fault injection (chaos testing only)
+	var faults *chaos.Injector
+	if cfg.Chaos.Enabled {
+		faults = chaos.New(chaos.Options{
+			DropRate:       cfg.Chaos.DropRate,
+			CorruptRate:    cfg.Chaos.CorruptRate,
+			DelayRate:      cfg.Chaos.DelayRate,
+			Delay:          cfg.Chaos.Delay,
+			DisconnectRate: cfg.Chaos.DisconnectRate,
+			IncludeControl: cfg.Chaos.IncludeControl,
+			Seed:           cfg.Chaos.Seed,
+		})
+		diag.Register("chaos.json", diag.JSON(func() any { return faults.Stats() }))
+		logger.Warn("Fault injection enabled, do not use in production",
+			"drop_rate", cfg.Chaos.DropRate,
+			"corrupt_rate", cfg.Chaos.CorruptRate,
+			"delay_rate", cfg.Chaos.DelayRate,
+			"delay", cfg.Chaos.Delay,
+			"disconnect_rate", cfg.Chaos.DisconnectRate,
+		)
+	}
 
-	// Create dispatcher
-	dispatcher := client.NewDispatcher(*readTimeout)
+	// Schedule của tunnel: close đóng hẳn tunnel ngoài khung giờ, maintenance
+	// trả 503 cho mọi backend
+	tunnelSchedule, _ := cfg.Schedule.Schedule() // đã được kiểm tra bởi cfg.Validate
+	var forwarderSchedule *schedule.Schedule
+	if cfg.Schedule.Outside == "close" {
+		scheduleClosed.Store(!tunnelSchedule.Active(time.Now()))
+	} else {
+		forwarderSchedule = tunnelSchedule
+	}
 
-	// Create stream manager
-	streamManager := client.NewStreamManager(connector)
+	// Tên agent trong unmatched responses và Via header
+	agentName := *tunnelName
+	if *agentID != "" {
+		agentName = *agentID
+	}
+
+	// Response cho requests không khớp backend nào
+	var unmatched *client.Unmatched
+	if cfg.Unmatched.Enabled {
+		var err error
+		unmatched, err = client.CompileUnmatched(client.UnmatchedOptions{
+			Status:      cfg.Unmatched.Status,
+			ContentType: cfg.Unmatched.ContentType,
+			Template:    cfg.Unmatched.Template,
+			Agent:       agentName,
+		})
+		if err != nil {
+			log.Fatalf("Invalid config file %s:\nunmatched.template: %v", *configPath, err)
+		}
+	}
+
+	// Bảng IP → quốc gia cho access policies của backends
+	var geoTable *client.GeoTable
+	if cfg.GeoIP.File != "" {
+		f, err := os.Open(cfg.GeoIP.File)
+		if err != nil {
+			log.Fatalf("Failed to open geoip file: %v", err)
+		}
+		geoTable, err = client.LoadGeoTable(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Invalid geoip file %s: %v", cfg.GeoIP.File, err)
+		}
+	}
+
+	// Quota theo tháng của tunnel, usage được lưu trong state file
+	tunnelQuota, err := openQuota(cfg.Quota)
+	if err != nil {
+		log.Fatalf("Failed to open quota state: %v", err)
+	}
+	if tunnelQuota != nil {
+		scheduleQuota(tunnelQuota, healthChecker.RegisterCheck("quota"))
+	}
+
+	// Record traffic vào file
+	recorder, err := openRecorder()
+	if err != nil {
+		log.Fatalf("Failed to open record file: %v", err)
+	}
 
 	// Create local forwarder
-	forwarder := client.NewLocalForwarder("", *requestTimeout)
+	forwarder := client.NewLocalForwarder(client.LocalForwarderOptions{
+		Timeout:               *requestTimeout,
+		TrustForwardedHeaders: cfg.Forwarding.TrustClientHeaders,
+		ResponseHeaders:       responseHeaderRules(cfg.ResponseHeaders),
+		CORS:                  corsOptions(cfg.CORS),
+		Limits:                client.ResponseLimits(cfg.ResponseLimits),
+		Schedule:              forwarderSchedule,
+		Unmatched:             unmatched,
+		AgentHeaders:          agentHeaders(cfg.Forwarding, build.Version, agentName),
+		JWT:                   jwtOptions(cfg.JWT),
+		GeoTable:              geoTable,
+		Quota:                 tunnelQuota,
+		Recorder:              recorder,
+		HostOverrides:         client.HostOverrides(cfg.Hosts),
+		WarmConns:             *warmConns,
+		RestartGrace:          *restartGrace,
+		OnLocalState:          localStateHandler(localServiceCheck),
+	})
 
 	// Remote or Local Config
 	if *remoteConfig {
@@ -159,6 +486,65 @@ func main() {
 	} else {
 		parseLocalServices(*localServices, forwarder)
 	}
+	services := forwarder.Backends()
+	if err := addConfigBackends(cfg.Backends, forwarder); err != nil {
+		log.Fatalf("Invalid config file %s:\n%v", *configPath, err)
+	}
+	routes := newRouteTable(forwarder, services, cfg.Backends)
+
+	// Resolve capability allowlist: flag > config file > defaults
+	capabilityNames := splitList(*capabilities)
+	explicitCapabilities := len(capabilityNames) > 0
+	if !explicitCapabilities && len(cfg.Capabilities) > 0 {
+		capabilityNames = cfg.Capabilities
+		explicitCapabilities = true
+	}
+	if !explicitCapabilities {
+		capabilityNames = append([]string(nil), client.DefaultCapabilities...)
+		if *execEnabled {
+			capabilityNames = append(capabilityNames, client.CapabilityExec)
+		}
+	}
+	caps, err := client.NewCapabilities(capabilityNames)
+	if err != nil {
+		log.Fatalf("Invalid capabilities: %v", err)
+	}
+	logger.Info("Capabilities configured", "allowed", caps.List(), "refused", caps.Refused())
+	audit.Record(audit.TypeCapability, "configure", audit.OutcomeSuccess, map[string]any{
+		"granted": caps.List(),
+		"refused": caps.Refused(),
+	})
+
+	// Create exec handler (opt-in)
+	var execHandler *client.ExecHandler
+	if *execEnabled && !caps.Allows(client.CapabilityExec) {
+		logger.Warn("Remote exec enabled by flag but refused by capability allowlist", "audit", true)
+	} else if *execEnabled {
+		allowed := splitList(*execAllow)
+		if len(allowed) == 0 {
+			log.Fatal("Remote exec requires -exec-allow with at least one command")
+		}
+		handler, err := client.NewExecHandler(allowed, *execTimeout)
+		if err != nil {
+			log.Fatalf("Invalid -exec-allow: %v", err)
+		}
+		execHandler = handler
+		logger.Warn("Remote exec enabled", "audit", true, "allowed", allowed)
+	}
+
+	// Graceful restart (SIGHUP / admin API)
+	restartCh := make(chan string, 1)
+	watchRestartSignal(restartCh)
+
+	// Auto-update (signed releases only)
+	if *autoUpdate {
+		updater, err := update.NewUpdater(*updateURL, *updateKey, build.Version)
+		if err != nil {
+			log.Fatalf("Failed to configure auto-update: %v", err)
+		}
+		logger.Info("Auto-update enabled", "interval", *autoUpdateInterval, "url", *updateURL)
+		scheduleAutoUpdate(updater, *autoUpdateInterval, restartCh)
+	}
 
 	// Create metadata with subdomains
 	metadata := make(map[string]string)
@@ -167,125 +553,315 @@ func main() {
 		metadata["subdomains"] = strings.Join(subs, ",")
 	}
 
+	// Process mới của graceful restart: Core có thể chuyển streams mới sang connection này
+	if isHandoffChild() {
+		metadata["handoff"] = "true"
+	}
+
 	// Create authenticator
-	authenticator := client.NewAuthenticator(*token, *agentID, *version, nil, metadata)
+	if refused := caps.Refused(); len(refused) > 0 {
+		metadata["capabilities_refused"] = strings.Join(refused, ",")
+	}
+	// Build info và config digest giúp Core/operators biết chính xác agent đang chạy gì
+	if build.Commit != "" {
+		metadata["build_commit"] = build.Commit
+	}
+	metadata["config_digest"] = digest
+	authenticator := client.NewAuthenticator(*token, *agentID, build.Version, caps.List(), metadata)
+	scheduleSecretRefresh(cfg.Secrets.Refresh, authenticator, routes)
 
-	// Create heartbeat
-	heartbeat := client.NewHeartbeat(connector, *heartbeatInterval)
+	frameDump, err := openFrameDump()
+	if err != nil {
+		log.Fatalf("Failed to open frame dump file: %v", err)
+	}
 
-	// Setup connection callbacks
-	connector.SetOnConnected(func(conn net.Conn) {
-		log.Printf("Connected to server: %s", *serverAddr)
+	// Connector và dispatcher tham chiếu lẫn nhau qua callbacks
+	var (
+		connector     *client.Connector
+		dispatcher    *client.Dispatcher
+		streamManager *client.StreamManager
+		pauser        *autoPause
+	)
 
-		// Set connection for dispatcher
-		dispatcher.SetConnection(conn)
+	// Create connector
+	linkQuality := client.NewLinkQuality(*linkQualityThreshold, onLowLinkQuality)
+	connected := false
+	connector = client.NewConnector(*serverAddr, client.ConnectorOptions{
+		TLSConfig:     tlsConfig,
+		BindAddress:   *bindAddr,
+		Socket:        socketOptions(cfg.Socket),
+		Transport:     transport,
+		Memory:        memory,
+		RetryInterval: 1 * time.Second,
+		Faults:        faults,
+		FrameDump:     frameDump,
+		OnConnected: func(conn net.Conn) {
+			log.Printf("Connected to server: %s", *serverAddr)
+			if connected {
+				linkQuality.RecordReconnect()
+			}
+			connected = true
 
-		// Start dispatcher
-		if err := dispatcher.Start(); err != nil {
-			log.Printf("Failed to start dispatcher: %v", err)
-			return
-		}
+			// Core bắt đầu lại stream IDs cho mỗi connection: streams của
+			// connection cũ phải đóng trước để IDs của chúng được dùng lại
+			if n := streamManager.CloseAll(); n > 0 {
+				logger.Warn("Closed streams of the previous connection", "streams", n)
+			}
+			streamManager.ResetRemoteIDs()
 
-		// Send authentication
-		authFrame, err := authenticator.CreateAuthFrame()
-		if err != nil {
-			log.Printf("Failed to create auth frame: %v", err)
-			return
-		}
+			// Set connection for dispatcher
+			dispatcher.SetConnection(conn)
 
-		if err := connector.SendFrame(authFrame); err != nil {
-			log.Printf("Failed to send auth frame: %v", err)
-			return
-		}
+			// Start dispatcher
+			if err := dispatcher.Start(ctx); err != nil {
+				log.Printf("Failed to start dispatcher: %v", err)
+				return
+			}
 
-		log.Println("Authentication frame sent")
-	})
+			// Send authentication
+			authFrame, err := authenticator.CreateAuthFrame()
+			if err != nil {
+				log.Printf("Failed to create auth frame: %v", err)
+				return
+			}
 
-	connector.SetOnDisconnected(func() {
-		logger.Info("Disconnected from server")
-		dispatcher.Stop()
+			if err := connector.SendFrame(ctx, authFrame); err != nil {
+				log.Printf("Failed to send auth frame: %v", err)
+				metrics.GetMetrics().RecordAuth(false)
+				audit.Record(audit.TypeAuth, "send", audit.OutcomeFailure, map[string]any{
+					"server": *serverAddr,
+					"error":  err.Error(),
+				})
+				return
+			}
+			audit.Record(audit.TypeAuth, "send", audit.OutcomeSuccess, map[string]any{"server": *serverAddr})
+
+			log.Println("Authentication frame sent")
+		},
+		OnDisconnected: func() {
+			logger.Info("Disconnected from server")
+			dispatcher.Stop()
+		},
+		OnError: func(err error) {
+			logger.Error("Connection error", "error", err)
+		},
 	})
 
-	connector.SetOnError(func(err error) {
-		logger.Error("Connection error", "error", err)
+	// Create stream manager
+	streamManager = client.NewStreamManager(connector, client.StreamManagerOptions{
+		Memory:           memory,
+		MaxRemoteStreams: *maxStreams,
+		RemoteOpenRate:   *maxStreamOpenRate,
+		OnStreamCreated: func(streamID uint32) {
+			logger.Info("Stream created", "streamID", streamID)
+			metrics.GetMetrics().IncrementStreamsTotal()
+			metrics.GetMetrics().IncrementStreamsActive()
+			streamCheck.UpdateCheck(health.HealthStatusHealthy, "Streams active")
+		},
+		OnStreamClosed: func(streamID uint32) {
+			logger.Info("Stream closed", "streamID", streamID)
+			metrics.GetMetrics().DecrementStreamsActive()
+			metrics.GetMetrics().IncrementStreamsCompleted()
+			if metrics.GetMetrics().GetSnapshot().StreamsActive == 0 {
+				streamCheck.UpdateCheck(health.HealthStatusHealthy, "No active streams")
+			}
+		},
 	})
 
-	// Setup dispatcher callbacks
-	dispatcher.SetOnConnectionClosed(func() {
-		logger.Warn("Dispatcher connection closed, triggering reconnect")
-		go func() {
-			if err := connector.Reconnect(); err != nil {
-				logger.Error("Reconnect failed", "error", err)
-			}
-		}()
+	// Auto-pause: báo Core ngừng route khi default local service down quá lâu
+	if *pauseAfter > 0 {
+		if forwarder.GetDefaultURL() == "" {
+			logger.Warn("-pause-after has no effect without a default local service")
+		} else {
+			pauser = newAutoPause(*pauseAfter, *probeInterval, forwarder.GetDefaultURL, connector, localServiceCheck)
+		}
+	}
+
+	// Create heartbeat
+	heartbeat := client.NewHeartbeat(connector, *heartbeatInterval, client.HeartbeatOptions{
+		Scheduler: jobs,
+		ProbeSize: *heartbeatProbeSize,
+		Quality:   linkQuality,
 	})
 
-	dispatcher.SetOnError(func(err error) {
-		logger.Error("Dispatcher error", "error", err)
-		go func() {
-			if err := connector.Reconnect(); err != nil {
-				logger.Error("Reconnect failed after dispatcher error", "error", err)
+	// Create dispatcher
+	dispatcher = client.NewDispatcher(client.DispatcherOptions{
+		IdleTimeout:  idleTimeout(),
+		Faults:       faults,
+		FrameDump:    frameDump,
+		RequireAuth:  true,
+		MaxFrameRate: *maxFrameRate,
+		FrameBurst:   *frameBurst,
+		ErrorPolicy:  errorPolicy(ctx, cfg.ErrorPolicy, connector, streamManager),
+		ControlHandler: func(frame *v1.Frame) error {
+			switch frame.Type {
+			case v1.FrameAuth:
+				// Handle auth response
+				if err := authenticator.HandleAuthResponse(frame); err != nil {
+					logger.Error("Authentication failed", "error", err)
+					connectionCheck.UpdateCheck(health.HealthStatusUnhealthy, "Authentication failed")
+					metrics.GetMetrics().RecordAuth(false)
+					audit.Record(audit.TypeAuth, "response", audit.OutcomeFailure, map[string]any{
+						"server": *serverAddr,
+						"error":  err.Error(),
+					})
+					return err
+				}
+				if publicURL := authenticator.PublicURL(); publicURL != "" {
+					logger.Info("Authentication successful", "public_url", publicURL)
+				} else {
+					logger.Info("Authentication successful")
+				}
+				audit.Record(audit.TypeAuth, "response", audit.OutcomeSuccess, map[string]any{"server": *serverAddr})
+				metrics.GetMetrics().RecordAuth(true)
+				connectionCheck.UpdateCheck(health.HealthStatusHealthy, "Authenticated")
+				dispatcher.MarkAuthenticated()
+				// Start heartbeat, auth response cũng chứng minh link còn sống
+				heartbeat.Start(ctx)
+				heartbeat.Ack()
+				// Graceful restart: báo process cũ bắt đầu drain
+				notifyHandoffReady()
+				// Connection mới không biết agent đang pause
+				pauser.resend(ctx)
+
+			case v1.FrameHeartbeat:
+				logger.Debug("Heartbeat ACK received")
+				heartbeat.AckEcho(frame.Payload)
+
+			case v1.FrameClose:
+				// GoAway: Core sắp dừng, drain rồi reconnect thay vì đóng ngay
+				goAway, err := client.ParseGoAway(frame)
+				if err != nil {
+					logger.Warn("Invalid GoAway payload, closing connection", "error", err)
+				}
+				if goAway != nil {
+					handleGoAway(ctx, goAway, connector, streamManager, connectionCheck)
+					return nil
+				}
+
+				// Server wants to close connection
+				logger.Info("Server requested connection close")
+				connectionCheck.UpdateCheck(health.HealthStatusUnhealthy, "Server requested close")
+				connector.Disconnect()
+
+			default:
+				logger.Warn("Unknown control frame type", "type", frame.Type)
 			}
-		}()
+			return nil
+		},
+		StreamHandler: func(frame *v1.Frame) error {
+			return handleStreamFrame(ctx, frame, streamManager, memory, forwarder, execHandler, caps, connector, localServiceCheck)
+		},
+		OnConnectionClosed: func() {
+			if tunnelClosed() {
+				logger.Debug("Dispatcher connection closed while tunnel is closed")
+				return
+			}
+			logger.Warn("Dispatcher connection closed, triggering reconnect")
+			go func() {
+				if err := connector.Reconnect(ctx); err != nil {
+					logger.Error("Reconnect failed", "error", err)
+				}
+			}()
+		},
+		OnError: func(err error) {
+			logger.Error("Dispatcher error", "error", err)
+			if tunnelClosed() {
+				return
+			}
+			go func() {
+				if err := connector.Reconnect(ctx); err != nil {
+					logger.Error("Reconnect failed after dispatcher error", "error", err)
+				}
+			}()
+		},
 	})
 
-	// Setup dispatcher handlers
-	dispatcher.SetControlHandler(func(frame *v1.Frame) error {
-		switch frame.Type {
-		case v1.FrameAuth:
-			// Handle auth response
-			if err := authenticator.HandleAuthResponse(frame); err != nil {
-				logger.Error("Authentication failed", "error", err)
-				connectionCheck.UpdateCheck(health.HealthStatusUnhealthy, "Authentication failed")
-				return err
-			}
-			logger.Info("Authentication successful")
-			connectionCheck.UpdateCheck(health.HealthStatusHealthy, "Authenticated")
-			// Start heartbeat
-			heartbeat.Start()
+	// Debug logging tạm thời (SIGUSR1 / admin API)
+	watchLogLevelSignal(*debugDuration)
 
-		case v1.FrameHeartbeat:
-			// Heartbeat ACK, do nothing
-			logger.Debug("Heartbeat ACK received")
+	// Diagnostics bundle (SIGUSR2 / admin API)
+	registerDiagnostics(cfg, streamManager, connector)
+	watchDiagnosticsSignal(*diagDir)
 
-		case v1.FrameClose:
-			// Server wants to close connection
-			logger.Info("Server requested connection close")
-			connectionCheck.UpdateCheck(health.HealthStatusUnhealthy, "Server requested close")
-			connector.Disconnect()
+	// Start admin API if enabled
+	var adminServer *admin.Server
+	if *adminEnabled {
+		adminServer = admin.NewServer(*adminAddr)
+		if *adminToken != "" {
+			registerDiagnosticsHandler(adminServer, *diagDir, *adminToken)
+			registerRestartHandler(adminServer, restartCh, *adminToken)
+		} else {
+			logger.Warn("Restart and diagnostics admin endpoints disabled; they require -admin-token")
+		}
+		registerStatusHandler(adminServer, digest)
+		registerRoutesHandler(adminServer, routes)
+		registerRouteStatsHandler(adminServer)
+		registerLogLevelHandler(adminServer, *debugDuration)
+		registerJobsHandler(adminServer)
+		if *inspectKeep > 0 {
+			registerInspectorHandlers(adminServer, recorder)
+		}
+		if *idleShutdown > 0 {
+			registerWakeHandler(adminServer, ctx, connector)
+		}
+		if caps.Allows(client.CapabilityFileTransfer) {
+			if *adminToken != "" && *filesDir != "" {
+				registerFileTransferHandlers(adminServer, client.NewFileTransfer(streamManager), *adminToken, *filesDir)
+			} else {
+				logger.Warn("File transfer admin endpoints disabled; they require -admin-token and -files-dir")
+			}
+		}
+		if err := startAdminServer(adminServer); err != nil {
+			log.Fatalf("Failed to start admin API: %v", err)
+		}
+	}
 
-		default:
-			logger.Warn("Unknown control frame type", "type", frame.Type)
+	// Connect to server, trừ khi tunnel đang ngoài khung giờ hoạt động hoặc
+	// process trước đã exit vì idle
+	if *idleShutdown > 0 {
+		wakeAfterIdleExit(*wakeOnStart)
+	}
+	switch {
+	case scheduleClosed.Load():
+		logger.Info("Outside scheduled hours, tunnel stays closed", "opens_at", tunnelSchedule.Next(time.Now()))
+		connectionCheck.UpdateCheck(health.HealthStatusDegraded, "Closed outside scheduled hours")
+	case idleSleeping.Load():
+		logger.Info("Started after idle shutdown, tunnel stays closed until POST /wake", "marker", idleMarkerPath())
+		connectionCheck.UpdateCheck(health.HealthStatusDegraded, "Sleeping after idle shutdown")
+	default:
+		logger.Info("Connecting to server", "address", *serverAddr, "tls", *useTLS)
+		if err := connector.Connect(ctx); err != nil {
+			logger.Error("Failed to connect", "error", err)
+			log.Fatalf("Failed to connect: %v", err)
 		}
-		return nil
-	})
+	}
+	if cfg.Schedule.Outside == "close" && tunnelSchedule != nil {
+		scheduleTunnelHours(ctx, tunnelSchedule, connector, streamManager, connectionCheck)
+	}
 
-	dispatcher.SetStreamHandler(func(frame *v1.Frame) error {
-		return handleStreamFrame(frame, streamManager, forwarder, connector, localServiceCheck)
-	})
+	if pauser != nil {
+		pauser.schedule()
+	}
+	if *warmConns > 0 {
+		newWarmer(forwarder, localServiceCheck).start(ctx)
+	}
 
-	// Setup stream manager callbacks
-	streamManager.SetOnStreamCreated(func(streamID uint32) {
-		logger.Info("Stream created", "streamID", streamID)
-		metrics.GetMetrics().IncrementStreamsTotal()
-		metrics.GetMetrics().IncrementStreamsActive()
-		streamCheck.UpdateCheck(health.HealthStatusHealthy, "Streams active")
-	})
+	// Local listeners: connections tới đây được forward tới services phía Core
+	listeners, _ := parseListeners(*listenAddrs) // đã được kiểm tra bởi validateFlags
+	if err := startListeners(ctx, listeners, streamManager); err != nil {
+		fatalShutdown(connector, "Failed to start local listener: %v", err)
+	}
 
-	streamManager.SetOnStreamClosed(func(streamID uint32) {
-		logger.Info("Stream closed", "streamID", streamID)
-		metrics.GetMetrics().DecrementStreamsActive()
-		metrics.GetMetrics().IncrementStreamsCompleted()
-		if metrics.GetMetrics().GetSnapshot().StreamsActive == 0 {
-			streamCheck.UpdateCheck(health.HealthStatusHealthy, "No active streams")
-		}
-	})
+	// Idle shutdown: exit hoặc sleep khi không có request trong -idle-shutdown
+	idleCh := make(chan string, 1)
+	if *idleShutdown > 0 {
+		scheduleIdleShutdown(*idleShutdown, *idleAction, idleCh, connector, streamManager, connectionCheck)
+	}
 
-	// Connect to server
-	logger.Info("Connecting to server", "address", *serverAddr, "tls", *useTLS)
-	if err := connector.Connect(); err != nil {
-		logger.Error("Failed to connect", "error", err)
-		log.Fatalf("Failed to connect: %v", err)
+	// Leak watchdog: baseline goroutines đo sau khi agent đã start xong
+	if *watchdogInterval > 0 {
+		startWatchdog(*watchdogInterval, streamManager)
 	}
 
 	// Wait for interrupt signal
@@ -293,193 +869,215 @@ func main() {
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
 	logger.Info("Agent started", "press", "Ctrl+C to stop")
-	<-sigCh
-
-	logger.Info("Shutting down...")
-
-	// Send Close Frame
-	closeFrame := &v1.Frame{
-		Version:  v1.Version,
-		Type:     v1.FrameClose,
-		Flags:    v1.FlagNone,
-		StreamID: v1.StreamIDControl,
-	}
-	if err := connector.SendFrame(closeFrame); err != nil {
-		logger.Warn("Failed to send close frame", "error", err)
+	var shutdownCode, shutdownMessage string
+	select {
+	case sig := <-sigCh:
+		shutdownCode, shutdownMessage = client.ShutdownSignal, "received "+sig.String()
+	case shutdownCode = <-idleCh:
+		shutdownMessage = fmt.Sprintf("no requests for %s", *idleShutdown)
+	case shutdownCode = <-restartCh:
+		shutdownMessage = "replaced by a new process"
+		// Process mới đã ready: giải phóng admin port và chờ streams hiện tại
+		if adminServer != nil {
+			shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			adminServer.Shutdown(shutdownCtx)
+			cancel()
+		}
+		drainStreams(streamManager, *drainTimeout)
 	}
 
-	// Give some time for the write buffer to flush (writeLoop interval is 10ms)
-	time.Sleep(100 * time.Millisecond)
-
-	// Stop heartbeat
-	heartbeat.Stop()
+	logger.Info("Shutting down...", "reason", shutdownCode)
 
-	// Stop dispatcher
+	// Ngừng nhận frames từ Core, heartbeat và các jobs định kỳ khác
 	dispatcher.Stop()
+	heartbeat.Stop()
+	jobs.Stop()
 
-	// Disconnect
-	connector.Close()
+	// Flush frames đang chờ rồi gửi Close Frame kèm lý do để Core phân biệt
+	// shutdown chủ động với crash, sau đó disconnect
+	sendShutdown(connector, shutdownCode, shutdownMessage)
 
+	if tunnelQuota != nil {
+		saveQuota(tunnelQuota)
+	}
+	if recorder != nil {
+		closeRecorder(recorder)
+	}
+	clearCrashLoop()
 	logger.Info("Shutdown complete")
 }
 
-// startMetricsServer starts HTTP server for metrics
-func startMetricsServer(port int) {
-	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
-		snapshot := metrics.GetMetrics().GetSnapshot()
-
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, `{
-  "connections": {
-    "total": %d,
-    "active": %d,
-    "reconnections": %d,
-    "reconnection_errors": %d
-  },
-  "streams": {
-    "total": %d,
-    "active": %d,
-    "completed": %d,
-    "failed": %d
-  },
-  "requests": {
-    "total": %d,
-    "success": %d,
-    "failed": %d,
-    "duration_us": %d
-  },
-  "frames": {
-    "received": %d,
-    "sent": %d,
-    "errors": %d
-  },
-  "heartbeat": {
-    "sent": %d,
-    "failed": %d
-  },
-  "local_service": {
-    "requests_total": %d,
-    "requests_error": %d,
-    "duration_us": %d
-  },
-  "timestamps": {
-    "last_connection": "%s",
-    "last_request": "%s",
-    "last_heartbeat": "%s"
-  },
-  "health": {
-    "status": "%s"
-  }
-}`,
-			snapshot.ConnectionsTotal,
-			snapshot.ConnectionsActive,
-			snapshot.ReconnectionsTotal,
-			snapshot.ReconnectionErrors,
-			snapshot.StreamsTotal,
-			snapshot.StreamsActive,
-			snapshot.StreamsCompleted,
-			snapshot.StreamsFailed,
-			snapshot.RequestsTotal,
-			snapshot.RequestsSuccess,
-			snapshot.RequestsFailed,
-			snapshot.RequestDuration,
-			snapshot.FramesReceived,
-			snapshot.FramesSent,
-			snapshot.FramesError,
-			snapshot.HeartbeatsSent,
-			snapshot.HeartbeatsFailed,
-			snapshot.LocalRequestsTotal,
-			snapshot.LocalRequestsError,
-			snapshot.LocalRequestDuration,
-			snapshot.LastConnectionTime.Format(time.RFC3339),
-			snapshot.LastRequestTime.Format(time.RFC3339),
-			snapshot.LastHeartbeatTime.Format(time.RFC3339),
-			health.GetHealthChecker().GetOverallStatus(),
-		)
-	})
-
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		status := health.GetHealthChecker().GetOverallStatus()
-		checks := health.GetHealthChecker().GetAllChecks()
+// errorFrameTimeout giới hạn thời gian chờ error frame được ghi xuống connection
+const errorFrameTimeout = 10 * time.Second
+
+// logForwardResult ghi debug log cho response mà forwarder đã ghi vào stream.
+// Lỗi sau khi headers đã gửi được đánh dấu: Core đã nhận một phần response.
+func logForwardResult(streamID uint32, result *client.ForwardResult, err error) {
+	args := []any{
+		"streamID", streamID,
+		"traceID", result.TraceID,
+		"source", result.Source,
+		"backend", result.Backend,
+		"status", result.StatusCode,
+		"headerBytes", result.HeaderBytes,
+		"bodyBytes", result.BodyBytes,
+		"duration", result.Duration,
+	}
+	if result.FirstByte > 0 {
+		args = append(args, "firstByte", result.FirstByte)
+	}
+	if err != nil {
+		logger.Debug("Request failed", append(args, "headersWritten", result.HeadersWritten())...)
+		return
+	}
+	logger.Debug("Request forwarded", args...)
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, `{
-  "status": "%s",
-  "checks": {`,
-			status)
+// sendErrorFrame báo Core stream thất bại (FrameData với FlagError) và chờ frame
+// được ghi thật sự: queue đầy thì chờ thay vì bỏ frame, để Core không chờ mãi
+// response của stream. Connection đóng trước khi ghi thì Core đã huỷ stream.
+func sendErrorFrame(ctx context.Context, connector *client.Connector, streamID uint32, cause error) {
+	errorFrame := &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameData,
+		Flags:    v1.FlagError,
+		StreamID: streamID,
+		Payload:  []byte(cause.Error()),
+	}
 
-		first := true
-		for name, check := range checks {
-			if !first {
-				fmt.Fprint(w, ",")
-			}
-			first = false
-			checkStatus, message, lastCheck := check.GetStatus()
-			fmt.Fprintf(w, `
-    "%s": {
-      "status": "%s",
-      "message": "%s",
-      "last_check": "%s"
-    }`,
-				name, checkStatus, message, lastCheck.Format(time.RFC3339))
-		}
-
-		fmt.Fprint(w, `
-  }
-}`)
-	})
+	ctx, cancel := context.WithTimeout(ctx, errorFrameTimeout)
+	defer cancel()
+	err := connector.SendFrameAcked(ctx, errorFrame)
+	metrics.GetMetrics().RecordErrorFrame(err == nil)
+	switch {
+	case err == nil:
+	case errors.Is(err, client.ErrConnectionClosed), errors.Is(err, client.ErrNotConnected):
+		logger.Warn("Error frame not delivered, connection closed (Core drops the stream)",
+			"streamID", streamID,
+			"originalError", cause,
+		)
+	default:
+		logger.Error("Failed to send error frame",
+			"error", err,
+			"streamID", streamID,
+			"originalError", cause,
+		)
+		metrics.GetMetrics().IncrementFramesError()
+	}
+}
 
-	addr := fmt.Sprintf(":%d", port)
-	logger.Info("Metrics server listening", "address", addr)
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		logger.Error("Metrics server error", "error", err)
+// idleTimeout trả về thời gian không nhận được frame nào từ Core trước khi
+// connection bị drop: -read-timeout, hoặc IdleTimeoutFactor × -heartbeat
+func idleTimeout() time.Duration {
+	if *readTimeout > 0 {
+		return *readTimeout
 	}
+	return client.IdleTimeoutFor(*heartbeatInterval)
 }
 
 // handleStreamFrame xử lý stream frames
 func handleStreamFrame(
+	ctx context.Context,
 	frame *v1.Frame,
 	streamManager *client.StreamManager,
+	memory *client.MemoryBudget,
 	forwarder *client.LocalForwarder,
+	execHandler *client.ExecHandler,
+	caps *client.Capabilities,
 	connector *client.Connector,
 	localServiceCheck *health.Check,
 ) error {
 	switch frame.Type {
 	case v1.FrameOpenStream:
+		// Core phải mở stream với odd ID tăng dần, ID sai bị reset thay vì xử lý
+		if err := streamManager.ValidateRemoteOpen(frame.StreamID); err != nil {
+			rejectStreamFrame(ctx, connector, frame, err, errors.Is(err, client.ErrProtocolViolation))
+			return nil
+		}
+
+		// Parse open header (kind + metadata)
+		kind, streamMeta, body, err := client.ParseOpenPayload(frame.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to parse open payload: %w", err)
+		}
+
 		// Create new stream
-		stream, err := streamManager.CreateStream(frame.StreamID)
+		// Stream không tạo được (ID đang dùng): reset để client của Core nhận
+		// lỗi ngay thay vì chờ timeout; stream đang chạy với ID đó giữ nguyên
+		// Kind, metadata và priority hint (thứ tự ghi response frames) được
+		// gán trước khi stream được publish
+		stream, err := streamManager.CreateStreamKind(frame.StreamID, kind, streamMeta)
 		if err != nil {
-			return fmt.Errorf("failed to create stream: %w", err)
+			rejectStreamFrame(ctx, connector, frame, fmt.Errorf("failed to create stream: %w", err), false)
+			return nil
 		}
+		// Trace ID của Core (hoặc ID mới) có trong mọi log của stream
+		traceID := stream.EnsureTraceID()
 
 		// Forward request to local service in goroutine
 		go func() {
-			ctx, cancel := context.WithTimeout(context.Background(), *requestTimeout)
+			timeout := *requestTimeout
+			if kind == client.StreamKindExec && execHandler != nil {
+				timeout = execHandler.Timeout()
+			}
+			reqCtx, cancel := context.WithTimeout(ctx, timeout)
 			defer cancel()
 
-			err := forwarder.ForwardRequest(ctx, stream, frame.Payload)
-			if err != nil {
-				logger.Error("Failed to forward request", "error", err, "streamID", frame.StreamID)
-				metrics.GetMetrics().IncrementStreamsFailed()
-				localServiceCheck.UpdateCheck(health.HealthStatusDegraded, err.Error())
-
-				// Send error frame (using FrameData with FlagError)
-				errorFrame := &v1.Frame{
-					Version:  v1.Version,
-					Type:     v1.FrameData,
-					Flags:    v1.FlagError,
-					StreamID: frame.StreamID,
-					Payload:  []byte(err.Error()),
+			var err error
+			switch {
+			case draining.Load():
+				// Process mới đã nhận streams mới, connection này chỉ đang drain
+				err = fmt.Errorf("agent is restarting, retry the request")
+			case goingAway.Load():
+				// Core đã gửi GoAway, stream mới phải đi qua Core tiếp theo
+				err = fmt.Errorf("core is going away, retry the request")
+			case memory.UnderPressure():
+				// Shed load cho đến khi buffered payload giảm dưới cap
+				metrics.GetMetrics().IncrementStreamsShed()
+				err = fmt.Errorf("%w, retry the request", client.ErrMemoryPressure)
+			case !caps.AllowsKind(kind):
+				logger.Warn("Stream refused by capability allowlist",
+					"audit", true,
+					"streamID", frame.StreamID,
+					"traceID", traceID,
+					"kind", kind,
+					"capability", client.CapabilityForKind(kind),
+				)
+				audit.Record(audit.TypeCapability, "stream_open", audit.OutcomeDenied, map[string]any{
+					"stream_id":  frame.StreamID,
+					"kind":       kind,
+					"capability": client.CapabilityForKind(kind),
+				})
+				err = fmt.Errorf("capability %q is disabled on this agent", client.CapabilityForKind(kind))
+			case kind == client.StreamKindHTTP:
+				var result *client.ForwardResult
+				result, err = forwarder.ForwardRequest(reqCtx, stream, body)
+				logForwardResult(frame.StreamID, result, err)
+			case kind == client.StreamKindExec:
+				if execHandler == nil {
+					err = fmt.Errorf("remote exec is disabled on this agent")
+					break
 				}
-				if sendErr := connector.SendFrame(errorFrame); sendErr != nil {
-					logger.Error("Failed to send error frame",
-						"error", sendErr,
-						"streamID", frame.StreamID,
-						"originalError", err,
-					)
-					metrics.GetMetrics().IncrementFramesError()
+				err = execHandler.Handle(reqCtx, stream, body)
+			default:
+				err = fmt.Errorf("unsupported stream kind: %s", kind)
+			}
+			switch {
+			case stream.Orphaned():
+				// Connection của stream đã mất, CloseAll đã đóng stream; lỗi
+				// ghi response không nói gì về local service
+				logger.Warn("Stream abandoned by reconnect", "error", err, "streamID", frame.StreamID, "traceID", traceID)
+				return
+			case err != nil:
+				logger.Error("Failed to forward request", "error", err, "streamID", frame.StreamID, "traceID", traceID)
+				metrics.GetMetrics().IncrementStreamsFailed()
+				// Unhealthy (down quá restart grace) chỉ hết khi local service phục hồi
+				if status, _, _ := localServiceCheck.GetStatus(); status != health.HealthStatusUnhealthy {
+					localServiceCheck.UpdateCheck(health.HealthStatusDegraded, err.Error())
 				}
-			} else {
+
+				sendErrorFrame(ctx, connector, frame.StreamID, err)
+			default:
 				// Update health check on success
 				localServiceCheck.UpdateCheck(health.HealthStatusHealthy, "Local service responding")
 			}
@@ -489,25 +1087,27 @@ func handleStreamFrame(
 				logger.Warn("Failed to close stream",
 					"error", closeErr,
 					"streamID", frame.StreamID,
+					"traceID", traceID,
 				)
+			} else {
+				metrics.GetMetrics().RecordStreamEnd(time.Since(stream.CreatedAt))
 			}
-			streamManager.CloseStream(frame.StreamID)
+			streamManager.CloseStreamOf(stream)
 		}()
 
 	case v1.FrameData:
 		// Data frame - forward to stream
 		stream, ok := streamManager.GetStream(frame.StreamID)
 		if !ok {
-			// If stream not found, it might have been closed already.
-			// Just ignore it to avoid connection drops.
-			logger.Debug("Received data for unknown stream (likely closed)", "streamID", frame.StreamID)
+			// Stream đã đóng (data đến sau khi đóng là race bình thường) hoặc
+			// chưa từng được mở (vi phạm protocol); cả hai đều được reset
+			closed := streamManager.IsClosedID(frame.StreamID)
+			rejectStreamFrame(ctx, connector, frame, client.ErrStreamNotFound, !closed)
 			return nil
 		}
 
-		select {
-		case stream.DataOut() <- frame.Payload:
-		case <-stream.CloseCh():
-			return client.ErrStreamNotFound
+		if err := stream.Deliver(frame.Payload); err != nil {
+			return err
 		}
 
 		// Check EndStream flag
@@ -526,6 +1126,32 @@ func handleStreamFrame(
 	return nil
 }
 
+// rejectStreamFrame gửi reset frame (có reset code theo reason) cho stream
+// của frame bị từ chối. violation = true khi frame vi phạm protocol (được đếm
+// trong metrics).
+func rejectStreamFrame(ctx context.Context, connector *client.Connector, frame *v1.Frame, reason error, violation bool) {
+	if violation {
+		metrics.GetMetrics().IncrementProtocolViolations()
+		logger.Warn("Protocol violation from core, resetting stream",
+			"error", reason,
+			"type", frame.Type,
+			"streamID", frame.StreamID,
+		)
+	} else {
+		logger.Debug("Rejected stream frame, resetting",
+			"error", reason,
+			"code", client.ResetCodeOf(reason),
+			"type", frame.Type,
+			"streamID", frame.StreamID,
+		)
+	}
+	metrics.GetMetrics().RecordStreamReset(string(client.ResetCodeOf(reason)))
+
+	if err := connector.SendFrame(ctx, client.NewStreamReset(frame.StreamID, reason)); err != nil {
+		logger.Warn("Failed to send reset frame", "error", err, "streamID", frame.StreamID)
+	}
+}
+
 // parseLocalServices parses comma-separated service mappings
 func parseLocalServices(input string, forwarder *client.LocalForwarder) {
 	parts := strings.Split(input, ",")
@@ -550,11 +1176,290 @@ func parseLocalServices(input string, forwarder *client.LocalForwarder) {
 		} else {
 			// Default service
 			forwarder.AddService("", part)
+			forwarder.SetDefaultURL(part)
 			logger.Info("Added default local service", "url", part)
 		}
 	}
 }
 
+// newMemoryBudget tạo memory budget từ config (nil nếu cap bị tắt), pressure
+// transitions được log và phản ánh trong health check
+func newMemoryBudget(c config.MemoryConfig, check *health.Check) *client.MemoryBudget {
+	limit := c.MaxBuffered
+	if limit == 0 {
+		limit = client.DefaultMemoryCap
+	}
+	if limit < 0 {
+		check.UpdateCheck(health.HealthStatusHealthy, "Memory cap disabled")
+		return nil
+	}
+	return client.NewMemoryBudget(limit, func(underPressure bool, buffered, limit int64) {
+		if underPressure {
+			logger.Warn("Memory cap exceeded, refusing new streams", "buffered", buffered, "limit", limit)
+			check.UpdateCheck(health.HealthStatusDegraded, fmt.Sprintf("Buffered payload %d bytes exceeds cap %d, shedding load", buffered, limit))
+			return
+		}
+		logger.Info("Memory pressure relieved", "buffered", buffered, "limit", limit)
+		check.UpdateCheck(health.HealthStatusHealthy, "Buffered payload below cap")
+	})
+}
+
+// responseHeaderRules chuyển response_headers của config file thành HeaderRules
+func responseHeaderRules(c config.ResponseHeadersConfig) client.HeaderRules {
+	rules := client.HeaderRules{Remove: c.Remove, Set: c.Set, Add: c.Add}
+	if c.Security {
+		rules.Defaults = client.SecurityHeaders
+	}
+	return rules
+}
+
+// socketOptions chuyển socket của config file (đã validate) thành SocketOptions
+func socketOptions(c config.SocketConfig) client.SocketOptions {
+	dscp, _ := config.ParseDSCP(c.DSCP)
+	if dscp != 0 && !client.DSCPSupported {
+		logger.Warn("DSCP marking is not supported on this platform, ignoring socket.dscp", "dscp", c.DSCP)
+		dscp = 0
+	}
+	return client.SocketOptions{
+		DisableNoDelay: !c.NoDelay,
+		SendBuffer:     c.SendBuffer,
+		ReceiveBuffer:  c.ReceiveBuffer,
+		DSCP:           dscp,
+	}
+}
+
+// localStateHandler cập nhật check local_service theo restart của local
+// service: restarting trong grace period là degraded, down sau grace period
+// là unhealthy, nhận connections trở lại là healthy
+func localStateHandler(check *health.Check) func(addr string, state client.LocalState) {
+	return func(addr string, state client.LocalState) {
+		switch state {
+		case client.LocalRestarting:
+			check.UpdateCheck(health.HealthStatusDegraded, "Local service restarting: "+addr+" refuses connections")
+		case client.LocalDown:
+			check.UpdateCheck(health.HealthStatusUnhealthy, fmt.Sprintf("Local service down: %s refused connections for %s", addr, *restartGrace))
+		case client.LocalUp:
+			check.UpdateCheck(health.HealthStatusHealthy, "Local service accepting connections")
+		}
+	}
+}
+
+// errorPolicy chuyển error_policy của config file thành ErrorPolicy của
+// dispatcher; reset đóng stream phía agent rồi gửi reset frame cho Core
+func errorPolicy(ctx context.Context, c config.ErrorPolicyConfig, connector *client.Connector, streamManager *client.StreamManager) *client.ErrorPolicy {
+	// Validate đã kiểm tra tên action
+	transient, _ := client.ParseErrorAction(c.Transient)
+	stream, _ := client.ParseErrorAction(c.Stream)
+	connection, _ := client.ParseErrorAction(c.Connection)
+	return &client.ErrorPolicy{
+		Transient:  transient,
+		Stream:     stream,
+		Connection: connection,
+		ResetStream: func(streamID uint32, err error) {
+			streamManager.CloseStream(streamID)
+			metrics.GetMetrics().RecordStreamReset(string(client.ResetCodeOf(err)))
+			if err := connector.SendFrame(ctx, client.NewStreamReset(streamID, err)); err != nil {
+				logger.Warn("Failed to send reset frame", "error", err, "streamID", streamID)
+			}
+		},
+	}
+}
+
+// agentHeaders chuyển forwarding của config file thành AgentHeaders, nil nếu tắt
+func agentHeaders(c config.ForwardingConfig, version, agentName string) *client.AgentHeaders {
+	if c.DisableAgentHeaders {
+		return nil
+	}
+	return &client.AgentHeaders{
+		Version:   version,
+		AgentID:   agentName,
+		UserAgent: c.UserAgent,
+	}
+}
+
+// jwtOptions chuyển jwt của config file thành JWTOptions, nil nếu tắt
+func jwtOptions(c config.JWTConfig) *client.JWTOptions {
+	if !c.Enabled {
+		return nil
+	}
+	return &client.JWTOptions{
+		JWKSURL:      c.JWKSURL,
+		Issuer:       c.Issuer,
+		Audience:     c.Audience,
+		ClaimHeaders: c.ClaimHeaders,
+		Leeway:       c.Leeway,
+		CacheTTL:     c.CacheTTL,
+	}
+}
+
+// corsOptions chuyển cors của config file thành CORSOptions, nil nếu tắt
+func corsOptions(c config.CORSConfig) *client.CORSOptions {
+	if !c.Enabled {
+		return nil
+	}
+	return &client.CORSOptions{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		ExposedHeaders:   c.ExposedHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	}
+}
+
+// addConfigBackends thêm backends từ config file (host_header, path, rewrite và transform riêng) vào forwarder
+func addConfigBackends(backends []config.BackendConfig, forwarder *client.LocalForwarder) error {
+	for i, b := range backends {
+		backend, err := configBackend(b)
+		if err != nil {
+			return fmt.Errorf("backends[%d].%w", i, err)
+		}
+		forwarder.AddBackend(backend)
+		forwarder.SetDefaultURL(nextDefaultURL(forwarder.GetDefaultURL(), b))
+		logger.Info("Added local backend", "host", b.Host, "path", b.Path, "url", redactURL(b.URL), "host_header", b.HostHeader)
+	}
+	return nil
+}
+
+// configBackend chuyển backend của config (đã được kiểm tra bởi Validate) thành client.Backend
+func configBackend(b config.BackendConfig) (client.Backend, error) {
+	rewrite := client.Rewrite{
+		StripPrefix: b.Rewrite.StripPrefix,
+		Replacement: b.Rewrite.Replacement,
+		AddPrefix:   b.Rewrite.AddPrefix,
+	}
+	if b.Rewrite.Regex != "" {
+		// Đã được kiểm tra bởi Validate
+		rewrite.Regex = regexp.MustCompile(b.Rewrite.Regex)
+	}
+
+	transform, err := compileTransform(b.Transform)
+	if err != nil {
+		return client.Backend{}, fmt.Errorf("transform: %w", err)
+	}
+
+	backendSchedule, err := b.Schedule.Schedule()
+	if err != nil {
+		return client.Backend{}, fmt.Errorf("schedule: %w", err)
+	}
+
+	var bridge *client.MQTTBridge
+	if config.IsBrokerURL(b.URL) {
+		bridge = newMQTTBridge(b)
+	}
+
+	auth, err := backendAuth(b.Auth)
+	if err != nil {
+		return client.Backend{}, fmt.Errorf("auth.%w", err)
+	}
+
+	webhook, err := webhookVerifier(b.Webhook)
+	if err != nil {
+		return client.Backend{}, fmt.Errorf("webhook: %w", err)
+	}
+
+	var scan *client.BodyScanner
+	if b.Scan.URL != "" {
+		scan, err = client.NewBodyScanner(client.BodyScanOptions{
+			URL:       b.Scan.URL,
+			Requests:  b.Scan.Requests,
+			Responses: b.Scan.Responses,
+			MinSize:   b.Scan.MinSize,
+			MaxSize:   b.Scan.MaxSize,
+			Timeout:   b.Scan.Timeout,
+			FailOpen:  b.Scan.FailOpen,
+		})
+		if err != nil {
+			return client.Backend{}, fmt.Errorf("scan: %w", err)
+		}
+	}
+
+	var access *client.AccessPolicy
+	if !b.Access.Empty() {
+		hours, err := b.Access.Schedule()
+		if err != nil {
+			return client.Backend{}, fmt.Errorf("access.hours: %w", err)
+		}
+		access = &client.AccessPolicy{
+			AllowCountries: b.Access.AllowCountries,
+			DenyCountries:  b.Access.DenyCountries,
+			Hours:          hours,
+		}
+	}
+
+	connection := b.Connection
+	if connection == "reuse" {
+		connection = client.ConnectionReuse
+	}
+	hostHeader := b.HostHeader
+	if hostHeader == "preserve" {
+		hostHeader = client.HostHeaderPreserve
+	}
+
+	return client.Backend{
+		Host:       b.Host,
+		Path:       b.Path,
+		URL:        b.URL,
+		HostHeader: hostHeader,
+		Connection: connection,
+		Rewrite:    rewrite,
+		Transform:  transform,
+		Schedule:   backendSchedule,
+		MQTT:       bridge,
+		Auth:       auth,
+		RateLimit:  client.NewRateLimit(b.RateLimit.Rate, b.RateLimit.Burst, nil),
+		Access:     access,
+		Webhook:    webhook,
+		Scan:       scan,
+		Latency:    client.NewLatency(b.Latency.Delay, b.Latency.Jitter),
+	}, nil
+}
+
+// nextDefaultURL trả về default URL sau khi thêm backend b. Default URL chỉ
+// dùng cho HTTP services (probe, -local): backend không host và không path
+// thắng, nếu chưa có thì backend HTTP không path đầu tiên.
+func nextDefaultURL(current string, b config.BackendConfig) string {
+	if config.IsBrokerURL(b.URL) || b.Path != "" || (b.Host != "" && current != "") {
+		return current
+	}
+	return b.URL
+}
+
+// redactURL ẩn password trong URL trước khi log
+func redactURL(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Redacted()
+	}
+	return rawURL
+}
+
+// newMQTTBridge tạo bridge cho backend mqtt://[user:pass@]host:port/topic
+// (URL đã được kiểm tra bởi cfg.Validate)
+func newMQTTBridge(b config.BackendConfig) *client.MQTTBridge {
+	u, _ := url.Parse(b.URL)
+	password, _ := u.User.Password()
+	return client.NewMQTTBridge(client.MQTTBridgeOptions{
+		Address:      u.Host,
+		Topic:        strings.TrimPrefix(u.Path, "/"),
+		ClientID:     b.MQTT.ClientID,
+		Username:     u.User.Username(),
+		Password:     password,
+		ReplyTimeout: b.MQTT.ReplyTimeout,
+		MaxBody:      b.MQTT.MaxBody,
+	})
+}
+
+// compileTransform compile transform của một backend, nil nếu không cấu hình
+func compileTransform(t config.TransformConfig) (*client.Transform, error) {
+	if t.Empty() {
+		return nil, nil
+	}
+	return client.CompileTransform(client.TransformSpec{
+		Request:  client.MessageTransformSpec(t.Request),
+		Response: client.MessageTransformSpec(t.Response),
+	})
+}
+
 // fetchRemoteConfig fetches mapping configuration from management API
 func fetchRemoteConfig(apiBase, token string, forwarder *client.LocalForwarder) {
 	logger.Info("Fetching remote configuration...", "api", apiBase)
@@ -599,7 +1504,13 @@ func fetchRemoteConfig(apiBase, token string, forwarder *client.LocalForwarder)
 	}
 }
 
-// parseInt parses string to int
-func parseInt(s string) (int, error) {
-	return strconv.Atoi(s)
+// splitList tách comma-separated list, bỏ qua phần tử rỗng
+func splitList(input string) []string {
+	var items []string
+	for _, item := range strings.Split(input, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
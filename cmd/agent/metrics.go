@@ -0,0 +1,470 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/buildinfo"
+	"github.com/hydragon2m/tunnel-agent/internal/health"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+// agentInfo là thông tin build/runtime của agent, có trong /metrics, /health và status
+type agentInfo struct {
+	Tunnel        string         `json:"tunnel"`
+	Build         buildinfo.Info `json:"build"`
+	UptimeSeconds int64          `json:"uptime_seconds"`
+	ConfigDigest  string         `json:"config_digest"`
+}
+
+// newAgentInfo tạo agentInfo tại thời điểm hiện tại
+func newAgentInfo(digest string) agentInfo {
+	return agentInfo{
+		Tunnel:        *tunnelName,
+		Build:         buildinfo.Get(),
+		UptimeSeconds: int64(buildinfo.Uptime().Seconds()),
+		ConfigDigest:  digest,
+	}
+}
+
+// metricsResponse là body của GET /metrics
+type metricsResponse struct {
+	agentInfo
+	Connections  connectionMetrics   `json:"connections"`
+	Streams      streamMetrics       `json:"streams"`
+	Latency      latencyMetrics      `json:"stream_latency"`
+	Requests     requestMetrics      `json:"requests"`
+	Frames       frameMetrics        `json:"frames"`
+	Traffic      trafficMetrics      `json:"traffic"`
+	Heartbeat    heartbeatMetrics    `json:"heartbeat"`
+	LinkQuality  *linkQualityMetrics `json:"link_quality,omitempty"`
+	LocalService localServiceMetrics `json:"local_service"`
+	Memory       memoryMetrics       `json:"memory"`
+	Runtime      runtimeMetrics      `json:"runtime"`
+	Auth         outcomeMetrics      `json:"auth"`
+	Reloads      outcomeMetrics      `json:"config_reloads"`
+	Secrets      secretMetrics       `json:"secrets"`
+	ErrorFrames  outcomeMetrics      `json:"error_frames"`
+	WarmUp       outcomeMetrics      `json:"warmup_connections"`
+	Timestamps   timestampMetrics    `json:"timestamps"`
+	Health       healthSummary       `json:"health"`
+}
+
+type connectionMetrics struct {
+	Total              int64  `json:"total"`
+	Active             int64  `json:"active"`
+	Reconnections      int64  `json:"reconnections"`
+	ReconnectionErrors int64  `json:"reconnection_errors"`
+	TLSHandshakes      int64  `json:"tls_handshakes"`
+	TLSResumed         int64  `json:"tls_resumed"`
+	LocalAddr          string `json:"local_addr,omitempty"`
+	// IdleSeconds là thời gian từ frame cuối nhận được từ Core; connection bị
+	// drop (IdleTimeouts) khi vượt IdleTimeoutSeconds
+	IdleSeconds        float64 `json:"idle_seconds"`
+	IdleTimeoutSeconds float64 `json:"idle_timeout_seconds"`
+	IdleTimeouts       int64   `json:"idle_timeouts"`
+}
+
+type streamMetrics struct {
+	Total     int64 `json:"total"`
+	Active    int64 `json:"active"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+}
+
+// latencyMetrics là thời gian từ lúc nhận FrameOpenStream tới từng giai đoạn:
+// request đã ghi tới local service, byte response đầu tiên, EndStream đã gửi.
+// local_send chậm = agent chậm, first_byte − local_send = local service,
+// end_stream − first_byte = truyền body qua link.
+type latencyMetrics struct {
+	LocalSend histogramMetrics `json:"local_send"`
+	FirstByte histogramMetrics `json:"first_byte"`
+	EndStream histogramMetrics `json:"end_stream"`
+}
+
+// histogramMetrics là histogram với buckets cộng dồn (le tính bằng giây)
+type histogramMetrics struct {
+	Count      int64            `json:"count"`
+	SumSeconds float64          `json:"sum_seconds"`
+	Buckets    []metrics.Bucket `json:"buckets"`
+}
+
+// idleSeconds là số giây từ last (0 khi chưa nhận frame nào)
+func idleSeconds(last time.Time) float64 {
+	if last.IsZero() {
+		return 0
+	}
+	return time.Since(last).Seconds()
+}
+
+func newHistogramMetrics(h metrics.HistogramSnapshot) histogramMetrics {
+	return histogramMetrics{Count: h.Count, SumSeconds: h.Sum.Seconds(), Buckets: h.Buckets}
+}
+
+type requestMetrics struct {
+	Total      int64 `json:"total"`
+	Success    int64 `json:"success"`
+	Failed     int64 `json:"failed"`
+	Throttled  int64 `json:"throttled"`
+	DurationUS int64 `json:"duration_us"`
+}
+
+type frameMetrics struct {
+	Received           int64 `json:"received"`
+	Sent               int64 `json:"sent"`
+	Errors             int64 `json:"errors"`
+	ProtocolViolations int64 `json:"protocol_violations"`
+	Throttled          int64 `json:"throttled"`
+	InvalidLength      int64 `json:"invalid_length"`
+	// Lỗi của frame handlers theo class của error policy
+	HandlerErrors handlerErrorMetrics `json:"handler_errors"`
+	// Reset frames gửi cho Core theo reset code
+	Resets streamResetMetrics `json:"resets"`
+}
+
+type handlerErrorMetrics struct {
+	Transient  int64 `json:"transient"`
+	Stream     int64 `json:"stream"`
+	Connection int64 `json:"connection"`
+}
+
+type streamResetMetrics struct {
+	ProtocolError  int64 `json:"protocol_error"`
+	StreamExists   int64 `json:"stream_exists"`
+	StreamLimit    int64 `json:"stream_limit"`
+	StreamClosed   int64 `json:"stream_closed"`
+	MemoryPressure int64 `json:"memory_pressure"`
+	InternalError  int64 `json:"internal_error"`
+}
+
+// trafficMetrics là thống kê theo chiều; rates là trung bình mỗi giây trong WindowSeconds
+type trafficMetrics struct {
+	WindowSeconds int              `json:"window_seconds"`
+	Sent          directionMetrics `json:"sent"`
+	Received      directionMetrics `json:"received"`
+}
+
+type directionMetrics struct {
+	Frames          int64   `json:"frames"`
+	Bytes           int64   `json:"bytes"`
+	FramesPerSecond float64 `json:"frames_per_second"`
+	BytesPerSecond  float64 `json:"bytes_per_second"`
+}
+
+type heartbeatMetrics struct {
+	Sent         int64 `json:"sent"`
+	Failed       int64 `json:"failed"`
+	Acked        int64 `json:"acked"`
+	EchoFailures int64 `json:"echo_failures"`
+}
+
+// linkQualityMetrics là điểm chất lượng link tính từ heartbeats gần nhất
+type linkQualityMetrics struct {
+	Score int     `json:"score"`
+	RTTMS float64 `json:"rtt_ms"`
+	Loss  float64 `json:"loss"`
+}
+
+type localServiceMetrics struct {
+	RequestsTotal int64 `json:"requests_total"`
+	RequestsError int64 `json:"requests_error"`
+	DurationUS    int64 `json:"duration_us"`
+	// Connections riêng của upgraded streams (WebSocket), ngoài keep-alive pool
+	PinnedTotal  int64 `json:"pinned_connections_total"`
+	PinnedActive int64 `json:"pinned_connections_active"`
+	// Restarts của local service được chờ trong -restart-grace
+	Restarts    int64 `json:"restarts"`
+	DialRetries int64 `json:"dial_retries"`
+}
+
+type memoryMetrics struct {
+	BufferedBytes int64 `json:"buffered_bytes"`
+	LimitBytes    int64 `json:"limit_bytes"`
+	UnderPressure bool  `json:"under_pressure"`
+	StreamsShed   int64 `json:"streams_shed"`
+}
+
+// runtimeMetrics là kết quả check gần nhất của watchdog
+type runtimeMetrics struct {
+	Goroutines     int64 `json:"goroutines"`
+	LeaksSuspected int64 `json:"leaks_suspected"`
+}
+
+// outcomeMetrics đếm attempts theo kết quả (auth, config reloads)
+type outcomeMetrics struct {
+	Success int64 `json:"success"`
+	Failed  int64 `json:"failed"`
+}
+
+// secretMetrics là các lần fetch lại secrets từ secret managers
+type secretMetrics struct {
+	Refreshes outcomeMetrics `json:"refreshes"`
+	Rotations int64          `json:"rotations"`
+}
+
+type timestampMetrics struct {
+	LastConnection   string `json:"last_connection"`
+	LastRequest      string `json:"last_request"`
+	LastHeartbeat    string `json:"last_heartbeat"`
+	LastHeartbeatAck string `json:"last_heartbeat_ack"`
+}
+
+type healthSummary struct {
+	Status health.HealthStatus `json:"status"`
+}
+
+// healthResponse là body của GET /health
+type healthResponse struct {
+	agentInfo
+	Status health.HealthStatus            `json:"status"`
+	Checks map[string]healthCheckResponse `json:"checks"`
+}
+
+type healthCheckResponse struct {
+	Status        health.HealthStatus `json:"status"`
+	Message       string              `json:"message"`
+	LastCheck     string              `json:"last_check"`
+	Since         string              `json:"since"`
+	LastError     string              `json:"last_error,omitempty"`
+	LastErrorTime string              `json:"last_error_time,omitempty"`
+	History       []healthTransition  `json:"history"`
+}
+
+type healthTransition struct {
+	Status  health.HealthStatus `json:"status"`
+	Message string              `json:"message"`
+	Time    string              `json:"time"`
+}
+
+// newMetricsResponse tạo metricsResponse từ snapshot
+func newMetricsResponse(info agentInfo, snapshot metrics.MetricsSnapshot, status health.HealthStatus) metricsResponse {
+	var linkQuality *linkQualityMetrics
+	if snapshot.LinkQualityKnown {
+		linkQuality = &linkQualityMetrics{
+			Score: snapshot.LinkQuality,
+			RTTMS: float64(snapshot.LinkRTT.Microseconds()) / 1000,
+			Loss:  snapshot.LinkLoss,
+		}
+	}
+	return metricsResponse{
+		agentInfo: info,
+		Connections: connectionMetrics{
+			Total:              snapshot.ConnectionsTotal,
+			Active:             snapshot.ConnectionsActive,
+			Reconnections:      snapshot.ReconnectionsTotal,
+			ReconnectionErrors: snapshot.ReconnectionErrors,
+			TLSHandshakes:      snapshot.TLSHandshakesFull + snapshot.TLSHandshakesResumed,
+			TLSResumed:         snapshot.TLSHandshakesResumed,
+			LocalAddr:          snapshot.LocalAddr,
+			IdleSeconds:        idleSeconds(snapshot.LastFrameReceivedTime),
+			IdleTimeoutSeconds: idleTimeout().Seconds(),
+			IdleTimeouts:       snapshot.IdleTimeouts,
+		},
+		Streams: streamMetrics{
+			Total:     snapshot.StreamsTotal,
+			Active:    snapshot.StreamsActive,
+			Completed: snapshot.StreamsCompleted,
+			Failed:    snapshot.StreamsFailed,
+		},
+		Latency: latencyMetrics{
+			LocalSend: newHistogramMetrics(snapshot.StreamLocalSend),
+			FirstByte: newHistogramMetrics(snapshot.StreamFirstByte),
+			EndStream: newHistogramMetrics(snapshot.StreamEnd),
+		},
+		Requests: requestMetrics{
+			Total:      snapshot.RequestsTotal,
+			Success:    snapshot.RequestsSuccess,
+			Failed:     snapshot.RequestsFailed,
+			Throttled:  snapshot.RequestsThrottled,
+			DurationUS: snapshot.RequestDuration,
+		},
+		Frames: frameMetrics{
+			Received:           snapshot.FramesReceived,
+			Sent:               snapshot.FramesSent,
+			Errors:             snapshot.FramesError,
+			ProtocolViolations: snapshot.ProtocolViolations,
+			Throttled:          snapshot.FramesThrottled,
+			InvalidLength:      snapshot.FramesInvalidLength,
+			HandlerErrors: handlerErrorMetrics{
+				Transient:  snapshot.HandlerErrTransient,
+				Stream:     snapshot.HandlerErrStream,
+				Connection: snapshot.HandlerErrConnection,
+			},
+			Resets: streamResetMetrics{
+				ProtocolError:  snapshot.StreamResetsProtocol,
+				StreamExists:   snapshot.StreamResetsExists,
+				StreamLimit:    snapshot.StreamResetsLimit,
+				StreamClosed:   snapshot.StreamResetsClosed,
+				MemoryPressure: snapshot.StreamResetsMemory,
+				InternalError:  snapshot.StreamResetsInternal,
+			},
+		},
+		Traffic: trafficMetrics{
+			WindowSeconds: int(metrics.RateWindow.Seconds()),
+			Sent: directionMetrics{
+				Frames:          snapshot.FramesSent,
+				Bytes:           snapshot.BytesSent,
+				FramesPerSecond: snapshot.FramesSentRate,
+				BytesPerSecond:  snapshot.BytesSentRate,
+			},
+			Received: directionMetrics{
+				Frames:          snapshot.FramesReceived,
+				Bytes:           snapshot.BytesReceived,
+				FramesPerSecond: snapshot.FramesReceivedRate,
+				BytesPerSecond:  snapshot.BytesReceivedRate,
+			},
+		},
+		Heartbeat: heartbeatMetrics{
+			Sent:         snapshot.HeartbeatsSent,
+			Failed:       snapshot.HeartbeatsFailed,
+			Acked:        snapshot.HeartbeatsAcked,
+			EchoFailures: snapshot.HeartbeatEchoFailures,
+		},
+		LinkQuality: linkQuality,
+		LocalService: localServiceMetrics{
+			RequestsTotal: snapshot.LocalRequestsTotal,
+			RequestsError: snapshot.LocalRequestsError,
+			DurationUS:    snapshot.LocalRequestDuration,
+			PinnedTotal:   snapshot.PinnedConnsTotal,
+			PinnedActive:  snapshot.PinnedConnsActive,
+			Restarts:      snapshot.LocalRestarts,
+			DialRetries:   snapshot.LocalDialRetries,
+		},
+		Memory: memoryMetrics{
+			BufferedBytes: snapshot.MemoryBuffered,
+			LimitBytes:    snapshot.MemoryLimit,
+			UnderPressure: snapshot.MemoryPressure,
+			StreamsShed:   snapshot.StreamsShed,
+		},
+		Runtime: runtimeMetrics{
+			Goroutines:     snapshot.Goroutines,
+			LeaksSuspected: snapshot.LeaksSuspected,
+		},
+		Auth:    outcomeMetrics{Success: snapshot.AuthSuccess, Failed: snapshot.AuthFailures},
+		Reloads: outcomeMetrics{Success: snapshot.ConfigReloads, Failed: snapshot.ConfigReloadFailures},
+		Secrets: secretMetrics{
+			Refreshes: outcomeMetrics{Success: snapshot.SecretRefreshes, Failed: snapshot.SecretRefreshFailures},
+			Rotations: snapshot.SecretRotations,
+		},
+		ErrorFrames: outcomeMetrics{Success: snapshot.ErrorFramesSent, Failed: snapshot.ErrorFramesFailed},
+		WarmUp:      outcomeMetrics{Success: snapshot.WarmConnsSuccess, Failed: snapshot.WarmConnsFailed},
+		Timestamps: timestampMetrics{
+			LastConnection:   snapshot.LastConnectionTime.Format(time.RFC3339),
+			LastRequest:      snapshot.LastRequestTime.Format(time.RFC3339),
+			LastHeartbeat:    snapshot.LastHeartbeatTime.Format(time.RFC3339),
+			LastHeartbeatAck: snapshot.LastHeartbeatAckTime.Format(time.RFC3339),
+		},
+		Health: healthSummary{Status: status},
+	}
+}
+
+// newHealthResponse tạo healthResponse từ tất cả health checks
+func newHealthResponse(info agentInfo, hc *health.HealthChecker) healthResponse {
+	resp := healthResponse{
+		agentInfo: info,
+		Status:    hc.GetOverallStatus(),
+		Checks:    make(map[string]healthCheckResponse),
+	}
+	for name, check := range hc.GetAllChecks() {
+		snap := check.Snapshot()
+		c := healthCheckResponse{
+			Status:    snap.Status,
+			Message:   snap.Message,
+			LastCheck: snap.LastCheck.Format(time.RFC3339),
+			Since:     snap.Since.Format(time.RFC3339),
+			History:   make([]healthTransition, 0, len(snap.History)),
+		}
+		if snap.LastError != "" {
+			c.LastError = snap.LastError
+			c.LastErrorTime = snap.LastErrorTime.Format(time.RFC3339)
+		}
+		for _, t := range snap.History {
+			c.History = append(c.History, healthTransition{
+				Status:  t.Status,
+				Message: t.Message,
+				Time:    t.Time.Format(time.RFC3339),
+			})
+		}
+		resp.Checks[name] = c
+	}
+	return resp
+}
+
+// wantsPrometheus trả về true khi client yêu cầu Prometheus text format:
+// ?format=prometheus hoặc Accept của Prometheus scraper (text/plain;version=0.0.4
+// hoặc OpenMetrics). Mặc định /metrics vẫn trả JSON.
+func wantsPrometheus(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "prometheus"
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/openmetrics-text") || strings.Contains(accept, "version=0.0.4")
+}
+
+// newMetricsMux tạo handlers của metrics server. Mux riêng (không dùng
+// DefaultServeMux) để handlers do packages khác tự đăng ký, như /debug/vars
+// của expvar với cmdline chứa -token, không bị expose ra mọi interface.
+func newMetricsMux(digest string) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		snapshot := metrics.GetMetrics().GetSnapshot()
+		if wantsPrometheus(r) {
+			build := buildinfo.Get()
+			w.Header().Set("Content-Type", metrics.PrometheusContentType)
+			metrics.WritePrometheus(w, snapshot, *tunnelName, build.Version, build.Commit)
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, newMetricsResponse(newAgentInfo(digest), snapshot, health.GetHealthChecker().GetOverallStatus()))
+	})
+
+	// /debug/vars theo format của expvar cho collectors chỉ hiểu expvar, nhưng
+	// chỉ có key "tunnel_agent" (cùng snapshot với /metrics): cmdline chuẩn của
+	// expvar chứa os.Args, tức là cả -token
+	mux.HandleFunc("/debug/vars", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, map[string]any{
+			"tunnel_agent": newMetricsResponse(newAgentInfo(digest), metrics.GetMetrics().GetSnapshot(), health.GetHealthChecker().GetOverallStatus()),
+		})
+	})
+
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, newHealthResponse(newAgentInfo(digest), health.GetHealthChecker()))
+	})
+
+	// Readiness: connected và Core còn ACK heartbeats (không chỉ TCP connected)
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{"connection", "link"} {
+			check, ok := health.GetHealthChecker().GetCheck(name)
+			if !ok {
+				continue
+			}
+			if status, message, _ := check.GetStatus(); status != health.HealthStatusHealthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintf(w, "not ready: %s: %s\n", name, message)
+				return
+			}
+		}
+		fmt.Fprintln(w, "ready")
+	})
+
+	return mux
+}
+
+// startMetricsServer starts HTTP server for metrics
+func startMetricsServer(port int, digest string) {
+	mux := newMetricsMux(digest)
+	addr := fmt.Sprintf(":%d", port)
+	logger.Info("Metrics server listening", "address", addr)
+	for {
+		err := http.ListenAndServe(addr, mux)
+		if !isHandoffChild() {
+			logger.Error("Metrics server error", "error", err)
+			return
+		}
+		// Graceful restart: process cũ vẫn giữ port cho đến khi drain xong
+		time.Sleep(time.Second)
+	}
+}
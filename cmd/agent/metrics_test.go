@@ -0,0 +1,39 @@
+package main
+
+import (
+	_ "expvar" // đăng ký /debug/vars với cmdline vào DefaultServeMux như một dependency có thể làm
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMetricsMux_DoesNotLeakToken(t *testing.T) {
+	const token = "s3cr3t-agent-token"
+	args := os.Args
+	os.Args = append([]string{"agent", "-token", token}, args[1:]...)
+	defer func() { os.Args = args }()
+
+	srv := httptest.NewServer(newMetricsMux("digest"))
+	defer srv.Close()
+
+	for _, path := range []string{"/debug/vars", "/metrics", "/metrics?format=prometheus", "/health"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: status %d", path, resp.StatusCode)
+		}
+		if strings.Contains(string(body), token) {
+			t.Errorf("GET %s leaks the agent token:\n%s", path, body)
+		}
+		if path == "/debug/vars" && (!strings.Contains(string(body), `"tunnel_agent"`) || strings.Contains(string(body), `"cmdline"`)) {
+			t.Errorf("GET /debug/vars should only contain tunnel_agent:\n%s", body)
+		}
+	}
+}
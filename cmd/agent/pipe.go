@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/buildinfo"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// pipeAuthTimeout giới hạn thời gian connect và authenticate trước khi mở stream
+const pipeAuthTimeout = 30 * time.Second
+
+// runPipe thực thi `agent pipe [flags] <target>`: kết nối tới Core với cùng
+// flags/env như agent, mở một stream tới target phía Core và nối nó với
+// stdin/stdout (như `ssh -W`), ví dụ làm ProxyCommand:
+//
+//	ssh -o ProxyCommand='agent pipe -server=core.example.com:8443 db.internal:22' db
+//
+// Logs được ghi ra stderr vì stdout là data của stream.
+func runPipe(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: agent pipe [agent flags] <target>")
+		fmt.Fprintln(os.Stderr, "Bridges stdin/stdout to <target> (host:port reachable from Core) through the tunnel.")
+		return 2
+	}
+	target := args[0]
+	if *token == "" {
+		fmt.Fprintln(os.Stderr, "Token is required. Use -token flag, TUNNEL_AGENT_TOKEN environment variable or `agent login`")
+		return 2
+	}
+
+	// Chỉ warnings trừ khi -log-level được chỉ định, để không lẫn vào output của lệnh gọi
+	level := "warn"
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "log-level" {
+			level = *logLevel
+		}
+	})
+	logger.InitLoggerWithOptions(logger.Options{Level: level, JSON: *logJSON, Sink: logger.SinkStderr, Tunnel: *tunnelName})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	frameDump, err := openFrameDump()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pipe: failed to open frame dump file: %v\n", err)
+		return 1
+	}
+	connector, streamManager, authenticated := startPipeConnection(ctx, frameDump)
+	defer connector.Close()
+
+	if err := connector.Connect(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "pipe: failed to connect to %s: %v\n", *serverAddr, err)
+		return 1
+	}
+
+	select {
+	case err := <-authenticated:
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pipe: authentication failed: %v\n", err)
+			return 1
+		}
+	case <-time.After(pipeAuthTimeout):
+		fmt.Fprintf(os.Stderr, "pipe: no authentication response from %s within %s\n", *serverAddr, pipeAuthTimeout)
+		return 1
+	case <-ctx.Done():
+		return 1
+	}
+
+	if err := client.Pipe(ctx, streamManager, target, os.Stdin, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "pipe: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// startPipeConnection tạo connector chỉ phục vụ stream của pipe: Core không
+// mở được stream tới agent ở mode này. authenticated nhận kết quả auth đầu tiên.
+func startPipeConnection(ctx context.Context, frameDump *client.FrameDumper) (*client.Connector, *client.StreamManager, <-chan error) {
+	var tlsConfig *tls.Config
+	if *useTLS {
+		tlsConfig = &tls.Config{InsecureSkipVerify: *skipVerify}
+	}
+	authenticator := client.NewAuthenticator(*token, *agentID, buildinfo.Get().Version, nil, map[string]string{"mode": "pipe"})
+	authenticated := make(chan error, 1)
+
+	var (
+		connector     *client.Connector
+		dispatcher    *client.Dispatcher
+		streamManager *client.StreamManager
+	)
+	connector = client.NewConnector(*serverAddr, client.ConnectorOptions{
+		TLSConfig:     tlsConfig,
+		BindAddress:   *bindAddr,
+		RetryInterval: 1 * time.Second,
+		FrameDump:     frameDump,
+		OnConnected: func(conn net.Conn) {
+			dispatcher.SetConnection(conn)
+			if err := dispatcher.Start(ctx); err != nil {
+				logger.Error("Failed to start dispatcher", "error", err)
+				return
+			}
+			authFrame, err := authenticator.CreateAuthFrame()
+			if err == nil {
+				err = connector.SendFrame(ctx, authFrame)
+			}
+			if err != nil {
+				logger.Error("Failed to send auth frame", "error", err)
+			}
+		},
+		OnDisconnected: func() {
+			dispatcher.Stop()
+		},
+	})
+	streamManager = client.NewStreamManager(connector, client.StreamManagerOptions{})
+
+	// Pipe không gửi heartbeat nên không có idle timeout: pipe rảnh vẫn là pipe sống
+	dispatcher = client.NewDispatcher(client.DispatcherOptions{
+		FrameDump:    frameDump,
+		RequireAuth:  true,
+		MaxFrameRate: *maxFrameRate,
+		FrameBurst:   *frameBurst,
+		ControlHandler: func(frame *v1.Frame) error {
+			switch frame.Type {
+			case v1.FrameAuth:
+				err := authenticator.HandleAuthResponse(frame)
+				if err == nil {
+					dispatcher.MarkAuthenticated()
+				}
+				select {
+				case authenticated <- err:
+				default:
+				}
+				return err
+			case v1.FrameClose:
+				logger.Warn("Server requested connection close")
+				connector.Disconnect()
+			}
+			return nil
+		},
+		StreamHandler: func(frame *v1.Frame) error {
+			stream, ok := streamManager.GetStream(frame.StreamID)
+			if !ok {
+				rejectStreamFrame(ctx, connector, frame, client.ErrStreamNotFound, false)
+				return nil
+			}
+			switch frame.Type {
+			case v1.FrameData:
+				if len(frame.Payload) > 0 {
+					if err := stream.Deliver(frame.Payload); err != nil {
+						streamManager.CloseStream(frame.StreamID)
+						return nil
+					}
+				}
+				if frame.IsEndStream() {
+					streamManager.CloseStream(frame.StreamID)
+				}
+			case v1.FrameClose:
+				streamManager.CloseStream(frame.StreamID)
+			}
+			return nil
+		},
+		OnConnectionClosed: func() {
+			logger.Warn("Connection to Core closed")
+			// Stream của pipe không sống qua reconnect
+			for _, info := range streamManager.Snapshot() {
+				streamManager.CloseStream(info.ID)
+			}
+		},
+	})
+
+	return connector, streamManager, authenticated
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/config"
+	"github.com/hydragon2m/tunnel-agent/internal/health"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/quota"
+)
+
+// quotaSaveInterval là chu kỳ lưu usage và cập nhật health check của quota
+const quotaSaveInterval = 30 * time.Second
+
+// quotaPath trả về state file của quota
+func quotaPath(c config.QuotaConfig) string {
+	if c.File != "" {
+		return c.File
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "tunnel-agent", *tunnelName+".quota")
+}
+
+// openQuota mở quota của tunnel từ config, nil nếu không có cap nào
+func openQuota(c config.QuotaConfig) (*quota.Quota, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+	loc := time.UTC
+	if c.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(c.Timezone); err != nil {
+			return nil, err
+		}
+	}
+	q, err := quota.Open(quota.Options{
+		Path:        quotaPath(c),
+		MaxRequests: c.Requests,
+		MaxBytes:    c.Bytes,
+		Location:    loc,
+	})
+	if err != nil {
+		return nil, err
+	}
+	usage := q.Usage()
+	logger.Info("Quota enabled", "period", usage.Period, "requests", usage.Requests, "max_requests", c.Requests, "bytes", usage.Bytes, "max_bytes", c.Bytes, "state_file", quotaPath(c))
+	return q, nil
+}
+
+// scheduleQuota thêm job lưu usage định kỳ; health check degraded khi quota
+// đã hết, healthy lại khi sang tháng mới
+func scheduleQuota(q *quota.Quota, check *health.Check) {
+	exceeded := false
+	update := func() {
+		saveQuota(q)
+		reason, resetAt := q.Exceeded()
+		switch {
+		case reason != "" && !exceeded:
+			logger.Warn("Quota exceeded, rejecting requests", "reason", reason, "resets_at", resetAt)
+			check.UpdateCheck(health.HealthStatusDegraded, fmt.Sprintf("Quota exceeded: %s, resets at %s", reason, resetAt.Format(time.RFC3339)))
+		case reason == "" && exceeded:
+			logger.Info("Quota period reset, accepting requests")
+			check.UpdateCheck(health.HealthStatusHealthy, "Usage within quota")
+		}
+		exceeded = reason != ""
+	}
+	check.UpdateCheck(health.HealthStatusHealthy, "Usage within quota")
+	update()
+	scheduleJob(jobQuota, quotaSaveInterval, 0, func(context.Context) { update() })
+}
+
+// saveQuota ghi usage vào state file
+func saveQuota(q *quota.Quota) {
+	if err := q.Save(); err != nil {
+		logger.Warn("Failed to save quota usage", "error", err)
+	}
+}
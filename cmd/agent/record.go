@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// openRecorder mở file record từ flags, nil nếu cả -record và -inspect không
+// được đặt. NDJSON được nối vào file có sẵn; HAR là một JSON document nên file
+// bị ghi đè. Chỉ với -inspect, exchanges chỉ được giữ trong memory.
+func openRecorder() (*client.Recorder, error) {
+	if *recordPath == "" {
+		if *inspectKeep == 0 {
+			return nil, nil
+		}
+		return client.NewRecorder(nil, recorderOptions(""))
+	}
+	format := *recordFormat
+	if format == "" {
+		format = client.RecordNDJSON
+		if strings.EqualFold(filepath.Ext(*recordPath), ".har") {
+			format = client.RecordHAR
+		}
+	}
+	mode := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if format == client.RecordHAR {
+		mode = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+	f, err := os.OpenFile(*recordPath, mode, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	recorder, err := client.NewRecorder(f, recorderOptions(format))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if *recordDryRun {
+		logger.Warn("Record dry-run enabled, requests are answered with 202 and not forwarded", "file", *recordPath, "format", format)
+	} else {
+		logger.Info("Recording traffic", "file", *recordPath, "format", format)
+	}
+	return recorder, nil
+}
+
+// recorderOptions trả về options của Recorder từ flags
+func recorderOptions(format string) client.RecorderOptions {
+	var redact []string
+	if *recordRedact != "" {
+		redact = strings.Split(*recordRedact, ",")
+	}
+	return client.RecorderOptions{
+		Format:        format,
+		MaxBody:       *recordMaxBody,
+		RedactHeaders: redact,
+		DryRun:        *recordDryRun,
+		Keep:          *inspectKeep,
+	}
+}
+
+// closeRecorder kết thúc file record, báo lỗi ghi nếu recording đã dừng giữa chừng
+func closeRecorder(recorder *client.Recorder) {
+	if err := recorder.Err(); err != nil {
+		logger.Warn("Recording stopped after a write error", "file", *recordPath, "error", err)
+	}
+	if err := recorder.Close(); err != nil {
+		logger.Warn("Failed to close record file", "file", *recordPath, "error", err)
+	}
+}
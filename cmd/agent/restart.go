@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// handoffEnv chứa fd của pipe mà process mới dùng để báo ready cho process cũ
+const handoffEnv = "TUNNEL_AGENT_HANDOFF_FD"
+
+// handoffReadyTimeout là thời gian tối đa chờ process mới authenticate
+const handoffReadyTimeout = 60 * time.Second
+
+var (
+	// draining = true khi process đã bàn giao cho process mới:
+	// không nhận stream mới, chỉ chờ streams hiện tại kết thúc
+	draining atomic.Bool
+
+	// handoffMu đảm bảo chỉ một restart chạy tại một thời điểm
+	handoffMu sync.Mutex
+
+	handoffReadyOnce sync.Once
+)
+
+// isHandoffChild trả về true nếu process được start bởi graceful restart
+func isHandoffChild() bool {
+	return os.Getenv(handoffEnv) != ""
+}
+
+// notifyHandoffReady báo process cũ rằng process mới đã authenticate xong
+// và có thể nhận streams. Gọi nhiều lần là an toàn.
+func notifyHandoffReady() {
+	handoffReadyOnce.Do(func() {
+		// systemd (Type=notify, NotifyAccess=all): process này là main PID mới
+		sdNotify(fmt.Sprintf("READY=1\nMAINPID=%d", os.Getpid()))
+
+		if !isHandoffChild() {
+			return
+		}
+		fd, err := strconv.Atoi(os.Getenv(handoffEnv))
+		if err != nil {
+			logger.Warn("Invalid handoff fd", "value", os.Getenv(handoffEnv))
+			return
+		}
+		f := os.NewFile(uintptr(fd), "handoff")
+		defer f.Close()
+		if _, err := f.Write([]byte("ready\n")); err != nil {
+			logger.Warn("Failed to notify previous process", "error", err)
+			return
+		}
+		logger.Info("Handoff complete, previous process is draining")
+	})
+}
+
+// sdNotify gửi state tới systemd nếu agent chạy dưới service Type=notify
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		logger.Debug("Failed to connect to systemd notify socket", "error", err)
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(state))
+}
+
+// startReplacement start binary hiện tại (có thể đã được thay bằng version mới)
+// với cùng arguments và chờ nó authenticate với Core
+func startReplacement() error {
+	if !handoffMu.TryLock() {
+		return fmt.Errorf("restart already in progress")
+	}
+	defer handoffMu.Unlock()
+
+	if draining.Load() {
+		return fmt.Errorf("agent is already draining")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to resolve executable: %w", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// ExtraFiles[0] là fd 3 trong process mới
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.Env = append(os.Environ(), handoffEnv+"=3")
+
+	logger.Info("Starting replacement process", "executable", exe)
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to start replacement: %w", err)
+	}
+	w.Close()
+
+	ready := make(chan error, 1)
+	go func() {
+		line, err := bufio.NewReader(r).ReadString('\n')
+		if err != nil {
+			// Pipe đóng mà không có "ready" → process mới đã exit
+			ready <- fmt.Errorf("replacement exited before becoming ready")
+			return
+		}
+		if line != "ready\n" {
+			ready <- fmt.Errorf("unexpected handoff message %q", line)
+			return
+		}
+		ready <- nil
+	}()
+
+	select {
+	case err = <-ready:
+	case <-time.After(handoffReadyTimeout):
+		err = fmt.Errorf("replacement not ready after %s", handoffReadyTimeout)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	// Process mới tự chạy tiếp, không chờ nó exit
+	cmd.Process.Release()
+	draining.Store(true)
+	logger.Info("Replacement process ready, draining", "pid", cmd.Process.Pid)
+	return nil
+}
+
+// watchRestartSignal trigger graceful restart khi nhận SIGHUP (Unix only).
+// Khi process mới ready, restartCh nhận reason code để main bắt đầu drain.
+func watchRestartSignal(restartCh chan<- string) {
+	signals := restartSignals()
+	if len(signals) == 0 {
+		return
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		for range ch {
+			triggerRestart(restartCh, client.ShutdownRestart)
+		}
+	}()
+}
+
+// triggerRestart start process mới và báo main drain (với reason là shutdown
+// reason code gửi cho Core) nếu thành công
+func triggerRestart(restartCh chan<- string, reason string) error {
+	if err := startReplacement(); err != nil {
+		logger.Error("Graceful restart failed, continuing with current process", "error", err)
+		return err
+	}
+	select {
+	case restartCh <- reason:
+	default:
+	}
+	return nil
+}
+
+// drainStreams chờ active streams kết thúc hoặc hết timeout
+func drainStreams(streamManager *client.StreamManager, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		active := len(streamManager.Snapshot())
+		if active == 0 {
+			logger.Info("All streams drained")
+			return
+		}
+		if time.Now().After(deadline) {
+			logger.Warn("Drain timeout, closing remaining streams", "active", active)
+			return
+		}
+		<-ticker.C
+	}
+}
+
+// startAdminServer start admin API. Trong handoff, port vẫn đang được
+// process cũ giữ cho đến khi nó drain, nên retry ở background.
+func startAdminServer(server *admin.Server) error {
+	if !isHandoffChild() {
+		return server.Start()
+	}
+	if err := server.Start(); err == nil {
+		return nil
+	}
+	go func() {
+		for {
+			time.Sleep(time.Second)
+			if err := server.Start(); err == nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// registerRestartHandler đăng ký POST /restart vào admin API. Restart spawn
+// process mới và drain agent nên cần admin token như file transfer.
+func registerRestartHandler(server *admin.Server, restartCh chan<- string, token string) {
+	server.Handle("/restart", admin.RequireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			admin.WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		if err := triggerRestart(restartCh, client.ShutdownRestart); err != nil {
+			admin.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, map[string]string{"status": "draining"})
+	}))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+// routeStats là thống kê của một route trong metrics.RouteWindow gần nhất
+type routeStats struct {
+	Route     string        `json:"route"`
+	Requests  int64         `json:"requests"`
+	Errors    int64         `json:"errors"`
+	ErrorRate float64       `json:"error_rate"`
+	BytesIn   int64         `json:"bytes_in"`
+	BytesOut  int64         `json:"bytes_out"`
+	P95Ms     float64       `json:"p95_ms"`
+	Statuses  []statusCount `json:"top_status,omitempty"`
+}
+
+// statusCount là số responses của một status code
+type statusCount struct {
+	Status int   `json:"status"`
+	Count  int64 `json:"count"`
+}
+
+// routeStatsResponse là body của GET /routes/stats
+type routeStatsResponse struct {
+	WindowSeconds int          `json:"window_seconds"`
+	Routes        []routeStats `json:"routes"`
+}
+
+// currentRouteStats lấy thống kê theo route, route nhiều requests nhất trước
+func currentRouteStats() []routeStats {
+	var routes []routeStats
+	for _, snap := range metrics.GetMetrics().Routes.Snapshot() {
+		route := routeStats{
+			Route:     snap.Route,
+			Requests:  snap.Requests,
+			Errors:    snap.Failed,
+			ErrorRate: snap.ErrorRate,
+			BytesIn:   snap.BytesIn,
+			BytesOut:  snap.BytesOut,
+			P95Ms:     float64(snap.P95.Microseconds()) / 1000,
+		}
+		for _, s := range snap.Statuses {
+			route.Statuses = append(route.Statuses, statusCount{Status: s.Status, Count: s.Count})
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// registerRouteStatsHandler đăng ký GET /routes/stats vào admin API
+func registerRouteStatsHandler(server *admin.Server) {
+	server.Handle("/routes/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			admin.WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		routes := currentRouteStats()
+		if routes == nil {
+			routes = []routeStats{}
+		}
+		admin.WriteJSON(w, http.StatusOK, routeStatsResponse{
+			WindowSeconds: int(metrics.RouteWindow.Seconds()),
+			Routes:        routes,
+		})
+	})
+}
+
+// printRouteStats in bảng thống kê theo route cho `agent status`
+func printRouteStats(w io.Writer, routes []routeStats) {
+	if len(routes) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nRoutes (last %s):\n", metrics.RouteWindow)
+	fmt.Fprintf(w, "  %-30s %8s %7s %9s %9s %9s  %s\n", "ROUTE", "REQUESTS", "ERRORS", "P95", "IN", "OUT", "STATUS")
+	for _, route := range routes {
+		statuses := ""
+		for i, s := range route.Statuses {
+			if i > 0 {
+				statuses += " "
+			}
+			statuses += fmt.Sprintf("%d:%d", s.Status, s.Count)
+		}
+		fmt.Fprintf(w, "  %-30s %8d %6.1f%% %7.1fms %9s %9s  %s\n",
+			route.Route, route.Requests, route.ErrorRate*100, route.P95Ms,
+			formatBytes(route.BytesIn), formatBytes(route.BytesOut), statuses)
+	}
+}
+
+// formatBytes in số bytes dạng ngắn gọn (KiB, MiB, ...)
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/config"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+// maxRouteTableBytes giới hạn body của PUT /routes
+const maxRouteTableBytes = 1 << 20
+
+// routeImportResponse là body trả về của PUT /routes
+type routeImportResponse struct {
+	Applied  bool `json:"applied"`
+	Backends int  `json:"backends"`
+	// ReconnectRequired báo subdomain labels đã đổi: Core chỉ nhận danh sách
+	// subdomains khi auth nên thay đổi có hiệu lực ở lần reconnect tiếp theo
+	ReconnectRequired bool `json:"reconnect_required"`
+}
+
+// routeTable giữ bảng routing dạng config của forwarder để export/import
+// qua admin API
+type routeTable struct {
+	mu        sync.Mutex
+	forwarder *client.LocalForwarder
+	current   config.RouteTable
+}
+
+// newRouteTable tạo routeTable từ services của -local/remote config (chỉ host
+// và URL) cộng với backends của config file và default URL hiện tại của forwarder
+func newRouteTable(forwarder *client.LocalForwarder, services []client.Backend, backends []config.BackendConfig) *routeTable {
+	rt := &routeTable{forwarder: forwarder}
+	rt.current.Default = forwarder.GetDefaultURL()
+	for _, s := range services {
+		rt.current.Backends = append(rt.current.Backends, config.BackendConfig{Host: s.Host, Path: s.Path, URL: s.URL})
+	}
+	rt.current.Backends = append(rt.current.Backends, backends...)
+	return rt
+}
+
+// export encode bảng routing hiện tại theo format
+func (rt *routeTable) export(format string) ([]byte, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.current.Marshal(format)
+}
+
+// replace kiểm tra table rồi thay bảng routing của forwarder trong một bước;
+// table lỗi không thay đổi gì. dryRun chỉ kiểm tra.
+func (rt *routeTable) replace(table *config.RouteTable, dryRun bool) (routeImportResponse, error) {
+	resp := routeImportResponse{Backends: len(table.Backends)}
+	if err := table.Validate(); err != nil {
+		return resp, err
+	}
+
+	backends := make([]client.Backend, 0, len(table.Backends))
+	for i, b := range table.Backends {
+		backend, err := configBackend(b)
+		if err != nil {
+			closeBridges(backends)
+			return resp, fmt.Errorf("backends[%d].%w", i, err)
+		}
+		backends = append(backends, backend)
+	}
+	if dryRun {
+		closeBridges(backends)
+		return resp, nil
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	// Default URL không suy ra từ thứ tự backends: bảng không có default
+	// giữ nguyên default hiện tại
+	applied := *table
+	if applied.Default == "" {
+		applied.Default = rt.current.Default
+	}
+	defaultURL := applied.Default
+	oldSubs := rt.forwarder.GetSubdomains()
+	old := rt.forwarder.Backends()
+	rt.forwarder.ReplaceBackends(backends, defaultURL)
+	rt.current = applied
+	closeBridges(old)
+
+	newSubs := rt.forwarder.GetSubdomains()
+	slices.Sort(oldSubs)
+	slices.Sort(newSubs)
+	resp.Applied = true
+	resp.ReconnectRequired = !slices.Equal(oldSubs, newSubs)
+	logger.Info("Route table imported", "backends", len(backends), "default", redactURL(defaultURL), "reconnect_required", resp.ReconnectRequired)
+	return resp, nil
+}
+
+// reload build lại backends của bảng routing hiện tại, ví dụ khi credentials
+// của backends được rotate
+func (rt *routeTable) reload() error {
+	rt.mu.Lock()
+	table := rt.current
+	rt.mu.Unlock()
+	_, err := rt.replace(&table, false)
+	return err
+}
+
+// closeBridges đóng MQTT bridges của backends không còn được dùng
+func closeBridges(backends []client.Backend) {
+	for _, b := range backends {
+		if b.MQTT != nil {
+			b.MQTT.Close()
+		}
+	}
+}
+
+// recordReload đếm lần import bảng routing vào metrics config reloads; dry run
+// không thay đổi gì nên không được tính
+func recordReload(dryRun, success bool) {
+	if !dryRun {
+		metrics.GetMetrics().RecordConfigReload(success)
+	}
+}
+
+// registerRoutesHandler đăng ký /routes vào admin API:
+// GET export bảng routing (?format=json|yaml), PUT import bảng mới (?dry_run=true chỉ kiểm tra)
+func registerRoutesHandler(server *admin.Server, rt *routeTable) {
+	server.Handle("/routes", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			format := r.URL.Query().Get("format")
+			if format == "" {
+				format = config.FormatJSON
+			}
+			data, err := rt.export(format)
+			if err != nil {
+				admin.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/"+format)
+			w.Write(data)
+
+		case http.MethodPut:
+			dryRun := r.URL.Query().Get("dry_run") == "true"
+			data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRouteTableBytes))
+			if err != nil {
+				recordReload(dryRun, false)
+				admin.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("route table too large: %w", err))
+				return
+			}
+			table, err := config.ParseRouteTable(data)
+			if err != nil {
+				recordReload(dryRun, false)
+				admin.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			resp, err := rt.replace(table, dryRun)
+			recordReload(dryRun, err == nil)
+			if err != nil {
+				admin.WriteError(w, http.StatusUnprocessableEntity, fmt.Errorf("invalid route table:\n%w", err))
+				return
+			}
+			admin.WriteJSON(w, http.StatusOK, resp)
+
+		default:
+			admin.WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		}
+	})
+}
+
+// runRoutes thực thi lệnh `agent routes` trên agent đang chạy:
+//
+//	agent routes export [-format yaml] > routes.yaml
+//	agent routes import [-dry-run] routes.yaml   (- = stdin)
+func runRoutes(args []string) int {
+	fs := flag.NewFlagSet("routes", flag.ExitOnError)
+	addr := fs.String("admin-addr", admin.DefaultAddr, "Admin API address of the running agent")
+	timeout := fs.Duration("timeout", 10*time.Second, "Request timeout")
+	format := fs.String("format", config.FormatYAML, "Export format: yaml or json")
+	dryRun := fs.Bool("dry-run", false, "Validate the imported table without applying it")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: agent routes export [flags]")
+		fmt.Fprintln(fs.Output(), "       agent routes import [flags] <file|->")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	cmd := args[0]
+	fs.Parse(args[1:])
+	c := admin.NewClient(*addr, *timeout)
+
+	switch {
+	case cmd == "export" && fs.NArg() == 0:
+		data, err := c.Send(http.MethodGet, "/routes?format="+*format, "", nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not export routes: %v\n", err)
+			return 1
+		}
+		os.Stdout.Write(data)
+		return 0
+
+	case cmd == "import" && fs.NArg() == 1:
+		var (
+			data []byte
+			err  error
+		)
+		if fs.Arg(0) == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(fs.Arg(0))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not read route table: %v\n", err)
+			return 1
+		}
+
+		path := "/routes"
+		if *dryRun {
+			path += "?dry_run=true"
+		}
+		var resp routeImportResponse
+		out, err := c.Send(http.MethodPut, path, "application/yaml", data)
+		if err == nil {
+			err = json.Unmarshal(out, &resp)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not import routes: %v\n", err)
+			return 1
+		}
+
+		switch {
+		case !resp.Applied:
+			fmt.Printf("Route table is valid (%d backends), not applied\n", resp.Backends)
+		case resp.ReconnectRequired:
+			fmt.Printf("Route table applied (%d backends); subdomain changes take effect after the next reconnect\n", resp.Backends)
+		default:
+			fmt.Printf("Route table applied (%d backends)\n", resp.Backends)
+		}
+		return 0
+
+	default:
+		fs.Usage()
+		return 2
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/health"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/schedule"
+)
+
+// scheduleCheckInterval là chu kỳ kiểm tra khung giờ của tunnel
+const scheduleCheckInterval = 30 * time.Second
+
+// scheduleClosed = true khi tunnel bị đóng vì ngoài khung giờ hoạt động:
+// connection đóng lúc này không trigger reconnect
+var scheduleClosed atomic.Bool
+
+// scheduleTunnelHours thêm job đóng tunnel khi ra khỏi khung giờ hoạt động
+// (sau khi drain streams) và kết nối lại khi khung giờ tiếp theo bắt đầu
+func scheduleTunnelHours(ctx context.Context, s *schedule.Schedule, connector *client.Connector, streamManager *client.StreamManager, connectionCheck *health.Check) {
+	scheduleJob(jobTunnelSchedule, scheduleCheckInterval, 0, func(context.Context) {
+		now := time.Now()
+		active := s.Active(now)
+		switch {
+		case !active && scheduleClosed.CompareAndSwap(false, true):
+			logger.Info("Outside scheduled hours, closing tunnel", "reopens_at", s.Next(now))
+			drainStreams(streamManager, *drainTimeout)
+			connector.Disconnect()
+			connectionCheck.UpdateCheck(health.HealthStatusDegraded, "Closed outside scheduled hours")
+		case active && scheduleClosed.CompareAndSwap(true, false):
+			logger.Info("Scheduled hours started, opening tunnel")
+			// Connection sống theo root context, không theo lần chạy của job
+			go func() {
+				if err := connector.Connect(ctx); err != nil {
+					logger.Error("Failed to connect at scheduled hours", "error", err)
+				}
+			}()
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/config"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+	"github.com/hydragon2m/tunnel-agent/internal/secrets"
+)
+
+// defaultSecretRefresh là chu kỳ fetch lại secrets khi secrets.refresh không đặt
+const defaultSecretRefresh = 5 * time.Minute
+
+var (
+	// secretStore phục vụ vault:, aws-sm: và gcp-sm: secret references; nil
+	// tới khi initSecrets được gọi với config file
+	secretStore *secrets.Store
+	// tokenSecretRef là secret reference của agent token khi token lấy từ
+	// `token` của config file
+	tokenSecretRef string
+)
+
+// initSecrets tạo secretStore với các secret managers được cấu hình. GCP luôn
+// có (metadata server của instance); Vault cần address, AWS cần region.
+func initSecrets(cfg config.SecretsConfig) {
+	httpClient := &http.Client{Timeout: secrets.DefaultTimeout}
+	providers := map[string]secrets.SecretProvider{
+		secrets.SourceGCP: &secrets.GCP{Project: cfg.GCP.Project, Client: httpClient},
+	}
+
+	if cfg.Vault.Address != "" {
+		tokenRef := cfg.Vault.Token
+		if tokenRef == "" {
+			tokenRef = "env:VAULT_TOKEN"
+		}
+		providers[secrets.SourceVault] = &secrets.Vault{
+			Address:   cfg.Vault.Address,
+			Namespace: cfg.Vault.Namespace,
+			Mount:     cfg.Vault.Mount,
+			Token:     func() (string, error) { return resolveVaultToken(tokenRef) },
+			Client:    httpClient,
+		}
+	}
+
+	region := cfg.AWS.Region
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region == "" {
+			region = os.Getenv(name)
+		}
+	}
+	if region != "" {
+		providers[secrets.SourceAWS] = &secrets.AWS{Region: region, Endpoint: cfg.AWS.Endpoint, Client: httpClient}
+	}
+	secretStore = secrets.NewStore(providers)
+}
+
+// resolveVaultToken đọc Vault token từ keyring, env hoặc file. Reference tới
+// secret manager bị từ chối kể cả khi config chưa được validate: vault: sẽ
+// gọi lại chính Vault provider (đệ quy không dừng).
+func resolveVaultToken(ref string) (string, error) {
+	source, _, err := config.ParseSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+	switch source {
+	case secrets.SourceVault, secrets.SourceAWS, secrets.SourceGCP:
+		return "", fmt.Errorf("secrets.vault.token must be a keyring:, env: or file: reference, got %s:", source)
+	}
+	return resolveSecret(ref)
+}
+
+// fetchSecret đọc secret từ secret manager của source
+func fetchSecret(source, name string) (string, error) {
+	if secretStore == nil {
+		initSecrets(config.SecretsConfig{})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secrets.DefaultTimeout)
+	defer cancel()
+	return secretStore.Get(ctx, source, name)
+}
+
+// scheduleSecretRefresh fetch lại secrets của secret managers mỗi
+// secrets.refresh. Token mới được dùng từ lần auth tiếp theo (connection đang
+// chạy giữ nguyên); credentials mới của backends được áp dụng bằng cách build
+// lại bảng routing. Fetch lỗi giữ giá trị cũ.
+func scheduleSecretRefresh(interval time.Duration, authenticator *client.Authenticator, routes *routeTable) {
+	if interval == 0 {
+		interval = defaultSecretRefresh
+	}
+	if interval < 0 || secretStore == nil {
+		return
+	}
+
+	scheduleJob(jobSecretRefresh, interval, 0.1, func(ctx context.Context) {
+		changed, err := secretStore.Refresh(ctx)
+		metrics.GetMetrics().RecordSecretRefresh(err == nil, len(changed))
+		if err != nil {
+			logger.Warn("Failed to refresh secrets, keeping the previous values", "error", err)
+		}
+
+		backendsChanged := false
+		for _, ref := range changed {
+			if ref != tokenSecretRef {
+				backendsChanged = true
+				continue
+			}
+			token, _ := secretStore.Value(ref)
+			if err := logger.AddRedactPatterns([]string{regexp.QuoteMeta(token)}); err != nil {
+				logger.Error("Failed to configure token redaction", "error", err)
+			}
+			authenticator.SetToken(token)
+			logger.Info("Agent token rotated, used from the next authentication", "ref", ref)
+		}
+		if !backendsChanged {
+			return
+		}
+		if err := routes.reload(); err != nil {
+			logger.Error("Failed to apply rotated backend credentials", "error", err)
+			return
+		}
+		logger.Info("Backend credentials rotated", "secrets", len(changed))
+	})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// sendShutdown đóng connection theo thứ tự: flush frames đang chờ (tối đa
+// -flush-timeout) rồi gửi control FrameClose kèm lý do shutdown cho Core,
+// để FrameClose không đến trước response frames của streams vừa xong
+func sendShutdown(connector *client.Connector, code, message string) {
+	frame, err := client.NewShutdownFrame(code, message)
+	if err != nil {
+		logger.Warn("Failed to send close frame", "error", err)
+		connector.Close()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *flushTimeout)
+	defer cancel()
+	if err := connector.Shutdown(ctx, frame); err != nil {
+		logger.Warn("Failed to send close frame", "error", err)
+		return
+	}
+	logger.Info("Sent shutdown reason to Core", "code", code, "message", message)
+}
+
+// fatalShutdown báo Core agent dừng vì lỗi rồi thoát như log.Fatalf
+func fatalShutdown(connector *client.Connector, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if connector.IsConnected() {
+		sendShutdown(connector, client.ShutdownFatal, message)
+	}
+	log.Fatal(message)
+}
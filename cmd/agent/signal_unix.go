@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// diagSignals trả về signals kích hoạt diagnostics bundle
+func diagSignals() []os.Signal {
+	return []os.Signal{syscall.SIGUSR2}
+}
+
+// logLevelSignals trả về signals bật/tắt debug logging
+func logLevelSignals() []os.Signal {
+	return []os.Signal{syscall.SIGUSR1}
+}
+
+// restartSignals trả về signals kích hoạt graceful restart
+func restartSignals() []os.Signal {
+	return []os.Signal{syscall.SIGHUP}
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// diagSignals: Windows không có SIGUSR2, dùng admin API POST /diagnostics
+func diagSignals() []os.Signal {
+	return nil
+}
+
+// logLevelSignals: Windows không có SIGUSR1, dùng admin API PUT /log-level
+func logLevelSignals() []os.Signal {
+	return nil
+}
+
+// restartSignals: Windows không có SIGHUP, dùng admin API POST /restart
+func restartSignals() []os.Signal {
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/health"
+)
+
+// statusResponse là body của GET /status trên admin API
+type statusResponse struct {
+	agentInfo
+	Status health.HealthStatus    `json:"status"`
+	Checks []health.CheckSnapshot `json:"checks"`
+	Routes []routeStats           `json:"routes,omitempty"`
+}
+
+// healthStatus tạo snapshot của tất cả health checks, sắp xếp theo tên, kèm
+// thống kê theo route
+func healthStatus(digest string) statusResponse {
+	hc := health.GetHealthChecker()
+	resp := statusResponse{agentInfo: newAgentInfo(digest), Status: hc.GetOverallStatus(), Routes: currentRouteStats()}
+	for _, check := range hc.GetAllChecks() {
+		resp.Checks = append(resp.Checks, check.Snapshot())
+	}
+	sort.Slice(resp.Checks, func(i, j int) bool { return resp.Checks[i].Name < resp.Checks[j].Name })
+	return resp
+}
+
+// registerStatusHandler đăng ký GET /status vào admin API
+func registerStatusHandler(server *admin.Server, digest string) {
+	server.Handle("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			admin.WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, healthStatus(digest))
+	})
+}
+
+// runStatus thực thi lệnh `agent status`: in health checks của agent đang chạy
+// kèm lịch sử chuyển trạng thái gần đây và traffic theo route. Exit code 0 khi healthy, 1 khi không.
+//
+//	agent status
+//	agent status -json
+func runStatus(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	addr := fs.String("admin-addr", admin.DefaultAddr, "Admin API address of the running agent")
+	timeout := fs.Duration("timeout", 5*time.Second, "Request timeout")
+	asJSON := fs.Bool("json", false, "Print raw JSON")
+	fs.Parse(args)
+
+	var resp statusResponse
+	c := admin.NewClient(*addr, *timeout)
+	if err := c.Do(http.MethodGet, "/status", nil, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "could not query agent status: %v\n", err)
+		return 2
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(resp)
+	} else {
+		printStatus(os.Stdout, resp, time.Now())
+	}
+
+	if resp.Status != health.HealthStatusHealthy {
+		return 1
+	}
+	return 0
+}
+
+// printStatus in status dạng human-readable
+func printStatus(w io.Writer, resp statusResponse, now time.Time) {
+	fmt.Fprintf(w, "Tunnel: %s\n", resp.Tunnel)
+	fmt.Fprintf(w, "Agent:  %s, up %s, config %s\n",
+		resp.Build, (time.Duration(resp.UptimeSeconds) * time.Second).String(), resp.ConfigDigest)
+	fmt.Fprintf(w, "Status: %s\n", resp.Status)
+	for _, check := range resp.Checks {
+		fmt.Fprintf(w, "\n%-14s %-9s since %s (%s)\n",
+			check.Name, check.Status, check.Since.Local().Format("15:04:05"), now.Sub(check.Since).Round(time.Second))
+		fmt.Fprintf(w, "  %s\n", check.Message)
+		if check.LastError != "" && check.Status == health.HealthStatusHealthy {
+			fmt.Fprintf(w, "  last error at %s: %s\n", check.LastErrorTime.Local().Format("15:04:05"), check.LastError)
+		}
+		if len(check.History) > 1 {
+			fmt.Fprintln(w, "  history:")
+			for _, t := range check.History {
+				fmt.Fprintf(w, "    %s  %-9s %s\n", t.Time.Local().Format("15:04:05"), t.Status, t.Message)
+			}
+		}
+	}
+	printRouteStats(w, resp.Routes)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/audit"
+	"github.com/hydragon2m/tunnel-agent/internal/buildinfo"
+	"github.com/hydragon2m/tunnel-agent/internal/config"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/update"
+)
+
+// updatePublicKey là ed25519 public key (base64) dùng verify releases,
+// được set lúc build: -ldflags "-X main.updatePublicKey=..."
+var updatePublicKey = ""
+
+// runUpdate thực thi lệnh `agent update`: tải release mới nhất cho OS/arch hiện tại,
+// verify signed checksum, thay binary và graceful restart agent đang chạy qua admin API.
+//
+//	agent update
+//	agent update -check
+func runUpdate(args []string) int {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	baseURL := fs.String("url", envOr("UPDATE_URL", update.DefaultBaseURL), "Release download base URL")
+	publicKey := fs.String("public-key", envOr("UPDATE_PUBLIC_KEY", updatePublicKey), "Base64 ed25519 key used to verify releases")
+	checkOnly := fs.Bool("check", false, "Only check whether an update is available")
+	restart := fs.Bool("restart", true, "Gracefully restart the running agent via admin API after updating")
+	addr := fs.String("admin-addr", admin.DefaultAddr, "Admin API address of the running agent")
+	token := fs.String("admin-token", os.Getenv("TUNNEL_AGENT_ADMIN_TOKEN"), "Admin token of the running agent (default: $TUNNEL_AGENT_ADMIN_TOKEN)")
+	timeout := fs.Duration("timeout", 10*time.Minute, "Download timeout")
+	fs.Parse(args)
+
+	updater, err := update.NewUpdater(*baseURL, *publicKey, buildinfo.Get().Version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "update failed: %v\n", err)
+		return 1
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "update failed: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	release, err := updater.Check(ctx, exe)
+	if errors.Is(err, update.ErrUpToDate) {
+		fmt.Println("Already up to date")
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "update check failed: %v\n", err)
+		return 1
+	}
+	if *checkOnly {
+		fmt.Printf("Update available: %s %s (sha256 %s)\n", release.Version, release.Asset, release.SHA256)
+		return 0
+	}
+
+	if err := updater.Apply(ctx, release, exe); err != nil {
+		fmt.Fprintf(os.Stderr, "update failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Updated %s to %s %s (sha256 %s)\n", exe, release.Version, release.Asset, release.SHA256)
+
+	if *restart {
+		c := admin.NewClient(*addr, handoffReadyTimeout+10*time.Second).WithToken(*token)
+		if err := c.Do(http.MethodPost, "/restart", struct{}{}, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "could not restart running agent: %v\n", err)
+			fmt.Fprintln(os.Stderr, "restart it manually (or send SIGHUP) to use the new version")
+			return 0
+		}
+		fmt.Println("Running agent restarted gracefully")
+	}
+	return 0
+}
+
+// scheduleAutoUpdate thêm job định kỳ kiểm tra release mới; khi cài xong sẽ
+// graceful restart. Jitter tránh cả fleet cùng kiểm tra một lúc.
+func scheduleAutoUpdate(updater *update.Updater, interval time.Duration, restartCh chan<- string) {
+	exe, err := os.Executable()
+	if err != nil {
+		logger.Error("Auto-update disabled", "error", err)
+		return
+	}
+
+	scheduleJob(jobAutoUpdate, interval, 0.1, func(jobCtx context.Context) {
+		// Process đang bàn giao cho process mới: không cần kiểm tra nữa
+		if draining.Load() {
+			jobs.Pause(jobAutoUpdate)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(jobCtx, 10*time.Minute)
+		release, err := updater.Check(ctx, exe)
+		if err == nil {
+			err = updater.Apply(ctx, release, exe)
+		}
+		cancel()
+
+		switch {
+		case errors.Is(err, update.ErrUpToDate):
+			logger.Debug("Auto-update: already up to date")
+			return
+		case err != nil:
+			logger.Warn("Auto-update failed", "error", err)
+			outcome := audit.OutcomeFailure
+			if errors.Is(err, update.ErrBadSignature) || errors.Is(err, update.ErrDowngrade) {
+				outcome = audit.OutcomeDenied
+			}
+			audit.Record(audit.TypeUpdate, "install", outcome, map[string]any{"error": err.Error()})
+			return
+		}
+
+		logger.Info("Auto-update installed new version", "audit", true, "version", release.Version, "asset", release.Asset, "sha256", release.SHA256)
+		audit.Record(audit.TypeUpdate, "install", audit.OutcomeSuccess, map[string]any{
+			"version": release.Version,
+			"asset":   release.Asset,
+			"sha256":  release.SHA256,
+		})
+		if triggerRestart(restartCh, client.ShutdownSelfUpdate) == nil {
+			jobs.Pause(jobAutoUpdate)
+		}
+	})
+}
+
+// envOr trả về TUNNEL_AGENT_<key>, env var cũ key hoặc fallback nếu không set
+func envOr(key, fallback string) string {
+	if v := os.Getenv(config.EnvName(key)); v != "" {
+		return v
+	}
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
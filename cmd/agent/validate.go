@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/admin"
+	"github.com/hydragon2m/tunnel-agent/internal/config"
+)
+
+// validateFlags kiểm tra giá trị và tổ hợp flags sau khi bind env, trả về tất cả lỗi
+// cùng lúc kèm cách sửa thay vì chấp nhận âm thầm giá trị sai
+func validateFlags() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if err := validateHostPort(*serverAddr); err != nil {
+		invalid("-server %q: %v; use host:port, e.g. core.example.com:8443", *serverAddr, err)
+	}
+	if _, err := client.ResolveBindAddress(*bindAddr); err != nil {
+		invalid("-bind-address: %v; use a local IP such as 192.0.2.10 or an interface name such as eth1", err)
+	}
+	if strings.TrimSpace(*tunnelName) == "" || strings.ContainsAny(*tunnelName, " \t\r\n") {
+		invalid("-tunnel-name %q must be a non-empty name without spaces, e.g. staging-api", *tunnelName)
+	}
+	if *skipVerify && !*useTLS {
+		invalid("-skip-verify has no effect with -tls=false; remove -skip-verify or enable -tls")
+	}
+
+	// Timeouts
+	positive := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"-heartbeat", *heartbeatInterval},
+		{"-request-timeout", *requestTimeout},
+		{"-exec-timeout", *execTimeout},
+	}
+	for _, p := range positive {
+		if p.value <= 0 {
+			invalid("%s must be greater than 0, got %s", p.name, p.value)
+		}
+	}
+	if *readTimeout < 0 {
+		invalid("-read-timeout must not be negative, got %s; use 0 for 3× -heartbeat", *readTimeout)
+	}
+	if *heartbeatInterval > 0 && *readTimeout > 0 && *readTimeout <= *heartbeatInterval {
+		invalid("-read-timeout (%s) must be greater than -heartbeat (%s), otherwise the connection times out between heartbeats; use e.g. -read-timeout=%s",
+			*readTimeout, *heartbeatInterval, 3**heartbeatInterval)
+	}
+	if *linkQualityThreshold < 0 || *linkQualityThreshold > 100 {
+		invalid("-link-quality-threshold must be between 0 and 100, got %d; use 0 to disable", *linkQualityThreshold)
+	}
+	if *heartbeatProbeSize < 0 || *heartbeatProbeSize > client.MaxHeartbeatProbeSize {
+		invalid("-heartbeat-probe-size must be between 0 and %d, got %d; a typical probe is 1400 (one Ethernet MTU)", client.MaxHeartbeatProbeSize, *heartbeatProbeSize)
+	}
+	if *maxFrameRate < 0 {
+		invalid("-max-frame-rate must not be negative, got %d; use 0 for no limit", *maxFrameRate)
+	}
+	if *frameBurst < 0 {
+		invalid("-frame-burst must not be negative, got %d", *frameBurst)
+	}
+	if *warmConns < 0 {
+		invalid("-warm-conns must not be negative, got %d; use 0 to disable warm-up", *warmConns)
+	}
+	if *restartGrace < 0 {
+		invalid("-restart-grace must not be negative, got %s; use 0 to disable", *restartGrace)
+	}
+	if *maxStreams < 0 {
+		invalid("-max-streams must not be negative, got %d; use 0 for no limit", *maxStreams)
+	}
+	if *maxStreamOpenRate < 0 {
+		invalid("-max-stream-open-rate must not be negative, got %d; use 0 for no limit", *maxStreamOpenRate)
+	}
+	if *drainTimeout < 0 {
+		invalid("-drain-timeout must not be negative, got %s", *drainTimeout)
+	}
+	if *flushTimeout <= 0 {
+		invalid("-flush-timeout must be positive, got %s", *flushTimeout)
+	}
+	if *idleShutdown < 0 {
+		invalid("-idle-shutdown must not be negative, got %s; use 0 to disable", *idleShutdown)
+	}
+	if *idleAction != idleActionExit && *idleAction != idleActionSleep {
+		invalid("-idle-action %q is unknown; use exit or sleep", *idleAction)
+	}
+	if *recordFormat != "" && *recordFormat != client.RecordNDJSON && *recordFormat != client.RecordHAR {
+		invalid("-record-format %q is unknown; use ndjson or har", *recordFormat)
+	}
+	if *recordDryRun && *recordPath == "" {
+		invalid("-record-dry-run requires -record")
+	}
+	if *inspectKeep < 0 {
+		invalid("-inspect must not be negative, got %d; use 0 to disable", *inspectKeep)
+	}
+	if *watchdogInterval < 0 {
+		invalid("-watchdog-interval must not be negative, got %s; use 0 to disable", *watchdogInterval)
+	}
+	if *crashLoopStarts < 0 {
+		invalid("-crash-loop-starts must not be negative, got %d; use 0 to disable", *crashLoopStarts)
+	}
+	if *crashLoopStarts > 0 && *crashLoopWindow <= 0 {
+		invalid("-crash-loop-window must be greater than 0 when -crash-loop-starts is set, got %s", *crashLoopWindow)
+	}
+	if *crashLoopStarts > 0 && *crashLoopMaxDelay <= 0 {
+		invalid("-crash-loop-max-delay must be greater than 0 when -crash-loop-starts is set, got %s", *crashLoopMaxDelay)
+	}
+	if *pauseAfter < 0 {
+		invalid("-pause-after must not be negative, got %s; use 0 to disable", *pauseAfter)
+	}
+	if *pauseAfter > 0 && *probeInterval <= 0 {
+		invalid("-probe-interval must be greater than 0 when -pause-after is set, got %s", *probeInterval)
+	}
+	if *autoUpdate && *autoUpdateInterval <= 0 {
+		invalid("-auto-update-interval must be greater than 0 when -auto-update is enabled, got %s", *autoUpdateInterval)
+	}
+
+	switch *logLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		invalid("-log-level %q is unknown; use debug, info, warn or error", *logLevel)
+	}
+	if *debugDuration < 0 {
+		invalid("-debug-duration must not be negative, got %s; use 0 to keep debug on until toggled off", *debugDuration)
+	}
+
+	if *metricsEnabled && (*metricsPort < 1 || *metricsPort > 65535) {
+		invalid("-metrics-port %d is out of range; use a port between 1 and 65535", *metricsPort)
+	}
+	if *adminEnabled {
+		if err := validateHostPort(*adminAddr); err != nil {
+			invalid("-admin-addr %q: %v; use host:port, e.g. %s", *adminAddr, err, admin.DefaultAddr)
+		}
+	}
+	if *execEnabled {
+		for _, line := range splitList(*execAllow) {
+			if _, err := client.ParseExecRule(line); err != nil {
+				invalid("-exec-allow: %v", err)
+			}
+		}
+	}
+	if *filesDir != "" {
+		if info, err := os.Stat(*filesDir); !filepath.IsAbs(*filesDir) || err != nil || !info.IsDir() {
+			invalid("-files-dir %q must be an absolute path to an existing directory", *filesDir)
+		}
+	}
+
+	if err := validateLocalServices(*localServices); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseListeners(*listenAddrs); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateHostPort kiểm tra địa chỉ dạng host:port với port hợp lệ
+func validateHostPort(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// validateLocalServices kiểm tra từng mapping [host=]url của -local
+func validateLocalServices(input string) error {
+	var errs []error
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		rawURL := part
+		if host, u, ok := strings.Cut(part, "="); ok {
+			host = strings.TrimSpace(host)
+			if host == "" {
+				errs = append(errs, fmt.Errorf("-local entry %q: host before '=' is empty; use host=url or just url", part))
+				continue
+			}
+			if err := config.ValidateHostPattern(host); err != nil {
+				errs = append(errs, fmt.Errorf("-local entry %q: %v", part, err))
+				continue
+			}
+			rawURL = strings.TrimSpace(u)
+		}
+
+		if err := config.ValidateServiceURL(rawURL); err != nil {
+			errs = append(errs, fmt.Errorf("-local entry %q: %v", part, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/health"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// warmUpCheckInterval là chu kỳ job warm-up kiểm tra local service đã phục hồi chưa
+const warmUpCheckInterval = 5 * time.Second
+
+// warmer mở sẵn keep-alive connections tới local services lúc khởi động và
+// mỗi khi check local_service trở lại healthy, vì connections cũ trong pool
+// đã hỏng khi local service restart
+type warmer struct {
+	forwarder *client.LocalForwarder
+	check     *health.Check
+
+	running atomic.Bool
+	healthy bool // chỉ dùng trong job jobWarmUp
+}
+
+func newWarmer(forwarder *client.LocalForwarder, check *health.Check) *warmer {
+	return &warmer{forwarder: forwarder, check: check, healthy: true}
+}
+
+// start warm-up ngay rồi thêm job theo dõi local service phục hồi
+func (w *warmer) start(ctx context.Context) {
+	go w.warm(ctx, "startup")
+	scheduleJob(jobWarmUp, warmUpCheckInterval, 0, func(ctx context.Context) {
+		w.poll(ctx)
+	})
+}
+
+// poll warm-up lại khi check chuyển từ unhealthy/degraded sang healthy
+func (w *warmer) poll(ctx context.Context) {
+	status, _, _ := w.check.GetStatus()
+	healthy := status == health.HealthStatusHealthy
+	recovered := healthy && !w.healthy
+	w.healthy = healthy
+	if recovered {
+		w.warm(ctx, "recovered")
+	}
+}
+
+// warm chạy một lượt warm-up; lượt mới bị bỏ qua khi lượt trước chưa xong
+func (w *warmer) warm(ctx context.Context, reason string) {
+	if !w.running.CompareAndSwap(false, true) {
+		return
+	}
+	defer w.running.Store(false)
+
+	start := time.Now()
+	warmed, failed := w.forwarder.WarmUp(ctx)
+	if failed > 0 {
+		logger.Warn("Local connection warm-up incomplete", "reason", reason, "warmed", warmed, "failed", failed, "duration", time.Since(start).Round(time.Millisecond))
+		return
+	}
+	logger.Info("Local connections warmed up", "reason", reason, "warmed", warmed, "duration", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+	"github.com/hydragon2m/tunnel-agent/internal/watchdog"
+)
+
+// startWatchdog chạy leak watchdog: goroutines, streams và connections được so
+// với bound mỗi interval, nghi ngờ leak được log và đếm trong /metrics
+func startWatchdog(interval time.Duration, streamManager *client.StreamManager) {
+	w := watchdog.New(watchdog.Options{
+		Interval: interval,
+		Baseline: runtime.NumGoroutine(),
+		Sample: func() watchdog.Sample {
+			goroutines := runtime.NumGoroutine()
+			metrics.GetMetrics().SetGoroutines(goroutines)
+			snapshot := metrics.GetMetrics().GetSnapshot()
+			return watchdog.Sample{
+				Goroutines:    goroutines,
+				Streams:       len(streamManager.Snapshot()),
+				StreamsActive: int(snapshot.StreamsActive),
+				Connections:   int(snapshot.ConnectionsActive),
+			}
+		},
+		OnSuspect: func(f watchdog.Finding) {
+			metrics.GetMetrics().IncrementLeaksSuspected()
+			logger.Warn("Resource leak suspected",
+				"resource", f.Resource,
+				"count", f.Count,
+				"limit", f.Limit,
+				"goroutines", f.Sample.Goroutines,
+				"streams", f.Sample.Streams,
+				"connections", f.Sample.Connections,
+			)
+		},
+	})
+	scheduleJob(jobWatchdog, interval, 0, func(context.Context) { w.Check() })
+}
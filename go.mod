@@ -4,4 +4,6 @@ go 1.22
 
 require github.com/hydragon2m/tunnel-protocol v0.1.1
 
+require gopkg.in/yaml.v3 v3.0.1
+
 replace github.com/hydragon2m/tunnel-protocol => ../tunnel-protocol
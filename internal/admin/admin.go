@@ -0,0 +1,219 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/audit"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+// DefaultAddr is the default listen address of the admin API.
+// The admin API is bound to loopback because it can trigger privileged
+// operations (file transfer, diagnostics, ...).
+const DefaultAddr = "127.0.0.1:9092"
+
+// Server serves the local administrative API
+type Server struct {
+	addr   string
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// ErrorResponse is the JSON body returned on admin API errors
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewServer creates a new admin server
+func NewServer(addr string) *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		addr: addr,
+		mux:  mux,
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Handle registers a handler for the given pattern.
+// Every admin API call is recorded in the audit log. Requests whose Host is
+// a DNS name other than localhost are rejected, so a web page cannot reach
+// the admin API through DNS rebinding.
+func (s *Server) Handle(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		if allowedHost(r.Host) {
+			handler(rec, r)
+		} else {
+			WriteError(rec, http.StatusForbidden, fmt.Errorf("host %q is not allowed", r.Host))
+		}
+
+		outcome := audit.OutcomeSuccess
+		if rec.status >= 400 {
+			outcome = audit.OutcomeFailure
+		}
+		audit.Record(audit.TypeAdminAPI, r.Method+" "+r.URL.Path, outcome, map[string]any{
+			"remote_addr": r.RemoteAddr,
+			"status":      rec.status,
+		})
+	})
+}
+
+// allowedHost reports whether host (of the Host header) is localhost or an IP
+// literal; only a DNS name can be rebound to the loopback address
+func allowedHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	return strings.EqualFold(host, "localhost") || net.ParseIP(host) != nil
+}
+
+// RequireToken wraps handler of a privileged endpoint: requests must carry
+// "Authorization: Bearer <token>" and a JSON body. A cross-site form or
+// fetch cannot set either without a CORS preflight, which is never answered.
+func RequireToken(token string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			WriteError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid admin token"))
+			return
+		}
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+			WriteError(w, http.StatusUnsupportedMediaType, fmt.Errorf("Content-Type must be application/json"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// statusRecorder captures the response status code
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records status code
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Start starts listening and serves requests in background
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Admin API listening", "address", ln.Addr().String())
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Error("Admin API server error", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown gracefully stops the admin server
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// WriteJSON writes v as JSON response with status code
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// WriteError writes an ErrorResponse with status code
+func WriteError(w http.ResponseWriter, status int, err error) {
+	WriteJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+// Client calls the admin API of a running agent
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+}
+
+// NewClient creates a new admin API client
+func NewClient(addr string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:    "http://" + addr,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// WithToken sets the admin token sent to endpoints wrapped by RequireToken
+func (c *Client) WithToken(token string) *Client {
+	c.token = token
+	return c
+}
+
+// Do sends a request to the admin API and decodes the JSON response into out.
+// in is encoded as JSON request body when not nil.
+func (c *Client) Do(method, path string, in, out any) error {
+	var body []byte
+	contentType := ""
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+
+	data, err := c.Send(method, path, contentType, body)
+	if err != nil || out == nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Send sends body with contentType (none when empty) to the admin API and
+// returns the raw response body
+func (c *Client) Send(method, path, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("admin API unreachable (is the agent running with -admin?): %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var errResp ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil && errResp.Error != "" {
+			return nil, fmt.Errorf("%s", errResp.Error)
+		}
+		return nil, fmt.Errorf("admin API returned %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
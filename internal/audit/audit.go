@@ -0,0 +1,289 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	TypeAuth       = "auth"
+	TypeConfig     = "config"
+	TypeAdminAPI   = "admin_api"
+	TypeCapability = "capability"
+	TypeExec       = "exec"
+	TypeUpdate     = "update"
+	TypeAudit      = "audit"
+)
+
+// Outcomes
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+// genesisHash is the PrevHash of the first event in a chain
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// ErrChainBroken is returned by Verify when the hash chain is invalid
+var ErrChainBroken = errors.New("audit chain broken")
+
+// Event is a single audit log record.
+// Each event includes the hash of the previous event, so any modification,
+// removal or reordering of records breaks the chain.
+type Event struct {
+	Seq      uint64         `json:"seq"`
+	Time     time.Time      `json:"time"`
+	Type     string         `json:"type"`
+	Action   string         `json:"action"`
+	Outcome  string         `json:"outcome"`
+	Details  map[string]any `json:"details,omitempty"`
+	PrevHash string         `json:"prev_hash"`
+	Hash     string         `json:"hash,omitempty"`
+}
+
+// Log is an append-only, hash-chained audit log file
+type Log struct {
+	mu       sync.Mutex
+	file     *os.File
+	seq      uint64
+	lastHash string
+}
+
+var (
+	globalLog   *Log
+	globalLogMu sync.RWMutex
+)
+
+// Init opens the global audit log at path
+func Init(path string) error {
+	l, err := Open(path)
+	if err != nil {
+		return err
+	}
+
+	globalLogMu.Lock()
+	defer globalLogMu.Unlock()
+	globalLog = l
+	return nil
+}
+
+// Record appends an event to the global audit log.
+// It is a no-op when the audit log is not enabled.
+func Record(eventType, action, outcome string, details map[string]any) {
+	globalLogMu.RLock()
+	l := globalLog
+	globalLogMu.RUnlock()
+
+	if l == nil {
+		return
+	}
+	if err := l.Record(eventType, action, outcome, details); err != nil {
+		// Audit failures must be visible but must not crash the agent
+		fmt.Fprintf(os.Stderr, "audit log write failed: %v\n", err)
+	}
+}
+
+// Close closes the global audit log
+func Close() error {
+	globalLogMu.Lock()
+	defer globalLogMu.Unlock()
+
+	if globalLog == nil {
+		return nil
+	}
+	err := globalLog.Close()
+	globalLog = nil
+	return err
+}
+
+// Open opens (or creates) an audit log file and resumes its hash chain.
+//
+// A crash while appending can leave an unterminated last line. Such a torn
+// record is truncated away and the truncation is recorded in the chain;
+// any other invalid record is an error.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	l := &Log{file: f, lastHash: genesisHash}
+
+	end, torn, err := completeLength(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+
+	// Resume chain from existing records
+	last, count, err := verify(io.NewSectionReader(f, 0, end))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("existing audit log %s is invalid: %w", path, err)
+	}
+	if count > 0 {
+		l.seq = last.Seq
+		l.lastHash = last.Hash
+	}
+
+	if torn > 0 {
+		if err := f.Truncate(end); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to truncate torn record of audit log %s: %w", path, err)
+		}
+		fmt.Fprintf(os.Stderr, "audit log %s: truncated torn last record (%d bytes)\n", path, torn)
+		if err := l.Record(TypeAudit, "truncate_torn_record", OutcomeFailure, map[string]any{"bytes": torn}); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// completeLength returns the length of f up to and including its last
+// newline, and the number of bytes after it
+func completeLength(f *os.File) (end, torn int64, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	size := info.Size()
+
+	buf := make([]byte, 4096)
+	for off := size; off > 0; {
+		n := int64(len(buf))
+		if off < n {
+			n = off
+		}
+		off -= n
+		if _, err := f.ReadAt(buf[:n], off); err != nil {
+			return 0, 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			end = off + int64(i) + 1
+			return end, size - end, nil
+		}
+	}
+	return 0, size, nil
+}
+
+// Record appends an event to the log
+func (l *Log) Record(eventType, action, outcome string, details map[string]any) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	event := Event{
+		Seq:      l.seq + 1,
+		Time:     time.Now().UTC(),
+		Type:     eventType,
+		Action:   action,
+		Outcome:  outcome,
+		Details:  details,
+		PrevHash: l.lastHash,
+	}
+	hash, err := hashEvent(&event)
+	if err != nil {
+		return err
+	}
+	event.Hash = hash
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+
+	l.seq = event.Seq
+	l.lastHash = event.Hash
+	return nil
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Verify checks the hash chain of an audit log and returns the number of valid records
+func Verify(r io.Reader) (int, error) {
+	_, count, err := verify(r)
+	return count, err
+}
+
+// verify walks the chain and returns the last event
+func verify(r io.Reader) (*Event, int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	prevHash := genesisHash
+	var last *Event
+	count := 0
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, count, fmt.Errorf("%w: record %d is not valid JSON: %v", ErrChainBroken, count+1, err)
+		}
+		if event.PrevHash != prevHash {
+			return nil, count, fmt.Errorf("%w: record seq=%d prev_hash mismatch", ErrChainBroken, event.Seq)
+		}
+		if last != nil && event.Seq != last.Seq+1 {
+			return nil, count, fmt.Errorf("%w: record seq=%d out of order", ErrChainBroken, event.Seq)
+		}
+
+		expected, err := hashEvent(&event)
+		if err != nil {
+			return nil, count, err
+		}
+		if event.Hash != expected {
+			return nil, count, fmt.Errorf("%w: record seq=%d hash mismatch", ErrChainBroken, event.Seq)
+		}
+
+		prevHash = event.Hash
+		e := event
+		last = &e
+		count++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, count, err
+	}
+	return last, count, nil
+}
+
+// hashEvent computes sha256 over the JSON encoding of event without its Hash
+func hashEvent(event *Event) (string, error) {
+	unhashed := *event
+	unhashed.Hash = ""
+
+	data, err := json.Marshal(unhashed)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
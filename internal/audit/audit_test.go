@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLog_ChainAndResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	l.Record(TypeAuth, "authenticate", OutcomeSuccess, map[string]any{"agent_id": "a1"})
+	l.Record(TypeExec, "session_start", OutcomeSuccess, map[string]any{"command": "uptime", "stream_id": 3})
+	l.Close()
+
+	// Reopening must resume the existing chain
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	l.Record(TypeConfig, "load", OutcomeSuccess, nil)
+	l.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	count, err := Verify(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 records, got %d", count)
+	}
+}
+
+func TestVerify_DetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	l.Record(TypeAuth, "authenticate", OutcomeFailure, map[string]any{"error": "bad token"})
+	l.Record(TypeAuth, "authenticate", OutcomeSuccess, nil)
+	l.Close()
+
+	data, _ := os.ReadFile(path)
+	tampered := bytes.Replace(data, []byte(`"failure"`), []byte(`"success"`), 1)
+
+	if _, err := Verify(bytes.NewReader(tampered)); !errors.Is(err, ErrChainBroken) {
+		t.Errorf("Expected ErrChainBroken for modified record, got %v", err)
+	}
+
+	// Remove the first record
+	lines := bytes.SplitN(data, []byte("\n"), 2)
+	if _, err := Verify(bytes.NewReader(lines[1])); !errors.Is(err, ErrChainBroken) {
+		t.Errorf("Expected ErrChainBroken for removed record, got %v", err)
+	}
+}
+
+func TestOpen_TruncatesTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	l.Record(TypeAuth, "authenticate", OutcomeSuccess, nil)
+	l.Record(TypeConfig, "load", OutcomeSuccess, nil)
+	l.Close()
+
+	// Simulate a crash in the middle of appending a record
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	f.WriteString(`{"seq":3,"time":"2026-`)
+	f.Close()
+
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open with torn record failed: %v", err)
+	}
+	l.Record(TypeAuth, "authenticate", OutcomeSuccess, nil)
+	l.Close()
+
+	data, _ := os.ReadFile(path)
+	count, err := Verify(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	// 2 original records, the truncation record and the new one
+	if count != 4 {
+		t.Errorf("Expected 4 records, got %d", count)
+	}
+	if !bytes.Contains(data, []byte(`"truncate_torn_record"`)) {
+		t.Error("Expected truncation to be recorded")
+	}
+}
+
+func TestOpen_RejectsBrokenChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	l.Record(TypeAuth, "authenticate", OutcomeFailure, nil)
+	l.Record(TypeAuth, "authenticate", OutcomeSuccess, nil)
+	l.Close()
+
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, bytes.Replace(data, []byte(`"failure"`), []byte(`"success"`), 1), 0o600)
+
+	if _, err := Open(path); !errors.Is(err, ErrChainBroken) {
+		t.Errorf("Expected ErrChainBroken, got %v", err)
+	}
+}
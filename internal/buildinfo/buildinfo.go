@@ -0,0 +1,121 @@
+// Package buildinfo reports the version, commit and build time of the running
+// binary. Release builds set them with ldflags:
+//
+//	go build -ldflags "-X github.com/hydragon2m/tunnel-agent/internal/buildinfo.Version=v1.2.3 \
+//	  -X github.com/hydragon2m/tunnel-agent/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/hydragon2m/tunnel-agent/internal/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Values not set via ldflags fall back to the module and VCS information
+// embedded by the Go toolchain.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Set via -ldflags "-X ..."
+var (
+	Version = ""
+	Commit  = ""
+	Date    = ""
+)
+
+// startTime is when the process started (package initialization)
+var startTime = time.Now()
+
+// Info describes the running binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+var (
+	infoOnce sync.Once
+	info     Info
+)
+
+// Get returns build information of the running binary
+func Get() Info {
+	infoOnce.Do(func() {
+		info = read(Version, Commit, Date)
+	})
+	return info
+}
+
+// read merges ldflags values with the embedded build info
+func read(version, commit, date string) Info {
+	i := Info{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if i.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			i.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if i.Commit == "" {
+					i.Commit = s.Value
+				}
+			case "vcs.time":
+				if i.Date == "" {
+					i.Date = s.Value
+				}
+			case "vcs.modified":
+				i.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	if i.Version == "" {
+		i.Version = "dev"
+	}
+	return i
+}
+
+// ShortCommit returns the first 12 characters of the commit hash
+func (i Info) ShortCommit() string {
+	if len(i.Commit) > 12 {
+		return i.Commit[:12]
+	}
+	return i.Commit
+}
+
+// String returns a human-readable description, e.g. "v1.2.3 (abc123def456, 2024-01-15T10:30:00Z)"
+func (i Info) String() string {
+	s := i.Version
+	if i.Commit == "" && i.Date == "" {
+		return s
+	}
+	s += " (" + i.ShortCommit()
+	if i.Modified {
+		s += "-dirty"
+	}
+	if i.Date != "" {
+		if i.Commit != "" {
+			s += ", "
+		}
+		s += i.Date
+	}
+	return s + ")"
+}
+
+// StartTime returns when the process started
+func StartTime() time.Time {
+	return startTime
+}
+
+// Uptime returns how long the process has been running
+func Uptime() time.Duration {
+	return time.Since(startTime)
+}
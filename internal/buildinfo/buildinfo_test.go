@@ -0,0 +1,38 @@
+package buildinfo
+
+import "testing"
+
+func TestRead_LdflagsTakePrecedence(t *testing.T) {
+	i := read("v1.2.3", "0123456789abcdef0123", "2024-01-15T10:30:00Z")
+
+	if i.Version != "v1.2.3" || i.Commit != "0123456789abcdef0123" || i.Date != "2024-01-15T10:30:00Z" {
+		t.Errorf("unexpected info: %+v", i)
+	}
+	if i.GoVersion == "" {
+		t.Error("GoVersion should always be set")
+	}
+}
+
+func TestRead_DefaultsToDev(t *testing.T) {
+	// Test binaries have no module version, so the fallback is used
+	if i := read("", "", ""); i.Version == "" {
+		t.Error("Version should never be empty")
+	}
+}
+
+func TestInfo_String(t *testing.T) {
+	tests := []struct {
+		info Info
+		want string
+	}{
+		{Info{Version: "dev"}, "dev"},
+		{Info{Version: "v1.2.3", Commit: "0123456789abcdef"}, "v1.2.3 (0123456789ab)"},
+		{Info{Version: "v1.2.3", Commit: "0123456789abcdef", Modified: true, Date: "2024-01-15T10:30:00Z"}, "v1.2.3 (0123456789ab-dirty, 2024-01-15T10:30:00Z)"},
+		{Info{Version: "v1.2.3", Date: "2024-01-15T10:30:00Z"}, "v1.2.3 (2024-01-15T10:30:00Z)"},
+	}
+	for _, tt := range tests {
+		if got := tt.info.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Package chaos injects faults into the agent's frame I/O so resilience
+// features (reconnect, retries, flow control) can be exercised against
+// realistic failures. It must never be enabled in production.
+package chaos
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options configures fault probabilities. Rates are in [0, 1] and are
+// evaluated independently for every frame.
+type Options struct {
+	// DropRate is the probability that a frame is silently dropped
+	DropRate float64
+	// CorruptRate is the probability that one payload byte is flipped
+	CorruptRate float64
+	// DelayRate is the probability that a write is delayed by up to Delay
+	DelayRate float64
+	Delay     time.Duration
+	// DisconnectRate is the probability that the connection is closed
+	// before a write, forcing a reconnect
+	DisconnectRate float64
+	// IncludeControl also applies drops and corruption to control frames
+	// (auth, heartbeat). By default they are exempt so the agent can
+	// still authenticate.
+	IncludeControl bool
+	// Seed makes fault sequences reproducible; 0 uses the current time
+	Seed int64
+}
+
+// Stats counts injected faults
+type Stats struct {
+	Dropped      int64 `json:"dropped"`
+	Corrupted    int64 `json:"corrupted"`
+	Delayed      int64 `json:"delayed"`
+	Disconnected int64 `json:"disconnected"`
+}
+
+// Injector decides which faults to inject. A nil *Injector injects nothing,
+// so callers don't need to check whether chaos is enabled.
+type Injector struct {
+	opts Options
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+
+	dropped      atomic.Int64
+	corrupted    atomic.Int64
+	delayed      atomic.Int64
+	disconnected atomic.Int64
+}
+
+// New creates a fault injector
+func New(opts Options) *Injector {
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Injector{
+		opts: opts,
+		rnd:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// roll returns true with probability rate
+func (i *Injector) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rnd.Float64() < rate
+}
+
+// exempt reports whether frames of streamID are excluded from injection
+func (i *Injector) exempt(streamID uint32) bool {
+	return streamID == 0 && !i.opts.IncludeControl
+}
+
+// Drop reports whether the frame should be dropped
+func (i *Injector) Drop(streamID uint32) bool {
+	if i == nil || i.exempt(streamID) || !i.roll(i.opts.DropRate) {
+		return false
+	}
+	i.dropped.Add(1)
+	return true
+}
+
+// Corrupt returns a copy of payload with one byte flipped and true, or
+// payload unchanged and false. The input slice is never modified.
+func (i *Injector) Corrupt(streamID uint32, payload []byte) ([]byte, bool) {
+	if i == nil || len(payload) == 0 || i.exempt(streamID) || !i.roll(i.opts.CorruptRate) {
+		return payload, false
+	}
+
+	i.mu.Lock()
+	pos := i.rnd.Intn(len(payload))
+	i.mu.Unlock()
+
+	corrupted := append([]byte(nil), payload...)
+	corrupted[pos] ^= 0xFF
+	i.corrupted.Add(1)
+	return corrupted, true
+}
+
+// Delay returns how long the next write should be delayed
+func (i *Injector) Delay() time.Duration {
+	if i == nil || i.opts.Delay <= 0 || !i.roll(i.opts.DelayRate) {
+		return 0
+	}
+
+	i.mu.Lock()
+	d := time.Duration(i.rnd.Int63n(int64(i.opts.Delay)) + 1)
+	i.mu.Unlock()
+
+	i.delayed.Add(1)
+	return d
+}
+
+// Disconnect reports whether the connection should be closed now
+func (i *Injector) Disconnect() bool {
+	if i == nil || !i.roll(i.opts.DisconnectRate) {
+		return false
+	}
+	i.disconnected.Add(1)
+	return true
+}
+
+// Stats returns counts of injected faults
+func (i *Injector) Stats() Stats {
+	if i == nil {
+		return Stats{}
+	}
+	return Stats{
+		Dropped:      i.dropped.Load(),
+		Corrupted:    i.corrupted.Load(),
+		Delayed:      i.delayed.Load(),
+		Disconnected: i.disconnected.Load(),
+	}
+}
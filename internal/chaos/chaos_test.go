@@ -0,0 +1,60 @@
+package chaos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInjector_Rates(t *testing.T) {
+	always := New(Options{DropRate: 1, CorruptRate: 1, DelayRate: 1, Delay: time.Millisecond, DisconnectRate: 1, Seed: 1})
+	never := New(Options{Seed: 1})
+
+	if !always.Drop(1) || never.Drop(1) {
+		t.Errorf("Drop should follow DropRate")
+	}
+	if !always.Disconnect() || never.Disconnect() {
+		t.Errorf("Disconnect should follow DisconnectRate")
+	}
+	if d := always.Delay(); d <= 0 || d > time.Millisecond {
+		t.Errorf("Expected delay in (0, 1ms], got %s", d)
+	}
+
+	payload := []byte("payload")
+	corrupted, ok := always.Corrupt(1, payload)
+	if !ok || string(corrupted) == "payload" {
+		t.Errorf("Expected corrupted payload, got %q", corrupted)
+	}
+	if string(payload) != "payload" {
+		t.Errorf("Corrupt must not modify its input, got %q", payload)
+	}
+
+	stats := always.Stats()
+	if stats.Dropped != 1 || stats.Corrupted != 1 || stats.Delayed != 1 || stats.Disconnected != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestInjector_ControlFramesExempt(t *testing.T) {
+	i := New(Options{DropRate: 1, CorruptRate: 1, Seed: 1})
+	if i.Drop(0) {
+		t.Errorf("Control frames should not be dropped by default")
+	}
+	if _, ok := i.Corrupt(0, []byte("auth")); ok {
+		t.Errorf("Control frames should not be corrupted by default")
+	}
+
+	i = New(Options{DropRate: 1, IncludeControl: true, Seed: 1})
+	if !i.Drop(0) {
+		t.Errorf("Control frames should be dropped with IncludeControl")
+	}
+}
+
+func TestInjector_NilIsDisabled(t *testing.T) {
+	var i *Injector
+	if i.Drop(1) || i.Disconnect() || i.Delay() != 0 {
+		t.Errorf("nil injector must not inject faults")
+	}
+	if _, ok := i.Corrupt(1, []byte("x")); ok {
+		t.Errorf("nil injector must not corrupt")
+	}
+}
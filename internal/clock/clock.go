@@ -0,0 +1,281 @@
+// Package clock abstracts time so timing behavior (heartbeats, reconnect
+// backoff, reapers, metrics timestamps) can be driven deterministically in
+// tests.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the subset of the time package used by the agent
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+	NewTimer(d time.Duration) Timer
+}
+
+// Ticker mirrors time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer mirrors time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Real is the Clock backed by the time package
+var Real Clock = realClock{}
+
+// Or returns c, or Real if c is nil
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
+
+type realTimer struct{ t *time.Timer }
+
+func (r realTimer) C() <-chan time.Time        { return r.t.C }
+func (r realTimer) Stop() bool                 { return r.t.Stop() }
+func (r realTimer) Reset(d time.Duration) bool { return r.t.Reset(d) }
+
+// Mock is a manually advanced Clock. Timers, tickers, After and Sleep fire
+// only when Advance moves the clock past their deadline.
+type Mock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*mockWaiter
+}
+
+// mockWaiter is a pending timer or ticker
+type mockWaiter struct {
+	deadline time.Time
+	period   time.Duration // > 0 for tickers
+	ch       chan time.Time
+	active   bool
+}
+
+// NewMock creates a Mock clock starting at start
+func NewMock(start time.Time) *Mock {
+	m := &Mock{now: start}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+// Now implements Clock
+func (m *Mock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// Since implements Clock
+func (m *Mock) Since(t time.Time) time.Duration {
+	return m.Now().Sub(t)
+}
+
+// After implements Clock
+func (m *Mock) After(d time.Duration) <-chan time.Time {
+	return m.NewTimer(d).C()
+}
+
+// Sleep implements Clock, blocking until the clock is advanced by d
+func (m *Mock) Sleep(d time.Duration) {
+	<-m.After(d)
+}
+
+// NewTicker implements Clock
+func (m *Mock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	w := m.add(d, d)
+	return &mockTicker{mock: m, w: w}
+}
+
+// NewTimer implements Clock
+func (m *Mock) NewTimer(d time.Duration) Timer {
+	w := m.add(d, 0)
+	return &mockTimer{mock: m, w: w}
+}
+
+// add registers a waiter firing after d
+func (m *Mock) add(d, period time.Duration) *mockWaiter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w := &mockWaiter{
+		deadline: m.now.Add(d),
+		period:   period,
+		ch:       make(chan time.Time, 1),
+		active:   true,
+	}
+	m.waiters = append(m.waiters, w)
+	m.cond.Broadcast()
+	m.fireLocked()
+	return w
+}
+
+// Advance moves the clock forward by d, firing due timers and tickers in
+// deadline order
+func (m *Mock) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	end := m.now.Add(d)
+	for {
+		next, ok := m.nextDeadlineLocked()
+		if !ok || next.After(end) {
+			break
+		}
+		if next.After(m.now) {
+			m.now = next
+		}
+		m.fireLocked()
+	}
+	m.now = end
+}
+
+// Set moves the clock to t, firing due timers and tickers
+func (m *Mock) Set(t time.Time) {
+	m.Advance(t.Sub(m.Now()))
+}
+
+// Waiters returns the number of active timers and tickers
+func (m *Mock) Waiters() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.waiters)
+}
+
+// BlockUntil blocks until at least n timers or tickers are active. Tests use
+// it to make sure a goroutine is waiting on the clock before advancing it.
+func (m *Mock) BlockUntil(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for len(m.waiters) < n {
+		m.cond.Wait()
+	}
+}
+
+// nextDeadlineLocked returns the earliest deadline among active waiters
+func (m *Mock) nextDeadlineLocked() (time.Time, bool) {
+	if len(m.waiters) == 0 {
+		return time.Time{}, false
+	}
+	sort.SliceStable(m.waiters, func(i, j int) bool {
+		return m.waiters[i].deadline.Before(m.waiters[j].deadline)
+	})
+	return m.waiters[0].deadline, true
+}
+
+// fireLocked fires every waiter whose deadline is not after now.
+// Like time.Ticker, a ticker whose channel is full drops the tick.
+func (m *Mock) fireLocked() {
+	kept := m.waiters[:0]
+	for _, w := range m.waiters {
+		if w.deadline.After(m.now) {
+			kept = append(kept, w)
+			continue
+		}
+		select {
+		case w.ch <- m.now:
+		default:
+		}
+		if w.period > 0 {
+			for !w.deadline.After(m.now) {
+				w.deadline = w.deadline.Add(w.period)
+			}
+			kept = append(kept, w)
+		} else {
+			w.active = false
+		}
+	}
+	m.waiters = kept
+}
+
+// removeLocked deactivates w, reporting whether it was active
+func (m *Mock) removeLocked(w *mockWaiter) bool {
+	if !w.active {
+		return false
+	}
+	w.active = false
+	for i, other := range m.waiters {
+		if other == w {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+type mockTicker struct {
+	mock *Mock
+	w    *mockWaiter
+}
+
+func (t *mockTicker) C() <-chan time.Time { return t.w.ch }
+
+func (t *mockTicker) Stop() {
+	t.mock.mu.Lock()
+	defer t.mock.mu.Unlock()
+	t.mock.removeLocked(t.w)
+}
+
+type mockTimer struct {
+	mock *Mock
+	w    *mockWaiter
+}
+
+func (t *mockTimer) C() <-chan time.Time { return t.w.ch }
+
+func (t *mockTimer) Stop() bool {
+	t.mock.mu.Lock()
+	defer t.mock.mu.Unlock()
+	return t.mock.removeLocked(t.w)
+}
+
+func (t *mockTimer) Reset(d time.Duration) bool {
+	m := t.mock
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wasActive := m.removeLocked(t.w)
+	t.w.deadline = m.now.Add(d)
+	t.w.active = true
+	m.waiters = append(m.waiters, t.w)
+	m.cond.Broadcast()
+	m.fireLocked()
+	return wasActive
+}
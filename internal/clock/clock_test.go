@@ -0,0 +1,118 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestMock_TimerFiresOnAdvance(t *testing.T) {
+	m := NewMock(epoch)
+	timer := m.NewTimer(time.Second)
+
+	m.Advance(999 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	m.Advance(time.Millisecond)
+	select {
+	case got := <-timer.C():
+		if !got.Equal(epoch.Add(time.Second)) {
+			t.Errorf("fired at %v, want %v", got, epoch.Add(time.Second))
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+
+	if m.Waiters() != 0 {
+		t.Errorf("expected fired timer to be removed, got %d waiters", m.Waiters())
+	}
+}
+
+func TestMock_TimerStopAndReset(t *testing.T) {
+	m := NewMock(epoch)
+	timer := m.NewTimer(time.Second)
+
+	if !timer.Stop() {
+		t.Error("Stop on active timer should return true")
+	}
+	m.Advance(2 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	if timer.Reset(time.Second) {
+		t.Error("Reset on stopped timer should return false")
+	}
+	m.Advance(time.Second)
+	select {
+	case <-timer.C():
+	default:
+		t.Fatal("reset timer did not fire")
+	}
+}
+
+func TestMock_TickerDropsMissedTicks(t *testing.T) {
+	m := NewMock(epoch)
+	ticker := m.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	m.Advance(time.Second)
+	<-ticker.C()
+
+	// Like time.Ticker, only one tick is buffered
+	m.Advance(5 * time.Second)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Fatal("expected missed ticks to be dropped")
+	default:
+	}
+
+	m.Advance(time.Second)
+	select {
+	case got := <-ticker.C():
+		if !got.Equal(epoch.Add(7 * time.Second)) {
+			t.Errorf("tick at %v, want %v", got, epoch.Add(7*time.Second))
+		}
+	default:
+		t.Fatal("ticker did not fire after advance")
+	}
+}
+
+func TestMock_SleepAndBlockUntil(t *testing.T) {
+	m := NewMock(epoch)
+	done := make(chan struct{})
+	go func() {
+		m.Sleep(time.Minute)
+		close(done)
+	}()
+
+	m.BlockUntil(1)
+	m.Advance(time.Minute)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Sleep did not return after Advance")
+	}
+	if got := m.Since(epoch); got != time.Minute {
+		t.Errorf("Since = %v, want 1m", got)
+	}
+}
+
+func TestOr(t *testing.T) {
+	if Or(nil) != Real {
+		t.Error("Or(nil) should return Real")
+	}
+	m := NewMock(epoch)
+	if Or(m) != m {
+		t.Error("Or(m) should return m")
+	}
+}
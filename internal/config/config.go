@@ -0,0 +1,1218 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/schedule"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the file-based agent configuration.
+// Values from the config file complement command-line flags and
+// environment variables for settings that don't fit in a flag.
+type Config struct {
+	// Token is a secret reference to the agent token, used when neither
+	// -token nor TUNNEL_AGENT_TOKEN is set
+	Token string `yaml:"token,omitempty"`
+
+	// Capabilities is the allowlist of features the agent accepts.
+	// Empty means the built-in defaults are used.
+	Capabilities []string `yaml:"capabilities"`
+
+	// Logging configures log output
+	Logging LoggingConfig `yaml:"logging"`
+
+	// Chaos configures fault injection for resilience testing
+	Chaos ChaosConfig `yaml:"chaos"`
+
+	// Backends routes requests to local services by their original host and
+	// complements the -local flag
+	Backends []BackendConfig `yaml:"backends"`
+
+	// Forwarding configures the client connection headers sent to local services
+	Forwarding ForwardingConfig `yaml:"forwarding"`
+
+	// Hosts maps backend hostnames to IP addresses, like a hosts file or
+	// curl --resolve. Keys are a hostname or host:port (which takes
+	// precedence for that port); values are IP addresses. Only connections
+	// to local services use them; the Host header and TLS name stay unchanged.
+	Hosts map[string]string `yaml:"hosts"`
+
+	// ResponseHeaders modifies the headers of every tunneled response
+	ResponseHeaders ResponseHeadersConfig `yaml:"response_headers"`
+
+	// CORS answers preflight requests and adds CORS headers at the agent
+	CORS CORSConfig `yaml:"cors"`
+
+	// JWT validates a bearer token on every request before it is forwarded
+	JWT JWTConfig `yaml:"jwt"`
+
+	// GeoIP maps client IPs to countries for backend access policies
+	GeoIP GeoIPConfig `yaml:"geoip"`
+
+	// Quota caps the monthly requests and bandwidth of the tunnel
+	Quota QuotaConfig `yaml:"quota"`
+
+	// ResponseLimits protects the agent from misbehaving local services
+	ResponseLimits ResponseLimitsConfig `yaml:"response_limits"`
+
+	// Socket tunes the TCP socket of the connection to Core
+	Socket SocketConfig `yaml:"socket"`
+
+	// Memory caps the payload buffered by the agent
+	Memory MemoryConfig `yaml:"memory"`
+
+	// ErrorPolicy chooses what happens when handling a frame from Core fails
+	ErrorPolicy ErrorPolicyConfig `yaml:"error_policy"`
+
+	// Schedule limits the whole tunnel to time windows; backends can have
+	// their own schedule
+	Schedule ScheduleConfig `yaml:"schedule"`
+
+	// Unmatched answers requests that match no backend
+	Unmatched UnmatchedConfig `yaml:"unmatched"`
+
+	// Secrets configures the secret managers of vault:, aws-sm: and gcp-sm:
+	// secret references
+	Secrets SecretsConfig `yaml:"secrets"`
+}
+
+// SecretsConfig configures external secret managers. Secrets are fetched at
+// startup and re-fetched every Refresh to pick up rotation.
+type SecretsConfig struct {
+	// Refresh is the interval between re-fetches (default 5m, negative disables)
+	Refresh time.Duration `yaml:"refresh"`
+	Vault   VaultConfig   `yaml:"vault"`
+	AWS     AWSConfig     `yaml:"aws"`
+	GCP     GCPConfig     `yaml:"gcp"`
+}
+
+// VaultConfig reads vault:<path>#<field> references from a KV v2 engine
+type VaultConfig struct {
+	// Address of the Vault server; empty disables the provider
+	Address   string `yaml:"address"`
+	Namespace string `yaml:"namespace"`
+	// Mount of the KV v2 engine (default secret)
+	Mount string `yaml:"mount"`
+	// Token is a keyring:, env: or file: reference to the Vault token
+	// (default env:VAULT_TOKEN); file: is re-read on every fetch
+	Token string `yaml:"token"`
+}
+
+// AWSConfig reads aws-sm:<secret id>[#<json key>] references from AWS
+// Secrets Manager with the AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY
+// credentials of the environment
+type AWSConfig struct {
+	// Region of Secrets Manager (default AWS_REGION)
+	Region string `yaml:"region"`
+	// Endpoint overrides the regional endpoint (VPC endpoints, LocalStack)
+	Endpoint string `yaml:"endpoint"`
+}
+
+// GCPConfig reads gcp-sm:<secret>[#<version>] references from GCP Secret
+// Manager with the service account of the metadata server
+type GCPConfig struct {
+	// Project holding secrets given by short name
+	Project string `yaml:"project"`
+}
+
+// UnmatchedConfig replaces the default backend with a rendered response for
+// requests that match no backend host or path
+type UnmatchedConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Status code of the response (default 404)
+	Status int `yaml:"status"`
+	// ContentType of the response (default text/html; charset=utf-8)
+	ContentType string `yaml:"content_type"`
+	// Template is a Go template with .Agent, .Host, .Path and .Routes;
+	// empty uses a landing page listing the routes
+	Template string `yaml:"template"`
+}
+
+// ScheduleConfig exposes a tunnel or backend only during weekly windows such
+// as "Mon-Fri 09:00-18:00". No windows means always active.
+type ScheduleConfig struct {
+	// Windows are "[days] HH:MM-HH:MM" entries; days are Mon..Sun, comma
+	// separated or as ranges, and an end before the start spans midnight
+	Windows []string `yaml:"windows,omitempty"`
+	// Timezone is an IANA name (Europe/Berlin), empty uses local time
+	Timezone string `yaml:"timezone,omitempty"`
+	// Outside is what happens outside the windows: maintenance (default)
+	// answers requests with 503, close disconnects the tunnel. close is only
+	// allowed for the tunnel schedule.
+	Outside string `yaml:"outside,omitempty"`
+}
+
+// Schedule parses the windows; nil means always active
+func (s ScheduleConfig) Schedule() (*schedule.Schedule, error) {
+	return schedule.Parse(s.Windows, s.Timezone)
+}
+
+// MemoryConfig caps the payload buffered in stream queues and the send queue.
+// Above the cap the agent refuses new streams and uses smaller chunks until
+// usage drops below 80% of the cap.
+type MemoryConfig struct {
+	// MaxBuffered is the cap in bytes: 0 uses the default of 256 MiB, a
+	// negative value disables the cap
+	MaxBuffered int64 `yaml:"max_buffered"`
+}
+
+// ErrorPolicyConfig sets the action for each class of frame handling error:
+// log (continue with the next frame), reset (reset the frame's stream) or
+// disconnect (drop the connection and reconnect). Empty keeps the default.
+type ErrorPolicyConfig struct {
+	// Transient errors affect a single frame (default log)
+	Transient string `yaml:"transient"`
+	// Stream errors make the frame's stream unusable (default reset)
+	Stream string `yaml:"stream"`
+	// Connection errors make the connection unusable (default disconnect)
+	Connection string `yaml:"connection"`
+}
+
+// SocketConfig tunes the TCP socket of the connection to Core
+type SocketConfig struct {
+	// NoDelay sends frames immediately (TCP_NODELAY); disabling it lets Nagle
+	// batch small frames on slow links. Defaults to true.
+	NoDelay bool `yaml:"no_delay"`
+	// SendBuffer and ReceiveBuffer are socket buffer sizes in bytes, 0 keeps the OS default
+	SendBuffer    int `yaml:"send_buffer"`
+	ReceiveBuffer int `yaml:"receive_buffer"`
+	// DSCP marks packets with a class name (EF, AF41, CS1, ...) or a number 0-63
+	DSCP string `yaml:"dscp"`
+}
+
+// dscpClasses maps DSCP class names to code points
+var dscpClasses = map[string]int{
+	"CS0": 0, "CS1": 8, "CS2": 16, "CS3": 24, "CS4": 32, "CS5": 40, "CS6": 48, "CS7": 56,
+	"AF11": 10, "AF12": 12, "AF13": 14,
+	"AF21": 18, "AF22": 20, "AF23": 22,
+	"AF31": 26, "AF32": 28, "AF33": 30,
+	"AF41": 34, "AF42": 36, "AF43": 38,
+	"EF": 46, "VA": 44, "LE": 1,
+}
+
+// ParseDSCP converts a DSCP class name or number to its code point; empty is 0
+func ParseDSCP(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if code, ok := dscpClasses[strings.ToUpper(value)]; ok {
+		return code, nil
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil || code < 0 || code > 63 {
+		return 0, fmt.Errorf("%q is not a DSCP class (EF, AF11-AF43, CS0-CS7, VA, LE) or a number between 0 and 63", value)
+	}
+	return code, nil
+}
+
+// ResponseLimitsConfig limits the responses of local services. Zero uses the
+// default; a negative value disables the limit.
+type ResponseLimitsConfig struct {
+	// MaxHeaderBytes defaults to 1 MiB
+	MaxHeaderBytes int64 `yaml:"max_header_bytes"`
+	// MaxHeaders defaults to 100
+	MaxHeaders int `yaml:"max_headers"`
+	// MaxDecompressedSize caps gzip bodies after decompression, default 100 MiB
+	MaxDecompressedSize int64 `yaml:"max_decompressed_size"`
+	// HeaderTimeout bounds the wait for response headers
+	HeaderTimeout time.Duration `yaml:"header_timeout"`
+	// ReadTimeout bounds the total time spent reading the body
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// IdleTimeout bounds how long a single body read may stall
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+}
+
+// JWTConfig validates JWTs at the agent. Requests without a valid token get
+// 401; selected claims are forwarded to the local service as headers.
+type JWTConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// JWKSURL is the JSON Web Key Set of the issuer
+	JWKSURL string `yaml:"jwks_url"`
+	// Issuer is the required iss claim, empty skips the check
+	Issuer string `yaml:"issuer"`
+	// Audience lists accepted aud values, empty skips the check
+	Audience []string `yaml:"audience"`
+	// ClaimHeaders maps claims to request headers, e.g. sub: X-User-Id
+	ClaimHeaders map[string]string `yaml:"claim_headers"`
+	// Leeway tolerates clock skew on exp and nbf (default 1m)
+	Leeway time.Duration `yaml:"leeway"`
+	// CacheTTL is how long the JWKS is cached (default 1h)
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+}
+
+// CORSConfig configures CORS handling at the agent
+type CORSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// AllowedOrigins are full origins (https://app.example.com), subdomain
+	// wildcards (https://*.example.com) or "*"
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// AllowedMethods defaults to GET, HEAD, POST, PUT, PATCH and DELETE
+	AllowedMethods []string `yaml:"allowed_methods"`
+	// AllowedHeaders defaults to the headers requested by the browser
+	AllowedHeaders   []string      `yaml:"allowed_headers"`
+	ExposedHeaders   []string      `yaml:"exposed_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+// ResponseHeadersConfig modifies response headers in order: remove, the
+// security preset, set, add
+type ResponseHeadersConfig struct {
+	// Security adds HSTS, X-Content-Type-Options, X-Frame-Options and
+	// Referrer-Policy unless the local service already sets them
+	Security bool `yaml:"security"`
+	// Remove deletes headers such as Server or X-Powered-By
+	Remove []string `yaml:"remove"`
+	// Set overwrites headers
+	Set map[string]string `yaml:"set"`
+	// Add appends values to headers
+	Add map[string]string `yaml:"add"`
+}
+
+// ForwardingConfig configures X-Forwarded-*, X-Real-IP and Forwarded headers
+type ForwardingConfig struct {
+	// TrustClientHeaders keeps the values sent by public clients and appends
+	// the client IP reported by Core. Only enable it when every client is a
+	// trusted proxy; by default client values are replaced.
+	TrustClientHeaders bool `yaml:"trust_client_headers"`
+
+	// DisableAgentHeaders stops adding the Via header and the User-Agent
+	// suffix that identify requests coming through the tunnel
+	DisableAgentHeaders bool `yaml:"disable_agent_headers"`
+
+	// UserAgent is appended to the client's User-Agent; empty uses
+	// tunnel-agent/<version> with the agent ID
+	UserAgent string `yaml:"user_agent"`
+}
+
+// BackendConfig is a local service selected by the original Host/SNI and
+// path prefix
+type BackendConfig struct {
+	// Host is a subdomain label (api), a hostname (api.example.com),
+	// a wildcard (*.example.com) or empty for the default backend
+	Host string `yaml:"host,omitempty"`
+	// Path is the public path prefix served by this backend (e.g. /service-a);
+	// empty matches every path
+	Path string `yaml:"path,omitempty"`
+	// URL of the local service, or mqtt://[user:pass@]host:port/topic to
+	// bridge requests to an MQTT broker
+	URL string `yaml:"url,omitempty"`
+	// HostHeader sent to the local service: empty or "preserve" keeps the
+	// original host, "rewrite" uses the host of URL, any other value is sent
+	// as is
+	HostHeader string `yaml:"host_header,omitempty"`
+	// Connection controls reuse of connections to the local service: reuse
+	// (default) keeps them alive, close sends Connection: close, fresh opens
+	// a new connection for every stream through a dedicated transport
+	Connection string `yaml:"connection,omitempty"`
+	// Rewrite rules applied to the path before building the local URL
+	Rewrite RewriteConfig `yaml:"rewrite,omitempty"`
+	// Transform modifies headers and JSON bodies with Go templates
+	Transform TransformConfig `yaml:"transform,omitempty"`
+	// Schedule answers with a maintenance response outside its windows
+	Schedule ScheduleConfig `yaml:"schedule,omitempty"`
+	// MQTT tunes the broker bridge of mqtt:// backends
+	MQTT MQTTConfig `yaml:"mqtt,omitempty"`
+	// Auth holds credentials the agent presents to the local service
+	Auth BackendAuthConfig `yaml:"auth,omitempty"`
+	// RateLimit answers 429 when the route exceeds its request rate
+	RateLimit RateLimitConfig `yaml:"rate_limit,omitempty"`
+	// Access answers 403 to clients outside the allowed countries or hours
+	Access AccessConfig `yaml:"access,omitempty"`
+	// Webhook rejects requests whose HMAC signature does not match the body
+	Webhook WebhookConfig `yaml:"webhook,omitempty"`
+	// Scan sends bodies to an external scanner that may block them
+	Scan ScanConfig `yaml:"scan,omitempty"`
+	// Latency delays every request of the route to rehearse a slow tunnel
+	Latency LatencyConfig `yaml:"latency,omitempty"`
+}
+
+// LatencyConfig injects artificial latency before each request of a route
+// is forwarded, for staging tests of how an app behaves behind a slow
+// tunnel. Each request waits delay ± jitter, uniformly distributed.
+type LatencyConfig struct {
+	// Delay added to every request, 0 with no jitter disables injection
+	Delay time.Duration `yaml:"delay,omitempty"`
+	// Jitter is the maximum random deviation from delay
+	Jitter time.Duration `yaml:"jitter,omitempty"`
+}
+
+// ScanConfig sends request and/or response bodies to an external scanner
+// (DLP, malware) before forwarding. The agent POSTs the body to URL; 2xx
+// allows it, 403 blocks it with a 403 to the client.
+type ScanConfig struct {
+	// URL of the scanner; empty disables scanning
+	URL       string `yaml:"url,omitempty"`
+	Requests  bool   `yaml:"requests,omitempty"`
+	Responses bool   `yaml:"responses,omitempty"`
+	// MinSize skips bodies smaller than this many bytes
+	MinSize int64 `yaml:"min_size,omitempty"`
+	// MaxSize is the largest body buffered for scanning (default 10 MiB)
+	MaxSize int64 `yaml:"max_size,omitempty"`
+	// Timeout of each scanner call (default 10s)
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// FailOpen forwards unscanned bodies when the scanner fails or the body
+	// exceeds max_size instead of answering 503
+	FailOpen bool `yaml:"fail_open,omitempty"`
+}
+
+// WebhookConfig verifies webhook signatures at the agent. The github and
+// stripe schemes preset the header and signature format; hmac takes them
+// from the fields below, which also override the presets.
+type WebhookConfig struct {
+	// Scheme is github, stripe or hmac; empty disables verification
+	Scheme string `yaml:"scheme,omitempty"`
+	// Secret is a secret reference, like the credentials of BackendAuthConfig
+	Secret string `yaml:"secret,omitempty"`
+	// Header carries the signature
+	Header string `yaml:"header,omitempty"`
+	// Algorithm is sha1, sha256 (default) or sha512
+	Algorithm string `yaml:"algorithm,omitempty"`
+	// Prefix precedes the signature in the header, e.g. "sha256="
+	Prefix string `yaml:"prefix,omitempty"`
+	// Encoding is hex (default) or base64
+	Encoding string `yaml:"encoding,omitempty"`
+	// Tolerance is the maximum timestamp age for stripe (default 5m)
+	Tolerance time.Duration `yaml:"tolerance,omitempty"`
+	// MaxBody is the largest body verified, in bytes (default 1 MiB);
+	// larger bodies are answered with 413
+	MaxBody int64 `yaml:"max_body,omitempty"`
+}
+
+// AccessConfig restricts which clients may call a backend and when. The
+// client country comes from the geo metadata sent by Core, or from the
+// geoip table when Core sends none.
+type AccessConfig struct {
+	// AllowCountries are ISO 3166-1 alpha-2 codes; when set, clients from
+	// other or unknown countries are denied
+	AllowCountries []string `yaml:"allow_countries,omitempty"`
+	// DenyCountries are denied even if allowed
+	DenyCountries []string `yaml:"deny_countries,omitempty"`
+	// Hours are windows in the schedule format ("Mon-Fri 08:00-20:00")
+	// during which the backend accepts requests
+	Hours    []string `yaml:"hours,omitempty"`
+	Timezone string   `yaml:"timezone,omitempty"`
+}
+
+// Empty reports whether no access restriction is configured
+func (a AccessConfig) Empty() bool {
+	return len(a.AllowCountries) == 0 && len(a.DenyCountries) == 0 && len(a.Hours) == 0
+}
+
+// Schedule parses the hours; nil means any time
+func (a AccessConfig) Schedule() (*schedule.Schedule, error) {
+	return schedule.Parse(a.Hours, a.Timezone)
+}
+
+// GeoIPConfig configures the local IP-to-country lookup
+type GeoIPConfig struct {
+	// File is a CSV of "network,country" lines (203.0.113.0/24,VN) with
+	// non-overlapping networks
+	File string `yaml:"file"`
+}
+
+// QuotaConfig caps the monthly usage of the tunnel. Usage is persisted in
+// File so restarts keep counting; a new calendar month starts from zero.
+// Requests over the quota are answered with 429 until the month ends.
+type QuotaConfig struct {
+	// Requests is the monthly request cap, 0 means unlimited
+	Requests int64 `yaml:"requests"`
+	// Bytes caps request plus response bytes per month, 0 means unlimited
+	Bytes int64 `yaml:"bytes"`
+	// Timezone defines month boundaries (IANA name, default UTC)
+	Timezone string `yaml:"timezone"`
+	// File stores the usage (default: <user config dir>/tunnel-agent/<tunnel-name>.quota)
+	File string `yaml:"file"`
+}
+
+// Enabled reports whether a cap is configured
+func (q QuotaConfig) Enabled() bool {
+	return q.Requests > 0 || q.Bytes > 0
+}
+
+// RateLimitConfig is a token bucket limiting the requests of a route
+type RateLimitConfig struct {
+	// Rate is the sustained rate in requests per second, 0 disables the limit
+	Rate float64 `yaml:"rate,omitempty"`
+	// Burst is the number of requests allowed at once (default: rate)
+	Burst int `yaml:"burst,omitempty"`
+}
+
+// BackendAuthConfig holds credentials the agent presents to a locked-down
+// local service. Bearer and Password are secret references rather than plain
+// values: keyring:<account> reads the OS keyring (stored with
+// `agent login -account <account>`), env:<NAME> or ${NAME} reads an
+// environment variable and file:<path> reads a mounted secret file.
+type BackendAuthConfig struct {
+	// Bearer is sent as Authorization: Bearer <token>
+	Bearer string `yaml:"bearer,omitempty"`
+	// Username and Password are sent as HTTP basic auth
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	// ClientCert and ClientKey are PEM files presented for mTLS
+	ClientCert string `yaml:"client_cert,omitempty"`
+	ClientKey  string `yaml:"client_key,omitempty"`
+	// CA is a PEM bundle verifying the local service certificate; empty
+	// uses the system roots
+	CA string `yaml:"ca,omitempty"`
+}
+
+// Empty reports whether no credentials are configured
+func (a BackendAuthConfig) Empty() bool {
+	return a == BackendAuthConfig{}
+}
+
+// envVarName matches the variable of a ${NAME} secret reference
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// maxSecretFileSize caps file:<path> secrets; larger files are not secrets
+const maxSecretFileSize = 64 << 10
+
+// secretSources are the accepted sources of secret references; vault, aws-sm
+// and gcp-sm are served by the secret managers of SecretsConfig
+var secretSources = []string{"keyring", "env", "file", "vault", "aws-sm", "gcp-sm"}
+
+// ParseSecretRef splits a secret reference into its source and name:
+// keyring:<account>, env:<NAME>, ${NAME} (source env), file:<absolute path>,
+// vault:<path>#<field>, aws-sm:<secret id>[#<json key>] or
+// gcp-sm:<secret>[#<version>]
+func ParseSecretRef(ref string) (source, name string, err error) {
+	if strings.HasPrefix(ref, "${") {
+		name, ok := strings.CutSuffix(ref[2:], "}")
+		if !ok || !envVarName.MatchString(name) {
+			return "", "", fmt.Errorf("%q is not a valid ${NAME} reference; NAME must be an environment variable name", ref)
+		}
+		return "env", name, nil
+	}
+	source, name, ok := strings.Cut(ref, ":")
+	if !ok || name == "" || !slices.Contains(secretSources, source) {
+		return "", "", fmt.Errorf("%q is not a secret reference; use keyring:<account>, env:<NAME>, ${NAME}, file:<path>, vault:<path>#<field>, aws-sm:<id> or gcp-sm:<secret>", ref)
+	}
+	switch source {
+	case "file":
+		if !filepath.IsAbs(name) {
+			return "", "", fmt.Errorf("%q must use an absolute path", ref)
+		}
+	case "vault":
+		if path, field, _ := strings.Cut(name, "#"); path == "" || field == "" {
+			return "", "", fmt.Errorf("%q must be vault:<path>#<field>", ref)
+		}
+	}
+	return source, name, nil
+}
+
+// ReadSecretFile reads a file:<path> secret. A single trailing newline, as
+// left by editors and `echo`, is dropped; an empty or oversized file is an
+// error so a missing mount never becomes an empty credential.
+func ReadSecretFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("secret file: %w", err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxSecretFileSize+1))
+	if err != nil {
+		return "", fmt.Errorf("secret file %s: %w", path, err)
+	}
+	if len(data) > maxSecretFileSize {
+		return "", fmt.Errorf("secret file %s is larger than %d bytes", path, maxSecretFileSize)
+	}
+	secret := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+	if secret == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return secret, nil
+}
+
+// MQTTConfig tunes an MQTT bridge backend. Each request is published as a
+// JSON envelope to the topic of the URL; the reply published to the
+// envelope's reply_to topic becomes the response body.
+type MQTTConfig struct {
+	// ClientID sent to the broker, empty generates a random one
+	ClientID string `yaml:"client_id,omitempty"`
+	// ReplyTimeout answers 504 when no reply arrives in time (default 30s)
+	ReplyTimeout time.Duration `yaml:"reply_timeout,omitempty"`
+	// MaxBody is the largest request body published, in bytes (default 1 MiB);
+	// larger requests are answered with 413
+	MaxBody int64 `yaml:"max_body,omitempty"`
+}
+
+// TransformConfig modifies the request sent to and the response received
+// from a backend
+type TransformConfig struct {
+	Request  MessageTransformConfig `yaml:"request,omitempty"`
+	Response MessageTransformConfig `yaml:"response,omitempty"`
+}
+
+// Empty reports whether no transformation is configured
+func (t TransformConfig) Empty() bool {
+	return t.Request.empty() && t.Response.empty()
+}
+
+// MessageTransformConfig modifies headers, then JSON body fields addressed by
+// dotted paths (user.id). Values are Go templates; see client.TransformData
+// for the available fields.
+type MessageTransformConfig struct {
+	SetHeaders    map[string]string `yaml:"set_headers,omitempty"`
+	RemoveHeaders []string          `yaml:"remove_headers,omitempty"`
+	SetJSON       map[string]string `yaml:"set_json,omitempty"`
+	RemoveJSON    []string          `yaml:"remove_json,omitempty"`
+}
+
+func (m MessageTransformConfig) empty() bool {
+	return len(m.SetHeaders) == 0 && len(m.RemoveHeaders) == 0 && len(m.SetJSON) == 0 && len(m.RemoveJSON) == 0
+}
+
+// RewriteConfig rewrites the request path in order: strip_prefix, regex,
+// add_prefix
+type RewriteConfig struct {
+	StripPrefix string `yaml:"strip_prefix,omitempty"`
+	// Regex is matched against the path and replaced with Replacement,
+	// which may reference groups as $1 or ${name}
+	Regex       string `yaml:"regex,omitempty"`
+	Replacement string `yaml:"replacement,omitempty"`
+	AddPrefix   string `yaml:"add_prefix,omitempty"`
+}
+
+// LoggingConfig configures log output
+type LoggingConfig struct {
+	// RedactPatterns are additional regular expressions whose matches are
+	// replaced with [REDACTED] in all log output
+	RedactPatterns []string `yaml:"redact_patterns"`
+
+	// SampleInterval enables collapsing of repetitive log messages when > 0
+	SampleInterval time.Duration `yaml:"sample_interval"`
+	// SampleBurst is the number of identical messages logged per interval
+	SampleBurst int `yaml:"sample_burst"`
+
+	// Sink is the log destination: stdout (default), syslog or journald
+	Sink string `yaml:"sink"`
+	// Syslog configures the syslog sink; Tag is also the journald identifier
+	Syslog SyslogConfig `yaml:"syslog"`
+}
+
+// SyslogConfig configures the syslog sink
+type SyslogConfig struct {
+	// Network and Address of a remote syslog daemon (e.g. udp, 10.0.0.5:514).
+	// Empty address means the local daemon.
+	Network  string `yaml:"network"`
+	Address  string `yaml:"address"`
+	Facility string `yaml:"facility"`
+	Tag      string `yaml:"tag"`
+}
+
+// Default returns an empty configuration
+func Default() *Config {
+	return &Config{
+		Socket: SocketConfig{NoDelay: true},
+	}
+}
+
+// Load reads and parses the YAML config file at path
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg := Default()
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate reports every invalid value in the configuration, naming the
+// offending YAML key and the accepted values
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Token != "" {
+		if _, _, err := ParseSecretRef(c.Token); err != nil {
+			invalid("token", "%v", err)
+		}
+	}
+	c.Secrets.validate(invalid)
+	if c.Logging.SampleInterval < 0 {
+		invalid("logging.sample_interval", "must not be negative, got %s", c.Logging.SampleInterval)
+	}
+	if c.Logging.SampleBurst < 0 {
+		invalid("logging.sample_burst", "must not be negative, got %d", c.Logging.SampleBurst)
+	}
+	switch c.Logging.Sink {
+	case "", "stdout", "syslog", "journald":
+	default:
+		invalid("logging.sink", "unknown sink %q, expected stdout, syslog or journald", c.Logging.Sink)
+	}
+	switch c.Logging.Syslog.Network {
+	case "", "udp", "tcp", "unix", "unixgram":
+	default:
+		invalid("logging.syslog.network", "unknown network %q, expected udp, tcp, unix or unixgram", c.Logging.Syslog.Network)
+	}
+	if c.Logging.Syslog.Network != "" && c.Logging.Syslog.Address == "" {
+		invalid("logging.syslog.network", "has no effect without logging.syslog.address; set the remote daemon address or remove the network")
+	}
+
+	for key, action := range map[string]string{
+		"error_policy.transient":  c.ErrorPolicy.Transient,
+		"error_policy.stream":     c.ErrorPolicy.Stream,
+		"error_policy.connection": c.ErrorPolicy.Connection,
+	} {
+		switch action {
+		case "", "log", "reset", "disconnect":
+		default:
+			invalid(key, "unknown action %q, expected log, reset or disconnect", action)
+		}
+	}
+
+	rates := []struct {
+		key  string
+		rate float64
+	}{
+		{"chaos.drop_rate", c.Chaos.DropRate},
+		{"chaos.corrupt_rate", c.Chaos.CorruptRate},
+		{"chaos.delay_rate", c.Chaos.DelayRate},
+		{"chaos.disconnect_rate", c.Chaos.DisconnectRate},
+	}
+	for _, r := range rates {
+		if r.rate < 0 || r.rate > 1 {
+			invalid(r.key, "must be a probability between 0 and 1, got %g", r.rate)
+		}
+	}
+	if c.Chaos.Delay < 0 {
+		invalid("chaos.delay", "must not be negative, got %s", c.Chaos.Delay)
+	}
+	if c.Chaos.DelayRate > 0 && c.Chaos.Delay == 0 {
+		invalid("chaos.delay", "must be set when chaos.delay_rate is greater than 0")
+	}
+
+	validateBackends(c.Backends, invalid)
+
+	for name, ip := range c.Hosts {
+		host := name
+		if h, port, err := net.SplitHostPort(name); err == nil {
+			if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+				invalid("hosts."+name, "port %q must be a number between 1 and 65535", port)
+			}
+			host = h
+		}
+		if host == "" || strings.ContainsAny(host, "*/ ") {
+			invalid("hosts."+name, "must be a hostname or host:port, e.g. api.internal or api.internal:8443")
+		}
+		if net.ParseIP(ip) == nil {
+			invalid("hosts."+name, "%q is not an IP address", ip)
+		}
+	}
+
+	if _, err := c.Schedule.Schedule(); err != nil {
+		invalid("schedule", "%v", err)
+	}
+
+	if c.Unmatched.Status != 0 && (c.Unmatched.Status < 200 || c.Unmatched.Status > 599) {
+		invalid("unmatched.status", "must be an HTTP status between 200 and 599, got %d", c.Unmatched.Status)
+	}
+	if strings.ContainsAny(c.Forwarding.UserAgent, "\r\n") {
+		invalid("forwarding.user_agent", "must not contain line breaks")
+	}
+	if strings.ContainsAny(c.Unmatched.ContentType, "\r\n") {
+		invalid("unmatched.content_type", "must not contain line breaks")
+	}
+	switch c.Schedule.Outside {
+	case "", "maintenance", "close":
+	default:
+		invalid("schedule.outside", "unknown value %q, expected maintenance or close", c.Schedule.Outside)
+	}
+
+	for _, name := range c.ResponseHeaders.Remove {
+		if !validHeaderName(name) {
+			invalid("response_headers.remove", "%q is not a valid header name", name)
+		}
+	}
+	for key, headers := range map[string]map[string]string{
+		"response_headers.set": c.ResponseHeaders.Set,
+		"response_headers.add": c.ResponseHeaders.Add,
+	} {
+		for name, value := range headers {
+			if !validHeaderName(name) {
+				invalid(key, "%q is not a valid header name", name)
+			}
+			if strings.ContainsAny(value, "\r\n") {
+				invalid(key+"."+name, "value must not contain line breaks")
+			}
+		}
+	}
+
+	if c.CORS.Enabled {
+		if len(c.CORS.AllowedOrigins) == 0 {
+			invalid("cors.allowed_origins", "is required when cors.enabled is true, e.g. [https://app.example.com]")
+		}
+		for _, origin := range c.CORS.AllowedOrigins {
+			if origin == "*" {
+				if c.CORS.AllowCredentials {
+					invalid("cors.allowed_origins", "\"*\" with cors.allow_credentials lets any site send credentialed requests; list the origins explicitly")
+				}
+				continue
+			}
+			u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+			if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+				invalid("cors.allowed_origins", "%q is not an origin; use scheme://host[:port], e.g. https://app.example.com", origin)
+			}
+		}
+		for _, method := range c.CORS.AllowedMethods {
+			if !validHeaderName(method) {
+				invalid("cors.allowed_methods", "%q is not a valid method", method)
+			}
+		}
+		for _, name := range append(append([]string(nil), c.CORS.AllowedHeaders...), c.CORS.ExposedHeaders...) {
+			if !validHeaderName(name) {
+				invalid("cors", "%q is not a valid header name", name)
+			}
+		}
+		if c.CORS.MaxAge < 0 {
+			invalid("cors.max_age", "must not be negative, got %s", c.CORS.MaxAge)
+		}
+	}
+
+	if c.JWT.Enabled {
+		if c.JWT.JWKSURL == "" {
+			invalid("jwt.jwks_url", "is required when jwt is enabled")
+		} else if err := ValidateServiceURL(c.JWT.JWKSURL); err != nil {
+			invalid("jwt.jwks_url", "%v", err)
+		}
+		for claim, name := range c.JWT.ClaimHeaders {
+			if !validHeaderName(name) {
+				invalid("jwt.claim_headers."+claim, "%q is not a valid header name", name)
+			}
+		}
+		if c.JWT.Leeway < 0 {
+			invalid("jwt.leeway", "must not be negative, got %s", c.JWT.Leeway)
+		}
+		if c.JWT.CacheTTL < 0 {
+			invalid("jwt.cache_ttl", "must not be negative, got %s", c.JWT.CacheTTL)
+		}
+	}
+
+	if c.Quota.Requests < 0 {
+		invalid("quota.requests", "must not be negative, got %d; use 0 for no cap", c.Quota.Requests)
+	}
+	if c.Quota.Bytes < 0 {
+		invalid("quota.bytes", "must not be negative, got %d; use 0 for no cap", c.Quota.Bytes)
+	}
+	if c.Quota.Timezone != "" {
+		if _, err := time.LoadLocation(c.Quota.Timezone); err != nil {
+			invalid("quota.timezone", "%v", err)
+		}
+	}
+
+	if c.Socket.SendBuffer < 0 {
+		invalid("socket.send_buffer", "must not be negative, got %d; use 0 for the OS default", c.Socket.SendBuffer)
+	}
+	if c.Socket.ReceiveBuffer < 0 {
+		invalid("socket.receive_buffer", "must not be negative, got %d; use 0 for the OS default", c.Socket.ReceiveBuffer)
+	}
+	if _, err := ParseDSCP(c.Socket.DSCP); err != nil {
+		invalid("socket.dscp", "%v", err)
+	}
+
+	for key, d := range map[string]time.Duration{
+		"response_limits.header_timeout": c.ResponseLimits.HeaderTimeout,
+		"response_limits.read_timeout":   c.ResponseLimits.ReadTimeout,
+		"response_limits.idle_timeout":   c.ResponseLimits.IdleTimeout,
+	} {
+		if d < 0 {
+			invalid(key, "must not be negative, got %s; use 0 to disable", d)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateBackends reports invalid values of backends through invalid
+func validateBackends(backends []BackendConfig, invalid func(key, format string, args ...any)) {
+	for i, b := range backends {
+		key := fmt.Sprintf("backends[%d]", i)
+		if err := ValidateHostPattern(b.Host); err != nil {
+			invalid(key+".host", "%v", err)
+		}
+		if IsBrokerURL(b.URL) {
+			if err := ValidateBrokerURL(b.URL); err != nil {
+				invalid(key+".url", "%v", err)
+			}
+		} else if err := ValidateServiceURL(b.URL); err != nil {
+			invalid(key+".url", "%v", err)
+		}
+		if b.MQTT.ReplyTimeout < 0 {
+			invalid(key+".mqtt.reply_timeout", "must not be negative, got %s", b.MQTT.ReplyTimeout)
+		}
+		if b.MQTT.MaxBody < 0 {
+			invalid(key+".mqtt.max_body", "must not be negative")
+		}
+		switch b.Connection {
+		case "", "reuse", "close", "fresh":
+		default:
+			invalid(key+".connection", "unknown value %q, expected reuse, close or fresh", b.Connection)
+		}
+		if strings.ContainsAny(b.HostHeader, " \t\r\n/") {
+			invalid(key+".host_header", "%q is not a valid host; use preserve, rewrite or a host such as app.internal", b.HostHeader)
+		}
+		paths := []struct {
+			key, value string
+		}{
+			{".path", b.Path},
+			{".rewrite.strip_prefix", b.Rewrite.StripPrefix},
+			{".rewrite.add_prefix", b.Rewrite.AddPrefix},
+		}
+		for _, p := range paths {
+			if p.value != "" && !strings.HasPrefix(p.value, "/") {
+				invalid(key+p.key, "%q must start with /, e.g. /service-a", p.value)
+			}
+		}
+		for kind, mt := range map[string]MessageTransformConfig{
+			".transform.request":  b.Transform.Request,
+			".transform.response": b.Transform.Response,
+		} {
+			for name := range mt.SetHeaders {
+				if !validHeaderName(name) {
+					invalid(key+kind+".set_headers", "%q is not a valid header name", name)
+				}
+			}
+			for _, name := range mt.RemoveHeaders {
+				if !validHeaderName(name) {
+					invalid(key+kind+".remove_headers", "%q is not a valid header name", name)
+				}
+			}
+			for path := range mt.SetJSON {
+				if !validJSONPath(path) {
+					invalid(key+kind+".set_json", "%q is not a valid path; use dotted field names, e.g. user.id", path)
+				}
+			}
+			for _, path := range mt.RemoveJSON {
+				if !validJSONPath(path) {
+					invalid(key+kind+".remove_json", "%q is not a valid path; use dotted field names, e.g. user.id", path)
+				}
+			}
+		}
+		if b.Rewrite.Regex != "" {
+			if _, err := regexp.Compile(b.Rewrite.Regex); err != nil {
+				invalid(key+".rewrite.regex", "%v", err)
+			}
+		} else if b.Rewrite.Replacement != "" {
+			invalid(key+".rewrite.replacement", "has no effect without rewrite.regex")
+		}
+		if _, err := b.Schedule.Schedule(); err != nil {
+			invalid(key+".schedule", "%v", err)
+		}
+		switch b.Schedule.Outside {
+		case "", "maintenance":
+		case "close":
+			invalid(key+".schedule.outside", "close applies to the whole tunnel; use the top-level schedule or maintenance")
+		default:
+			invalid(key+".schedule.outside", "unknown value %q, expected maintenance", b.Schedule.Outside)
+		}
+		validateBackendAuth(key+".auth", b, invalid)
+		validateWebhook(key+".webhook", b, invalid)
+		validateScan(key+".scan", b, invalid)
+		if b.RateLimit.Rate < 0 {
+			invalid(key+".rate_limit.rate", "must not be negative, got %g", b.RateLimit.Rate)
+		}
+		if b.RateLimit.Burst < 0 {
+			invalid(key+".rate_limit.burst", "must not be negative, got %d", b.RateLimit.Burst)
+		}
+		if b.RateLimit.Burst > 0 && b.RateLimit.Rate == 0 {
+			invalid(key+".rate_limit.burst", "has no effect without rate_limit.rate")
+		}
+		if b.Latency.Delay < 0 {
+			invalid(key+".latency.delay", "must not be negative, got %s", b.Latency.Delay)
+		}
+		if b.Latency.Jitter < 0 {
+			invalid(key+".latency.jitter", "must not be negative, got %s", b.Latency.Jitter)
+		} else if b.Latency.Jitter > b.Latency.Delay && b.Latency.Delay >= 0 {
+			invalid(key+".latency.jitter", "must not exceed latency.delay (%s), got %s", b.Latency.Delay, b.Latency.Jitter)
+		}
+		for _, country := range b.Access.AllowCountries {
+			if !validCountry(country) {
+				invalid(key+".access.allow_countries", "%q is not a two-letter ISO 3166-1 country code, e.g. VN", country)
+			}
+		}
+		for _, country := range b.Access.DenyCountries {
+			if !validCountry(country) {
+				invalid(key+".access.deny_countries", "%q is not a two-letter ISO 3166-1 country code, e.g. VN", country)
+			}
+		}
+		if _, err := b.Access.Schedule(); err != nil {
+			invalid(key+".access.hours", "%v", err)
+		}
+	}
+}
+
+// validate checks the secret manager settings
+func (s SecretsConfig) validate(invalid func(key, format string, args ...any)) {
+	if s.Vault.Address != "" {
+		if u, err := url.Parse(s.Vault.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("secrets.vault.address", "%q must be an http:// or https:// URL", s.Vault.Address)
+		}
+	}
+	if s.Vault.Token != "" {
+		source, _, err := ParseSecretRef(s.Vault.Token)
+		switch {
+		case err != nil:
+			invalid("secrets.vault.token", "%v", err)
+		case source != "keyring" && source != "env" && source != "file":
+			invalid("secrets.vault.token", "must be a keyring:, env: or file: reference, got %s:", source)
+		}
+	}
+	if s.AWS.Endpoint != "" {
+		if u, err := url.Parse(s.AWS.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("secrets.aws.endpoint", "%q must be an http:// or https:// URL", s.AWS.Endpoint)
+		}
+	}
+}
+
+// validateBackendAuth checks the credentials of backend b
+func validateBackendAuth(key string, b BackendConfig, invalid func(key, format string, args ...any)) {
+	a := b.Auth
+	if a.Empty() {
+		return
+	}
+	if IsBrokerURL(b.URL) {
+		invalid(key, "is not supported for broker backends; put the broker credentials in the URL")
+		return
+	}
+	if a.Bearer != "" && a.Username != "" {
+		invalid(key, "bearer and username are mutually exclusive")
+	}
+	if a.Bearer != "" {
+		if _, _, err := ParseSecretRef(a.Bearer); err != nil {
+			invalid(key+".bearer", "%v", err)
+		}
+	}
+	if (a.Username == "") != (a.Password == "") {
+		invalid(key, "username and password must be set together")
+	}
+	if strings.Contains(a.Username, ":") {
+		invalid(key+".username", "must not contain ':'")
+	}
+	if a.Password != "" {
+		if _, _, err := ParseSecretRef(a.Password); err != nil {
+			invalid(key+".password", "%v", err)
+		}
+	}
+	if (a.ClientCert == "") != (a.ClientKey == "") {
+		invalid(key, "client_cert and client_key must be set together")
+	}
+	if (a.ClientCert != "" || a.CA != "") && !strings.HasPrefix(strings.ToLower(b.URL), "https://") {
+		invalid(key, "client_cert and ca need an https:// backend URL")
+	}
+}
+
+// validateWebhook checks the signature verification of backend b
+func validateWebhook(key string, b BackendConfig, invalid func(key, format string, args ...any)) {
+	w := b.Webhook
+	if w == (WebhookConfig{}) {
+		return
+	}
+	switch w.Scheme {
+	case "github", "stripe":
+	case "hmac":
+		if w.Header == "" {
+			invalid(key+".header", "is required for the hmac scheme")
+		}
+	case "":
+		invalid(key+".scheme", "is required; use github, stripe or hmac")
+	default:
+		invalid(key+".scheme", "%q is not supported; use github, stripe or hmac", w.Scheme)
+	}
+	if IsBrokerURL(b.URL) {
+		invalid(key, "is not supported for broker backends")
+	}
+	if _, _, err := ParseSecretRef(w.Secret); err != nil {
+		invalid(key+".secret", "%v", err)
+	}
+	if w.Header != "" && !validHeaderName(w.Header) {
+		invalid(key+".header", "%q is not a valid header name", w.Header)
+	}
+	if w.Algorithm != "" && w.Algorithm != "sha1" && w.Algorithm != "sha256" && w.Algorithm != "sha512" {
+		invalid(key+".algorithm", "%q is not supported; use sha1, sha256 or sha512", w.Algorithm)
+	}
+	if w.Encoding != "" && w.Encoding != "hex" && w.Encoding != "base64" {
+		invalid(key+".encoding", "%q is not supported; use hex or base64", w.Encoding)
+	}
+	if w.Tolerance < 0 {
+		invalid(key+".tolerance", "must not be negative")
+	}
+	if w.MaxBody < 0 {
+		invalid(key+".max_body", "must not be negative")
+	}
+}
+
+// validateScan checks the content scan of backend b
+func validateScan(key string, b BackendConfig, invalid func(key, format string, args ...any)) {
+	s := b.Scan
+	if s == (ScanConfig{}) {
+		return
+	}
+	if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		invalid(key+".url", "%q must be an http:// or https:// URL", s.URL)
+	}
+	if IsBrokerURL(b.URL) {
+		invalid(key, "is not supported for broker backends")
+	}
+	if !s.Requests && !s.Responses {
+		invalid(key, "set requests, responses or both")
+	}
+	if s.MinSize < 0 {
+		invalid(key+".min_size", "must not be negative")
+	}
+	if s.MaxSize < 0 {
+		invalid(key+".max_size", "must not be negative")
+	}
+	if s.MaxSize > 0 && s.MinSize > s.MaxSize {
+		invalid(key+".min_size", "must not exceed max_size")
+	}
+	if s.Timeout < 0 {
+		invalid(key+".timeout", "must not be negative")
+	}
+}
+
+// validCountry reports whether code is a two-letter country code
+func validCountry(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, r := range code {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// validJSONPath reports whether path is a dotted path without empty fields
+func validJSONPath(path string) bool {
+	for _, field := range strings.Split(path, ".") {
+		if field == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// validHeaderName reports whether name is a non-empty HTTP token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateHostPattern checks a backend host pattern: a subdomain label, a
+// hostname or a wildcard whose only '*' is the leading label
+func ValidateHostPattern(pattern string) error {
+	name := strings.TrimPrefix(pattern, "*.")
+	if strings.Contains(name, "*") {
+		return fmt.Errorf("invalid host %q: '*' is only allowed as the first label, e.g. *.example.com", pattern)
+	}
+	if strings.ContainsAny(name, ":/ ") {
+		return fmt.Errorf("invalid host %q: use a hostname without scheme, port or path", pattern)
+	}
+	if name == "" && pattern != "" {
+		return fmt.Errorf("invalid host %q: wildcard needs a domain, e.g. *.example.com", pattern)
+	}
+	return nil
+}
+
+// ValidateServiceURL checks that rawURL is an absolute http(s) URL of a
+// local service
+func ValidateServiceURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL must start with http:// or https://, e.g. http://localhost:8080")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("URL has no host, e.g. http://localhost:8080")
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+	}
+	return nil
+}
+
+// IsBrokerURL reports whether rawURL points to a message broker rather than
+// an HTTP service
+func IsBrokerURL(rawURL string) bool {
+	scheme, _, _ := strings.Cut(rawURL, "://")
+	switch strings.ToLower(scheme) {
+	case "mqtt", "amqp", "amqps":
+		return true
+	}
+	return false
+}
+
+// ValidateBrokerURL checks a broker backend URL: mqtt://[user:pass@]host:port/topic
+func ValidateBrokerURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	if u.Scheme != "mqtt" {
+		return fmt.Errorf("%s brokers are not supported, use mqtt:// (RabbitMQ can expose AMQP queues over its MQTT plugin)", u.Scheme)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return fmt.Errorf("URL needs host and port, e.g. mqtt://localhost:1883/devices/cmd")
+	}
+	if n, err := strconv.Atoi(u.Port()); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", u.Port())
+	}
+	topic := strings.TrimPrefix(u.Path, "/")
+	if topic == "" {
+		return fmt.Errorf("URL has no topic, e.g. mqtt://localhost:1883/devices/cmd")
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("topic %q must not contain wildcards", topic)
+	}
+	return nil
+}
+
+// ChaosConfig configures fault injection. Never enable it in production.
+type ChaosConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Probabilities in [0, 1], evaluated per frame
+	DropRate       float64       `yaml:"drop_rate"`
+	CorruptRate    float64       `yaml:"corrupt_rate"`
+	DelayRate      float64       `yaml:"delay_rate"`
+	Delay          time.Duration `yaml:"delay"`
+	DisconnectRate float64       `yaml:"disconnect_rate"`
+
+	// IncludeControl also drops/corrupts auth and heartbeat frames
+	IncludeControl bool `yaml:"include_control"`
+	// Seed makes fault sequences reproducible (0 = random)
+	Seed int64 `yaml:"seed"`
+}
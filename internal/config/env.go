@@ -0,0 +1,199 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of environment variables bound to flags and
+// config file fields
+const EnvPrefix = "TUNNEL_AGENT_"
+
+// LookupFunc looks up an environment variable (os.LookupEnv in production)
+type LookupFunc func(key string) (string, bool)
+
+// EnvName returns the environment variable bound to a flag name or config
+// path, e.g. "read-timeout" -> TUNNEL_AGENT_READ_TIMEOUT and
+// "logging.sample_burst" -> TUNNEL_AGENT_LOGGING_SAMPLE_BURST
+func EnvName(key string) string {
+	return EnvPrefix + legacyEnvName(key)
+}
+
+// legacyEnvName returns the unprefixed variable name for key
+func legacyEnvName(key string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+}
+
+// BindFlags sets every flag of fs that was not given on the command line from
+// its TUNNEL_AGENT_* environment variable. Flags listed in legacy also honor
+// the unprefixed variable (e.g. SERVER) when the prefixed one is unset.
+// Values are parsed by the flag itself, so durations, ints and bools are
+// validated; all invalid values are reported together.
+func BindFlags(fs *flag.FlagSet, lookup LookupFunc, legacy []string) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	legacySet := make(map[string]bool, len(legacy))
+	for _, name := range legacy {
+		legacySet[name] = true
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] {
+			return
+		}
+
+		name := EnvName(f.Name)
+		value, ok := lookup(name)
+		if !ok && legacySet[f.Name] {
+			name = legacyEnvName(f.Name)
+			value, ok = lookup(name)
+		}
+		if !ok || value == "" {
+			return
+		}
+
+		if err := fs.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value %q for -%s: %s", name, value, f.Name, expectedFormat(f.Value, err)))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// expectedFormat describes the value a flag accepts, falling back to err for
+// custom flag types
+func expectedFormat(v flag.Value, err error) string {
+	getter, ok := v.(flag.Getter)
+	if !ok {
+		return err.Error()
+	}
+	switch getter.Get().(type) {
+	case time.Duration:
+		return "expected a duration such as 30s or 5m"
+	case bool:
+		return "expected true or false"
+	case int, int64, uint, uint64:
+		return "expected an integer"
+	case float64:
+		return "expected a number"
+	default:
+		return err.Error()
+	}
+}
+
+// unwrapNumError strips the strconv.NumError wrapping, keeping the cause
+func unwrapNumError(err error) error {
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		return numErr.Err
+	}
+	return err
+}
+
+// ApplyEnv overrides config fields from TUNNEL_AGENT_* environment variables
+// named after their YAML path, e.g. logging.sample_burst is set by
+// TUNNEL_AGENT_LOGGING_SAMPLE_BURST. Lists are comma-separated.
+func (c *Config) ApplyEnv(lookup LookupFunc) error {
+	var errs []error
+	applyEnv(reflect.ValueOf(c).Elem(), "", lookup, &errs)
+	return errors.Join(errs...)
+}
+
+// applyEnv walks the struct v and sets fields with a matching variable
+func applyEnv(v reflect.Value, path string, lookup LookupFunc, errs *[]error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := tag
+		if path != "" {
+			key = path + "." + tag
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			applyEnv(fv, key, lookup, errs)
+			continue
+		}
+
+		name := EnvName(key)
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := setField(fv, value); err != nil {
+			*errs = append(*errs, fmt.Errorf("%s: invalid value %q for %s: %w", name, value, key, err))
+		}
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setField parses value into fv according to its type
+func setField(fv reflect.Value, value string) error {
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return unwrapNumError(err)
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return unwrapNumError(err)
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return unwrapNumError(err)
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return unwrapNumError(err)
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", fv.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+func lookupFrom(env map[string]string) LookupFunc {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	if got := EnvName("read-timeout"); got != "TUNNEL_AGENT_READ_TIMEOUT" {
+		t.Errorf("EnvName(read-timeout) = %q", got)
+	}
+	if got := EnvName("logging.sample_burst"); got != "TUNNEL_AGENT_LOGGING_SAMPLE_BURST" {
+		t.Errorf("EnvName(logging.sample_burst) = %q", got)
+	}
+}
+
+func TestBindFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	server := fs.String("server", "localhost:8443", "")
+	heartbeat := fs.Duration("heartbeat", 10*time.Second, "")
+	metrics := fs.Bool("metrics", false, "")
+	port := fs.Int("metrics-port", 9091, "")
+	token := fs.String("token", "", "")
+	if err := fs.Parse([]string{"-token=from-flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := BindFlags(fs, lookupFrom(map[string]string{
+		"SERVER":                    "legacy:1",
+		"TUNNEL_AGENT_SERVER":       "core:8443",
+		"TUNNEL_AGENT_HEARTBEAT":    "5s",
+		"METRICS":                   "true",
+		"TUNNEL_AGENT_METRICS_PORT": "9100",
+		"TUNNEL_AGENT_TOKEN":        "from-env",
+	}), []string{"server", "metrics", "token"})
+	if err != nil {
+		t.Fatalf("BindFlags: %v", err)
+	}
+
+	if *server != "core:8443" {
+		t.Errorf("server = %q, prefixed variable should win over legacy", *server)
+	}
+	if *heartbeat != 5*time.Second {
+		t.Errorf("heartbeat = %v, want 5s", *heartbeat)
+	}
+	if !*metrics {
+		t.Error("metrics should be set from legacy METRICS")
+	}
+	if *port != 9100 {
+		t.Errorf("metrics-port = %d, want 9100", *port)
+	}
+	if *token != "from-flag" {
+		t.Errorf("token = %q, command-line flag should win over env", *token)
+	}
+}
+
+func TestBindFlags_ReportsInvalidValues(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Duration("heartbeat", 10*time.Second, "")
+	fs.Bool("metrics", false, "")
+	fs.Parse(nil)
+
+	err := BindFlags(fs, lookupFrom(map[string]string{
+		"TUNNEL_AGENT_HEARTBEAT": "10",
+		"TUNNEL_AGENT_METRICS":   "yes please",
+	}), nil)
+	if err == nil {
+		t.Fatal("expected error for invalid values")
+	}
+	for _, want := range []string{"TUNNEL_AGENT_HEARTBEAT", "TUNNEL_AGENT_METRICS"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %s", err, want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	cfg := Default()
+	err := cfg.ApplyEnv(lookupFrom(map[string]string{
+		"TUNNEL_AGENT_CAPABILITIES":            "http-forward, exec",
+		"TUNNEL_AGENT_LOGGING_SAMPLE_INTERVAL": "1m",
+		"TUNNEL_AGENT_LOGGING_SAMPLE_BURST":    "3",
+		"TUNNEL_AGENT_LOGGING_SYSLOG_TAG":      "edge",
+		"TUNNEL_AGENT_CHAOS_ENABLED":           "true",
+		"TUNNEL_AGENT_CHAOS_DROP_RATE":         "0.25",
+	}))
+	if err != nil {
+		t.Fatalf("ApplyEnv: %v", err)
+	}
+
+	if len(cfg.Capabilities) != 2 || cfg.Capabilities[1] != "exec" {
+		t.Errorf("Capabilities = %v", cfg.Capabilities)
+	}
+	if cfg.Logging.SampleInterval != time.Minute || cfg.Logging.SampleBurst != 3 {
+		t.Errorf("sampling = %v/%d", cfg.Logging.SampleInterval, cfg.Logging.SampleBurst)
+	}
+	if cfg.Logging.Syslog.Tag != "edge" {
+		t.Errorf("Syslog.Tag = %q", cfg.Logging.Syslog.Tag)
+	}
+	if !cfg.Chaos.Enabled || cfg.Chaos.DropRate != 0.25 {
+		t.Errorf("Chaos = %+v", cfg.Chaos)
+	}
+}
+
+func TestApplyEnv_ReportsInvalidValues(t *testing.T) {
+	cfg := Default()
+	err := cfg.ApplyEnv(lookupFrom(map[string]string{
+		"TUNNEL_AGENT_CHAOS_SEED": "abc",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "chaos.seed") {
+		t.Errorf("expected error mentioning chaos.seed, got %v", err)
+	}
+}
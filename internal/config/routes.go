@@ -0,0 +1,74 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Route table formats
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// RouteTable is the routing table of a running agent: every backend with its
+// host, path and per-backend settings, in the same schema as the backends
+// key of the config file
+type RouteTable struct {
+	// Default is the local service for requests that match no backend. An
+	// imported table without it keeps the current default.
+	Default  string          `yaml:"default,omitempty"`
+	Backends []BackendConfig `yaml:"backends"`
+}
+
+// ParseRouteTable parses a route table in YAML or JSON. Unknown keys are
+// rejected so that typos do not silently drop settings.
+func ParseRouteTable(data []byte) (*RouteTable, error) {
+	var rt RouteTable
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&rt); err != nil {
+		return nil, fmt.Errorf("failed to parse route table: %w", err)
+	}
+	return &rt, nil
+}
+
+// Validate reports every invalid backend of the table
+func (rt *RouteTable) Validate() error {
+	var errs []error
+	if rt.Default != "" {
+		if err := ValidateServiceURL(rt.Default); err != nil {
+			errs = append(errs, fmt.Errorf("default: %v", err))
+		}
+	}
+	validateBackends(rt.Backends, func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	})
+	return errors.Join(errs...)
+}
+
+// Marshal encodes the table as FormatYAML or FormatJSON, leaving out unset
+// settings
+func (rt *RouteTable) Marshal(format string) ([]byte, error) {
+	out, err := yaml.Marshal(rt)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatYAML:
+		return out, nil
+	case FormatJSON:
+		// Going through YAML keeps the YAML key names and duration strings
+		var v any
+		if err := yaml.Unmarshal(out, &v); err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(v, "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected yaml or json", format)
+	}
+}
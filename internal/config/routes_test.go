@@ -0,0 +1,64 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouteTable_RoundTrip(t *testing.T) {
+	rt := &RouteTable{Default: "http://localhost:3000", Backends: []BackendConfig{
+		{Host: "api", Path: "/v1", URL: "http://localhost:8080", Rewrite: RewriteConfig{StripPrefix: "/v1"}},
+		{Host: "iot", URL: "mqtt://localhost:1883/cmd", MQTT: MQTTConfig{ReplyTimeout: 5 * time.Second}},
+	}}
+
+	for _, format := range []string{FormatYAML, FormatJSON} {
+		data, err := rt.Marshal(format)
+		if err != nil {
+			t.Fatalf("Marshal(%s) failed: %v", format, err)
+		}
+		if strings.Contains(string(data), "host_header") {
+			t.Errorf("%s output should leave out unset settings:\n%s", format, data)
+		}
+
+		parsed, err := ParseRouteTable(data)
+		if err != nil {
+			t.Fatalf("ParseRouteTable(%s) failed: %v\n%s", format, err, data)
+		}
+		if parsed.Default != "http://localhost:3000" ||
+			len(parsed.Backends) != 2 ||
+			parsed.Backends[0].Rewrite.StripPrefix != "/v1" ||
+			parsed.Backends[1].MQTT.ReplyTimeout != 5*time.Second {
+			t.Errorf("%s round trip mismatch: %+v", format, parsed.Backends)
+		}
+	}
+
+	if _, err := rt.Marshal("toml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestParseRouteTable_RejectsUnknownKeys(t *testing.T) {
+	if _, err := ParseRouteTable([]byte("backends:\n  - host: api\n    ulr: http://localhost:8080\n")); err == nil {
+		t.Error("expected error for unknown key")
+	}
+}
+
+func TestRouteTable_Validate(t *testing.T) {
+	rt := &RouteTable{Default: "localhost:3000", Backends: []BackendConfig{
+		{Host: "api", URL: "http://localhost:8080"},
+		{Host: "bad host", URL: "localhost"},
+	}}
+	err := rt.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, key := range []string{"default:", "backends[1].host:", "backends[1].url:"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error should mention %s, got:\n%v", key, err)
+		}
+	}
+	if strings.Contains(err.Error(), "backends[0]") {
+		t.Errorf("backend 0 is valid, got:\n%v", err)
+	}
+}
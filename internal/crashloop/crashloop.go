@@ -0,0 +1,114 @@
+// Package crashloop detects restart storms. Every start is appended to a
+// small state file and clean exits clear it, so many starts within a short
+// window mean a supervisor (systemd Restart=always, a Kubernetes restart
+// policy) keeps restarting an agent that exits on errors. The caller delays
+// startup with an exponential backoff instead of hammering Core.
+package crashloop
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Options configures crash-loop detection
+type Options struct {
+	// Path of the state file holding recent start times
+	Path string
+
+	// Starts within Window at which the agent is considered crash-looping
+	Starts int
+	Window time.Duration
+
+	// BaseDelay is the startup delay at the threshold, doubled for every
+	// further start (default 10s)
+	BaseDelay time.Duration
+
+	// MaxDelay caps the startup delay (default 5m)
+	MaxDelay time.Duration
+}
+
+// Result describes the start history after recording a start
+type Result struct {
+	// Starts is the number of starts within the window, including this one
+	Starts int
+	// Looping reports whether Starts reached the threshold
+	Looping bool
+	// Delay is how long to wait before starting, 0 when not looping
+	Delay time.Duration
+}
+
+// state is the JSON content of the state file
+type state struct {
+	Starts []time.Time `json:"starts"`
+}
+
+// RecordStart appends now to the start history, drops starts older than the
+// window and computes the startup delay. A missing or unreadable state file
+// is treated as an empty history.
+func RecordStart(opts Options, now time.Time) (Result, error) {
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = 10 * time.Second
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = 5 * time.Minute
+	}
+
+	var st state
+	if data, err := os.ReadFile(opts.Path); err == nil {
+		json.Unmarshal(data, &st)
+	}
+
+	recent := []time.Time{}
+	for _, t := range st.Starts {
+		if now.Sub(t) < opts.Window && !t.After(now) {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+
+	res := Result{Starts: len(recent)}
+	if opts.Starts > 0 && res.Starts >= opts.Starts {
+		res.Looping = true
+		res.Delay = backoff(res.Starts-opts.Starts, opts.BaseDelay, opts.MaxDelay)
+	}
+	return res, write(opts.Path, state{Starts: recent})
+}
+
+// Clear removes the start history after a clean exit
+func Clear(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// backoff returns base doubled n times, capped at max
+func backoff(n int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 0; i < n && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// write replaces the state file atomically
+func write(path string, st state) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,69 @@
+package crashloop
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordStart(t *testing.T) {
+	opts := Options{
+		Path:      filepath.Join(t.TempDir(), "state", "starts.json"),
+		Starts:    3,
+		Window:    time.Minute,
+		BaseDelay: time.Second,
+		MaxDelay:  3 * time.Second,
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	want := []Result{
+		{Starts: 1},
+		{Starts: 2},
+		{Starts: 3, Looping: true, Delay: time.Second},
+		{Starts: 4, Looping: true, Delay: 2 * time.Second},
+		{Starts: 5, Looping: true, Delay: 3 * time.Second}, // capped
+	}
+	for i, w := range want {
+		got, err := RecordStart(opts, now.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatalf("RecordStart failed: %v", err)
+		}
+		if got != w {
+			t.Errorf("start %d: got %+v, want %+v", i+1, got, w)
+		}
+	}
+
+	// Starts older than the window no longer count
+	got, _ := RecordStart(opts, now.Add(2*time.Minute))
+	if got.Starts != 1 || got.Looping {
+		t.Errorf("after window: got %+v, want a single start", got)
+	}
+}
+
+func TestClear(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "starts.json")
+	opts := Options{Path: path, Starts: 2, Window: time.Hour}
+	now := time.Now()
+
+	RecordStart(opts, now)
+	if err := Clear(path); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if err := Clear(path); err != nil {
+		t.Errorf("Clear of a missing file should succeed, got %v", err)
+	}
+	if got, _ := RecordStart(opts, now); got.Starts != 1 {
+		t.Errorf("history should be empty after Clear, got %+v", got)
+	}
+}
+
+func TestRecordStart_CorruptState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "starts.json")
+	os.WriteFile(path, []byte("not json"), 0o600)
+
+	got, err := RecordStart(Options{Path: path, Starts: 2, Window: time.Hour}, time.Now())
+	if err != nil || got.Starts != 1 {
+		t.Errorf("corrupt state should be ignored, got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,158 @@
+// Package diag builds diagnostics bundles for support tickets.
+package diag
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	"github.com/hydragon2m/tunnel-agent/internal/metrics"
+)
+
+// Provider returns the content of one file in the bundle
+type Provider func() ([]byte, error)
+
+var (
+	providers   = make(map[string]Provider)
+	providersMu sync.RWMutex
+)
+
+// Register adds a named file provider to every bundle (e.g. "streams.json").
+// Providers must not return secrets; use logger.Redact for free text.
+func Register(name string, provider Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = provider
+}
+
+// JSON is a helper Provider that encodes the result of fn as indented JSON
+func JSON(fn func() any) Provider {
+	return func() ([]byte, error) {
+		return json.MarshalIndent(fn(), "", "  ")
+	}
+}
+
+// WriteBundle writes a timestamped tar.gz bundle into dir and returns its path
+func WriteBundle(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("tunnel-agent-diag-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+	path := filepath.Join(dir, name)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	for _, file := range collect() {
+		hdr := &tar.Header{
+			Name:    file.name,
+			Mode:    0o600,
+			Size:    int64(len(file.data)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return "", err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return path, f.Close()
+}
+
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+// collect gathers built-in and registered bundle files
+func collect() []bundleFile {
+	files := []bundleFile{
+		{name: "goroutines.txt", data: goroutineDump()},
+		{name: "runtime.json", data: mustJSON(runtimeInfo())},
+		{name: "metrics.json", data: mustJSON(metrics.GetMetrics().GetSnapshot())},
+		{name: "logs.txt", data: []byte(strings.Join(logger.RecentLogs(), "\n") + "\n")},
+	}
+
+	providersMu.RLock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := providers[name]()
+		if err != nil {
+			data = []byte(fmt.Sprintf("error collecting %s: %v\n", name, err))
+		}
+		files = append(files, bundleFile{name: name, data: data})
+	}
+	providersMu.RUnlock()
+
+	return files
+}
+
+// goroutineDump returns stacks of all goroutines
+func goroutineDump() []byte {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+		return []byte(fmt.Sprintf("error: %v\n", err))
+	}
+	return buf.Bytes()
+}
+
+// runtimeInfo returns Go runtime statistics
+func runtimeInfo() map[string]any {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	hostname, _ := os.Hostname()
+	return map[string]any{
+		"time":        time.Now().UTC(),
+		"hostname":    hostname,
+		"pid":         os.Getpid(),
+		"go_version":  runtime.Version(),
+		"os":          runtime.GOOS,
+		"arch":        runtime.GOARCH,
+		"num_cpu":     runtime.NumCPU(),
+		"goroutines":  runtime.NumGoroutine(),
+		"heap_alloc":  mem.HeapAlloc,
+		"heap_sys":    mem.HeapSys,
+		"num_gc":      mem.NumGC,
+		"total_alloc": mem.TotalAlloc,
+	}
+}
+
+// mustJSON encodes v as indented JSON, embedding the error on failure
+func mustJSON(v any) []byte {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return []byte(fmt.Sprintf(`{"error": %q}`, err.Error()))
+	}
+	return data
+}
@@ -14,13 +14,31 @@ const (
 	HealthStatusUnhealthy HealthStatus = "unhealthy"
 )
 
+// maxHistory is the number of status transitions kept per check
+const maxHistory = 10
+
+// Transition is a status change of a check
+type Transition struct {
+	Status  HealthStatus `json:"status"`
+	Message string       `json:"message"`
+	Time    time.Time    `json:"time"`
+}
+
 // Check represents a health check
 type Check struct {
 	Name      string
 	Status    HealthStatus
 	Message   string
 	LastCheck time.Time
-	mu        sync.RWMutex
+
+	// Since is when the check entered its current status
+	Since time.Time
+	// LastError is the most recent non-healthy message and when it was reported
+	LastError     string
+	LastErrorTime time.Time
+
+	history []Transition // oldest first, at most maxHistory entries
+	mu      sync.RWMutex
 }
 
 // HealthChecker manages health checks
@@ -45,10 +63,12 @@ func (hc *HealthChecker) RegisterCheck(name string) *Check {
 	hc.mu.Lock()
 	defer hc.mu.Unlock()
 
+	now := time.Now()
 	check := &Check{
 		Name:      name,
 		Status:    HealthStatusHealthy,
-		LastCheck: time.Now(),
+		LastCheck: now,
+		Since:     now,
 	}
 
 	hc.checks[name] = check
@@ -69,9 +89,59 @@ func (c *Check) UpdateCheck(status HealthStatus, message string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	now := time.Now()
+	if status != c.Status {
+		c.Since = now
+		c.history = append(c.history, Transition{Status: status, Message: message, Time: now})
+		if len(c.history) > maxHistory {
+			c.history = append([]Transition(nil), c.history[len(c.history)-maxHistory:]...)
+		}
+	}
+	if status != HealthStatusHealthy {
+		c.LastError = message
+		c.LastErrorTime = now
+	}
+
 	c.Status = status
 	c.Message = message
-	c.LastCheck = time.Now()
+	c.LastCheck = now
+}
+
+// History returns recent status transitions, oldest first
+func (c *Check) History() []Transition {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]Transition(nil), c.history...)
+}
+
+// CheckSnapshot is a point-in-time copy of a check
+type CheckSnapshot struct {
+	Name          string       `json:"name"`
+	Status        HealthStatus `json:"status"`
+	Message       string       `json:"message"`
+	LastCheck     time.Time    `json:"last_check"`
+	Since         time.Time    `json:"since"`
+	LastError     string       `json:"last_error,omitempty"`
+	LastErrorTime time.Time    `json:"last_error_time"`
+	History       []Transition `json:"history"`
+}
+
+// Snapshot returns a copy of the check state including history
+func (c *Check) Snapshot() CheckSnapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return CheckSnapshot{
+		Name:          c.Name,
+		Status:        c.Status,
+		Message:       c.Message,
+		LastCheck:     c.LastCheck,
+		Since:         c.Since,
+		LastError:     c.LastError,
+		LastErrorTime: c.LastErrorTime,
+		History:       append([]Transition(nil), c.history...),
+	}
 }
 
 // GetStatus returns check status
@@ -0,0 +1,56 @@
+package health
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCheck_RecordsTransitions(t *testing.T) {
+	hc := &HealthChecker{checks: make(map[string]*Check)}
+	check := hc.RegisterCheck("connection")
+
+	check.UpdateCheck(HealthStatusHealthy, "Connected")
+	check.UpdateCheck(HealthStatusUnhealthy, "dial tcp: connection refused")
+	check.UpdateCheck(HealthStatusUnhealthy, "dial tcp: i/o timeout")
+	check.UpdateCheck(HealthStatusHealthy, "Connected")
+
+	history := check.History()
+	if len(history) != 2 {
+		t.Fatalf("expected 2 transitions (same status is not a transition), got %d: %+v", len(history), history)
+	}
+	if history[0].Status != HealthStatusUnhealthy || history[0].Message != "dial tcp: connection refused" {
+		t.Errorf("unexpected first transition: %+v", history[0])
+	}
+	if history[1].Status != HealthStatusHealthy {
+		t.Errorf("unexpected second transition: %+v", history[1])
+	}
+
+	snap := check.Snapshot()
+	if snap.LastError != "dial tcp: i/o timeout" {
+		t.Errorf("LastError = %q, want latest non-healthy message", snap.LastError)
+	}
+	if !snap.Since.Equal(history[1].Time) {
+		t.Errorf("Since = %v, want time of last transition %v", snap.Since, history[1].Time)
+	}
+}
+
+func TestCheck_HistoryIsBounded(t *testing.T) {
+	hc := &HealthChecker{checks: make(map[string]*Check)}
+	check := hc.RegisterCheck("link")
+
+	for i := 0; i < maxHistory*2; i++ {
+		status := HealthStatusDegraded
+		if i%2 == 1 {
+			status = HealthStatusHealthy
+		}
+		check.UpdateCheck(status, fmt.Sprintf("update %d", i))
+	}
+
+	history := check.History()
+	if len(history) != maxHistory {
+		t.Fatalf("expected %d transitions, got %d", maxHistory, len(history))
+	}
+	if last := history[len(history)-1].Message; last != fmt.Sprintf("update %d", maxHistory*2-1) {
+		t.Errorf("expected newest transition last, got %q", last)
+	}
+}
@@ -0,0 +1,44 @@
+// Package keyring stores secrets in the operating system credential store:
+// Keychain on macOS, Secret Service (secret-tool) on Linux and DPAPI-protected
+// files on Windows.
+package keyring
+
+import (
+	"errors"
+	"strings"
+)
+
+// Service is the service name used for agent secrets
+const Service = "tunnel-agent"
+
+// DefaultAccount is the account name used when none is configured
+const DefaultAccount = "default"
+
+var (
+	// ErrNotFound is returned when no secret is stored for the account
+	ErrNotFound = errors.New("secret not found in keyring")
+	// ErrUnsupported is returned on platforms without a supported keyring
+	ErrUnsupported = errors.New("keyring is not supported on this platform")
+)
+
+// Set stores secret for service/account, replacing any existing value
+func Set(service, account, secret string) error {
+	if secret == "" {
+		return errors.New("secret must not be empty")
+	}
+	return set(service, account, secret)
+}
+
+// Get returns the secret stored for service/account
+func Get(service, account string) (string, error) {
+	secret, err := get(service, account)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(secret, "\r\n"), nil
+}
+
+// Delete removes the secret stored for service/account
+func Delete(service, account string) error {
+	return del(service, account)
+}
@@ -0,0 +1,51 @@
+//go:build darwin
+
+package keyring
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// securityNotFoundExit is the exit code of `security` when the item doesn't exist
+const securityNotFoundExit = 44
+
+func set(service, account, secret string) error {
+	// Use interactive mode so the secret is passed via stdin, not argv
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		quote(service), quote(account), quote(secret)))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("keychain store failed: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func get(service, account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == securityNotFoundExit {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("keychain lookup failed: %w", err)
+	}
+	return string(out), nil
+}
+
+func del(service, account string) error {
+	err := exec.Command("security", "delete-generic-password", "-s", service, "-a", account).Run()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == securityNotFoundExit {
+			return ErrNotFound
+		}
+		return fmt.Errorf("keychain delete failed: %w", err)
+	}
+	return nil
+}
+
+// quote quotes a value for `security -i` command parsing
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
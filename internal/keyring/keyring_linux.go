@@ -0,0 +1,50 @@
+//go:build linux
+
+package keyring
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Linux uses the freedesktop Secret Service through secret-tool (libsecret)
+
+func set(service, account, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", service+" ("+account+")",
+		"service", service, "account", account)
+	// secret-tool reads the secret from stdin
+	cmd.Stdin = strings.NewReader(secret)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret service store failed: %w: %s", wrapExecErr(err), bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func get(service, account string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", service, "account", account).Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			// secret-tool exits 1 without output when the item doesn't exist
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("secret service lookup failed: %w", wrapExecErr(err))
+	}
+	return string(out), nil
+}
+
+func del(service, account string) error {
+	if err := exec.Command("secret-tool", "clear", "service", service, "account", account).Run(); err != nil {
+		return fmt.Errorf("secret service delete failed: %w", wrapExecErr(err))
+	}
+	return nil
+}
+
+// wrapExecErr maps a missing secret-tool binary to ErrUnsupported
+func wrapExecErr(err error) error {
+	if _, ok := err.(*exec.Error); ok {
+		return fmt.Errorf("%w (secret-tool not installed)", ErrUnsupported)
+	}
+	return err
+}
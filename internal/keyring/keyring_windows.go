@@ -0,0 +1,109 @@
+//go:build windows
+
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// Windows stores secrets as DPAPI-encrypted files under %APPDATA%\tunnel-agent.
+// DPAPI binds the ciphertext to the current user account.
+
+var (
+	crypt32                = syscall.NewLazyDLL("crypt32.dll")
+	kernel32               = syscall.NewLazyDLL("kernel32.dll")
+	procCryptProtectData   = crypt32.NewProc("CryptProtectData")
+	procCryptUnprotectData = crypt32.NewProc("CryptUnprotectData")
+	procLocalFree          = kernel32.NewProc("LocalFree")
+)
+
+type dataBlob struct {
+	size uint32
+	data *byte
+}
+
+func newBlob(d []byte) *dataBlob {
+	if len(d) == 0 {
+		return &dataBlob{}
+	}
+	return &dataBlob{size: uint32(len(d)), data: &d[0]}
+}
+
+func (b *dataBlob) bytes() []byte {
+	out := make([]byte, b.size)
+	copy(out, unsafe.Slice(b.data, b.size))
+	return out
+}
+
+func set(service, account, secret string) error {
+	var out dataBlob
+	r, _, err := procCryptProtectData.Call(
+		uintptr(unsafe.Pointer(newBlob([]byte(secret)))), 0, 0, 0, 0, 0,
+		uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return fmt.Errorf("DPAPI encrypt failed: %w", err)
+	}
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(out.data)))
+
+	path, err := secretPath(service, account)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out.bytes(), 0o600)
+}
+
+func get(service, account string) (string, error) {
+	path, err := secretPath(service, account)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+
+	var out dataBlob
+	r, _, callErr := procCryptUnprotectData.Call(
+		uintptr(unsafe.Pointer(newBlob(encrypted))), 0, 0, 0, 0, 0,
+		uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return "", fmt.Errorf("DPAPI decrypt failed: %w", callErr)
+	}
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(out.data)))
+
+	return string(out.bytes()), nil
+}
+
+func del(service, account string) error {
+	path, err := secretPath(service, account)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// secretPath returns the DPAPI blob path for service/account
+func secretPath(service, account string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, service, account+".secret"), nil
+}
@@ -0,0 +1,123 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ANSI escape codes
+const (
+	ansiReset     = "\033[0m"
+	ansiBold      = "\033[1m"
+	ansiDim       = "\033[2m"
+	ansiUnderline = "\033[4m"
+	ansiRed       = "\033[31m"
+	ansiGreen     = "\033[32m"
+	ansiYellow    = "\033[33m"
+	ansiCyan      = "\033[36m"
+	ansiGray      = "\033[90m"
+)
+
+// highlightKeys are attributes rendered prominently in console mode
+var highlightKeys = map[string]bool{
+	"public_url": true,
+}
+
+// consoleWriter formats records for humans: relative timestamp, short
+// colored level, message and compact key=value attributes.
+//
+//	+1.204s INF Connected to server address=localhost:8443
+type consoleWriter struct {
+	out   io.Writer
+	start time.Time
+	color bool
+}
+
+// newConsoleWriter creates a console writer. Colors are disabled when
+// NO_COLOR is set (https://no-color.org).
+func newConsoleWriter(out io.Writer) *consoleWriter {
+	return &consoleWriter{
+		out:   out,
+		start: time.Now(),
+		color: os.Getenv("NO_COLOR") == "",
+	}
+}
+
+// write implements sinkWriter
+func (w *consoleWriter) write(record slog.Record, fields []field) error {
+	var b strings.Builder
+
+	elapsed := record.Time.Sub(w.start)
+	w.paint(&b, ansiGray, fmt.Sprintf("+%.3fs", elapsed.Seconds()))
+	b.WriteByte(' ')
+
+	level, levelColor := consoleLevel(record.Level)
+	w.paint(&b, levelColor+ansiBold, level)
+	b.WriteByte(' ')
+	b.WriteString(record.Message)
+
+	for _, f := range fields {
+		b.WriteByte(' ')
+		w.paint(&b, ansiDim, f.key+"=")
+		value := consoleValue(f.value)
+		switch {
+		case highlightKeys[f.key]:
+			w.paint(&b, ansiBold+ansiUnderline+ansiGreen, value)
+		case f.key == "error":
+			w.paint(&b, ansiRed, value)
+		default:
+			b.WriteString(value)
+		}
+	}
+	b.WriteByte('\n')
+
+	_, err := io.WriteString(w.out, b.String())
+	return err
+}
+
+// paint writes s wrapped in the given color when colors are enabled
+func (w *consoleWriter) paint(b *strings.Builder, color, s string) {
+	if !w.color {
+		b.WriteString(s)
+		return
+	}
+	b.WriteString(color)
+	b.WriteString(s)
+	b.WriteString(ansiReset)
+}
+
+// consoleLevel returns the short level label and its color
+func consoleLevel(level slog.Level) (string, string) {
+	switch {
+	case level >= slog.LevelError:
+		return "ERR", ansiRed
+	case level >= slog.LevelWarn:
+		return "WRN", ansiYellow
+	case level >= slog.LevelInfo:
+		return "INF", ansiCyan
+	default:
+		return "DBG", ansiGray
+	}
+}
+
+// consoleValue quotes values that would be ambiguous in key=value form
+func consoleValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// isTerminal reports whether f is a character device (an interactive terminal)
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// journaldSocket is the native journald protocol socket
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journaldWriter writes records using the native journald protocol,
+// keeping attributes as structured journal fields
+type journaldWriter struct {
+	conn       net.Conn
+	identifier string
+}
+
+// newJournaldWriter connects to the journald socket
+func newJournaldWriter(identifier string) (*journaldWriter, error) {
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return nil, err
+	}
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+	return &journaldWriter{conn: conn, identifier: identifier}, nil
+}
+
+// write implements sinkWriter
+func (w *journaldWriter) write(record slog.Record, fields []field) error {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", record.Message)
+	writeJournalField(&buf, "PRIORITY", strconv.Itoa(syslogSeverity(record.Level)))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", w.identifier)
+	for _, f := range fields {
+		writeJournalField(&buf, journalFieldName(f.key), f.value)
+	}
+
+	_, err := w.conn.Write(buf.Bytes())
+	return err
+}
+
+// writeJournalField encodes one field. Values containing newlines use the
+// binary form: NAME\n<little-endian uint64 length><value>\n
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(name)
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	buf.WriteString(name)
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalFieldName converts an attribute key to a valid journal field name:
+// uppercase ASCII letters, digits and underscores, not starting with '_'
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+
+	name = strings.TrimLeft(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "F_" + name
+	}
+	return name
+}
@@ -0,0 +1,126 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// levelVar is the level of every handler created by InitLoggerWithOptions;
+// changing it takes effect immediately without rebuilding the handlers
+var levelVar = new(slog.LevelVar)
+
+var (
+	levelMu sync.Mutex
+	// baseLevel is the configured level that SetLevel reverts to
+	baseLevel slog.Level
+	// revertTimer and revertAt are set while a temporary level is active
+	revertTimer *time.Timer
+	revertAt    time.Time
+)
+
+// LevelState describes the current log level
+type LevelState struct {
+	Level      string `json:"level"`
+	Configured string `json:"configured"`
+	// RevertAt is when the configured level is restored, nil when the
+	// current level is not temporary
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", level)
+	}
+}
+
+// setBaseLevel sets the configured level and cancels any temporary level
+func setBaseLevel(level slog.Level) {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	stopRevert()
+	baseLevel = level
+	levelVar.Set(level)
+}
+
+// SetLevel changes the level of the running logger. When d > 0 the
+// configured level is restored after d, so a level raised for debugging is
+// not left on forever; d = 0 keeps the new level until the next change.
+func SetLevel(level string, d time.Duration) error {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	stopRevert()
+	levelVar.Set(l)
+	if d > 0 && l != baseLevel {
+		revertAt = time.Now().Add(d)
+		var timer *time.Timer
+		timer = time.AfterFunc(d, func() {
+			levelMu.Lock()
+			if revertTimer != timer {
+				// Level changed again while this revert was firing
+				levelMu.Unlock()
+				return
+			}
+			revertTimer, revertAt = nil, time.Time{}
+			base := baseLevel
+			levelVar.Set(base)
+			levelMu.Unlock()
+			Info("Log level reverted", "level", levelName(base))
+		})
+		revertTimer = timer
+	}
+	return nil
+}
+
+// ResetLevel restores the configured level immediately
+func ResetLevel() {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	stopRevert()
+	levelVar.Set(baseLevel)
+}
+
+// Level returns the current level state
+func Level() LevelState {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	state := LevelState{
+		Level:      levelName(levelVar.Level()),
+		Configured: levelName(baseLevel),
+	}
+	if revertTimer != nil {
+		at := revertAt
+		state.RevertAt = &at
+	}
+	return state
+}
+
+// stopRevert cancels a pending revert; levelMu must be held
+func stopRevert() {
+	if revertTimer != nil {
+		revertTimer.Stop()
+	}
+	revertTimer, revertAt = nil, time.Time{}
+}
+
+// levelName returns the lowercase name of level
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSetLevel_Reverts(t *testing.T) {
+	setBaseLevel(slog.LevelInfo)
+	defer setBaseLevel(slog.LevelInfo)
+
+	if err := SetLevel("debug", 50*time.Millisecond); err != nil {
+		t.Fatalf("SetLevel failed: %v", err)
+	}
+	state := Level()
+	if state.Level != "debug" || state.Configured != "info" || state.RevertAt == nil {
+		t.Errorf("Unexpected state after SetLevel: %+v", state)
+	}
+	if !slog.New(slog.NewTextHandler(nil, &slog.HandlerOptions{Level: levelVar})).Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("debug should be enabled")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for Level().Level != "info" {
+		if time.Now().After(deadline) {
+			t.Fatal("level was not reverted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if Level().RevertAt != nil {
+		t.Error("RevertAt should be cleared after revert")
+	}
+}
+
+func TestSetLevel_Permanent(t *testing.T) {
+	setBaseLevel(slog.LevelInfo)
+	defer setBaseLevel(slog.LevelInfo)
+
+	SetLevel("warn", 0)
+	if state := Level(); state.Level != "warn" || state.RevertAt != nil {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+	ResetLevel()
+	if state := Level(); state.Level != "info" {
+		t.Errorf("ResetLevel should restore info, got %+v", state)
+	}
+
+	if err := SetLevel("verbose", 0); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
@@ -1,52 +1,153 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"time"
 )
 
 var (
 	// Default logger instance
 	defaultLogger *slog.Logger
+
+	// stopSampling stops the flush loop of the current sampling handler
+	stopSampling chan struct{}
+
+	// sinkConn is the connection of the current syslog/journald sink
+	sinkConn io.Closer
+)
+
+// Log sinks
+const (
+	SinkStdout   = "stdout"
+	SinkStderr   = "stderr"
+	SinkSyslog   = "syslog"
+	SinkJournald = "journald"
 )
 
+// Options configures the logger
+type Options struct {
+	Level string
+	JSON  bool
+
+	// SampleInterval enables sampling of repetitive messages when > 0:
+	// at most SampleBurst identical messages are logged per interval.
+	SampleInterval time.Duration
+	SampleBurst    int
+
+	// Sink selects the log destination: stdout (default), stderr, syslog or
+	// journald. stderr keeps stdout free for data, e.g. in pipe mode.
+	Sink   string
+	Syslog SyslogOptions
+
+	// Tunnel, when set, is added as tunnel=<name> to every line so the output
+	// of several agents can be told apart once merged
+	Tunnel string
+}
+
 // InitLogger khởi tạo structured logger
 func InitLogger(level string, json bool) {
-	var logLevel slog.Level
-	switch level {
-	case "debug":
-		logLevel = slog.LevelDebug
-	case "info":
-		logLevel = slog.LevelInfo
-	case "warn":
-		logLevel = slog.LevelWarn
-	case "error":
-		logLevel = slog.LevelError
-	default:
-		logLevel = slog.LevelInfo
-	}
+	// stdout sink không thể lỗi
+	_ = InitLoggerWithOptions(Options{Level: level, JSON: json})
+}
+
+// InitLoggerWithOptions khởi tạo structured logger với options
+func InitLoggerWithOptions(o Options) error {
+	// Unknown levels fall back to info
+	level, _ := ParseLevel(o.Level)
+	setBaseLevel(level)
+	logLevel := levelVar
 
 	opts := &slog.HandlerOptions{
 		Level: logLevel,
 	}
 
 	var handler slog.Handler
-	if json {
-		handler = slog.NewJSONHandler(os.Stdout, opts)
-	} else {
-		handler = slog.NewTextHandler(os.Stdout, opts)
+	var conn io.Closer
+	switch o.Sink {
+	case "", SinkStdout, SinkStderr:
+		out := os.Stdout
+		if o.Sink == SinkStderr {
+			out = os.Stderr
+		}
+		switch {
+		case o.JSON:
+			handler = slog.NewJSONHandler(out, opts)
+		case isTerminal(out):
+			// Developer console: colored, compact output
+			handler = newSinkHandler(newConsoleWriter(out), logLevel)
+		default:
+			handler = slog.NewTextHandler(out, opts)
+		}
+	case SinkSyslog:
+		w, err := newSyslogWriter(o.Syslog)
+		if err != nil {
+			return err
+		}
+		handler, conn = newSinkHandler(w, logLevel), w.conn
+	case SinkJournald:
+		w, err := newJournaldWriter(o.Syslog.Tag)
+		if err != nil {
+			return fmt.Errorf("failed to connect to journald: %w", err)
+		}
+		handler, conn = newSinkHandler(w, logLevel), w.conn
+	default:
+		return fmt.Errorf("unknown log sink %q", o.Sink)
 	}
 
+	// Keep recent lines in memory for diagnostics bundles
+	ring := slog.NewTextHandler(globalRing, opts)
+
+	handler = newRedactHandler(newMultiHandler(handler, ring), globalRedactor)
+
+	if stopSampling != nil {
+		close(stopSampling)
+		stopSampling = nil
+	}
+	if o.SampleInterval > 0 {
+		sampling := newSamplingHandler(handler, o.SampleInterval, o.SampleBurst)
+		stopSampling = make(chan struct{})
+		go flushLoop(sampling, o.SampleInterval, stopSampling)
+		handler = sampling
+	}
+
+	if sinkConn != nil {
+		sinkConn.Close()
+	}
+	sinkConn = conn
+
 	defaultLogger = slog.New(handler)
+	if o.Tunnel != "" {
+		defaultLogger = defaultLogger.With("tunnel", o.Tunnel)
+	}
+	return nil
+}
+
+// flushLoop periodically reports suppressed messages
+func flushLoop(h *samplingHandler, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			h.Flush()
+			return
+		case <-ticker.C:
+			h.Flush()
+		}
+	}
 }
 
 // GetLogger returns default logger
 func GetLogger() *slog.Logger {
 	if defaultLogger == nil {
 		// Fallback to default if not initialized
-		defaultLogger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		defaultLogger = slog.New(newRedactHandler(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 			Level: slog.LevelInfo,
-		}))
+		}), globalRedactor))
 	}
 	return defaultLogger
 }
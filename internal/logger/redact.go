@@ -0,0 +1,194 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redactedValue replaces secret values in log output
+const redactedValue = "[REDACTED]"
+
+// sensitiveKeys are attribute/header names whose values are always redacted
+var sensitiveKeys = []string{
+	"authorization",
+	"proxy-authorization",
+	"cookie",
+	"set-cookie",
+	"token",
+	"password",
+	"secret",
+	"api_key",
+	"api-key",
+	"x-api-key",
+	"x-tunnel-token",
+}
+
+// defaultRedactPatterns match common credential formats inside free text
+var defaultRedactPatterns = []string{
+	`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`,
+	`(?i)\b(token|access_token|password|secret|api_key|apikey)=[^&\s"]+`,
+}
+
+// Redactor removes secrets from strings, headers and log attributes
+type Redactor struct {
+	mu       sync.RWMutex
+	keys     map[string]bool
+	patterns []*regexp.Regexp
+}
+
+var globalRedactor = newDefaultRedactor()
+
+// newDefaultRedactor creates a Redactor with built-in keys and patterns
+func newDefaultRedactor() *Redactor {
+	r := &Redactor{keys: make(map[string]bool)}
+	for _, key := range sensitiveKeys {
+		r.keys[key] = true
+	}
+	for _, pattern := range defaultRedactPatterns {
+		r.patterns = append(r.patterns, regexp.MustCompile(pattern))
+	}
+	return r
+}
+
+// GetRedactor returns the global redactor
+func GetRedactor() *Redactor {
+	return globalRedactor
+}
+
+// AddRedactPatterns adds configured secret patterns (regular expressions)
+// to the global redactor
+func AddRedactPatterns(patterns []string) error {
+	return globalRedactor.AddPatterns(patterns)
+}
+
+// Redact redacts secrets in s using the global redactor
+func Redact(s string) string {
+	return globalRedactor.RedactString(s)
+}
+
+// AddPatterns compiles and adds secret patterns
+func (r *Redactor) AddPatterns(patterns []string) error {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, compiled...)
+	return nil
+}
+
+// IsSensitiveKey reports whether values under key must be redacted
+func (r *Redactor) IsSensitiveKey(key string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[strings.ToLower(key)]
+}
+
+// RedactString replaces every pattern match in s
+func (r *Redactor) RedactString(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, redactedValue)
+	}
+	return s
+}
+
+// RedactHeader returns a copy of h with sensitive header values redacted
+func (r *Redactor) RedactHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for key, values := range h {
+		if r.IsSensitiveKey(key) {
+			out[key] = []string{redactedValue}
+			continue
+		}
+		redacted := make([]string, len(values))
+		for i, v := range values {
+			redacted[i] = r.RedactString(v)
+		}
+		out[key] = redacted
+	}
+	return out
+}
+
+// RedactAttr redacts a log attribute
+func (r *Redactor) RedactAttr(attr slog.Attr) slog.Attr {
+	if r.IsSensitiveKey(attr.Key) {
+		return slog.String(attr.Key, redactedValue)
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, r.RedactString(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, a := range group {
+			redacted[i] = r.RedactAttr(a)
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case error:
+			return slog.String(attr.Key, r.RedactString(v.Error()))
+		case http.Header:
+			return slog.Any(attr.Key, r.RedactHeader(v))
+		case fmt.Stringer:
+			return slog.String(attr.Key, r.RedactString(v.String()))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// redactHandler is a slog.Handler that redacts secrets before delegating
+type redactHandler struct {
+	next     slog.Handler
+	redactor *Redactor
+}
+
+// newRedactHandler wraps next with secret redaction
+func newRedactHandler(next slog.Handler, redactor *Redactor) slog.Handler {
+	return &redactHandler{next: next, redactor: redactor}
+}
+
+// Enabled implements slog.Handler
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *redactHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, h.redactor.RedactString(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.redactor.RedactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+// WithAttrs implements slog.Handler
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = h.redactor.RedactAttr(attr)
+	}
+	return &redactHandler{next: h.next.WithAttrs(redacted), redactor: h.redactor}
+}
+
+// WithGroup implements slog.Handler
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{next: h.next.WithGroup(name), redactor: h.redactor}
+}
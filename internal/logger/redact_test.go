@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRedactor_RedactString(t *testing.T) {
+	r := newDefaultRedactor()
+
+	cases := map[string]string{
+		"Authorization: Bearer abc.def.ghi": "Authorization: [REDACTED]",
+		"GET /cb?token=s3cr3t&x=1":          "GET /cb?[REDACTED]&x=1",
+		"nothing to hide":                   "nothing to hide",
+	}
+	for in, want := range cases {
+		if got := r.RedactString(in); got != want {
+			t.Errorf("RedactString(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRedactor_CustomPatterns(t *testing.T) {
+	r := newDefaultRedactor()
+	if err := r.AddPatterns([]string{`sk_live_[A-Za-z0-9]+`}); err != nil {
+		t.Fatalf("AddPatterns failed: %v", err)
+	}
+	if got := r.RedactString("key sk_live_123abc used"); got != "key [REDACTED] used" {
+		t.Errorf("Custom pattern not applied: %q", got)
+	}
+	if err := r.AddPatterns([]string{"("}); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+}
+
+func TestRedactHandler(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(newRedactHandler(slog.NewTextHandler(&buf, nil), newDefaultRedactor()))
+
+	headers := http.Header{}
+	headers.Set("Cookie", "session=abc")
+	headers.Set("Accept", "text/html")
+
+	log.With("token", "t0k3n").Info("request",
+		"headers", headers,
+		"error", errors.New("dial failed: password=hunter2"),
+	)
+
+	out := buf.String()
+	for _, secret := range []string{"t0k3n", "session=abc", "hunter2"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Log output leaks %q: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "text/html") {
+		t.Errorf("Non-sensitive header should be kept: %s", out)
+	}
+}
@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// DefaultRingSize is the number of recent log lines kept in memory
+const DefaultRingSize = 1000
+
+// RingBuffer keeps the most recent log lines in memory for diagnostics
+type RingBuffer struct {
+	mu    sync.Mutex
+	lines [][]byte
+	next  int
+	full  bool
+}
+
+var globalRing = NewRingBuffer(DefaultRingSize)
+
+// NewRingBuffer creates a ring buffer holding up to size lines
+func NewRingBuffer(size int) *RingBuffer {
+	return &RingBuffer{lines: make([][]byte, size)}
+}
+
+// Write implements io.Writer. Each call is stored as one line.
+func (r *RingBuffer) Write(p []byte) (int, error) {
+	line := bytes.TrimRight(p, "\n")
+	stored := make([]byte, len(line))
+	copy(stored, line)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lines[r.next] = stored
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+	return len(p), nil
+}
+
+// Lines returns buffered lines, oldest first
+func (r *RingBuffer) Lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []string
+	if r.full {
+		for _, line := range r.lines[r.next:] {
+			out = append(out, string(line))
+		}
+	}
+	for _, line := range r.lines[:r.next] {
+		out = append(out, string(line))
+	}
+	return out
+}
+
+// RecentLogs returns the most recent log lines (already redacted)
+func RecentLogs() []string {
+	return globalRing.Lines()
+}
+
+// multiHandler fans out records to several handlers
+type multiHandler struct {
+	handlers []slog.Handler
+}
+
+// newMultiHandler creates a handler writing to all handlers
+func newMultiHandler(handlers ...slog.Handler) slog.Handler {
+	return &multiHandler{handlers: handlers}
+}
+
+// Enabled implements slog.Handler
+func (h *multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle implements slog.Handler
+func (h *multiHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, record.Level) {
+			if err := handler.Handle(ctx, record.Clone()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithAttrs implements slog.Handler
+func (h *multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return &multiHandler{handlers: handlers}
+}
+
+// WithGroup implements slog.Handler
+func (h *multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return &multiHandler{handlers: handlers}
+}
@@ -0,0 +1,139 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// samplingKey identifies repetitive messages: same level, message and error
+type samplingKey struct {
+	level slog.Level
+	msg   string
+	err   string
+}
+
+// samplingEntry tracks occurrences of a key within the current interval
+type samplingEntry struct {
+	windowStart time.Time
+	count       int
+	suppressed  int
+	last        slog.Record
+}
+
+// sampler is shared state between a samplingHandler and its derived handlers
+type sampler struct {
+	mu       sync.Mutex
+	entries  map[samplingKey]*samplingEntry
+	interval time.Duration
+	burst    int
+}
+
+// samplingHandler logs at most burst records per key and interval.
+// Suppressed records are summarized with a "repeated" counter when the
+// interval ends, so a flood of identical errors collapses to a few lines.
+type samplingHandler struct {
+	next    slog.Handler
+	sampler *sampler
+}
+
+// newSamplingHandler wraps next with log sampling
+func newSamplingHandler(next slog.Handler, interval time.Duration, burst int) *samplingHandler {
+	if burst < 1 {
+		burst = 1
+	}
+	return &samplingHandler{
+		next: next,
+		sampler: &sampler{
+			entries:  make(map[samplingKey]*samplingEntry),
+			interval: interval,
+			burst:    burst,
+		},
+	}
+}
+
+// Enabled implements slog.Handler
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *samplingHandler) Handle(ctx context.Context, record slog.Record) error {
+	key := samplingKey{level: record.Level, msg: record.Message}
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == "error" {
+			key.err = attr.Value.String()
+			return false
+		}
+		return true
+	})
+
+	s := h.sampler
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	if !ok || record.Time.Sub(entry.windowStart) >= s.interval {
+		// New interval: report what was suppressed in the previous one
+		var summary *slog.Record
+		if ok && entry.suppressed > 0 {
+			r := entry.last.Clone()
+			r.AddAttrs(slog.Int("repeated", entry.suppressed))
+			summary = &r
+		}
+		entry = &samplingEntry{windowStart: record.Time}
+		s.entries[key] = entry
+		if summary != nil {
+			s.mu.Unlock()
+			if err := h.next.Handle(ctx, *summary); err != nil {
+				return err
+			}
+			s.mu.Lock()
+		}
+	}
+
+	entry.count++
+	if entry.count > s.burst {
+		entry.suppressed++
+		entry.last = record.Clone()
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	return h.next.Handle(ctx, record)
+}
+
+// Flush logs summaries for intervals that ended without a new occurrence
+func (h *samplingHandler) Flush() {
+	s := h.sampler
+	now := time.Now()
+
+	s.mu.Lock()
+	var summaries []slog.Record
+	for key, entry := range s.entries {
+		if now.Sub(entry.windowStart) < s.interval {
+			continue
+		}
+		if entry.suppressed > 0 {
+			r := entry.last.Clone()
+			r.AddAttrs(slog.Int("repeated", entry.suppressed))
+			summaries = append(summaries, r)
+		}
+		delete(s.entries, key)
+	}
+	s.mu.Unlock()
+
+	for _, r := range summaries {
+		h.next.Handle(context.Background(), r)
+	}
+}
+
+// WithAttrs implements slog.Handler
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{next: h.next.WithAttrs(attrs), sampler: h.sampler}
+}
+
+// WithGroup implements slog.Handler
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{next: h.next.WithGroup(name), sampler: h.sampler}
+}
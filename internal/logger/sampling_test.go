@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSamplingHandler_CollapsesRepeats(t *testing.T) {
+	var buf bytes.Buffer
+	h := newSamplingHandler(slog.NewTextHandler(&buf, nil), time.Minute, 2)
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		r := slog.NewRecord(start.Add(time.Duration(i)*time.Millisecond), slog.LevelError, "Failed to forward request", 0)
+		r.AddAttrs(slog.String("error", "connection refused"))
+		h.Handle(context.Background(), r)
+	}
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 2 {
+		t.Fatalf("Expected 2 lines within interval, got %d: %s", lines, buf.String())
+	}
+
+	// Next interval reports the suppressed count
+	r := slog.NewRecord(start.Add(2*time.Minute), slog.LevelError, "Failed to forward request", 0)
+	r.AddAttrs(slog.String("error", "connection refused"))
+	h.Handle(context.Background(), r)
+
+	if !strings.Contains(buf.String(), "repeated=98") {
+		t.Errorf("Expected summary with repeated=98, got: %s", buf.String())
+	}
+}
+
+func TestSamplingHandler_DistinctErrorsNotSuppressed(t *testing.T) {
+	var buf bytes.Buffer
+	h := newSamplingHandler(slog.NewTextHandler(&buf, nil), time.Minute, 1)
+
+	for _, errMsg := range []string{"connection refused", "timeout", "EOF"} {
+		r := slog.NewRecord(time.Now(), slog.LevelWarn, "Frame read error", 0)
+		r.AddAttrs(slog.String("error", errMsg))
+		h.Handle(context.Background(), r)
+	}
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 3 {
+		t.Errorf("Expected 3 lines for distinct errors, got %d", lines)
+	}
+}
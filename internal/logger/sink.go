@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// field is a flattened key/value pair of a log record
+type field struct {
+	key   string
+	value string
+}
+
+// sinkWriter formats and writes a record with its flattened fields
+type sinkWriter interface {
+	write(record slog.Record, fields []field) error
+}
+
+// sinkHandler is a slog.Handler for non-slog outputs (console, syslog, journald).
+// It flattens attributes (groups become "group.key") and delegates
+// formatting to a sinkWriter.
+type sinkHandler struct {
+	level  slog.Leveler
+	writer sinkWriter
+	mu     *sync.Mutex
+	attrs  []field
+	group  string
+}
+
+// newSinkHandler creates a handler writing records to w
+func newSinkHandler(w sinkWriter, level slog.Leveler) *sinkHandler {
+	return &sinkHandler{level: level, writer: w, mu: &sync.Mutex{}}
+}
+
+// Enabled implements slog.Handler
+func (h *sinkHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle implements slog.Handler
+func (h *sinkHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := make([]field, len(h.attrs), len(h.attrs)+record.NumAttrs())
+	copy(fields, h.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		fields = appendFields(fields, h.group, attr)
+		return true
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.writer.write(record, fields)
+}
+
+// WithAttrs implements slog.Handler
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = append([]field(nil), h.attrs...)
+	for _, attr := range attrs {
+		next.attrs = appendFields(next.attrs, h.group, attr)
+	}
+	return &next
+}
+
+// WithGroup implements slog.Handler
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	next := *h
+	next.group = joinKey(h.group, name)
+	return &next
+}
+
+// appendFields flattens attr into fields
+func appendFields(fields []field, prefix string, attr slog.Attr) []field {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		for _, a := range value.Group() {
+			fields = appendFields(fields, joinKey(prefix, attr.Key), a)
+		}
+		return fields
+	}
+	if attr.Key == "" {
+		return fields
+	}
+	return append(fields, field{key: joinKey(prefix, attr.Key), value: fmt.Sprint(value.Any())})
+}
+
+// joinKey joins group prefix and key
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,96 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogHandler_RFC5424(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("udp not available: %v", err)
+	}
+	defer pc.Close()
+
+	w, err := newSyslogWriter(SyslogOptions{
+		Network:  "udp",
+		Address:  pc.LocalAddr().String(),
+		Facility: "local0",
+		Tag:      "agent",
+	})
+	if err != nil {
+		t.Fatalf("newSyslogWriter failed: %v", err)
+	}
+	defer w.conn.Close()
+
+	log := slog.New(newSinkHandler(w, slog.LevelInfo)).WithGroup("req")
+	log.Warn("slow request", "path", `/a"b]`)
+
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	msg := string(buf[:n])
+
+	// local0 (16) * 8 + warning (4)
+	if !strings.HasPrefix(msg, "<132>1 ") {
+		t.Errorf("Expected priority <132>, got %q", msg)
+	}
+	if !strings.Contains(msg, ` agent `) {
+		t.Errorf("Expected tag in header, got %q", msg)
+	}
+	if !strings.Contains(msg, `[tunnel@32473 req.path="/a\"b\]"] slow request`) {
+		t.Errorf("Unexpected structured data: %q", msg)
+	}
+}
+
+func TestJournald_FieldEncoding(t *testing.T) {
+	if got := journalFieldName("req.remote-addr"); got != "REQ_REMOTE_ADDR" {
+		t.Errorf("Expected REQ_REMOTE_ADDR, got %s", got)
+	}
+	if got := journalFieldName("_cursor"); got != "CURSOR" {
+		t.Errorf("Expected CURSOR, got %s", got)
+	}
+	if got := journalFieldName("1st"); got != "F_1ST" {
+		t.Errorf("Expected F_1ST, got %s", got)
+	}
+
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", "line1\nline2")
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("MESSAGE\n")) {
+		t.Fatalf("Expected binary field form, got %q", data)
+	}
+	size := binary.LittleEndian.Uint64(data[len("MESSAGE\n"):])
+	if size != uint64(len("line1\nline2")) {
+		t.Errorf("Expected size %d, got %d", len("line1\nline2"), size)
+	}
+}
+
+func TestConsoleWriter_Format(t *testing.T) {
+	var buf bytes.Buffer
+	w := newConsoleWriter(&buf)
+	w.color = false
+
+	log := slog.New(newSinkHandler(w, slog.LevelInfo))
+	log.Info("Authentication successful", "public_url", "https://a.example.com", "note", "two words")
+	log.Debug("hidden")
+
+	line := buf.String()
+	if !strings.HasPrefix(line, "+") {
+		t.Errorf("Expected relative timestamp, got %q", line)
+	}
+	if !strings.Contains(line, ` INF Authentication successful public_url=https://a.example.com note="two words"`) {
+		t.Errorf("Unexpected console line: %q", line)
+	}
+	if strings.Contains(line, "hidden") {
+		t.Errorf("Debug record should be filtered: %q", line)
+	}
+}
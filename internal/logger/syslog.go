@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// syslogEnterpriseID is used in RFC5424 structured data IDs (example PEN)
+const syslogEnterpriseID = 32473
+
+// Syslog facilities (RFC5424 section 6.2.1)
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogOptions configures the syslog sink
+type SyslogOptions struct {
+	// Network and Address of the syslog daemon. Empty means the local
+	// daemon via /dev/log (or /var/run/syslog).
+	Network  string
+	Address  string
+	Facility string
+	Tag      string
+}
+
+// syslogWriter writes RFC5424 messages
+type syslogWriter struct {
+	conn     net.Conn
+	facility int
+	hostname string
+	tag      string
+	pid      int
+}
+
+// newSyslogWriter connects to the syslog daemon
+func newSyslogWriter(o SyslogOptions) (*syslogWriter, error) {
+	facility := syslogFacilities["daemon"]
+	if o.Facility != "" {
+		f, ok := syslogFacilities[o.Facility]
+		if !ok {
+			return nil, fmt.Errorf("unknown syslog facility %q", o.Facility)
+		}
+		facility = f
+	}
+
+	conn, err := dialSyslog(o.Network, o.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	tag := o.Tag
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+
+	return &syslogWriter{
+		conn:     conn,
+		facility: facility,
+		hostname: hostname,
+		tag:      tag,
+		pid:      os.Getpid(),
+	}, nil
+}
+
+// dialSyslog connects to the configured or local syslog daemon
+func dialSyslog(network, address string) (net.Conn, error) {
+	if address != "" {
+		if network == "" {
+			network = "udp"
+		}
+		return net.DialTimeout(network, address, 5*time.Second)
+	}
+
+	var lastErr error
+	for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+		for _, nw := range []string{"unixgram", "unix"} {
+			conn, err := net.Dial(nw, path)
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+// write implements sinkWriter
+func (w *syslogWriter) write(record slog.Record, fields []field) error {
+	priority := w.facility*8 + syslogSeverity(record.Level)
+
+	var sd strings.Builder
+	if len(fields) == 0 {
+		sd.WriteString("-")
+	} else {
+		fmt.Fprintf(&sd, "[tunnel@%d", syslogEnterpriseID)
+		for _, f := range fields {
+			fmt.Fprintf(&sd, ` %s="%s"`, sdName(f.key), sdEscape(f.value))
+		}
+		sd.WriteString("]")
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - %s %s\n",
+		priority,
+		record.Time.Format(time.RFC3339Nano),
+		nilValue(w.hostname),
+		nilValue(w.tag),
+		w.pid,
+		sd.String(),
+		record.Message,
+	)
+	_, err := w.conn.Write([]byte(msg))
+	return err
+}
+
+// syslogSeverity maps slog levels to RFC5424 severities
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3 // err
+	case level >= slog.LevelWarn:
+		return 4 // warning
+	case level >= slog.LevelInfo:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
+
+// sdName sanitizes a structured data PARAM-NAME (printable ASCII, no '=', ' ', ']', '"')
+func sdName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// sdEscape escapes a structured data PARAM-VALUE
+func sdEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// nilValue returns the RFC5424 NILVALUE for empty header fields
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds in seconds of latency histograms
+var LatencyBuckets = [...]float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Histogram counts durations into LatencyBuckets. The zero value is ready to use.
+type Histogram struct {
+	counts [len(LatencyBuckets) + 1]atomic.Int64 // last bucket is +Inf
+	count  atomic.Int64
+	sumUS  atomic.Int64 // microseconds
+}
+
+// Observe records one duration
+func (h *Histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := 0
+	for i < len(LatencyBuckets) && seconds > LatencyBuckets[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sumUS.Add(d.Microseconds())
+}
+
+// Snapshot returns the cumulative bucket counts
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{Buckets: make([]Bucket, len(LatencyBuckets))}
+	var cumulative int64
+	for i, le := range LatencyBuckets {
+		cumulative += h.counts[i].Load()
+		s.Buckets[i] = Bucket{LE: le, Count: cumulative}
+	}
+	s.Count = h.count.Load()
+	s.Sum = time.Duration(h.sumUS.Load()) * time.Microsecond
+	return s
+}
+
+// HistogramSnapshot is a snapshot of a Histogram
+type HistogramSnapshot struct {
+	// Buckets hold cumulative counts; observations above the last bound are
+	// only counted in Count (the +Inf bucket)
+	Buckets []Bucket
+	Count   int64
+	Sum     time.Duration
+}
+
+// Bucket is the number of observations less than or equal to LE seconds
+type Bucket struct {
+	LE    float64 `json:"le"`
+	Count int64   `json:"count"`
+}
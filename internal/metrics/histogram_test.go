@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+	var h Histogram
+	h.Observe(500 * time.Microsecond) // <= 0.001
+	h.Observe(time.Millisecond)       // <= 0.001 (upper bound is inclusive)
+	h.Observe(200 * time.Millisecond) // <= 0.25
+	h.Observe(time.Minute)            // +Inf
+
+	s := h.Snapshot()
+	if s.Count != 4 {
+		t.Errorf("Count = %d, want 4", s.Count)
+	}
+	if want := time.Minute + 201500*time.Microsecond; s.Sum != want {
+		t.Errorf("Sum = %s, want %s", s.Sum, want)
+	}
+	want := map[float64]int64{0.001: 2, 0.1: 2, 0.25: 3, 30: 3}
+	for _, b := range s.Buckets {
+		if n, ok := want[b.LE]; ok && b.Count != n {
+			t.Errorf("bucket le=%g: got %d, want %d", b.LE, b.Count, n)
+		}
+	}
+}
@@ -14,6 +14,10 @@ type Metrics struct {
 	ReconnectionsTotal int64
 	ReconnectionErrors int64
 
+	// TLS handshake metrics (resumed = session ticket/cache hit)
+	TLSHandshakesFull    int64
+	TLSHandshakesResumed int64
+
 	// Stream metrics
 	StreamsTotal     int64
 	StreamsActive    int64
@@ -25,25 +29,127 @@ type Metrics struct {
 	RequestsSuccess int64
 	RequestsFailed  int64
 	RequestDuration int64 // microseconds
+	// Requests answered with 429 by a route rate limit
+	RequestsThrottled int64
 
 	// Frame metrics
 	FramesReceived int64
 	FramesSent     int64
 	FramesError    int64
 
+	// Frames rejected for breaking stream ID rules (parity, reuse, unknown stream)
+	ProtocolViolations int64
+
+	// Frames delayed for exceeding the frame rate limit
+	FramesThrottled int64
+
+	// Invalid frame lengths read from Core (corrupted stream, connection dropped)
+	FramesInvalidLength int64
+
+	// Stream error frames by whether they were written to the connection
+	ErrorFramesSent   int64
+	ErrorFramesFailed int64
+
+	// Frame handler errors by class (transient, stream, connection)
+	HandlerErrTransient  int64
+	HandlerErrStream     int64
+	HandlerErrConnection int64
+
+	// Stream resets sent to Core by reset code
+	StreamResetsProtocol int64
+	StreamResetsExists   int64
+	StreamResetsLimit    int64
+	StreamResetsClosed   int64
+	StreamResetsMemory   int64
+	StreamResetsInternal int64
+
+	// Keep-alive connections to local services opened ahead of requests
+	WarmConnsSuccess int64
+	WarmConnsFailed  int64
+
+	// Connections dropped because Core sent nothing within the idle timeout,
+	// and when the last frame was received (unix nanoseconds)
+	IdleTimeouts      int64
+	lastFrameReceived int64
+
+	// Payload bytes per direction
+	BytesSent     int64
+	BytesReceived int64
+
+	// Per-second rates per direction over RateWindow
+	framesSentRate     Rate
+	framesReceivedRate Rate
+	bytesSentRate      Rate
+	bytesReceivedRate  Rate
+
 	// Heartbeat metrics
 	HeartbeatsSent   int64
 	HeartbeatsFailed int64
+	HeartbeatsAcked  int64
+
+	// Heartbeat probe echoes that came back truncated or corrupted
+	HeartbeatEchoFailures int64
+
+	// Link quality score (0-100), smoothed heartbeat RTT and heartbeat loss ratio
+	LinkQuality      int
+	LinkRTT          time.Duration
+	LinkLoss         float64
+	LinkQualityKnown bool
+
+	// Stream latency from FrameOpenStream receipt to the request headers written
+	// to the local service, to the first local response byte and to EndStream sent
+	StreamLocalSend Histogram
+	StreamFirstByte Histogram
+	StreamEnd       Histogram
+
+	// Requests per public route over the last RouteWindow
+	Routes RouteStats
 
 	// Local service metrics
 	LocalRequestsTotal   int64
 	LocalRequestsError   int64
 	LocalRequestDuration int64 // microseconds
 
+	// Dedicated local connections pinned to an upgraded (WebSocket) stream
+	PinnedConnsTotal  int64
+	PinnedConnsActive int64
+
+	// Local service restarts survived within the grace period and the dials
+	// retried while waiting for them
+	LocalRestarts    int64
+	LocalDialRetries int64
+
+	// Memory metrics (buffered payload against the configured cap)
+	MemoryBuffered int64
+	MemoryLimit    int64
+	MemoryPressure int32
+	StreamsShed    int64
+
+	// Watchdog metrics (goroutine count at the last check, suspected leaks)
+	Goroutines     int64
+	LeaksSuspected int64
+
+	// Authentication attempts by outcome
+	AuthSuccess  int64
+	AuthFailures int64
+
+	// Runtime configuration reloads (route table imports) by outcome
+	ConfigReloads        int64
+	ConfigReloadFailures int64
+
+	// Secret manager refreshes by outcome and rotated secrets they found
+	SecretRefreshes       int64
+	SecretRefreshFailures int64
+	SecretRotations       int64
+
+	// LocalAddr is the local address of the current connection to Core
+	LocalAddr string
+
 	// Timestamps
-	LastConnectionTime time.Time
-	LastRequestTime    time.Time
-	LastHeartbeatTime  time.Time
+	LastConnectionTime   time.Time
+	LastRequestTime      time.Time
+	LastHeartbeatTime    time.Time
+	LastHeartbeatAckTime time.Time
 
 	mu sync.RWMutex
 }
@@ -83,6 +189,15 @@ func (m *Metrics) IncrementReconnectionErrors() {
 	atomic.AddInt64(&m.ReconnectionErrors, 1)
 }
 
+// RecordTLSHandshake counts a completed TLS handshake as full or resumed
+func (m *Metrics) RecordTLSHandshake(resumed bool) {
+	if resumed {
+		atomic.AddInt64(&m.TLSHandshakesResumed, 1)
+		return
+	}
+	atomic.AddInt64(&m.TLSHandshakesFull, 1)
+}
+
 // IncrementStreamsTotal increments total streams
 func (m *Metrics) IncrementStreamsTotal() {
 	atomic.AddInt64(&m.StreamsTotal, 1)
@@ -128,14 +243,74 @@ func (m *Metrics) RecordRequestDuration(duration time.Duration) {
 	atomic.StoreInt64(&m.RequestDuration, duration.Microseconds())
 }
 
-// IncrementFramesReceived increments received frames
-func (m *Metrics) IncrementFramesReceived() {
+// RecordFrameReceived counts a received frame with payloadBytes of payload
+func (m *Metrics) RecordFrameReceived(payloadBytes int) {
 	atomic.AddInt64(&m.FramesReceived, 1)
+	atomic.AddInt64(&m.BytesReceived, int64(payloadBytes))
+	atomic.StoreInt64(&m.lastFrameReceived, time.Now().UnixNano())
+	m.framesReceivedRate.Add(1)
+	m.bytesReceivedRate.Add(int64(payloadBytes))
+}
+
+// RecordErrorFrame counts a stream error frame by whether it was written
+func (m *Metrics) RecordErrorFrame(delivered bool) {
+	if delivered {
+		atomic.AddInt64(&m.ErrorFramesSent, 1)
+		return
+	}
+	atomic.AddInt64(&m.ErrorFramesFailed, 1)
+}
+
+// RecordHandlerError counts a frame handler error by its class
+func (m *Metrics) RecordHandlerError(class string) {
+	switch class {
+	case "stream":
+		atomic.AddInt64(&m.HandlerErrStream, 1)
+	case "connection":
+		atomic.AddInt64(&m.HandlerErrConnection, 1)
+	default:
+		atomic.AddInt64(&m.HandlerErrTransient, 1)
+	}
+}
+
+// RecordStreamReset counts a stream reset sent to Core by its reset code
+func (m *Metrics) RecordStreamReset(code string) {
+	switch code {
+	case "protocol_error":
+		atomic.AddInt64(&m.StreamResetsProtocol, 1)
+	case "stream_exists":
+		atomic.AddInt64(&m.StreamResetsExists, 1)
+	case "stream_limit":
+		atomic.AddInt64(&m.StreamResetsLimit, 1)
+	case "stream_closed":
+		atomic.AddInt64(&m.StreamResetsClosed, 1)
+	case "memory_pressure":
+		atomic.AddInt64(&m.StreamResetsMemory, 1)
+	default:
+		atomic.AddInt64(&m.StreamResetsInternal, 1)
+	}
+}
+
+// RecordWarmConn counts a warm-up connection by whether it was opened
+func (m *Metrics) RecordWarmConn(opened bool) {
+	if opened {
+		atomic.AddInt64(&m.WarmConnsSuccess, 1)
+		return
+	}
+	atomic.AddInt64(&m.WarmConnsFailed, 1)
+}
+
+// IncrementIdleTimeouts counts a connection dropped for idling past the idle timeout
+func (m *Metrics) IncrementIdleTimeouts() {
+	atomic.AddInt64(&m.IdleTimeouts, 1)
 }
 
-// IncrementFramesSent increments sent frames
-func (m *Metrics) IncrementFramesSent() {
+// RecordFrameSent counts a sent frame with payloadBytes of payload
+func (m *Metrics) RecordFrameSent(payloadBytes int) {
 	atomic.AddInt64(&m.FramesSent, 1)
+	atomic.AddInt64(&m.BytesSent, int64(payloadBytes))
+	m.framesSentRate.Add(1)
+	m.bytesSentRate.Add(int64(payloadBytes))
 }
 
 // IncrementFramesError increments error frames
@@ -143,6 +318,26 @@ func (m *Metrics) IncrementFramesError() {
 	atomic.AddInt64(&m.FramesError, 1)
 }
 
+// IncrementProtocolViolations increments protocol violations
+func (m *Metrics) IncrementProtocolViolations() {
+	atomic.AddInt64(&m.ProtocolViolations, 1)
+}
+
+// IncrementRequestsThrottled increments requests answered with 429 by a route rate limit
+func (m *Metrics) IncrementRequestsThrottled() {
+	atomic.AddInt64(&m.RequestsThrottled, 1)
+}
+
+// IncrementFramesThrottled increments frames delayed by the frame rate limit
+func (m *Metrics) IncrementFramesThrottled() {
+	atomic.AddInt64(&m.FramesThrottled, 1)
+}
+
+// IncrementFramesInvalidLength increments frames with an invalid length prefix
+func (m *Metrics) IncrementFramesInvalidLength() {
+	atomic.AddInt64(&m.FramesInvalidLength, 1)
+}
+
 // IncrementHeartbeatsSent increments sent heartbeats
 func (m *Metrics) IncrementHeartbeatsSent() {
 	atomic.AddInt64(&m.HeartbeatsSent, 1)
@@ -153,6 +348,21 @@ func (m *Metrics) IncrementHeartbeatsFailed() {
 	atomic.AddInt64(&m.HeartbeatsFailed, 1)
 }
 
+// RecordStreamLocalSend records the time from stream open until the request was written to the local service
+func (m *Metrics) RecordStreamLocalSend(d time.Duration) {
+	m.StreamLocalSend.Observe(d)
+}
+
+// RecordStreamFirstByte records the time from stream open until the first local response byte
+func (m *Metrics) RecordStreamFirstByte(d time.Duration) {
+	m.StreamFirstByte.Observe(d)
+}
+
+// RecordStreamEnd records the time from stream open until EndStream was sent
+func (m *Metrics) RecordStreamEnd(d time.Duration) {
+	m.StreamEnd.Observe(d)
+}
+
 // IncrementLocalRequestsTotal increments total local requests
 func (m *Metrics) IncrementLocalRequestsTotal() {
 	atomic.AddInt64(&m.LocalRequestsTotal, 1)
@@ -168,6 +378,91 @@ func (m *Metrics) RecordLocalRequestDuration(duration time.Duration) {
 	atomic.StoreInt64(&m.LocalRequestDuration, duration.Microseconds())
 }
 
+// IncrementPinnedConns counts a local connection pinned to a stream
+func (m *Metrics) IncrementPinnedConns() {
+	atomic.AddInt64(&m.PinnedConnsTotal, 1)
+	atomic.AddInt64(&m.PinnedConnsActive, 1)
+}
+
+// IncrementLocalRestarts counts a local service that accepted connections
+// again within the restart grace period
+func (m *Metrics) IncrementLocalRestarts() {
+	atomic.AddInt64(&m.LocalRestarts, 1)
+}
+
+// IncrementLocalDialRetries counts a dial retried while a local service restarts
+func (m *Metrics) IncrementLocalDialRetries() {
+	atomic.AddInt64(&m.LocalDialRetries, 1)
+}
+
+// DecrementPinnedConnsActive decrements pinned local connections still open
+func (m *Metrics) DecrementPinnedConnsActive() {
+	atomic.AddInt64(&m.PinnedConnsActive, -1)
+}
+
+// AddMemoryBuffered adjusts buffered payload bytes by delta
+func (m *Metrics) AddMemoryBuffered(delta int64) {
+	atomic.AddInt64(&m.MemoryBuffered, delta)
+}
+
+// SetMemoryLimit sets the buffered payload cap
+func (m *Metrics) SetMemoryLimit(limit int64) {
+	atomic.StoreInt64(&m.MemoryLimit, limit)
+}
+
+// SetMemoryPressure sets whether the agent is shedding load
+func (m *Metrics) SetMemoryPressure(under bool) {
+	var v int32
+	if under {
+		v = 1
+	}
+	atomic.StoreInt32(&m.MemoryPressure, v)
+}
+
+// IncrementStreamsShed increments streams refused under memory pressure
+func (m *Metrics) IncrementStreamsShed() {
+	atomic.AddInt64(&m.StreamsShed, 1)
+}
+
+// SetGoroutines sets the goroutine count seen by the watchdog
+func (m *Metrics) SetGoroutines(n int) {
+	atomic.StoreInt64(&m.Goroutines, int64(n))
+}
+
+// IncrementLeaksSuspected increments suspected resource leaks
+func (m *Metrics) IncrementLeaksSuspected() {
+	atomic.AddInt64(&m.LeaksSuspected, 1)
+}
+
+// RecordAuth counts an authentication attempt by outcome
+func (m *Metrics) RecordAuth(success bool) {
+	if success {
+		atomic.AddInt64(&m.AuthSuccess, 1)
+		return
+	}
+	atomic.AddInt64(&m.AuthFailures, 1)
+}
+
+// RecordConfigReload counts a runtime configuration reload by outcome
+func (m *Metrics) RecordConfigReload(success bool) {
+	if success {
+		atomic.AddInt64(&m.ConfigReloads, 1)
+		return
+	}
+	atomic.AddInt64(&m.ConfigReloadFailures, 1)
+}
+
+// RecordSecretRefresh counts a re-fetch of the secret manager secrets by
+// outcome; rotated is the number of secrets whose value changed
+func (m *Metrics) RecordSecretRefresh(success bool, rotated int) {
+	atomic.AddInt64(&m.SecretRotations, int64(rotated))
+	if success {
+		atomic.AddInt64(&m.SecretRefreshes, 1)
+		return
+	}
+	atomic.AddInt64(&m.SecretRefreshFailures, 1)
+}
+
 // SetLastConnectionTime sets last connection time
 func (m *Metrics) SetLastConnectionTime(t time.Time) {
 	m.mu.Lock()
@@ -175,6 +470,13 @@ func (m *Metrics) SetLastConnectionTime(t time.Time) {
 	m.LastConnectionTime = t
 }
 
+// SetLocalAddr sets the local address of the current connection
+func (m *Metrics) SetLocalAddr(addr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.LocalAddr = addr
+}
+
 // SetLastRequestTime sets last request time
 func (m *Metrics) SetLastRequestTime(t time.Time) {
 	m.mu.Lock()
@@ -182,6 +484,30 @@ func (m *Metrics) SetLastRequestTime(t time.Time) {
 	m.LastRequestTime = t
 }
 
+// IncrementHeartbeatsAcked increments acknowledged heartbeats
+func (m *Metrics) IncrementHeartbeatsAcked() {
+	atomic.AddInt64(&m.HeartbeatsAcked, 1)
+}
+
+// IncrementHeartbeatEchoFailures increments heartbeat probe echo mismatches
+func (m *Metrics) IncrementHeartbeatEchoFailures() {
+	atomic.AddInt64(&m.HeartbeatEchoFailures, 1)
+}
+
+// SetLinkQuality sets the latest link quality score and its inputs
+func (m *Metrics) SetLinkQuality(score int, rtt time.Duration, loss float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.LinkQuality, m.LinkRTT, m.LinkLoss, m.LinkQualityKnown = score, rtt, loss, true
+}
+
+// SetLastHeartbeatAckTime sets last heartbeat ACK time
+func (m *Metrics) SetLastHeartbeatAckTime(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.LastHeartbeatAckTime = t
+}
+
 // SetLastHeartbeatTime sets last heartbeat time
 func (m *Metrics) SetLastHeartbeatTime(t time.Time) {
 	m.mu.Lock()
@@ -195,55 +521,173 @@ func (m *Metrics) GetSnapshot() MetricsSnapshot {
 	defer m.mu.RUnlock()
 
 	return MetricsSnapshot{
-		ConnectionsTotal:     atomic.LoadInt64(&m.ConnectionsTotal),
-		ConnectionsActive:    atomic.LoadInt64(&m.ConnectionsActive),
-		ReconnectionsTotal:   atomic.LoadInt64(&m.ReconnectionsTotal),
-		ReconnectionErrors:   atomic.LoadInt64(&m.ReconnectionErrors),
-		StreamsTotal:         atomic.LoadInt64(&m.StreamsTotal),
-		StreamsActive:        atomic.LoadInt64(&m.StreamsActive),
-		StreamsCompleted:     atomic.LoadInt64(&m.StreamsCompleted),
-		StreamsFailed:        atomic.LoadInt64(&m.StreamsFailed),
-		RequestsTotal:        atomic.LoadInt64(&m.RequestsTotal),
-		RequestsSuccess:      atomic.LoadInt64(&m.RequestsSuccess),
-		RequestsFailed:       atomic.LoadInt64(&m.RequestsFailed),
-		RequestDuration:      atomic.LoadInt64(&m.RequestDuration),
-		FramesReceived:       atomic.LoadInt64(&m.FramesReceived),
-		FramesSent:           atomic.LoadInt64(&m.FramesSent),
-		FramesError:          atomic.LoadInt64(&m.FramesError),
-		HeartbeatsSent:       atomic.LoadInt64(&m.HeartbeatsSent),
-		HeartbeatsFailed:     atomic.LoadInt64(&m.HeartbeatsFailed),
-		LocalRequestsTotal:   atomic.LoadInt64(&m.LocalRequestsTotal),
-		LocalRequestsError:   atomic.LoadInt64(&m.LocalRequestsError),
-		LocalRequestDuration: atomic.LoadInt64(&m.LocalRequestDuration),
-		LastConnectionTime:   m.LastConnectionTime,
-		LastRequestTime:      m.LastRequestTime,
-		LastHeartbeatTime:    m.LastHeartbeatTime,
+		ConnectionsTotal:      atomic.LoadInt64(&m.ConnectionsTotal),
+		ConnectionsActive:     atomic.LoadInt64(&m.ConnectionsActive),
+		ReconnectionsTotal:    atomic.LoadInt64(&m.ReconnectionsTotal),
+		ReconnectionErrors:    atomic.LoadInt64(&m.ReconnectionErrors),
+		TLSHandshakesFull:     atomic.LoadInt64(&m.TLSHandshakesFull),
+		TLSHandshakesResumed:  atomic.LoadInt64(&m.TLSHandshakesResumed),
+		StreamsTotal:          atomic.LoadInt64(&m.StreamsTotal),
+		StreamsActive:         atomic.LoadInt64(&m.StreamsActive),
+		StreamsCompleted:      atomic.LoadInt64(&m.StreamsCompleted),
+		StreamsFailed:         atomic.LoadInt64(&m.StreamsFailed),
+		RequestsTotal:         atomic.LoadInt64(&m.RequestsTotal),
+		RequestsSuccess:       atomic.LoadInt64(&m.RequestsSuccess),
+		RequestsFailed:        atomic.LoadInt64(&m.RequestsFailed),
+		RequestDuration:       atomic.LoadInt64(&m.RequestDuration),
+		RequestsThrottled:     atomic.LoadInt64(&m.RequestsThrottled),
+		FramesReceived:        atomic.LoadInt64(&m.FramesReceived),
+		FramesSent:            atomic.LoadInt64(&m.FramesSent),
+		FramesError:           atomic.LoadInt64(&m.FramesError),
+		ProtocolViolations:    atomic.LoadInt64(&m.ProtocolViolations),
+		FramesThrottled:       atomic.LoadInt64(&m.FramesThrottled),
+		FramesInvalidLength:   atomic.LoadInt64(&m.FramesInvalidLength),
+		IdleTimeouts:          atomic.LoadInt64(&m.IdleTimeouts),
+		ErrorFramesSent:       atomic.LoadInt64(&m.ErrorFramesSent),
+		ErrorFramesFailed:     atomic.LoadInt64(&m.ErrorFramesFailed),
+		HandlerErrTransient:   atomic.LoadInt64(&m.HandlerErrTransient),
+		HandlerErrStream:      atomic.LoadInt64(&m.HandlerErrStream),
+		HandlerErrConnection:  atomic.LoadInt64(&m.HandlerErrConnection),
+		StreamResetsProtocol:  atomic.LoadInt64(&m.StreamResetsProtocol),
+		StreamResetsExists:    atomic.LoadInt64(&m.StreamResetsExists),
+		StreamResetsLimit:     atomic.LoadInt64(&m.StreamResetsLimit),
+		StreamResetsClosed:    atomic.LoadInt64(&m.StreamResetsClosed),
+		StreamResetsMemory:    atomic.LoadInt64(&m.StreamResetsMemory),
+		StreamResetsInternal:  atomic.LoadInt64(&m.StreamResetsInternal),
+		WarmConnsSuccess:      atomic.LoadInt64(&m.WarmConnsSuccess),
+		WarmConnsFailed:       atomic.LoadInt64(&m.WarmConnsFailed),
+		LastFrameReceivedTime: unixNano(atomic.LoadInt64(&m.lastFrameReceived)),
+		BytesSent:             atomic.LoadInt64(&m.BytesSent),
+		BytesReceived:         atomic.LoadInt64(&m.BytesReceived),
+		FramesSentRate:        m.framesSentRate.PerSecond(),
+		FramesReceivedRate:    m.framesReceivedRate.PerSecond(),
+		BytesSentRate:         m.bytesSentRate.PerSecond(),
+		BytesReceivedRate:     m.bytesReceivedRate.PerSecond(),
+		HeartbeatsSent:        atomic.LoadInt64(&m.HeartbeatsSent),
+		HeartbeatsFailed:      atomic.LoadInt64(&m.HeartbeatsFailed),
+		HeartbeatsAcked:       atomic.LoadInt64(&m.HeartbeatsAcked),
+		HeartbeatEchoFailures: atomic.LoadInt64(&m.HeartbeatEchoFailures),
+		LinkQuality:           m.LinkQuality,
+		LinkRTT:               m.LinkRTT,
+		LinkLoss:              m.LinkLoss,
+		LinkQualityKnown:      m.LinkQualityKnown,
+		StreamLocalSend:       m.StreamLocalSend.Snapshot(),
+		StreamFirstByte:       m.StreamFirstByte.Snapshot(),
+		StreamEnd:             m.StreamEnd.Snapshot(),
+		LocalRequestsTotal:    atomic.LoadInt64(&m.LocalRequestsTotal),
+		LocalRequestsError:    atomic.LoadInt64(&m.LocalRequestsError),
+		LocalRequestDuration:  atomic.LoadInt64(&m.LocalRequestDuration),
+		PinnedConnsTotal:      atomic.LoadInt64(&m.PinnedConnsTotal),
+		PinnedConnsActive:     atomic.LoadInt64(&m.PinnedConnsActive),
+		LocalRestarts:         atomic.LoadInt64(&m.LocalRestarts),
+		LocalDialRetries:      atomic.LoadInt64(&m.LocalDialRetries),
+		MemoryBuffered:        atomic.LoadInt64(&m.MemoryBuffered),
+		MemoryLimit:           atomic.LoadInt64(&m.MemoryLimit),
+		MemoryPressure:        atomic.LoadInt32(&m.MemoryPressure) == 1,
+		StreamsShed:           atomic.LoadInt64(&m.StreamsShed),
+		Goroutines:            atomic.LoadInt64(&m.Goroutines),
+		LeaksSuspected:        atomic.LoadInt64(&m.LeaksSuspected),
+		AuthSuccess:           atomic.LoadInt64(&m.AuthSuccess),
+		AuthFailures:          atomic.LoadInt64(&m.AuthFailures),
+		ConfigReloads:         atomic.LoadInt64(&m.ConfigReloads),
+		ConfigReloadFailures:  atomic.LoadInt64(&m.ConfigReloadFailures),
+		SecretRefreshes:       atomic.LoadInt64(&m.SecretRefreshes),
+		SecretRefreshFailures: atomic.LoadInt64(&m.SecretRefreshFailures),
+		SecretRotations:       atomic.LoadInt64(&m.SecretRotations),
+		LocalAddr:             m.LocalAddr,
+		LastConnectionTime:    m.LastConnectionTime,
+		LastRequestTime:       m.LastRequestTime,
+		LastHeartbeatTime:     m.LastHeartbeatTime,
+		LastHeartbeatAckTime:  m.LastHeartbeatAckTime,
 	}
 }
 
 // MetricsSnapshot is a snapshot of metrics
 type MetricsSnapshot struct {
-	ConnectionsTotal     int64
-	ConnectionsActive    int64
-	ReconnectionsTotal   int64
-	ReconnectionErrors   int64
-	StreamsTotal         int64
-	StreamsActive        int64
-	StreamsCompleted     int64
-	StreamsFailed        int64
-	RequestsTotal        int64
-	RequestsSuccess      int64
-	RequestsFailed       int64
-	RequestDuration      int64
-	FramesReceived       int64
-	FramesSent           int64
-	FramesError          int64
-	HeartbeatsSent       int64
-	HeartbeatsFailed     int64
-	LocalRequestsTotal   int64
-	LocalRequestsError   int64
-	LocalRequestDuration int64
-	LastConnectionTime   time.Time
-	LastRequestTime      time.Time
-	LastHeartbeatTime    time.Time
+	ConnectionsTotal      int64
+	ConnectionsActive     int64
+	ReconnectionsTotal    int64
+	ReconnectionErrors    int64
+	TLSHandshakesFull     int64
+	TLSHandshakesResumed  int64
+	StreamsTotal          int64
+	StreamsActive         int64
+	StreamsCompleted      int64
+	StreamsFailed         int64
+	RequestsTotal         int64
+	RequestsSuccess       int64
+	RequestsFailed        int64
+	RequestDuration       int64
+	RequestsThrottled     int64
+	FramesReceived        int64
+	FramesSent            int64
+	FramesError           int64
+	ProtocolViolations    int64
+	FramesThrottled       int64
+	FramesInvalidLength   int64
+	IdleTimeouts          int64
+	ErrorFramesSent       int64
+	ErrorFramesFailed     int64
+	HandlerErrTransient   int64
+	HandlerErrStream      int64
+	HandlerErrConnection  int64
+	StreamResetsProtocol  int64
+	StreamResetsExists    int64
+	StreamResetsLimit     int64
+	StreamResetsClosed    int64
+	StreamResetsMemory    int64
+	StreamResetsInternal  int64
+	WarmConnsSuccess      int64
+	WarmConnsFailed       int64
+	BytesSent             int64
+	BytesReceived         int64
+	FramesSentRate        float64 // per second over RateWindow
+	FramesReceivedRate    float64
+	BytesSentRate         float64
+	BytesReceivedRate     float64
+	HeartbeatsSent        int64
+	HeartbeatsFailed      int64
+	HeartbeatsAcked       int64
+	HeartbeatEchoFailures int64
+	LinkQuality           int // 0-100, valid when LinkQualityKnown
+	LinkRTT               time.Duration
+	LinkLoss              float64
+	LinkQualityKnown      bool
+	StreamLocalSend       HistogramSnapshot
+	StreamFirstByte       HistogramSnapshot
+	StreamEnd             HistogramSnapshot
+	LocalRequestsTotal    int64
+	LocalRequestsError    int64
+	LocalRequestDuration  int64
+	PinnedConnsTotal      int64
+	PinnedConnsActive     int64
+	LocalRestarts         int64
+	LocalDialRetries      int64
+	MemoryBuffered        int64
+	MemoryLimit           int64
+	MemoryPressure        bool
+	StreamsShed           int64
+	Goroutines            int64
+	LeaksSuspected        int64
+	AuthSuccess           int64
+	AuthFailures          int64
+	ConfigReloads         int64
+	ConfigReloadFailures  int64
+	SecretRefreshes       int64
+	SecretRefreshFailures int64
+	SecretRotations       int64
+	LocalAddr             string
+	LastConnectionTime    time.Time
+	LastRequestTime       time.Time
+	LastHeartbeatTime     time.Time
+	LastHeartbeatAckTime  time.Time
+	LastFrameReceivedTime time.Time
+}
+
+// unixNano converts unix nanoseconds to a time, zero for 0
+func unixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
 }
@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PrometheusContentType is the content type of the text exposition format
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// labelEscaper escapes label values per the text exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// sample is one line of a metric family
+type sample struct {
+	suffix string // appended to the family name (_bucket, _sum, _count)
+	labels string // rendered label set without braces, empty for none
+	value  float64
+}
+
+// family is a Prometheus metric family
+type family struct {
+	name    string
+	help    string
+	kind    string // counter or gauge
+	samples []sample
+}
+
+// value returns a family with a single unlabeled sample
+func value(name, kind, help string, v float64) family {
+	return family{name: name, help: help, kind: kind, samples: []sample{{value: v}}}
+}
+
+// outcome returns a counter split by result="success|failure"
+func outcome(name, help string, success, failure int64) family {
+	return family{name: name, help: help, kind: "counter", samples: []sample{
+		{labels: `result="success"`, value: float64(success)},
+		{labels: `result="failure"`, value: float64(failure)},
+	}}
+}
+
+// series is a histogram with its label set
+type series struct {
+	labels string
+	h      HistogramSnapshot
+}
+
+// histogram returns a histogram family with one series per label set
+func histogram(name, help string, all ...series) family {
+	f := family{name: name, help: help, kind: "histogram"}
+	for _, s := range all {
+		labels, h := s.labels, s.h
+		for _, b := range h.Buckets {
+			f.samples = append(f.samples, sample{suffix: "_bucket", labels: fmt.Sprintf(`%s,le="%g"`, labels, b.LE), value: float64(b.Count)})
+		}
+		f.samples = append(f.samples,
+			sample{suffix: "_bucket", labels: labels + `,le="+Inf"`, value: float64(h.Count)},
+			sample{suffix: "_sum", labels: labels, value: h.Sum.Seconds()},
+			sample{suffix: "_count", labels: labels, value: float64(h.Count)},
+		)
+	}
+	return f
+}
+
+// WritePrometheus writes s in the Prometheus text exposition format, with
+// version and commit exported as the agent_build_info gauge. A non-empty
+// tunnel is added as the tunnel label of every series.
+func WritePrometheus(w io.Writer, s MetricsSnapshot, tunnel, version, commit string) error {
+	families := []family{
+		{
+			name: "agent_build_info", kind: "gauge",
+			help:    "Build information of the running agent, always 1.",
+			samples: []sample{{labels: fmt.Sprintf(`version="%s",commit="%s"`, labelEscaper.Replace(version), labelEscaper.Replace(commit)), value: 1}},
+		},
+		outcome("agent_auth_attempts_total", "Authentication attempts with Core by result.", s.AuthSuccess, s.AuthFailures),
+		outcome("agent_config_reloads_total", "Runtime configuration reloads by result.", s.ConfigReloads, s.ConfigReloadFailures),
+		outcome("agent_secret_refreshes_total", "Re-fetches of secret manager secrets by result.", s.SecretRefreshes, s.SecretRefreshFailures),
+		value("agent_secret_rotations_total", "counter", "Secret manager secrets whose value changed on refresh.", float64(s.SecretRotations)),
+		outcome("agent_error_frames_total", "Stream error frames sent to Core by whether they were written to the connection.", s.ErrorFramesSent, s.ErrorFramesFailed),
+		{
+			name: "agent_frame_handler_errors_total", kind: "counter",
+			help: "Errors returned by frame handlers by error policy class.",
+			samples: []sample{
+				{labels: `class="transient"`, value: float64(s.HandlerErrTransient)},
+				{labels: `class="stream"`, value: float64(s.HandlerErrStream)},
+				{labels: `class="connection"`, value: float64(s.HandlerErrConnection)},
+			},
+		},
+		{
+			name: "agent_stream_resets_total", kind: "counter",
+			help: "Stream resets sent to Core by reset code.",
+			samples: []sample{
+				{labels: `code="protocol_error"`, value: float64(s.StreamResetsProtocol)},
+				{labels: `code="stream_exists"`, value: float64(s.StreamResetsExists)},
+				{labels: `code="stream_limit"`, value: float64(s.StreamResetsLimit)},
+				{labels: `code="stream_closed"`, value: float64(s.StreamResetsClosed)},
+				{labels: `code="memory_pressure"`, value: float64(s.StreamResetsMemory)},
+				{labels: `code="internal_error"`, value: float64(s.StreamResetsInternal)},
+			},
+		},
+		outcome("agent_warmup_connections_total", "Keep-alive connections to local services opened ahead of requests by result.", s.WarmConnsSuccess, s.WarmConnsFailed),
+		value("agent_connections_total", "counter", "Connections established to Core.", float64(s.ConnectionsTotal)),
+		value("agent_connections_active", "gauge", "Connections currently open to Core.", float64(s.ConnectionsActive)),
+		value("agent_reconnections_total", "counter", "Reconnection attempts.", float64(s.ReconnectionsTotal)),
+		value("agent_streams_total", "counter", "Streams opened.", float64(s.StreamsTotal)),
+		value("agent_streams_active", "gauge", "Streams currently open.", float64(s.StreamsActive)),
+		value("agent_streams_failed_total", "counter", "Streams that failed.", float64(s.StreamsFailed)),
+		value("agent_requests_total", "counter", "Requests forwarded to local services.", float64(s.RequestsTotal)),
+		value("agent_requests_failed_total", "counter", "Requests that failed.", float64(s.RequestsFailed)),
+		value("agent_requests_throttled_total", "counter", "Requests answered with 429 by a route rate limit.", float64(s.RequestsThrottled)),
+		value("agent_frames_received_total", "counter", "Frames received from Core.", float64(s.FramesReceived)),
+		value("agent_frames_sent_total", "counter", "Frames sent to Core.", float64(s.FramesSent)),
+		value("agent_idle_timeouts_total", "counter", "Connections dropped because Core sent nothing within the idle timeout.", float64(s.IdleTimeouts)),
+		value("agent_frames_throttled_total", "counter", "Frames from Core delayed by the frame rate limit.", float64(s.FramesThrottled)),
+		value("agent_frames_invalid_length_total", "counter", "Frames read from Core with an invalid length prefix; each one drops the connection.", float64(s.FramesInvalidLength)),
+		value("agent_bytes_received_total", "counter", "Payload bytes received from Core.", float64(s.BytesReceived)),
+		value("agent_bytes_sent_total", "counter", "Payload bytes sent to Core.", float64(s.BytesSent)),
+		value("agent_heartbeats_failed_total", "counter", "Heartbeats that could not be sent.", float64(s.HeartbeatsFailed)),
+		value("agent_heartbeat_echo_failures_total", "counter", "Heartbeat probe echoes that came back truncated or corrupted.", float64(s.HeartbeatEchoFailures)),
+		value("agent_pinned_connections_total", "counter", "Dedicated local connections opened for upgraded streams.", float64(s.PinnedConnsTotal)),
+		value("agent_pinned_connections_active", "gauge", "Dedicated local connections currently pinned to a stream.", float64(s.PinnedConnsActive)),
+		value("agent_local_restarts_total", "counter", "Local service restarts survived within the restart grace period.", float64(s.LocalRestarts)),
+		value("agent_local_dial_retries_total", "counter", "Dials to local services retried while waiting for a restart.", float64(s.LocalDialRetries)),
+		value("agent_memory_buffered_bytes", "gauge", "Payload bytes buffered in memory.", float64(s.MemoryBuffered)),
+		value("agent_goroutines", "gauge", "Goroutines at the last watchdog check.", float64(s.Goroutines)),
+		histogram("agent_stream_latency_seconds", "Time from FrameOpenStream receipt to each phase of the stream.",
+			series{`phase="local_send"`, s.StreamLocalSend},
+			series{`phase="first_byte"`, s.StreamFirstByte},
+			series{`phase="end_stream"`, s.StreamEnd}),
+	}
+
+	if !s.LastFrameReceivedTime.IsZero() {
+		families = append(families,
+			value("agent_last_frame_received_timestamp_seconds", "gauge", "Unix time of the last frame received from Core.", float64(s.LastFrameReceivedTime.UnixNano())/1e9))
+	}
+
+	if s.LinkQualityKnown {
+		families = append(families,
+			value("agent_link_quality_score", "gauge", "Link quality score from 0 to 100.", float64(s.LinkQuality)),
+			value("agent_link_rtt_seconds", "gauge", "Smoothed heartbeat round-trip time.", s.LinkRTT.Seconds()),
+			value("agent_link_heartbeat_loss_ratio", "gauge", "Share of recent heartbeats without an ACK.", s.LinkLoss),
+		)
+	}
+
+	tunnelLabel := ""
+	if tunnel != "" {
+		tunnelLabel = fmt.Sprintf(`tunnel="%s"`, labelEscaper.Replace(tunnel))
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		for _, s := range f.samples {
+			switch {
+			case tunnelLabel != "" && s.labels != "":
+				s.labels = tunnelLabel + "," + s.labels
+			case tunnelLabel != "":
+				s.labels = tunnelLabel
+			}
+			if s.labels != "" {
+				fmt.Fprintf(bw, "%s%s{%s} %g\n", f.name, s.suffix, s.labels, s.value)
+			} else {
+				fmt.Fprintf(bw, "%s%s %g\n", f.name, s.suffix, s.value)
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	s := MetricsSnapshot{
+		AuthSuccess:          3,
+		AuthFailures:         1,
+		ConfigReloads:        2,
+		ConfigReloadFailures: 5,
+		StreamsActive:        7,
+	}
+	var h Histogram
+	h.Observe(20 * time.Millisecond)
+	s.StreamFirstByte = h.Snapshot()
+
+	var out strings.Builder
+	if err := WritePrometheus(&out, s, "", "v1.2.3", `dirty"commit`); err != nil {
+		t.Fatalf("WritePrometheus failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"# TYPE agent_build_info gauge\n",
+		`agent_build_info{version="v1.2.3",commit="dirty\"commit"} 1` + "\n",
+		"# TYPE agent_auth_attempts_total counter\n",
+		`agent_auth_attempts_total{result="success"} 3` + "\n",
+		`agent_auth_attempts_total{result="failure"} 1` + "\n",
+		`agent_config_reloads_total{result="success"} 2` + "\n",
+		`agent_config_reloads_total{result="failure"} 5` + "\n",
+		"agent_streams_active 7\n",
+		"# TYPE agent_stream_latency_seconds histogram\n",
+		`agent_stream_latency_seconds_bucket{phase="first_byte",le="0.01"} 0` + "\n",
+		`agent_stream_latency_seconds_bucket{phase="first_byte",le="0.025"} 1` + "\n",
+		`agent_stream_latency_seconds_bucket{phase="first_byte",le="+Inf"} 1` + "\n",
+		`agent_stream_latency_seconds_sum{phase="first_byte"} 0.02` + "\n",
+		`agent_stream_latency_seconds_count{phase="local_send"} 0` + "\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output should contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestWritePrometheus_TunnelLabel(t *testing.T) {
+	var out strings.Builder
+	if err := WritePrometheus(&out, MetricsSnapshot{AuthSuccess: 3, StreamsActive: 7}, "staging-api", "v1.2.3", "abc"); err != nil {
+		t.Fatalf("WritePrometheus failed: %v", err)
+	}
+	for _, want := range []string{
+		`agent_build_info{tunnel="staging-api",version="v1.2.3",commit="abc"} 1` + "\n",
+		`agent_auth_attempts_total{tunnel="staging-api",result="success"} 3` + "\n",
+		`agent_streams_active{tunnel="staging-api"} 7` + "\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output should contain %q:\n%s", want, out.String())
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if !strings.HasPrefix(line, "#") && !strings.Contains(line, `tunnel="staging-api"`) {
+			t.Errorf("series without tunnel label: %s", line)
+		}
+	}
+}
+
+func TestMetrics_RecordOutcomes(t *testing.T) {
+	m := &Metrics{}
+	m.RecordAuth(true)
+	m.RecordAuth(false)
+	m.RecordAuth(false)
+	m.RecordConfigReload(true)
+
+	s := m.GetSnapshot()
+	if s.AuthSuccess != 1 || s.AuthFailures != 2 || s.ConfigReloads != 1 || s.ConfigReloadFailures != 0 {
+		t.Errorf("unexpected counters: %+v", s)
+	}
+}
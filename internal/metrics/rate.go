@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+// RateWindow is the sliding window over which per-second rates are computed
+const RateWindow = 10 * time.Second
+
+const rateBuckets = int(RateWindow / time.Second)
+
+// Rate computes a per-second rate over the last RateWindow of completed
+// seconds. The zero value is ready to use.
+type Rate struct {
+	mu      sync.Mutex
+	clock   clock.Clock
+	buckets [rateBuckets + 1]rateBucket
+}
+
+// rateBucket holds the total added during one wall-clock second
+type rateBucket struct {
+	second int64
+	total  int64
+}
+
+// Add records n units at the current time
+func (r *Rate) Add(n int64) {
+	sec := clock.Or(r.clock).Now().Unix()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := &r.buckets[sec%int64(len(r.buckets))]
+	if b.second != sec {
+		b.second = sec
+		b.total = 0
+	}
+	b.total += n
+}
+
+// PerSecond returns the average rate over the last RateWindow, excluding the
+// current (incomplete) second
+func (r *Rate) PerSecond() float64 {
+	now := clock.Or(r.clock).Now().Unix()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var total int64
+	for _, b := range r.buckets {
+		if b.second < now && b.second >= now-int64(rateBuckets) {
+			total += b.total
+		}
+	}
+	return float64(total) / RateWindow.Seconds()
+}
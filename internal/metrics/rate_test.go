@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+func TestRate_SlidingWindow(t *testing.T) {
+	mock := clock.NewMock(time.Unix(1000, 0))
+	r := &Rate{clock: mock}
+
+	// The current second is incomplete and not counted yet
+	r.Add(500)
+	if got := r.PerSecond(); got != 0 {
+		t.Errorf("rate during the first second = %v, want 0", got)
+	}
+
+	for i := 0; i < 9; i++ {
+		mock.Advance(time.Second)
+		r.Add(500)
+	}
+	mock.Advance(time.Second)
+	if got := r.PerSecond(); got != 500 {
+		t.Errorf("steady rate = %v, want 500", got)
+	}
+
+	// Once traffic stops the rate decays and reaches 0 after a full window
+	mock.Advance(5 * time.Second)
+	if got := r.PerSecond(); got != 250 {
+		t.Errorf("rate half a window later = %v, want 250", got)
+	}
+	mock.Advance(RateWindow)
+	if got := r.PerSecond(); got != 0 {
+		t.Errorf("rate after the window = %v, want 0", got)
+	}
+}
+
+func TestRate_ZeroValue(t *testing.T) {
+	var r Rate
+	r.Add(1)
+	if got := r.PerSecond(); got < 0 || got > 0.1 {
+		t.Errorf("unexpected rate %v", got)
+	}
+}
@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+// RouteWindow is the sliding window over which per-route statistics are
+// aggregated
+const RouteWindow = 5 * time.Minute
+
+// routeSlot is the granularity of the sliding window: a request leaves the
+// window at most routeSlot after it became older than RouteWindow
+const routeSlot = 10 * time.Second
+
+const routeSlots = int(RouteWindow / routeSlot)
+
+// topStatuses is the number of status codes reported per route
+const topStatuses = 3
+
+// RouteRequest is one finished request on a public route
+type RouteRequest struct {
+	Route    string
+	Status   int // 0 if no response was written
+	Failed   bool
+	BytesIn  int64 // request bytes received from Core
+	BytesOut int64 // response bytes written to Core
+	Duration time.Duration
+}
+
+// RouteStats aggregates requests per route over the last RouteWindow. Each
+// route keeps a ring of fixed slots, so recording is O(1) and memory does not
+// grow with traffic. The zero value is ready to use.
+type RouteStats struct {
+	mu     sync.Mutex
+	clock  clock.Clock
+	routes map[string]*routeRing
+}
+
+// routeRing is the sliding window of one route
+type routeRing struct {
+	slots [routeSlots + 1]routeSlotStats
+}
+
+// routeSlotStats holds the requests finished during one slot
+type routeSlotStats struct {
+	slot     int64
+	requests int64
+	failed   int64
+	bytesIn  int64
+	bytesOut int64
+	latency  [len(LatencyBuckets) + 1]int64 // last bucket is +Inf
+	statuses map[int]int64
+}
+
+// Record adds a finished request to its route
+func (s *RouteStats) Record(r RouteRequest) {
+	slot := clock.Or(s.clock).Now().UnixNano() / int64(routeSlot)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.routes == nil {
+		s.routes = make(map[string]*routeRing)
+	}
+	ring := s.routes[r.Route]
+	if ring == nil {
+		ring = &routeRing{}
+		s.routes[r.Route] = ring
+	}
+	b := &ring.slots[slot%int64(len(ring.slots))]
+	if b.slot != slot {
+		*b = routeSlotStats{slot: slot}
+	}
+
+	b.requests++
+	if r.Failed {
+		b.failed++
+	}
+	b.bytesIn += r.BytesIn
+	b.bytesOut += r.BytesOut
+	seconds := r.Duration.Seconds()
+	i := 0
+	for i < len(LatencyBuckets) && seconds > LatencyBuckets[i] {
+		i++
+	}
+	b.latency[i]++
+	if r.Status != 0 {
+		if b.statuses == nil {
+			b.statuses = make(map[int]int64)
+		}
+		b.statuses[r.Status]++
+	}
+}
+
+// RouteSnapshot is the aggregate of one route over the last RouteWindow
+type RouteSnapshot struct {
+	Route     string
+	Requests  int64
+	Failed    int64
+	ErrorRate float64 // Failed / Requests
+	BytesIn   int64
+	BytesOut  int64
+	P95       time.Duration // estimated from LatencyBuckets
+	Statuses  []StatusCount // most frequent first, at most topStatuses
+}
+
+// StatusCount is the number of responses with a status code
+type StatusCount struct {
+	Status int
+	Count  int64
+}
+
+// Snapshot returns the routes with requests in the last RouteWindow, busiest
+// first. Routes without recent requests are dropped.
+func (s *RouteStats) Snapshot() []RouteSnapshot {
+	now := clock.Or(s.clock).Now().UnixNano() / int64(routeSlot)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var snapshots []RouteSnapshot
+	for route, ring := range s.routes {
+		snap := RouteSnapshot{Route: route}
+		var latency [len(LatencyBuckets) + 1]int64
+		statuses := make(map[int]int64)
+		for _, b := range ring.slots {
+			// The current slot counts, so just-finished requests show up
+			if b.slot <= now-int64(routeSlots) || b.requests == 0 {
+				continue
+			}
+			snap.Requests += b.requests
+			snap.Failed += b.failed
+			snap.BytesIn += b.bytesIn
+			snap.BytesOut += b.bytesOut
+			for i, n := range b.latency {
+				latency[i] += n
+			}
+			for status, n := range b.statuses {
+				statuses[status] += n
+			}
+		}
+		if snap.Requests == 0 {
+			delete(s.routes, route)
+			continue
+		}
+
+		snap.ErrorRate = float64(snap.Failed) / float64(snap.Requests)
+		snap.P95 = latencyQuantile(latency[:], snap.Requests, 0.95)
+		for status, n := range statuses {
+			snap.Statuses = append(snap.Statuses, StatusCount{Status: status, Count: n})
+		}
+		sort.Slice(snap.Statuses, func(i, j int) bool {
+			a, b := snap.Statuses[i], snap.Statuses[j]
+			return a.Count > b.Count || a.Count == b.Count && a.Status < b.Status
+		})
+		if len(snap.Statuses) > topStatuses {
+			snap.Statuses = snap.Statuses[:topStatuses]
+		}
+		snapshots = append(snapshots, snap)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		a, b := snapshots[i], snapshots[j]
+		return a.Requests > b.Requests || a.Requests == b.Requests && a.Route < b.Route
+	})
+	return snapshots
+}
+
+// latencyQuantile estimates quantile q from per-bucket counts of
+// LatencyBuckets, interpolating linearly inside the bucket. Observations in
+// the +Inf bucket are reported as the last bound.
+func latencyQuantile(counts []int64, total int64, q float64) time.Duration {
+	rank := q * float64(total)
+	var cumulative int64
+	lower := 0.0
+	for i, le := range LatencyBuckets {
+		n := counts[i]
+		if n > 0 && float64(cumulative+n) >= rank {
+			fraction := (rank - float64(cumulative)) / float64(n)
+			return time.Duration((lower + (le-lower)*fraction) * float64(time.Second))
+		}
+		cumulative += n
+		lower = le
+	}
+	return time.Duration(lower * float64(time.Second))
+}
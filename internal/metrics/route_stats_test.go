@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+func TestRouteStats_Aggregates(t *testing.T) {
+	mock := clock.NewMock(time.Unix(1000, 0))
+	s := &RouteStats{clock: mock}
+
+	for i := 0; i < 95; i++ {
+		s.Record(RouteRequest{Route: "api/", Status: 200, BytesIn: 10, BytesOut: 100, Duration: 3 * time.Millisecond})
+		if i%10 == 0 {
+			mock.Advance(routeSlot)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		s.Record(RouteRequest{Route: "api/", Status: 502, Failed: true, Duration: 2 * time.Second})
+	}
+	s.Record(RouteRequest{Route: "api/", Status: 404, Duration: 2 * time.Second})
+	s.Record(RouteRequest{Route: "api/", Failed: true, Duration: 2 * time.Second})
+	s.Record(RouteRequest{Route: "*", Status: 200, Duration: time.Millisecond})
+
+	snaps := s.Snapshot()
+	if len(snaps) != 2 || snaps[0].Route != "api/" || snaps[1].Route != "*" {
+		t.Fatalf("routes = %+v, want api/ then *", snaps)
+	}
+	api := snaps[0]
+	if api.Requests != 100 || api.Failed != 4 || api.ErrorRate != 0.04 {
+		t.Errorf("requests %d, failed %d, error rate %v; want 100, 4, 0.04", api.Requests, api.Failed, api.ErrorRate)
+	}
+	if api.BytesIn != 950 || api.BytesOut != 9500 {
+		t.Errorf("bytes in %d, out %d; want 950, 9500", api.BytesIn, api.BytesOut)
+	}
+	if api.P95 != 5*time.Millisecond {
+		t.Errorf("p95 = %s, want 5ms (upper bound of the 3ms bucket)", api.P95)
+	}
+	want := []StatusCount{{200, 95}, {502, 3}, {404, 1}}
+	if len(api.Statuses) != len(want) {
+		t.Fatalf("statuses = %v, want %v", api.Statuses, want)
+	}
+	for i := range want {
+		if api.Statuses[i] != want[i] {
+			t.Errorf("statuses = %v, want %v", api.Statuses, want)
+			break
+		}
+	}
+}
+
+func TestRouteStats_Window(t *testing.T) {
+	mock := clock.NewMock(time.Unix(1000, 0))
+	s := &RouteStats{clock: mock}
+
+	s.Record(RouteRequest{Route: "old", Status: 200})
+	mock.Advance(RouteWindow / 2)
+	s.Record(RouteRequest{Route: "new", Status: 200})
+	s.Record(RouteRequest{Route: "new", Status: 200})
+
+	if snaps := s.Snapshot(); len(snaps) != 2 {
+		t.Fatalf("routes = %+v, want both inside the window", snaps)
+	}
+
+	// Requests leave the window once they are older than RouteWindow, and
+	// routes without requests are dropped
+	mock.Advance(RouteWindow/2 + routeSlot)
+	snaps := s.Snapshot()
+	if len(snaps) != 1 || snaps[0].Route != "new" || snaps[0].Requests != 2 {
+		t.Fatalf("routes = %+v, want only new with 2 requests", snaps)
+	}
+	mock.Advance(RouteWindow)
+	if snaps := s.Snapshot(); len(snaps) != 0 {
+		t.Errorf("routes after the window = %+v, want none", snaps)
+	}
+
+	// A ring slot reused after a full window starts from zero
+	s.Record(RouteRequest{Route: "new", Status: 201})
+	if snaps := s.Snapshot(); len(snaps) != 1 || snaps[0].Requests != 1 || snaps[0].Statuses[0].Status != 201 {
+		t.Errorf("routes = %+v, want a single fresh request", snaps)
+	}
+}
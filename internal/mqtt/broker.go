@@ -0,0 +1,136 @@
+package mqtt
+
+import (
+	"bufio"
+	"net"
+	"sync"
+)
+
+// Broker is a minimal in-process MQTT broker for tests: it accepts every
+// client and fans QoS 0 messages out to matching subscriptions
+type Broker struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	clients map[*brokerClient]bool
+}
+
+// brokerClient is one connection to the broker
+type brokerClient struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	filters []string // guarded by Broker.mu
+}
+
+func (c *brokerClient) send(header byte, body []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.Write(append(appendRemainingLength([]byte{header}, len(body)), body...))
+}
+
+// NewBroker starts a broker listening on addr (use 127.0.0.1:0 for a free port)
+func NewBroker(addr string) (*Broker, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	b := &Broker{ln: ln, clients: make(map[*brokerClient]bool)}
+	go b.accept()
+	return b, nil
+}
+
+// Addr returns the listen address
+func (b *Broker) Addr() string {
+	return b.ln.Addr().String()
+}
+
+// Close stops the broker and disconnects all clients
+func (b *Broker) Close() error {
+	err := b.ln.Close()
+	b.mu.Lock()
+	for c := range b.clients {
+		c.conn.Close()
+	}
+	b.mu.Unlock()
+	return err
+}
+
+func (b *Broker) accept() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &brokerClient{conn: conn}
+		b.mu.Lock()
+		b.clients[c] = true
+		b.mu.Unlock()
+		go b.serve(c)
+	}
+}
+
+func (b *Broker) serve(c *brokerClient) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+		c.conn.Close()
+	}()
+
+	r := bufio.NewReader(c.conn)
+	for {
+		kind, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch kind {
+		case packetConnect:
+			c.send(packetConnack<<4, []byte{0, 0})
+		case packetSubscribe:
+			if len(body) < 2 {
+				return
+			}
+			ack := append([]byte(nil), body[:2]...) // packet id
+			for rest := body[2:]; len(rest) > 0; {
+				filter, n, err := readString(rest)
+				if err != nil || len(rest) < n+1 {
+					return
+				}
+				b.mu.Lock()
+				c.filters = append(c.filters, filter)
+				b.mu.Unlock()
+				ack = append(ack, 0) // granted QoS 0
+				rest = rest[n+1:]
+			}
+			c.send(packetSuback<<4, ack)
+		case packetPublish:
+			topic, _, err := readString(body)
+			if err != nil {
+				return
+			}
+			b.publish(topic, body)
+		case packetPingreq:
+			c.send(packetPingresp<<4, nil)
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+// publish forwards a PUBLISH body to every client subscribed to topic
+func (b *Broker) publish(topic string, body []byte) {
+	var targets []*brokerClient
+	b.mu.Lock()
+	for c := range b.clients {
+		for _, filter := range c.filters {
+			if Match(filter, topic) {
+				targets = append(targets, c)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+	for _, c := range targets {
+		c.send(packetPublish<<4, body)
+	}
+}
@@ -0,0 +1,386 @@
+// Package mqtt is a minimal MQTT 3.1.1 client: connect, QoS 0 publish and
+// subscribe, keep-alive. It covers what the broker bridge backend needs and
+// nothing more; QoS 1/2, retained messages, wills and sessions are not
+// supported.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Packet types (high nibble of the fixed header)
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+	maxRemainingBytes = 268435455
+)
+
+// ErrClosed is returned by operations on a closed client
+var ErrClosed = errors.New("mqtt: client closed")
+
+// Handler receives messages for a subscription
+type Handler func(topic string, payload []byte)
+
+// Options configures a Client
+type Options struct {
+	ClientID string
+	Username string
+	Password string
+
+	// KeepAlive is the interval of PINGREQ packets (default 30s)
+	KeepAlive time.Duration
+
+	// Dialer opens the TCP connection (default net.Dialer)
+	Dialer func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Client is a connection to an MQTT broker. It is safe for concurrent use.
+type Client struct {
+	conn net.Conn
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	subacks  map[uint16]chan byte
+	nextID   uint16
+	err      error
+
+	done chan struct{}
+}
+
+// Dial connects to the broker at addr (host:port) and waits for CONNACK
+func Dial(ctx context.Context, addr string, opts Options) (*Client, error) {
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = 30 * time.Second
+	}
+	if opts.Dialer == nil {
+		var d net.Dialer
+		opts.Dialer = d.DialContext
+	}
+
+	conn, err := opts.Dialer(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(encodeConnect(opts)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: failed to send CONNECT: %w", err)
+	}
+	r := bufio.NewReader(conn)
+	kind, body, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: no CONNACK: %w", err)
+	}
+	if kind != packetConnack || len(body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: expected CONNACK, got packet type %d", kind)
+	}
+	if code := body[1]; code != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: connection refused: %s", connackReason(code))
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &Client{
+		conn:     conn,
+		handlers: make(map[string]Handler),
+		subacks:  make(map[uint16]chan byte),
+		done:     make(chan struct{}),
+	}
+	go c.readLoop(r)
+	go c.keepAlive(opts.KeepAlive)
+	return c, nil
+}
+
+// Publish sends payload to topic with QoS 0
+func (c *Client) Publish(topic string, payload []byte) error {
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	return c.write(packetPublish<<4, body)
+}
+
+// Subscribe subscribes to filter (which may contain + and # wildcards) with
+// QoS 0 and waits for SUBACK; matching messages are passed to handler
+func (c *Client) Subscribe(ctx context.Context, filter string, handler Handler) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	ack := make(chan byte, 1)
+	c.subacks[id] = ack
+	c.handlers[filter] = handler
+	c.mu.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	body = append(body, 0) // requested QoS 0
+	if err := c.write(packetSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+
+	select {
+	case code := <-ack:
+		if code == 0x80 {
+			c.mu.Lock()
+			delete(c.handlers, filter)
+			c.mu.Unlock()
+			return fmt.Errorf("mqtt: subscription to %q refused", filter)
+		}
+		return nil
+	case <-c.done:
+		return c.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done is closed when the connection ends
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the connection ended, nil while it is open
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close sends DISCONNECT and closes the connection
+func (c *Client) Close() error {
+	c.write(packetDisconnect<<4, nil)
+	c.fail(ErrClosed)
+	return nil
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	if len(body) > maxRemainingBytes {
+		return fmt.Errorf("mqtt: packet of %d bytes exceeds the protocol limit", len(body))
+	}
+	packet := appendRemainingLength([]byte{header}, len(body))
+	packet = append(packet, body...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.conn.Write(packet); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+// fail records the first error and closes the connection
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.conn.Close()
+	close(c.done)
+}
+
+func (c *Client) readLoop(r *bufio.Reader) {
+	for {
+		kind, body, err := readPacket(r)
+		if err != nil {
+			c.fail(fmt.Errorf("mqtt: connection lost: %w", err))
+			return
+		}
+		switch kind {
+		case packetPublish:
+			topic, n, err := readString(body)
+			if err != nil {
+				c.fail(fmt.Errorf("mqtt: invalid PUBLISH: %w", err))
+				return
+			}
+			c.deliver(topic, body[n:])
+		case packetSuback:
+			if len(body) < 3 {
+				continue
+			}
+			id := binary.BigEndian.Uint16(body)
+			c.mu.Lock()
+			ack, ok := c.subacks[id]
+			delete(c.subacks, id)
+			c.mu.Unlock()
+			if ok {
+				ack <- body[2]
+			}
+		case packetPingresp:
+		}
+	}
+}
+
+// deliver passes a message to every handler whose filter matches topic
+func (c *Client) deliver(topic string, payload []byte) {
+	c.mu.Lock()
+	var matched []Handler
+	for filter, handler := range c.handlers {
+		if Match(filter, topic) {
+			matched = append(matched, handler)
+		}
+	}
+	c.mu.Unlock()
+	for _, handler := range matched {
+		handler(topic, payload)
+	}
+}
+
+func (c *Client) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.write(packetPingreq<<4, nil)
+		}
+	}
+}
+
+// Match reports whether topic matches filter, where + matches one level and
+// a trailing # matches any number of levels
+func Match(filter, topic string) bool {
+	fl := strings.Split(filter, "/")
+	tl := strings.Split(topic, "/")
+	for i, f := range fl {
+		if f == "#" {
+			return true
+		}
+		if i >= len(tl) || (f != "+" && f != tl[i]) {
+			return false
+		}
+	}
+	return len(fl) == len(tl)
+}
+
+func encodeConnect(opts Options) []byte {
+	body := appendString(nil, "MQTT")
+	body = append(body, 4) // protocol level 3.1.1
+	flags := byte(0x02)    // clean session
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive/time.Second))
+	body = appendString(body, opts.ClientID)
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+		if opts.Password != "" {
+			body = appendString(body, opts.Password)
+		}
+	}
+	packet := appendRemainingLength([]byte{packetConnect << 4}, len(body))
+	return append(packet, body...)
+}
+
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	default:
+		return fmt.Sprintf("return code %d", code)
+	}
+}
+
+// readPacket reads one packet and returns its type and body
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+func appendRemainingLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (string, int, error) {
+	if len(b) < 2 {
+		return "", 0, io.ErrUnexpectedEOF
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", 0, io.ErrUnexpectedEOF
+	}
+	return string(b[2 : 2+n]), 2 + n, nil
+}
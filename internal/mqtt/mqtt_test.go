@@ -0,0 +1,82 @@
+package mqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/+/c", "a/b/c", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a/b/c", true},
+		{"a/#", "a", true},
+		{"#", "x/y", true},
+		{"a/b/c", "a/b", false},
+	}
+	for _, c := range cases {
+		if got := Match(c.filter, c.topic); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", c.filter, c.topic, got, c.want)
+		}
+	}
+}
+
+func TestClient_PublishSubscribe(t *testing.T) {
+	broker, err := NewBroker("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewBroker failed: %v", err)
+	}
+	defer broker.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := Dial(ctx, broker.Addr(), Options{ClientID: "sub"})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer sub.Close()
+	pub, err := Dial(ctx, broker.Addr(), Options{ClientID: "pub", Username: "u", Password: "p"})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer pub.Close()
+
+	received := make(chan string, 1)
+	if err := sub.Subscribe(ctx, "devices/+/reply", func(topic string, payload []byte) {
+		received <- topic + "=" + string(payload)
+	}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	pub.Publish("devices/42/other", []byte("ignored"))
+	if err := pub.Publish("devices/42/reply", []byte("ok")); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	select {
+	case got := <-received:
+		if got != "devices/42/reply=ok" {
+			t.Errorf("Unexpected message %q", got)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for message")
+	}
+
+	// Closing the broker ends the client with an error
+	broker.Close()
+	select {
+	case <-sub.Done():
+		if sub.Err() == nil {
+			t.Error("Expected an error after the broker closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("Client did not notice the broker closing")
+	}
+}
@@ -0,0 +1,170 @@
+// Package quota tracks the monthly usage of the tunnel (requests and bytes in
+// both directions) against configured caps. Usage is kept in a small state
+// file so restarts do not reset the month; the caller saves it periodically
+// and on shutdown. A new calendar month starts with zero usage.
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+// Options configures a quota
+type Options struct {
+	// Path of the state file holding the usage of the current month
+	Path string
+
+	// MaxRequests and MaxBytes cap the monthly usage, 0 means unlimited
+	MaxRequests int64
+	MaxBytes    int64
+
+	// Location defines month boundaries (default UTC)
+	Location *time.Location
+
+	Clock clock.Clock
+}
+
+// Usage is the usage within one month
+type Usage struct {
+	// Period is the month as "2006-01"
+	Period   string `json:"period"`
+	Requests int64  `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// Quota accumulates usage and reports when a cap is reached. A nil Quota
+// never exceeds.
+type Quota struct {
+	mu    sync.Mutex
+	opts  Options
+	clock clock.Clock
+	usage Usage
+	dirty bool
+}
+
+// Open loads the usage of the current month from the state file. A missing
+// file starts from zero; an unreadable one is an error so usage is never
+// reset by accident.
+func Open(opts Options) (*Quota, error) {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	q := &Quota{opts: opts, clock: clock.Or(opts.Clock)}
+
+	data, err := os.ReadFile(opts.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &q.usage); err != nil {
+			return nil, fmt.Errorf("%s: %w", opts.Path, err)
+		}
+	}
+	q.roll(q.clock.Now())
+	return q, nil
+}
+
+// roll starts a new period when the month changed
+func (q *Quota) roll(now time.Time) {
+	if period := now.In(q.opts.Location).Format("2006-01"); q.usage.Period != period {
+		q.usage = Usage{Period: period}
+		q.dirty = true
+	}
+}
+
+// Record adds requests and bytes to the usage of the current month
+func (q *Quota) Record(requests, bytes int64) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll(q.clock.Now())
+	q.usage.Requests += requests
+	q.usage.Bytes += bytes
+	q.dirty = true
+}
+
+// Exceeded returns why the quota is exhausted, "" while usage is below the
+// caps, and when the next period starts
+func (q *Quota) Exceeded() (string, time.Time) {
+	if q == nil {
+		return "", time.Time{}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.clock.Now()
+	q.roll(now)
+
+	var reason string
+	switch {
+	case q.opts.MaxRequests > 0 && q.usage.Requests >= q.opts.MaxRequests:
+		reason = fmt.Sprintf("monthly request quota of %d reached", q.opts.MaxRequests)
+	case q.opts.MaxBytes > 0 && q.usage.Bytes >= q.opts.MaxBytes:
+		reason = fmt.Sprintf("monthly bandwidth quota of %d bytes reached", q.opts.MaxBytes)
+	}
+	return reason, q.resetAt(now)
+}
+
+// resetAt returns the start of the month after now
+func (q *Quota) resetAt(now time.Time) time.Time {
+	local := now.In(q.opts.Location)
+	return time.Date(local.Year(), local.Month()+1, 1, 0, 0, 0, 0, q.opts.Location)
+}
+
+// Usage returns the usage of the current month
+func (q *Quota) Usage() Usage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll(q.clock.Now())
+	return q.usage
+}
+
+// Limits returns the configured caps
+func (q *Quota) Limits() (requests, bytes int64) {
+	return q.opts.MaxRequests, q.opts.MaxBytes
+}
+
+// Save writes the usage to the state file if it changed since the last save
+func (q *Quota) Save() error {
+	q.mu.Lock()
+	if !q.dirty {
+		q.mu.Unlock()
+		return nil
+	}
+	usage := q.usage
+	q.dirty = false
+	q.mu.Unlock()
+
+	if err := write(q.opts.Path, usage); err != nil {
+		q.mu.Lock()
+		q.dirty = true
+		q.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// write replaces the state file atomically
+func write(path string, usage Usage) error {
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
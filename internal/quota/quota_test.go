@@ -0,0 +1,73 @@
+package quota
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+func TestQuota(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 1, 31, 23, 0, 0, 0, time.UTC))
+	opts := Options{
+		Path:        filepath.Join(t.TempDir(), "state", "quota.json"),
+		MaxRequests: 3,
+		MaxBytes:    1000,
+		Clock:       clk,
+	}
+	q, err := Open(opts)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	q.Record(2, 100)
+	if reason, _ := q.Exceeded(); reason != "" {
+		t.Errorf("below caps: exceeded with %q", reason)
+	}
+	q.Record(1, 100)
+	reason, resetAt := q.Exceeded()
+	if !strings.Contains(reason, "request quota of 3") {
+		t.Errorf("reason = %q, want request quota", reason)
+	}
+	if want := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC); !resetAt.Equal(want) {
+		t.Errorf("resetAt = %v, want %v", resetAt, want)
+	}
+
+	// Usage survives a restart
+	if err := q.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	q, err = Open(opts)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if got := q.Usage(); got != (Usage{Period: "2024-01", Requests: 3, Bytes: 200}) {
+		t.Errorf("usage after reopen = %+v", got)
+	}
+
+	// A new month starts from zero
+	clk.Advance(2 * time.Hour)
+	if reason, _ := q.Exceeded(); reason != "" {
+		t.Errorf("new month: exceeded with %q", reason)
+	}
+	q.Record(1, 1000)
+	if reason, _ := q.Exceeded(); !strings.Contains(reason, "bandwidth quota") {
+		t.Errorf("reason = %q, want bandwidth quota", reason)
+	}
+	if got := q.Usage(); got.Period != "2024-02" || got.Requests != 1 {
+		t.Errorf("usage in new month = %+v", got)
+	}
+}
+
+func TestOpen_CorruptState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(Options{Path: path}); err == nil {
+		t.Error("Open succeeded with a corrupt state file")
+	}
+}
@@ -0,0 +1,171 @@
+// Package schedule parses weekly time windows such as "Mon-Fri 09:00-18:00"
+// and reports whether a moment falls inside one, so tunnels and backends can
+// be exposed only during configured hours.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a set of weekly windows in one time zone. A nil Schedule is
+// always active.
+type Schedule struct {
+	windows []window
+	loc     *time.Location
+}
+
+// window is active on days from start to end minutes after midnight; end
+// before start means the window continues past midnight into the next day
+type window struct {
+	days       [7]bool
+	start, end int
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Parse parses windows in the form "[days] HH:MM-HH:MM", where days is a
+// comma-separated list of days or day ranges (Mon-Fri, Sat,Sun); without
+// days the window applies every day. timezone is an IANA name, empty means
+// local time. No windows returns a nil (always active) Schedule.
+func Parse(windows []string, timezone string) (*Schedule, error) {
+	loc := time.Local
+	if timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q, use an IANA name such as Europe/Berlin", timezone)
+		}
+	}
+	if len(windows) == 0 {
+		return nil, nil
+	}
+
+	s := &Schedule{loc: loc}
+	for _, spec := range windows {
+		w, err := parseWindow(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", spec, err)
+		}
+		s.windows = append(s.windows, w)
+	}
+	return s, nil
+}
+
+func parseWindow(spec string) (window, error) {
+	var w window
+	fields := strings.Fields(spec)
+	var times string
+	switch len(fields) {
+	case 1:
+		times = fields[0]
+		for d := range w.days {
+			w.days[d] = true
+		}
+	case 2:
+		times = fields[1]
+		for _, part := range strings.Split(fields[0], ",") {
+			from, to, isRange := strings.Cut(part, "-")
+			first, ok := weekdays[strings.ToLower(from)]
+			if !ok {
+				return w, fmt.Errorf("unknown day %q, use Mon, Tue, ... Sun", from)
+			}
+			last := first
+			if isRange {
+				if last, ok = weekdays[strings.ToLower(to)]; !ok {
+					return w, fmt.Errorf("unknown day %q, use Mon, Tue, ... Sun", to)
+				}
+			}
+			for d := first; ; d = (d + 1) % 7 {
+				w.days[d] = true
+				if d == last {
+					break
+				}
+			}
+		}
+	default:
+		return w, fmt.Errorf("expected \"[days] HH:MM-HH:MM\", e.g. Mon-Fri 09:00-18:00")
+	}
+
+	from, to, ok := strings.Cut(times, "-")
+	if !ok {
+		return w, fmt.Errorf("expected a time range HH:MM-HH:MM, got %q", times)
+	}
+	var err error
+	if w.start, err = parseClock(from); err != nil {
+		return w, err
+	}
+	if w.end, err = parseClock(to); err != nil {
+		return w, err
+	}
+	if w.start == w.end {
+		return w, fmt.Errorf("window starts and ends at %s", from)
+	}
+	return w, nil
+}
+
+// parseClock parses HH:MM (24:00 allowed as end of day) into minutes
+func parseClock(value string) (int, error) {
+	h, m, ok := strings.Cut(value, ":")
+	hour, herr := strconv.Atoi(h)
+	minute, merr := strconv.Atoi(m)
+	if !ok || herr != nil || merr != nil || hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM such as 09:00", value)
+	}
+	return hour*60 + minute, nil
+}
+
+// Active reports whether t falls inside any window
+func (s *Schedule) Active(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	t = t.In(s.loc)
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if w.days[today] && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		// Overnight window: evening part today or morning part from yesterday
+		if (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the next time after t at which the schedule becomes active,
+// or t itself when it is already active
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.Active(t) {
+		return t
+	}
+	local := t.In(s.loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.loc)
+	var next time.Time
+	for day := 0; day <= 7; day++ {
+		date := midnight.AddDate(0, 0, day)
+		for _, w := range s.windows {
+			if !w.days[date.Weekday()] {
+				continue
+			}
+			start := date.Add(time.Duration(w.start) * time.Minute)
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+		if !next.IsZero() {
+			return next
+		}
+	}
+	return next
+}
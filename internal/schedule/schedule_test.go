@@ -0,0 +1,70 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	for _, windows := range [][]string{
+		{"Mon-Fri"},
+		{"Funday 09:00-17:00"},
+		{"Mon 9-17"},
+		{"Mon 25:00-26:00"},
+		{"10:00-10:00"},
+		{"Mon Tue 09:00-17:00"},
+	} {
+		if _, err := Parse(windows, "UTC"); err == nil {
+			t.Errorf("Parse(%q) should fail", windows)
+		}
+	}
+	if _, err := Parse([]string{"09:00-17:00"}, "Mars/Olympus"); err == nil {
+		t.Error("unknown time zone should fail")
+	}
+	if s, err := Parse(nil, ""); s != nil || err != nil {
+		t.Errorf("no windows should be always active, got %v, %v", s, err)
+	}
+}
+
+func TestSchedule_Active(t *testing.T) {
+	s, err := Parse([]string{"Mon-Fri 09:00-18:00", "Sat 22:00-02:00"}, "UTC")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	// 2026-10-12 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+	cases := []struct {
+		t    time.Time
+		want bool
+	}{
+		{at(12, 9, 0), true},
+		{at(12, 8, 59), false},
+		{at(16, 17, 59), true},
+		{at(16, 18, 0), false},
+		{at(17, 12, 0), false}, // Saturday midday
+		{at(17, 23, 0), true},  // Saturday night
+		{at(18, 1, 59), true},  // Sunday morning, overnight from Saturday
+		{at(18, 2, 0), false},
+		{at(18, 23, 0), false},
+	}
+	for _, c := range cases {
+		if got := s.Active(c.t); got != c.want {
+			t.Errorf("Active(%s) = %v, want %v", c.t.Format("Mon 15:04"), got, c.want)
+		}
+	}
+
+	if next := s.Next(at(16, 19, 0)); !next.Equal(at(17, 22, 0)) {
+		t.Errorf("Next after Friday close = %s, want Saturday 22:00", next)
+	}
+	if next := s.Next(at(18, 3, 0)); !next.Equal(at(19, 9, 0)) {
+		t.Errorf("Next after Sunday = %s, want Monday 09:00", next)
+	}
+
+	var always *Schedule
+	if !always.Active(at(18, 3, 0)) {
+		t.Error("nil schedule should always be active")
+	}
+}
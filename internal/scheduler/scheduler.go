@@ -0,0 +1,258 @@
+// Package scheduler runs the agent's periodic background jobs (heartbeats,
+// probes, leak checks, update checks, ...) on one clock with a shared
+// lifecycle: jobs can be paused and resumed by name, are stopped together,
+// and report their last run so stuck or failing jobs are visible.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+)
+
+var (
+	// ErrDuplicateJob is returned by Add for a name that is already scheduled
+	ErrDuplicateJob = errors.New("job already scheduled")
+	// ErrUnknownJob is returned for a name that is not scheduled
+	ErrUnknownJob = errors.New("unknown job")
+)
+
+// Job is a function run every Interval
+type Job struct {
+	// Name identifies the job in Pause, Resume, Remove and Jobs
+	Name string
+	// Interval between the end of one run and the start of the next
+	Interval time.Duration
+	// Jitter randomizes each delay by up to ±Jitter×Interval (0 to 1), so
+	// agents started together do not hit Core or update servers in lockstep
+	Jitter float64
+	// Run does the work; ctx is cancelled when the job is removed or the
+	// scheduler stops
+	Run func(ctx context.Context)
+}
+
+// Status is the state of a scheduled job
+type Status struct {
+	Name     string        `json:"name"`
+	Interval time.Duration `json:"interval"`
+	Paused   bool          `json:"paused"`
+	Running  bool          `json:"running"`
+	Runs     int64         `json:"runs"`
+	// Skipped counts runs skipped while paused
+	Skipped int64 `json:"skipped"`
+	// Panics counts runs that panicked; the job keeps being scheduled
+	Panics       int64         `json:"panics"`
+	LastRun      time.Time     `json:"last_run,omitempty"`
+	LastDuration time.Duration `json:"last_duration"`
+	NextRun      time.Time     `json:"next_run,omitempty"`
+}
+
+// job is a scheduled Job and its state, guarded by Scheduler.mu
+type job struct {
+	Job
+	cancel context.CancelFunc
+	done   chan struct{}
+	status Status
+}
+
+// Scheduler runs Jobs. Jobs added before Start begin when Start is called;
+// jobs added afterwards begin immediately.
+type Scheduler struct {
+	clock clock.Clock
+
+	mu   sync.Mutex
+	ctx  context.Context // nil until Start
+	jobs map[string]*job
+}
+
+// New creates a Scheduler driven by c (nil means clock.Real)
+func New(c clock.Clock) *Scheduler {
+	return &Scheduler{clock: clock.Or(c), jobs: make(map[string]*job)}
+}
+
+// Start runs the scheduled jobs until ctx is cancelled or Stop is called
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx != nil {
+		return
+	}
+	s.ctx = ctx
+	for _, j := range s.jobs {
+		s.launchLocked(j)
+	}
+}
+
+// Stop cancels all jobs and waits for running ones to return
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	jobs := s.jobs
+	s.jobs = make(map[string]*job)
+	for _, j := range jobs {
+		if j.cancel != nil {
+			j.cancel()
+		}
+	}
+	s.mu.Unlock()
+
+	for _, j := range jobs {
+		if j.done != nil {
+			<-j.done
+		}
+	}
+}
+
+// Add schedules j; its first run is one Interval (with jitter) from now
+func (s *Scheduler) Add(j Job) error {
+	if j.Interval <= 0 || j.Run == nil {
+		return fmt.Errorf("job %q: interval must be positive and Run set", j.Name)
+	}
+	if j.Jitter < 0 || j.Jitter > 1 {
+		return fmt.Errorf("job %q: jitter must be between 0 and 1", j.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[j.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, j.Name)
+	}
+	scheduled := &job{Job: j, status: Status{Name: j.Name, Interval: j.Interval}}
+	s.jobs[j.Name] = scheduled
+	if s.ctx != nil {
+		s.launchLocked(scheduled)
+	}
+	return nil
+}
+
+// Remove cancels the named job and waits for a running run to return
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	if ok {
+		delete(s.jobs, name)
+		if j.cancel != nil {
+			j.cancel()
+		}
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+	if j.done != nil {
+		<-j.done
+	}
+	return nil
+}
+
+// Pause skips the named job's runs until Resume; a run in progress finishes
+func (s *Scheduler) Pause(name string) error {
+	return s.setPaused(name, true)
+}
+
+// Resume undoes Pause; the job runs again at its next scheduled time
+func (s *Scheduler) Resume(name string) error {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+	j.status.Paused = paused
+	return nil
+}
+
+// Jobs returns the status of all scheduled jobs sorted by name
+func (s *Scheduler) Jobs() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Status, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		out = append(out, j.status)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name < out[b].Name })
+	return out
+}
+
+// launchLocked starts the goroutine running j
+func (s *Scheduler) launchLocked(j *job) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	j.cancel = cancel
+	j.done = make(chan struct{})
+	go s.loop(ctx, j)
+}
+
+// loop waits out each delay and runs j until ctx is cancelled
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	defer close(j.done)
+	for {
+		delay := s.delay(j.Job)
+		s.mu.Lock()
+		j.status.NextRun = s.clock.Now().Add(delay)
+		s.mu.Unlock()
+
+		timer := s.clock.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+
+		s.mu.Lock()
+		paused := j.status.Paused
+		if paused {
+			j.status.Skipped++
+		} else {
+			j.status.Running = true
+		}
+		s.mu.Unlock()
+		if !paused {
+			s.run(ctx, j)
+		}
+	}
+}
+
+// run runs j once, recovering panics so one faulty job does not take down
+// the agent
+func (s *Scheduler) run(ctx context.Context, j *job) {
+	start := s.clock.Now()
+	panicked := false
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			logger.Error("Scheduled job panicked", "job", j.Name, "panic", r)
+		}
+		s.mu.Lock()
+		j.status.Running = false
+		j.status.Runs++
+		j.status.LastRun = start
+		j.status.LastDuration = s.clock.Since(start)
+		if panicked {
+			j.status.Panics++
+		}
+		s.mu.Unlock()
+	}()
+	j.Run(ctx)
+}
+
+// delay returns Interval randomized by Jitter
+func (s *Scheduler) delay(j Job) time.Duration {
+	if j.Jitter == 0 {
+		return j.Interval
+	}
+	spread := j.Jitter * float64(j.Interval)
+	d := time.Duration(float64(j.Interval) + (rand.Float64()*2-1)*spread)
+	return max(d, time.Millisecond)
+}
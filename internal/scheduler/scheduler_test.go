@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+func TestScheduler_RunsPausesAndResumes(t *testing.T) {
+	mock := clock.NewMock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := New(mock)
+	runs := make(chan struct{}, 10)
+	if err := s.Add(Job{Name: "probe", Interval: 10 * time.Second, Run: func(context.Context) { runs <- struct{}{} }}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	s.Start(context.Background())
+	defer s.Stop()
+
+	mock.BlockUntil(1)
+	mock.Advance(10 * time.Second)
+	<-runs
+
+	if err := s.Pause("probe"); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+	mock.BlockUntil(1)
+	mock.Advance(10 * time.Second)
+	mock.BlockUntil(1)
+	select {
+	case <-runs:
+		t.Fatal("paused job should not run")
+	default:
+	}
+
+	if err := s.Resume("probe"); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	mock.Advance(10 * time.Second)
+	<-runs
+	mock.BlockUntil(1)
+
+	jobs := s.Jobs()
+	if len(jobs) != 1 || jobs[0].Runs != 2 || jobs[0].Skipped != 1 || jobs[0].Paused {
+		t.Errorf("unexpected status: %+v", jobs)
+	}
+	if want := mock.Now().Add(10 * time.Second); !jobs[0].NextRun.Equal(want) {
+		t.Errorf("NextRun = %v, want %v", jobs[0].NextRun, want)
+	}
+}
+
+func TestScheduler_RecoversPanics(t *testing.T) {
+	mock := clock.NewMock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := New(mock)
+	s.Start(context.Background())
+	defer s.Stop()
+
+	if err := s.Add(Job{Name: "faulty", Interval: time.Second, Run: func(context.Context) { panic("boom") }}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		mock.BlockUntil(1)
+		mock.Advance(time.Second)
+	}
+	mock.BlockUntil(1)
+
+	if jobs := s.Jobs(); jobs[0].Panics != 2 || jobs[0].Runs != 2 {
+		t.Errorf("job should keep running after panics: %+v", jobs[0])
+	}
+}
+
+func TestScheduler_RemoveCancelsRun(t *testing.T) {
+	mock := clock.NewMock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := New(mock)
+	s.Start(context.Background())
+
+	started := make(chan struct{})
+	s.Add(Job{Name: "slow", Interval: time.Second, Run: func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+	}})
+	mock.BlockUntil(1)
+	mock.Advance(time.Second)
+	<-started
+
+	if err := s.Remove("slow"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if len(s.Jobs()) != 0 {
+		t.Error("removed job should not be listed")
+	}
+	if err := s.Remove("slow"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("second Remove: got %v, want ErrUnknownJob", err)
+	}
+	s.Stop()
+}
+
+func TestScheduler_AddValidation(t *testing.T) {
+	s := New(nil)
+	run := func(context.Context) {}
+	if err := s.Add(Job{Name: "a", Interval: time.Second, Run: run}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := s.Add(Job{Name: "a", Interval: time.Second, Run: run}); !errors.Is(err, ErrDuplicateJob) {
+		t.Errorf("duplicate: got %v, want ErrDuplicateJob", err)
+	}
+	for _, j := range []Job{
+		{Name: "zero", Run: run},
+		{Name: "norun", Interval: time.Second},
+		{Name: "jitter", Interval: time.Second, Jitter: 1.5, Run: run},
+	} {
+		if err := s.Add(j); err == nil {
+			t.Errorf("Add(%s) should fail", j.Name)
+		}
+	}
+	if err := s.Pause("missing"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Pause unknown: got %v, want ErrUnknownJob", err)
+	}
+}
+
+func TestScheduler_Jitter(t *testing.T) {
+	s := New(nil)
+	j := Job{Interval: 10 * time.Second, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		if d := s.delay(j); d < 8*time.Second || d > 12*time.Second {
+			t.Fatalf("delay %v outside ±20%% of 10s", d)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+// AWSCredentials sign requests to AWS
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// EnvAWSCredentials reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN on every call, so rotated credentials are used
+func EnvAWSCredentials() (AWSCredentials, error) {
+	creds := AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return AWSCredentials{}, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+	return creds, nil
+}
+
+// AWS reads secrets from AWS Secrets Manager. Names are "<secret id or
+// ARN>[#<json key>]": without a key the whole SecretString is returned, with
+// a key SecretString must be a JSON object. AWSCURRENT is always read, so
+// the next fetch after a rotation returns the new value.
+type AWS struct {
+	// Region of Secrets Manager, e.g. eu-west-1
+	Region string
+	// Endpoint overrides https://secretsmanager.<region>.amazonaws.com
+	// (VPC endpoints, LocalStack)
+	Endpoint string
+	// Credentials returns the keys signing each request (nil = EnvAWSCredentials)
+	Credentials func() (AWSCredentials, error)
+	// Client sends the requests (nil = http.DefaultClient)
+	Client *http.Client
+
+	clock clock.Clock
+}
+
+// Fetch reads the current version of the secret
+func (a *AWS) Fetch(ctx context.Context, name string) (string, error) {
+	id, key, hasKey := strings.Cut(name, "#")
+	if id == "" || hasKey && key == "" {
+		return "", fmt.Errorf("%q must be <secret id>[#<json key>]", name)
+	}
+	credentials := a.Credentials
+	if credentials == nil {
+		credentials = EnvAWSCredentials
+	}
+	creds, err := credentials()
+	if err != nil {
+		return "", fmt.Errorf("aws credentials: %w", err)
+	}
+
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + a.Region + ".amazonaws.com"
+	}
+	body, _ := json.Marshal(map[string]string{"SecretId": id})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWS(req, body, creds, a.Region, "secretsmanager", clock.Or(a.clock).Now())
+
+	var resp struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := doJSON(a.Client, req, &resp); err != nil {
+		return "", err
+	}
+	if resp.SecretString == nil {
+		return "", errors.New("secret has no SecretString (binary secrets are not supported)")
+	}
+	if hasKey {
+		return jsonField(*resp.SecretString, key)
+	}
+	return *resp.SecretString, nil
+}
+
+// signAWS adds Signature Version 4 headers to req. Only the host, the
+// X-Amz-* headers and Content-Type are signed.
+func signAWS(req *http.Request, body []byte, creds AWSCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
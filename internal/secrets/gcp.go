@@ -0,0 +1,136 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+const (
+	gcpEndpoint      = "https://secretmanager.googleapis.com"
+	gcpMetadataToken = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// GCP reads secrets from GCP Secret Manager. Names are "<secret>[#<version>]"
+// in Project, or a full "projects/<project>/secrets/<secret>[#<version>]";
+// the version defaults to latest, so the next fetch after a rotation returns
+// the new version.
+type GCP struct {
+	// Project holding secrets given by short name
+	Project string
+	// Endpoint overrides https://secretmanager.googleapis.com
+	Endpoint string
+	// Token returns an OAuth access token (nil = GOOGLE_OAUTH_ACCESS_TOKEN,
+	// else the service account of the metadata server)
+	Token func(ctx context.Context) (string, error)
+	// Client sends the requests (nil = http.DefaultClient)
+	Client *http.Client
+
+	mu      sync.Mutex
+	cached  string // access token of the metadata server
+	expires time.Time
+	clock   clock.Clock
+}
+
+// gcpAccessResponse is the body of versions.access
+type gcpAccessResponse struct {
+	Payload struct {
+		Data       string `json:"data"`
+		DataCrc32c string `json:"dataCrc32c"`
+	} `json:"payload"`
+}
+
+// Fetch reads a version of the secret and verifies its checksum
+func (g *GCP) Fetch(ctx context.Context, name string) (string, error) {
+	secret, version, hasVersion := strings.Cut(name, "#")
+	if !hasVersion {
+		version = "latest"
+	}
+	if !strings.HasPrefix(secret, "projects/") {
+		if g.Project == "" {
+			return "", fmt.Errorf("%q has no project; use projects/<project>/secrets/<secret> or set the project", name)
+		}
+		secret = "projects/" + g.Project + "/secrets/" + secret
+	}
+	if strings.Count(secret, "/") != 3 || version == "" {
+		return "", fmt.Errorf("%q must be [projects/<project>/secrets/]<secret>[#<version>]", name)
+	}
+
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return "", fmt.Errorf("gcp token: %w", err)
+	}
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = gcpEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimRight(endpoint, "/")+"/v1/"+secret+"/versions/"+version+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var resp gcpAccessResponse
+	if err := doJSON(g.Client, req, &resp); err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("invalid payload: %w", err)
+	}
+	if resp.Payload.DataCrc32c != "" {
+		want, err := strconv.ParseUint(resp.Payload.DataCrc32c, 10, 32)
+		if err != nil || crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)) != uint32(want) {
+			return "", errors.New("payload checksum mismatch")
+		}
+	}
+	return string(data), nil
+}
+
+// accessToken returns the OAuth token of Token, GOOGLE_OAUTH_ACCESS_TOKEN or
+// the metadata server; metadata tokens are cached until shortly before expiry
+func (g *GCP) accessToken(ctx context.Context) (string, error) {
+	if g.Token != nil {
+		return g.Token(ctx)
+	}
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := clock.Or(g.clock).Now()
+	if g.cached != "" && now.Before(g.expires) {
+		return g.cached, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataToken, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := doJSON(g.Client, req, &resp); err != nil {
+		return "", fmt.Errorf("metadata server: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return "", errors.New("metadata server returned no access token")
+	}
+	g.cached = resp.AccessToken
+	g.expires = now.Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+	return g.cached, nil
+}
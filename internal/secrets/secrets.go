@@ -0,0 +1,174 @@
+// Package secrets fetches agent secrets from external secret managers:
+// HashiCorp Vault (KV v2), AWS Secrets Manager and GCP Secret Manager. Each
+// manager is a SecretProvider; a Store resolves references through them and
+// re-fetches the values it has handed out so rotated secrets are picked up.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reference sources served by the providers of this package
+const (
+	SourceVault = "vault"
+	SourceAWS   = "aws-sm"
+	SourceGCP   = "gcp-sm"
+)
+
+// DefaultTimeout bounds a single fetch from a secret manager
+const DefaultTimeout = 10 * time.Second
+
+// maxResponseSize caps the responses read from secret managers
+const maxResponseSize = 1 << 20
+
+// ErrNotFound is returned when the secret (or the field of a secret) does not exist
+var ErrNotFound = errors.New("secret not found")
+
+// SecretProvider fetches secrets from one secret manager. Name is the part of
+// a secret reference after the source prefix, e.g. "kv/agent#token" for
+// vault:kv/agent#token; its syntax is defined by the provider.
+type SecretProvider interface {
+	Fetch(ctx context.Context, name string) (string, error)
+}
+
+// Store resolves secret references through providers keyed by source and
+// remembers the values it returned, so Refresh can detect rotation
+type Store struct {
+	mu        sync.Mutex
+	providers map[string]SecretProvider
+	values    map[string]string // "source:name" -> last fetched value
+}
+
+// NewStore creates a Store serving the given sources
+func NewStore(providers map[string]SecretProvider) *Store {
+	return &Store{providers: providers, values: make(map[string]string)}
+}
+
+// Has reports whether a provider is configured for source
+func (s *Store) Has(source string) bool {
+	_, ok := s.providers[source]
+	return ok
+}
+
+// Get fetches source:name. The value is remembered for Refresh.
+func (s *Store) Get(ctx context.Context, source, name string) (string, error) {
+	provider, ok := s.providers[source]
+	if !ok {
+		return "", fmt.Errorf("no %s provider is configured", source)
+	}
+	value, err := provider.Fetch(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("%s:%s: %w", source, name, err)
+	}
+	if value == "" {
+		return "", fmt.Errorf("%s:%s is empty", source, name)
+	}
+
+	s.mu.Lock()
+	s.values[source+":"+name] = value
+	s.mu.Unlock()
+	return value, nil
+}
+
+// Value returns the last value fetched for ref ("<source>:<name>")
+func (s *Store) Value(ref string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[ref]
+	return value, ok
+}
+
+// Refresh re-fetches every reference returned by Get and reports those whose
+// value changed, sorted. A reference that fails to fetch keeps its previous
+// value and is reported in the error.
+func (s *Store) Refresh(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	refs := make([]string, 0, len(s.values))
+	for ref := range s.values {
+		refs = append(refs, ref)
+	}
+	s.mu.Unlock()
+	sort.Strings(refs)
+
+	var changed []string
+	var errs []error
+	for _, ref := range refs {
+		source, name, _ := strings.Cut(ref, ":")
+		fetchCtx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+		value, err := s.providers[source].Fetch(fetchCtx, name)
+		cancel()
+		if err == nil && value == "" {
+			err = errors.New("secret is empty")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ref, err))
+			continue
+		}
+
+		s.mu.Lock()
+		if s.values[ref] != value {
+			s.values[ref] = value
+			changed = append(changed, ref)
+		}
+		s.mu.Unlock()
+	}
+	return changed, errors.Join(errs...)
+}
+
+// doJSON sends req and decodes a 2xx JSON response into out. 404 maps to
+// ErrNotFound; other statuses report the start of the response body.
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		detail := strings.TrimSpace(string(body))
+		if len(detail) > 256 {
+			detail = detail[:256] + "..."
+		}
+		return fmt.Errorf("%s: %s", resp.Status, detail)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// jsonField returns the string field key of a JSON object secret
+func jsonField(secret, key string) (string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, cannot select %q", key)
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("field %q: %w", key, ErrNotFound)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("field %q is not a string", key)
+	}
+	return s, nil
+}
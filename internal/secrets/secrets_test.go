@@ -0,0 +1,241 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+func TestVault_Fetch(t *testing.T) {
+	version := "v1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.Header.Get("X-Vault-Namespace") != "team" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/tunnel/agent" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"data":{"data":{"token":"tok-%s","port":8080},"metadata":{"version":2}}}`, version)
+	}))
+	defer server.Close()
+
+	token := "root"
+	v := &Vault{Address: server.URL, Namespace: "team", Mount: "kv", Token: func() (string, error) { return token, nil }}
+	if got, err := v.Fetch(context.Background(), "tunnel/agent#token"); err != nil || got != "tok-v1" {
+		t.Fatalf("Fetch = %q, %v; want tok-v1", got, err)
+	}
+
+	for name, want := range map[string]string{
+		"tunnel/agent":         "must be <path>#<field>",
+		"tunnel/agent#missing": ErrNotFound.Error(),
+		"tunnel/agent#port":    "not a string",
+		"tunnel/other#token":   ErrNotFound.Error(),
+	} {
+		if _, err := v.Fetch(context.Background(), name); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Fetch(%q) error = %v, want %q", name, err, want)
+		}
+	}
+	token = "revoked"
+	if _, err := v.Fetch(context.Background(), "tunnel/agent#token"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Fetch with a revoked token = %v, want 403", err)
+	}
+}
+
+func TestSignAWS_TestSuiteVector(t *testing.T) {
+	// get-vanilla of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWS(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAWS_Fetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/secretsmanager/aws4_request") ||
+			r.Header.Get("X-Amz-Security-Token") != "session" {
+			http.Error(w, "bad signature", http.StatusForbidden)
+			return
+		}
+		var req struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.SecretId {
+		case "tunnel/token":
+			fmt.Fprint(w, `{"SecretString":"plain-token"}`)
+		case "tunnel/backends":
+			fmt.Fprint(w, `{"SecretString":"{\"orders\":\"s3cret\"}"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type":"ResourceNotFoundException"}`)
+		}
+	}))
+	defer server.Close()
+
+	a := &AWS{
+		Region:      "eu-west-1",
+		Endpoint:    server.URL,
+		Credentials: func() (AWSCredentials, error) { return AWSCredentials{"AKID", "secret", "session"}, nil },
+	}
+	for name, want := range map[string]string{"tunnel/token": "plain-token", "tunnel/backends#orders": "s3cret"} {
+		if got, err := a.Fetch(context.Background(), name); err != nil || got != want {
+			t.Errorf("Fetch(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"tunnel/token#key", "tunnel/backends#missing", "tunnel/unknown", "#key"} {
+		if _, err := a.Fetch(context.Background(), name); err == nil {
+			t.Errorf("Fetch(%q) succeeded", name)
+		}
+	}
+}
+
+func TestGCP_Fetch(t *testing.T) {
+	payload := func(data string, crc uint32) string {
+		return fmt.Sprintf(`{"payload":{"data":%q,"dataCrc32c":"%d"}}`,
+			base64.StdEncoding.EncodeToString([]byte(data)), crc)
+	}
+	checksum := func(data string) uint32 { return crc32.Checksum([]byte(data), crc32.MakeTable(crc32.Castagnoli)) }
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ya29.test" {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/projects/prod/secrets/agent-token/versions/latest:access":
+			fmt.Fprint(w, payload("tok-latest", checksum("tok-latest")))
+		case "/v1/projects/other/secrets/agent-token/versions/3:access":
+			fmt.Fprint(w, payload("tok-3", checksum("tok-3")))
+		case "/v1/projects/prod/secrets/corrupt/versions/latest:access":
+			fmt.Fprint(w, payload("tok", checksum("other")))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	g := &GCP{Project: "prod", Endpoint: server.URL, Token: func(context.Context) (string, error) { return "ya29.test", nil }}
+	for name, want := range map[string]string{
+		"agent-token":                              "tok-latest",
+		"projects/other/secrets/agent-token#3":     "tok-3",
+		"projects/prod/secrets/agent-token#latest": "tok-latest",
+	} {
+		if got, err := g.Fetch(context.Background(), name); err != nil || got != want {
+			t.Errorf("Fetch(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := g.Fetch(context.Background(), "corrupt"); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("corrupt payload accepted: %v", err)
+	}
+	if _, err := g.Fetch(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing secret error = %v, want ErrNotFound", err)
+	}
+	if _, err := (&GCP{Token: g.Token}).Fetch(context.Background(), "agent-token"); err == nil {
+		t.Error("short name without a project accepted")
+	}
+}
+
+func TestGCP_MetadataTokenCached(t *testing.T) {
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+	var tokenRequests int
+	mock := clock.NewMock(time.Unix(1000, 0))
+	g := &GCP{Project: "prod", clock: mock, Client: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if r.URL.Host == "metadata.google.internal" {
+			tokenRequests++
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				return jsonResponse(http.StatusForbidden, `{}`), nil
+			}
+			return jsonResponse(http.StatusOK, `{"access_token":"ya29.meta","expires_in":3600}`), nil
+		}
+		if r.Header.Get("Authorization") != "Bearer ya29.meta" {
+			return jsonResponse(http.StatusUnauthorized, `{}`), nil
+		}
+		return jsonResponse(http.StatusOK, `{"payload":{"data":"dG9r"}}`), nil
+	})}}
+
+	for i := 0; i < 3; i++ {
+		if got, err := g.Fetch(context.Background(), "agent-token"); err != nil || got != "tok" {
+			t.Fatalf("Fetch = %q, %v", got, err)
+		}
+	}
+	mock.Advance(time.Hour)
+	g.Fetch(context.Background(), "agent-token")
+	if tokenRequests != 2 {
+		t.Errorf("metadata token requested %d times, want once per token lifetime (2)", tokenRequests)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func jsonResponse(status int, body string) *http.Response {
+	return &http.Response{StatusCode: status, Status: http.StatusText(status), Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}
+}
+
+// fakeProvider serves values by name
+type fakeProvider struct {
+	values map[string]string
+	err    error
+}
+
+func (p *fakeProvider) Fetch(ctx context.Context, name string) (string, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+	value, ok := p.values[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func TestStore_Refresh(t *testing.T) {
+	vault := &fakeProvider{values: map[string]string{"agent#token": "t1", "db#password": "p1", "blank#x": ""}}
+	store := NewStore(map[string]SecretProvider{SourceVault: vault})
+
+	if got, err := store.Get(context.Background(), SourceVault, "agent#token"); err != nil || got != "t1" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+	store.Get(context.Background(), SourceVault, "db#password")
+	if _, err := store.Get(context.Background(), SourceVault, "blank#x"); err == nil {
+		t.Error("empty secret accepted")
+	}
+	if _, err := store.Get(context.Background(), SourceAWS, "token"); err == nil || !strings.Contains(err.Error(), "no aws-sm provider") {
+		t.Errorf("unconfigured provider error = %v", err)
+	}
+
+	if changed, err := store.Refresh(context.Background()); err != nil || len(changed) != 0 {
+		t.Errorf("Refresh without rotation = %v, %v", changed, err)
+	}
+	vault.values["agent#token"] = "t2"
+	if changed, err := store.Refresh(context.Background()); err != nil || len(changed) != 1 || changed[0] != "vault:agent#token" {
+		t.Errorf("Refresh after rotation = %v, %v; want [vault:agent#token]", changed, err)
+	}
+
+	// Secret manager unavailable: previous values stay, nothing reported as changed
+	vault.err = errors.New("connection refused")
+	if changed, err := store.Refresh(context.Background()); err == nil || len(changed) != 0 {
+		t.Errorf("Refresh during an outage = %v, %v; want errors only", changed, err)
+	}
+	vault.err = nil
+	if changed, _ := store.Refresh(context.Background()); len(changed) != 0 {
+		t.Errorf("Refresh after the outage reported %v as changed", changed)
+	}
+}
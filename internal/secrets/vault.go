@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultVaultMount is the mount of the KV v2 secrets engine
+const DefaultVaultMount = "secret"
+
+// Vault reads secrets from a HashiCorp Vault KV v2 engine. Names are
+// "<path>#<field>", e.g. vault:tunnel/agent#token reads field token of
+// secret/data/tunnel/agent. The latest version is always read, so a new
+// version written by rotation is returned by the next fetch.
+type Vault struct {
+	// Address of the Vault server, e.g. https://vault.example.com:8200
+	Address string
+	// Namespace is sent as X-Vault-Namespace (Vault Enterprise)
+	Namespace string
+	// Mount of the KV v2 engine (default DefaultVaultMount)
+	Mount string
+	// Token returns the Vault token for each request, so a token file
+	// renewed by Vault Agent is re-read
+	Token func() (string, error)
+	// Client sends the requests (nil = http.DefaultClient)
+	Client *http.Client
+}
+
+// vaultResponse is the body of a KV v2 read
+type vaultResponse struct {
+	Data struct {
+		Data map[string]any `json:"data"`
+	} `json:"data"`
+}
+
+// Fetch reads field of the latest version of path
+func (v *Vault) Fetch(ctx context.Context, name string) (string, error) {
+	path, field, ok := strings.Cut(name, "#")
+	path = strings.Trim(path, "/")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("%q must be <path>#<field>", name)
+	}
+	token, err := v.Token()
+	if err != nil {
+		return "", fmt.Errorf("vault token: %w", err)
+	}
+
+	mount := strings.Trim(v.Mount, "/")
+	if mount == "" {
+		mount = DefaultVaultMount
+	}
+	endpoint, err := url.JoinPath(v.Address, "v1", mount, "data", path)
+	if err != nil {
+		return "", fmt.Errorf("vault address: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	req.Header.Set("X-Vault-Request", "true")
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	var resp vaultResponse
+	if err := doJSON(v.Client, req, &resp); err != nil {
+		return "", err
+	}
+	value, ok := resp.Data.Data[field]
+	if !ok {
+		return "", fmt.Errorf("field %q: %w", field, ErrNotFound)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("field %q is not a string", field)
+	}
+	return s, nil
+}
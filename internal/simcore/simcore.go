@@ -0,0 +1,461 @@
+// Package simcore implements an in-process fake Core server speaking the
+// v1 protocol. It lets developers run the full agent pipeline (auth,
+// streams, forwarding) without a real Core and backs integration tests.
+package simcore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/logger"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// agentWaitTimeout is how long requests wait for an agent to authenticate
+const agentWaitTimeout = 10 * time.Second
+
+// chunkSize is the maximum FrameData payload sent for request bodies
+const chunkSize = 32 * 1024
+
+var (
+	// ErrNoAgent is returned when no authenticated agent is connected
+	ErrNoAgent = errors.New("no agent connected")
+	// ErrStreamReset is returned when the agent drops the stream
+	ErrStreamReset = errors.New("stream reset by agent")
+)
+
+// Server is a fake Core. Agents connect to Addr over plain TCP, or over any
+// net.Listener passed to Serve (such as an in-memory transport); HTTP requests
+// sent to PublicURL are tunneled to the connected agent.
+type Server struct {
+	token string
+
+	ln         net.Listener
+	httpLn     net.Listener
+	httpServer *http.Server
+
+	mu      sync.Mutex
+	conn    net.Conn
+	ready   chan struct{} // closed when an agent is authenticated
+	nextID  uint32
+	streams map[uint32]*stream
+
+	writeMu sync.Mutex
+}
+
+// stream is a Core-initiated stream waiting for the agent's response
+type stream struct {
+	conn net.Conn
+	pw   *io.PipeWriter
+}
+
+// NewServer creates a fake Core. If token is empty any token is accepted.
+func NewServer(token string) *Server {
+	return &Server{
+		token:   token,
+		ready:   make(chan struct{}),
+		nextID:  1,
+		streams: make(map[uint32]*stream),
+	}
+}
+
+// Start listens for agents on agentAddr and for public HTTP requests on
+// httpAddr. Use "127.0.0.1:0" to pick free ports.
+func (s *Server) Start(agentAddr, httpAddr string) error {
+	ln, err := net.Listen("tcp", agentAddr)
+	if err != nil {
+		return err
+	}
+	if err := s.Serve(ln, httpAddr); err != nil {
+		ln.Close()
+		return err
+	}
+	return nil
+}
+
+// Serve accepts agents from ln and listens for public HTTP requests on
+// httpAddr. The server takes ownership of ln and closes it on Close.
+func (s *Server) Serve(ln net.Listener, httpAddr string) error {
+	httpLn, err := net.Listen("tcp", httpAddr)
+	if err != nil {
+		return err
+	}
+
+	s.ln = ln
+	s.httpLn = httpLn
+	s.httpServer = &http.Server{Handler: s}
+
+	go s.acceptLoop()
+	go func() {
+		if err := s.httpServer.Serve(httpLn); err != nil && err != http.ErrServerClosed {
+			logger.Error("Simulated core HTTP server error", "error", err)
+		}
+	}()
+
+	logger.Info("Simulated core started", "agent_addr", s.Addr(), "public_url", s.PublicURL())
+	return nil
+}
+
+// Addr returns the address agents connect to
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// PublicURL returns the URL whose requests are tunneled to the agent
+func (s *Server) PublicURL() string {
+	return "http://" + s.httpLn.Addr().String()
+}
+
+// Ready returns a channel closed once an agent has authenticated
+func (s *Server) Ready() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ready
+}
+
+// Close stops the server and disconnects the agent
+func (s *Server) Close() error {
+	s.httpServer.Close()
+	err := s.ln.Close()
+
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// acceptLoop accepts agent connections. A new connection replaces the
+// previous one, like a real Core does on reconnect.
+func (s *Server) acceptLoop() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		s.conn = conn
+		s.mu.Unlock()
+
+		go s.serveAgent(conn)
+	}
+}
+
+// serveAgent reads frames from an agent connection
+func (s *Server) serveAgent(conn net.Conn) {
+	defer s.disconnect(conn)
+
+	for {
+		length, err := v1.ReadFrameLength(conn)
+		if err != nil {
+			return
+		}
+		if length < v1.HeaderSize || length > v1.MaxFrameSize {
+			logger.Warn("Simulated core: invalid frame size", "length", length)
+			return
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		frame, err := v1.ParseFrame(buf)
+		if err != nil {
+			logger.Warn("Simulated core: invalid frame", "error", err)
+			return
+		}
+
+		if err := s.handleFrame(conn, frame); err != nil {
+			logger.Warn("Simulated core: frame error", "error", err, "streamID", frame.StreamID)
+			return
+		}
+	}
+}
+
+// disconnect cleans up after an agent connection ends
+func (s *Server) disconnect(conn net.Conn) {
+	conn.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, st := range s.streams {
+		if st.conn == conn {
+			st.pw.CloseWithError(ErrStreamReset)
+			delete(s.streams, id)
+		}
+	}
+	if s.conn != conn {
+		return
+	}
+	s.conn = nil
+	select {
+	case <-s.ready:
+		s.ready = make(chan struct{})
+	default:
+	}
+}
+
+// handleFrame handles one frame from the agent
+func (s *Server) handleFrame(conn net.Conn, frame *v1.Frame) error {
+	if frame.IsControlFrame() {
+		switch frame.Type {
+		case v1.FrameAuth:
+			return s.handleAuth(conn, frame)
+		case v1.FrameHeartbeat:
+			// Echo the payload so heartbeat probes (-heartbeat-probe-size) verify
+			return s.send(conn, &v1.Frame{
+				Version:  v1.Version,
+				Type:     v1.FrameHeartbeat,
+				Flags:    v1.FlagAck,
+				StreamID: v1.StreamIDControl,
+				Payload:  frame.Payload,
+			})
+		}
+		// FrameClose: the agent closes the connection itself
+		return nil
+	}
+
+	switch frame.Type {
+	case v1.FrameOpenStream:
+		// Agent-initiated streams (file transfer, events...) are not simulated
+		s.send(conn, &v1.Frame{
+			Version:  v1.Version,
+			Type:     v1.FrameData,
+			Flags:    v1.FlagError | v1.FlagEndStream,
+			StreamID: frame.StreamID,
+			Payload:  []byte(`{"error":"not supported by simulated core"}` + "\n"),
+		})
+
+	case v1.FrameData:
+		s.mu.Lock()
+		st, ok := s.streams[frame.StreamID]
+		s.mu.Unlock()
+		if !ok || st.conn != conn {
+			return nil
+		}
+
+		if frame.Flags&v1.FlagError != 0 {
+			s.closeStream(frame.StreamID, fmt.Errorf("agent error: %s", frame.Payload))
+			return nil
+		}
+		if len(frame.Payload) > 0 {
+			st.pw.Write(frame.Payload)
+		}
+		if frame.IsEndStream() {
+			s.closeStream(frame.StreamID, nil)
+		}
+
+	case v1.FrameClose:
+		s.closeStream(frame.StreamID, ErrStreamReset)
+	}
+	return nil
+}
+
+// handleAuth validates the token and acknowledges the agent
+func (s *Server) handleAuth(conn net.Conn, frame *v1.Frame) error {
+	var req struct {
+		Token   string `json:"token"`
+		AgentID string `json:"agent_id"`
+	}
+	if err := json.Unmarshal(frame.Payload, &req); err != nil {
+		return err
+	}
+
+	resp := map[string]any{"success": true, "agent_id": req.AgentID, "public_url": s.PublicURL()}
+	if req.AgentID == "" {
+		resp["agent_id"] = "simulated-agent"
+	}
+	if s.token != "" && req.Token != s.token {
+		resp = map[string]any{"success": false, "error": "invalid token"}
+	}
+	payload, _ := json.Marshal(resp)
+
+	if err := s.send(conn, &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameAuth,
+		Flags:    v1.FlagAck,
+		StreamID: v1.StreamIDControl,
+		Payload:  payload,
+	}); err != nil {
+		return err
+	}
+
+	if resp["success"] == true {
+		logger.Info("Simulated core: agent authenticated", "agent_id", resp["agent_id"])
+		s.mu.Lock()
+		select {
+		case <-s.ready:
+		default:
+			close(s.ready)
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// send writes a frame to the agent connection
+func (s *Server) send(conn net.Conn, frame *v1.Frame) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return v1.Encode(conn, frame)
+}
+
+// closeStream finishes the response body of a stream
+func (s *Server) closeStream(id uint32, err error) {
+	s.mu.Lock()
+	st, ok := s.streams[id]
+	delete(s.streams, id)
+	s.mu.Unlock()
+
+	if ok {
+		st.pw.CloseWithError(err)
+	}
+}
+
+// Do sends req through the tunnel to the connected agent and returns the
+// response produced by the agent's local service.
+func (s *Server) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	select {
+	case <-s.Ready():
+	case <-ctx.Done():
+		return nil, ErrNoAgent
+	case <-time.After(agentWaitTimeout):
+		return nil, ErrNoAgent
+	}
+
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	conn := s.conn
+	if conn == nil {
+		s.mu.Unlock()
+		return nil, ErrNoAgent
+	}
+	// Core-initiated streams use odd IDs
+	id := s.nextID
+	s.nextID += 2
+	pr, pw := io.Pipe()
+	s.streams[id] = &stream{conn: conn, pw: pw}
+	s.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		s.closeStream(id, ctx.Err())
+	})
+
+	if err := s.sendRequest(conn, id, req, body); err != nil {
+		s.closeStream(id, err)
+		return nil, err
+	}
+
+	// Informational responses (103 Early Hints) precede the final response
+	br := bufio.NewReader(pr)
+	for {
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			s.closeStream(id, err)
+			return nil, err
+		}
+		if resp.StatusCode >= 200 || resp.StatusCode == http.StatusSwitchingProtocols {
+			return resp, nil
+		}
+	}
+}
+
+// sendRequest serializes req as FrameOpenStream (request line and headers)
+// followed by FrameData body chunks and FlagEndStream
+func (s *Server) sendRequest(conn net.Conn, id uint32, req *http.Request, body []byte) error {
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	fmt.Fprintf(&head, "Host: %s\r\n", req.Host)
+	for key, values := range req.Header {
+		if key == "Content-Length" || key == "Transfer-Encoding" {
+			continue
+		}
+		for _, value := range values {
+			fmt.Fprintf(&head, "%s: %s\r\n", key, value)
+		}
+	}
+	if len(body) > 0 {
+		fmt.Fprintf(&head, "Content-Length: %d\r\n", len(body))
+	}
+	head.WriteString("\r\n")
+
+	if err := s.send(conn, &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameOpenStream,
+		Flags:    v1.FlagNone,
+		StreamID: id,
+		Payload:  head.Bytes(),
+	}); err != nil {
+		return err
+	}
+
+	for len(body) > 0 {
+		n := min(len(body), chunkSize)
+		if err := s.send(conn, &v1.Frame{
+			Version:  v1.Version,
+			Type:     v1.FrameData,
+			Flags:    v1.FlagNone,
+			StreamID: id,
+			Payload:  body[:n],
+		}); err != nil {
+			return err
+		}
+		body = body[n:]
+	}
+
+	return s.send(conn, &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameData,
+		Flags:    v1.FlagEndStream,
+		StreamID: id,
+	})
+}
+
+// readBody reads the request body, bounded by the maximum frame size
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	defer req.Body.Close()
+	return io.ReadAll(io.LimitReader(req.Body, v1.MaxFrameSize))
+}
+
+// ServeHTTP tunnels public HTTP requests to the agent
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.Do(r)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, ErrNoAgent) || errors.Is(err, context.Canceled) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer resp.Body.Close()
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
@@ -0,0 +1,122 @@
+package simcore
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// readFrame reads one frame from conn
+func readFrame(conn net.Conn) (*v1.Frame, error) {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	length, err := v1.ReadFrameLength(conn)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	return v1.ParseFrame(buf)
+}
+
+func TestServer_TunnelsRequestToAgent(t *testing.T) {
+	s := NewServer("secret")
+	if err := s.Start("127.0.0.1:0", "127.0.0.1:0"); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Close()
+
+	// Fake agent speaking raw v1 frames
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	v1.Encode(conn, &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameAuth,
+		Flags:    v1.FlagNone,
+		StreamID: v1.StreamIDControl,
+		Payload:  []byte(`{"token":"secret","agent_id":"a1"}`),
+	})
+	ack, err := readFrame(conn)
+	if err != nil {
+		t.Fatalf("read auth response: %v", err)
+	}
+	if ack.Type != v1.FrameAuth || !ack.IsAck() || !strings.Contains(string(ack.Payload), `"success":true`) {
+		t.Fatalf("Expected successful auth ack, got %q", ack.Payload)
+	}
+
+	go func() {
+		open, err := readFrame(conn)
+		if err != nil {
+			t.Errorf("read open stream: %v", err)
+			return
+		}
+		if open.Type != v1.FrameOpenStream || open.StreamID%2 != 1 {
+			t.Errorf("Expected odd Core-initiated stream, got type %v id %d", open.Type, open.StreamID)
+		}
+		if !strings.HasPrefix(string(open.Payload), "POST /echo HTTP/1.1\r\n") {
+			t.Errorf("Unexpected request head: %q", open.Payload)
+		}
+		body, err := readFrame(conn)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+			return
+		}
+		end, err := readFrame(conn)
+		if err != nil || !end.IsEndStream() {
+			t.Errorf("Expected EndStream after body")
+		}
+
+		resp := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\n" + string(body.Payload)
+		v1.Encode(conn, &v1.Frame{Version: v1.Version, Type: v1.FrameData, Flags: v1.FlagNone, StreamID: open.StreamID, Payload: []byte(resp)})
+		v1.Encode(conn, &v1.Frame{Version: v1.Version, Type: v1.FrameData, Flags: v1.FlagEndStream, StreamID: open.StreamID})
+	}()
+
+	resp, err := http.Post(s.PublicURL()+"/echo", "text/plain", strings.NewReader("ping"))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(data) != "ping" {
+		t.Errorf("Expected 200 ping, got %d %q", resp.StatusCode, data)
+	}
+}
+
+func TestServer_RejectsInvalidToken(t *testing.T) {
+	s := NewServer("secret")
+	if err := s.Start("127.0.0.1:0", "127.0.0.1:0"); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	v1.Encode(conn, &v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameAuth,
+		Flags:    v1.FlagNone,
+		StreamID: v1.StreamIDControl,
+		Payload:  []byte(`{"token":"wrong"}`),
+	})
+	resp, err := readFrame(conn)
+	if err != nil {
+		t.Fatalf("read auth response: %v", err)
+	}
+	if !strings.Contains(string(resp.Payload), "invalid token") {
+		t.Errorf("Expected invalid token error, got %q", resp.Payload)
+	}
+}
@@ -0,0 +1,356 @@
+package update
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is where release artifacts are downloaded from
+const DefaultBaseURL = "https://github.com/hydragon2m/tunnel-agent/releases/latest/download"
+
+// Release artifact names
+const (
+	ChecksumsFile = "checksums.txt"
+	SignatureFile = "checksums.txt.sig"
+)
+
+// versionPrefix starts the line of checksums.txt declaring the release version
+const versionPrefix = "# version:"
+
+var (
+	// ErrUpToDate is returned when the installed binary matches the latest release
+	ErrUpToDate = errors.New("already up to date")
+	// ErrBadSignature is returned when the checksums file signature is invalid
+	ErrBadSignature = errors.New("invalid checksums signature")
+	// ErrNoPublicKey is returned when no signing key is configured
+	ErrNoPublicKey = errors.New("no update signing key configured")
+	// ErrDowngrade is returned when the signed release is older than the running binary
+	ErrDowngrade = errors.New("release is older than the running version")
+)
+
+// Release describes the latest release artifact for this platform
+type Release struct {
+	Version string
+	Asset   string
+	URL     string
+	SHA256  string
+}
+
+// Updater downloads and installs signed releases.
+//
+// A release consists of one binary per platform, a checksums.txt in
+// sha256sum format and checksums.txt.sig, a base64 ed25519 signature of
+// checksums.txt. checksums.txt starts with a "# version: vX.Y.Z" line, so
+// the version is signed too. Binaries are only installed when the signature
+// is valid, the release is newer than the running version and the binary
+// matches its signed checksum.
+type Updater struct {
+	baseURL    string
+	publicKey  ed25519.PublicKey
+	current    string
+	httpClient *http.Client
+}
+
+// NewUpdater creates an updater. publicKey is a base64 encoded ed25519 key
+// and currentVersion is the version of the running binary. Releases that are
+// not newer than currentVersion are refused; a currentVersion that isn't a
+// semantic version (e.g. "dev") accepts any signed release.
+func NewUpdater(baseURL, publicKey, currentVersion string) (*Updater, error) {
+	if publicKey == "" {
+		return nil, ErrNoPublicKey
+	}
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid update public key")
+	}
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &Updater{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		publicKey:  ed25519.PublicKey(key),
+		current:    currentVersion,
+		httpClient: &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+// AssetName returns the release binary name for the current platform
+func AssetName() string {
+	name := fmt.Sprintf("tunnel-agent_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Check fetches and verifies the signed checksums and returns the release
+// for this platform. It returns ErrUpToDate if the release is the running
+// version or exePath already matches, and ErrDowngrade if it is older.
+func (u *Updater) Check(ctx context.Context, exePath string) (*Release, error) {
+	checksums, err := u.fetch(ctx, ChecksumsFile)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := u.fetch(ctx, SignatureFile)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || !ed25519.Verify(u.publicKey, checksums, signature) {
+		return nil, ErrBadSignature
+	}
+
+	version, err := findVersion(checksums)
+	if err != nil {
+		return nil, err
+	}
+	// An older release with a valid signature must not be installed, or
+	// anyone serving the update URL could replay a vulnerable version
+	if cmp, ok := compareVersions(version, u.current); ok {
+		if cmp == 0 {
+			return nil, ErrUpToDate
+		}
+		if cmp < 0 {
+			return nil, fmt.Errorf("%w: %s < %s", ErrDowngrade, version, u.current)
+		}
+	}
+
+	asset := AssetName()
+	sum, err := findChecksum(checksums, asset)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := fileSHA256(exePath)
+	if err == nil && current == sum {
+		return nil, ErrUpToDate
+	}
+
+	return &Release{
+		Version: version,
+		Asset:   asset,
+		URL:     u.baseURL + "/" + asset,
+		SHA256:  sum,
+	}, nil
+}
+
+// Apply downloads the release, verifies its checksum and atomically
+// replaces exePath. The previous binary is kept as exePath + ".old".
+func (u *Updater) Apply(ctx context.Context, release *Release, exePath string) error {
+	dir := filepath.Dir(exePath)
+	tmp, err := os.CreateTemp(dir, ".tunnel-agent-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, release.URL, nil)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download %s: %w", release.Asset, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		tmp.Close()
+		return fmt.Errorf("failed to download %s: %s", release.Asset, resp.Status)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download %s: %w", release.Asset, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != release.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", release.Asset, release.SHA256, sum)
+	}
+	if err := os.Chmod(tmpPath, 0o755); err != nil {
+		return err
+	}
+
+	// Running executables can't be overwritten on Windows, but they can
+	// be renamed, so move the current binary aside first
+	oldPath := exePath + ".old"
+	os.Remove(oldPath)
+	if err := os.Rename(exePath, oldPath); err != nil {
+		return fmt.Errorf("failed to move current binary: %w", err)
+	}
+	if err := os.Rename(tmpPath, exePath); err != nil {
+		os.Rename(oldPath, exePath)
+		return fmt.Errorf("failed to install new binary: %w", err)
+	}
+	return nil
+}
+
+// fetch downloads a small release artifact
+func (u *Updater) fetch(ctx context.Context, name string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.baseURL+"/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", name, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// findChecksum finds the sha256 of asset in sha256sum formatted data
+func findChecksum(checksums []byte, asset string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// sha256sum marks binary mode with a leading '*'
+		if strings.TrimPrefix(fields[1], "*") == asset {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no release asset %s in %s", asset, ChecksumsFile)
+}
+
+// findVersion returns the release version declared in checksums.txt
+func findVersion(checksums []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), versionPrefix)
+		if !ok {
+			continue
+		}
+		version := strings.TrimSpace(line)
+		if _, _, ok := parseVersion(version); !ok {
+			return "", fmt.Errorf("invalid release version %q in %s", version, ChecksumsFile)
+		}
+		return version, nil
+	}
+	return "", fmt.Errorf("no release version in %s", ChecksumsFile)
+}
+
+// compareVersions compares two semantic versions. ok is false if either
+// isn't one.
+func compareVersions(a, b string) (cmp int, ok bool) {
+	an, apre, ok := parseVersion(a)
+	if !ok {
+		return 0, false
+	}
+	bn, bpre, ok := parseVersion(b)
+	if !ok {
+		return 0, false
+	}
+	for i := range an {
+		if an[i] != bn[i] {
+			if an[i] < bn[i] {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return comparePrerelease(apre, bpre), true
+}
+
+// parseVersion splits "v1.2.3-rc.1+build" into its numbers and prerelease
+func parseVersion(v string) (nums [3]int, pre string, ok bool) {
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, pre, _ = strings.Cut(v, "-")
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return nums, "", false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nums, "", false
+		}
+		nums[i] = n
+	}
+	return nums, pre, true
+}
+
+// comparePrerelease orders prerelease identifiers as semver does: a release
+// is newer than any of its prereleases, numeric identifiers compare
+// numerically and sort before alphanumeric ones
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// fileSHA256 returns the hex sha256 of a file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
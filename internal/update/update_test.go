@@ -0,0 +1,164 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newReleaseServer serves a signed release of version containing binary for this platform
+func newReleaseServer(t *testing.T, version string, binary []byte, signKey ed25519.PrivateKey) *httptest.Server {
+	t.Helper()
+
+	sum := sha256.Sum256(binary)
+	checksums := []byte(fmt.Sprintf("# version: %s\n%s  %s\n", version, hex.EncodeToString(sum[:]), AssetName()))
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(signKey, checksums))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+ChecksumsFile, func(w http.ResponseWriter, r *http.Request) { w.Write(checksums) })
+	mux.HandleFunc("/"+SignatureFile, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(sig)) })
+	mux.HandleFunc("/"+AssetName(), func(w http.ResponseWriter, r *http.Request) { w.Write(binary) })
+	return httptest.NewServer(mux)
+}
+
+func TestUpdater_CheckAndApply(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	srv := newReleaseServer(t, "v1.2.0", []byte("new binary"), priv)
+	defer srv.Close()
+
+	exe := filepath.Join(t.TempDir(), "agent")
+	if err := os.WriteFile(exe, []byte("old binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := NewUpdater(srv.URL, base64.StdEncoding.EncodeToString(pub), "v1.1.0")
+	if err != nil {
+		t.Fatalf("NewUpdater failed: %v", err)
+	}
+
+	release, err := u.Check(context.Background(), exe)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if release.Version != "v1.2.0" {
+		t.Errorf("Expected release version v1.2.0, got %q", release.Version)
+	}
+	if err := u.Apply(context.Background(), release, exe); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(exe)
+	if string(data) != "new binary" {
+		t.Errorf("Expected new binary installed, got %q", data)
+	}
+	if old, _ := os.ReadFile(exe + ".old"); string(old) != "old binary" {
+		t.Errorf("Expected previous binary kept, got %q", old)
+	}
+
+	if _, err := u.Check(context.Background(), exe); !errors.Is(err, ErrUpToDate) {
+		t.Errorf("Expected ErrUpToDate, got %v", err)
+	}
+}
+
+func TestUpdater_RejectsBadSignature(t *testing.T) {
+	_, signKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	srv := newReleaseServer(t, "v9.0.0", []byte("evil binary"), signKey)
+	defer srv.Close()
+
+	u, err := NewUpdater(srv.URL, base64.StdEncoding.EncodeToString(otherPub), "v1.0.0")
+	if err != nil {
+		t.Fatalf("NewUpdater failed: %v", err)
+	}
+
+	if _, err := u.Check(context.Background(), filepath.Join(t.TempDir(), "agent")); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature, got %v", err)
+	}
+}
+
+func TestUpdater_RefusesOlderRelease(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	srv := newReleaseServer(t, "v1.1.0", []byte("old signed binary"), priv)
+	defer srv.Close()
+	exe := filepath.Join(t.TempDir(), "agent")
+
+	tests := []struct {
+		current string
+		want    error
+	}{
+		{"v1.2.0", ErrDowngrade},
+		{"v1.1.0", ErrUpToDate},
+		{"1.1.0", ErrUpToDate},
+		{"v1.1.0-rc.1", nil},
+		{"dev", nil},
+	}
+	for _, tt := range tests {
+		u, err := NewUpdater(srv.URL, base64.StdEncoding.EncodeToString(pub), tt.current)
+		if err != nil {
+			t.Fatalf("NewUpdater failed: %v", err)
+		}
+		_, err = u.Check(context.Background(), exe)
+		if tt.want == nil && err != nil {
+			t.Errorf("current %s: expected release accepted, got %v", tt.current, err)
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("current %s: expected %v, got %v", tt.current, tt.want, err)
+		}
+	}
+}
+
+func TestUpdater_RequiresSignedVersion(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	sum := sha256.Sum256([]byte("binary"))
+	checksums := []byte(fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), AssetName()))
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, checksums))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+ChecksumsFile, func(w http.ResponseWriter, r *http.Request) { w.Write(checksums) })
+	mux.HandleFunc("/"+SignatureFile, func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(sig)) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	u, err := NewUpdater(srv.URL, base64.StdEncoding.EncodeToString(pub), "v1.0.0")
+	if err != nil {
+		t.Fatalf("NewUpdater failed: %v", err)
+	}
+	if _, err := u.Check(context.Background(), filepath.Join(t.TempDir(), "agent")); err == nil {
+		t.Error("Expected release without a signed version to be refused")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "v1.10.0", -1},
+		{"v2.0.0", "v1.99.99", 1},
+		{"v1.0.0-rc.1", "v1.0.0", -1},
+		{"v1.0.0-rc.2", "v1.0.0-rc.10", -1},
+		{"v1.0.0-alpha", "v1.0.0-alpha.1", -1},
+		{"v1.0.0-1", "v1.0.0-alpha", -1},
+		{"v1.0.0+build.5", "v1.0.0", 0},
+	}
+	for _, tt := range tests {
+		got, ok := compareVersions(tt.a, tt.b)
+		if !ok || got != tt.want {
+			t.Errorf("compareVersions(%s, %s) = %d, %v; want %d", tt.a, tt.b, got, ok, tt.want)
+		}
+	}
+	if _, ok := compareVersions("dev", "v1.0.0"); ok {
+		t.Error("Expected non-semver version to be incomparable")
+	}
+}
@@ -0,0 +1,170 @@
+// Package watchdog periodically compares goroutine, stream and connection
+// counts against expected bounds and reports suspected leaks, so regressions
+// such as dispatcher loops or stream goroutines that never exit show up in
+// logs and metrics before they exhaust the host.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/internal/clock"
+)
+
+// Sample is a point-in-time count of the resources the watchdog bounds
+type Sample struct {
+	// Goroutines is the number of goroutines in the process
+	Goroutines int
+	// Streams is the number of streams held by the stream manager
+	Streams int
+	// StreamsActive is the number of active streams according to metrics;
+	// it drifts from Streams when close callbacks are skipped
+	StreamsActive int
+	// Connections is the number of active connections to Core
+	Connections int
+}
+
+// Finding is a resource whose count exceeded its bound for Confirm
+// consecutive checks
+type Finding struct {
+	Resource string `json:"resource"`
+	Count    int    `json:"count"`
+	Limit    int    `json:"limit"`
+	Sample   Sample `json:"sample"`
+}
+
+// String describes the finding for logs and health messages
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %d exceeds expected %d", f.Resource, f.Count, f.Limit)
+}
+
+// Options configures a Watchdog. Zero values use the defaults.
+type Options struct {
+	// Interval between checks (default 1m)
+	Interval time.Duration
+
+	// Baseline is the expected goroutine count with no streams; 0 measures it
+	// when Start is called
+	Baseline int
+	// PerStream is the number of goroutines a stream may use (default 4)
+	PerStream int
+	// Slack absorbs short-lived goroutines such as admin requests (default 50)
+	Slack int
+	// MaxConnections is the expected number of connections to Core (default 1)
+	MaxConnections int
+
+	// Confirm is the number of consecutive failed checks before a resource
+	// is reported (default 3), so transient bursts are not reported as leaks
+	Confirm int
+
+	// Sample returns the current counts; Goroutines defaults to
+	// runtime.NumGoroutine when left at 0
+	Sample func() Sample
+
+	// OnSuspect is called once per resource when a leak is first suspected
+	OnSuspect func(Finding)
+
+	// Clock drives the check ticker (default clock.Real)
+	Clock clock.Clock
+}
+
+// Watchdog checks resource counts on an interval
+type Watchdog struct {
+	opts    Options
+	clock   clock.Clock
+	strikes map[string]int
+}
+
+// New creates a Watchdog
+func New(opts Options) *Watchdog {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.PerStream <= 0 {
+		opts.PerStream = 4
+	}
+	if opts.Slack <= 0 {
+		opts.Slack = 50
+	}
+	if opts.MaxConnections <= 0 {
+		opts.MaxConnections = 1
+	}
+	if opts.Confirm <= 0 {
+		opts.Confirm = 3
+	}
+	if opts.Sample == nil {
+		opts.Sample = func() Sample { return Sample{} }
+	}
+	return &Watchdog{
+		opts:    opts,
+		clock:   clock.Or(opts.Clock),
+		strikes: make(map[string]int),
+	}
+}
+
+// Start runs checks until ctx is cancelled. The goroutine baseline is
+// measured now unless Options.Baseline is set, so call Start once the agent
+// has finished starting up.
+func (w *Watchdog) Start(ctx context.Context) {
+	if w.opts.Baseline <= 0 {
+		w.opts.Baseline = w.sample().Goroutines
+	}
+
+	ticker := w.clock.NewTicker(w.opts.Interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				w.Check()
+			}
+		}
+	}()
+}
+
+// Check samples the counts once and returns the resources newly suspected
+// of leaking. A resource is reported again only after it recovers.
+func (w *Watchdog) Check() []Finding {
+	s := w.sample()
+
+	bounds := []struct {
+		resource     string
+		count, limit int
+	}{
+		{"goroutines", s.Goroutines, w.opts.Baseline + w.opts.PerStream*s.Streams + w.opts.Slack},
+		{"connections", s.Connections, w.opts.MaxConnections},
+		// Streams closed without the close callback still count as active
+		{"streams", s.StreamsActive, s.Streams},
+	}
+
+	var findings []Finding
+	for _, b := range bounds {
+		if b.count <= b.limit {
+			w.strikes[b.resource] = 0
+			continue
+		}
+		w.strikes[b.resource]++
+		if w.strikes[b.resource] != w.opts.Confirm {
+			continue
+		}
+		f := Finding{Resource: b.resource, Count: b.count, Limit: b.limit, Sample: s}
+		findings = append(findings, f)
+		if w.opts.OnSuspect != nil {
+			w.opts.OnSuspect(f)
+		}
+	}
+	return findings
+}
+
+// sample returns the current counts, filling in the goroutine count
+func (w *Watchdog) sample() Sample {
+	s := w.opts.Sample()
+	if s.Goroutines == 0 {
+		s.Goroutines = runtime.NumGoroutine()
+	}
+	return s
+}
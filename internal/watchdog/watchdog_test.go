@@ -0,0 +1,60 @@
+package watchdog
+
+import (
+	"testing"
+)
+
+func TestWatchdog_ReportsAfterConfirm(t *testing.T) {
+	sample := Sample{Goroutines: 20, Streams: 2, StreamsActive: 2, Connections: 1}
+	var reported []Finding
+	w := New(Options{
+		Baseline:  10,
+		PerStream: 2,
+		Slack:     5,
+		Confirm:   2,
+		Sample:    func() Sample { return sample },
+		OnSuspect: func(f Finding) { reported = append(reported, f) },
+	})
+
+	// 20 exceeds 10 + 2*2 + 5 = 19, but only once
+	if findings := w.Check(); len(findings) != 0 {
+		t.Fatalf("Expected no findings before confirm, got %v", findings)
+	}
+	findings := w.Check()
+	if len(findings) != 1 || findings[0].Resource != "goroutines" || findings[0].Limit != 19 {
+		t.Fatalf("Expected goroutines finding with limit 19, got %v", findings)
+	}
+
+	// Already reported: not reported again until it recovers
+	if findings := w.Check(); len(findings) != 0 {
+		t.Errorf("Expected finding to be reported once, got %v", findings)
+	}
+	sample.Goroutines = 12
+	w.Check()
+	sample.Goroutines = 30
+	w.Check()
+	if findings := w.Check(); len(findings) != 1 {
+		t.Errorf("Expected finding after recovery and relapse, got %v", findings)
+	}
+	if len(reported) != 2 {
+		t.Errorf("Expected 2 OnSuspect calls, got %d", len(reported))
+	}
+}
+
+func TestWatchdog_ConnectionsAndStreams(t *testing.T) {
+	w := New(Options{
+		Baseline: 100,
+		Confirm:  1,
+		Sample: func() Sample {
+			return Sample{Goroutines: 100, Streams: 1, StreamsActive: 3, Connections: 2}
+		},
+	})
+
+	resources := map[string]bool{}
+	for _, f := range w.Check() {
+		resources[f.Resource] = true
+	}
+	if !resources["connections"] || !resources["streams"] || resources["goroutines"] {
+		t.Errorf("Expected connections and streams findings, got %v", resources)
+	}
+}
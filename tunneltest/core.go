@@ -0,0 +1,262 @@
+// Package tunneltest provides a scriptable fake Core for end-to-end tests of
+// agents built on the client package. Unlike internal/simcore, which tunnels
+// real HTTP traffic for manual runs, tunneltest exposes each agent connection
+// at the frame level: tests send scripted frame sequences and assert on the
+// frames the agent writes back. Agents connect through an in-memory
+// transport, so tests need no sockets.
+//
+// A typical test creates a Core, points a client.Connector at it with
+// ConnectorOptions.Transport = core.Transport(), then accepts the agent:
+//
+//	core := tunneltest.NewCore(tunneltest.Options{Token: "secret"})
+//	defer core.Close()
+//	// ... start the agent ...
+//	conn := core.Accept(t)
+//	conn.Run(t, tunneltest.Script{
+//		tunneltest.SendFrame(tunneltest.Request(1, "GET / HTTP/1.1\r\nHost: app\r\n\r\n")),
+//		tunneltest.ExpectFrame(tunneltest.Stream(1), tunneltest.PayloadContains("200 OK")),
+//	})
+package tunneltest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// DefaultTimeout is how long Accept and Expect wait when Options.Timeout is
+// not set
+const DefaultTimeout = 5 * time.Second
+
+// Options configures a Core. The zero value accepts any token and answers
+// auth and heartbeat frames automatically.
+type Options struct {
+	// Token is the only token accepted; empty accepts any token
+	Token string
+	// ManualAuth passes FrameAuth to the test instead of answering it, so
+	// scripts can send their own auth responses
+	ManualAuth bool
+	// PublicURL is returned to the agent in successful auth responses
+	PublicURL string
+	// Timeout bounds Accept, Next and Expect (default DefaultTimeout)
+	Timeout time.Duration
+}
+
+// Core is a fake Core server. Every agent connection is handed to the test
+// as a Conn through Accept.
+type Core struct {
+	opts      Options
+	transport *client.MemoryTransport
+	conns     chan *Conn
+
+	mu  sync.Mutex
+	all []*Conn
+}
+
+// NewCore creates a fake Core and starts accepting agent connections
+func NewCore(opts Options) *Core {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	c := &Core{
+		opts:      opts,
+		transport: client.NewMemoryTransport(),
+		conns:     make(chan *Conn, 16),
+	}
+	go c.acceptLoop()
+	return c
+}
+
+// Transport returns the transport agents use to reach the Core
+// (client.ConnectorOptions.Transport)
+func (c *Core) Transport() client.Transport {
+	return c.transport
+}
+
+// Accept returns the next agent connection. Unless ManualAuth is set it
+// returns once the agent's first FrameAuth has been answered; check
+// Conn.Authenticated for the outcome. The test fails if no agent connects
+// within the timeout.
+func (c *Core) Accept(t testing.TB) *Conn {
+	t.Helper()
+	select {
+	case conn := <-c.conns:
+		return conn
+	case <-time.After(c.opts.Timeout):
+		t.Fatalf("tunneltest: no agent connected within %s", c.opts.Timeout)
+		return nil
+	}
+}
+
+// Close stops accepting agents and drops every connection
+func (c *Core) Close() error {
+	err := c.transport.Close()
+	c.mu.Lock()
+	conns := c.all
+	c.all = nil
+	c.mu.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	return err
+}
+
+func (c *Core) acceptLoop() {
+	for {
+		nc, err := c.transport.Accept()
+		if err != nil {
+			return
+		}
+		conn := newConn(c, nc)
+		c.mu.Lock()
+		c.all = append(c.all, conn)
+		c.mu.Unlock()
+		go conn.readLoop()
+		if c.opts.ManualAuth {
+			c.conns <- conn
+		}
+	}
+}
+
+// Conn is the Core side of one agent connection
+type Conn struct {
+	core *Core
+	nc   net.Conn
+
+	writeMu sync.Mutex
+	frames  chan *v1.Frame
+	backlog []*v1.Frame // frames skipped by Response, returned first by Next
+	closed  chan struct{}
+	err     error // read error, valid after closed
+
+	auth          client.AuthRequest
+	authenticated bool
+}
+
+func newConn(core *Core, nc net.Conn) *Conn {
+	return &Conn{
+		core:   core,
+		nc:     nc,
+		frames: make(chan *v1.Frame, 256),
+		closed: make(chan struct{}),
+	}
+}
+
+// Send writes a frame to the agent
+func (c *Conn) Send(frame *v1.Frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return v1.Encode(c.nc, frame)
+}
+
+// Close drops the connection, like a crashed Core or a broken network
+func (c *Conn) Close() error {
+	return c.nc.Close()
+}
+
+// Auth returns the auth request sent by the agent
+func (c *Conn) Auth() client.AuthRequest {
+	return c.auth
+}
+
+// Authenticated reports whether the Core accepted the agent's token
+func (c *Conn) Authenticated() bool {
+	return c.authenticated
+}
+
+// Closed returns a channel closed when the agent connection ends
+func (c *Conn) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// readLoop reads frames from the agent, answers auth and heartbeats and
+// queues everything else for Next
+func (c *Conn) readLoop() {
+	defer close(c.closed)
+	accepted := c.core.opts.ManualAuth
+	for {
+		frame, err := readFrame(c.nc)
+		if err != nil {
+			c.err = err
+			if !accepted {
+				// Agent disconnected before authenticating: hand the
+				// connection to the test anyway so it can observe that
+				c.core.conns <- c
+			}
+			return
+		}
+
+		switch {
+		case frame.Type == v1.FrameAuth && !c.core.opts.ManualAuth:
+			if err := c.answerAuth(frame); err != nil {
+				c.err = err
+				c.nc.Close()
+			}
+			if !accepted {
+				accepted = true
+				c.core.conns <- c
+			}
+		case frame.Type == v1.FrameHeartbeat && !frame.IsAck():
+			// Echo the payload like Core does, so heartbeat probes verify
+			c.Send(&v1.Frame{
+				Version:  v1.Version,
+				Type:     v1.FrameHeartbeat,
+				Flags:    v1.FlagAck,
+				StreamID: v1.StreamIDControl,
+				Payload:  frame.Payload,
+			})
+		default:
+			c.frames <- frame
+		}
+	}
+}
+
+// answerAuth validates the token and sends the auth response
+func (c *Conn) answerAuth(frame *v1.Frame) error {
+	if err := json.Unmarshal(frame.Payload, &c.auth); err != nil {
+		return err
+	}
+
+	resp := client.AuthResponse{Success: true, AgentID: c.auth.AgentID, PublicURL: c.core.opts.PublicURL, ServerTime: time.Now().Unix()}
+	if resp.AgentID == "" {
+		resp.AgentID = "tunneltest-agent"
+	}
+	if c.core.opts.Token != "" && c.auth.Token != c.core.opts.Token {
+		resp = client.AuthResponse{Error: "invalid token"}
+	}
+	c.authenticated = resp.Success
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return c.Send(&v1.Frame{
+		Version:  v1.Version,
+		Type:     v1.FrameAuth,
+		Flags:    v1.FlagAck,
+		StreamID: v1.StreamIDControl,
+		Payload:  payload,
+	})
+}
+
+// readFrame reads one frame from r
+func readFrame(r io.Reader) (*v1.Frame, error) {
+	length, err := v1.ReadFrameLength(r)
+	if err != nil {
+		return nil, err
+	}
+	if length < v1.HeaderSize || length > v1.MaxFrameSize {
+		return nil, fmt.Errorf("tunneltest: invalid frame length %d", length)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return v1.ParseFrame(buf)
+}
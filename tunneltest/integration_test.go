@@ -0,0 +1,321 @@
+package tunneltest_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	"github.com/hydragon2m/tunnel-agent/tunneltest"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// agent wires the client package the way cmd/agent does: connector,
+// dispatcher, auth, stream manager and local forwarder
+type agent struct {
+	connector *client.Connector
+	streams   *client.StreamManager
+	authErrs  chan error
+}
+
+func startAgent(t *testing.T, core *tunneltest.Core, token, localURL string) *agent {
+	t.Helper()
+	return startAgentWith(t, core, token, localURL, client.StreamManagerOptions{})
+}
+
+// startAgentWith is startAgent with stream manager options (e.g. remote limits)
+func startAgentWith(t *testing.T, core *tunneltest.Core, token, localURL string, streamOpts client.StreamManagerOptions) *agent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &agent{authErrs: make(chan error, 4)}
+	forwarder := client.NewLocalForwarder(client.LocalForwarderOptions{DefaultURL: localURL, Timeout: 5 * time.Second})
+	authenticator := client.NewAuthenticator(token, "it-agent", "test", nil, nil)
+
+	var dispatcher *client.Dispatcher
+	a.connector = client.NewConnector("tunneltest", client.ConnectorOptions{
+		Transport:     core.Transport(),
+		RetryInterval: 10 * time.Millisecond,
+		OnConnected: func(conn net.Conn) {
+			a.streams.ResetRemoteIDs()
+			dispatcher.SetConnection(conn)
+			if err := dispatcher.Start(ctx); err != nil {
+				t.Errorf("start dispatcher: %v", err)
+				return
+			}
+			frame, _ := authenticator.CreateAuthFrame()
+			a.connector.SendFrame(ctx, frame)
+		},
+		OnDisconnected: func() { dispatcher.Stop() },
+	})
+	a.streams = client.NewStreamManager(a.connector, streamOpts)
+
+	reconnect := func() {
+		go a.connector.Reconnect(ctx)
+	}
+	dispatcher = client.NewDispatcher(client.DispatcherOptions{
+		RequireAuth: true,
+		ControlHandler: func(frame *v1.Frame) error {
+			if frame.Type != v1.FrameAuth {
+				return nil
+			}
+			err := authenticator.HandleAuthResponse(frame)
+			a.authErrs <- err
+			if err != nil {
+				return err
+			}
+			dispatcher.MarkAuthenticated()
+			return nil
+		},
+		StreamHandler: func(frame *v1.Frame) error {
+			return a.handleStreamFrame(ctx, frame, forwarder)
+		},
+		OnConnectionClosed: reconnect,
+		OnError:            func(error) { reconnect() },
+	})
+
+	go a.connector.Connect(ctx)
+	t.Cleanup(func() {
+		cancel()
+		a.connector.Close()
+	})
+	return a
+}
+
+func (a *agent) handleStreamFrame(ctx context.Context, frame *v1.Frame, forwarder *client.LocalForwarder) error {
+	switch frame.Type {
+	case v1.FrameOpenStream:
+		if err := a.streams.ValidateRemoteOpen(frame.StreamID); err != nil {
+			return a.connector.SendFrame(ctx, client.NewStreamReset(frame.StreamID, err))
+		}
+		_, metadata, body, err := client.ParseOpenPayload(frame.Payload)
+		if err != nil {
+			return err
+		}
+		stream, err := a.streams.CreateStream(frame.StreamID)
+		if err != nil {
+			return a.connector.SendFrame(ctx, client.NewStreamReset(frame.StreamID, err))
+		}
+		for k, v := range metadata {
+			stream.SetMetadata(k, v)
+		}
+		go func() {
+			if _, err := forwarder.ForwardRequest(ctx, stream, body); err != nil {
+				a.connector.SendFrame(ctx, &v1.Frame{Version: v1.Version, Type: v1.FrameData, Flags: v1.FlagError, StreamID: frame.StreamID, Payload: []byte(err.Error())})
+			}
+			stream.Close()
+			a.streams.CloseStream(frame.StreamID)
+		}()
+	case v1.FrameData:
+		stream, ok := a.streams.GetStream(frame.StreamID)
+		if !ok {
+			return nil
+		}
+		if err := stream.Deliver(frame.Payload); err != nil {
+			return err
+		}
+		if frame.IsEndStream() {
+			a.streams.CloseStream(frame.StreamID)
+		}
+	case v1.FrameClose:
+		a.streams.CloseStream(frame.StreamID)
+	}
+	return nil
+}
+
+func (a *agent) authResult(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-a.authErrs:
+		return err
+	case <-time.After(tunneltest.DefaultTimeout):
+		t.Fatal("agent never handled the auth response")
+		return nil
+	}
+}
+
+func TestIntegration_Auth(t *testing.T) {
+	core := tunneltest.NewCore(tunneltest.Options{Token: "secret"})
+	defer core.Close()
+
+	a := startAgent(t, core, "secret", "http://127.0.0.1:1")
+	conn := core.Accept(t)
+	if !conn.Authenticated() || conn.Auth().AgentID != "it-agent" {
+		t.Fatalf("auth request = %+v, authenticated %v", conn.Auth(), conn.Authenticated())
+	}
+	if err := a.authResult(t); err != nil {
+		t.Errorf("agent rejected a successful auth response: %v", err)
+	}
+}
+
+func TestIntegration_AuthRejected(t *testing.T) {
+	core := tunneltest.NewCore(tunneltest.Options{Token: "secret"})
+	defer core.Close()
+
+	a := startAgent(t, core, "wrong", "http://127.0.0.1:1")
+	conn := core.Accept(t)
+	if conn.Authenticated() {
+		t.Fatal("Core accepted a wrong token")
+	}
+	if err := a.authResult(t); err == nil || !strings.Contains(err.Error(), "invalid token") {
+		t.Errorf("auth error = %v, want invalid token", err)
+	}
+	// Chưa xác thực, agent không xử lý stream frames của Core
+	conn.Run(t, tunneltest.Script{
+		tunneltest.SendFrame(tunneltest.Request(1, "GET / HTTP/1.1\r\nHost: app\r\n\r\n")),
+		tunneltest.Wait(50 * time.Millisecond),
+	})
+	if n := len(a.streams.Snapshot()); n != 0 {
+		t.Errorf("unauthenticated agent opened %d streams", n)
+	}
+}
+
+func TestIntegration_Request(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Write(append([]byte("echo:"), body...))
+	}))
+	defer backend.Close()
+	core := tunneltest.NewCore(tunneltest.Options{})
+	defer core.Close()
+
+	startAgent(t, core, "", backend.URL)
+	conn := core.Accept(t)
+	conn.Run(t, tunneltest.Script{
+		tunneltest.SendFrame(tunneltest.Request(1, "POST /items HTTP/1.1\r\nHost: app\r\nContent-Length: 5\r\n\r\n")),
+		tunneltest.SendFrame(tunneltest.Data(1, []byte("hello"), v1.FlagEndStream)),
+	})
+	resp := conn.Response(t, 1)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Path") != "/items" || string(body) != "echo:hello" {
+		t.Errorf("response = %d %v %q", resp.StatusCode, resp.Header, body)
+	}
+}
+
+func TestIntegration_TraceID(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Seen-Trace", r.Header.Get(client.TraceHeader))
+	}))
+	defer backend.Close()
+	core := tunneltest.NewCore(tunneltest.Options{})
+	defer core.Close()
+
+	startAgent(t, core, "", backend.URL)
+	conn := core.Accept(t)
+	conn.Run(t, tunneltest.Script{
+		tunneltest.SendFrame(tunneltest.Open(1, client.StreamKindHTTP, map[string]string{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"},
+			[]byte("GET / HTTP/1.1\r\nHost: app\r\nX-Tunnel-Trace-Id: spoofed\r\n\r\n"))),
+		tunneltest.SendFrame(tunneltest.End(1)),
+	})
+	resp := conn.Response(t, 1)
+	if got := resp.Header.Get("X-Seen-Trace"); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("local service saw trace ID %q, want Core's", got)
+	}
+	if got := resp.Header.Get(client.TraceHeader); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("response trace ID = %q, want Core's", got)
+	}
+}
+
+func TestIntegration_StreamingResponse(t *testing.T) {
+	const chunks = 5
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < chunks; i++ {
+			io.WriteString(w, strings.Repeat("x", 64<<10))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer backend.Close()
+	core := tunneltest.NewCore(tunneltest.Options{})
+	defer core.Close()
+
+	startAgent(t, core, "", backend.URL)
+	conn := core.Accept(t)
+	conn.Run(t, tunneltest.Script{
+		tunneltest.SendFrame(tunneltest.Request(1, "GET /download HTTP/1.1\r\nHost: app\r\n\r\n")),
+		tunneltest.SendFrame(tunneltest.End(1)),
+	})
+	resp := conn.Response(t, 1)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || len(body) != chunks*64<<10 {
+		t.Errorf("streamed body = %d bytes (%v), want %d", len(body), err, chunks*64<<10)
+	}
+}
+
+func TestIntegration_LocalServiceDown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := "http://" + listener.Addr().String()
+	listener.Close()
+	core := tunneltest.NewCore(tunneltest.Options{})
+	defer core.Close()
+
+	startAgent(t, core, "", down)
+	conn := core.Accept(t)
+	conn.Run(t, tunneltest.Script{
+		tunneltest.SendFrame(tunneltest.Request(1, "GET / HTTP/1.1\r\nHost: app\r\n\r\n")),
+		tunneltest.SendFrame(tunneltest.End(1)),
+		tunneltest.ExpectFrame(tunneltest.Stream(1), tunneltest.Flags(v1.FlagError), tunneltest.PayloadContains("connection refused")),
+	})
+}
+
+func TestIntegration_InvalidStreamID(t *testing.T) {
+	core := tunneltest.NewCore(tunneltest.Options{})
+	defer core.Close()
+
+	startAgent(t, core, "", "http://127.0.0.1:1")
+	conn := core.Accept(t)
+	// Core chỉ được mở odd stream IDs: agent reset stream thay vì xử lý
+	conn.Run(t, tunneltest.Script{
+		tunneltest.SendFrame(tunneltest.Request(2, "GET / HTTP/1.1\r\nHost: app\r\n\r\n")),
+		tunneltest.ExpectFrame(tunneltest.Stream(2), tunneltest.Reset(client.ResetProtocolError)),
+	})
+}
+
+func TestIntegration_StreamLimitReset(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer backend.Close()
+	defer close(release)
+	core := tunneltest.NewCore(tunneltest.Options{})
+	defer core.Close()
+
+	startAgentWith(t, core, "", backend.URL, client.StreamManagerOptions{MaxRemoteStreams: 1})
+	conn := core.Accept(t)
+	// Stream 1 chiếm chỗ duy nhất; Core nhận reset ngay cho stream 3
+	conn.Run(t, tunneltest.Script{
+		tunneltest.SendFrame(tunneltest.Request(1, "GET /slow HTTP/1.1\r\nHost: app\r\n\r\n")),
+		tunneltest.SendFrame(tunneltest.Request(3, "GET / HTTP/1.1\r\nHost: app\r\n\r\n")),
+		tunneltest.ExpectFrame(tunneltest.Stream(3), tunneltest.Reset(client.ResetStreamLimit)),
+	})
+}
+
+func TestIntegration_ReconnectAfterDrop(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	core := tunneltest.NewCore(tunneltest.Options{})
+	defer core.Close()
+
+	startAgent(t, core, "", backend.URL)
+	first := core.Accept(t)
+	first.Run(t, tunneltest.Script{tunneltest.Drop()})
+
+	// Agent kết nối và xác thực lại; Core mới bắt đầu lại stream IDs từ 1
+	second := core.Accept(t)
+	if !second.Authenticated() {
+		t.Fatal("agent did not authenticate after reconnecting")
+	}
+	second.Run(t, tunneltest.Script{
+		tunneltest.SendFrame(tunneltest.Request(1, "GET / HTTP/1.1\r\nHost: app\r\n\r\n")),
+		tunneltest.SendFrame(tunneltest.End(1)),
+		tunneltest.ExpectResponse(1, http.StatusOK),
+	})
+}
@@ -0,0 +1,257 @@
+package tunneltest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydragon2m/tunnel-agent/client"
+	v1 "github.com/hydragon2m/tunnel-protocol/go/v1"
+)
+
+// Next returns the next frame the agent sent, other than the auth and
+// heartbeat frames the Core answers itself. The test fails if the agent
+// sends nothing within the timeout or disconnects.
+func (c *Conn) Next(t testing.TB) *v1.Frame {
+	t.Helper()
+	if len(c.backlog) > 0 {
+		frame := c.backlog[0]
+		c.backlog = c.backlog[1:]
+		return frame
+	}
+	select {
+	case frame := <-c.frames:
+		return frame
+	case <-c.closed:
+		// Frames read before the disconnect are still delivered
+		select {
+		case frame := <-c.frames:
+			return frame
+		default:
+		}
+		t.Fatalf("tunneltest: agent disconnected: %v", c.err)
+	case <-time.After(c.core.opts.Timeout):
+		t.Fatalf("tunneltest: no frame from agent within %s", c.core.opts.Timeout)
+	}
+	return nil
+}
+
+// Expect returns the next frame and fails the test unless it matches every
+// matcher
+func (c *Conn) Expect(t testing.TB, matchers ...Matcher) *v1.Frame {
+	t.Helper()
+	frame := c.Next(t)
+	for _, match := range matchers {
+		if err := match(frame); err != nil {
+			t.Fatalf("tunneltest: unexpected %s: %v", Describe(frame), err)
+		}
+	}
+	return frame
+}
+
+// ExpectClosed fails the test unless the agent closes the connection within
+// the timeout. Frames still queued are discarded.
+func (c *Conn) ExpectClosed(t testing.TB) {
+	t.Helper()
+	select {
+	case <-c.closed:
+	case <-time.After(c.core.opts.Timeout):
+		t.Fatalf("tunneltest: agent kept the connection open for %s", c.core.opts.Timeout)
+	}
+}
+
+// Response collects the FrameData payloads of streamID until EndStream or an
+// error frame and parses them as an HTTP response. Frames of other streams
+// are kept for Next. An error frame fails the test; use Expect with
+// Flags(v1.FlagError) to assert on error paths.
+func (c *Conn) Response(t testing.TB, streamID uint32) *http.Response {
+	t.Helper()
+	var (
+		body    bytes.Buffer
+		skipped []*v1.Frame
+	)
+	defer func() { c.backlog = append(c.backlog, skipped...) }()
+	for {
+		frame := c.Next(t)
+		if frame.StreamID != streamID {
+			skipped = append(skipped, frame)
+			continue
+		}
+		if frame.Flags&v1.FlagError != 0 || frame.Type == v1.FrameClose {
+			t.Fatalf("tunneltest: stream %d failed: %s %q", streamID, Describe(frame), frame.Payload)
+		}
+		body.Write(frame.Payload)
+		if frame.IsEndStream() {
+			break
+		}
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(&body), nil)
+	if err != nil {
+		t.Fatalf("tunneltest: stream %d is not an HTTP response: %v", streamID, err)
+	}
+	return resp
+}
+
+// Run executes the steps of script in order
+func (c *Conn) Run(t testing.TB, script Script) {
+	t.Helper()
+	for _, step := range script {
+		step(t, c)
+	}
+}
+
+// Script is a sequence of steps run against an agent connection
+type Script []Step
+
+// Step is one action or assertion of a Script
+type Step func(t testing.TB, c *Conn)
+
+// SendFrame sends frame to the agent
+func SendFrame(frame *v1.Frame) Step {
+	return func(t testing.TB, c *Conn) {
+		t.Helper()
+		if err := c.Send(frame); err != nil {
+			t.Fatalf("tunneltest: send %s: %v", Describe(frame), err)
+		}
+	}
+}
+
+// ExpectFrame expects the next frame to match every matcher
+func ExpectFrame(matchers ...Matcher) Step {
+	return func(t testing.TB, c *Conn) {
+		t.Helper()
+		c.Expect(t, matchers...)
+	}
+}
+
+// ExpectResponse expects an HTTP response on streamID and checks its status
+func ExpectResponse(streamID uint32, status int) Step {
+	return func(t testing.TB, c *Conn) {
+		t.Helper()
+		resp := c.Response(t, streamID)
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Fatalf("tunneltest: stream %d answered %d, want %d", streamID, resp.StatusCode, status)
+		}
+	}
+}
+
+// Drop closes the connection, like a crashed Core
+func Drop() Step {
+	return func(t testing.TB, c *Conn) {
+		c.Close()
+	}
+}
+
+// Wait pauses the script, e.g. to let the agent hit a timeout
+func Wait(d time.Duration) Step {
+	return func(testing.TB, *Conn) {
+		time.Sleep(d)
+	}
+}
+
+// Matcher checks a frame, returning why it does not match
+type Matcher func(frame *v1.Frame) error
+
+// Type matches the frame type
+func Type(want v1.FrameType) Matcher {
+	return func(frame *v1.Frame) error {
+		if frame.Type != want {
+			return fmt.Errorf("type %d, want %d", frame.Type, want)
+		}
+		return nil
+	}
+}
+
+// Stream matches the stream ID
+func Stream(id uint32) Matcher {
+	return func(frame *v1.Frame) error {
+		if frame.StreamID != id {
+			return fmt.Errorf("stream %d, want %d", frame.StreamID, id)
+		}
+		return nil
+	}
+}
+
+// Flags matches frames having every flag in want set
+func Flags(want v1.Flag) Matcher {
+	return func(frame *v1.Frame) error {
+		if frame.Flags&want != want {
+			return fmt.Errorf("flags %#x, want %#x set", frame.Flags, want)
+		}
+		return nil
+	}
+}
+
+// PayloadContains matches frames whose payload contains s
+func PayloadContains(s string) Matcher {
+	return func(frame *v1.Frame) error {
+		if !strings.Contains(string(frame.Payload), s) {
+			return fmt.Errorf("payload %q does not contain %q", truncate(frame.Payload), s)
+		}
+		return nil
+	}
+}
+
+// Reset matches a stream reset (FrameClose with FlagError) carrying code
+func Reset(code client.ResetCode) Matcher {
+	return func(frame *v1.Frame) error {
+		if frame.Type != v1.FrameClose || frame.Flags&v1.FlagError == 0 {
+			return fmt.Errorf("not a stream reset")
+		}
+		if got, reason := client.ParseReset(frame); got != code {
+			return fmt.Errorf("reset code %q (%s), want %q", got, reason, code)
+		}
+		return nil
+	}
+}
+
+// Describe formats the frame header for failure messages
+func Describe(frame *v1.Frame) string {
+	return fmt.Sprintf("frame type=%d flags=%#x stream=%d len=%d", frame.Type, frame.Flags, frame.StreamID, len(frame.Payload))
+}
+
+// truncate shortens payloads quoted in failure messages
+func truncate(payload []byte) []byte {
+	const max = 256
+	if len(payload) > max {
+		return payload[:max]
+	}
+	return payload
+}
+
+// Request returns the FrameOpenStream carrying a raw HTTP request, as Core
+// opens streams for public requests. Core-initiated stream IDs are odd.
+func Request(streamID uint32, raw string) *v1.Frame {
+	return &v1.Frame{Version: v1.Version, Type: v1.FrameOpenStream, Flags: v1.FlagNone, StreamID: streamID, Payload: []byte(raw)}
+}
+
+// Open returns a FrameOpenStream with an open header of kind and metadata
+// followed by body. It panics on metadata the open header cannot carry.
+func Open(streamID uint32, kind string, metadata map[string]string, body []byte) *v1.Frame {
+	payload, err := client.EncodeOpenPayload(kind, metadata, body)
+	if err != nil {
+		panic("tunneltest: " + err.Error())
+	}
+	return &v1.Frame{Version: v1.Version, Type: v1.FrameOpenStream, Flags: v1.FlagNone, StreamID: streamID, Payload: payload}
+}
+
+// Data returns a FrameData of streamID
+func Data(streamID uint32, payload []byte, flags v1.Flag) *v1.Frame {
+	return &v1.Frame{Version: v1.Version, Type: v1.FrameData, Flags: flags, StreamID: streamID, Payload: payload}
+}
+
+// End returns an empty FrameData ending the request side of streamID
+func End(streamID uint32) *v1.Frame {
+	return Data(streamID, nil, v1.FlagEndStream)
+}
+
+// CloseStream returns the FrameClose Core sends to abort a stream
+func CloseStream(streamID uint32) *v1.Frame {
+	return &v1.Frame{Version: v1.Version, Type: v1.FrameClose, Flags: v1.FlagNone, StreamID: streamID}
+}